@@ -0,0 +1,250 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/Turee/si/pkg/config"
+	"github.com/Turee/si/pkg/llm"
+	"github.com/Turee/si/pkg/output"
+	"github.com/Turee/si/pkg/pricing"
+	"github.com/Turee/si/pkg/redact"
+	"github.com/Turee/si/pkg/search"
+	"github.com/Turee/si/pkg/termcap"
+	"github.com/Turee/si/pkg/tools"
+)
+
+// agentBudget limits the tokens and the estimated cost of the requests of an
+// agent task, on top of max_steps. When a limit is reached the user is asked
+// whether to continue; every confirmation grants the budget once more.
+type agentBudget struct {
+	maxTokens int
+	maxCost   float64
+	model     string
+	usage     *usageTracker
+
+	// settings name the settings of the limits, for the error when the
+	// budget is used up
+	settings string
+
+	// start is the usage before the task started, for the budgets of
+	// sub-agents, whose usage is tracked together with their parent's
+	start llm.Usage
+
+	// grants is the number of budgets granted so far
+	grants int
+
+	// confirm asks the user whether to continue after spending the given
+	// amount; without a terminal the task stops at the limit
+	confirm func(spent string) (bool, error)
+}
+
+// check returns an error if the task used up its budget and the user doesn't
+// want to continue
+func (b *agentBudget) check() error {
+	for b.exceeded() {
+		spent := b.spent()
+		if b.confirm == nil {
+			return fmt.Errorf("the agent stopped after using %s, the budget of a task set by %s", spent, b.settings)
+		}
+		ok, err := b.confirm(spent)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return fmt.Errorf("the agent stopped after using %s", spent)
+		}
+		b.grants++
+	}
+	return nil
+}
+
+// exceeded reports whether the usage so far reached one of the limits
+func (b *agentBudget) exceeded() bool {
+	used := b.used()
+	if b.maxTokens > 0 && used.TotalTokens >= b.maxTokens*b.grants {
+		return true
+	}
+	if cost, ok := pricing.Estimate(b.model, used); b.maxCost > 0 && ok {
+		return cost >= b.maxCost*float64(b.grants)
+	}
+	return false
+}
+
+// spent describes the usage so far
+func (b *agentBudget) spent() string {
+	used := b.used()
+	spent := fmt.Sprintf("%d tokens", used.TotalTokens)
+	if cost, ok := pricing.Estimate(b.model, used); ok {
+		spent += fmt.Sprintf(" (estimated cost $%.4f)", cost)
+	}
+	return spent
+}
+
+// used returns the usage of the task so far
+func (b *agentBudget) used() llm.Usage {
+	return llm.Usage{
+		PromptTokens:     b.usage.usage.PromptTokens - b.start.PromptTokens,
+		CompletionTokens: b.usage.usage.CompletionTokens - b.start.CompletionTokens,
+		TotalTokens:      b.usage.usage.TotalTokens - b.start.TotalTokens,
+		CachedTokens:     b.usage.usage.CachedTokens - b.start.CachedTokens,
+	}
+}
+
+// newToolLoop sets up the tools of agent mode. Shell commands and API
+// requests that may change data are confirmed on the terminal; without one
+// the model can't run commands or send such requests. URLs may only be
+// fetched from the allowed domains, since the model chooses them, and the web
+// can only be searched with a configured search engine. The usage
+// tracked by usage counts against the budget of agent.max_tokens and
+// agent.max_cost. The files and URLs the tools read are added to sources,
+// and the secrets in the results of the tools are redacted by redactor.
+func newToolLoop(cfg *config.Config, provider llm.Provider, usage *usageTracker, sources *sourceList, redactor *redact.Redactor) (*llm.ToolLoop, func(), error) {
+	caller, ok := provider.(llm.ToolCaller)
+	if !ok {
+		return nil, nil, fmt.Errorf("the configured provider does not support tool calling")
+	}
+
+	caps := stderrCapabilities(cfg)
+	opts := tools.Options{Shell: userShell(), Policy: cfg.Fetch.Policy(true), Cite: sources.add, SearchResults: cfg.Search.MaxResults}
+	if redactor != nil {
+		opts.Redact = redactor.Redact
+	}
+	if cfg.Search.Backend != "" {
+		searcher, err := search.New(search.Options{
+			Backend: cfg.Search.Backend,
+			URL:     cfg.Search.URL,
+			APIKey:  cfg.Search.APIKey,
+			Client:  &http.Client{Timeout: fetchTimeout},
+		})
+		if err != nil {
+			return nil, nil, fmt.Errorf("search: %w", err)
+		}
+		opts.Search = searcher
+	}
+	budget := &agentBudget{
+		maxTokens: cfg.Agent.MaxTokens,
+		maxCost:   cfg.Agent.MaxCost,
+		model:     modelName(cfg),
+		usage:     usage,
+		settings:  "agent.max_tokens or agent.max_cost",
+		grants:    1,
+	}
+	cleanup := func() {}
+	if term, err := newTerminal(); err == nil {
+		cleanup = func() { term.Close() }
+		// The questions wait for the segment of the answer being written
+		confirm := func(text, question string) (ok bool, err error) {
+			stderr.exclusive(func() {
+				fmt.Fprint(os.Stderr, text)
+				var choice string
+				choice, err = term.choose(question, []string{"yes", "no"}, "no")
+				ok = choice == "yes"
+			})
+			return ok, err
+		}
+		opts.Confirm = func(command string) (bool, error) {
+			return confirm(fmt.Sprintf("\n  %s\n\n", caps.Bold(command)), "Run this command")
+		}
+		opts.ConfirmRequest = func(request string) (bool, error) {
+			return confirm(fmt.Sprintf("\n  %s\n\n", caps.Bold(request)), "Send this request")
+		}
+		budget.confirm = func(spent string) (bool, error) {
+			return confirm(fmt.Sprintf("\nThe agent used %s, its budget for a task.\n", spent), "Continue")
+		}
+	}
+
+	toolbox := llm.NewToolbox()
+	if err := tools.Register(toolbox, cfg.Agent.Tools, opts); err != nil {
+		cleanup()
+		return nil, nil, fmt.Errorf("agent.tools: %w", err)
+	}
+	if err := registerAPIs(toolbox, cfg.Agent.APIs, opts); err != nil {
+		cleanup()
+		return nil, nil, err
+	}
+
+	onCall := func(agent string) func(call llm.ToolCall) {
+		return func(call llm.ToolCall) {
+			fmt.Fprintln(stderr, caps.Foreground(fmt.Sprintf("%sCalling %s %s", agent, call.Name, call.Arguments), termcap.Cyan))
+		}
+	}
+	if err := registerSubagents(toolbox, cfg, caller, opts, usage, onCall); err != nil {
+		cleanup()
+		return nil, nil, err
+	}
+
+	loop := &llm.ToolLoop{
+		Provider:   caller,
+		Toolbox:    toolbox,
+		MaxSteps:   cfg.Agent.MaxSteps,
+		OnCall:     onCall(""),
+		BeforeStep: budget.check,
+	}
+	return loop, cleanup, nil
+}
+
+// answerWithTools answers the question in agent mode, letting the model call
+// tools until it produces the answer. The answer is printed like the answers
+// of answerQuestion, followed by footnotes citing the files and URLs the tools
+// read.
+func answerWithTools(cfg *config.Config, provider llm.Provider, question string, images []llm.ContentPart, printer *answerPrinter, usage *usageTracker, sources *sourceList, redactor *redact.Redactor) (string, error) {
+	loop, cleanup, err := newToolLoop(cfg, provider, usage, sources, redactor)
+	if err != nil {
+		return "", err
+	}
+	defer cleanup()
+
+	// Secrets the tools came across are only known once the task is done
+	redacted := redactor.Count()
+	defer func() {
+		if redactor.Count() > redacted {
+			warnRedacted(redactor)
+		}
+	}()
+
+	ctx, stop := notifyInterrupt(context.Background())
+	defer stop()
+
+	var answer strings.Builder
+	messages := []llm.Message{llm.NewUserMessage(question, images...)}
+
+	if printer != nil {
+		_, err := loop.Run(ctx, messages, func(chunk string) error {
+			answer.WriteString(chunk)
+			if printer.stream == nil {
+				return nil
+			}
+			return printer.stream(chunk)
+		})
+		if err != nil {
+			return "", fmt.Errorf("error asking question: %w", err)
+		}
+		return answer.String(), printer.print(answer.String())
+	}
+
+	stream := output.NewStreamWriter(answerOutput(), streamFlushMode())
+	defer stderr.streaming(stream)()
+	_, err = loop.Run(ctx, messages, func(chunk string) error {
+		answer.WriteString(chunk)
+		_, err := stream.WriteString(chunk)
+		return err
+	})
+	if answer.Len() > 0 || err == nil {
+		stream.WriteString("\n")
+	}
+	if err == nil {
+		err = output.WriteFootnotes(stream, sources.sources)
+	}
+	if flushErr := stream.Flush(); err == nil {
+		err = flushErr
+	}
+
+	if err != nil {
+		return "", fmt.Errorf("error asking question: %w", err)
+	}
+	return answer.String(), nil
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Turee/si/pkg/config"
+	"github.com/Turee/si/pkg/llm"
+	"github.com/Turee/si/pkg/output"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// toolProvider is a mock provider that calls the given tools once and then
+// answers with the results it got back
+type toolProvider struct {
+	*MockProvider
+	calls   []llm.ToolCall
+	results []string
+
+	// tokens are reported as the usage of every request
+	tokens  int
+	onUsage func(llm.Usage)
+}
+
+func (p *toolProvider) SetUsageCallback(callback func(llm.Usage)) {
+	p.onUsage = callback
+}
+
+func (p *toolProvider) ChatTools(ctx context.Context, messages []llm.Message, tools []llm.Tool, callback func(chunk string) error) ([]llm.ToolCall, error) {
+	if p.onUsage != nil && p.tokens > 0 {
+		p.onUsage(llm.Usage{TotalTokens: p.tokens})
+	}
+	last := messages[len(messages)-1]
+	if last.Role != llm.RoleTool {
+		return p.calls, nil
+	}
+
+	for _, message := range messages {
+		if message.Role == llm.RoleTool {
+			p.results = append(p.results, message.Text())
+		}
+	}
+	return nil, callback("Done")
+}
+
+// mockAgentEnvironment sets up a tool calling provider; answers are what the
+// user types on the terminal
+func mockAgentEnvironment(t *testing.T, answers string, calls ...llm.ToolCall) *toolProvider {
+	mockCommandEnvironment(t, "", false, answers)
+	mockUsagePath(t)
+	t.Cleanup(func() { CLI.Agent = false })
+
+	provider := &toolProvider{MockProvider: &MockProvider{}, calls: calls}
+	llm.NewProvider = func(cfg *config.Config) (llm.Provider, error) {
+		return provider, nil
+	}
+	return provider
+}
+
+// TestAgentReadFile tests answering with the result of a tool call
+func TestAgentReadFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "notes.txt")
+	require.NoError(t, os.WriteFile(path, []byte("buy milk"), 0644))
+	provider := mockAgentEnvironment(t, "", llm.ToolCall{ID: "call_1", Name: "read_file", Arguments: `{"path":"` + path + `"}`})
+
+	stdout, stderr := runMainOutput(t, "--agent", "what", "is", "in", "my", "notes?")
+	assert.Equal(t, "Done\n\nSources:\n[1] "+path+"\n", stdout)
+	assert.Contains(t, stderr, "Calling read_file")
+	assert.Equal(t, []string{"buy milk"}, provider.results)
+
+	// JSON output lists the sources instead
+	defer func() { CLI.Output = "text" }()
+	stdout = runMain(t, "--agent", "--output", "json", "what", "is", "in", "my", "notes?")
+	var response struct {
+		Answer  string          `json:"answer"`
+		Sources []output.Source `json:"sources"`
+	}
+	require.NoError(t, json.Unmarshal([]byte(stdout), &response))
+	assert.Equal(t, "Done", response.Answer)
+	assert.Equal(t, []output.Source{{Path: path}}, response.Sources)
+}
+
+// TestAgentShellConfirmation tests that shell commands only run when the
+// user confirms them
+func TestAgentShellConfirmation(t *testing.T) {
+	provider := mockAgentEnvironment(t, "y\n", llm.ToolCall{ID: "call_1", Name: "shell", Arguments: `{"command":"echo hello"}`})
+	t.Setenv("SHELL", "/bin/sh")
+
+	_, stderr := runMainOutput(t, "--agent", "say", "hello")
+	assert.Contains(t, stderr, "echo hello")
+	assert.Equal(t, []string{"hello\nexit code 0"}, provider.results)
+
+	provider = mockAgentEnvironment(t, "\n", llm.ToolCall{ID: "call_1", Name: "shell", Arguments: `{"command":"rm -rf /"}`})
+	runMain(t, "--agent", "clean", "up")
+	assert.Equal(t, []string{"The user declined to run the command."}, provider.results)
+}
+
+// TestAgentUnsupportedProvider tests that agent mode requires tool calling
+func TestAgentUnsupportedProvider(t *testing.T) {
+	mockCommandEnvironment(t, "Paris", false, "")
+	defer func() { CLI.Agent = false }()
+
+	output, stderr := runMainOutput(t, "--agent", "capital", "of", "France?")
+	assert.Empty(t, output)
+	assert.Contains(t, stderr, "does not support tool calling")
+}
+
+// TestAgentBudget tests that the user is asked whether to continue when a
+// task reaches agent.max_tokens
+func TestAgentBudget(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "notes.txt")
+	require.NoError(t, os.WriteFile(path, []byte("buy milk"), 0644))
+	call := llm.ToolCall{ID: "call_1", Name: "read_file", Arguments: `{"path":"` + path + `"}`}
+	mockBudget := func(answers string) *toolProvider {
+		provider := mockAgentEnvironment(t, answers, call)
+		provider.tokens = 60
+		loadConfigFunc = func(path string) (*config.Config, error) {
+			cfg := &config.Config{LLM: config.LLMConfig{OpenAI: config.OpenAIConfig{APIKey: "test-api-key"}}}
+			cfg.Agent.MaxTokens = 50
+			return cfg, nil
+		}
+		return provider
+	}
+
+	mockBudget("y\n")
+	output, stderr := runMainOutput(t, "--agent", "what", "is", "in", "my", "notes?")
+	assert.Contains(t, output, "Done\n")
+	assert.Contains(t, stderr, "The agent used 60 tokens")
+
+	provider := mockBudget("\n")
+	output, stderr = runMainOutput(t, "--agent", "what", "is", "in", "my", "notes?")
+	assert.Empty(t, output)
+	assert.Contains(t, stderr, "the agent stopped after using 60 tokens")
+	assert.Empty(t, provider.results)
+}
+
+// TestAgentWebSearch tests searching the web with the configured engine
+func TestAgentWebSearch(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"results":[{"title":"Go 1.24","url":"https://go.dev/doc/go1.24","content":"Released in February"}]}`))
+	}))
+	defer server.Close()
+
+	provider := mockAgentEnvironment(t, "", llm.ToolCall{ID: "call_1", Name: "web_search", Arguments: `{"query":"latest go release"}`})
+	loadConfigFunc = func(path string) (*config.Config, error) {
+		return &config.Config{
+			LLM:    config.LLMConfig{OpenAI: config.OpenAIConfig{APIKey: "test-api-key", ModelName: "gpt-4o"}},
+			Search: config.SearchConfig{Backend: "searxng", URL: server.URL},
+		}, nil
+	}
+
+	stdout, stderr := runMainOutput(t, "--agent", "latest", "go", "release?")
+	assert.Contains(t, stderr, "Calling web_search")
+	assert.Equal(t, []string{"1. Go 1.24\n   https://go.dev/doc/go1.24\n   Released in February\n"}, provider.results)
+	assert.Equal(t, "Done\n\nSources:\n[1] https://go.dev/doc/go1.24\n", stdout)
+
+	// Without a search engine the model can't search
+	provider = mockAgentEnvironment(t, "", llm.ToolCall{ID: "call_1", Name: "web_search", Arguments: `{"query":"latest go release"}`})
+	runMain(t, "--agent", "latest", "go", "release?")
+	assert.Len(t, provider.results, 1)
+	assert.Contains(t, provider.results[0], "unknown tool")
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/Turee/si/pkg/config"
+)
+
+// runAPIKeyCmd runs the api_key_cmd with the user's shell and returns what it
+// printed. Password managers may ask for a passphrase, so the command gets
+// the terminal. It can be replaced in tests.
+var runAPIKeyCmd = func(command string) (string, error) {
+	shell := userShell()
+	cmd := exec.Command(shell[0], append(shell[1:], command)...)
+	cmd.Stdin = os.Stdin
+	cmd.Stderr = os.Stderr
+	output, err := cmd.Output()
+	return string(output), err
+}
+
+// resolveAPIKey sets the API key to the output of api_key_cmd, if the config
+// has one, so keys can stay in a password manager
+func resolveAPIKey(cfg *config.Config) error {
+	openai := &cfg.LLM.OpenAI
+	if openai.APIKeyCmd == "" {
+		return nil
+	}
+
+	output, err := runAPIKeyCmd(openai.APIKeyCmd)
+	if err != nil {
+		return &authError{fmt.Errorf("llm.openai.api_key_cmd failed: %w", err)}
+	}
+	key := strings.TrimSpace(output)
+	if key == "" {
+		return &authError{fmt.Errorf("llm.openai.api_key_cmd printed no API key")}
+	}
+
+	openai.APIKey = key
+	openai.APIKeyCmd = ""
+	return nil
+}
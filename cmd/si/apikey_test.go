@@ -0,0 +1,48 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/Turee/si/pkg/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestResolveAPIKey tests taking the API key from the output of api_key_cmd
+func TestResolveAPIKey(t *testing.T) {
+	t.Setenv("SHELL", "/bin/sh")
+
+	cfg := &config.Config{LLM: config.LLMConfig{OpenAI: config.OpenAIConfig{APIKeyCmd: "echo sk-from-cmd"}}}
+	require.NoError(t, resolveAPIKey(cfg))
+	assert.Equal(t, "sk-from-cmd", cfg.LLM.OpenAI.APIKey)
+	assert.Empty(t, cfg.LLM.OpenAI.APIKeyCmd)
+	require.NoError(t, cfg.Validate())
+
+	cfg.LLM.OpenAI = config.OpenAIConfig{APIKeyCmd: "exit 3"}
+	assert.ErrorContains(t, resolveAPIKey(cfg), "llm.openai.api_key_cmd failed: exit status 3")
+
+	cfg.LLM.OpenAI = config.OpenAIConfig{APIKeyCmd: "true"}
+	assert.EqualError(t, resolveAPIKey(cfg), "llm.openai.api_key_cmd printed no API key")
+
+	// Without a command the configured key is used
+	cfg.LLM.OpenAI = config.OpenAIConfig{APIKey: "sk-file"}
+	require.NoError(t, resolveAPIKey(cfg))
+	assert.Equal(t, "sk-file", cfg.LLM.OpenAI.APIKey)
+}
+
+// TestAPIKeyCmdFailure tests that questions aren't asked without a key
+func TestAPIKeyCmdFailure(t *testing.T) {
+	mockCommandEnvironment(t, "Paris", false, "")
+	loadConfigFunc = func(path string) (*config.Config, error) {
+		return &config.Config{LLM: config.LLMConfig{OpenAI: config.OpenAIConfig{APIKeyCmd: "op read op://vault/openai"}}}, nil
+	}
+	oldRunAPIKeyCmd := runAPIKeyCmd
+	t.Cleanup(func() { runAPIKeyCmd = oldRunAPIKeyCmd })
+	runAPIKeyCmd = func(command string) (string, error) {
+		return "", assert.AnError
+	}
+
+	output, stderr := runMainOutput(t, "capital", "of", "France?")
+	assert.Empty(t, output)
+	assert.Contains(t, stderr, "Error: llm.openai.api_key_cmd failed")
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/Turee/si/pkg/cache"
+	"github.com/Turee/si/pkg/config"
+	"github.com/Turee/si/pkg/llm"
+)
+
+// cachePath returns the path of the answer cache, it can be replaced in tests
+var cachePath = cache.DefaultPath
+
+// Ways a cached answer can match a question
+const (
+	cacheMatchExact   = "exact"
+	cacheMatchSimilar = "similar"
+)
+
+// answerCache looks up and stores answers as configured. A nil answerCache
+// is a disabled cache.
+type answerCache struct {
+	cfg      config.CacheConfig
+	cache    *cache.Cache
+	embedder llm.Embedder
+
+	// embedding is the embedding of the last looked up question, so it
+	// doesn't have to be computed again when the answer is stored
+	embedding []float32
+}
+
+// openAnswerCache opens the answer cache if it is enabled. Problems with the
+// cache only disable it, they never keep the question from being answered.
+func openAnswerCache(cfg *config.Config, provider llm.Provider) *answerCache {
+	if cfg.Cache.Mode == "" || CLI.NoCache || CLI.Ephemeral {
+		return nil
+	}
+
+	c, err := cache.Open(cachePath(), cfg.Cache.MaxAge())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: answer cache disabled: %v\n", err)
+		return nil
+	}
+
+	a := &answerCache{cfg: cfg.Cache, cache: c}
+	if a.cfg.EmbeddingModel == "" {
+		a.cfg.EmbeddingModel = cfg.Embed.Model
+	}
+	if cfg.Cache.Mode == config.CacheSemantic {
+		embedder, ok := provider.(llm.Embedder)
+		if !ok {
+			fmt.Fprintln(os.Stderr, "Warning: the provider can't compute embeddings, only identical questions are answered from the cache")
+		}
+		a.embedder = embedder
+	}
+	return a
+}
+
+// lookup returns the cached answer of the model to the question and how the
+// question matched. The match is reported on stderr.
+func (a *answerCache) lookup(model, question string) (string, string, bool) {
+	if a == nil {
+		return "", "", false
+	}
+
+	if entry, ok := a.cache.Lookup(model, question); ok {
+		fmt.Fprintln(os.Stderr, "cached")
+		return entry.Answer, cacheMatchExact, true
+	}
+
+	if a.embedder == nil {
+		return "", "", false
+	}
+
+	embeddings, err := a.embedder.Embed(context.Background(), a.embeddingModel(), []string{question})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to look up similar questions: %v\n", err)
+		a.embedder = nil
+		return "", "", false
+	}
+	a.embedding = embeddings[0]
+
+	entry, similarity, ok := a.cache.LookupSimilar(model, a.embeddingModel(), a.embedding, a.cfg.MinSimilarity())
+	if !ok {
+		return "", "", false
+	}
+	fmt.Fprintf(os.Stderr, "cached (similar): answer to %q, similarity %.2f\n", entry.Prompt, similarity)
+	return entry.Answer, cacheMatchSimilar, true
+}
+
+// store adds the answer of the model to the cache
+func (a *answerCache) store(model, question, answer string) {
+	if a == nil {
+		return
+	}
+
+	entry := cache.Entry{Time: time.Now(), Model: model, Prompt: question, Answer: answer}
+	if a.embedding != nil {
+		entry.Embedding, entry.EmbeddingModel = a.embedding, a.embeddingModel()
+	}
+
+	if err := a.cache.Add(entry); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to cache the answer: %v\n", err)
+	}
+}
+
+// embeddingModel returns the configured embedding model or the default
+func (a *answerCache) embeddingModel() string {
+	if a.cfg.EmbeddingModel == "" {
+		return llm.DefaultEmbeddingModel
+	}
+	return a.cfg.EmbeddingModel
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Turee/si/pkg/config"
+	"github.com/Turee/si/pkg/llm"
+	"github.com/stretchr/testify/assert"
+)
+
+// embedProvider is a mock provider that computes embeddings from a table and
+// counts the questions it was asked
+type embedProvider struct {
+	*MockProvider
+	vectors   map[string][]float32
+	questions int
+}
+
+func (p *embedProvider) ChatStream(ctx context.Context, messages []llm.Message, callback func(chunk string) error) error {
+	p.questions++
+	return p.MockProvider.ChatStream(ctx, messages, callback)
+}
+
+func (p *embedProvider) Embed(ctx context.Context, model string, texts []string) ([][]float32, error) {
+	embeddings := make([][]float32, len(texts))
+	for i, text := range texts {
+		embeddings[i] = p.vectors[text]
+	}
+	return embeddings, nil
+}
+
+// mockCachePath points the answer cache to a temporary file
+func mockCachePath(t *testing.T) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "responses.jsonl")
+	oldCachePath := cachePath
+	t.Cleanup(func() { cachePath = oldCachePath })
+	cachePath = func() string { return path }
+	return path
+}
+
+// mockCacheEnvironment sets up a provider and a configuration with the
+// answer cache in the given mode
+func mockCacheEnvironment(t *testing.T, mode string) *embedProvider {
+	mockCommandEnvironment(t, "", false, "")
+	mockUsagePath(t)
+	mockCachePath(t)
+
+	loadConfigFunc = func(path string) (*config.Config, error) {
+		return &config.Config{
+			LLM:   config.LLMConfig{OpenAI: config.OpenAIConfig{APIKey: "test-api-key"}},
+			Cache: config.CacheConfig{Mode: mode},
+		}, nil
+	}
+	provider := &embedProvider{
+		MockProvider: &MockProvider{AskResponse: "Paris"},
+		vectors: map[string][]float32{
+			"capital of France?":             {1, 0, 0},
+			"what is the capital of France?": {0.99, 0.05, 0},
+			"capital of Spain?":              {0, 1, 0},
+		},
+	}
+	llm.NewProvider = func(cfg *config.Config) (llm.Provider, error) {
+		return provider, nil
+	}
+	return provider
+}
+
+// TestExactCache tests answering repeated questions from the cache
+func TestExactCache(t *testing.T) {
+	provider := mockCacheEnvironment(t, config.CacheExact)
+
+	output, stderr := runMainOutput(t, "capital", "of", "France?")
+	assert.Equal(t, "Paris\n", output)
+	assert.NotContains(t, stderr, "cached")
+
+	output, stderr = runMainOutput(t, "capital", "of", "France?")
+	assert.Equal(t, "Paris\n", output)
+	assert.Contains(t, stderr, "cached")
+	assert.Equal(t, 1, provider.questions)
+
+	// Similar questions are only answered from the cache in semantic mode
+	runMain(t, "what", "is", "the", "capital", "of", "France?")
+	assert.Equal(t, 2, provider.questions)
+
+	// --no-cache bypasses the cache
+	defer func() { CLI.NoCache = false }()
+	runMain(t, "--no-cache", "capital", "of", "France?")
+	assert.Equal(t, 3, provider.questions)
+}
+
+// TestNoState tests that --no-state keeps the cache from being written
+func TestNoState(t *testing.T) {
+	provider := mockCacheEnvironment(t, config.CacheExact)
+	path := cachePath()
+	defer func() { CLI.NoState = false }()
+
+	output := runMain(t, "--no-state", "capital", "of", "France?")
+	assert.Equal(t, "Paris\n", output)
+	assert.NoFileExists(t, path)
+
+	// Answers cached before are still used
+	CLI.NoState = false
+	runMain(t, "capital", "of", "France?")
+	assert.FileExists(t, path)
+	data, _ := os.ReadFile(path)
+
+	_, stderr := runMainOutput(t, "--no-state", "capital", "of", "France?")
+	assert.Contains(t, stderr, "cached")
+	assert.Equal(t, 2, provider.questions)
+	after, _ := os.ReadFile(path)
+	assert.Equal(t, string(data), string(after))
+}
+
+// TestEphemeral tests that --ephemeral neither uses nor writes local state
+// and asks the provider not to store the request
+func TestEphemeral(t *testing.T) {
+	provider := mockCacheEnvironment(t, config.CacheExact)
+	path := cachePath()
+	defer func() { CLI.Ephemeral = false }()
+
+	var store *bool
+	llm.NewProvider = func(cfg *config.Config) (llm.Provider, error) {
+		store = cfg.LLM.OpenAI.Store
+		return provider, nil
+	}
+
+	runMain(t, "capital", "of", "France?")
+	assert.Nil(t, store)
+	data, _ := os.ReadFile(path)
+
+	_, stderr := runMainOutput(t, "--ephemeral", "capital", "of", "France?")
+	assert.NotContains(t, stderr, "cached")
+	assert.Equal(t, 2, provider.questions)
+	if assert.NotNil(t, store) {
+		assert.False(t, *store)
+	}
+	after, _ := os.ReadFile(path)
+	assert.Equal(t, string(data), string(after))
+}
+
+// TestSemanticCache tests answering similar questions from the cache
+func TestSemanticCache(t *testing.T) {
+	provider := mockCacheEnvironment(t, config.CacheSemantic)
+
+	runMain(t, "capital", "of", "France?")
+	assert.Equal(t, 1, provider.questions)
+
+	output, stderr := runMainOutput(t, "what", "is", "the", "capital", "of", "France?")
+	assert.Equal(t, "Paris\n", output)
+	assert.Contains(t, stderr, `cached (similar): answer to "capital of France?", similarity 1.00`)
+	assert.Equal(t, 1, provider.questions)
+
+	provider.AskResponse = "Madrid"
+	output, stderr = runMainOutput(t, "capital", "of", "Spain?")
+	assert.Equal(t, "Madrid\n", output)
+	assert.False(t, strings.Contains(stderr, "cached"))
+	assert.Equal(t, 2, provider.questions)
+
+	// Output templates can tell cached answers apart
+	defer func() { CLI.Format = "" }()
+	output = runMain(t, "--format", "template={{.Cached}}: {{.Content}}", "capital", "of", "Spain?")
+	assert.Equal(t, "exact: Madrid\n", output)
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/Turee/si/pkg/clipboard"
+	"github.com/Turee/si/pkg/output"
+	"github.com/alecthomas/kong"
+)
+
+// pasteFromClipboard reads the clipboard, it can be replaced in tests
+var pasteFromClipboard = clipboard.Read
+
+// copyFlag is the value of --copy. The flag alone copies the answer,
+// --copy=code only its first code block.
+type copyFlag struct {
+	Enabled bool
+	Code    bool
+}
+
+// Decode implements kong.MapperValue. Only --copy=VALUE takes a value, so
+// the word after --copy stays part of the question.
+func (c *copyFlag) Decode(ctx *kong.DecodeContext) error {
+	c.Enabled = true
+
+	if token := ctx.Scan.Peek(); token.Type == kong.FlagValueToken {
+		switch value := fmt.Sprint(ctx.Scan.Pop().Value); value {
+		case "answer":
+		case "code":
+			c.Code = true
+		default:
+			return fmt.Errorf("invalid --copy %q, use answer or code", value)
+		}
+	}
+	return nil
+}
+
+// IsBool implements kong.BoolMapperValue, so the flag doesn't require a value
+func (c *copyFlag) IsBool() bool {
+	return true
+}
+
+// pasteInput returns the text on the clipboard for --paste, which takes the
+// place of piped input
+func pasteInput(stdinContent string) (string, error) {
+	if stdinContent != "" {
+		return "", errors.New("--paste can't be combined with piped input")
+	}
+
+	text, err := pasteFromClipboard()
+	if err != nil {
+		return "", err
+	}
+	if text == "" {
+		return "", errors.New("the clipboard is empty")
+	}
+	return text, nil
+}
+
+// copyAnswer copies the answer, or its first code block, to the clipboard as
+// requested by --copy
+func copyAnswer(answer string) error {
+	if !CLI.Copy.Enabled {
+		return nil
+	}
+
+	text := answer
+	if CLI.Copy.Code {
+		blocks := output.CodeBlocks(answer)
+		if len(blocks) == 0 {
+			return fmt.Errorf("%w to copy", errNoCode)
+		}
+		text = blocks[0].Code
+	}
+
+	if err := copyToClipboard(text); err != nil {
+		return err
+	}
+	fmt.Fprintln(os.Stderr, "Copied to clipboard.")
+	return nil
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"os"
+	"testing"
+
+	"github.com/Turee/si/pkg/clipboard"
+	"github.com/alecthomas/kong"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// mockClipboard replaces the system clipboard with the returned text
+func mockClipboard(t *testing.T, text string) *string {
+	t.Helper()
+
+	oldCopy, oldPaste := copyToClipboard, pasteFromClipboard
+	t.Cleanup(func() {
+		copyToClipboard, pasteFromClipboard = oldCopy, oldPaste
+		CLI.Copy = copyFlag{}
+	})
+	copyToClipboard = func(s string) error {
+		text = s
+		return nil
+	}
+	pasteFromClipboard = func() (string, error) {
+		return text, nil
+	}
+	return &text
+}
+
+// TestPaste tests taking the input of the question from the clipboard
+func TestPaste(t *testing.T) {
+	provider := mockCommandEnvironment(t, "It's a panic.", false, "")
+	mockUsagePath(t)
+	mockClipboard(t, "panic: runtime error\n")
+
+	output, _ := runMainOutput(t, "--no-stream", "--paste", "explain")
+	assert.Equal(t, "It's a panic.\n", output)
+	assert.Equal(t, "explain\n\nContext:\npanic: runtime error\n", provider.QuestionAsked)
+
+	// The clipboard alone is the question
+	runMainOutput(t, "--no-stream", "--paste")
+	assert.Equal(t, "panic: runtime error\n", provider.QuestionAsked)
+
+	mockClipboard(t, "")
+	_, stderr := runMainOutput(t, "--no-stream", "--paste")
+	assert.Contains(t, stderr, "Error: the clipboard is empty")
+
+	stdinStat = func() (os.FileInfo, error) {
+		return mockFileInfo{mode: 0}, nil
+	}
+	oldStdinRead := stdinRead
+	t.Cleanup(func() { stdinRead = oldStdinRead })
+	stdinRead = func() ([]byte, error) {
+		return []byte("piped"), nil
+	}
+	_, stderr = runMainOutput(t, "--no-stream", "--paste")
+	assert.Contains(t, stderr, "Error: --paste can't be combined with piped input")
+
+	pasteFromClipboard = func() (string, error) {
+		return "", clipboard.ErrUnavailable
+	}
+	stdinStat = func() (os.FileInfo, error) {
+		return mockFileInfo{mode: os.ModeCharDevice}, nil
+	}
+	_, stderr = runMainOutput(t, "--no-stream", "--paste")
+	assert.Contains(t, stderr, "Error: "+clipboard.ErrUnavailable.Error())
+}
+
+// TestCopy tests copying the answer or its first code block to the clipboard
+func TestCopy(t *testing.T) {
+	const answer = "Sum it with awk:\n\n```awk\n{ s += $2 } END { print s }\n```\n\nor `paste | bc`."
+	mockCommandEnvironment(t, answer, false, "")
+	mockUsagePath(t)
+	copied := mockClipboard(t, "")
+
+	output, stderr := runMainOutput(t, "--no-stream", "--copy", "sum", "column", "2")
+	assert.Equal(t, answer+"\n", output)
+	assert.Equal(t, answer, *copied)
+	assert.Contains(t, stderr, "Copied to clipboard.")
+
+	*copied = ""
+	runMainOutput(t, "--no-stream", "--copy=code", "sum", "column", "2")
+	assert.Equal(t, "{ s += $2 } END { print s }\n", *copied)
+
+	// Streamed answers are copied when they are complete
+	*copied = ""
+	runMainOutput(t, "--copy", "sum", "column", "2")
+	assert.Equal(t, answer, *copied)
+}
+
+// TestCopyNoCode tests that answers without code blocks fail --copy=code
+func TestCopyNoCode(t *testing.T) {
+	mockCommandEnvironment(t, "Paris", false, "")
+	mockUsagePath(t)
+	copied := mockClipboard(t, "")
+
+	output, stderr := runMainOutput(t, "--no-stream", "--copy=code", "capital", "of", "France?")
+	assert.Equal(t, "Paris\n", output)
+	assert.Contains(t, stderr, "Error: the answer has no code block to copy")
+	assert.Empty(t, *copied)
+}
+
+// TestCopyFlag tests parsing --copy
+func TestCopyFlag(t *testing.T) {
+	var cli struct {
+		Copy     copyFlag `name:"copy"`
+		Question []string `arg:"" optional:""`
+	}
+	parser, err := kong.New(&cli)
+	require.NoError(t, err)
+
+	_, err = parser.Parse([]string{"--copy", "code", "please"})
+	require.NoError(t, err)
+	assert.Equal(t, copyFlag{Enabled: true}, cli.Copy)
+	assert.Equal(t, []string{"code", "please"}, cli.Question)
+
+	cli.Copy = copyFlag{}
+	_, err = parser.Parse([]string{"--copy=code"})
+	require.NoError(t, err)
+	assert.Equal(t, copyFlag{Enabled: true, Code: true}, cli.Copy)
+
+	_, err = parser.Parse([]string{"--copy=first"})
+	assert.ErrorContains(t, err, `invalid --copy "first", use answer or code`)
+}
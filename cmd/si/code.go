@@ -0,0 +1,82 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/Turee/si/pkg/output"
+	"github.com/alecthomas/kong"
+)
+
+// errNoCode is returned when code is requested from an answer without code
+// blocks
+var errNoCode = errors.New("the answer has no code block")
+
+// codeFlag is the value of --code. The flag alone prints every code block of
+// the answer; --code=first only the first one, and --code=LANG only the
+// blocks of a language. Values can be combined with commas, e.g.
+// --code=first,sh,bash.
+type codeFlag struct {
+	Enabled   bool
+	First     bool
+	Languages []string
+}
+
+// Decode implements kong.MapperValue. Only --code=VALUE takes a value, so the
+// word after --code stays part of the question.
+func (c *codeFlag) Decode(ctx *kong.DecodeContext) error {
+	c.Enabled = true
+
+	if token := ctx.Scan.Peek(); token.Type == kong.FlagValueToken {
+		for _, value := range strings.Split(fmt.Sprint(ctx.Scan.Pop().Value), ",") {
+			switch value = strings.ToLower(strings.TrimSpace(value)); value {
+			case "":
+			case "first":
+				c.First = true
+			default:
+				c.Languages = append(c.Languages, value)
+			}
+		}
+	}
+	return nil
+}
+
+// IsBool implements kong.BoolMapperValue, so the flag doesn't require a value
+func (c *codeFlag) IsBool() bool {
+	return true
+}
+
+// selectCode returns the code blocks of the answer selected by the flag
+func (c *codeFlag) selectCode(answer string) ([]string, error) {
+	var code []string
+	for _, block := range output.CodeBlocks(answer) {
+		if len(c.Languages) > 0 && !slices.Contains(c.Languages, strings.ToLower(block.Language)) {
+			continue
+		}
+		code = append(code, block.Code)
+		if c.First {
+			break
+		}
+	}
+
+	if len(code) == 0 && len(c.Languages) > 0 {
+		return nil, fmt.Errorf("%w in %s", errNoCode, strings.Join(c.Languages, " or "))
+	}
+	if len(code) == 0 {
+		return nil, errNoCode
+	}
+	return code, nil
+}
+
+// printCode prints the code blocks of the answer selected by --code,
+// separated by empty lines
+func printCode(answer string) error {
+	code, err := CLI.Code.selectCode(answer)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprint(answerOutput(), strings.Join(code, "\n"))
+	return err
+}
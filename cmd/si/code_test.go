@@ -0,0 +1,72 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/alecthomas/kong"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// codeAnswer is an answer with code blocks in two languages
+const codeAnswer = "Sum it with awk:\n\n```awk\n{ s += $2 } END { print s }\n```\n\nRun it like this:\n\n```bash\nawk -f sum.awk data.txt\n```\n\nor in Python:\n\n```python\nprint(sum(rows))\n```\n"
+
+// TestCodeFlag tests printing only the code blocks of the answer
+func TestCodeFlag(t *testing.T) {
+	provider := mockCommandEnvironment(t, codeAnswer, false, "")
+	mockUsagePath(t)
+	t.Cleanup(func() { CLI.Code = codeFlag{} })
+
+	output, _ := runMainOutput(t, "--code", "awk", "to", "sum", "column", "2")
+	assert.Equal(t, "{ s += $2 } END { print s }\n\nawk -f sum.awk data.txt\n\nprint(sum(rows))\n", output)
+	assert.Equal(t, "awk to sum column 2", provider.QuestionAsked)
+
+	CLI.Code = codeFlag{}
+	output, _ = runMainOutput(t, "--code=first", "sum", "column", "2")
+	assert.Equal(t, "{ s += $2 } END { print s }\n", output)
+
+	CLI.Code = codeFlag{}
+	output, _ = runMainOutput(t, "--code=sh,bash", "sum", "column", "2")
+	assert.Equal(t, "awk -f sum.awk data.txt\n", output)
+
+	CLI.Code = codeFlag{}
+	output, stderr := runMainOutput(t, "--code=go", "sum", "column", "2")
+	assert.Empty(t, output)
+	assert.Contains(t, stderr, "Error: the answer has no code block in go")
+
+	CLI.Code = codeFlag{}
+	_, stderr = runMainOutput(t, "--code", "--output", "json", "sum", "column", "2")
+	assert.Contains(t, stderr, "Error: --code can't be combined with --format or --output")
+}
+
+// TestCodeFlagNoCode tests that answers without code blocks fail
+func TestCodeFlagNoCode(t *testing.T) {
+	mockCommandEnvironment(t, "Use a spreadsheet.", false, "")
+	mockUsagePath(t)
+	t.Cleanup(func() { CLI.Code = codeFlag{} })
+
+	output, stderr := runMainOutput(t, "--code", "sum", "column", "2")
+	assert.Empty(t, output)
+	assert.Contains(t, stderr, "Error: the answer has no code block")
+	assert.Equal(t, exitNoAnswer, exitCode(errNoCode))
+}
+
+// TestCodeFlagParse tests parsing --code
+func TestCodeFlagParse(t *testing.T) {
+	var cli struct {
+		Code     codeFlag `name:"code"`
+		Question []string `arg:"" optional:""`
+	}
+	parser, err := kong.New(&cli)
+	require.NoError(t, err)
+
+	_, err = parser.Parse([]string{"--code", "first", "awk"})
+	require.NoError(t, err)
+	assert.Equal(t, codeFlag{Enabled: true}, cli.Code)
+	assert.Equal(t, []string{"first", "awk"}, cli.Question)
+
+	cli.Code = codeFlag{}
+	_, err = parser.Parse([]string{"--code=First, Bash,sh"})
+	require.NoError(t, err)
+	assert.Equal(t, codeFlag{Enabled: true, First: true, Languages: []string{"bash", "sh"}}, cli.Code)
+}
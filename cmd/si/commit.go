@@ -0,0 +1,263 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/Turee/si/pkg/config"
+	"github.com/Turee/si/pkg/git"
+	"github.com/Turee/si/pkg/llm"
+	"github.com/alecthomas/kong"
+)
+
+// maxCommitDiffSize is the maximum number of bytes of the diff sent to the LLM
+const maxCommitDiffSize = 100 * 1024
+
+// hookTimeout limits how long the prepare-commit-msg hook may delay a commit
+const hookTimeout = 30 * time.Second
+
+// CommitCmd generates a commit message for the staged changes
+type CommitCmd struct {
+	Print        bool     `name:"print" help:"Only print the message, do not offer to commit"`
+	Yes          bool     `name:"yes" short:"y" help:"Commit without asking for confirmation"`
+	Conventional bool     `name:"conventional" help:"Use the Conventional Commits format"`
+	Hook         string   `name:"hook" placeholder:"FILE" help:"Run as prepare-commit-msg hook and write the message to FILE"`
+	HookArgs     []string `arg:"" optional:"" name:"source" help:"Source of the commit message, as passed to the prepare-commit-msg hook"`
+}
+
+// For testing purposes, we can override these functions
+var (
+	gitStagedDiff     = git.StagedDiff
+	gitRecentSubjects = git.RecentSubjects
+	gitCommit         = git.Commit
+)
+
+// Run generates a commit message from the staged diff and optionally commits it
+func (c *CommitCmd) Run(kongCtx *kong.Context) error {
+	if c.Hook != "" {
+		return c.runHook(kongCtx)
+	}
+	if len(c.HookArgs) > 0 {
+		return fmt.Errorf("unexpected arguments %q, they are only accepted with --hook", c.HookArgs)
+	}
+
+	ctx := context.Background()
+
+	diff, err := gitStagedDiff(ctx)
+	if err != nil {
+		return err
+	}
+	if strings.TrimSpace(diff) == "" {
+		return fmt.Errorf("no staged changes, stage changes with git add first")
+	}
+
+	cfg := loadConfiguration(kongCtx)
+	if cfg == nil {
+		return nil
+	}
+	if c.Conventional {
+		cfg.Commit.Conventional = true
+	}
+
+	message, err := generateCommitMessage(ctx, cfg, diff)
+	if err != nil {
+		return err
+	}
+
+	if c.Yes {
+		return gitCommit(ctx, message)
+	}
+
+	// Without a terminal there is nobody to confirm, so only print the message
+	if c.Print || !isTerminal(stdoutStat) {
+		fmt.Println(message)
+		return nil
+	}
+	term, err := newTerminal()
+	if err != nil {
+		fmt.Println(message)
+		return nil
+	}
+	defer term.Close()
+
+	for {
+		fmt.Fprintf(os.Stderr, "\n%s\n\n", message)
+
+		choice, err := term.choose("Commit with this message", []string{"yes", "edit", "no"}, "no")
+		if err != nil {
+			return err
+		}
+
+		switch choice {
+		case "yes":
+			return gitCommit(ctx, message)
+		case "edit":
+			edited, err := editText(message+"\n", "si-commit-*.txt")
+			if errors.Is(err, errNoEditor) {
+				edited, err = term.ask("Message: ")
+			}
+			if err != nil {
+				return err
+			}
+			if edited = strings.TrimSpace(edited); edited != "" {
+				message = edited
+			}
+		default:
+			return nil
+		}
+	}
+}
+
+// runHook writes a generated message into the commit message file of the
+// prepare-commit-msg hook. Failures, e.g. when offline, are reported but never
+// abort the commit, so git falls back to its usual editor flow.
+func (c *CommitCmd) runHook(kongCtx *kong.Context) error {
+	// Only plain "git commit" gets a generated message. Messages given with
+	// -m or -F, templates, merges, squashes and amends are left alone.
+	if len(c.HookArgs) > 0 && c.HookArgs[0] != "" {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), hookTimeout)
+	defer cancel()
+
+	message, err := c.hookMessage(ctx, kongCtx)
+	if err == nil {
+		err = prependToFile(c.Hook, message+"\n")
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "si: could not generate a commit message: %v\n", err)
+	}
+	return nil
+}
+
+// hookMessage generates the commit message in hook mode, where the
+// configuration errors are returned instead of exiting
+func (c *CommitCmd) hookMessage(ctx context.Context, kongCtx *kong.Context) (string, error) {
+	diff, err := gitStagedDiff(ctx)
+	if err != nil {
+		return "", err
+	}
+	if strings.TrimSpace(diff) == "" {
+		return "", fmt.Errorf("no staged changes")
+	}
+
+	cfg, err := loadConfigFunc(CLI.ConfigPath)
+	if err != nil {
+		return "", fmt.Errorf("error loading configuration: %w", err)
+	}
+	if err := applySelection(kongCtx, cfg); err != nil {
+		return "", fmt.Errorf("invalid configuration: %w", err)
+	}
+	if err := cfg.Validate(); err != nil {
+		return "", fmt.Errorf("invalid configuration: %w", err)
+	}
+	if err := resolveAPIKey(cfg); err != nil {
+		return "", err
+	}
+	if c.Conventional {
+		cfg.Commit.Conventional = true
+	}
+
+	return generateCommitMessage(ctx, cfg, diff)
+}
+
+// generateCommitMessage asks the LLM for a commit message for the diff,
+// with its secrets redacted
+func generateCommitMessage(ctx context.Context, cfg *config.Config, diff string) (string, error) {
+	redactor, err := newRedactor(cfg)
+	if err != nil {
+		return "", err
+	}
+	diff = redactor.Redact(diff)
+	warnRedacted(redactor)
+
+	system, err := systemPrompt(cfg)
+	if err != nil {
+		return "", err
+	}
+	provider, err := llm.NewProvider(cfg)
+	if err != nil {
+		return "", fmt.Errorf("error creating LLM provider: %w", err)
+	}
+	useSystemPrompt(provider, system)
+	var usage usageTracker
+	usage.track(provider)
+
+	// Recent subjects help the model match the style of the repository; a
+	// repository without commits simply has none
+	subjects, _ := gitRecentSubjects(ctx, 10)
+
+	answer, err := provider.Ask(ctx, commitPrompt(cfg.Commit, diff, subjects))
+	usage.save(modelName(cfg))
+	if err != nil {
+		return "", fmt.Errorf("error asking question: %w", err)
+	}
+
+	message := cleanCommitMessage(answer)
+	if message == "" {
+		return "", fmt.Errorf("the model did not return a commit message")
+	}
+	return message, nil
+}
+
+// prependToFile writes text in front of the existing content of the file,
+// keeping the comments git puts into the commit message file
+func prependToFile(path, text string) error {
+	existing, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return os.WriteFile(path, append([]byte(text), existing...), 0644)
+}
+
+// commitPrompt builds the prompt asking for a commit message for the diff
+func commitPrompt(cfg config.CommitConfig, diff string, recentSubjects []string) string {
+	var b strings.Builder
+
+	b.WriteString("Write a git commit message for the following staged changes.\n\n")
+	b.WriteString("Rules:\n")
+	b.WriteString("- The first line is a summary in the imperative mood of at most 72 characters.\n")
+	b.WriteString("- If the change needs explanation, add a body after a blank line describing what changed and why, wrapped at 72 characters.\n")
+	if cfg.Conventional {
+		b.WriteString("- Use the Conventional Commits format for the first line: <type>[(optional scope)]: <description>, ")
+		b.WriteString("where type is one of feat, fix, docs, style, refactor, perf, test or chore.\n")
+	}
+	b.WriteString("- Respond with only the commit message, without markdown formatting or any other text.\n")
+	if cfg.Instructions != "" {
+		fmt.Fprintf(&b, "- %s\n", strings.TrimSpace(cfg.Instructions))
+	}
+
+	if len(recentSubjects) > 0 {
+		b.WriteString("\nRecent commit messages in this repository, for reference of the style:\n")
+		for _, subject := range recentSubjects {
+			fmt.Fprintf(&b, "%s\n", subject)
+		}
+	}
+
+	if len(diff) > maxCommitDiffSize {
+		diff = diff[:maxCommitDiffSize] + "\n[diff truncated]\n"
+	}
+	fmt.Fprintf(&b, "\nDiff:\n%s", diff)
+
+	return b.String()
+}
+
+// cleanCommitMessage removes formatting the model may have wrapped the message in
+func cleanCommitMessage(answer string) string {
+	message := strings.TrimSpace(answer)
+	if strings.HasPrefix(message, "```") && strings.HasSuffix(message, "```") {
+		message = strings.TrimSuffix(message, "```")
+		if i := strings.IndexByte(message, '\n'); i >= 0 {
+			message = message[i+1:]
+		} else {
+			message = strings.TrimPrefix(message, "```")
+		}
+	}
+	return strings.TrimSpace(message)
+}
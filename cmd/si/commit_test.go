@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Turee/si/pkg/config"
+	"github.com/Turee/si/pkg/llm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// mockGit replaces the git functions used by the commit command
+func mockGit(t *testing.T, diff string) *string {
+	t.Helper()
+
+	oldStagedDiff, oldRecentSubjects, oldCommit := gitStagedDiff, gitRecentSubjects, gitCommit
+	t.Cleanup(func() {
+		gitStagedDiff, gitRecentSubjects, gitCommit = oldStagedDiff, oldRecentSubjects, oldCommit
+	})
+
+	committed := new(string)
+	gitStagedDiff = func(ctx context.Context) (string, error) {
+		return diff, nil
+	}
+	gitRecentSubjects = func(ctx context.Context, n int) ([]string, error) {
+		return []string{"fix: handle empty input"}, nil
+	}
+	gitCommit = func(ctx context.Context, message string, extraArgs ...string) error {
+		*committed = message
+		return nil
+	}
+	return committed
+}
+
+// TestCommitPrompt tests the commit message prompt
+func TestCommitPrompt(t *testing.T) {
+	prompt := commitPrompt(config.CommitConfig{}, "+hello", nil)
+	assert.Contains(t, prompt, "imperative mood")
+	assert.Contains(t, prompt, "Diff:\n+hello")
+	assert.NotContains(t, prompt, "Conventional Commits")
+	assert.NotContains(t, prompt, "Recent commit messages")
+
+	prompt = commitPrompt(config.CommitConfig{
+		Conventional: true,
+		Instructions: "Reference the ticket number.",
+	}, "+hello", []string{"feat: add greeting"})
+	assert.Contains(t, prompt, "Conventional Commits")
+	assert.Contains(t, prompt, "- Reference the ticket number.")
+	assert.Contains(t, prompt, "Recent commit messages in this repository, for reference of the style:\nfeat: add greeting\n")
+}
+
+// TestCleanCommitMessage tests removing formatting from the model's answer
+func TestCleanCommitMessage(t *testing.T) {
+	assert.Equal(t, "feat: add greeting", cleanCommitMessage("  feat: add greeting\n"))
+	assert.Equal(t, "fix: typo\n\nBody text", cleanCommitMessage("```text\nfix: typo\n\nBody text\n```"))
+	assert.Equal(t, "", cleanCommitMessage("```\n```"))
+}
+
+// TestCommitPrintsMessage tests that the message is printed when stdout is not a terminal
+func TestCommitPrintsMessage(t *testing.T) {
+	committed := mockGit(t, "diff --git a/x b/x\n+hello\n")
+	provider := mockCommandEnvironment(t, "feat: add greeting", false, "")
+
+	output := runMain(t, "commit", "--conventional")
+	assert.Equal(t, "feat: add greeting\n", output)
+	assert.Empty(t, *committed)
+	assert.Contains(t, provider.QuestionAsked, "Conventional Commits")
+	assert.Contains(t, provider.QuestionAsked, "fix: handle empty input")
+}
+
+// TestCommitConfirm tests committing after confirmation
+func TestCommitConfirm(t *testing.T) {
+	committed := mockGit(t, "+hello\n")
+	mockCommandEnvironment(t, "Add greeting", true, "y\n")
+
+	runMain(t, "commit")
+	assert.Equal(t, "Add greeting", *committed)
+}
+
+// TestCommitYes tests committing without confirmation
+func TestCommitYes(t *testing.T) {
+	committed := mockGit(t, "+hello\n")
+	mockCommandEnvironment(t, "Add greeting", false, "")
+
+	runMain(t, "commit", "--yes")
+	assert.Equal(t, "Add greeting", *committed)
+}
+
+// TestCommitNothingStaged tests the error when there are no staged changes
+func TestCommitNothingStaged(t *testing.T) {
+	mockGit(t, "")
+	mockCommandEnvironment(t, "unused", false, "")
+
+	output, stderr := runMainOutput(t, "commit")
+	assert.Empty(t, output)
+	assert.Contains(t, stderr, "no staged changes")
+}
+
+// TestCommitHook tests writing the message into the file of the prepare-commit-msg hook
+func TestCommitHook(t *testing.T) {
+	committed := mockGit(t, "+hello\n")
+	mockCommandEnvironment(t, "Add greeting", false, "")
+
+	messageFile := filepath.Join(t.TempDir(), "COMMIT_EDITMSG")
+	require.NoError(t, os.WriteFile(messageFile, []byte("\n# Please enter the commit message\n"), 0644))
+
+	output := runMain(t, "commit", "--hook", messageFile)
+	assert.Empty(t, output)
+	assert.Empty(t, *committed)
+
+	data, err := os.ReadFile(messageFile)
+	require.NoError(t, err)
+	assert.Equal(t, "Add greeting\n\n# Please enter the commit message\n", string(data))
+
+	// Messages given on the command line are kept
+	require.NoError(t, os.WriteFile(messageFile, []byte("my message\n"), 0644))
+	runMain(t, "commit", "--hook", messageFile, "message")
+	data, err = os.ReadFile(messageFile)
+	require.NoError(t, err)
+	assert.Equal(t, "my message\n", string(data))
+}
+
+// TestCommitHookProvider tests that the hook sends the diff to the selected
+// provider
+func TestCommitHookProvider(t *testing.T) {
+	mockGit(t, "+hello\n")
+	provider := mockCommandEnvironment(t, "Add greeting", false, "")
+	loadConfigFunc = func(path string) (*config.Config, error) {
+		return &config.Config{LLM: config.LLMConfig{
+			OpenAI:   config.OpenAIConfig{APIKey: "test-api-key"},
+			Provider: "local",
+			Providers: map[string]config.ProviderConfig{
+				"local": {OpenAIConfig: config.OpenAIConfig{BaseURL: "http://localhost:11434/v1", APIKey: "ollama", ModelName: "llama3.1"}},
+			},
+		}}, nil
+	}
+	var used config.OpenAIConfig
+	llm.NewProvider = func(cfg *config.Config) (llm.Provider, error) {
+		used = cfg.LLM.OpenAI
+		return provider, nil
+	}
+
+	messageFile := filepath.Join(t.TempDir(), "COMMIT_EDITMSG")
+	require.NoError(t, os.WriteFile(messageFile, []byte("\n"), 0644))
+	runMain(t, "commit", "--hook", messageFile)
+	assert.Equal(t, "http://localhost:11434/v1", used.BaseURL)
+	assert.Equal(t, "ollama", used.APIKey)
+	assert.Equal(t, "llama3.1", used.ModelName)
+
+	data, err := os.ReadFile(messageFile)
+	require.NoError(t, err)
+	assert.Equal(t, "Add greeting\n\n", string(data))
+}
+
+// TestCommitHookFailure tests that failures in hook mode never abort the commit
+func TestCommitHookFailure(t *testing.T) {
+	mockGit(t, "+hello\n")
+	provider := mockCommandEnvironment(t, "", false, "")
+	provider.AskError = errors.New("network unreachable")
+
+	messageFile := filepath.Join(t.TempDir(), "COMMIT_EDITMSG")
+	require.NoError(t, os.WriteFile(messageFile, []byte("# comment\n"), 0644))
+
+	exited := false
+	oldOsExit := osExit
+	defer func() { osExit = oldOsExit }()
+	osExit = func(code int) { exited = true }
+
+	oldArgs := os.Args
+	defer func() { os.Args = oldArgs }()
+	os.Args = []string{"si", "commit", "--hook", messageFile}
+	main()
+
+	assert.False(t, exited, "the hook must not fail the commit")
+	data, err := os.ReadFile(messageFile)
+	require.NoError(t, err)
+	assert.Equal(t, "# comment\n", string(data))
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/Turee/si/pkg/config"
+	"github.com/Turee/si/pkg/llm"
+	"github.com/Turee/si/pkg/termcap"
+	"github.com/Turee/si/pkg/textdiff"
+	"github.com/alecthomas/kong"
+)
+
+// CompareCmd asks several models, or one model several times, the same
+// question and shows the answers side by side
+type CompareCmd struct {
+	Models   []string `name:"models" sep:"," help:"Comma-separated models to compare (default: the configured model)"`
+	Runs     int      `name:"runs" default:"1" help:"Number of times to ask each model"`
+	Question []string `arg:"" optional:"" name:"question" help:"Question to ask"`
+}
+
+// comparison is the answer of one model in a comparison
+type comparison struct {
+	label  string
+	answer string
+	err    error
+}
+
+// Run asks the question to every model and prints the answers. With the
+// global --diff flag the two answers are shown as a word-level diff instead.
+func (c *CompareCmd) Run(kongCtx *kong.Context) error {
+	stdinContent, err := checkStdin()
+	if err != nil {
+		return err
+	}
+
+	// Here --diff compares the answers instead of attaching a git diff, so a
+	// revision it took is part of the question
+	question := c.Question
+	if CLI.Diff.Ref != "" {
+		question = append([]string{CLI.Diff.Ref}, question...)
+	}
+	if len(question) == 0 && stdinContent == "" {
+		printUsage(kongCtx)
+		return nil
+	}
+
+	cfg := loadConfiguration(kongCtx)
+	if cfg == nil {
+		return nil
+	}
+	redactor, err := newRedactor(cfg)
+	if err != nil {
+		return err
+	}
+	questionStr, err := buildQuestion(cfg, question, redactor.Redact(stdinContent))
+	if err != nil {
+		return err
+	}
+	warnRedacted(redactor)
+
+	if c.Runs < 1 {
+		return fmt.Errorf("--runs must be at least 1, got %d", c.Runs)
+	}
+	models := c.Models
+	if len(models) == 0 {
+		models = []string{modelName(cfg)}
+	}
+	if CLI.Diff.Enabled && len(models)*c.Runs != 2 {
+		return fmt.Errorf("--diff compares exactly two answers, use two models or one model with --runs 2")
+	}
+
+	system, err := systemPrompt(cfg)
+	if err != nil {
+		return err
+	}
+
+	results := fanOut(cfg, system, questionStr, models, c.Runs)
+
+	caps := capabilities(cfg, stdoutStat)
+	if CLI.Diff.Enabled {
+		for _, result := range results {
+			if result.err != nil {
+				return fmt.Errorf("%s: %w", result.label, result.err)
+			}
+		}
+		printAnswerDiff(caps, results[0], results[1])
+		return nil
+	}
+
+	var failed int
+	for i, result := range results {
+		if i > 0 {
+			fmt.Println()
+		}
+		fmt.Println(caps.Bold("== " + result.label + " =="))
+		if result.err != nil {
+			failed++
+			fmt.Fprintf(os.Stderr, "Error: %v\n", result.err)
+			continue
+		}
+		fmt.Println(strings.TrimRight(result.answer, "\n"))
+	}
+	if failed == len(results) {
+		return fmt.Errorf("all models failed to answer")
+	}
+	return nil
+}
+
+// fanOut asks every model the question the given number of times,
+// concurrently, and returns the answers in the order of the models
+func fanOut(cfg *config.Config, system, question string, models []string, runs int) []comparison {
+	ctx, stop := notifyInterrupt(context.Background())
+	defer stop()
+
+	results := make([]comparison, len(models)*runs)
+	var wg sync.WaitGroup
+	for i, model := range models {
+		for run := 0; run < runs; run++ {
+			result := &results[i*runs+run]
+			result.label = model
+			if runs > 1 {
+				result.label = fmt.Sprintf("%s (run %d)", model, run+1)
+			}
+
+			wg.Add(1)
+			go func(model string) {
+				defer wg.Done()
+				result.answer, result.err = askModel(ctx, cfg, system, model, question)
+			}(model)
+		}
+	}
+	wg.Wait()
+	return results
+}
+
+// askModel asks the model the question with its own provider, so the usage
+// of every model is recorded separately
+func askModel(ctx context.Context, cfg *config.Config, system, model, question string) (string, error) {
+	modelCfg := *cfg
+	modelCfg.SetModel(model)
+
+	provider, err := llm.NewProvider(&modelCfg)
+	if err != nil {
+		return "", fmt.Errorf("error creating LLM provider: %w", err)
+	}
+	useSystemPrompt(provider, system)
+	var usage usageTracker
+	usage.track(provider)
+
+	answer, err := provider.Chat(ctx, []llm.Message{llm.NewUserMessage(question)})
+	usage.save(modelName(&modelCfg))
+	return answer, err
+}
+
+// printAnswerDiff prints the word-level diff between two answers. Colors mark
+// the changes on terminals, elsewhere they are marked like git's --word-diff:
+// [-deleted-] and {+inserted+}.
+func printAnswerDiff(caps termcap.Capabilities, a, b comparison) {
+	colored := caps.Color != termcap.ColorNone
+	fmt.Println(caps.Foreground("--- "+a.label, termcap.Red))
+	fmt.Println(caps.Foreground("+++ "+b.label, termcap.Green))
+	fmt.Println()
+
+	ops := textdiff.Words(strings.TrimSpace(a.answer), strings.TrimSpace(b.answer))
+	var out strings.Builder
+	for _, op := range ops {
+		switch {
+		case op.Kind == textdiff.Equal:
+			out.WriteString(op.Text)
+		case op.Kind == textdiff.Delete && colored:
+			out.WriteString(caps.Foreground(op.Text, termcap.Red))
+		case op.Kind == textdiff.Delete:
+			out.WriteString("[-" + op.Text + "-]")
+		case colored:
+			out.WriteString(caps.Foreground(op.Text, termcap.Green))
+		default:
+			out.WriteString("{+" + op.Text + "+}")
+		}
+	}
+	fmt.Println(out.String())
+
+	if len(ops) <= 1 && (len(ops) == 0 || ops[0].Kind == textdiff.Equal) {
+		fmt.Fprintln(os.Stderr, "The answers are identical.")
+	}
+}
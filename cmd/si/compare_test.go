@@ -0,0 +1,62 @@
+package main
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/Turee/si/pkg/config"
+	"github.com/Turee/si/pkg/llm"
+	"github.com/stretchr/testify/assert"
+)
+
+// mockCompareEnvironment answers questions with the answer of the model
+// asked; models without an answer fail
+func mockCompareEnvironment(t *testing.T, answers map[string]string) {
+	mockCommandEnvironment(t, "", false, "")
+	mockUsagePath(t)
+	mockGitDiff(t, "")
+	t.Cleanup(func() { CLI.Compare = CompareCmd{} })
+
+	llm.NewProvider = func(cfg *config.Config) (llm.Provider, error) {
+		answer, ok := answers[cfg.LLM.OpenAI.ModelName]
+		if !ok {
+			return &MockProvider{AskError: errors.New("model not found")}, nil
+		}
+		return &MockProvider{AskResponse: answer}, nil
+	}
+}
+
+// TestCompare tests asking several models the same question
+func TestCompare(t *testing.T) {
+	mockCompareEnvironment(t, map[string]string{
+		"gpt-4o":      "Paris is the capital of France.",
+		"gpt-4o-mini": "The capital of France is Paris.",
+	})
+
+	output, stderr := runMainOutput(t, "compare", "--models", "gpt-4o,gpt-4o-mini,unknown", "capital", "of", "France?")
+	assert.Equal(t, "== gpt-4o ==\nParis is the capital of France.\n\n"+
+		"== gpt-4o-mini ==\nThe capital of France is Paris.\n\n"+
+		"== unknown ==\n", output)
+	assert.Contains(t, stderr, "Error: model not found")
+
+	output = runMain(t, "compare", "--models", "gpt-4o", "--runs", "2", "capital", "of", "France?")
+	assert.Equal(t, "== gpt-4o (run 1) ==\nParis is the capital of France.\n\n"+
+		"== gpt-4o (run 2) ==\nParis is the capital of France.\n", output)
+}
+
+// TestCompareDiff tests showing a word-level diff between two answers
+func TestCompareDiff(t *testing.T) {
+	mockCompareEnvironment(t, map[string]string{
+		"gpt-4o":      "The capital is Paris.",
+		"gpt-4o-mini": "The capital is Lyon.",
+	})
+
+	output := runMain(t, "compare", "--diff", "--models", "gpt-4o,gpt-4o-mini", "capital", "of", "France?")
+	assert.Equal(t, "--- gpt-4o\n+++ gpt-4o-mini\n\nThe capital is [-Paris.-]{+Lyon.+}\n", output)
+
+	_, stderr := runMainOutput(t, "compare", "--diff", "--models", "gpt-4o", "--runs", "2", "capital?")
+	assert.Contains(t, stderr, "The answers are identical.")
+
+	_, stderr = runMainOutput(t, "compare", "--diff", "--models", "gpt-4o", "capital?")
+	assert.Contains(t, stderr, "--diff compares exactly two answers")
+}
@@ -0,0 +1,385 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/Turee/si/pkg/config"
+	"github.com/alecthomas/kong"
+)
+
+// CompletionCmd prints the completion script of a shell. The scripts ask
+// si __complete for the candidates, so they follow the commands and flags of
+// the installed version and the names defined in the config.
+type CompletionCmd struct {
+	Shell string `arg:"" enum:"bash,zsh,fish,powershell" help:"Shell to print the completion script for: bash, zsh, fish or powershell"`
+}
+
+// CompleteCmd lists the candidates for the word being completed, one per
+// line. It is called by the completion scripts.
+type CompleteCmd struct {
+	Shell   string   `name:"shell" enum:"bash,zsh,fish,powershell" default:"bash" help:"Shell to format the candidates for"`
+	Current string   `name:"current" help:"Word being completed"`
+	Words   []string `arg:"" optional:"" help:"Words before the one being completed, without the program name"`
+}
+
+// Run prints the completion script
+func (c *CompletionCmd) Run() error {
+	fmt.Print(completionScripts[c.Shell])
+	return nil
+}
+
+// Run prints the candidates for the current word
+func (c *CompleteCmd) Run(kongCtx *kong.Context) error {
+	words, current, prefix := c.Words, c.Current, ""
+	if c.Shell == "bash" {
+		words, current, prefix = joinBashAssignments(words, current)
+	}
+
+	completer := &completer{values: map[string]string{}}
+	for _, candidate := range completer.complete(kongCtx.Model.Node, words, current) {
+		fmt.Println(candidate.format(c.Shell, prefix))
+	}
+	return nil
+}
+
+// candidate is a completion of the current word
+type candidate struct {
+	value       string
+	description string
+}
+
+// format formats the candidate for the shell. Bash replaces only the part
+// after the prefix, and can't show descriptions.
+func (c candidate) format(shell, prefix string) string {
+	description := strings.Join(strings.Fields(c.description), " ")
+	switch {
+	case shell == "bash":
+		return strings.TrimPrefix(c.value, prefix)
+	case description == "":
+		return c.value
+	case shell == "zsh":
+		return strings.ReplaceAll(c.value, ":", `\:`) + ":" + description
+	default:
+		return c.value + "\t" + description
+	}
+}
+
+// completer finds the candidates for a word in the kong model of the CLI
+type completer struct {
+	// values are the values of the flags given before the current word
+	values map[string]string
+
+	// cfg is the configuration, loaded when names from it are completed
+	cfg    *config.Config
+	loaded bool
+}
+
+// complete returns the candidates for current, which follows words on the
+// command line
+func (c *completer) complete(root *kong.Node, words []string, current string) []candidate {
+	node := root
+	var args []string
+	var pending *kong.Flag
+	flagsDone := false
+
+	for _, word := range words {
+		switch {
+		case pending != nil:
+			c.values[pending.Name] = word
+			pending = nil
+		case word == "--":
+			flagsDone = true
+		case !flagsDone && strings.HasPrefix(word, "-") && word != "-":
+			name, value, hasValue := strings.Cut(word, "=")
+			flag := findFlag(node, name)
+			switch {
+			case flag == nil:
+			case hasValue:
+				c.values[flag.Name] = value
+			case !flag.IsBool() && !flag.IsCounter():
+				pending = flag
+			}
+		default:
+			// Words after an argument belong to the question of the
+			// default command, even if they are command names
+			if child := findCommand(node, word); child != nil && len(args) == 0 {
+				node = child
+			} else {
+				args = append(args, word)
+			}
+		}
+	}
+
+	if pending != nil {
+		return filter(c.flagValues(pending), current)
+	}
+
+	if !flagsDone && strings.HasPrefix(current, "-") {
+		if name, value, ok := strings.Cut(current, "="); ok {
+			flag := findFlag(node, name)
+			if flag == nil {
+				return nil
+			}
+			candidates := filter(c.flagValues(flag), value)
+			for i := range candidates {
+				candidates[i].value = name + "=" + candidates[i].value
+			}
+			return candidates
+		}
+		return filter(flagNames(node), current)
+	}
+
+	var candidates []candidate
+	if len(args) == 0 {
+		for _, child := range node.Children {
+			if !child.Hidden {
+				candidates = append(candidates, candidate{child.Name, child.Help})
+			}
+		}
+	}
+	candidates = append(candidates, c.argValues(node, len(args))...)
+	return filter(candidates, current)
+}
+
+// flagValues returns the values of a flag: its enum, or the names the config
+// defines for it. Other values, such as paths, are left to the shell.
+func (c *completer) flagValues(flag *kong.Flag) []candidate {
+	if flag.Enum != "" {
+		return values(flag.EnumSlice())
+	}
+
+	cfg := c.config()
+	if cfg == nil {
+		return nil
+	}
+	switch flag.Name {
+	case "prompt":
+		return values(sortedKeys(cfg.Prompts))
+	case "profile":
+		return values(sortedKeys(cfg.Profiles))
+	case "provider":
+		return values(sortedKeys(cfg.LLM.Providers))
+	case "role":
+		return values(sortedKeys(cfg.Roles))
+	case "format":
+		return values(append([]string{"text", "json-stream"}, sortedKeys(cfg.Formats)...))
+	}
+	return nil
+}
+
+// argValues returns the values of the positional argument of the command at
+// index: its enum, or the names the config defines for it
+func (c *completer) argValues(node *kong.Node, index int) []candidate {
+	if index < len(node.Positional) && node.Positional[index].Enum != "" {
+		return values(node.Positional[index].EnumSlice())
+	}
+	if index != 0 {
+		return nil
+	}
+
+	switch commandPath(node) {
+	case "saved run":
+		if cfg := c.config(); cfg != nil {
+			var candidates []candidate
+			for _, name := range sortedKeys(cfg.Saved) {
+				candidates = append(candidates, candidate{name, cfg.Saved[name]})
+			}
+			return candidates
+		}
+	case "config get", "config set":
+		var candidates []candidate
+		for _, setting := range (&config.Config{}).Settings() {
+			candidates = append(candidates, candidate{value: setting.Key})
+		}
+		return candidates
+	}
+	return nil
+}
+
+// config loads the configuration given with --config on the completed
+// command line, or the default one. Nil is returned if it can't be loaded.
+func (c *completer) config() *config.Config {
+	if !c.loaded {
+		c.loaded = true
+		path, ok := c.values["config"]
+		if !ok {
+			path = CLI.ConfigPath
+		}
+		c.cfg, _ = loadConfigFunc(config.ExpandPath(path))
+	}
+	return c.cfg
+}
+
+// joinBashAssignments undoes bash splitting --flag=value into three words,
+// as = is one of its word breaks. It returns the words, the current word
+// and the prefix of the current word bash doesn't replace.
+func joinBashAssignments(words []string, current string) ([]string, string, string) {
+	var joined []string
+	for i := 0; i < len(words); i++ {
+		n := len(joined)
+		if words[i] == "=" && n > 0 && strings.HasPrefix(joined[n-1], "-") && i+1 < len(words) {
+			joined[n-1] += "=" + words[i+1]
+			i++
+			continue
+		}
+		joined = append(joined, words[i])
+	}
+
+	n := len(joined)
+	switch {
+	case current == "=" && n > 0 && strings.HasPrefix(joined[n-1], "-"):
+		prefix := joined[n-1] + "="
+		return joined[:n-1], prefix, prefix
+	case n > 1 && joined[n-1] == "=" && strings.HasPrefix(joined[n-2], "-"):
+		prefix := joined[n-2] + "="
+		return joined[:n-2], prefix + current, prefix
+	}
+	return joined, current, ""
+}
+
+// findFlag returns the flag of the node or its parents with the long or
+// short name, e.g. --model or -m
+func findFlag(node *kong.Node, name string) *kong.Flag {
+	for _, group := range node.AllFlags(false) {
+		for _, flag := range group {
+			if name == "--"+flag.Name || (flag.Short != 0 && name == "-"+string(flag.Short)) {
+				return flag
+			}
+		}
+	}
+	return nil
+}
+
+// findCommand returns the subcommand of the node with the name or alias
+func findCommand(node *kong.Node, name string) *kong.Node {
+	for _, child := range node.Children {
+		if child.Type != kong.CommandNode {
+			continue
+		}
+		if child.Name == name {
+			return child
+		}
+		for _, alias := range child.Aliases {
+			if alias == name {
+				return child
+			}
+		}
+	}
+	return nil
+}
+
+// flagNames returns the long names of the visible flags of the node and its
+// parents
+func flagNames(node *kong.Node) []candidate {
+	var candidates []candidate
+	for _, group := range node.AllFlags(true) {
+		for _, flag := range group {
+			candidates = append(candidates, candidate{"--" + flag.Name, flag.Help})
+		}
+	}
+	return candidates
+}
+
+// commandPath returns the names of the commands leading to the node, e.g.
+// "saved run"
+func commandPath(node *kong.Node) string {
+	var names []string
+	for ; node != nil && node.Type == kong.CommandNode; node = node.Parent {
+		names = append([]string{node.Name}, names...)
+	}
+	return strings.Join(names, " ")
+}
+
+// filter returns the candidates starting with prefix
+func filter(candidates []candidate, prefix string) []candidate {
+	var matching []candidate
+	for _, c := range candidates {
+		if strings.HasPrefix(c.value, prefix) {
+			matching = append(matching, c)
+		}
+	}
+	return matching
+}
+
+// values returns candidates without descriptions
+func values(names []string) []candidate {
+	candidates := make([]candidate, len(names))
+	for i, name := range names {
+		candidates[i] = candidate{value: name}
+	}
+	return candidates
+}
+
+// sortedKeys returns the keys of a map in order
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// completionScripts are the completion scripts of the supported shells
+var completionScripts = map[string]string{
+	"bash": `# bash completion for si, add to ~/.bashrc:
+#   source <(si completion bash)
+_si() {
+    local IFS=$'\n'
+    COMPREPLY=($(si __complete --shell=bash --current="${COMP_WORDS[COMP_CWORD]}" -- "${COMP_WORDS[@]:1:COMP_CWORD-1}" 2>/dev/null))
+}
+complete -o default -F _si si
+`,
+
+	"zsh": `#compdef si
+# zsh completion for si, add to ~/.zshrc:
+#   source <(si completion zsh)
+_si() {
+    local -a candidates
+    candidates=("${(@f)$(si __complete --shell=zsh --current="${words[CURRENT]}" -- "${(@)words[2,CURRENT-1]}" 2>/dev/null)}")
+    candidates=(${candidates:#})
+    if (( ${#candidates} )); then
+        _describe 'si' candidates
+    else
+        _files
+    fi
+}
+if [ "$funcstack[1]" = "_si" ]; then
+    _si "$@"
+else
+    compdef _si si
+fi
+`,
+
+	"fish": `# fish completion for si, save as ~/.config/fish/completions/si.fish:
+#   si completion fish > ~/.config/fish/completions/si.fish
+function __si_complete
+    set -l words (commandline -opc)
+    set -e words[1]
+    set -l current (commandline -ct)
+    set -l candidates (si __complete --shell=fish --current="$current" -- $words 2>/dev/null)
+    if test (count $candidates) -eq 0
+        __fish_complete_path "$current"
+    else
+        printf '%s\n' $candidates
+    end
+end
+complete -c si -f -a '(__si_complete)'
+`,
+
+	"powershell": `# PowerShell completion for si, add to $PROFILE:
+#   si completion powershell | Out-String | Invoke-Expression
+Register-ArgumentCompleter -Native -CommandName si -ScriptBlock {
+    param($wordToComplete, $commandAst, $cursorPosition)
+    $words = @($commandAst.CommandElements | Select-Object -Skip 1 |
+        Where-Object { $_.Extent.EndOffset -lt $cursorPosition } | ForEach-Object { $_.ToString() })
+    si __complete --shell=powershell "--current=$wordToComplete" -- @words 2>$null | ForEach-Object {
+        $candidate, $description = $_ -split "` + "`" + `t", 2
+        if (-not $description) { $description = $candidate }
+        [System.Management.Automation.CompletionResult]::new($candidate, $candidate, 'ParameterValue', $description)
+    }
+}
+`,
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/Turee/si/pkg/config"
+	"github.com/stretchr/testify/assert"
+)
+
+// complete runs si __complete for the shell and returns the candidates
+func complete(t *testing.T, shell, current string, words ...string) []string {
+	t.Helper()
+	defer func() { CLI.Complete = CompleteCmd{} }()
+
+	args := append([]string{"__complete", "--shell=" + shell, "--current=" + current, "--"}, words...)
+	output := strings.TrimSuffix(runMain(t, args...), "\n")
+	if output == "" {
+		return nil
+	}
+	return strings.Split(output, "\n")
+}
+
+// mockCompletionConfig makes the configuration define names to complete
+func mockCompletionConfig(t *testing.T) {
+	mockCommandEnvironment(t, "", false, "")
+	loadConfigFunc = func(path string) (*config.Config, error) {
+		return &config.Config{
+			Prompts:  map[string]config.PromptConfig{"review": {}, "explain": {}},
+			Profiles: map[string]config.ProfileConfig{"work": {}},
+			LLM:      config.LLMConfig{Providers: map[string]config.ProviderConfig{"groq": {}, "deepseek": {}}},
+			Formats:  map[string]string{"short": "{{.Answer}}"},
+			Saved:    map[string]string{"weather": "Weather in {{city}}?"},
+		}, nil
+	}
+}
+
+// TestCompleteCommandsAndFlags tests completing commands and flags from the
+// CLI model
+func TestCompleteCommandsAndFlags(t *testing.T) {
+	mockCompletionConfig(t)
+
+	commands := complete(t, "bash", "co")
+	assert.Equal(t, []string{"commit", "compare", "config", "copilot", "completion"}, commands)
+	assert.NotContains(t, complete(t, "bash", ""), "__complete")
+
+	assert.Equal(t, []string{"--profile", "--provider", "--prompt", "--print-system"}, complete(t, "bash", "--pr"))
+	assert.Equal(t, []string{"--json"}, complete(t, "bash", "--j", "version"))
+	assert.Equal(t, []string{"init", "get", "set", "migrate"}, complete(t, "bash", "", "config"))
+
+	// Words of a question are not taken as commands
+	assert.Empty(t, complete(t, "bash", "", "what", "is", "config"))
+
+	// Descriptions are shown by shells that support them
+	assert.Equal(t, []string{"add:Save a query, with {{name}} placeholders for its parameters"}, complete(t, "zsh", "a", "saved"))
+	assert.Equal(t, []string{"--json\tPrint version information as JSON"}, complete(t, "fish", "--j", "version"))
+}
+
+// TestCompleteValues tests completing flag values and arguments
+func TestCompleteValues(t *testing.T) {
+	mockCompletionConfig(t)
+
+	assert.Equal(t, []string{"text", "json", "ndjson"}, complete(t, "bash", "", "--output"))
+	assert.Equal(t, []string{"bash"}, complete(t, "bash", "b", "completion"))
+	assert.Equal(t, []string{"explain", "review"}, complete(t, "bash", "", "-p"))
+	assert.Equal(t, []string{"work"}, complete(t, "bash", "", "ask", "--profile"))
+	assert.Equal(t, []string{"deepseek", "groq"}, complete(t, "bash", "", "--provider"))
+	assert.Equal(t, []string{"text", "json-stream", "short"}, complete(t, "bash", "", "--format"))
+	assert.Equal(t, []string{"weather\tWeather in {{city}}?"}, complete(t, "powershell", "", "saved", "run"))
+	assert.Contains(t, complete(t, "bash", "llm.openai.m", "config", "set"), "llm.openai.model_name")
+
+	// Values of flags after --model are not confused with commands
+	assert.Equal(t, []string{"review"}, complete(t, "bash", "r", "--model", "gpt-4o", "--prompt"))
+
+	// Paths are left to the shell
+	assert.Empty(t, complete(t, "bash", "", "--schema"))
+}
+
+// TestCompleteAssignments tests completing --flag=value, which bash splits
+// at the =
+func TestCompleteAssignments(t *testing.T) {
+	mockCompletionConfig(t)
+
+	assert.Equal(t, []string{"--output=ndjson"}, complete(t, "zsh", "--output=n"))
+	assert.Equal(t, []string{"ndjson"}, complete(t, "bash", "n", "--output", "="))
+	assert.Equal(t, []string{"text", "json", "ndjson"}, complete(t, "bash", "=", "--output"))
+	assert.Equal(t, []string{"review"}, complete(t, "bash", "r", "--output", "=", "json", "--prompt"))
+}
+
+// TestCompletionScripts tests that the scripts call si __complete
+func TestCompletionScripts(t *testing.T) {
+	for _, shell := range []string{"bash", "zsh", "fish", "powershell"} {
+		output := runMain(t, "completion", shell)
+		assert.Contains(t, output, "si __complete --shell="+shell, shell)
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/Turee/si/pkg/config"
+)
+
+// ConfigCmd manages the configuration file
+type ConfigCmd struct {
+	Init    ConfigInitCmd    `cmd:"" help:"Create the configuration file interactively"`
+	Get     ConfigGetCmd     `cmd:"" help:"Print a setting of the configuration file"`
+	Set     ConfigSetCmd     `cmd:"" help:"Change a setting of the configuration file, keeping its comments"`
+	Migrate ConfigMigrateCmd `cmd:"" help:"Migrate the configuration file to the current version"`
+}
+
+// ConfigGetCmd prints a setting as it is written in the configuration file
+type ConfigGetCmd struct {
+	Key string `arg:"" help:"Dotted key of the setting, e.g. llm.openai.model_name"`
+}
+
+// ConfigSetCmd changes a setting of the configuration file in place
+type ConfigSetCmd struct {
+	Key   string `arg:"" help:"Dotted key of the setting, e.g. llm.openai.model_name"`
+	Value string `arg:"" help:"New value of the setting"`
+}
+
+// ConfigMigrateCmd migrates the configuration file, keeping a backup
+type ConfigMigrateCmd struct{}
+
+// configFilePath returns the path of the configuration file given with
+// --config, or the default one
+func configFilePath() string {
+	if CLI.ConfigPath != "" {
+		return CLI.ConfigPath
+	}
+	return config.DefaultConfigPath()
+}
+
+// Run prints the value of the setting, or fails if the file doesn't set it
+func (c *ConfigGetCmd) Run() error {
+	path := configFilePath()
+	if !config.KnownKey(c.Key) {
+		return fmt.Errorf("unknown setting %s", c.Key)
+	}
+
+	value, ok, err := config.GetValue(path, c.Key)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("%s is not set in %s", c.Key, path)
+	}
+	fmt.Println(value)
+	return nil
+}
+
+// Run saves the new value of the setting
+func (c *ConfigSetCmd) Run() error {
+	path := configFilePath()
+	if err := config.SetValue(path, c.Key, c.Value); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Set %s in %s\n", c.Key, path)
+	return nil
+}
+
+// Run migrates the configuration file and reports what was changed
+func (c *ConfigMigrateCmd) Run() error {
+	path := configFilePath()
+
+	m, err := config.Migrate(path)
+	if err != nil {
+		return err
+	}
+	if m == nil {
+		fmt.Fprintf(os.Stderr, "%s is up to date (version %d)\n", path, config.CurrentVersion)
+		return nil
+	}
+	printMigration(path, m)
+	return nil
+}
+
+// printMigration describes a migration of the configuration file on stderr
+func printMigration(path string, m *config.Migration) {
+	if m.Err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %s is config version %d and was migrated to version %d for this run only, saving it failed: %v\n", path, m.From, m.To, m.Err)
+		return
+	}
+
+	fmt.Fprintf(os.Stderr, "Migrated %s from config version %d to %d, the previous file is saved as %s\n", path, m.From, m.To, m.Backup)
+	for _, change := range m.Changes {
+		fmt.Fprintf(os.Stderr, "  %s\n", change)
+	}
+}
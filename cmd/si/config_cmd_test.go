@@ -0,0 +1,67 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestConfigMigrate tests migrating the config file on demand
+func TestConfigMigrate(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "si.yaml")
+	require.NoError(t, os.WriteFile(configPath, []byte(`llm:
+  openai:
+    base_url: https://llm.example.com/v1/chat/completions
+    api_key: test-api-key
+`), 0600))
+	defer func() { CLI.ConfigPath = "" }()
+
+	_, stderr := runMainOutput(t, "--config", configPath, "config", "migrate")
+	assert.Contains(t, stderr, "Migrated "+configPath+" from config version 1 to 2, the previous file is saved as "+configPath+".v1.bak")
+	assert.Contains(t, stderr, "llm.openai.base_url: https://llm.example.com/v1/chat/completions -> https://llm.example.com/v1")
+
+	output, stderr := runMainOutput(t, "--config", configPath, "config", "migrate")
+	assert.Empty(t, output)
+	assert.Equal(t, configPath+" is up to date (version 2)\n", stderr)
+}
+
+// TestConfigGetSet tests reading and changing settings in place
+func TestConfigGetSet(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "si.yaml")
+	require.NoError(t, os.WriteFile(configPath, []byte(`llm:
+  openai:
+    # Your OpenAI API key
+    api_key: ${OPENAI_KEY}
+    model_name: gpt-4o # the default model
+`), 0600))
+	defer func() { CLI.ConfigPath = "" }()
+
+	output := runMain(t, "--config", configPath, "config", "get", "llm.openai.api_key")
+	assert.Equal(t, "${OPENAI_KEY}\n", output)
+
+	_, stderr := runMainOutput(t, "--config", configPath, "config", "set", "llm.openai.model_name", "gpt-4o-mini")
+	assert.Contains(t, stderr, "Set llm.openai.model_name in "+configPath)
+	output = runMain(t, "--config", configPath, "config", "get", "llm.openai.model_name")
+	assert.Equal(t, "gpt-4o-mini\n", output)
+
+	data, err := os.ReadFile(configPath)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), "# Your OpenAI API key")
+	assert.Contains(t, string(data), "model_name: gpt-4o-mini # the default model")
+
+	// Mappings are printed as YAML
+	output = runMain(t, "--config", configPath, "config", "get", "llm")
+	assert.Contains(t, output, "openai:\n  # Your OpenAI API key\n  api_key: ${OPENAI_KEY}\n")
+
+	_, stderr = runMainOutput(t, "--config", configPath, "config", "get", "llm.openai.temperature")
+	assert.Contains(t, stderr, "llm.openai.temperature is not set in "+configPath)
+
+	_, stderr = runMainOutput(t, "--config", configPath, "config", "set", "llm.openai.model", "gpt-4o")
+	assert.Contains(t, stderr, "unknown setting llm.openai.model")
+
+	_, stderr = runMainOutput(t, "--config", configPath, "config", "set", "llm.openai.temperature", "warm")
+	assert.Contains(t, stderr, `invalid value "warm" for llm.openai.temperature`)
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/Turee/si/pkg/config"
+	"github.com/Turee/si/pkg/llm"
+)
+
+// testRequestTimeout limits how long the test request of config init may take
+const testRequestTimeout = 30 * time.Second
+
+// Providers config init can set up
+const (
+	initOpenAI     = "OpenAI"
+	initAzure      = "Azure OpenAI"
+	initOpenRouter = "OpenRouter (models of many providers with one key)"
+	initCompatible = "OpenAI-compatible server (Ollama, LM Studio, vLLM, ...)"
+)
+
+// ConfigInitCmd creates the configuration file interactively
+type ConfigInitCmd struct {
+	Force bool `name:"force" help:"Replace an existing configuration file without asking"`
+}
+
+// Run asks for the provider, API key and model, tests them with a request
+// and writes the configuration file
+func (c *ConfigInitCmd) Run() error {
+	path := configFilePath()
+
+	term, err := newTerminal()
+	if err != nil {
+		return err
+	}
+	defer term.Close()
+
+	_, statErr := os.Stat(path)
+	exists := statErr == nil
+	if exists && !c.Force {
+		answer, err := term.choose(path+" already exists. Replace it", []string{"yes", "no"}, "no")
+		if err != nil || answer != "yes" {
+			return err
+		}
+	}
+
+	openai, err := askProvider(term)
+	if err != nil {
+		return err
+	}
+
+	// Test the settings with the key the config will resolve to
+	cfg := &config.Config{LLM: config.LLMConfig{OpenAI: openai}}
+	if cfg.LLM.OpenAI.APIKey == "" {
+		cfg.LLM.OpenAI.APIKey = os.Getenv("OPENAI_API_KEY")
+	}
+	fmt.Fprintln(term.out, "Sending a test request...")
+	if err := testProvider(cfg); err != nil {
+		fmt.Fprintf(term.out, "The test request failed: %v\n", err)
+		answer, err := term.choose("Save the configuration anyway", []string{"yes", "no"}, "no")
+		if err != nil {
+			return err
+		}
+		if answer != "yes" {
+			return errors.New("the configuration was not saved")
+		}
+	} else {
+		fmt.Fprintln(term.out, "The test request succeeded.")
+	}
+
+	// Keep the replaced file, it may contain more than init asks for
+	if exists {
+		if err := os.Rename(path, path+".bak"); err != nil {
+			return fmt.Errorf("failed to back up %s: %w", path, err)
+		}
+		fmt.Fprintf(term.out, "The previous configuration is saved as %s.bak\n", path)
+	}
+	if err := writeInitialConfig(path, openai); err != nil {
+		return err
+	}
+	fmt.Fprintf(term.out, "Saved the configuration to %s\n", path)
+	return nil
+}
+
+// askProvider asks for the provider and its settings
+func askProvider(term *terminal) (config.OpenAIConfig, error) {
+	var openai config.OpenAIConfig
+
+	provider, err := term.pick("Provider", []string{initOpenAI, initAzure, initOpenRouter, initCompatible})
+	if err != nil {
+		return openai, err
+	}
+
+	defaultModel := "gpt-4o"
+	switch provider {
+	case initAzure:
+		if openai.BaseURL, err = askRequired(term, "Resource endpoint (https://NAME.openai.azure.com)", ""); err != nil {
+			return openai, err
+		}
+		if openai.AzureDeploymentName, err = askRequired(term, "Deployment name", ""); err != nil {
+			return openai, err
+		}
+		defaultModel = openai.AzureDeploymentName
+	case initOpenRouter:
+		openai.BaseURL = config.OpenRouterBaseURL
+		defaultModel = "openai/gpt-4o"
+	case initCompatible:
+		if openai.BaseURL, err = askRequired(term, "Base URL", "http://localhost:11434/v1"); err != nil {
+			return openai, err
+		}
+		defaultModel = "llama3.2"
+	default:
+		openai.BaseURL = config.DefaultBaseURL
+	}
+
+	keyPrompt := "API key"
+	switch {
+	case provider == initCompatible:
+		keyPrompt += " (empty if the server needs none)"
+	case os.Getenv("OPENAI_API_KEY") != "":
+		keyPrompt += " (empty to use $OPENAI_API_KEY)"
+	}
+	for {
+		if openai.APIKey, err = term.ask(keyPrompt + ": "); err != nil {
+			return openai, err
+		}
+		if openai.APIKey != "" || os.Getenv("OPENAI_API_KEY") != "" {
+			break
+		}
+		if provider == initCompatible {
+			// The key is required, servers without authentication ignore it
+			openai.APIKey = "none"
+			break
+		}
+		fmt.Fprintln(term.out, "An API key is required")
+	}
+
+	openai.ModelName, err = askRequired(term, "Model", defaultModel)
+	return openai, err
+}
+
+// askRequired asks for a value until one is entered; an empty answer selects
+// the default, if there is one
+func askRequired(term *terminal, prompt, def string) (string, error) {
+	if def != "" {
+		prompt += " [" + def + "]"
+	}
+	for {
+		answer, err := term.ask(prompt + ": ")
+		if err != nil {
+			return "", err
+		}
+		if answer == "" {
+			answer = def
+		}
+		if answer != "" {
+			return answer, nil
+		}
+	}
+}
+
+// testProvider sends a tiny request to check the API key and the model
+func testProvider(cfg *config.Config) error {
+	provider, err := llm.NewProvider(cfg)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), testRequestTimeout)
+	defer cancel()
+	_, err = provider.Ask(ctx, "Reply with OK.")
+	return err
+}
+
+// writeInitialConfig writes a new configuration file with the settings of
+// the provider
+func writeInitialConfig(path string, openai config.OpenAIConfig) error {
+	values := [][2]string{
+		{"version", strconv.Itoa(config.CurrentVersion)},
+		{"llm.openai.base_url", openai.BaseURL},
+		{"llm.openai.api_key", openai.APIKey},
+		{"llm.openai.model_name", openai.ModelName},
+		{"llm.openai.azure_deployment_name", openai.AzureDeploymentName},
+	}
+	for _, value := range values {
+		if value[1] == "" {
+			continue
+		}
+		if err := config.SaveValue(path, value[0], value[1]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Turee/si/pkg/config"
+	"github.com/Turee/si/pkg/llm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// mockConfigInit sets up the terminal answers and a provider that fails the
+// test request with askErr
+func mockConfigInit(t *testing.T, answers string, askErr error) (*config.Config, string) {
+	t.Helper()
+
+	mockCommandEnvironment(t, "OK", false, answers)
+	t.Setenv("OPENAI_API_KEY", "")
+	t.Cleanup(func() { CLI.ConfigPath = "" })
+
+	var tested config.Config
+	llm.NewProvider = func(cfg *config.Config) (llm.Provider, error) {
+		tested = *cfg
+		return &MockProvider{AskResponse: "OK", AskError: askErr}, nil
+	}
+	return &tested, filepath.Join(t.TempDir(), "si.yaml")
+}
+
+// TestConfigInit tests creating the configuration file interactively
+func TestConfigInit(t *testing.T) {
+	tested, path := mockConfigInit(t, "1\n\nsk-test\n\n", nil)
+
+	_, stderr := runMainOutput(t, "--config", path, "config", "init")
+	assert.Contains(t, stderr, "An API key is required")
+	assert.Contains(t, stderr, "The test request succeeded.")
+	assert.Contains(t, stderr, "Saved the configuration to "+path)
+	assert.Equal(t, "sk-test", tested.LLM.OpenAI.APIKey)
+
+	cfg, err := config.LoadConfig(path)
+	require.NoError(t, err)
+	assert.NoError(t, cfg.Validate())
+	assert.Equal(t, config.CurrentVersion, cfg.Version)
+	assert.Equal(t, config.OpenAIConfig{BaseURL: config.DefaultBaseURL, APIKey: "sk-test", ModelName: "gpt-4o"}, cfg.LLM.OpenAI)
+
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+}
+
+// TestConfigInitAzure tests setting up an Azure deployment over an existing
+// file, which is kept as a backup
+func TestConfigInitAzure(t *testing.T) {
+	tested, path := mockConfigInit(t, "y\n2\nhttps://example.openai.azure.com\nprod-gpt4o\nazure-key\n\n", nil)
+	require.NoError(t, os.WriteFile(path, []byte("llm:\n  openai:\n    api_key: old\n"), 0600))
+
+	_, stderr := runMainOutput(t, "--config", path, "config", "init")
+	assert.Contains(t, stderr, "already exists. Replace it")
+	assert.Equal(t, "prod-gpt4o", tested.LLM.OpenAI.AzureDeploymentName)
+
+	cfg, err := config.LoadConfig(path)
+	require.NoError(t, err)
+	assert.Equal(t, config.OpenAIConfig{
+		BaseURL:             "https://example.openai.azure.com",
+		APIKey:              "azure-key",
+		ModelName:           "prod-gpt4o",
+		AzureDeploymentName: "prod-gpt4o",
+	}, cfg.LLM.OpenAI)
+
+	backup, err := os.ReadFile(path + ".bak")
+	require.NoError(t, err)
+	assert.Contains(t, string(backup), "api_key: old")
+}
+
+// TestConfigInitOpenRouter tests setting up OpenRouter, whose models are
+// named after their vendor
+func TestConfigInitOpenRouter(t *testing.T) {
+	tested, path := mockConfigInit(t, "3\nsk-or-test\n\n", nil)
+
+	runMain(t, "--config", path, "config", "init")
+	assert.True(t, tested.LLM.OpenAI.IsOpenRouter())
+
+	cfg, err := config.LoadConfig(path)
+	require.NoError(t, err)
+	assert.Equal(t, config.OpenAIConfig{BaseURL: config.OpenRouterBaseURL, APIKey: "sk-or-test", ModelName: "openai/gpt-4o"}, cfg.LLM.OpenAI)
+}
+
+// TestConfigInitFailedTest tests that nothing is saved when the test request
+// fails, unless the user wants to
+func TestConfigInitFailedTest(t *testing.T) {
+	_, path := mockConfigInit(t, "4\n\n\nllama3.1\n\n", errors.New("connection refused"))
+
+	_, stderr := runMainOutput(t, "--config", path, "config", "init")
+	assert.Contains(t, stderr, "The test request failed: connection refused")
+	assert.Contains(t, stderr, "the configuration was not saved")
+	assert.NoFileExists(t, path)
+}
+
+// TestMissingConfig tests that a missing configuration file points to config init
+func TestMissingConfig(t *testing.T) {
+	_, path := mockConfigInit(t, "", nil)
+	loadConfigFunc = config.LoadConfig
+
+	_, stderr := runMainOutput(t, "--config", path, "capital", "of", "France?")
+	assert.Contains(t, stderr, "Error loading configuration")
+	assert.True(t, strings.HasSuffix(stderr, "Run si config init to create "+path+".\n"), stderr)
+}
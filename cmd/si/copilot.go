@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+
+	"github.com/Turee/si/pkg/copilot"
+)
+
+// For testing purposes, we can override these
+var (
+	newCopilotClient = func() *copilot.Client { return copilot.NewClient(&http.Client{}) }
+	copilotTokenPath = copilot.DefaultTokenPath
+)
+
+// CopilotCmd manages the sign-in to GitHub Copilot
+type CopilotCmd struct {
+	Login  CopilotLoginCmd  `cmd:"" help:"Sign in to GitHub Copilot with a code entered on github.com"`
+	Logout CopilotLogoutCmd `cmd:"" help:"Remove the GitHub token saved by si copilot login"`
+}
+
+// CopilotLoginCmd signs in to GitHub Copilot with the device flow
+type CopilotLoginCmd struct{}
+
+// Run shows the code to enter on GitHub, waits for the sign-in and saves the
+// GitHub token once the token exchange confirmed the Copilot subscription
+func (c *CopilotLoginCmd) Run() error {
+	ctx, stop := notifyInterrupt(context.Background())
+	defer stop()
+
+	client := newCopilotClient()
+	code, err := client.RequestDeviceCode(ctx)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Open %s and enter the code %s\n", code.VerificationURI, code.UserCode)
+	fmt.Fprintln(os.Stderr, "Waiting for the sign-in...")
+
+	token, err := client.WaitForToken(ctx, code)
+	if err != nil {
+		return err
+	}
+	if _, err := client.ExchangeToken(ctx, token); err != nil {
+		return err
+	}
+
+	path := copilotTokenPath()
+	if err := copilot.SaveGitHubToken(path, token); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Signed in to GitHub Copilot, the token is saved in %s\n", path)
+	return nil
+}
+
+// CopilotLogoutCmd removes the saved GitHub token
+type CopilotLogoutCmd struct{}
+
+// Run removes the saved GitHub token
+func (c *CopilotLogoutCmd) Run() error {
+	path := copilotTokenPath()
+	err := os.Remove(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		fmt.Fprintln(os.Stderr, "Not signed in to GitHub Copilot")
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to remove the GitHub token: %w", err)
+	}
+	fmt.Fprintf(os.Stderr, "Removed the GitHub token from %s\n", path)
+	return nil
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Turee/si/pkg/copilot"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// mockCopilot redirects si copilot to a fake GitHub and a temporary token
+// file. Without a subscription the token exchange fails.
+func mockCopilot(t *testing.T, subscribed bool) string {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/login/device/code":
+			io.WriteString(w, `{"device_code":"dev-1","user_code":"ABCD-1234","verification_uri":"https://github.com/login/device","expires_in":60,"interval":0}`)
+		case "/login/oauth/access_token":
+			io.WriteString(w, `{"access_token":"ghu_test"}`)
+		case "/copilot_internal/v2/token":
+			if !subscribed {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			fmt.Fprintf(w, `{"token":"cop-1","expires_at":%d}`, time.Now().Add(time.Hour).Unix())
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	oldClient, oldPath := newCopilotClient, copilotTokenPath
+	t.Cleanup(func() { newCopilotClient, copilotTokenPath = oldClient, oldPath })
+	newCopilotClient = func() *copilot.Client {
+		client := copilot.NewClient(server.Client())
+		client.GitHubURL, client.APIURL = server.URL, server.URL
+		return client
+	}
+	path := filepath.Join(t.TempDir(), "copilot_token")
+	copilotTokenPath = func() string { return path }
+	return path
+}
+
+// TestCopilotLogin tests signing in and out
+func TestCopilotLogin(t *testing.T) {
+	path := mockCopilot(t, true)
+
+	_, stderr := runMainOutput(t, "copilot", "login")
+	assert.Contains(t, stderr, "Open https://github.com/login/device and enter the code ABCD-1234")
+	assert.Contains(t, stderr, "Signed in to GitHub Copilot")
+	token, err := copilot.LoadGitHubToken(path)
+	require.NoError(t, err)
+	assert.Equal(t, "ghu_test", token)
+
+	_, stderr = runMainOutput(t, "copilot", "logout")
+	assert.Contains(t, stderr, "Removed the GitHub token")
+	assert.NoFileExists(t, path)
+
+	_, stderr = runMainOutput(t, "copilot", "logout")
+	assert.Contains(t, stderr, "Not signed in")
+}
+
+// TestCopilotLoginWithoutSubscription tests that the token isn't saved when
+// the account has no Copilot subscription
+func TestCopilotLoginWithoutSubscription(t *testing.T) {
+	path := mockCopilot(t, false)
+
+	_, stderr := runMainOutput(t, "copilot", "login")
+	assert.Contains(t, stderr, "is Copilot enabled for the account?")
+	assert.NoFileExists(t, path)
+}
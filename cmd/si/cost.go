@@ -0,0 +1,148 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/Turee/si/pkg/llm"
+	"github.com/Turee/si/pkg/pricing"
+	"github.com/Turee/si/pkg/usage"
+)
+
+// usagePath returns the path of the usage log, it can be replaced in tests
+var usagePath = usage.DefaultPath
+
+// runSession is the session the usage of this run is recorded under, unless
+// --session names one
+var runSession = newSessionID()
+
+// randRead fills the random part of session IDs, it can be replaced in tests
+var randRead = rand.Read
+
+// newSessionID returns a session ID starting with the time, so sessions sort
+// by their start. Without random bytes, the process ID tells apart the runs
+// started in the same second.
+func newSessionID() string {
+	b := make([]byte, 3)
+	if _, err := randRead(b); err != nil {
+		pid := os.Getpid()
+		b = []byte{byte(pid >> 16), byte(pid >> 8), byte(pid)}
+	}
+	return time.Now().Format("20060102-150405") + "-" + hex.EncodeToString(b)
+}
+
+// usageSession returns the session the usage is recorded under
+func usageSession() string {
+	if CLI.Session != "" {
+		return CLI.Session
+	}
+	return runSession
+}
+
+// usageTracker sums up the token usage of all requests of a command
+type usageTracker struct {
+	usage    llm.Usage
+	requests []llm.Usage
+
+	// metadata is the metadata of the last response
+	metadata llm.Metadata
+}
+
+// track collects the usage and response metadata of the requests sent
+// through the provider, if the provider reports them
+func (t *usageTracker) track(provider llm.Provider) {
+	if reporter, ok := provider.(llm.UsageReporter); ok {
+		reporter.SetUsageCallback(func(usage llm.Usage) {
+			t.usage.Add(usage)
+			t.requests = append(t.requests, usage)
+		})
+	}
+	if reporter, ok := provider.(llm.MetadataReporter); ok {
+		reporter.SetMetadataCallback(func(metadata llm.Metadata) {
+			t.metadata = metadata
+		})
+	}
+}
+
+// print writes the token counts and the estimated cost for the model
+func (t *usageTracker) print(w io.Writer, model string) {
+	if len(t.requests) == 0 {
+		fmt.Fprintln(w, "Usage: not reported by the provider")
+		return
+	}
+
+	prompt := fmt.Sprintf("%d prompt tokens", t.usage.PromptTokens)
+	if t.usage.CachedTokens > 0 {
+		prompt += fmt.Sprintf(" (%d cached)", t.usage.CachedTokens)
+	}
+
+	cost := "cost unknown for " + model
+	if dollars, ok := pricing.Estimate(model, t.usage); ok {
+		cost = fmt.Sprintf("estimated cost $%.6f", dollars)
+	}
+
+	fmt.Fprintf(w, "Usage: %s, %d completion tokens, %s%s%s\n", prompt, t.usage.CompletionTokens, cost, t.timings(), t.route())
+}
+
+// tokensPerSecond returns the rate the last answer was generated at after
+// its first chunk, or zero if the provider didn't report enough to tell
+func (t *usageTracker) tokensPerSecond() float64 {
+	if len(t.requests) == 0 || t.metadata.TimeToFirstToken == 0 {
+		return 0
+	}
+	generation := t.metadata.Duration - t.metadata.TimeToFirstToken
+	tokens := t.requests[len(t.requests)-1].CompletionTokens
+	if generation <= 0 || tokens == 0 {
+		return 0
+	}
+	return float64(tokens) / generation.Seconds()
+}
+
+// timings describes how fast the last answer arrived, for the usage line
+func (t *usageTracker) timings() string {
+	if t.metadata.Duration == 0 {
+		return ""
+	}
+
+	var timings string
+	if t.metadata.TimeToFirstToken > 0 {
+		timings += fmt.Sprintf(", first token after %s", t.metadata.TimeToFirstToken.Round(time.Millisecond))
+	}
+	if rate := t.tokensPerSecond(); rate > 0 {
+		timings += fmt.Sprintf(", %.1f tokens/s", rate)
+	}
+	return timings + fmt.Sprintf(", %s total", t.metadata.Duration.Round(time.Millisecond))
+}
+
+// route describes where a router like OpenRouter sent the last request, for
+// the usage line
+func (t *usageTracker) route() string {
+	if t.metadata.Provider == "" {
+		return ""
+	}
+	if t.metadata.Model == "" {
+		return ", served by " + t.metadata.Provider
+	}
+	return fmt.Sprintf(", served by %s via %s", t.metadata.Model, t.metadata.Provider)
+}
+
+// save appends the usage of the tracked requests to the usage log. Failing to
+// record usage is only worth a warning.
+func (t *usageTracker) save(model string) {
+	if len(t.requests) == 0 {
+		return
+	}
+
+	records := make([]usage.Record, len(t.requests))
+	for i, request := range t.requests {
+		records[i] = usage.NewRecord(model, request)
+		records[i].Session = usageSession()
+	}
+	if err := usage.Append(usagePath(), records...); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to record usage: %v\n", err)
+	}
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Turee/si/pkg/config"
+	"github.com/Turee/si/pkg/llm"
+	"github.com/Turee/si/pkg/usage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// usageProvider is a MockProvider that reports a fixed usage for every request
+type usageProvider struct {
+	*MockProvider
+	usage    llm.Usage
+	callback func(llm.Usage)
+}
+
+func (p *usageProvider) SetUsageCallback(callback func(llm.Usage)) {
+	p.callback = callback
+}
+
+func (p *usageProvider) Chat(ctx context.Context, messages []llm.Message) (string, error) {
+	answer, err := p.MockProvider.Chat(ctx, messages)
+	if p.callback != nil {
+		p.callback(p.usage)
+	}
+	return answer, err
+}
+
+func (p *usageProvider) ChatStream(ctx context.Context, messages []llm.Message, callback func(chunk string) error) error {
+	err := p.MockProvider.ChatStream(ctx, messages, callback)
+	if p.callback != nil {
+		p.callback(p.usage)
+	}
+	return err
+}
+
+// TestUsageTrackerPrint tests the usage and cost summary
+func TestUsageTrackerPrint(t *testing.T) {
+	var buf bytes.Buffer
+	var tracker usageTracker
+	tracker.print(&buf, "gpt-4")
+	assert.Equal(t, "Usage: not reported by the provider\n", buf.String())
+
+	provider := &usageProvider{MockProvider: &MockProvider{}, usage: llm.Usage{PromptTokens: 1000, CompletionTokens: 500, TotalTokens: 1500}}
+	tracker.track(provider)
+	provider.Chat(context.Background(), []llm.Message{llm.NewUserMessage("hi")})
+	provider.Chat(context.Background(), []llm.Message{llm.NewUserMessage("hi")})
+
+	buf.Reset()
+	tracker.print(&buf, "gpt-4")
+	assert.Equal(t, "Usage: 2000 prompt tokens, 1000 completion tokens, estimated cost $0.120000\n", buf.String())
+
+	buf.Reset()
+	tracker.usage.CachedTokens = 100
+	tracker.print(&buf, "llama3")
+	assert.Equal(t, "Usage: 2000 prompt tokens (100 cached), 1000 completion tokens, cost unknown for llama3\n", buf.String())
+
+	// The timings of the last answer are reported with it
+	buf.Reset()
+	tracker.metadata = llm.Metadata{TimeToFirstToken: 250 * time.Millisecond, Duration: 10250 * time.Millisecond}
+	tracker.print(&buf, "llama3")
+	assert.Equal(t, "Usage: 2000 prompt tokens (100 cached), 1000 completion tokens, cost unknown for llama3, "+
+		"first token after 250ms, 50.0 tokens/s, 10.25s total\n", buf.String())
+	assert.InDelta(t, 50.0, tracker.tokensPerSecond(), 0.001)
+
+	// Routers like OpenRouter report where they sent the request
+	buf.Reset()
+	tracker.metadata = llm.Metadata{Model: "openai/gpt-4o", Provider: "Azure"}
+	tracker.print(&buf, "openai/gpt-4o")
+	assert.Equal(t, "Usage: 2000 prompt tokens (100 cached), 1000 completion tokens, estimated cost $0.014875, "+
+		"served by openai/gpt-4o via Azure\n", buf.String())
+}
+
+// TestCostFlag tests printing the cost to stderr after the answer
+func TestCostFlag(t *testing.T) {
+	cfg := &config.Config{LLM: config.LLMConfig{OpenAI: config.OpenAIConfig{APIKey: "test-api-key", ModelName: "gpt-4o"}}}
+
+	CLI.Cost = true
+	defer func() { CLI.Cost = false }()
+	logPath := mockUsagePath(t)
+
+	oldNewProvider := llm.NewProvider
+	defer func() { llm.NewProvider = oldNewProvider }()
+	llm.NewProvider = func(cfg *config.Config) (llm.Provider, error) {
+		return &usageProvider{
+			MockProvider: &MockProvider{AskResponse: "Paris"},
+			usage:        llm.Usage{PromptTokens: 10, CompletionTokens: 1, TotalTokens: 11},
+		}, nil
+	}
+
+	// Capture stdout and stderr
+	oldStdout, oldStderr := os.Stdout, os.Stderr
+	rOut, wOut, _ := os.Pipe()
+	rErr, wErr, _ := os.Pipe()
+	os.Stdout, os.Stderr = wOut, wErr
+	defer func() { os.Stdout, os.Stderr = oldStdout, oldStderr }()
+
+	err := handleQuestion(cfg, []string{"capital", "of", "France?"}, "")
+	wOut.Close()
+	wErr.Close()
+
+	var stdout, stderr bytes.Buffer
+	_, err2 := stdout.ReadFrom(rOut)
+	require.NoError(t, err2)
+	_, err2 = stderr.ReadFrom(rErr)
+	require.NoError(t, err2)
+
+	require.NoError(t, err)
+	assert.Equal(t, "Paris\n", stdout.String())
+	assert.Equal(t, "Usage: 10 prompt tokens, 1 completion tokens, estimated cost $0.000035\n", stderr.String())
+
+	// The usage is recorded in the usage log
+	records, err := usage.Load(logPath)
+	require.NoError(t, err)
+	require.Len(t, records, 1)
+	assert.Equal(t, "gpt-4o", records[0].Model)
+	assert.Equal(t, 10, records[0].PromptTokens)
+}
+
+// mockUsagePath makes the usage log a temporary file
+func mockUsagePath(t *testing.T) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "usage.jsonl")
+	oldUsagePath := usagePath
+	t.Cleanup(func() { usagePath = oldUsagePath })
+	usagePath = func() string { return path }
+	return path
+}
+
+// TestNewSessionID tests that session IDs differ between runs, even without
+// random bytes
+func TestNewSessionID(t *testing.T) {
+	assert.Regexp(t, `^\d{8}-\d{6}-[0-9a-f]{6}$`, newSessionID())
+
+	old := randRead
+	t.Cleanup(func() { randRead = old })
+	randRead = func(b []byte) (int, error) {
+		return 0, errors.New("no entropy")
+	}
+	pid := os.Getpid()
+	assert.Regexp(t, fmt.Sprintf(`^\d{8}-\d{6}-%02x%02x%02x$`, byte(pid>>16), byte(pid>>8), byte(pid)), newSessionID())
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/Turee/si/pkg/git"
+	"github.com/Turee/si/pkg/redact"
+	"github.com/alecthomas/kong"
+)
+
+// For testing purposes, we can override these functions
+var (
+	gitDiff       = git.Diff
+	gitIsRevision = git.IsRevision
+)
+
+// diffFlag is the value of --diff. The flag can be given alone to attach the
+// changes of the working tree, or followed by a git revision or range to diff
+// against.
+type diffFlag struct {
+	Enabled bool
+	Ref     string
+}
+
+// Decode implements kong.MapperValue. The argument after the flag is only
+// taken as the revision if git knows it, so that in `si --diff explain this`
+// "explain" remains part of the question. --diff=REF is never ambiguous.
+func (d *diffFlag) Decode(ctx *kong.DecodeContext) error {
+	d.Enabled = true
+
+	token := ctx.Scan.Peek()
+	switch {
+	case token.Type == kong.FlagValueToken:
+		d.Ref = fmt.Sprint(ctx.Scan.Pop().Value)
+	case token.IsValue() && gitIsRevision(context.Background(), token.String()):
+		d.Ref = fmt.Sprint(ctx.Scan.Pop().Value)
+	}
+	return nil
+}
+
+// IsBool implements kong.BoolMapperValue, so the flag doesn't require a value
+func (d *diffFlag) IsBool() bool {
+	return true
+}
+
+// attachDiff runs git diff as requested by --diff and appends the diff to the
+// question as framed context, with its secrets redacted
+func attachDiff(ctx context.Context, question string, redactor *redact.Redactor) (string, error) {
+	if !CLI.Diff.Enabled {
+		return question, nil
+	}
+
+	command := strings.TrimSpace("git diff " + CLI.Diff.Ref)
+	diff, err := gitDiff(ctx, CLI.Diff.Ref)
+	if err != nil {
+		return "", err
+	}
+	if strings.TrimSpace(diff) == "" {
+		return "", fmt.Errorf("%s shows no changes", command)
+	}
+
+	diff = redactor.Redact(diff)
+	framed := fmt.Sprintf("Output of `%s`:\n```diff\n%s\n```", command, strings.TrimRight(diff, "\n"))
+	if question == "" {
+		return framed, nil
+	}
+	return question + "\n\n" + framed, nil
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// mockGitDiff replaces git diff and the revision lookup; only the given
+// revisions exist
+func mockGitDiff(t *testing.T, diff string, revisions ...string) *string {
+	t.Helper()
+
+	var diffRef string
+	oldGitDiff, oldGitIsRevision := gitDiff, gitIsRevision
+	t.Cleanup(func() {
+		gitDiff, gitIsRevision = oldGitDiff, oldGitIsRevision
+		CLI.Diff = diffFlag{}
+	})
+	gitDiff = func(ctx context.Context, ref string) (string, error) {
+		diffRef = ref
+		return diff, nil
+	}
+	gitIsRevision = func(ctx context.Context, rev string) bool {
+		for _, revision := range revisions {
+			if rev == revision {
+				return true
+			}
+		}
+		return false
+	}
+	return &diffRef
+}
+
+// TestDiffFlag tests attaching git diff output to the question
+func TestDiffFlag(t *testing.T) {
+	provider := mockCommandEnvironment(t, "Release notes", false, "")
+	mockUsagePath(t)
+	diffRef := mockGitDiff(t, "+hello\n", "HEAD~3", "main...HEAD")
+
+	output := runMain(t, "--diff", "HEAD~3", "write", "release", "notes")
+	assert.Equal(t, "Release notes\n", output)
+	assert.Equal(t, "HEAD~3", *diffRef)
+	assert.Equal(t, "write release notes\n\nOutput of `git diff HEAD~3`:\n```diff\n+hello\n```", provider.QuestionAsked)
+
+	// Arguments that aren't revisions belong to the question
+	runMain(t, "--diff", "explain", "this")
+	assert.Equal(t, "", *diffRef)
+	assert.Equal(t, "explain this\n\nOutput of `git diff`:\n```diff\n+hello\n```", provider.QuestionAsked)
+
+	runMain(t, "--diff=main...HEAD")
+	assert.Equal(t, "main...HEAD", *diffRef)
+	assert.Equal(t, "Output of `git diff main...HEAD`:\n```diff\n+hello\n```", provider.QuestionAsked)
+}
+
+// TestDiffFlagNoChanges tests that an empty diff is reported
+func TestDiffFlagNoChanges(t *testing.T) {
+	mockCommandEnvironment(t, "Release notes", false, "")
+	mockGitDiff(t, "")
+
+	output, stderr := runMainOutput(t, "--diff", "write", "release", "notes")
+	assert.Empty(t, output)
+	assert.Contains(t, stderr, "Error: git diff shows no changes")
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Turee/si/pkg/config"
+	"github.com/Turee/si/pkg/ignore"
+	"github.com/Turee/si/pkg/redact"
+	"github.com/Turee/si/pkg/tokens"
+)
+
+// dirFile is a file of a --dir directory
+type dirFile struct {
+	path    string
+	content string
+}
+
+// attachDirs appends the text files of the --dir directories matching
+// --include to the question, each framed with its path. Files that don't
+// fit into what is left of the input limit are left out, and listed as such.
+func attachDirs(cfg *config.Config, question string, redactor *redact.Redactor) (string, error) {
+	if len(CLI.Dir) == 0 {
+		return question, nil
+	}
+
+	files, err := collectFiles(CLI.Dir, CLI.Include, CLI.Exclude)
+	if err != nil {
+		return "", err
+	}
+	if len(files) == 0 {
+		return "", fmt.Errorf("no text files in %s match", strings.Join(CLI.Dir, ", "))
+	}
+
+	// Files are added whole as long as they fit, smaller ones after them
+	// may still fit
+	limit := inputLimit(cfg)
+	budget := limit - len(question)
+	total := 0
+	var parts, omitted []string
+	if question != "" {
+		parts = append(parts, question)
+	}
+	for _, file := range files {
+		framed := frameFile(file.path, redactor.Redact(file.content))
+		total += tokens.Estimate(framed)
+		if limit > 0 && len(framed) > budget {
+			omitted = append(omitted, file.path)
+			continue
+		}
+		budget -= len(framed) + 2
+		parts = append(parts, framed)
+	}
+
+	if len(omitted) > 0 {
+		fmt.Fprintf(os.Stderr, "Warning: the files of --dir have about %d tokens, more than the limit of %d; leaving out %d of %d files (see --include and --max-input)\n",
+			total, limit/4, len(omitted), len(files))
+		parts = append(parts, "Files left out for lack of space: "+strings.Join(omitted, ", "))
+	}
+	return strings.Join(parts, "\n\n"), nil
+}
+
+// collectFiles reads the text files of the directories in the order of their
+// paths, skipping what .gitignore files and the exclude patterns ignore.
+// With include patterns only the files matching one of them are read.
+func collectFiles(dirs, include, exclude []string) ([]dirFile, error) {
+	var included ignore.Matcher
+	included.Add("", include)
+
+	var files []dirFile
+	for _, dir := range dirs {
+		info, err := os.Stat(dir)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			return nil, fmt.Errorf("%s is not a directory", dir)
+		}
+
+		err = ignore.Walk(dir, exclude, func(name string, d fs.DirEntry) error {
+			if !d.Type().IsRegular() || len(include) > 0 && !included.Match(name, false) {
+				return nil
+			}
+			path := filepath.Join(dir, filepath.FromSlash(name))
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			if isBinary(data) {
+				return nil
+			}
+			files = append(files, dirFile{path: filepath.ToSlash(path), content: string(data)})
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
+
+// frameFile frames the content of a file with its path in a fence that code
+// blocks in the file can't close
+func frameFile(path, content string) string {
+	fence := fenceFor(content)
+	return fmt.Sprintf("Content of %s:\n%s\n%s\n%s", path, fence, strings.TrimRight(content, "\n"), fence)
+}
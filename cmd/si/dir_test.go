@@ -0,0 +1,84 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Turee/si/pkg/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// mockProject creates a project directory with the files and makes it the
+// working directory
+func mockProject(t *testing.T, files map[string]string) {
+	t.Helper()
+
+	project := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(project, filepath.FromSlash(name))
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	}
+
+	oldDir, err := os.Getwd()
+	require.NoError(t, err)
+	require.NoError(t, os.Chdir(project))
+	t.Cleanup(func() { os.Chdir(oldDir) })
+}
+
+// TestDirContext tests adding the files of a directory to the question
+func TestDirContext(t *testing.T) {
+	provider := mockCommandEnvironment(t, "Answer", false, "")
+	mockUsagePath(t)
+	mockProject(t, map[string]string{
+		"src/.gitignore":        "gen/\n",
+		"src/main.go":           "package main\n",
+		"src/main_test.go":      "package main\n\n// ```\n",
+		"src/README.md":         "# Tool\n",
+		"src/gen/types.go":      "package gen\n",
+		"src/vendor/lib/lib.go": "package lib\n",
+		"src/logo.png":          "\x89PNG\x00",
+	})
+	t.Cleanup(func() { CLI.Dir, CLI.Include, CLI.Exclude = nil, nil, nil })
+
+	runMain(t, "--no-stream", "--dir", "./src", "--include", "*.go", "--exclude", "vendor/", "explain", "this")
+	assert.Equal(t, "explain this\n\nContent of src/main.go:\n```\npackage main\n```\n\n"+
+		"Content of src/main_test.go:\n````\npackage main\n\n// ```\n````", provider.QuestionAsked)
+
+	// Without --include every text file is added
+	CLI.Include, CLI.Exclude = nil, nil
+	runMain(t, "--no-stream", "--dir", "src", "summarize")
+	assert.Contains(t, provider.QuestionAsked, "Content of src/README.md:")
+	assert.Contains(t, provider.QuestionAsked, "Content of src/vendor/lib/lib.go:")
+	assert.NotContains(t, provider.QuestionAsked, "gen/types.go")
+	assert.NotContains(t, provider.QuestionAsked, "logo.png")
+
+	_, stderr := runMainOutput(t, "--no-stream", "--dir", "src", "--include", "*.rs", "summarize")
+	assert.Contains(t, stderr, "no text files in src match")
+}
+
+// TestDirBudget tests leaving out the files that don't fit into the input
+// limit
+func TestDirBudget(t *testing.T) {
+	provider := mockCommandEnvironment(t, "Answer", false, "")
+	mockUsagePath(t)
+	mockProject(t, map[string]string{
+		"a.txt": "small\n",
+		"b.txt": "a much longer file that doesn't fit\n",
+		"c.txt": "tiny\n",
+	})
+	loadConfigFunc = func(path string) (*config.Config, error) {
+		return &config.Config{
+			LLM:   config.LLMConfig{OpenAI: config.OpenAIConfig{APIKey: "test-api-key"}},
+			Input: config.InputConfig{MaxTokens: 20},
+		}, nil
+	}
+	t.Cleanup(func() { CLI.Dir = nil })
+
+	_, stderr := runMainOutput(t, "--no-stream", "--dir", ".", "summarize")
+	assert.Contains(t, stderr, "Warning: the files of --dir have about 32 tokens, more than the limit of 20; leaving out 1 of 3 files")
+	assert.Equal(t, "summarize\n\nContent of a.txt:\n```\nsmall\n```\n\nContent of c.txt:\n```\ntiny\n```\n\n"+
+		"Files left out for lack of space: b.txt", provider.QuestionAsked)
+}
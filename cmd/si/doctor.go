@@ -0,0 +1,376 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/Turee/si/pkg/config"
+	"github.com/Turee/si/pkg/copilot"
+	"github.com/Turee/si/pkg/llm"
+	"github.com/Turee/si/pkg/logging"
+	"github.com/Turee/si/pkg/termcap"
+	"github.com/alecthomas/kong"
+)
+
+// DoctorCmd checks the configuration and the connection to the provider and
+// explains how to fix what fails
+type DoctorCmd struct {
+	Timeout time.Duration `name:"timeout" default:"10s" help:"Time limit of each network check"`
+}
+
+// checkStatus is the outcome of a diagnostic check
+type checkStatus int
+
+const (
+	checkOK checkStatus = iota
+	checkWarn
+	checkFail
+	checkSkipped
+)
+
+// check is the result of a diagnostic check
+type check struct {
+	name   string
+	status checkStatus
+	detail string
+
+	// hint tells how to fix a failed check
+	hint string
+}
+
+// doctor runs the checks and prints their results as they complete
+type doctor struct {
+	out     io.Writer
+	caps    termcap.Capabilities
+	timeout time.Duration
+	failed  int
+}
+
+// Run checks the configuration, the reachability of the provider, the API key
+// and the model, and fails if any check failed
+func (c *DoctorCmd) Run(kongCtx *kong.Context) error {
+	d := &doctor{
+		out:     os.Stdout,
+		caps:    capabilities(&config.Config{}, stdoutStat),
+		timeout: c.Timeout,
+	}
+
+	ctx, stop := notifyInterrupt(context.Background())
+	defer stop()
+
+	d.run(ctx, kongCtx)
+	if d.failed > 0 {
+		return fmt.Errorf("%d of the checks failed", d.failed)
+	}
+	return nil
+}
+
+// run performs the checks in order. Checks that depend on a failed one are
+// not run.
+func (d *doctor) run(ctx context.Context, kongCtx *kong.Context) {
+	cfg, ok := d.checkConfig(kongCtx)
+	if !ok {
+		return
+	}
+	if !d.checkAPIKey(cfg) {
+		return
+	}
+
+	target, err := url.Parse(providerURL(cfg))
+	if err != nil || target.Host == "" {
+		d.report(check{name: "base URL", status: checkFail, detail: fmt.Sprintf("%q is not a URL", providerURL(cfg)), hint: "Set base_url to the URL of the API, e.g. " + config.DefaultBaseURL})
+		return
+	}
+	if !d.checkNetwork(ctx, cfg, target) {
+		return
+	}
+
+	d.checkProvider(ctx, cfg)
+}
+
+// report prints the result of a check, with the hint on how to fix it
+// aligned below the detail
+func (d *doctor) report(c check) {
+	symbols := map[checkStatus]string{checkOK: "ok  ", checkWarn: "warn", checkFail: "FAIL", checkSkipped: "skip"}
+	if d.caps.Unicode {
+		symbols = map[checkStatus]string{checkOK: "✓", checkWarn: "!", checkFail: "✗", checkSkipped: "-"}
+	}
+	symbol := symbols[c.status]
+	indent := strings.Repeat(" ", utf8.RuneCountInString(symbol)+13)
+
+	switch c.status {
+	case checkOK:
+		symbol = d.caps.Foreground(symbol, termcap.Green)
+	case checkWarn:
+		symbol = d.caps.Foreground(symbol, termcap.Yellow)
+	case checkFail:
+		symbol = d.caps.Foreground(symbol, termcap.Red)
+		d.failed++
+	}
+
+	fmt.Fprintf(d.out, "%s %-11s %s\n", symbol, c.name, c.detail)
+	if c.hint != "" {
+		fmt.Fprintf(d.out, "%s%s\n", indent, c.hint)
+	}
+}
+
+// checkConfig loads the configuration with the selected profile, provider and
+// overrides, and validates it
+func (d *doctor) checkConfig(kongCtx *kong.Context) (*config.Config, bool) {
+	path := configFilePath()
+	cfg, err := loadConfigFunc(CLI.ConfigPath)
+	if err != nil {
+		hint := "Fix the file; si config get and set edit single settings"
+		if errors.Is(err, fs.ErrNotExist) {
+			hint = "Run si config init to create it"
+		}
+		d.report(check{name: "config", status: checkFail, detail: err.Error(), hint: hint})
+		return nil, false
+	}
+
+	if missing := cfg.MissingEnv(); len(missing) > 0 {
+		d.report(check{
+			name:   "environment",
+			status: checkWarn,
+			detail: "the config file refers to unset variables: " + strings.Join(missing, ", "),
+			hint:   "Export them, or write $${...} for a literal ${...}",
+		})
+	}
+
+	for _, apply := range []func(*config.Config) error{applyProfile, applyProvider} {
+		if err := apply(cfg); err != nil {
+			d.report(check{name: "config", status: checkFail, detail: err.Error(), hint: "Check --profile, --provider and the profiles and providers of " + path})
+			return nil, false
+		}
+	}
+	applyOverrides(kongCtx, cfg)
+
+	if err := cfg.Validate(); err != nil {
+		d.report(check{name: "config", status: checkFail, detail: err.Error(), hint: "si explain-config shows where each value comes from"})
+		return nil, false
+	}
+	if err := logging.SetupFile(cfg.LogLevel, config.ExpandPath(cfg.LogFile), stderr); err != nil {
+		d.report(check{name: "config", status: checkFail, detail: err.Error(), hint: "Check log_file"})
+		return nil, false
+	}
+
+	detail := path + " is valid"
+	if cfg.LLM.Provider != "" {
+		detail += ", using provider " + cfg.LLM.Provider
+	}
+	d.report(check{name: "config", status: checkOK, detail: detail})
+	return cfg, true
+}
+
+// checkAPIKey runs api_key_cmd, if configured
+func (d *doctor) checkAPIKey(cfg *config.Config) bool {
+	openai := &cfg.LLM.OpenAI
+	switch {
+	case openai.APIKeyCmd != "":
+		if err := resolveAPIKey(cfg); err != nil {
+			d.report(check{name: "API key", status: checkFail, detail: err.Error(), hint: "Run the command in a shell to see why it fails"})
+			return false
+		}
+		d.report(check{name: "API key", status: checkOK, detail: "read from api_key_cmd"})
+	case len(openai.APIKeys) > 0:
+		d.report(check{name: "API key", status: checkOK, detail: fmt.Sprintf("%d keys in api_keys", len(openai.APIKeys))})
+	case cfg.ProviderType() == config.ProviderTypeCopilot:
+		d.report(check{name: "API key", status: checkSkipped, detail: "GitHub Copilot signs in with si copilot login"})
+	case openai.APIKey != "":
+		d.report(check{name: "API key", status: checkOK, detail: "set"})
+	default:
+		d.report(check{name: "API key", status: checkSkipped, detail: "none configured"})
+	}
+	return true
+}
+
+// providerURL returns the base URL requests are sent to
+func providerURL(cfg *config.Config) string {
+	switch {
+	case cfg.LLM.OpenAI.BaseURL != "":
+		return cfg.LLM.OpenAI.BaseURL
+	case cfg.ProviderType() == config.ProviderTypeCopilot:
+		return copilot.DefaultAPIURL
+	default:
+		return config.DefaultBaseURL
+	}
+}
+
+// checkNetwork resolves the host of the provider and connects to it,
+// verifying its certificate. Both are left to the proxy if one is used.
+func (d *doctor) checkNetwork(ctx context.Context, cfg *config.Config, target *url.URL) bool {
+	host, port := target.Hostname(), target.Port()
+	if port == "" {
+		port = map[string]string{"http": "80", "https": "443"}[target.Scheme]
+	}
+
+	proxy, err := proxyURL(cfg, target)
+	if err != nil {
+		d.report(check{name: "proxy", status: checkFail, detail: err.Error(), hint: "Fix proxy or the HTTPS_PROXY and HTTP_PROXY environment variables"})
+		return false
+	}
+	if proxy != nil {
+		d.report(check{name: "network", status: checkSkipped, detail: fmt.Sprintf("requests go through the proxy %s, which resolves and connects to %s", proxy.Host, host)})
+		return true
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, d.timeout)
+	defer cancel()
+
+	addrs, err := net.DefaultResolver.LookupHost(ctx, host)
+	if err != nil {
+		d.report(check{name: "DNS", status: checkFail, detail: err.Error(), hint: "Check the host of base_url and your network connection"})
+		return false
+	}
+	d.report(check{name: "DNS", status: checkOK, detail: fmt.Sprintf("%s resolves to %s", host, strings.Join(addrs, ", "))})
+
+	address := net.JoinHostPort(host, port)
+	dialer := &net.Dialer{}
+	if target.Scheme != "https" {
+		conn, err := dialer.DialContext(ctx, "tcp", address)
+		if err != nil {
+			d.report(check{name: "connect", status: checkFail, detail: err.Error(), hint: "Check that the server is running and the port of base_url"})
+			return false
+		}
+		conn.Close()
+		d.report(check{name: "connect", status: checkOK, detail: address + " accepts connections"})
+		return true
+	}
+
+	tlsConfig, err := llm.NewTLSConfig(&cfg.LLM.OpenAI.TLS)
+	if err != nil {
+		d.report(check{name: "TLS", status: checkFail, detail: err.Error(), hint: "Check tls.ca_file, tls.cert_file and tls.key_file"})
+		return false
+	}
+	if tlsConfig == nil {
+		tlsConfig = &tls.Config{}
+	}
+	tlsConfig.ServerName = host
+	conn, err := (&tls.Dialer{NetDialer: dialer, Config: tlsConfig}).DialContext(ctx, "tcp", address)
+	if err != nil {
+		d.report(check{name: "TLS", status: checkFail, detail: err.Error(), hint: tlsHint(err)})
+		return false
+	}
+	defer conn.Close()
+
+	detail := "connected to " + address
+	if certs := conn.(*tls.Conn).ConnectionState().PeerCertificates; len(certs) > 0 {
+		detail += fmt.Sprintf(", certificate valid until %s", certs[0].NotAfter.Format(time.DateOnly))
+	}
+	if cfg.LLM.OpenAI.TLS.InsecureSkipVerify {
+		d.report(check{name: "TLS", status: checkWarn, detail: detail + " without verifying the certificate", hint: "Remove tls.insecure_skip_verify outside of tests"})
+		return true
+	}
+	d.report(check{name: "TLS", status: checkOK, detail: detail})
+	return true
+}
+
+// proxyURL returns the proxy of requests to the target, or nil
+func proxyURL(cfg *config.Config, target *url.URL) (*url.URL, error) {
+	if cfg.LLM.OpenAI.Proxy != "" {
+		return url.Parse(cfg.LLM.OpenAI.Proxy)
+	}
+	return http.ProxyFromEnvironment(&http.Request{URL: target})
+}
+
+// tlsHint explains how to fix a failed TLS handshake
+func tlsHint(err error) string {
+	var unknownAuthority x509.UnknownAuthorityError
+	var hostname x509.HostnameError
+	var invalid x509.CertificateInvalidError
+	switch {
+	case errors.As(err, &unknownAuthority):
+		return "The certificate is signed by an unknown CA; add the CA with tls.ca_file"
+	case errors.As(err, &hostname):
+		return "The certificate is for another host; check the host of base_url"
+	case errors.As(err, &invalid) && invalid.Reason == x509.Expired:
+		return "The certificate has expired or the system clock is wrong"
+	default:
+		return "Check that base_url uses the right scheme and port"
+	}
+}
+
+// checkProvider authenticates with the provider by listing its models, and
+// checks that the model is available, sending a one-token question unless
+// the listing shows it
+func (d *doctor) checkProvider(ctx context.Context, cfg *config.Config) {
+	testCfg := *cfg
+	testCfg.SetSampling(config.SamplingConfig{MaxTokens: 1})
+	provider, err := llm.NewProvider(&testCfg)
+	if err != nil {
+		d.report(check{name: "provider", status: checkFail, detail: err.Error()})
+		return
+	}
+	model := modelName(cfg)
+
+	var models []llm.Model
+	if describer, ok := provider.(llm.ModelDescriber); ok {
+		listCtx, cancel := context.WithTimeout(ctx, d.timeout)
+		models, err = describer.DescribeModels(listCtx)
+		cancel()
+		switch {
+		case err == nil:
+			d.report(check{name: "auth", status: checkOK, detail: fmt.Sprintf("the provider accepted the key and lists %d models", len(models))})
+		case isAuthError(err):
+			d.report(check{name: "auth", status: checkFail, detail: err.Error(), hint: authHint(cfg)})
+			return
+		default:
+			// Some servers don't list their models, the question below
+			// still checks the key
+			d.report(check{name: "auth", status: checkWarn, detail: "listing the models failed: " + err.Error()})
+		}
+	}
+
+	// Azure lists the models of the resource, not its deployments
+	listed := slices.ContainsFunc(models, func(m llm.Model) bool { return m.ID == model })
+	if listed && cfg.LLM.OpenAI.AzureDeploymentName == "" {
+		d.report(check{name: "model", status: checkOK, detail: model + " is available"})
+		return
+	}
+
+	askCtx, cancel := context.WithTimeout(ctx, d.timeout)
+	defer cancel()
+	start := now()
+	_, err = provider.Chat(askCtx, []llm.Message{llm.NewUserMessage(warmupQuestion)})
+	switch {
+	case err == nil:
+		d.report(check{name: "model", status: checkOK, detail: fmt.Sprintf("%s answered in %s", model, now().Sub(start).Round(time.Millisecond))})
+	case llm.IsModelNotFound(err):
+		d.report(check{name: "model", status: checkFail, detail: err.Error(), hint: "si models lists the available models; pick one with --model or model_name"})
+	case isAuthError(err):
+		d.report(check{name: "model", status: checkFail, detail: err.Error(), hint: authHint(cfg)})
+	default:
+		d.report(check{name: "model", status: checkFail, detail: err.Error(), hint: "si --debug shows the request and the response"})
+	}
+}
+
+// isAuthError reports whether the provider rejected the credentials
+func isAuthError(err error) bool {
+	var apiErr *llm.APIError
+	return errors.As(err, &apiErr) && (apiErr.StatusCode == http.StatusUnauthorized || apiErr.StatusCode == http.StatusForbidden)
+}
+
+// authHint explains how to fix rejected credentials
+func authHint(cfg *config.Config) string {
+	if cfg.ProviderType() == config.ProviderTypeCopilot {
+		return "Sign in again with si copilot login"
+	}
+	hint := "Check api_key, or that the key belongs to the provider of base_url"
+	if cfg.LLM.OpenAI.OrganizationID != "" || cfg.LLM.OpenAI.ProjectID != "" {
+		hint += ", organization_id and project_id"
+	}
+	return hint
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"encoding/pem"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Turee/si/pkg/config"
+	"github.com/Turee/si/pkg/llm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// mockDoctor lets si doctor check the provider of the config against a real
+// provider
+func mockDoctor(t *testing.T, openai config.OpenAIConfig) {
+	t.Helper()
+	newProvider := llm.NewProvider
+	mockCommandEnvironment(t, "", false, "")
+	llm.NewProvider = newProvider
+	t.Cleanup(func() { CLI.ConfigPath = "" })
+
+	loadConfigFunc = func(path string) (*config.Config, error) {
+		return &config.Config{LLM: config.LLMConfig{OpenAI: openai}}, nil
+	}
+}
+
+// providerServer serves the model list and answers questions of the model
+func providerServer(models string, status int) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if status != http.StatusOK {
+			w.WriteHeader(status)
+			w.Write([]byte(`{"error":{"message":"Incorrect API key provided"}}`))
+			return
+		}
+		switch r.URL.Path {
+		case "/v1/models":
+			w.Write([]byte(`{"data":[` + models + `]}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"error":{"message":"The model does not exist","code":"model_not_found"}}`))
+		}
+	}
+}
+
+// TestDoctor tests the checks of a working configuration
+func TestDoctor(t *testing.T) {
+	server := httptest.NewServer(providerServer(`{"id":"gpt-4o"}`, http.StatusOK))
+	t.Cleanup(server.Close)
+	mockDoctor(t, config.OpenAIConfig{BaseURL: server.URL + "/v1", APIKey: "test-api-key", ModelName: "gpt-4o"})
+
+	stdout, stderr := runMainOutput(t, "--config", "/etc/si.yaml", "doctor")
+	assert.Contains(t, stdout, "ok   config      /etc/si.yaml is valid\n")
+	assert.Contains(t, stdout, "ok   API key     set\n")
+	assert.Contains(t, stdout, "ok   DNS         127.0.0.1 resolves to 127.0.0.1\n")
+	assert.Contains(t, stdout, "ok   connect     "+server.Listener.Addr().String()+" accepts connections\n")
+	assert.Contains(t, stdout, "ok   auth        the provider accepted the key and lists 1 models\n")
+	assert.Contains(t, stdout, "ok   model       gpt-4o is available\n")
+	assert.Empty(t, stderr)
+}
+
+// TestDoctorFailures tests the diagnostics of failed checks
+func TestDoctorFailures(t *testing.T) {
+	t.Run("Unknown model", func(t *testing.T) {
+		server := httptest.NewServer(providerServer(`{"id":"gpt-4o"}`, http.StatusOK))
+		t.Cleanup(server.Close)
+		mockDoctor(t, config.OpenAIConfig{BaseURL: server.URL + "/v1", APIKey: "test-api-key", ModelName: "gpt-5-typo"})
+
+		stdout, stderr := runMainOutput(t, "doctor")
+		assert.Contains(t, stdout, "FAIL model       API request failed with status 404")
+		assert.Contains(t, stdout, "si models lists the available models")
+		assert.Equal(t, "Error: 1 of the checks failed\n", stderr)
+	})
+
+	t.Run("Rejected key", func(t *testing.T) {
+		server := httptest.NewServer(providerServer("", http.StatusUnauthorized))
+		t.Cleanup(server.Close)
+		mockDoctor(t, config.OpenAIConfig{BaseURL: server.URL + "/v1", APIKey: "wrong-key"})
+
+		stdout, _ := runMainOutput(t, "doctor")
+		assert.Contains(t, stdout, "FAIL auth        API request failed with status 401")
+		assert.Contains(t, stdout, "Check api_key")
+		assert.NotContains(t, stdout, "model")
+	})
+
+	t.Run("Missing config file", func(t *testing.T) {
+		mockDoctor(t, config.OpenAIConfig{})
+		loadConfigFunc = func(path string) (*config.Config, error) {
+			return nil, &fs.PathError{Op: "open", Path: "si.yaml", Err: fs.ErrNotExist}
+		}
+
+		stdout, _ := runMainOutput(t, "doctor")
+		assert.Contains(t, stdout, "FAIL config      open si.yaml: file does not exist\n")
+		assert.Contains(t, stdout, "Run si config init to create it\n")
+	})
+
+	t.Run("Invalid config", func(t *testing.T) {
+		mockDoctor(t, config.OpenAIConfig{APIKey: "test-api-key", Proxy: "proxy:8080"})
+
+		stdout, _ := runMainOutput(t, "doctor")
+		assert.Contains(t, stdout, "FAIL config      proxy must be an http, https, socks5 or socks5h URL")
+		assert.Contains(t, stdout, "si explain-config shows where each value comes from\n")
+	})
+}
+
+// TestDoctorTLS tests diagnosing certificates of private CAs
+func TestDoctorTLS(t *testing.T) {
+	server := httptest.NewTLSServer(providerServer(`{"id":"gpt-4o"}`, http.StatusOK))
+	t.Cleanup(server.Close)
+	mockDoctor(t, config.OpenAIConfig{BaseURL: server.URL + "/v1", APIKey: "test-api-key", ModelName: "gpt-4o"})
+
+	stdout, _ := runMainOutput(t, "doctor")
+	assert.Contains(t, stdout, "FAIL TLS")
+	assert.Contains(t, stdout, "add the CA with tls.ca_file")
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	require.NoError(t, os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}), 0o600))
+	mockDoctor(t, config.OpenAIConfig{BaseURL: server.URL + "/v1", APIKey: "test-api-key", ModelName: "gpt-4o", TLS: config.TLSConfig{CAFile: caFile}})
+
+	stdout, stderr := runMainOutput(t, "doctor")
+	assert.Contains(t, stdout, "ok   TLS         connected to "+server.Listener.Addr().String()+", certificate valid until")
+	assert.Contains(t, stdout, "ok   model       gpt-4o is available\n")
+	assert.Empty(t, stderr)
+}
@@ -0,0 +1,19 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/Turee/si/pkg/llm"
+)
+
+// useDryRun makes the provider print its requests to stdout instead of
+// sending them
+func useDryRun(provider llm.Provider) error {
+	runner, ok := provider.(llm.DryRunner)
+	if !ok {
+		return fmt.Errorf("the configured provider does not support --dry-run")
+	}
+	runner.SetDryRun(os.Stdout)
+	return nil
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/Turee/si/pkg/config"
+	"github.com/Turee/si/pkg/llm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestDryRun tests printing the request with the expanded prompt template
+// instead of sending it
+func TestDryRun(t *testing.T) {
+	mockCommandEnvironment(t, "", false, "")
+	mockUsagePath(t)
+	defer func() { CLI.DryRun, CLI.Prompt = false, "" }()
+
+	loadConfigFunc = func(path string) (*config.Config, error) {
+		return &config.Config{
+			LLM:     config.LLMConfig{OpenAI: config.OpenAIConfig{APIKey: "sk-secret", BaseURL: "http://127.0.0.1:1/v1", ModelName: "gpt-4o"}},
+			Prompts: map[string]config.PromptConfig{"translate": {Template: "Translate to French: {{.Args}}"}},
+		}, nil
+	}
+	llm.NewProvider = func(cfg *config.Config) (llm.Provider, error) {
+		return llm.NewOpenAIProvider(&cfg.LLM.OpenAI)
+	}
+
+	output, stderr := runMainOutput(t, "--dry-run", "-p", "translate", "good", "morning")
+	assert.Empty(t, stderr)
+	assert.NotContains(t, output, "sk-secret")
+
+	var request struct {
+		Method  string            `json:"method"`
+		URL     string            `json:"url"`
+		Headers map[string]string `json:"headers"`
+		Body    struct {
+			Model    string `json:"model"`
+			Messages []struct {
+				Role    string `json:"role"`
+				Content string `json:"content"`
+			} `json:"messages"`
+		} `json:"body"`
+	}
+	require.NoError(t, json.Unmarshal([]byte(output), &request))
+	assert.Equal(t, "POST", request.Method)
+	assert.Equal(t, "http://127.0.0.1:1/v1/chat/completions", request.URL)
+	assert.Equal(t, "[redacted]", request.Headers["Authorization"])
+	assert.Equal(t, "gpt-4o", request.Body.Model)
+	require.Len(t, request.Body.Messages, 2)
+	assert.Equal(t, "Translate to French: good morning", request.Body.Messages[1].Content)
+}
+
+// TestDryRunUnsupported tests that providers that can't print their
+// requests are reported
+func TestDryRunUnsupported(t *testing.T) {
+	mockCommandEnvironment(t, "answer", false, "")
+	defer func() { CLI.DryRun = false }()
+
+	output, stderr := runMainOutput(t, "--dry-run", "question")
+	assert.Empty(t, output)
+	assert.Contains(t, stderr, "does not support --dry-run")
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/Turee/si/pkg/config"
+	"github.com/Turee/si/pkg/llm"
+	"github.com/alecthomas/kong"
+)
+
+// EmbedCmd prints the embeddings of texts for similarity pipelines
+type EmbedCmd struct {
+	Text []string `arg:"" optional:"" help:"Texts to embed when nothing is piped via stdin, one per argument"`
+}
+
+// embedding is the embedding of a text as it is printed
+type embedding struct {
+	Index     int       `json:"index"`
+	Text      string    `json:"text"`
+	Embedding []float32 `json:"embedding"`
+}
+
+// Run embeds every non-empty line of stdin, or every argument, and prints
+// the embeddings as a JSON object per line, or as a single array with
+// --output json
+func (c *EmbedCmd) Run(kongCtx *kong.Context) error {
+	input, err := checkStdin()
+	if err != nil {
+		return err
+	}
+	texts := c.Text
+	if input != "" {
+		texts = embedLines(input)
+	}
+	if len(texts) == 0 {
+		printUsage(kongCtx)
+		return nil
+	}
+
+	cfg := loadConfiguration(kongCtx)
+	if cfg == nil {
+		return nil
+	}
+	embedder, err := newEmbedder(cfg)
+	if err != nil {
+		return err
+	}
+	redactor, err := newRedactor(cfg)
+	if err != nil {
+		return err
+	}
+	// The texts are printed as they are, but embedded without their secrets
+	inputs := make([]string, len(texts))
+	for i, text := range texts {
+		inputs[i] = redactor.Redact(text)
+	}
+	warnRedacted(redactor)
+
+	ctx, stop := notifyInterrupt(context.Background())
+	defer stop()
+
+	model := embedModel(cfg)
+	var embeddings []embedding
+	encoder := json.NewEncoder(os.Stdout)
+	batch := cfg.Embed.Batch()
+	for start := 0; start < len(texts); start += batch {
+		end := min(start+batch, len(texts))
+		chunk := texts[start:end]
+		vectors, err := embedder.Embed(ctx, model, inputs[start:end])
+		if err != nil {
+			return fmt.Errorf("error computing embeddings with %s: %w", model, err)
+		}
+
+		for i, vector := range vectors {
+			e := embedding{Index: start + i, Text: chunk[i], Embedding: vector}
+			if CLI.Output == outputJSON {
+				embeddings = append(embeddings, e)
+			} else if err := encoder.Encode(e); err != nil {
+				return err
+			}
+		}
+	}
+
+	if CLI.Output == outputJSON {
+		return encoder.Encode(embeddings)
+	}
+	return nil
+}
+
+// newEmbedder creates the provider for computing embeddings
+func newEmbedder(cfg *config.Config) (llm.Embedder, error) {
+	provider, err := llm.NewProvider(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("error creating LLM provider: %w", err)
+	}
+	embedder, ok := provider.(llm.Embedder)
+	if !ok {
+		return nil, errors.New("the configured provider can't compute embeddings")
+	}
+	return embedder, nil
+}
+
+// embedLines returns the lines of the input to embed, without blank lines
+// and line endings
+func embedLines(input string) []string {
+	var lines []string
+	for _, line := range strings.Split(input, "\n") {
+		line = strings.TrimSuffix(line, "\r")
+		if strings.TrimSpace(line) != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+// embedModel returns the embedding model: the one of --model, the
+// configured one or the default
+func embedModel(cfg *config.Config) string {
+	switch {
+	case CLI.Model != "":
+		return CLI.Model
+	case cfg.Embed.Model != "":
+		return cfg.Embed.Model
+	default:
+		return llm.DefaultEmbeddingModel
+	}
+}
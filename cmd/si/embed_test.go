@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/Turee/si/pkg/config"
+	"github.com/Turee/si/pkg/llm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// batchEmbedder is a mock provider that embeds texts as their lengths and
+// records the model and the batches
+type batchEmbedder struct {
+	*MockProvider
+	model   string
+	batches [][]string
+}
+
+func (p *batchEmbedder) Embed(ctx context.Context, model string, texts []string) ([][]float32, error) {
+	p.model = model
+	p.batches = append(p.batches, texts)
+	embeddings := make([][]float32, len(texts))
+	for i, text := range texts {
+		embeddings[i] = []float32{float32(len(text)), 1}
+	}
+	return embeddings, nil
+}
+
+// mockEmbedEnvironment sets up an embedding provider with the embed config
+func mockEmbedEnvironment(t *testing.T, embed config.EmbedConfig) *batchEmbedder {
+	mockCommandEnvironment(t, "", false, "")
+	loadConfigFunc = func(path string) (*config.Config, error) {
+		return &config.Config{
+			LLM:   config.LLMConfig{OpenAI: config.OpenAIConfig{APIKey: "test-api-key"}},
+			Embed: embed,
+		}, nil
+	}
+
+	provider := &batchEmbedder{MockProvider: &MockProvider{}}
+	llm.NewProvider = func(cfg *config.Config) (llm.Provider, error) {
+		return provider, nil
+	}
+	return provider
+}
+
+// TestEmbedStdin tests printing the embeddings of the lines of stdin
+func TestEmbedStdin(t *testing.T) {
+	provider := mockEmbedEnvironment(t, config.EmbedConfig{BatchSize: 2})
+	mockPipedInput(t, "first\r\n\nsecond line\nthird\n")
+
+	output := runMain(t, "embed")
+	assert.Equal(t, `{"index":0,"text":"first","embedding":[5,1]}
+{"index":1,"text":"second line","embedding":[11,1]}
+{"index":2,"text":"third","embedding":[5,1]}
+`, output)
+	assert.Equal(t, [][]string{{"first", "second line"}, {"third"}}, provider.batches)
+	assert.Equal(t, llm.DefaultEmbeddingModel, provider.model)
+
+	// --output json prints a single array
+	t.Cleanup(func() { CLI.Output = "text" })
+	output = runMain(t, "--output", "json", "embed")
+	var embeddings []embedding
+	require.NoError(t, json.Unmarshal([]byte(output), &embeddings))
+	assert.Len(t, embeddings, 3)
+	assert.Equal(t, "third", embeddings[2].Text)
+}
+
+// TestEmbedArguments tests embedding the arguments with the selected model
+func TestEmbedArguments(t *testing.T) {
+	provider := mockEmbedEnvironment(t, config.EmbedConfig{Model: "nomic-embed-text"})
+
+	output := runMain(t, "embed", "a cat", "a dog")
+	assert.Equal(t, 2, strings.Count(output, "\n"))
+	assert.Equal(t, "nomic-embed-text", provider.model)
+
+	t.Cleanup(func() { CLI.Model = "" })
+	runMain(t, "embed", "-m", "text-embedding-3-large", "a cat")
+	assert.Equal(t, "text-embedding-3-large", provider.model)
+}
+
+// TestEmbedUnsupportedProvider tests providers without embeddings
+func TestEmbedUnsupportedProvider(t *testing.T) {
+	mockCommandEnvironment(t, "", false, "")
+
+	_, stderr := runMainOutput(t, "embed", "a cat")
+	assert.Contains(t, stderr, "the configured provider can't compute embeddings")
+}
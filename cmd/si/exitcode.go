@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/url"
+
+	"github.com/Turee/si/pkg/copilot"
+	"github.com/Turee/si/pkg/llm"
+)
+
+// Exit codes tell scripts why si failed without parsing the error
+const (
+	// exitError is the exit code of failures without a code of their own
+	exitError = 1
+
+	// exitConfig is the exit code when the configuration can't be loaded or
+	// is invalid
+	exitConfig = 2
+
+	// exitAuth is the exit code when no API key can be obtained or the
+	// provider rejects it
+	exitAuth = 3
+
+	// exitRateLimited is the exit code when the provider rate limits the
+	// request, even after retrying
+	exitRateLimited = 4
+
+	// exitNetwork is the exit code when the provider can't be reached, the
+	// connection drops or the request times out
+	exitNetwork = 5
+
+	// exitNoAnswer is the exit code when the model refuses to answer,
+	// answers with nothing or without the requested code
+	exitNoAnswer = 6
+
+	// exitInterrupted is the exit code when the user interrupts si with
+	// Ctrl+C, following the shell convention of 128 plus the signal number
+	exitInterrupted = 130
+)
+
+// errEmptyAnswer is returned when the model answers with nothing but
+// whitespace
+var errEmptyAnswer = errors.New("the model returned an empty answer")
+
+// authError marks errors obtaining the API key
+type authError struct {
+	err error
+}
+
+// Error implements the error interface
+func (e *authError) Error() string {
+	return e.err.Error()
+}
+
+// Unwrap returns the underlying error
+func (e *authError) Unwrap() error {
+	return e.err
+}
+
+// exitCode returns the exit code for an error returned by a command
+func exitCode(err error) int {
+	var authErr *authError
+	var refusal *llm.RefusalError
+	var urlErr *url.Error
+	var netErr net.Error
+
+	switch {
+	case errors.Is(err, context.Canceled):
+		return exitInterrupted
+	case errors.As(err, &authErr), llm.IsUnauthorized(err),
+		errors.Is(err, copilot.ErrNotSignedIn), errors.Is(err, copilot.ErrTokenRejected):
+		return exitAuth
+	case llm.IsRateLimited(err):
+		return exitRateLimited
+	case errors.As(err, &refusal), errors.Is(err, errEmptyAnswer), errors.Is(err, errNoCode):
+		return exitNoAnswer
+	case errors.Is(err, llm.ErrStreamInterrupted), errors.Is(err, context.DeadlineExceeded),
+		errors.As(err, &urlErr), errors.As(err, &netErr):
+		return exitNetwork
+	default:
+		return exitError
+	}
+}
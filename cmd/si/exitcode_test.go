@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"testing"
+
+	"github.com/Turee/si/pkg/copilot"
+	"github.com/Turee/si/pkg/llm"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestExitCode tests the exit codes of the failure classes
+func TestExitCode(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{"Other error", errors.New("something failed"), exitError},
+		{"Server error", &llm.APIError{StatusCode: http.StatusInternalServerError}, exitError},
+		{"Canceled", fmt.Errorf("error asking question: %w", context.Canceled), exitInterrupted},
+		{"Canceled retry", fmt.Errorf("%w (retry canceled: %w)", &llm.APIError{StatusCode: http.StatusTooManyRequests}, context.Canceled), exitInterrupted},
+		{"API key command", &authError{errors.New("llm.openai.api_key_cmd failed")}, exitAuth},
+		{"Unauthorized", fmt.Errorf("error asking question: %w", &llm.APIError{StatusCode: http.StatusUnauthorized}), exitAuth},
+		{"Forbidden", &llm.APIError{StatusCode: http.StatusForbidden}, exitAuth},
+		{"Copilot sign-in", copilot.ErrNotSignedIn, exitAuth},
+		{"Copilot token", fmt.Errorf("%w, run si copilot login again", copilot.ErrTokenRejected), exitAuth},
+		{"Rate limited", fmt.Errorf("%w (gave up after 3 attempts)", &llm.APIError{StatusCode: http.StatusTooManyRequests}), exitRateLimited},
+		{"Rate limited in stream", &llm.StreamError{Type: "rate_limit_error"}, exitRateLimited},
+		{"Refusal", &llm.RefusalError{Refusal: "I can't help with that."}, exitNoAnswer},
+		{"Empty answer", errEmptyAnswer, exitNoAnswer},
+		{"Connection refused", fmt.Errorf("failed to send request: %w", &net.OpError{Op: "dial", Err: errors.New("connection refused")}), exitNetwork},
+		{"Interrupted stream", fmt.Errorf("%w: error reading response: unexpected EOF", llm.ErrStreamInterrupted), exitNetwork},
+		{"Timeout", fmt.Errorf("error asking question: %w", context.DeadlineExceeded), exitNetwork},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, exitCode(tt.err))
+		})
+	}
+}
+
+// TestEmptyAnswer tests that an empty answer is reported as a failure
+func TestEmptyAnswer(t *testing.T) {
+	mockCommandEnvironment(t, " \n", false, "")
+	mockUsagePath(t)
+
+	_, stderr := runMainOutput(t, "--no-stream", "capital", "of", "France?")
+	assert.Contains(t, stderr, "Error: the model returned an empty answer")
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/Turee/si/pkg/config"
+	"github.com/alecthomas/kong"
+)
+
+// ExplainConfigCmd prints the effective configuration with the source of every value
+type ExplainConfigCmd struct {
+	ShowSecrets bool `name:"show-secrets" help:"Show secret values such as API keys in clear text"`
+}
+
+// Run prints the merged configuration annotated with the source of each value
+func (c *ExplainConfigCmd) Run(kongCtx *kong.Context) error {
+	configPath := configFilePath()
+
+	layers := []config.Layer{{Name: "default", Config: config.Defaults()}}
+
+	var profile, provider string
+	fileConfig, err := loadConfigFunc(configPath)
+	switch {
+	case err == nil:
+		layers = append(layers, config.Layer{Name: "file " + configPath, Config: fileConfig})
+		layers = append(layers, fileConfig.ProjectLayers()...)
+		layers = append(layers, fileConfig.EnvLayers()...)
+		if profile = selectedProfile(fileConfig); profile != "" {
+			layer, err := fileConfig.ProfileLayer(profile)
+			if err != nil {
+				return err
+			}
+			layers = append(layers, layer)
+		}
+		// The profile may select the provider
+		provider = selectedProvider(fileConfig)
+		if name := fileConfig.Profiles[profile].LLM.Provider; CLI.Provider == "" && name != "" {
+			provider = name
+		}
+		if provider != "" {
+			layer, err := fileConfig.ProviderLayer(provider)
+			if err != nil {
+				return err
+			}
+			layers = append(layers, layer)
+		}
+		fmt.Printf("Config file: %s\n\n", configPath)
+		reportConfigLoad(fileConfig)
+	case errors.Is(err, fs.ErrNotExist):
+		fmt.Printf("Config file: %s (not found)\n\n", configPath)
+	default:
+		return fmt.Errorf("error loading configuration: %w", err)
+	}
+
+	layers = append(layers, overrideLayers(kongCtx)...)
+	settings := config.Explain(layers...)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "KEY\tVALUE\tSOURCE")
+	for _, s := range settings {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", s.Key, c.formatValue(s), s.Source)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	// Report problems with the effective configuration
+	effective := &config.Config{}
+	for _, layer := range layers[1:] {
+		if profile != "" && layer.Name == "profile "+profile {
+			// Applied like when si runs, so the profile's key replaces the
+			// key of the file
+			if err := effective.ApplyProfile(profile); err != nil {
+				return err
+			}
+			continue
+		}
+		if provider != "" && layer.Name == "provider "+provider {
+			// Replaces the endpoint and the key like when si runs
+			if err := effective.ApplyProvider(provider); err != nil {
+				return err
+			}
+			continue
+		}
+		effective.Merge(layer.Config)
+	}
+	if err := effective.Validate(); err != nil {
+		fmt.Fprintf(os.Stderr, "\nInvalid configuration: %v\n", err)
+	}
+
+	return nil
+}
+
+// formatValue formats a setting for display, masking secrets
+func (c *ExplainConfigCmd) formatValue(s config.Setting) string {
+	if s.Value == "" {
+		return "-"
+	}
+	if s.Secret && !c.ShowSecrets {
+		return config.MaskSecret(s.Value)
+	}
+	if strings.ContainsAny(s.Value, "\n\t\"") {
+		return strconv.Quote(s.Value)
+	}
+	return s.Value
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// runMain runs main with the given arguments and returns everything written to stdout
+func runMain(t *testing.T, args ...string) string {
+	t.Helper()
+
+	stdout, _ := runMainOutput(t, args...)
+	return stdout
+}
+
+// runMainOutput runs main with the given arguments and returns what was
+// written to stdout and stderr
+func runMainOutput(t *testing.T, args ...string) (string, string) {
+	t.Helper()
+
+	// Save original os.Args and restore after test
+	oldArgs := os.Args
+	defer func() { os.Args = oldArgs }()
+	os.Args = append([]string{"si"}, args...)
+
+	// Capture stdout and stderr
+	oldStdout, oldStderr := os.Stdout, os.Stderr
+	rOut, wOut, _ := os.Pipe()
+	rErr, wErr, _ := os.Pipe()
+	os.Stdout, os.Stderr = wOut, wErr
+	defer func() { os.Stdout, os.Stderr = oldStdout, oldStderr }()
+
+	// Read stderr concurrently, interactive prompts can fill the pipe
+	var stderr bytes.Buffer
+	done := make(chan struct{})
+	go func() {
+		stderr.ReadFrom(rErr)
+		close(done)
+	}()
+
+	// Turn os.Exit into a panic so main stops executing
+	oldOsExit := osExit
+	defer func() { osExit = oldOsExit }()
+	osExit = func(code int) {
+		panic("os.Exit called")
+	}
+
+	func() {
+		defer func() {
+			recover() // Recover from the panic caused by our mock osExit
+		}()
+		main()
+	}()
+
+	wOut.Close()
+	wErr.Close()
+	var stdout bytes.Buffer
+	_, err := stdout.ReadFrom(rOut)
+	require.NoError(t, err)
+	<-done
+	return stdout.String(), stderr.String()
+}
+
+// TestExplainConfig tests that explain-config shows merged values with their sources
+func TestExplainConfig(t *testing.T) {
+	tempDir := t.TempDir()
+	configPath := filepath.Join(tempDir, "si.yaml")
+	err := os.WriteFile(configPath, []byte(`llm:
+  openai:
+    api_key: sk-test-1234567890
+    model_name: gpt-4o
+`), 0644)
+	require.NoError(t, err)
+
+	defer func() { CLI.Model = "" }()
+
+	output := runMain(t, "--config", configPath, "explain-config")
+	assert.Contains(t, output, "Config file: "+configPath)
+	assert.Regexp(t, `llm\.openai\.base_url\s+https://api\.openai\.com/v1\s+default`, output)
+	assert.Regexp(t, `llm\.openai\.model_name\s+gpt-4o\s+file `, output)
+	assert.Regexp(t, `llm\.openai\.api_key\s+sk-\*\*\*\*7890\s+file `, output)
+	assert.NotContains(t, output, "sk-test-1234567890")
+
+	output = runMain(t, "--config", configPath, "--model", "gpt-4o-mini", "explain-config", "--show-secrets")
+	assert.Regexp(t, `llm\.openai\.model_name\s+gpt-4o-mini\s+flag --model`, output)
+	assert.Contains(t, output, "sk-test-1234567890")
+}
+
+// TestExplainConfigMissingFile tests explain-config without a config file
+func TestExplainConfigMissingFile(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "missing.yaml")
+
+	output, stderr := runMainOutput(t, "--config", configPath, "explain-config")
+	assert.Contains(t, output, "(not found)")
+	assert.Regexp(t, `llm\.openai\.model_name\s+gpt-4\s+default`, output)
+	assert.Contains(t, stderr, "Invalid configuration: OpenAI API key is required")
+}
+
+// TestExplainConfigEnv tests that values from the environment are attributed
+// to their variables and unset references are reported
+func TestExplainConfigEnv(t *testing.T) {
+	t.Setenv("OPENAI_API_KEY", "sk-env-1234567890")
+	configPath := filepath.Join(t.TempDir(), "si.yaml")
+	require.NoError(t, os.WriteFile(configPath, []byte(`llm:
+  openai:
+    model_name: ${SI_TEST_UNSET_MODEL}
+`), 0644))
+
+	output, stderr := runMainOutput(t, "--config", configPath, "explain-config")
+	assert.Regexp(t, `llm\.openai\.api_key\s+sk-\*\*\*\*7890\s+env OPENAI_API_KEY`, output)
+	assert.Contains(t, stderr, "Warning: the config file refers to unset environment variables: SI_TEST_UNSET_MODEL")
+	assert.NotContains(t, stderr, "Invalid configuration")
+}
+
+// TestExplainConfigProfile tests that the settings of the selected profile
+// are attributed to it
+func TestExplainConfigProfile(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "si.yaml")
+	require.NoError(t, os.WriteFile(configPath, []byte(`llm:
+  openai:
+    api_key: sk-personal-1234
+    model_name: gpt-4o
+profiles:
+  work:
+    llm:
+      openai:
+        api_key_cmd: pass show work/openai
+        model_name: gpt-4.1
+`), 0644))
+	defer func() { CLI.Profile = "" }()
+
+	output, stderr := runMainOutput(t, "--config", configPath, "--profile", "work", "explain-config")
+	assert.Regexp(t, `llm\.openai\.model_name\s+gpt-4\.1\s+profile work`, output)
+	assert.Regexp(t, `llm\.openai\.api_key_cmd\s+pass show work/openai\s+profile work`, output)
+	assert.NotContains(t, output, "profiles.")
+	assert.NotContains(t, stderr, "Invalid configuration")
+
+	_, stderr = runMainOutput(t, "--config", configPath, "--profile", "azure", "explain-config")
+	assert.Contains(t, stderr, `unknown profile "azure" (available: work)`)
+}
+
+// TestExplainConfigProvider tests that the settings of the selected provider
+// are attributed to it
+func TestExplainConfigProvider(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "si.yaml")
+	require.NoError(t, os.WriteFile(configPath, []byte(`llm:
+  openai:
+    api_key: sk-openai-1234
+    model_name: gpt-4o
+  provider: groq
+  providers:
+    groq:
+      base_url: https://api.groq.com/openai/v1
+      api_key: gsk-test-5678
+      model_name: llama-3.3-70b-versatile
+`), 0644))
+
+	output, stderr := runMainOutput(t, "--config", configPath, "explain-config")
+	assert.Regexp(t, `llm\.openai\.model_name\s+llama-3\.3-70b-versatile\s+provider groq`, output)
+	assert.Regexp(t, `llm\.openai\.api_key\s+gsk\*\*\*\*5678\s+provider groq`, output)
+	assert.Regexp(t, `llm\.provider\s+groq\s+file `, output)
+	assert.NotContains(t, output, "llm.providers.")
+	assert.NotContains(t, stderr, "Invalid configuration")
+}
+
+// TestExplainConfigProject tests that the settings of a project config file
+// are attributed to it
+func TestExplainConfigProject(t *testing.T) {
+	projectDir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(projectDir, ".si.yaml"), []byte("llm:\n  openai:\n    model_name: gpt-4.1\n"), 0644))
+	oldDir, err := os.Getwd()
+	require.NoError(t, err)
+	require.NoError(t, os.Chdir(projectDir))
+	defer os.Chdir(oldDir)
+
+	configPath := filepath.Join(t.TempDir(), "si.yaml")
+	require.NoError(t, os.WriteFile(configPath, []byte("llm:\n  openai:\n    api_key: sk-test-1234567890\n    model_name: gpt-4o\n"), 0644))
+
+	output := runMain(t, "--config", configPath, "explain-config")
+	assert.Regexp(t, `llm\.openai\.model_name\s+gpt-4\.1\s+project .*\.si\.yaml`, output)
+	assert.Regexp(t, `llm\.openai\.api_key\s+sk-\*\*\*\*7890\s+file `, output)
+}
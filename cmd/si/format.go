@@ -0,0 +1,138 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Turee/si/pkg/config"
+	"github.com/Turee/si/pkg/output"
+)
+
+// templateFormatPrefix starts an inline output template given with --format
+const templateFormatPrefix = "template="
+
+// formatJSONStream is the --format name of the ndjson output mode, for
+// wrappers that select every output shape with --format
+const formatJSONStream = "json-stream"
+
+// Structured --output modes
+const (
+	// outputJSON prints the answer as a single JSON object
+	outputJSON = "json"
+
+	// outputNDJSON streams the answer as newline-delimited JSON events
+	outputNDJSON = "ndjson"
+)
+
+// outputFormat returns the output template selected with --format, or nil
+// for plain text. The format is either an inline template or the name of a
+// template from the formats section of the config.
+func outputFormat(cfg *config.Config) (*output.Template, error) {
+	format := CLI.Format
+	switch {
+	case CLI.Code.Enabled && (format != "" && format != "text" || CLI.Output != "" && CLI.Output != "text"):
+		return nil, fmt.Errorf("--code can't be combined with --format or --output")
+	case format == "" || format == "text":
+		return nil, nil
+	case CLI.Output != "" && CLI.Output != "text":
+		return nil, fmt.Errorf("--format can't be combined with --output %s", CLI.Output)
+	case format == formatJSONStream:
+		return nil, nil
+	case strings.HasPrefix(format, templateFormatPrefix):
+		return output.ParseTemplate("template", strings.TrimPrefix(format, templateFormatPrefix))
+	}
+
+	text, ok := cfg.Formats[format]
+	if !ok {
+		names := []string{"text", formatJSONStream, templateFormatPrefix + "..."}
+		for name := range cfg.Formats {
+			names = append(names, name)
+		}
+		sort.Strings(names[3:])
+		return nil, fmt.Errorf("unknown format %q (available: %s)", format, strings.Join(names, ", "))
+	}
+	return output.ParseTemplate(format, text)
+}
+
+// newConversationID returns a random identifier for the answers of this
+// invocation, so scripts can tell them apart in logs
+func newConversationID() string {
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(id)
+}
+
+// answerPrinter prints answers with their metadata, for output templates and
+// the structured output modes
+type answerPrinter struct {
+	// stream writes a streamed chunk of the answer; without it the printer
+	// needs the complete answer, which disables streaming
+	stream func(chunk string) error
+
+	// print prints the complete answer
+	print func(answer string) error
+}
+
+// newAnswerPrinter returns the printer for --code, the output template or the
+// --output mode, or nil to print the answer as plain text. The usage, the
+// cache match and the sources are read when the answer is printed.
+func newAnswerPrinter(cfg *config.Config, format *output.Template, question string, usage *usageTracker, cacheMatch *string, sources *sourceList) *answerPrinter {
+	// Code blocks can only be told apart in the complete answer
+	if CLI.Code.Enabled {
+		return &answerPrinter{print: printCode}
+	}
+
+	mode := CLI.Output
+	if CLI.Format == formatJSONStream {
+		mode = outputNDJSON
+	}
+	if format == nil && mode != outputJSON && mode != outputNDJSON {
+		return nil
+	}
+
+	start := time.Now()
+	conversationID := newConversationID()
+	response := func(answer string) output.Response {
+		return output.Response{
+			ConversationID: conversationID,
+			ID:             usage.metadata.ID,
+			Model:          modelName(cfg),
+			Provider:       usage.metadata.Provider,
+			Prompt:         question,
+			Content:        answer,
+			FinishReason:   usage.metadata.FinishReason,
+			Usage:          usage.usage,
+			Duration:       time.Since(start),
+			Cached:         *cacheMatch,
+			Sources:        sources.sources,
+
+			TimeToFirstToken: usage.metadata.TimeToFirstToken,
+			TokensPerSecond:  usage.tokensPerSecond(),
+		}
+	}
+
+	switch {
+	case format != nil:
+		return &answerPrinter{print: func(answer string) error {
+			return format.Execute(answerOutput(), response(answer))
+		}}
+	case mode == outputNDJSON:
+		events := output.NewEventWriter(answerOutput())
+		return &answerPrinter{
+			stream: events.WriteDelta,
+			print: func(answer string) error {
+				return events.WriteDone(response(answer))
+			},
+		}
+	default:
+		return &answerPrinter{print: func(answer string) error {
+			return output.WriteJSON(answerOutput(), response(answer))
+		}}
+	}
+}
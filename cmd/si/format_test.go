@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/Turee/si/pkg/config"
+	"github.com/Turee/si/pkg/llm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestOutputFormat tests selecting inline and named output templates
+func TestOutputFormat(t *testing.T) {
+	defer func() { CLI.Format = "" }()
+	cfg := &config.Config{Formats: map[string]string{"short": "{{.Content | trunc 10}}"}}
+
+	for _, format := range []string{"", "text"} {
+		CLI.Format = format
+		tmpl, err := outputFormat(cfg)
+		require.NoError(t, err)
+		assert.Nil(t, tmpl)
+	}
+
+	CLI.Format = "template={{.Model}}"
+	tmpl, err := outputFormat(cfg)
+	require.NoError(t, err)
+	assert.NotNil(t, tmpl)
+
+	CLI.Format = "short"
+	tmpl, err = outputFormat(cfg)
+	require.NoError(t, err)
+	assert.NotNil(t, tmpl)
+
+	CLI.Format = "long"
+	_, err = outputFormat(cfg)
+	assert.ErrorContains(t, err, `unknown format "long" (available: text, json-stream, template=..., short)`)
+
+	CLI.Format = "template={{.Model"
+	_, err = outputFormat(cfg)
+	assert.ErrorContains(t, err, "failed to parse output template")
+}
+
+// TestFormatFlag tests rendering the answer with an output template
+func TestFormatFlag(t *testing.T) {
+	mockCommandEnvironment(t, "", false, "")
+	mockUsagePath(t)
+	loadConfigFunc = func(path string) (*config.Config, error) {
+		return &config.Config{LLM: config.LLMConfig{OpenAI: config.OpenAIConfig{APIKey: "test-api-key", ModelName: "gpt-4o"}}}, nil
+	}
+	llm.NewProvider = func(cfg *config.Config) (llm.Provider, error) {
+		return &usageProvider{
+			MockProvider: &MockProvider{AskResponse: "The capital of France is Paris."},
+			usage:        llm.Usage{PromptTokens: 10, CompletionTokens: 7, TotalTokens: 17},
+		}, nil
+	}
+
+	output := runMain(t, "--format", "template={{.Model}}: {{.Content | trunc 14}} ({{.Usage.TotalTokens}} tokens)", "capital", "of", "France?")
+	assert.Equal(t, "gpt-4o: The capital of (17 tokens)\n", output)
+}
+
+// metadataProvider is a usageProvider that also reports response metadata
+type metadataProvider struct {
+	*usageProvider
+	metadata llm.Metadata
+	callback func(llm.Metadata)
+}
+
+func (p *metadataProvider) SetMetadataCallback(callback func(llm.Metadata)) {
+	p.callback = callback
+}
+
+func (p *metadataProvider) Chat(ctx context.Context, messages []llm.Message) (string, error) {
+	answer, err := p.usageProvider.Chat(ctx, messages)
+	if p.callback != nil {
+		p.callback(p.metadata)
+	}
+	return answer, err
+}
+
+func (p *metadataProvider) ChatStream(ctx context.Context, messages []llm.Message, callback func(chunk string) error) error {
+	err := p.usageProvider.ChatStream(ctx, messages, callback)
+	if p.callback != nil {
+		p.callback(p.metadata)
+	}
+	return err
+}
+
+// mockMetadataEnvironment sets up a provider that reports usage and metadata
+func mockMetadataEnvironment(t *testing.T, provider *MockProvider) {
+	mockCommandEnvironment(t, "", false, "")
+	mockUsagePath(t)
+	t.Cleanup(func() { CLI.Output, CLI.Format, CLI.NoStream = "text", "", false })
+	loadConfigFunc = func(path string) (*config.Config, error) {
+		return &config.Config{LLM: config.LLMConfig{OpenAI: config.OpenAIConfig{APIKey: "test-api-key", ModelName: "gpt-4o"}}}, nil
+	}
+	llm.NewProvider = func(cfg *config.Config) (llm.Provider, error) {
+		return &metadataProvider{
+			usageProvider: &usageProvider{
+				MockProvider: provider,
+				usage:        llm.Usage{PromptTokens: 10, CompletionTokens: 1, TotalTokens: 11},
+			},
+			metadata: llm.Metadata{ID: "chatcmpl-1", Model: "gpt-4o-2024-08-06", FinishReason: "stop"},
+		}, nil
+	}
+}
+
+// TestOutputJSON tests printing the answer as a JSON object
+func TestOutputJSON(t *testing.T) {
+	mockMetadataEnvironment(t, &MockProvider{AskResponse: "Paris"})
+
+	out := runMain(t, "--output", "json", "capital", "of", "France?")
+	var response map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(out), &response))
+	assert.Equal(t, "Paris", response["answer"])
+	assert.Equal(t, "gpt-4o", response["model"])
+	assert.Equal(t, "chatcmpl-1", response["id"])
+	assert.Equal(t, "stop", response["finish_reason"])
+	assert.Equal(t, map[string]interface{}{"prompt_tokens": 10.0, "completion_tokens": 1.0, "total_tokens": 11.0}, response["usage"])
+	assert.Len(t, response["conversation_id"], 16)
+	assert.Contains(t, response, "latency_ms")
+	assert.Contains(t, response, "total_duration_ms")
+
+	// Output templates are an alternative to JSON output
+	_, stderr := runMainOutput(t, "--output", "json", "--format", "template={{.Content}}", "capital", "of", "France?")
+	assert.Contains(t, stderr, "--format can't be combined with --output json")
+}
+
+// TestOutputNDJSON tests streaming the answer as JSON events
+func TestOutputNDJSON(t *testing.T) {
+	mockMetadataEnvironment(t, &MockProvider{AskResponse: "Paris", AskStreamChunks: []string{"Par", "is"}})
+
+	out := runMain(t, "--output", "ndjson", "capital", "of", "France?")
+	lines := strings.Split(strings.TrimSuffix(out, "\n"), "\n")
+	require.Len(t, lines, 3)
+	assert.Equal(t, `{"type":"delta","content":"Par"}`, lines[0])
+	assert.Equal(t, `{"type":"delta","content":"is"}`, lines[1])
+
+	var done map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(lines[2]), &done))
+	assert.Equal(t, "done", done["type"])
+	assert.Equal(t, "stop", done["finish_reason"])
+	assert.Equal(t, 11.0, done["usage"].(map[string]interface{})["total_tokens"])
+
+	// --format json-stream is the same event stream
+	stream := runMain(t, "--format", "json-stream", "capital", "of", "France?")
+	assert.True(t, strings.HasPrefix(stream, lines[0]+"\n"+lines[1]+"\n"+`{"type":"done",`), stream)
+
+	// Answers that aren't streamed arrive in a single delta
+	out = runMain(t, "--output", "ndjson", "--no-stream", "capital", "of", "France?")
+	assert.True(t, strings.HasPrefix(out, `{"type":"delta","content":"Paris"}`+"\n"+`{"type":"done",`), out)
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/Turee/si/pkg/config"
+	"github.com/Turee/si/pkg/redact"
+	"github.com/Turee/si/pkg/script"
+)
+
+// runHookCommand runs a hook command with the user's shell, passing the text
+// on stdin, and returns what it printed. The command's stderr goes to
+// stderr. It can be replaced in tests.
+var runHookCommand = func(command, text string, env []string) (string, error) {
+	shell := userShell()
+	cmd := exec.Command(shell[0], append(shell[1:], command)...)
+	cmd.Stdin = strings.NewReader(text)
+	cmd.Stderr = os.Stderr
+	cmd.Env = append(os.Environ(), env...)
+
+	var stdout bytes.Buffer
+	cmd.Stdout = &stdout
+	err := cmd.Run()
+	return stdout.String(), err
+}
+
+// runHook runs the hook command of the stage with the text. The text is
+// replaced by the output without its trailing newlines, or kept when the
+// command prints nothing. A failing command rejects the text.
+func runHook(cfg *config.Config, stage, command, text string) (string, error) {
+	if command == "" {
+		return text, nil
+	}
+
+	env := []string{"SI_HOOK=" + stage, "SI_MODEL=" + modelName(cfg)}
+	output, err := runHookCommand(command, text, env)
+	if err != nil {
+		return "", fmt.Errorf("hooks.%s rejected the %s: %w", stage, hookSubject(stage), err)
+	}
+	if output = strings.TrimRight(output, "\r\n"); output == "" {
+		return text, nil
+	}
+	return output, nil
+}
+
+// hookSubject names the text the hook of the stage gets
+func hookSubject(stage string) string {
+	if stage == "pre_request" {
+		return "question"
+	}
+	return "answer"
+}
+
+// responseHooks change the complete answer before it is printed: first the
+// on_response function of the hook script, then the post_response command.
+// Secrets and personal data replaced in the prompt are restored last, so the
+// hooks only see their placeholders.
+type responseHooks struct {
+	cfg      *config.Config
+	script   *script.Hook
+	redactor *redact.Redactor
+	scrubber *redact.Redactor
+}
+
+// HasResponseHook reports whether the answer is changed, which requires the
+// complete answer and so disables streaming
+func (h responseHooks) HasResponseHook() bool {
+	return h.script.HasResponseHook() || h.cfg.Hooks.PostResponse != "" || h.restoresSecrets() || h.scrubber.Count() > 0
+}
+
+// restoresSecrets reports whether secrets are put back into the answer
+func (h responseHooks) restoresSecrets() bool {
+	return h.cfg.Redact.Restore && h.redactor.Count() > 0
+}
+
+// OnResponse passes the answer through the hooks
+func (h responseHooks) OnResponse(answer string) (string, error) {
+	answer, err := h.script.OnResponse(answer)
+	if err != nil {
+		return "", err
+	}
+	if answer, err = runHook(h.cfg, "post_response", h.cfg.Hooks.PostResponse, answer); err != nil {
+		return "", err
+	}
+	if h.restoresSecrets() {
+		answer = h.redactor.Restore(answer)
+	}
+	return h.scrubber.Restore(answer), nil
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Turee/si/pkg/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// mockHooks makes the config use the hook commands
+func mockHooks(t *testing.T, hooks config.HooksConfig) {
+	t.Helper()
+	t.Setenv("SHELL", "/bin/sh")
+
+	loadConfigFunc = func(path string) (*config.Config, error) {
+		return &config.Config{
+			LLM:   config.LLMConfig{OpenAI: config.OpenAIConfig{APIKey: "test-api-key", ModelName: "gpt-4o"}},
+			Hooks: hooks,
+		}, nil
+	}
+}
+
+// TestPreRequestHook tests changing and rejecting the question
+func TestPreRequestHook(t *testing.T) {
+	provider := mockCommandEnvironment(t, "Paris", false, "")
+	mockUsagePath(t)
+
+	mockHooks(t, config.HooksConfig{PreRequest: `tr a-z A-Z; echo " ($SI_HOOK, $SI_MODEL)"`})
+	output, _ := runMainOutput(t, "capital", "of", "France?")
+	assert.Equal(t, "Paris\n", output)
+	assert.Equal(t, "CAPITAL OF FRANCE? (pre_request, gpt-4o)", provider.QuestionAsked)
+
+	// A hook printing nothing leaves the question as it is
+	log := filepath.Join(t.TempDir(), "questions.log")
+	t.Setenv("SI_TEST_LOG", log)
+	mockHooks(t, config.HooksConfig{PreRequest: `cat >> "$SI_TEST_LOG"`})
+	runMainOutput(t, "capital", "of", "Spain?")
+	assert.Equal(t, "capital of Spain?", provider.QuestionAsked)
+	logged, err := os.ReadFile(log)
+	require.NoError(t, err)
+	assert.Equal(t, "capital of Spain?", string(logged))
+
+	provider.QuestionAsked = ""
+	mockHooks(t, config.HooksConfig{PreRequest: `echo "contains a secret" >&2; exit 3`})
+	output, stderr := runMainOutput(t, "my", "password", "is", "hunter2")
+	assert.Empty(t, output)
+	assert.Contains(t, stderr, "contains a secret")
+	assert.Contains(t, stderr, "Error: hooks.pre_request rejected the question: exit status 3")
+	assert.Empty(t, provider.QuestionAsked)
+}
+
+// TestPostResponseHook tests changing and rejecting the answer
+func TestPostResponseHook(t *testing.T) {
+	provider := mockCommandEnvironment(t, "The capital is Paris.", false, "")
+	provider.AskStreamChunks = []string{"The capital ", "is Paris."}
+	mockUsagePath(t)
+
+	mockHooks(t, config.HooksConfig{PostResponse: `sed "s/Paris/[$SI_HOOK]/"`})
+	output, _ := runMainOutput(t, "capital", "of", "France?")
+	assert.Equal(t, "The capital is [post_response].\n", output)
+
+	mockHooks(t, config.HooksConfig{PostResponse: `grep -q Paris && exit 1; cat`})
+	output, stderr := runMainOutput(t, "capital", "of", "France?")
+	assert.Empty(t, output)
+	assert.Contains(t, stderr, "Error: hooks.post_response rejected the answer: exit status 1")
+}
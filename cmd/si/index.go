@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Turee/si/pkg/config"
+	"github.com/Turee/si/pkg/output"
+	"github.com/Turee/si/pkg/rag"
+	"github.com/Turee/si/pkg/redact"
+	"github.com/Turee/si/pkg/state"
+	"github.com/alecthomas/kong"
+)
+
+// indexDir returns the directory the indexes are stored in
+var indexDir = rag.DefaultDir
+
+// IndexCmd indexes the files of a directory for --rag
+type IndexCmd struct {
+	Dir string `arg:"" optional:"" default:"." type:"existingdir" help:"Directory to index (default: the current directory)"`
+}
+
+// Run chunks and embeds the files of the directory that are new or changed
+// since it was last indexed, skipping what .gitignore files and --exclude
+// ignore. With --include only the matching files are indexed.
+func (c *IndexCmd) Run(kongCtx *kong.Context) error {
+	cfg := loadConfiguration(kongCtx)
+	if cfg == nil {
+		return nil
+	}
+	ix, err := rag.Open(indexDir(), c.Dir)
+	if err != nil {
+		return err
+	}
+	if err := state.Writable(); err != nil {
+		return fmt.Errorf("can't index %s: %w", ix.Root, err)
+	}
+	embedder, err := newEmbedder(cfg)
+	if err != nil {
+		return err
+	}
+	redactor, err := newRedactor(cfg)
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := notifyInterrupt(context.Background())
+	defer stop()
+
+	model := embedModel(cfg)
+	batch := cfg.Embed.Batch()
+	stats, err := ix.Update(ctx, rag.Options{
+		Model:       model,
+		Include:     CLI.Include,
+		Exclude:     CLI.Exclude,
+		ChunkTokens: cfg.RAG.ChunkTokens,
+		BatchSize:   batch,
+		Embed: func(ctx context.Context, texts []string) ([][]float32, error) {
+			redacted := make([]string, len(texts))
+			for i, text := range texts {
+				redacted[i] = redactor.Redact(text)
+			}
+			embeddings, err := embedder.Embed(ctx, model, redacted)
+			if err != nil {
+				return nil, fmt.Errorf("error computing embeddings with %s: %w", model, err)
+			}
+			return embeddings, nil
+		},
+		Progress: func(done, total int) {
+			if total > batch {
+				fmt.Fprintf(os.Stderr, "Embedding chunks %d to %d of %d...\n", done+1, min(done+batch, total), total)
+			}
+		},
+	})
+	if err != nil {
+		return err
+	}
+	if err := ix.Save(); err != nil {
+		return err
+	}
+	warnRedacted(redactor)
+
+	fmt.Fprintf(os.Stderr, "Indexed %s with %s: %d chunks of %d files (%d new or changed, %d removed, %d binary or too large)\n",
+		ix.Root, model, stats.Chunks, stats.Indexed+stats.Unchanged, stats.Indexed, stats.Removed, stats.Skipped)
+	return nil
+}
+
+// attachChunks appends the chunks of the index of the current directory most
+// relevant to the query to the question for --rag, numbered like the
+// footnotes citing them. The index is searched with the embedding model it
+// was built with.
+func attachChunks(ctx context.Context, cfg *config.Config, query, question string, redactor *redact.Redactor, sources *sourceList) (string, error) {
+	if !CLI.RAG {
+		return question, nil
+	}
+
+	ix, err := rag.Find(indexDir(), ".")
+	if errors.Is(err, rag.ErrNoIndex) {
+		return "", errors.New("neither this directory nor its parents are indexed, create an index with si index")
+	}
+	if err != nil {
+		return "", err
+	}
+
+	embedder, err := newEmbedder(cfg)
+	if err != nil {
+		return "", err
+	}
+	if strings.TrimSpace(query) == "" {
+		query = question
+	}
+	embeddings, err := embedder.Embed(ctx, ix.Model, []string{query})
+	if err != nil {
+		return "", fmt.Errorf("error computing embeddings with %s: %w", ix.Model, err)
+	}
+	if len(embeddings) != 1 {
+		return "", fmt.Errorf("expected an embedding of the question, got %d", len(embeddings))
+	}
+
+	results := ix.Search(embeddings[0], cfg.RAG.Results())
+	if len(results) == 0 {
+		fmt.Fprintf(os.Stderr, "Warning: the index of %s is empty\n", ix.Root)
+		return question, nil
+	}
+
+	parts := []string{fmt.Sprintf("Excerpts of the files in %s, cite them by their numbers:", ix.Root)}
+	if question != "" {
+		parts = append([]string{question}, parts...)
+	}
+	for _, result := range results {
+		source := output.Source{Path: relativePath(filepath.Join(ix.Root, filepath.FromSlash(result.Path))), Line: result.StartLine}
+		sources.add(source)
+		parts = append(parts, frameChunk(sources.number(source), source.Path, result.Chunk, redactor.Redact(result.Text)))
+	}
+	return strings.Join(parts, "\n\n"), nil
+}
+
+// frameChunk frames the text of a chunk with its number and lines
+func frameChunk(number int, path string, chunk rag.Chunk, text string) string {
+	fence := fenceFor(text)
+	return fmt.Sprintf("[%d] %s:%d-%d\n%s\n%s\n%s", number, path, chunk.StartLine, chunk.EndLine,
+		fence, strings.TrimRight(text, "\n"), fence)
+}
+
+// relativePath returns the path relative to the working directory if
+// possible
+func relativePath(path string) string {
+	wd, err := os.Getwd()
+	if err != nil {
+		return path
+	}
+	if rel, err := filepath.Rel(wd, path); err == nil {
+		return rel
+	}
+	return path
+}
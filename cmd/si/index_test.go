@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Turee/si/pkg/config"
+	"github.com/Turee/si/pkg/llm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// topicEmbedder is a mock provider that embeds texts by the topics they
+// mention
+type topicEmbedder struct {
+	*MockProvider
+	model string
+	texts []string
+}
+
+func (p *topicEmbedder) Embed(ctx context.Context, model string, texts []string) ([][]float32, error) {
+	p.model = model
+	p.texts = append(p.texts, texts...)
+	embeddings := make([][]float32, len(texts))
+	for i, text := range texts {
+		embeddings[i] = []float32{0.1, 0, 0}
+		for j, topic := range []string{"login", "database"} {
+			if strings.Contains(text, topic) {
+				embeddings[i][j+1] = 1
+			}
+		}
+	}
+	return embeddings, nil
+}
+
+// mockIndexEnvironment sets up a project as the working directory, an index
+// directory and a provider that answers and computes embeddings
+func mockIndexEnvironment(t *testing.T, answer string) (*topicEmbedder, string) {
+	t.Helper()
+
+	mockCommandEnvironment(t, answer, false, "")
+	mockUsagePath(t)
+	provider := &topicEmbedder{MockProvider: &MockProvider{AskResponse: answer}}
+	llm.NewProvider = func(cfg *config.Config) (llm.Provider, error) {
+		return provider, nil
+	}
+
+	oldIndexDir := indexDir
+	t.Cleanup(func() { indexDir = oldIndexDir })
+	dir := t.TempDir()
+	indexDir = func() string { return dir }
+
+	mockProject(t, map[string]string{
+		".gitignore":   "*.env\n",
+		"auth/auth.go": "package auth\n\n// login checks the password\nfunc login() {}\n",
+		"db/db.go":     "package db\n\n// Open connects to the database with DB_PASSWORD=hunter2hunter2\nfunc Open() {}\n",
+		"secrets.env":  "login=admin\n",
+	})
+	project, err := os.Getwd()
+	require.NoError(t, err)
+	return provider, project
+}
+
+// TestIndexAndRAG tests indexing a directory and answering from its chunks
+func TestIndexAndRAG(t *testing.T) {
+	provider, _ := mockIndexEnvironment(t, "Use login [1].")
+	t.Cleanup(func() { CLI.RAG = false })
+
+	output, stderr := runMainOutput(t, "index")
+	root, err := filepath.Abs(".")
+	require.NoError(t, err)
+	assert.Empty(t, output)
+	assert.Contains(t, stderr, "Indexed "+root+" with "+llm.DefaultEmbeddingModel+": 3 chunks of 3 files (3 new or changed, 0 removed, 0 binary or too large)\n")
+
+	// Secrets are redacted before the chunks are embedded
+	assert.Contains(t, stderr, "replaced 1 secret (secret)")
+	assert.Contains(t, strings.Join(provider.texts, "\n"), "DB_PASSWORD=[REDACTED_SECRET_1]")
+	assert.NotContains(t, strings.Join(provider.texts, "\n"), "hunter2hunter2")
+
+	// Questions from subdirectories use the index of the project
+	require.NoError(t, os.Chdir("db"))
+	loadConfigFunc = func(path string) (*config.Config, error) {
+		return &config.Config{
+			LLM: config.LLMConfig{OpenAI: config.OpenAIConfig{APIKey: "test-api-key"}},
+			RAG: config.RAGConfig{TopK: 1},
+		}, nil
+	}
+	output = runMain(t, "--no-stream", "--rag", "how", "does", "login", "work")
+	assert.Equal(t, "Use login [1].\n\nSources:\n[1] ../auth/auth.go:1\n", output)
+	assert.Equal(t, "how does login work\n\nExcerpts of the files in "+root+", cite them by their numbers:\n\n"+
+		"[1] ../auth/auth.go:1-4\n```\npackage auth\n\n// login checks the password\nfunc login() {}\n```", provider.QuestionAsked)
+	assert.Equal(t, llm.DefaultEmbeddingModel, provider.model)
+}
+
+// TestIndexErrors tests asking without an index and indexing in read-only
+// mode
+func TestIndexErrors(t *testing.T) {
+	_, project := mockIndexEnvironment(t, "Answer")
+	t.Cleanup(func() { CLI.RAG, CLI.NoState = false, false })
+
+	_, stderr := runMainOutput(t, "--rag", "how", "does", "login", "work")
+	assert.Contains(t, stderr, "neither this directory nor its parents are indexed, create an index with si index")
+
+	_, stderr = runMainOutput(t, "--no-state", "index", project)
+	assert.Contains(t, stderr, "can't index "+project+": local state is read-only")
+}
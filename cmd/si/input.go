@@ -0,0 +1,255 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/Turee/si/pkg/config"
+	"github.com/Turee/si/pkg/llm"
+	"github.com/Turee/si/pkg/prompt"
+	"github.com/Turee/si/pkg/redact"
+	"github.com/Turee/si/pkg/tokens"
+)
+
+// maxStdinBytes is the most piped input kept in memory, half of it from the
+// start and half from the end. Configured limits are applied afterwards.
+var maxStdinBytes = 64 << 20
+
+// readStdin reads piped input, keeping the start and the end of input
+// longer than maxStdinBytes with a marker of the omitted bytes in between
+func readStdin(r io.Reader) ([]byte, error) {
+	half := maxStdinBytes / 2
+	head, err := io.ReadAll(io.LimitReader(r, int64(maxStdinBytes)))
+	if err != nil || len(head) < maxStdinBytes {
+		return head, err
+	}
+
+	// Keep reading into a window of the last half of the input, which is
+	// moved to the front of its buffer whenever the buffer is full
+	tail := make([]byte, 0, 2*half)
+	tail = append(tail, head[half:]...)
+	head = head[:half]
+	omitted := 0
+	for {
+		n, err := r.Read(tail[len(tail):cap(tail)])
+		tail = tail[:len(tail)+n]
+		if len(tail) == cap(tail) || errors.Is(err, io.EOF) {
+			drop := max(len(tail)-half, 0)
+			omitted += drop
+			tail = append(tail[:0], tail[drop:]...)
+		}
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if omitted == 0 {
+		return append(head, tail...), nil
+	}
+
+	fmt.Fprintf(os.Stderr, "Warning: the piped input exceeds %d MiB, %d bytes in the middle were dropped\n", maxStdinBytes>>20, omitted)
+	marker := fmt.Sprintf("\n[... %d bytes omitted ...]\n", omitted)
+	return append(append(head, marker...), tail...), nil
+}
+
+// binarySniffLen is how much of the start of piped input is checked for
+// binary data
+const binarySniffLen = 8 << 10
+
+// checkBinary returns piped input as text, refusing binary data unless
+// --base64 asks to send it base64-encoded
+func checkBinary(data []byte) (string, error) {
+	if !isBinary(data) {
+		return string(data), nil
+	}
+	if CLI.Base64 {
+		return base64.StdEncoding.EncodeToString(data), nil
+	}
+
+	kind := http.DetectContentType(data)
+	hint := "pipe text instead, or use --base64 to send it base64-encoded"
+	if strings.HasPrefix(kind, "image/") {
+		hint = "attach images with --image FILE instead, or use --base64 to send it base64-encoded"
+	}
+	if kind == "application/octet-stream" {
+		kind = "binary data"
+	}
+	return "", fmt.Errorf("the piped input looks like %s (%d bytes), not text; %s", kind, len(data), hint)
+}
+
+// isBinary tells if the start of the data holds NUL bytes, invalid UTF-8 or
+// many control characters. NUL bytes separating inputs for --stdin-delimiter
+// are allowed.
+func isBinary(data []byte) bool {
+	sample := data[:min(len(data), binarySniffLen)]
+	if CLI.StdinDelim == `\0` {
+		sample = bytes.ReplaceAll(sample, []byte{0}, []byte{'\n'})
+	}
+
+	suspicious := 0
+scan:
+	for len(sample) > 0 {
+		r, size := utf8.DecodeRune(sample)
+		switch {
+		case r == 0:
+			return true
+		case r == utf8.RuneError && size == 1:
+			// A sequence cut off by the end of the sample is still text
+			if !utf8.FullRune(sample) && len(data) > binarySniffLen {
+				break scan
+			}
+			suspicious++
+		case r < ' ' && !strings.ContainsRune("\t\n\r\f\b\x1b", r), r == 0x7f:
+			suspicious++
+		}
+		sample = sample[size:]
+	}
+	return suspicious*10 > min(len(data), binarySniffLen)
+}
+
+// inputLimit returns the limit of piped input in bytes, or zero without a
+// limit. Token limits are converted with the estimate of four bytes per
+// token.
+func inputLimit(cfg *config.Config) int {
+	maxTokens := cfg.Input.MaxTokens
+	if maxTokens == 0 {
+		maxTokens = contextWindow(cfg) * 3 / 4
+	}
+
+	limit := cfg.Input.MaxBytes
+	if maxTokens > 0 && (limit == 0 || 4*maxTokens < limit) {
+		limit = 4 * maxTokens
+	}
+	return limit
+}
+
+// limitInput truncates piped input exceeding the configured limit with a
+// warning, or summarizes it in chunks with map_reduce. With the summarize
+// strategy the model summarizes the omitted middle. Whatever is sent to be
+// summarized is scrubbed like the prompt.
+func limitInput(cfg *config.Config, question, input string, scrubber *redact.Redactor) (string, error) {
+	limit := inputLimit(cfg)
+	if limit == 0 || len(input) <= limit {
+		return input, nil
+	}
+
+	// Dry runs don't send requests, so they show the truncated input
+	if cfg.Input.MapReduce && !CLI.DryRun {
+		chunkSize := limit
+		if cfg.Input.ChunkTokens > 0 {
+			chunkSize = min(4*cfg.Input.ChunkTokens, limit)
+		}
+		fmt.Fprintf(os.Stderr, "Warning: the piped input has about %d tokens, more than the limit of %d; summarizing it in parts of %d tokens\n",
+			tokens.Estimate(input), limit/4, chunkSize/4)
+		return mapReduce(cfg, question, input, limit, chunkSize, scrubber)
+	}
+
+	strategy := cfg.Input.Strategy()
+	truncated := prompt.Truncate(input, limit, strategy)
+	fmt.Fprintf(os.Stderr, "Warning: the piped input has about %d tokens, more than the limit of %d; keeping the %s (see --max-input and --truncate)\n",
+		tokens.Estimate(input), limit/4, keptPart(strategy))
+
+	var summary string
+	if strategy == prompt.TruncateSummarize && !CLI.DryRun {
+		var err error
+		if summary, err = summarizeOmitted(cfg, scrubber.Redact(truncated.Omitted), limit); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to summarize the omitted input: %v\n", err)
+		}
+	}
+	return truncated.Join(summary), nil
+}
+
+// keptPart describes the part of the input the strategy keeps
+func keptPart(strategy string) string {
+	switch strategy {
+	case prompt.TruncateHead:
+		return "start"
+	case prompt.TruncateTail:
+		return "end"
+	case prompt.TruncateSummarize:
+		return "start and end and summarizing the middle"
+	default:
+		return "start and end"
+	}
+}
+
+// askAside sends requests of their own to the model before the question is
+// asked, tracking their usage
+func askAside(cfg *config.Config, ask func(ctx context.Context, provider llm.Provider) error) error {
+	provider, err := llm.NewProvider(cfg)
+	if err != nil {
+		return fmt.Errorf("error creating LLM provider: %w", err)
+	}
+	var usage usageTracker
+	usage.track(provider)
+	defer usage.save(modelName(cfg))
+
+	ctx, stop := notifyInterrupt(context.Background())
+	defer stop()
+	return ask(ctx, provider)
+}
+
+// summarizeOmitted asks the model to summarize the omitted part of the
+// input, itself cut to the limit
+func summarizeOmitted(cfg *config.Config, omitted string, limit int) (string, error) {
+	excerpt := prompt.Truncate(omitted, limit, prompt.TruncateHeadTail).Join("")
+	var summary string
+	err := askAside(cfg, func(ctx context.Context, provider llm.Provider) error {
+		var err error
+		summary, err = provider.Ask(ctx, "Summarize this excerpt from the middle of a longer input in a few sentences. "+
+			"Keep names, numbers, errors and anything else a reader of the rest of the input may need:\n\n"+excerpt)
+		return err
+	})
+	return summary, err
+}
+
+// mapReduce asks the model to summarize each chunk of the input with regard
+// to the question, and returns the summaries for the question to be answered
+// from. Summaries that are together still longer than the limit are
+// summarized again the same way.
+func mapReduce(cfg *config.Config, question, input string, limit, chunkSize int, scrubber *redact.Redactor) (string, error) {
+	err := askAside(cfg, func(ctx context.Context, provider llm.Provider) error {
+		for len(input) > limit {
+			chunks := prompt.Chunk(input, chunkSize)
+			summaries := make([]string, len(chunks))
+			for i, chunk := range chunks {
+				fmt.Fprintf(os.Stderr, "Summarizing part %d of %d...\n", i+1, len(chunks))
+				summary, err := provider.Ask(ctx, chunkPrompt(question, i+1, len(chunks), scrubber.Redact(chunk)))
+				if err != nil {
+					return fmt.Errorf("error summarizing part %d of the input: %w", i+1, err)
+				}
+				summaries[i] = fmt.Sprintf("Summary of part %d of %d:\n%s", i+1, len(chunks), strings.TrimSpace(summary))
+			}
+
+			reduced := strings.Join(summaries, "\n\n")
+			if len(reduced) >= len(input) {
+				return errors.New("the summaries of the input are no shorter than the input, try larger --max-input or input.chunk_tokens")
+			}
+			input = reduced
+		}
+		return nil
+	})
+	return input, err
+}
+
+// chunkPrompt asks to summarize a chunk of the input with regard to the
+// question
+func chunkPrompt(question string, part, parts int, chunk string) string {
+	focus := "Keep names, numbers, errors and anything else a reader may need."
+	if question = strings.TrimSpace(question); question != "" {
+		focus = "Keep everything relevant to this question, including names, numbers and errors, " +
+			"but don't answer it yet:\n" + question
+	}
+	return fmt.Sprintf("This is part %d of %d of a longer input. Summarize it. %s\n\nPart %d:\n%s",
+		part, parts, focus, part, chunk)
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/Turee/si/pkg/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestReadStdin tests keeping the start and end of huge piped input
+func TestReadStdin(t *testing.T) {
+	oldMaxStdinBytes := maxStdinBytes
+	t.Cleanup(func() { maxStdinBytes = oldMaxStdinBytes })
+	maxStdinBytes = 16
+
+	data, err := readStdin(strings.NewReader("short"))
+	require.NoError(t, err)
+	assert.Equal(t, "short", string(data))
+
+	data, err = readStdin(strings.NewReader("0123456789abcdef"))
+	require.NoError(t, err)
+	assert.Equal(t, "0123456789abcdef", string(data))
+
+	data, err = readStdin(strings.NewReader("HEADHEAD" + strings.Repeat("-", 100) + "TAILTAIL"))
+	require.NoError(t, err)
+	assert.Equal(t, "HEADHEAD\n[... 100 bytes omitted ...]\nTAILTAIL", string(data))
+}
+
+// TestInputLimit tests the limit of piped input in bytes
+func TestInputLimit(t *testing.T) {
+	cfg := &config.Config{LLM: config.LLMConfig{OpenAI: config.OpenAIConfig{ModelName: "gpt-4o"}}}
+	assert.Equal(t, 4*128000*3/4, inputLimit(cfg))
+
+	cfg.Input.MaxBytes = 1000
+	assert.Equal(t, 1000, inputLimit(cfg))
+
+	cfg.Input.MaxTokens = 100
+	assert.Equal(t, 400, inputLimit(cfg))
+
+	cfg = &config.Config{LLM: config.LLMConfig{OpenAI: config.OpenAIConfig{ModelName: "my-model"}}}
+	assert.Zero(t, inputLimit(cfg))
+}
+
+// TestLimitInput tests truncating piped input longer than the limit
+func TestLimitInput(t *testing.T) {
+	provider := mockCommandEnvironment(t, "Answer", false, "")
+	mockUsagePath(t)
+	mockPipedInput(t, "line 1\nline 2\nline 3\nline 4\nline 5\nline 6\n")
+	t.Cleanup(func() { CLI.MaxInput, CLI.Truncate = 0, "" })
+
+	_, stderr := runMainOutput(t, "--no-stream", "--max-input", "5", "explain")
+	assert.Equal(t, "explain\n\nContext:\nline 1\n[... 4 lines omitted ...]\nline 6\n", provider.QuestionAsked)
+	assert.Contains(t, stderr, "Warning: the piped input has about 11 tokens, more than the limit of 5; keeping the start and end (see --max-input and --truncate)")
+
+	_, stderr = runMainOutput(t, "--no-stream", "--max-input", "5", "--truncate", "tail", "explain")
+	assert.Equal(t, "explain\n\nContext:\n[... 4 lines omitted ...]\nline 5\nline 6\n", provider.QuestionAsked)
+	assert.Contains(t, stderr, "keeping the end")
+
+	// The model summarizes the omitted middle first
+	_, stderr = runMainOutput(t, "--no-stream", "--max-input", "5", "--truncate", "summarize", "explain")
+	assert.Equal(t, "explain\n\nContext:\nline 1\n[... 4 lines omitted, summary:\nAnswer\n...]\nline 6\n", provider.QuestionAsked)
+	assert.Contains(t, stderr, "keeping the start and end and summarizing the middle")
+
+	_, stderr = runMainOutput(t, "--truncate", "middle", "explain")
+	assert.Contains(t, stderr, `input.truncate must be head, tail, head+tail or summarize, got "middle"`)
+
+	// Input within the limit is sent as it is
+	_, stderr = runMainOutput(t, "--no-stream", "explain")
+	assert.Equal(t, "explain\n\nContext:\nline 1\nline 2\nline 3\nline 4\nline 5\nline 6\n", provider.QuestionAsked)
+	assert.NotContains(t, stderr, "Warning")
+}
+
+// TestIsBinary tests telling binary data from text
+func TestIsBinary(t *testing.T) {
+	assert.False(t, isBinary(nil))
+	assert.False(t, isBinary([]byte("plain text\twith tabs\r\n\x1b[31mcolors\x1b[0m\n")))
+	assert.False(t, isBinary([]byte("ünïcödé 日本語\n")))
+	assert.True(t, isBinary([]byte("text\x00more")))
+	assert.True(t, isBinary([]byte{0x1f, 0x8b, 0x08, 0x00, 0xde, 0xad}))
+	assert.True(t, isBinary([]byte("\xff\xfe\xfd some text")))
+
+	// A character cut off by the end of the sample is still text
+	long := strings.Repeat("a", binarySniffLen-1) + "ä" + strings.Repeat("b", 10)
+	assert.False(t, isBinary([]byte(long)))
+
+	oldStdinDelim := CLI.StdinDelim
+	t.Cleanup(func() { CLI.StdinDelim = oldStdinDelim })
+	CLI.StdinDelim = `\0`
+	assert.False(t, isBinary([]byte("first\x00second\x00")))
+}
+
+// TestBinaryInput tests refusing binary piped input unless --base64 is given
+func TestBinaryInput(t *testing.T) {
+	provider := mockCommandEnvironment(t, "Answer", false, "")
+	mockUsagePath(t)
+	mockPipedInput(t, "\x1f\x8b\x08\x00\x00\x00\x00\x00")
+	t.Cleanup(func() { CLI.Base64 = false })
+
+	_, stderr := runMainOutput(t, "--no-stream", "what is this")
+	assert.Contains(t, stderr, "the piped input looks like application/x-gzip (8 bytes), not text; pipe text instead, or use --base64 to send it base64-encoded")
+	assert.Empty(t, provider.QuestionAsked)
+
+	_, _ = runMainOutput(t, "--no-stream", "--base64", "what is this")
+	assert.Equal(t, "what is this\n\nContext:\nH4sIAAAAAAA=", provider.QuestionAsked)
+
+	mockPipedInput(t, "\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+	_, stderr = runMainOutput(t, "--no-stream", "what is this")
+	assert.Contains(t, stderr, "the piped input looks like image/png (16 bytes), not text; attach images with --image FILE instead")
+}
+
+// TestMapReduce tests answering from summaries of the chunks of long input
+func TestMapReduce(t *testing.T) {
+	provider := mockCommandEnvironment(t, "Answer", false, "")
+	mockUsagePath(t)
+	var input strings.Builder
+	for i := range 100 {
+		fmt.Fprintf(&input, "line %d\n", i)
+	}
+	mockPipedInput(t, input.String())
+	t.Cleanup(func() { CLI.MaxInput, CLI.MapReduce = 0, false })
+
+	_, stderr := runMainOutput(t, "--no-stream", "--max-input", "50", "--map-reduce", "explain")
+	assert.Contains(t, stderr, "Warning: the piped input has about 198 tokens, more than the limit of 50; summarizing it in parts of 50 tokens")
+	assert.Contains(t, stderr, "Summarizing part 4 of 4...")
+	assert.Equal(t, "explain\n\nContext:\nSummary of part 1 of 4:\nAnswer\n\nSummary of part 2 of 4:\nAnswer\n\n"+
+		"Summary of part 3 of 4:\nAnswer\n\nSummary of part 4 of 4:\nAnswer", provider.QuestionAsked)
+
+	// Summaries that don't shrink the input fail
+	provider.AskResponse = strings.Repeat("long ", 100)
+	_, stderr = runMainOutput(t, "--no-stream", "--max-input", "50", "--map-reduce", "explain")
+	assert.Contains(t, stderr, "the summaries of the input are no shorter than the input")
+}
+
+// TestChunkPrompt tests asking to summarize a chunk with regard to the question
+func TestChunkPrompt(t *testing.T) {
+	assert.Equal(t, "This is part 2 of 3 of a longer input. Summarize it. Keep everything relevant to this question, "+
+		"including names, numbers and errors, but don't answer it yet:\nwhy did it fail?\n\nPart 2:\nlog", chunkPrompt("why did it fail?", 2, 3, "log"))
+	assert.Equal(t, "This is part 1 of 2 of a longer input. Summarize it. Keep names, numbers, errors and anything else "+
+		"a reader may need.\n\nPart 1:\nlog", chunkPrompt(" ", 1, 2, "log"))
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Turee/si/pkg/git"
+)
+
+// hookMarker identifies hooks installed by si
+const hookMarker = "# Installed by si integrate git-hooks"
+
+// prepareCommitMsgHook generates a commit message with si. It never fails, so
+// commits keep working when si is not installed, not configured or offline.
+const prepareCommitMsgHook = `#!/bin/sh
+` + hookMarker + `
+# Generates a commit message for plain "git commit" using si.
+command -v si >/dev/null 2>&1 || exit 0
+si commit --hook "$1" "$2" "$3" </dev/null || true
+exit 0
+`
+
+// gitHooksDir returns the git hooks directory, it can be replaced in tests
+var gitHooksDir = git.HooksDir
+
+// IntegrateCmd integrates si into other tools
+type IntegrateCmd struct {
+	GitHooks GitHooksCmd `cmd:"" name:"git-hooks" help:"Install a git hook that generates commit messages"`
+}
+
+// GitHooksCmd installs the prepare-commit-msg hook into the current repository
+type GitHooksCmd struct {
+	Force     bool `name:"force" help:"Replace an existing prepare-commit-msg hook"`
+	Uninstall bool `name:"uninstall" help:"Remove the hook installed by si"`
+}
+
+// Run installs or removes the hook
+func (c *GitHooksCmd) Run() error {
+	dir, err := gitHooksDir(context.Background())
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(dir, "prepare-commit-msg")
+
+	existing, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("failed to read existing hook: %w", err)
+	}
+	installedBySi := strings.Contains(string(existing), hookMarker)
+
+	if c.Uninstall {
+		if existing == nil {
+			fmt.Fprintln(os.Stderr, "No prepare-commit-msg hook is installed")
+			return nil
+		}
+		if !installedBySi {
+			return fmt.Errorf("the hook at %s was not installed by si, remove it manually", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return fmt.Errorf("failed to remove hook: %w", err)
+		}
+		fmt.Fprintf(os.Stderr, "Removed %s\n", path)
+		return nil
+	}
+
+	if existing != nil && !installedBySi && !c.Force {
+		return fmt.Errorf("a prepare-commit-msg hook already exists at %s, use --force to replace it", path)
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create hooks directory: %w", err)
+	}
+	if err := os.WriteFile(path, []byte(prepareCommitMsgHook), 0755); err != nil {
+		return fmt.Errorf("failed to write hook: %w", err)
+	}
+	// WriteFile keeps the mode of an existing file, so make sure it's executable
+	if err := os.Chmod(path, 0755); err != nil {
+		return fmt.Errorf("failed to make hook executable: %w", err)
+	}
+
+	fmt.Fprintf(os.Stderr, "Installed %s\n", path)
+	return nil
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// mockHooksDir makes the git hooks directory a temporary directory
+func mockHooksDir(t *testing.T) string {
+	t.Helper()
+
+	dir := filepath.Join(t.TempDir(), "hooks")
+	oldGitHooksDir := gitHooksDir
+	t.Cleanup(func() { gitHooksDir = oldGitHooksDir })
+	gitHooksDir = func(ctx context.Context) (string, error) {
+		return dir, nil
+	}
+	return dir
+}
+
+// TestIntegrateGitHooks tests installing and removing the prepare-commit-msg hook
+func TestIntegrateGitHooks(t *testing.T) {
+	dir := mockHooksDir(t)
+	hookPath := filepath.Join(dir, "prepare-commit-msg")
+
+	output, stderr := runMainOutput(t, "integrate", "git-hooks")
+	assert.Empty(t, output)
+	assert.Equal(t, "Installed "+hookPath+"\n", stderr)
+
+	data, err := os.ReadFile(hookPath)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `si commit --hook "$1" "$2" "$3"`)
+	info, err := os.Stat(hookPath)
+	require.NoError(t, err)
+	assert.NotZero(t, info.Mode()&0100, "the hook must be executable")
+
+	// Installing again updates the hook
+	_, stderr = runMainOutput(t, "integrate", "git-hooks")
+	assert.Equal(t, "Installed "+hookPath+"\n", stderr)
+
+	_, stderr = runMainOutput(t, "integrate", "git-hooks", "--uninstall")
+	assert.Equal(t, "Removed "+hookPath+"\n", stderr)
+	assert.NoFileExists(t, hookPath)
+}
+
+// TestIntegrateGitHooksExisting tests that hooks not installed by si are kept
+func TestIntegrateGitHooksExisting(t *testing.T) {
+	dir := mockHooksDir(t)
+	hookPath := filepath.Join(dir, "prepare-commit-msg")
+	require.NoError(t, os.MkdirAll(dir, 0755))
+	require.NoError(t, os.WriteFile(hookPath, []byte("#!/bin/sh\necho custom\n"), 0644))
+
+	_, stderr := runMainOutput(t, "integrate", "git-hooks")
+	assert.Contains(t, stderr, "already exists")
+
+	_, stderr = runMainOutput(t, "integrate", "git-hooks", "--uninstall")
+	assert.Contains(t, stderr, "was not installed by si")
+	assert.FileExists(t, hookPath)
+
+	_, stderr = runMainOutput(t, "integrate", "git-hooks", "--force")
+	assert.Equal(t, "Installed "+hookPath+"\n", stderr)
+	info, err := os.Stat(hookPath)
+	require.NoError(t, err)
+	assert.NotZero(t, info.Mode()&0100, "the hook must be executable")
+}
@@ -2,25 +2,107 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"io"
+	"io/fs"
 	"os"
+	"os/signal"
 	"strings"
 
+	"github.com/Turee/si/pkg/cache"
 	"github.com/Turee/si/pkg/config"
 	"github.com/Turee/si/pkg/llm"
-	"github.com/Turee/si/pkg/version"
+	"github.com/Turee/si/pkg/logging"
+	"github.com/Turee/si/pkg/output"
+	"github.com/Turee/si/pkg/prompt"
+	"github.com/Turee/si/pkg/script"
+	"github.com/Turee/si/pkg/state"
+	"github.com/Turee/si/pkg/usage"
 	"github.com/alecthomas/kong"
 )
 
 // CLI represents the command line interface
 var CLI struct {
 	// Global flags
-	ConfigPath string   `name:"config" help:"Path to config file" type:"path"`
-	Debug      bool     `name:"debug" help:"Enable debug mode"`
-	Version    bool     `name:"version" help:"Show version information"`
-	NoStream   bool     `name:"no-stream" help:"Disable streaming responses"`
-	Question   []string `arg:"" optional:"" name:"question" help:"Question to ask the LLM"`
+	ConfigPath   string   `name:"config" help:"Path to config file" type:"path"`
+	Profile      string   `name:"profile" help:"Name of a profile from the config to use"`
+	Provider     string   `name:"provider" help:"Name of a provider from llm.providers in the config to use"`
+	Debug        bool     `name:"debug" help:"Log HTTP requests, responses, stream events, timings and retries to stderr or log_file"`
+	Version      bool     `name:"version" help:"Show version information"`
+	NoStream     bool     `name:"no-stream" help:"Disable streaming responses"`
+	LineBuffered bool     `name:"line-buffered" help:"Only write complete lines of streamed output"`
+	NoSpinner    bool     `name:"no-spinner" help:"Don't show a spinner on stderr while waiting for the answer"`
+	Prompt       string   `name:"prompt" short:"p" help:"Name of a prompt template from the config to use"`
+	Model        string   `name:"model" short:"m" help:"Model to use, overriding the model from the config"`
+	Temperature  *float64 `name:"temperature" help:"Sampling temperature between 0 and 2"`
+	TopP         *float64 `name:"top-p" help:"Nucleus sampling probability mass between 0 and 1"`
+	MaxTokens    int      `name:"max-tokens" help:"Maximum number of tokens to generate"`
+	Image        []string `name:"image" sep:"none" help:"Image file or URL to attach to the question, can be repeated"`
+	URL          []string `name:"url" sep:"none" placeholder:"URL" help:"Fetch a web page and add its readable text to the question, can be repeated"`
+	Dir          []string `name:"dir" sep:"none" placeholder:"DIR" help:"Add the text files of a directory to the question with their paths, skipping what .gitignore files ignore, can be repeated"`
+	Include      []string `name:"include" sep:"none" placeholder:"PATTERN" help:"Only add the files of --dir, or index the files, matching a .gitignore-style pattern such as '*.go', can be repeated"`
+	Exclude      []string `name:"exclude" sep:"none" placeholder:"PATTERN" help:"Skip the files of --dir, or of si index, matching a .gitignore-style pattern such as 'vendor/', can be repeated"`
+	RAG          bool     `name:"rag" help:"Add the chunks of the files indexed with si index most relevant to the question, citing them in footnotes"`
+	Cost         bool     `name:"cost" help:"Print token usage and estimated cost after the response"`
+	Session      string   `name:"session" help:"Name of the session the usage is recorded under, for the cache hit rates of si usage --sessions (default: a new session every run)"`
+	Format       string   `name:"format" help:"Output format: text, json-stream, template=<go template> or the name of a format from the config"`
+	Output       string   `name:"output" enum:"text,json,ndjson" default:"text" help:"Output mode: text, json for a single JSON object with the answer and its metadata, or ndjson for a JSON event per streamed chunk"`
+	NoCache      bool     `name:"no-cache" help:"Neither answer from nor add to the answer cache, and fetch --url pages again"`
+	Schema       string   `name:"schema" type:"path" help:"JSON Schema file the answer must conform to; requests structured output and retries invalid answers"`
+	Diff         diffFlag `name:"diff" help:"Attach the output of git diff to the question, optionally followed by a revision or range (e.g. --diff HEAD~3); with compare, show a word-level diff of the two answers"`
+	Agent        bool     `name:"agent" help:"Let the model call tools (shell commands, reading files, fetching URLs) until it can answer"`
+	NoMemory     bool     `name:"no-memory" help:"Ignore the workspace memory file (SI.md or .si/instructions.md)"`
+	Role         string   `name:"role" help:"Name of a role from the config to add to the system prompt"`
+	PrintSystem  bool     `name:"print-system" help:"Print the system prompt instead of asking a question"`
+	NoState      bool     `name:"no-state" help:"Don't write local state such as the answer cache and the usage log"`
+	Ephemeral    bool     `name:"ephemeral" help:"Leave no trace of the question: implies --no-state and --no-cache and asks the provider not to store the request"`
+	DryRun       bool     `name:"dry-run" help:"Print the request that would be sent to the provider, with the API key redacted, instead of sending it"`
+	Paste        bool     `name:"paste" help:"Use the text on the clipboard as the piped input"`
+	Out          string   `name:"out" type:"path" placeholder:"PATH" help:"Also write the answer to a file, creating its directory"`
+	Append       bool     `name:"append" help:"Append the answer to the file of --out instead of replacing it"`
+	NoRedact     bool     `name:"no-redact" help:"Send secrets such as API keys in piped input and diffs as they are instead of replacing them with placeholders"`
+	ScrubPII     bool     `name:"scrub-pii" help:"Replace email addresses, phone numbers and IP addresses in the prompt with placeholders, restoring them in the answer"`
+	MaxInput     int      `name:"max-input" help:"Maximum tokens of piped input, longer input is truncated (default: three quarters of the context window)"`
+	Truncate     string   `name:"truncate" help:"Part of piped input longer than --max-input to keep: head, tail, head+tail or summarize"`
+	MapReduce    bool     `name:"map-reduce" help:"Summarize piped input longer than --max-input in chunks and answer from the summaries instead of truncating it"`
+	Code         codeFlag `name:"code" help:"Print only the code blocks of the answer; --code=first for the first one, --code=LANG for those of a language"`
+	Copy         copyFlag `name:"copy" help:"Copy the answer to the clipboard, or only its first code block with --copy=code"`
+	Edit         bool     `name:"edit" short:"e" help:"Compose the question in $VISUAL or $EDITOR, starting with the piped input"`
+	StdinDelim   string   `name:"stdin-delimiter" placeholder:"MARKER" help:"Split piped input into separate attachments at lines consisting of MARKER, or at NUL bytes with \\0"`
+	Base64       bool     `name:"base64" help:"Send binary piped input base64-encoded instead of refusing it"`
+
+	// Commands
+	Ask           AskCmd           `cmd:"" default:"withargs" help:"Ask the LLM a question (default)"`
+	Sh            ShCmd            `cmd:"" help:"Generate a shell command and optionally run it"`
+	Commit        CommitCmd        `cmd:"" help:"Generate a commit message for the staged changes"`
+	Review        ReviewCmd        `cmd:"" help:"Review the changes of a diff and report the findings"`
+	PR            PRCmd            `cmd:"" name:"pr" help:"Write the title and description of a pull request for the branch"`
+	Compare       CompareCmd       `cmd:"" help:"Ask several models the same question and compare the answers"`
+	TUI           TUICmd           `cmd:"" name:"tui" help:"Chat with the model in a full-screen terminal interface"`
+	Tokens        TokensCmd        `cmd:"" help:"Count the tokens of the text piped via stdin"`
+	Embed         EmbedCmd         `cmd:"" help:"Print the embeddings of the lines piped via stdin as JSON"`
+	Index         IndexCmd         `cmd:"" help:"Index the files of a directory for answering with --rag"`
+	Usage         UsageCmd         `cmd:"" help:"Report the recorded token usage and cost"`
+	Integrate     IntegrateCmd     `cmd:"" help:"Integrate si into other tools"`
+	Serve         ServeCmd         `cmd:"" help:"Serve requests of editor plugins over JSON-RPC, or an OpenAI-compatible API"`
+	MCPServe      MCPServeCmd      `cmd:"" name:"mcp-serve" help:"Serve the prompt templates and models of si to MCP clients over stdio"`
+	ExplainConfig ExplainConfigCmd `cmd:"" name:"explain-config" help:"Print the effective configuration and where each value comes from"`
+	Config        ConfigCmd        `cmd:"" help:"Manage the configuration file"`
+	Saved         SavedCmd         `cmd:"" help:"Save queries with parameters and run them"`
+	Tools         ToolsCmd         `cmd:"" help:"Manage the tools the model can call in agent mode"`
+	Models        ModelsCmd        `cmd:"" help:"List the models the provider offers with their context windows"`
+	Doctor        DoctorCmd        `cmd:"" help:"Check the configuration and the connection to the provider"`
+	Warmup        WarmupCmd        `cmd:"" help:"Load the model of a local provider into memory before the first question"`
+	Tail          TailCmd          `cmd:"" help:"Review log lines for anomalies, following a growing file with --follow"`
+	Copilot       CopilotCmd       `cmd:"" help:"Sign in to GitHub Copilot to use it as a provider"`
+	Completion    CompletionCmd    `cmd:"" help:"Print the shell completion script for bash, zsh, fish or powershell"`
+	Complete      CompleteCmd      `cmd:"" name:"__complete" hidden:"" help:"List completions of the current word for the completion scripts"`
+	VersionCmd    VersionCmd       `cmd:"" name:"version" help:"Show version information"`
+}
+
+// AskCmd asks the LLM a question
+type AskCmd struct {
+	Question []string `arg:"" optional:"" name:"question" help:"Question to ask the LLM"`
 }
 
 // For testing purposes, we can override these functions
@@ -28,7 +110,9 @@ var (
 	osExit         = os.Exit
 	loadConfigFunc = config.LoadConfig
 	stdinStat      = os.Stdin.Stat
-	stdinRead      = func() ([]byte, error) { return io.ReadAll(os.Stdin) }
+	stdoutStat     = os.Stdout.Stat
+	stderrStat     = func() (os.FileInfo, error) { return os.Stderr.Stat() }
+	stdinRead      = func() ([]byte, error) { return readStdin(os.Stdin) }
 )
 
 func main() {
@@ -44,64 +128,314 @@ func main() {
 		}),
 	)
 
+	state.SetReadOnly(CLI.NoState || CLI.Ephemeral)
+	moveLegacyFiles()
+
 	// Handle version flag
 	if CLI.Version {
-		fmt.Println("si version", version.Info())
+		printVersion()
+		return
+	}
+
+	// Run the selected command
+	if err := kongCtx.Run(kongCtx); err != nil {
+		// An interrupted answer has already been flushed, there's nothing to report
+		if !errors.Is(err, context.Canceled) {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		}
+		osExit(exitCode(err))
+	}
+}
+
+// moveLegacyFiles moves the configuration file, the answer cache and the
+// usage log from the paths of older versions to the conventional ones of the
+// platform. Nothing is moved in read-only mode; the legacy files are used
+// until they are moved.
+func moveLegacyFiles() {
+	if state.ReadOnly() {
 		return
 	}
 
+	type legacyFile struct {
+		name string
+		move func() (string, error)
+	}
+	files := []legacyFile{
+		{"usage log", usage.MoveLegacy},
+		{"answer cache", cache.MoveLegacy},
+	}
+	if CLI.ConfigPath == "" {
+		files = append(files, legacyFile{"configuration file", config.MoveLegacyConfig})
+	}
+	for _, m := range files {
+		path, err := m.move()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to move the %s: %v\n", m.name, err)
+		} else if path != "" {
+			fmt.Fprintf(os.Stderr, "Moved the %s to %s\n", m.name, path)
+		}
+	}
+}
+
+// notifyInterrupt returns a context that is canceled when the user presses
+// Ctrl+C. After the first Ctrl+C the default handling is restored, so a second
+// one terminates si immediately. It is a variable so tests can simulate
+// interrupts.
+var notifyInterrupt = func(parent context.Context) (context.Context, context.CancelFunc) {
+	ctx, stop := signal.NotifyContext(parent, os.Interrupt)
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+	return ctx, stop
+}
+
+// Run asks the question given on the command line and/or piped via stdin
+func (c *AskCmd) Run(kongCtx *kong.Context) error {
+	if CLI.PrintSystem {
+		cfg := loadConfiguration(kongCtx)
+		if cfg == nil {
+			return nil
+		}
+		return printSystem(cfg)
+	}
+
 	// Check if we have data from stdin
 	stdinContent, err := checkStdin()
 	if err != nil {
-		fmt.Printf("Error reading from stdin: %v\n", err)
-		osExit(1)
+		fmt.Fprintf(os.Stderr, "Error reading from stdin: %v\n", err)
+		osExit(exitError)
 	}
 
-	// If no question is provided and no stdin content, show help
-	if len(CLI.Question) == 0 && stdinContent == "" {
-		kongCtx.PrintUsage(false)
-		return
+	// The clipboard and the edited text take the place of the piped input
+	if CLI.Paste {
+		if stdinContent, err = pasteInput(stdinContent); err != nil {
+			return err
+		}
+	}
+	if CLI.Edit {
+		if stdinContent, err = composeQuestion(stdinContent); err != nil {
+			return err
+		}
+	}
+
+	// If no question, prompt template or stdin content is provided, show help
+	if len(c.Question) == 0 && CLI.Prompt == "" && stdinContent == "" && !CLI.Diff.Enabled && len(CLI.URL) == 0 && len(CLI.Dir) == 0 {
+		printUsage(kongCtx)
+		return nil
+	}
+
+	cfg := loadConfiguration(kongCtx)
+	if cfg == nil {
+		return nil
 	}
 
+	// Process the question with stdin content if available
+	return handleQuestion(cfg, c.Question, stdinContent)
+}
+
+// printUsage prints the usage to stderr, for when a command is run without
+// input. Stdout is reserved for the answer.
+func printUsage(kongCtx *kong.Context) {
+	stdout := kongCtx.Stdout
+	kongCtx.Stdout = os.Stderr
+	defer func() { kongCtx.Stdout = stdout }()
+
+	kongCtx.PrintUsage(false)
+}
+
+// loadConfiguration loads, overrides and validates the configuration. On
+// failure it reports the problem, exits and returns nil.
+func loadConfiguration(kongCtx *kong.Context) *config.Config {
 	// Load configuration
 	configPath := CLI.ConfigPath
 	cfg, err := loadConfigFunc(configPath)
 	if err != nil {
-		if os.IsNotExist(err) {
-			fmt.Println("Configuration file not found. Please create a configuration file at ~/.config/si.yaml")
-			fmt.Println("Example configuration:")
-			fmt.Println("```yaml")
-			fmt.Println("llm:")
-			fmt.Println("  openai:")
-			fmt.Println("    # Base URL for the OpenAI API. You can specify:")
-			fmt.Println("    # - Full endpoint URL: https://api.openai.com/v1/chat/completions")
-			fmt.Println("    # - Base API URL: https://api.openai.com/v1")
-			fmt.Println("    # - For Azure, use your Azure OpenAI resource endpoint")
-			fmt.Println("    base_url: https://api.openai.com/v1")
-			fmt.Println("    # Your OpenAI API key or Azure API key")
-			fmt.Println("    api_key: your-api-key")
-			fmt.Println("    # Model name to use (default: gpt-4)")
-			fmt.Println("    model_name: gpt-4")
-			fmt.Println("    # For Azure OpenAI, specify your deployment name")
-			fmt.Println("    azure_deployment_name: optional-azure-deployment-name")
-			fmt.Println("```")
-			osExit(1)
-		}
-		fmt.Printf("Error loading configuration: %v\n", err)
-		osExit(1)
+		fmt.Fprintf(os.Stderr, "Error loading configuration: %v\n", err)
+		if errors.Is(err, fs.ErrNotExist) {
+			fmt.Fprintf(os.Stderr, "Run si config init to create %s.\n", configFilePath())
+		}
+		osExit(exitConfig)
+		return nil
+	}
+
+	reportConfigLoad(cfg)
+
+	// Apply the selected profile and the command line overrides on top of
+	// the configuration
+	if err := applySelection(kongCtx, cfg); err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid configuration: %v\n", err)
+		osExit(exitConfig)
+		return nil
 	}
 
 	// Validate configuration
 	if err := cfg.Validate(); err != nil {
-		fmt.Printf("Invalid configuration: %v\n", err)
-		osExit(1)
+		fmt.Fprintf(os.Stderr, "Invalid configuration: %v\n", err)
+		osExit(exitConfig)
+		return nil
+	}
+	if err := logging.SetupFile(cfg.LogLevel, config.ExpandPath(cfg.LogFile), stderr); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		osExit(exitConfig)
+		return nil
+	}
+	if err := resolveAPIKey(cfg); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		osExit(exitAuth)
+		return nil
 	}
 
-	// Process the question with stdin content if available
-	if err := handleQuestion(cfg, CLI.Question, stdinContent); err != nil {
-		fmt.Printf("Error: %v\n", err)
-		osExit(1)
+	return cfg
+}
+
+// reportConfigLoad reports a migration of the config file and the
+// environment variables it refers to that are not set, which are easy to miss
+// as they expand to empty values
+func reportConfigLoad(cfg *config.Config) {
+	if m := cfg.Migrated(); m != nil {
+		printMigration(configFilePath(), m)
+	}
+	if missing := cfg.MissingEnv(); len(missing) > 0 {
+		fmt.Fprintf(os.Stderr, "Warning: the config file refers to unset environment variables: %s\n", strings.Join(missing, ", "))
+	}
+}
+
+// selectedProfile returns the profile selected with --profile or SI_PROFILE,
+// or the default profile of the configuration
+func selectedProfile(cfg *config.Config) string {
+	if CLI.Profile != "" {
+		return CLI.Profile
+	}
+	return cfg.Profile
+}
+
+// applyProfile applies the selected profile, if any, to the configuration
+func applyProfile(cfg *config.Config) error {
+	name := selectedProfile(cfg)
+	if name == "" {
+		return nil
+	}
+	return cfg.ApplyProfile(name)
+}
+
+// selectedProvider returns the provider selected with --provider or
+// SI_PROVIDER, or the default provider of the configuration
+func selectedProvider(cfg *config.Config) string {
+	if CLI.Provider != "" {
+		return CLI.Provider
+	}
+	return cfg.LLM.Provider
+}
+
+// applyProvider applies the selected provider, if any, to the configuration
+func applyProvider(cfg *config.Config) error {
+	name := selectedProvider(cfg)
+	if name == "" {
+		return nil
+	}
+	return cfg.ApplyProvider(name)
+}
+
+// applySelection applies the selected profile and provider, and then the
+// settings given on the command line, to the configuration
+func applySelection(kongCtx *kong.Context, cfg *config.Config) error {
+	if err := applyProfile(cfg); err != nil {
+		return err
+	}
+	if err := applyProvider(cfg); err != nil {
+		return err
+	}
+	applyOverrides(kongCtx, cfg)
+	return nil
+}
+
+// applyOverrides applies settings given on the command line to the configuration
+func applyOverrides(kongCtx *kong.Context, cfg *config.Config) {
+	for _, layer := range overrideLayers(kongCtx) {
+		cfg.Merge(layer.Config)
+	}
+}
+
+// overrideLayers returns a configuration layer for every setting overridden
+// by a command line flag or environment variable
+func overrideLayers(kongCtx *kong.Context) []config.Layer {
+	var layers []config.Layer
+
+	if CLI.Model != "" {
+		layer := config.Layer{Name: flagSource(kongCtx, "model"), Config: &config.Config{}}
+		layer.Config.SetModel(CLI.Model)
+		layers = append(layers, layer)
+	}
+
+	if CLI.Temperature != nil {
+		layer := config.Layer{Name: flagSource(kongCtx, "temperature"), Config: &config.Config{}}
+		layer.Config.SetSampling(config.SamplingConfig{Temperature: CLI.Temperature})
+		layers = append(layers, layer)
+	}
+
+	if CLI.TopP != nil {
+		layer := config.Layer{Name: flagSource(kongCtx, "top-p"), Config: &config.Config{}}
+		layer.Config.SetSampling(config.SamplingConfig{TopP: CLI.TopP})
+		layers = append(layers, layer)
+	}
+
+	if CLI.MaxTokens != 0 {
+		layer := config.Layer{Name: flagSource(kongCtx, "max-tokens"), Config: &config.Config{}}
+		layer.Config.SetSampling(config.SamplingConfig{MaxTokens: CLI.MaxTokens})
+		layers = append(layers, layer)
+	}
+
+	if CLI.MaxInput != 0 {
+		layer := config.Layer{Name: flagSource(kongCtx, "max-input"), Config: &config.Config{}}
+		layer.Config.Input.MaxTokens = CLI.MaxInput
+		layers = append(layers, layer)
+	}
+
+	if CLI.Truncate != "" {
+		layer := config.Layer{Name: flagSource(kongCtx, "truncate"), Config: &config.Config{}}
+		layer.Config.Input.Truncate = CLI.Truncate
+		layers = append(layers, layer)
+	}
+
+	if CLI.MapReduce {
+		layer := config.Layer{Name: flagSource(kongCtx, "map-reduce"), Config: &config.Config{}}
+		layer.Config.Input.MapReduce = true
+		layers = append(layers, layer)
+	}
+
+	if CLI.Debug {
+		layer := config.Layer{Name: flagSource(kongCtx, "debug"), Config: &config.Config{}}
+		layer.Config.LogLevel = logging.LevelDebug
+		layers = append(layers, layer)
+	}
+
+	// Ephemeral questions opt out of provider-side retention
+	if CLI.Ephemeral {
+		layer := config.Layer{Name: flagSource(kongCtx, "ephemeral"), Config: &config.Config{}}
+		layer.Config.SetStore(false)
+		layers = append(layers, layer)
+	}
+
+	return layers
+}
+
+// flagSource describes whether a flag was given on the command line or
+// through its environment variable
+func flagSource(kongCtx *kong.Context, name string) string {
+	if kongCtx != nil {
+		for _, path := range kongCtx.Path {
+			if path.Flag != nil && path.Flag.Name == name {
+				return "flag --" + name
+			}
+		}
+		for _, flag := range kongCtx.Flags() {
+			if flag.Name == name && len(flag.Envs) > 0 {
+				return "env " + flag.Envs[0]
+			}
+		}
 	}
+	return "flag --" + name
 }
 
 // checkStdin checks if there is input from stdin and reads it
@@ -118,22 +452,58 @@ func checkStdin() (string, error) {
 		if err != nil {
 			return "", fmt.Errorf("error reading from stdin: %w", err)
 		}
-		return string(data), nil
+		return checkBinary(data)
 	}
 
 	return "", nil
 }
 
-func handleQuestion(cfg *config.Config, question []string, stdinContent string) error {
-	// Create LLM provider
-	provider, err := llm.NewProvider(cfg)
+// composeQuestion lets the user write the question in the editor, starting
+// with the piped input. Nothing is asked if the saved text is empty.
+func composeQuestion(stdinContent string) (string, error) {
+	text, err := editText(stdinContent, "si-question-*.md")
 	if err != nil {
-		return fmt.Errorf("error creating LLM provider: %w", err)
+		return "", err
 	}
+	if strings.TrimSpace(text) == "" {
+		return "", errors.New("the question is empty, nothing was asked")
+	}
+	return text, nil
+}
 
+// buildQuestion combines the question arguments and stdin content into the
+// final question, rendering the selected prompt template if one was given
+func buildQuestion(cfg *config.Config, question []string, stdinContent string) (string, error) {
 	// Join all question parts into a single string
 	questionStr := strings.Join(question, " ")
 
+	var inputs []string
+	if stdinContent != "" {
+		inputs = []string{stdinContent}
+		if CLI.StdinDelim != "" {
+			inputs = prompt.Split(stdinContent, CLI.StdinDelim)
+		}
+	}
+
+	// A prompt template decides itself where the input and arguments go
+	if CLI.Prompt != "" {
+		return prompt.Lookup(cfg.Prompts, CLI.Prompt, prompt.Data{
+			Input:   stdinContent,
+			Inputs:  inputs,
+			Args:    questionStr,
+			ArgList: question,
+		})
+	}
+
+	// Several inputs are attached separately, so the model can tell them apart
+	if len(inputs) > 1 {
+		attachments := make([]string, len(inputs))
+		for i, input := range inputs {
+			attachments[i] = fmt.Sprintf("Attachment %d of %d:\n%s", i+1, len(inputs), strings.TrimRight(input, "\n"))
+		}
+		stdinContent = strings.Join(attachments, "\n\n")
+	}
+
 	// If we have content from stdin, add it to the question
 	if stdinContent != "" {
 		if questionStr == "" {
@@ -145,34 +515,388 @@ func handleQuestion(cfg *config.Config, question []string, stdinContent string)
 		}
 	}
 
-	// If streaming is disabled, use the non-streaming API
-	if CLI.NoStream {
+	return questionStr, nil
+}
+
+func handleQuestion(cfg *config.Config, question []string, stdinContent string) error {
+	// Secrets in the input are replaced before the prompt template sees it,
+	// and before the input is truncated, as the omitted part may be sent to
+	// be summarized
+	redactor, err := newRedactor(cfg)
+	if err != nil {
+		return err
+	}
+	scrubber := newScrubber(cfg)
+	stdinContent, err = limitInput(cfg, strings.Join(question, " "), redactor.Redact(stdinContent), scrubber)
+	if err != nil {
+		return err
+	}
+
+	questionStr, err := buildQuestion(cfg, question, stdinContent)
+	if err != nil {
+		return err
+	}
+
+	if questionStr, err = attachDiff(context.Background(), questionStr, redactor); err != nil {
+		return err
+	}
+	if questionStr, err = attachDirs(cfg, questionStr, redactor); err != nil {
+		return err
+	}
+	if questionStr, err = attachURLs(context.Background(), cfg, questionStr); err != nil {
+		return err
+	}
+	var sources sourceList
+	if questionStr, err = attachChunks(context.Background(), cfg, strings.Join(question, " "), questionStr, redactor, &sources); err != nil {
+		return err
+	}
+	warnRedacted(redactor)
+
+	// Personal data is scrubbed from the whole prompt
+	questionStr = scrubber.Redact(questionStr)
+	warnScrubbed(scrubber)
+
+	// The pre_request hook can change or reject the question
+	if questionStr, err = runHook(cfg, "pre_request", cfg.Hooks.PreRequest, questionStr); err != nil {
+		return err
+	}
+
+	images, err := loadImages(CLI.Image)
+	if err != nil {
+		return err
+	}
+
+	format, err := outputFormat(cfg)
+	if err != nil {
+		return err
+	}
+
+	warnContextWindow(cfg, questionStr)
+
+	closeOut, err := openAnswerFile()
+	if err != nil {
+		return err
+	}
+	defer closeOut()
+
+	// Load the hook script that can modify requests and responses
+	hook, err := loadHook(cfg)
+	if err != nil {
+		return err
+	}
+
+	// Validation rules and examples of the selected prompt template
+	var rules config.ValidationConfig
+	var examples []config.PromptExample
+	if CLI.Prompt != "" {
+		rules = cfg.Prompts[CLI.Prompt].Validate
+		examples = cfg.Prompts[CLI.Prompt].Examples
+	}
+	if CLI.Schema != "" {
+		rules.Schema = CLI.Schema
+	}
+	responseSchema, err := loadResponseSchema(rules)
+	if err != nil {
+		return err
+	}
+
+	// Create LLM provider
+	system, err := systemPrompt(cfg)
+	if err != nil {
+		return err
+	}
+	var usage usageTracker
+	newProvider := func() (llm.Provider, error) {
+		provider, err := newHookedProvider(cfg, hook)
+		if err != nil {
+			return nil, err
+		}
+		useSystemPrompt(provider, system)
+		useExamples(provider, examples)
+		useResponseSchema(provider, responseSchema)
+		usage.track(provider)
+		return provider, nil
+	}
+	provider, err := newProvider()
+	if err != nil {
+		return err
+	}
+
+	// Output templates and JSON output render the answer with its metadata
+	var cacheMatch string
+	printer := newAnswerPrinter(cfg, format, questionStr, &usage, &cacheMatch, &sources)
+
+	// Questions with images or a schema and agent answers are never cached,
+	// and dry runs must reach the provider
+	var answers *answerCache
+	if len(images) == 0 && responseSchema == nil && !CLI.Agent && !CLI.DryRun {
+		answers = openAnswerCache(cfg, provider)
+	}
+	if answer, match, ok := answers.lookup(modelName(cfg), questionStr); ok {
+		cacheMatch = match
+		if err := printCachedAnswer(answer, printer); err != nil {
+			return err
+		}
+		if err := printFootnotes(printer, &sources); err != nil {
+			return err
+		}
+		return copyAnswer(answer)
+	}
+
+	ask := func(provider llm.Provider) (string, error) {
+		if CLI.Agent {
+			return answerWithTools(cfg, provider, questionStr, images, printer, &usage, &sources, redactor)
+		}
+		return answerQuestion(provider, questionStr, images, responseHooks{cfg, hook, redactor, scrubber}, rules, printer, newSpinner(cfg))
+	}
+	answer, err := ask(provider)
+	if errors.Is(err, llm.ErrDryRun) {
+		return nil
+	}
+
+	// Let the user pick another model if the configured one doesn't exist
+	if llm.IsModelNotFound(err) {
+		model, pickErr := pickModel(cfg, provider)
+		if pickErr != nil {
+			return pickErr
+		}
+		if model == "" {
+			return err
+		}
+
+		cfg.SetModel(model)
+		if provider, err = newProvider(); err != nil {
+			return err
+		}
+		answer, err = ask(provider)
+	}
+
+	// Let the fallbacks answer in order while the model is rate limited or
+	// unavailable. Agents only fall back before their first answer, so no
+	// tool is run twice.
+	primary := *cfg
+	for _, fallback := range cfg.LLM.Fallbacks {
+		if !llm.IsUnavailable(err) || len(usage.requests) > 0 {
+			break
+		}
+
+		failed := modelName(cfg)
+		*cfg = primary
+		if fallbackErr := cfg.ApplyFallback(fallback); fallbackErr != nil {
+			return fallbackErr
+		}
+		if keyErr := resolveAPIKey(cfg); keyErr != nil {
+			return keyErr
+		}
+		fmt.Fprintf(os.Stderr, "Warning: %s failed: %v, answering with %s\n", failed, err, modelName(cfg))
+
+		if provider, err = newProvider(); err != nil {
+			return err
+		}
+		answer, err = ask(provider)
+	}
+
+	if err == nil && strings.TrimSpace(answer) == "" {
+		err = errEmptyAnswer
+	}
+
+	if err == nil {
+		err = printFootnotes(printer, &sources)
+	}
+
+	usage.save(modelName(cfg))
+	if err == nil {
+		answers.store(modelName(cfg), questionStr, answer)
+		if CLI.Cost {
+			usage.print(os.Stderr, modelName(cfg))
+		}
+		err = copyAnswer(answer)
+	}
+
+	return err
+}
+
+// printCachedAnswer prints an answer taken from the cache
+func printCachedAnswer(answer string, printer *answerPrinter) error {
+	if printer != nil {
+		if err := printer.print(answer); err != nil {
+			return err
+		}
+	} else {
+		fmt.Fprintln(answerOutput(), answer)
+	}
+
+	if CLI.Cost {
+		fmt.Fprintln(os.Stderr, "Usage: none, answered from the cache")
+	}
+	return nil
+}
+
+// newHookedProvider creates the LLM provider and installs the request hook of
+// the hook script
+func newHookedProvider(cfg *config.Config, hook *script.Hook) (llm.Provider, error) {
+	provider, err := llm.NewProvider(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("error creating LLM provider: %w", err)
+	}
+
+	if hook.HasRequestHook() {
+		hookable, ok := provider.(llm.HookableProvider)
+		if !ok {
+			return nil, fmt.Errorf("the configured provider does not support request hooks")
+		}
+		hookable.SetRequestHook(hook.OnRequest)
+	}
+
+	if CLI.DryRun {
+		if err := useDryRun(provider); err != nil {
+			return nil, err
+		}
+	}
+
+	return provider, nil
+}
+
+// answerQuestion asks the question, prints the answer and returns it. A
+// printer replaces printing the answer as is. The spinner is shown until the
+// answer starts.
+func answerQuestion(provider llm.Provider, question string, images []llm.ContentPart, hook responseHooks, rules config.ValidationConfig, printer *answerPrinter, spin *spinner) (string, error) {
+	// Ctrl+C cancels the request instead of killing si, so a partially
+	// streamed answer is flushed and terminated properly
+	ctx, stop := notifyInterrupt(context.Background())
+	defer stop()
+
+	spin.Start()
+	defer spin.Stop()
+
+	// If streaming is disabled, use the non-streaming API. Response hooks,
+	// validation and output templates need the complete answer, so they
+	// disable streaming as well.
+	if CLI.NoStream || hook.HasResponseHook() || rules.Enabled() || (printer != nil && printer.stream == nil) {
 		// Ask the question
-		answer, err := provider.Ask(context.Background(), questionStr)
+		answer, err := askValidated(ctx, provider, question, images, rules)
+		spin.Stop()
 		if err != nil {
+			return "", err
+		}
 
-			return fmt.Errorf("error asking question: %w", err)
+		// Let the hooks modify the answer
+		if answer, err = hook.OnResponse(answer); err != nil {
+			return "", err
 		}
 
 		// Print the answer
-		fmt.Println(answer)
-		return nil
+		if printer != nil {
+			return answer, printer.print(answer)
+		}
+		fmt.Fprintln(answerOutput(), answer)
+		return answer, nil
 	}
 
 	// Use streaming API
-	err = provider.AskStream(context.Background(), questionStr, func(chunk string) error {
+	var answer strings.Builder
+	messages := []llm.Message{llm.NewUserMessage(question, images...)}
+	if printer != nil {
+		err := provider.ChatStream(ctx, messages, func(chunk string) error {
+			spin.Stop()
+			answer.WriteString(chunk)
+			return printer.stream(chunk)
+		})
+		if err != nil {
+			return "", fmt.Errorf("error asking question: %w", err)
+		}
+		return answer.String(), printer.print(answer.String())
+	}
+
+	stream := output.NewStreamWriter(answerOutput(), streamFlushMode())
+	defer stderr.streaming(stream)()
+	err := provider.ChatStream(ctx, messages, func(chunk string) error {
 		// Print the chunk without a newline to create a streaming effect
-		fmt.Print(chunk)
-		// Flush stdout to ensure the chunk is displayed immediately
-		return nil
+		spin.Stop()
+		answer.WriteString(chunk)
+		_, err := stream.WriteString(chunk)
+		return err
 	})
 
+	spin.Stop()
+
+	// Print a newline at the end of the response, flushing what is buffered.
+	// Requests that fail before any output leave stdout untouched.
+	if answer.Len() > 0 || err == nil {
+		stream.WriteString("\n")
+	}
+	if flushErr := stream.Flush(); err == nil {
+		err = flushErr
+	}
+
 	if err != nil {
+		return "", fmt.Errorf("error asking question: %w", err)
+	}
+
+	return answer.String(), nil
+}
+
+// askValidated asks the question and re-prompts the model while the answer
+// violates the validation rules, up to the configured number of retries. The
+// images are attached to every attempt.
+func askValidated(ctx context.Context, provider llm.Provider, question string, images []llm.ContentPart, rules config.ValidationConfig) (string, error) {
+	currentQuestion := question
+	for attempt := 0; ; attempt++ {
+		messages := []llm.Message{llm.NewUserMessage(currentQuestion, images...)}
+		answer, err := provider.Chat(ctx, messages)
+		if err != nil {
+			return "", fmt.Errorf("error asking question: %w", err)
+		}
+
+		if !rules.Enabled() {
+			return answer, nil
+		}
+
+		validationErr := prompt.Validate(rules, answer)
+		if validationErr == nil {
+			return answer, nil
+		}
+		if attempt >= rules.MaxRetries() {
+			return "", fmt.Errorf("answer failed validation after %d attempts: %w", attempt+1, validationErr)
+		}
 
-		return fmt.Errorf("error asking question: %w", err)
+		fmt.Fprintf(os.Stderr, "Answer failed validation, retrying: %v\n", validationErr)
+		currentQuestion = prompt.RetryQuestion(question, answer, validationErr)
 	}
+}
 
-	// Print a newline at the end of the response
-	fmt.Println()
-	return nil
+// loadImages loads the images to attach to the question
+func loadImages(paths []string) ([]llm.ContentPart, error) {
+	var images []llm.ContentPart
+	for _, path := range paths {
+		image, err := llm.LoadImage(config.ExpandPath(path))
+		if err != nil {
+			return nil, err
+		}
+		images = append(images, image)
+	}
+	return images, nil
+}
+
+// loadHook loads the hook script from the configuration, if one is configured
+func loadHook(cfg *config.Config) (*script.Hook, error) {
+	if cfg.Script == "" {
+		return nil, nil
+	}
+
+	return script.Load(config.ExpandPath(cfg.Script))
+}
+
+// streamFlushMode decides how streamed output is flushed. Terminals get every
+// chunk immediately, while pipes get whole sentences or lines.
+func streamFlushMode() output.FlushMode {
+	if CLI.LineBuffered {
+		return output.FlushLine
+	}
+
+	if isTerminal(stdoutStat) {
+		return output.FlushChunk
+	}
+
+	return output.FlushSentence
 }
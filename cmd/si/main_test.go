@@ -3,15 +3,21 @@ package main
 import (
 	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"net/http"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/Turee/si/pkg/config"
 	"github.com/Turee/si/pkg/llm"
+	"github.com/Turee/si/pkg/logging"
+	"github.com/Turee/si/pkg/output"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -78,7 +84,8 @@ func TestHelpFlag(t *testing.T) {
 	assert.Contains(t, outputStr, "Usage: si")
 	assert.Contains(t, outputStr, "--help")
 	assert.Contains(t, outputStr, "--version")
-	assert.Contains(t, outputStr, "Question to ask the LLM")
+	assert.Contains(t, outputStr, "Ask the LLM a question")
+	assert.Contains(t, outputStr, "explain-config")
 }
 
 // MockProvider is a mock implementation of the llm.Provider interface for testing
@@ -88,6 +95,7 @@ type MockProvider struct {
 	AskError        error
 	AskStreamError  error
 	QuestionAsked   string
+	MessagesSent    []llm.Message
 }
 
 // Ask implements the Provider interface
@@ -117,6 +125,18 @@ func (m *MockProvider) AskStream(ctx context.Context, question string, callback
 	return nil
 }
 
+// Chat implements the Provider interface
+func (m *MockProvider) Chat(ctx context.Context, messages []llm.Message) (string, error) {
+	m.MessagesSent = messages
+	return m.Ask(ctx, messages[len(messages)-1].Text())
+}
+
+// ChatStream implements the Provider interface
+func (m *MockProvider) ChatStream(ctx context.Context, messages []llm.Message, callback func(chunk string) error) error {
+	m.MessagesSent = messages
+	return m.AskStream(ctx, messages[len(messages)-1].Text(), callback)
+}
+
 // MockNewProvider returns a mock provider for testing
 func MockNewProvider(cfg *config.Config) (llm.Provider, error) {
 	return &MockProvider{
@@ -298,13 +318,13 @@ func TestConfigNotFound(t *testing.T) {
 	nonExistentConfig := filepath.Join(tempDir, "non-existent-config.yaml")
 	os.Args = []string{"si", "--config", nonExistentConfig, "test", "question"}
 
-	// Capture stdout
-	oldStdout := os.Stdout
+	// Capture stderr, where diagnostics go
+	oldStderr := os.Stderr
 	r, w, _ := os.Pipe()
-	os.Stdout = w
+	os.Stderr = w
 
 	// Reset after test
-	defer func() { os.Stdout = oldStdout }()
+	defer func() { os.Stderr = oldStderr }()
 
 	// Call main with exit handling
 	exitCalled := false
@@ -333,7 +353,7 @@ func TestConfigNotFound(t *testing.T) {
 
 	// Check output and exit behavior
 	assert.True(t, exitCalled, "os.Exit should have been called")
-	assert.Equal(t, 1, exitCode, "Exit code should be 1")
+	assert.Equal(t, exitConfig, exitCode, "Exit code should be the one of configuration errors")
 	assert.Contains(t, buf.String(), "Error loading configuration")
 	assert.Contains(t, buf.String(), "failed to read config file")
 }
@@ -362,13 +382,13 @@ func TestInvalidConfig(t *testing.T) {
 	// Set up test args
 	os.Args = []string{"si", "--config", configPath, "test", "question"}
 
-	// Capture stdout
-	oldStdout := os.Stdout
+	// Capture stderr, where diagnostics go
+	oldStderr := os.Stderr
 	r, w, _ := os.Pipe()
-	os.Stdout = w
+	os.Stderr = w
 
 	// Reset after test
-	defer func() { os.Stdout = oldStdout }()
+	defer func() { os.Stderr = oldStderr }()
 
 	// Call main with exit handling
 	exitCalled := false
@@ -397,7 +417,7 @@ func TestInvalidConfig(t *testing.T) {
 
 	// Check output and exit behavior
 	assert.True(t, exitCalled, "os.Exit should have been called")
-	assert.Equal(t, 1, exitCode, "Exit code should be 1")
+	assert.Equal(t, exitConfig, exitCode, "Exit code should be the one of configuration errors")
 	assert.Contains(t, buf.String(), "Invalid configuration")
 }
 
@@ -549,3 +569,638 @@ func TestQuestionHandlingNoStream(t *testing.T) {
 	assert.Equal(t, "what is the capital of France?", mockProvider.QuestionAsked)
 	assert.Contains(t, buf.String(), "Paris is the capital of France.")
 }
+
+// TestQuestionHandlingWithPrompt tests rendering a named prompt template from the config
+func TestQuestionHandlingWithPrompt(t *testing.T) {
+	// Save original CLI.Prompt and restore after test
+	oldPrompt := CLI.Prompt
+	defer func() { CLI.Prompt = oldPrompt }()
+
+	CLI.Prompt = "summarize"
+
+	// Create a mock config with a prompt template
+	cfg := &config.Config{
+		LLM: config.LLMConfig{
+			OpenAI: config.OpenAIConfig{
+				APIKey: "test-api-key",
+			},
+		},
+		Prompts: map[string]config.PromptConfig{
+			"summarize": {Template: "Summarize this {{.Args}}:\n{{.Input}}"},
+		},
+	}
+
+	// Save original NewProvider and restore after test
+	oldNewProvider := llm.NewProvider
+	defer func() {
+		llm.NewProvider = oldNewProvider
+	}()
+
+	mockProvider := &MockProvider{
+		AskResponse: "A short summary.",
+	}
+	llm.NewProvider = func(cfg *config.Config) (llm.Provider, error) {
+		return mockProvider, nil
+	}
+
+	// Capture stdout
+	oldStdout := os.Stdout
+	r, w, _ := os.Pipe()
+	os.Stdout = w
+	defer func() { os.Stdout = oldStdout }()
+
+	err := handleQuestion(cfg, []string{"in", "one", "sentence"}, "file contents")
+	w.Close()
+
+	var buf bytes.Buffer
+	_, err2 := buf.ReadFrom(r)
+	require.NoError(t, err2)
+
+	// Verify the template was rendered with the arguments and stdin
+	require.NoError(t, err)
+	assert.Equal(t, "Summarize this in one sentence:\nfile contents", mockProvider.QuestionAsked)
+	assert.Contains(t, buf.String(), "A short summary.")
+
+	// Unknown prompt names are reported
+	CLI.Prompt = "translate"
+	err = handleQuestion(cfg, nil, "file contents")
+	assert.ErrorContains(t, err, "unknown prompt \"translate\"")
+}
+
+// TestStdinDelimiter tests splitting piped input into separate attachments
+func TestStdinDelimiter(t *testing.T) {
+	oldPrompt, oldDelim := CLI.Prompt, CLI.StdinDelim
+	defer func() { CLI.Prompt, CLI.StdinDelim = oldPrompt, oldDelim }()
+	cfg := &config.Config{Prompts: map[string]config.PromptConfig{
+		"second": {Template: "{{index .Inputs 1}}"},
+	}}
+
+	CLI.StdinDelim = "---"
+	question, err := buildQuestion(cfg, []string{"compare", "these"}, "package a\n---\npackage b\n")
+	require.NoError(t, err)
+	assert.Equal(t, "compare these\n\nContext:\nAttachment 1 of 2:\npackage a\n\nAttachment 2 of 2:\npackage b", question)
+
+	// A single segment is attached as is
+	question, err = buildQuestion(cfg, []string{"explain"}, "package a\n")
+	require.NoError(t, err)
+	assert.Equal(t, "explain\n\nContext:\npackage a\n", question)
+
+	// Templates get the segments as .Inputs
+	CLI.StdinDelim, CLI.Prompt = `\0`, "second"
+	question, err = buildQuestion(cfg, nil, "a.go\x00b.go\x00")
+	require.NoError(t, err)
+	assert.Equal(t, "b.go", question)
+}
+
+// TestModelFlag tests that the --model flag overrides the model from the config
+func TestModelFlag(t *testing.T) {
+	// Save original os.Args and restore after test
+	oldArgs := os.Args
+	defer func() { os.Args = oldArgs }()
+
+	os.Args = []string{"si", "--model", "gpt-4o-mini", "test", "question"}
+	defer func() { CLI.Model = "" }()
+
+	// Mock the configuration loading
+	oldLoadConfig := loadConfigFunc
+	defer func() { loadConfigFunc = oldLoadConfig }()
+	loadConfigFunc = func(path string) (*config.Config, error) {
+		return &config.Config{
+			LLM: config.LLMConfig{
+				OpenAI: config.OpenAIConfig{
+					APIKey:    "test-api-key",
+					ModelName: "gpt-4",
+				},
+			},
+		}, nil
+	}
+
+	// Capture the model the provider is created with
+	var usedModel string
+	oldNewProvider := llm.NewProvider
+	defer func() { llm.NewProvider = oldNewProvider }()
+	llm.NewProvider = func(cfg *config.Config) (llm.Provider, error) {
+		usedModel = cfg.LLM.OpenAI.ModelName
+		return &MockProvider{AskResponse: "ok"}, nil
+	}
+
+	// Make sure stdin is not treated as piped input
+	oldStdinStat := stdinStat
+	defer func() { stdinStat = oldStdinStat }()
+	stdinStat = func() (os.FileInfo, error) {
+		return mockFileInfo{mode: os.ModeCharDevice}, nil
+	}
+
+	// Capture stdout
+	oldStdout := os.Stdout
+	r, w, _ := os.Pipe()
+	os.Stdout = w
+	defer func() { os.Stdout = oldStdout }()
+
+	main()
+	w.Close()
+
+	var buf bytes.Buffer
+	_, err := buf.ReadFrom(r)
+	require.NoError(t, err)
+
+	assert.Equal(t, "gpt-4o-mini", usedModel)
+	assert.Contains(t, buf.String(), "ok")
+}
+
+// TestStreamFlushMode tests choosing how streamed output is flushed
+func TestStreamFlushMode(t *testing.T) {
+	oldStdoutStat := stdoutStat
+	oldLineBuffered := CLI.LineBuffered
+	defer func() {
+		stdoutStat = oldStdoutStat
+		CLI.LineBuffered = oldLineBuffered
+	}()
+
+	// Terminals get every chunk immediately
+	stdoutStat = func() (os.FileInfo, error) {
+		return mockFileInfo{mode: os.ModeCharDevice}, nil
+	}
+	assert.Equal(t, output.FlushChunk, streamFlushMode())
+
+	// Pipes get whole sentences or lines
+	stdoutStat = func() (os.FileInfo, error) {
+		return mockFileInfo{mode: 0}, nil
+	}
+	assert.Equal(t, output.FlushSentence, streamFlushMode())
+
+	// --line-buffered always waits for complete lines
+	CLI.LineBuffered = true
+	assert.Equal(t, output.FlushLine, streamFlushMode())
+}
+
+// TestQuestionHandlingWithHookScript tests that a configured hook script can modify the response
+func TestQuestionHandlingWithHookScript(t *testing.T) {
+	scriptPath := filepath.Join(t.TempDir(), "hook.star")
+	err := os.WriteFile(scriptPath, []byte(`
+def on_response(response):
+    return "[hooked] " + response
+`), 0644)
+	require.NoError(t, err)
+
+	cfg := &config.Config{
+		LLM: config.LLMConfig{
+			OpenAI: config.OpenAIConfig{
+				APIKey: "test-api-key",
+			},
+		},
+		Script: scriptPath,
+	}
+
+	// Save original NewProvider and restore after test
+	oldNewProvider := llm.NewProvider
+	defer func() {
+		llm.NewProvider = oldNewProvider
+	}()
+
+	mockProvider := &MockProvider{
+		AskResponse: "Paris",
+	}
+	llm.NewProvider = func(cfg *config.Config) (llm.Provider, error) {
+		return mockProvider, nil
+	}
+
+	// Capture stdout
+	oldStdout := os.Stdout
+	r, w, _ := os.Pipe()
+	os.Stdout = w
+	defer func() { os.Stdout = oldStdout }()
+
+	err = handleQuestion(cfg, []string{"capital", "of", "France?"}, "")
+	w.Close()
+
+	var buf bytes.Buffer
+	_, err2 := buf.ReadFrom(r)
+	require.NoError(t, err2)
+
+	require.NoError(t, err)
+	assert.Equal(t, "[hooked] Paris\n", buf.String())
+}
+
+// sequenceProvider returns a different answer for every question asked
+type sequenceProvider struct {
+	answers   []string
+	questions []string
+}
+
+func (s *sequenceProvider) Ask(ctx context.Context, question string) (string, error) {
+	s.questions = append(s.questions, question)
+	answer := s.answers[0]
+	if len(s.answers) > 1 {
+		s.answers = s.answers[1:]
+	}
+	return answer, nil
+}
+
+func (s *sequenceProvider) AskStream(ctx context.Context, question string, callback func(chunk string) error) error {
+	answer, err := s.Ask(ctx, question)
+	if err != nil {
+		return err
+	}
+	return callback(answer)
+}
+
+func (s *sequenceProvider) Chat(ctx context.Context, messages []llm.Message) (string, error) {
+	return s.Ask(ctx, messages[len(messages)-1].Text())
+}
+
+func (s *sequenceProvider) ChatStream(ctx context.Context, messages []llm.Message, callback func(chunk string) error) error {
+	return s.AskStream(ctx, messages[len(messages)-1].Text(), callback)
+}
+
+// TestAskValidated tests re-prompting when the answer violates the validation rules
+func TestAskValidated(t *testing.T) {
+	provider := &sequenceProvider{answers: []string{"Sure, here it is", `{"name": "si"}`}}
+	rules := config.ValidationConfig{JSON: true}
+
+	answer, err := askValidated(context.Background(), provider, "Give me JSON", nil, rules)
+	require.NoError(t, err)
+	assert.Equal(t, `{"name": "si"}`, answer)
+	require.Len(t, provider.questions, 2)
+	assert.Contains(t, provider.questions[1], "It was rejected because:\nthe answer must be valid JSON")
+
+	// Retries are limited
+	retries := 1
+	rules.Retries = &retries
+	provider = &sequenceProvider{answers: []string{"not json"}}
+	_, err = askValidated(context.Background(), provider, "Give me JSON", nil, rules)
+	assert.ErrorContains(t, err, "answer failed validation after 2 attempts")
+	assert.Len(t, provider.questions, 2)
+}
+
+// TestQuestionHandlingWithImage tests attaching images with --image
+func TestQuestionHandlingWithImage(t *testing.T) {
+	cfg := &config.Config{
+		LLM: config.LLMConfig{
+			OpenAI: config.OpenAIConfig{
+				APIKey: "test-api-key",
+			},
+		},
+	}
+
+	// A minimal PNG header is enough for content type detection
+	imagePath := filepath.Join(t.TempDir(), "screenshot.png")
+	require.NoError(t, os.WriteFile(imagePath, []byte("\x89PNG\r\n\x1a\n0000"), 0644))
+
+	CLI.Image = []string{imagePath}
+	CLI.NoStream = true
+	defer func() {
+		CLI.Image = nil
+		CLI.NoStream = false
+	}()
+
+	oldNewProvider := llm.NewProvider
+	defer func() { llm.NewProvider = oldNewProvider }()
+	mockProvider := &MockProvider{AskResponse: "A broken layout."}
+	llm.NewProvider = func(cfg *config.Config) (llm.Provider, error) {
+		return mockProvider, nil
+	}
+
+	// Capture stdout
+	oldStdout := os.Stdout
+	r, w, _ := os.Pipe()
+	os.Stdout = w
+	defer func() { os.Stdout = oldStdout }()
+
+	err := handleQuestion(cfg, []string{"what's", "wrong", "here?"}, "")
+	w.Close()
+
+	var buf bytes.Buffer
+	_, err2 := buf.ReadFrom(r)
+	require.NoError(t, err2)
+
+	require.NoError(t, err)
+	assert.Contains(t, buf.String(), "A broken layout.")
+	require.Len(t, mockProvider.MessagesSent, 1)
+	parts := mockProvider.MessagesSent[0].Parts
+	require.Len(t, parts, 2)
+	assert.Equal(t, "what's wrong here?", parts[0].Text)
+	assert.Equal(t, "image_url", parts[1].Type)
+	assert.True(t, strings.HasPrefix(parts[1].ImageURL.URL, "data:image/png;base64,"))
+
+	// Files that are not images are rejected
+	textPath := filepath.Join(t.TempDir(), "notes.txt")
+	require.NoError(t, os.WriteFile(textPath, []byte("just text"), 0644))
+	CLI.Image = []string{textPath}
+	err = handleQuestion(cfg, []string{"what's", "this?"}, "")
+	assert.ErrorContains(t, err, "is not an image")
+}
+
+// TestDiagnosticsGoToStderr tests that stdout only ever carries the answer
+func TestDiagnosticsGoToStderr(t *testing.T) {
+	provider := mockCommandEnvironment(t, "", false, "")
+	provider.AskStreamError = fmt.Errorf("connection refused")
+
+	stdout, stderr := runMainOutput(t, "test", "question")
+	assert.Empty(t, stdout)
+	assert.Contains(t, stderr, "Error: error asking question: connection refused")
+
+	// Configuration problems are diagnostics as well
+	loadConfigFunc = func(path string) (*config.Config, error) {
+		return nil, fmt.Errorf("failed to read config file: %w", os.ErrNotExist)
+	}
+	stdout, stderr = runMainOutput(t, "test", "question")
+	assert.Empty(t, stdout)
+	assert.Contains(t, stderr, "Error loading configuration")
+
+	// The usage shown without a question is not an answer either
+	stdout, stderr = runMainOutput(t)
+	assert.Empty(t, stdout)
+	assert.Contains(t, stderr, "Usage: si")
+}
+
+// interruptProvider streams the first chunk and is then interrupted
+type interruptProvider struct {
+	*MockProvider
+	interrupt context.CancelFunc
+}
+
+func (p *interruptProvider) ChatStream(ctx context.Context, messages []llm.Message, callback func(chunk string) error) error {
+	if err := callback("The capital "); err != nil {
+		return err
+	}
+	p.interrupt()
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+// TestInterrupt tests that Ctrl+C flushes the partial answer and exits quietly
+func TestInterrupt(t *testing.T) {
+	mockCommandEnvironment(t, "", false, "")
+	mockUsagePath(t)
+
+	provider := &interruptProvider{MockProvider: &MockProvider{}}
+	llm.NewProvider = func(cfg *config.Config) (llm.Provider, error) {
+		return provider, nil
+	}
+
+	oldNotifyInterrupt := notifyInterrupt
+	defer func() { notifyInterrupt = oldNotifyInterrupt }()
+	notifyInterrupt = func(parent context.Context) (context.Context, context.CancelFunc) {
+		ctx, cancel := context.WithCancel(parent)
+		provider.interrupt = cancel
+		return ctx, cancel
+	}
+
+	output, stderr := runMainOutput(t, "capital", "of", "France?")
+	assert.Equal(t, "The capital \n", output)
+	assert.NotContains(t, stderr, "Error")
+
+	assert.Equal(t, exitInterrupted, exitCode(fmt.Errorf("error asking question: %w", context.Canceled)))
+	assert.Equal(t, 1, exitCode(errors.New("connection refused")))
+}
+
+// TestProfileFlag tests that --profile and SI_PROFILE select a profile of the
+// config, and that --model still overrides its model
+func TestProfileFlag(t *testing.T) {
+	defer func() { CLI.Profile, CLI.Model = "", "" }()
+
+	oldLoadConfig := loadConfigFunc
+	defer func() { loadConfigFunc = oldLoadConfig }()
+	loadConfigFunc = func(path string) (*config.Config, error) {
+		return &config.Config{
+			LLM: config.LLMConfig{OpenAI: config.OpenAIConfig{APIKey: "sk-personal", ModelName: "gpt-4o"}},
+			Profiles: map[string]config.ProfileConfig{
+				"work": {LLM: config.LLMConfig{OpenAI: config.OpenAIConfig{APIKey: "sk-work", ModelName: "gpt-4.1"}}},
+			},
+		}, nil
+	}
+
+	var used config.OpenAIConfig
+	oldNewProvider := llm.NewProvider
+	defer func() { llm.NewProvider = oldNewProvider }()
+	llm.NewProvider = func(cfg *config.Config) (llm.Provider, error) {
+		used = cfg.LLM.OpenAI
+		return &MockProvider{AskResponse: "ok"}, nil
+	}
+
+	oldStdinStat := stdinStat
+	defer func() { stdinStat = oldStdinStat }()
+	stdinStat = func() (os.FileInfo, error) {
+		return mockFileInfo{mode: os.ModeCharDevice}, nil
+	}
+
+	output := runMain(t, "--profile", "work", "test", "question")
+	assert.Contains(t, output, "ok")
+	assert.Equal(t, "sk-work", used.APIKey)
+	assert.Equal(t, "gpt-4.1", used.ModelName)
+
+	CLI.Profile = ""
+	t.Setenv("SI_PROFILE", "work")
+	runMain(t, "--model", "gpt-4o-mini", "test", "question")
+	assert.Equal(t, "sk-work", used.APIKey)
+	assert.Equal(t, "gpt-4o-mini", used.ModelName)
+
+	CLI.Profile, CLI.Model = "", ""
+	_, stderr := runMainOutput(t, "--profile", "azure", "test", "question")
+	assert.Contains(t, stderr, `Invalid configuration: unknown profile "azure" (available: work)`)
+}
+
+// TestProviderFlag tests that --provider and llm.provider select a named
+// provider, whose endpoint and key replace those of llm.openai
+func TestProviderFlag(t *testing.T) {
+	defer func() { CLI.Provider, CLI.Model = "", "" }()
+
+	oldLoadConfig := loadConfigFunc
+	defer func() { loadConfigFunc = oldLoadConfig }()
+	defaultProvider := ""
+	loadConfigFunc = func(path string) (*config.Config, error) {
+		return &config.Config{
+			LLM: config.LLMConfig{
+				OpenAI:   config.OpenAIConfig{APIKey: "sk-openai", ModelName: "gpt-4o"},
+				Provider: defaultProvider,
+				Providers: map[string]config.ProviderConfig{
+					"groq":     {OpenAIConfig: config.OpenAIConfig{BaseURL: "https://api.groq.com/openai/v1", APIKey: "gsk-test", ModelName: "llama-3.3-70b-versatile"}},
+					"deepseek": {OpenAIConfig: config.OpenAIConfig{BaseURL: "https://api.deepseek.com", APIKey: "sk-deepseek", ModelName: "deepseek-chat"}},
+				},
+			},
+		}, nil
+	}
+
+	var used config.OpenAIConfig
+	oldNewProvider := llm.NewProvider
+	defer func() { llm.NewProvider = oldNewProvider }()
+	llm.NewProvider = func(cfg *config.Config) (llm.Provider, error) {
+		used = cfg.LLM.OpenAI
+		return &MockProvider{AskResponse: "ok"}, nil
+	}
+
+	oldStdinStat := stdinStat
+	defer func() { stdinStat = oldStdinStat }()
+	stdinStat = func() (os.FileInfo, error) {
+		return mockFileInfo{mode: os.ModeCharDevice}, nil
+	}
+
+	runMain(t, "--provider", "groq", "-m", "llama-3.1-8b-instant", "test", "question")
+	assert.Equal(t, "https://api.groq.com/openai/v1", used.BaseURL)
+	assert.Equal(t, "gsk-test", used.APIKey)
+	assert.Equal(t, "llama-3.1-8b-instant", used.ModelName)
+
+	// llm.provider selects the default, --provider another
+	CLI.Provider, CLI.Model = "", ""
+	defaultProvider = "deepseek"
+	runMain(t, "test", "question")
+	assert.Equal(t, "sk-deepseek", used.APIKey)
+	runMain(t, "--provider", "groq", "test", "question")
+	assert.Equal(t, "gsk-test", used.APIKey)
+
+	CLI.Provider = ""
+	_, stderr := runMainOutput(t, "--provider", "mistral", "test", "question")
+	assert.Contains(t, stderr, `Invalid configuration: unknown provider "mistral" (available: deepseek, groq)`)
+}
+
+// TestDebugFlag tests that --debug and log_level enable the log, and that
+// log_file sends it to a file
+func TestDebugFlag(t *testing.T) {
+	defer func() { CLI.Debug = false }()
+	defer logging.Setup("", nil)
+
+	logFile := filepath.Join(t.TempDir(), "si.log")
+	logLevel := ""
+	oldLoadConfig := loadConfigFunc
+	defer func() { loadConfigFunc = oldLoadConfig }()
+	loadConfigFunc = func(path string) (*config.Config, error) {
+		return &config.Config{
+			LLM:      config.LLMConfig{OpenAI: config.OpenAIConfig{APIKey: "test-api-key"}},
+			LogLevel: logLevel,
+			LogFile:  logFile,
+		}, nil
+	}
+
+	oldNewProvider := llm.NewProvider
+	defer func() { llm.NewProvider = oldNewProvider }()
+	llm.NewProvider = func(cfg *config.Config) (llm.Provider, error) {
+		logging.Logger().Debug("provider created")
+		return &MockProvider{AskResponse: "ok"}, nil
+	}
+
+	oldStdinStat := stdinStat
+	defer func() { stdinStat = oldStdinStat }()
+	stdinStat = func() (os.FileInfo, error) {
+		return mockFileInfo{mode: os.ModeCharDevice}, nil
+	}
+
+	runMain(t, "test", "question")
+	assert.NoFileExists(t, logFile)
+
+	runMain(t, "--debug", "test", "question")
+	data, err := os.ReadFile(logFile)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), "provider created")
+
+	// The config sets the level without --debug
+	CLI.Debug = false
+	logLevel = logging.LevelInfo
+	runMain(t, "test", "question")
+	after, err := os.ReadFile(logFile)
+	require.NoError(t, err)
+	assert.Equal(t, string(data), string(after))
+
+	logLevel = "verbose"
+	_, stderr := runMainOutput(t, "test", "question")
+	assert.Contains(t, stderr, "Invalid configuration: log_level: log level must be debug, info, warn or error")
+}
+
+// TestFallbacks tests answering with the fallbacks when the model is rate
+// limited or unavailable
+func TestFallbacks(t *testing.T) {
+	defer func() { CLI.Output = "text" }()
+
+	oldLoadConfig := loadConfigFunc
+	defer func() { loadConfigFunc = oldLoadConfig }()
+	loadConfigFunc = func(path string) (*config.Config, error) {
+		return &config.Config{
+			LLM: config.LLMConfig{
+				OpenAI: config.OpenAIConfig{APIKey: "sk-openai", ModelName: "gpt-4o"},
+				Providers: map[string]config.ProviderConfig{
+					"ollama": {OpenAIConfig: config.OpenAIConfig{BaseURL: "http://localhost:11434/v1", APIKey: "ollama", ModelName: "llama3.2"}},
+				},
+				Fallbacks: []config.FallbackConfig{{Model: "gpt-4o-mini"}, {Provider: "ollama"}},
+			},
+		}, nil
+	}
+
+	errs := map[string]error{}
+	var asked []string
+	oldNewProvider := llm.NewProvider
+	defer func() { llm.NewProvider = oldNewProvider }()
+	llm.NewProvider = func(cfg *config.Config) (llm.Provider, error) {
+		model := cfg.LLM.OpenAI.ModelName
+		asked = append(asked, model+"@"+cfg.LLM.OpenAI.BaseURL)
+		return &MockProvider{AskResponse: "answer from " + model, AskError: errs[model], AskStreamError: errs[model]}, nil
+	}
+
+	oldStdinStat := stdinStat
+	defer func() { stdinStat = oldStdinStat }()
+	stdinStat = func() (os.FileInfo, error) {
+		return mockFileInfo{mode: os.ModeCharDevice}, nil
+	}
+
+	errs["gpt-4o"] = &llm.APIError{StatusCode: http.StatusTooManyRequests, Body: "rate limited"}
+	errs["gpt-4o-mini"] = &llm.APIError{StatusCode: http.StatusServiceUnavailable, Body: "overloaded"}
+	stdout, stderr := runMainOutput(t, "--output", "json", "test", "question")
+	var response map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(stdout), &response))
+	assert.Equal(t, "answer from llama3.2", response["answer"])
+	assert.Equal(t, "llama3.2", response["model"])
+	assert.Equal(t, []string{"gpt-4o@", "gpt-4o-mini@", "llama3.2@http://localhost:11434/v1"}, asked)
+	assert.Contains(t, stderr, "Warning: gpt-4o failed: error asking question: API request failed with status 429: rate limited, answering with gpt-4o-mini")
+	assert.Contains(t, stderr, "Warning: gpt-4o-mini failed: error asking question: API request failed with status 503: overloaded, answering with llama3.2")
+
+	// Other errors are not passed on to the fallbacks
+	CLI.Output = "text"
+	asked = nil
+	errs["gpt-4o"] = &llm.APIError{StatusCode: http.StatusUnauthorized, Body: "invalid key"}
+	_, stderr = runMainOutput(t, "test", "question")
+	assert.Equal(t, []string{"gpt-4o@"}, asked)
+	assert.Contains(t, stderr, "invalid key")
+	assert.NotContains(t, stderr, "answering with")
+}
+
+// TestEditQuestion tests composing the question in the editor, starting with
+// the piped input
+func TestEditQuestion(t *testing.T) {
+	provider := mockCommandEnvironment(t, "Paris", false, "")
+	mockUsagePath(t)
+	t.Setenv("VISUAL", "fake-editor")
+
+	oldRunEditor, oldStdinRead := runEditor, stdinRead
+	t.Cleanup(func() { runEditor, stdinRead = oldRunEditor, oldStdinRead })
+	var prefilled string
+	runEditor = func(editor, path string) error {
+		content, err := os.ReadFile(path)
+		require.NoError(t, err)
+		prefilled = string(content)
+		return os.WriteFile(path, []byte("What is the capital of France?\n"), 0644)
+	}
+
+	output, _ := runMainOutput(t, "--no-stream", "-e")
+	assert.Equal(t, "Paris\n", output)
+	assert.Empty(t, prefilled)
+	assert.Equal(t, "What is the capital of France?\n", provider.QuestionAsked)
+
+	// Piped input is edited, the arguments stay the question
+	stdinStat = func() (os.FileInfo, error) {
+		return mockFileInfo{mode: 0}, nil
+	}
+	stdinRead = func() ([]byte, error) {
+		return []byte("Paris is the capital of France.\n"), nil
+	}
+	runMainOutput(t, "--no-stream", "--edit", "summarize")
+	assert.Equal(t, "Paris is the capital of France.\n", prefilled)
+	assert.Equal(t, "summarize\n\nContext:\nWhat is the capital of France?\n", provider.QuestionAsked)
+
+	// Nothing is asked when the text is removed
+	provider.QuestionAsked = ""
+	runEditor = func(editor, path string) error {
+		return os.WriteFile(path, []byte("\n"), 0644)
+	}
+	_, stderr := runMainOutput(t, "--no-stream", "-e")
+	assert.Contains(t, stderr, "Error: the question is empty, nothing was asked")
+	assert.Empty(t, provider.QuestionAsked)
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/Turee/si/pkg/config"
+	"github.com/Turee/si/pkg/prompt"
+	"github.com/Turee/si/pkg/rpc"
+	"github.com/Turee/si/pkg/version"
+	"github.com/alecthomas/kong"
+)
+
+// MCPServeCmd runs si as a Model Context Protocol server
+type MCPServeCmd struct{}
+
+// mcpProtocolVersions are the MCP revisions the server speaks, newest first
+var mcpProtocolVersions = []string{"2025-06-18", "2025-03-26", "2024-11-05"}
+
+// mcpAskTool is the name of the tool that asks the configured model
+const mcpAskTool = "ask"
+
+// mcpAskSchema is the input schema of the ask tool
+const mcpAskSchema = `{
+	"type": "object",
+	"properties": {
+		"question": {"type": "string", "description": "The question to ask"},
+		"prompt": {"type": "string", "description": "Name of a prompt template of si to render the question with"},
+		"input": {"type": "string", "description": "Content for the prompt template, like text piped into si"},
+		"model": {"type": "string", "description": "Model to use instead of the configured one"}
+	},
+	"required": ["question"]
+}`
+
+// Run serves MCP requests over stdin and stdout until stdin is closed
+func (c *MCPServeCmd) Run(kongCtx *kong.Context) error {
+	cfg := loadConfiguration(kongCtx)
+	if cfg == nil {
+		return nil
+	}
+
+	s, err := newServer(cfg)
+	if err != nil {
+		return err
+	}
+	return rpc.NewConn(os.Stdin, os.Stdout).Serve(context.Background(), (&mcpServer{server: s}).handle)
+}
+
+// mcpServer answers MCP requests with the ask method of the JSON-RPC server
+// and the prompt templates of the config
+type mcpServer struct {
+	*server
+}
+
+// mcpContent is a text content block of a tool result or prompt message
+type mcpContent struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+// mcpToolResult is the result of tools/call
+type mcpToolResult struct {
+	Content []mcpContent `json:"content"`
+	IsError bool         `json:"isError"`
+}
+
+// mcpPromptArgument describes an argument of a prompt template
+type mcpPromptArgument struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Required    bool   `json:"required"`
+}
+
+// mcpPromptArguments are the arguments of every prompt template
+var mcpPromptArguments = []mcpPromptArgument{
+	{Name: "args", Description: "The question arguments, {{.Args}} in the template"},
+	{Name: "input", Description: "Content piped into si, {{.Input}} in the template"},
+}
+
+// handle dispatches an MCP request to its method
+func (s *mcpServer) handle(ctx context.Context, conn *rpc.Conn, req *rpc.Request) (interface{}, error) {
+	switch req.Method {
+	case "initialize":
+		var params struct {
+			ProtocolVersion string `json:"protocolVersion"`
+		}
+		if err := req.DecodeParams(&params); err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{
+			"protocolVersion": mcpProtocolVersion(params.ProtocolVersion),
+			"capabilities": map[string]interface{}{
+				"tools":   map[string]interface{}{},
+				"prompts": map[string]interface{}{},
+			},
+			"serverInfo": map[string]string{"name": "si", "version": version.Get().Version},
+		}, nil
+
+	case "ping", "notifications/initialized":
+		return map[string]string{}, nil
+
+	case "notifications/cancelled":
+		var params struct {
+			RequestID json.RawMessage `json:"requestId"`
+		}
+		if err := req.DecodeParams(&params); err != nil {
+			return nil, err
+		}
+		conn.Cancel(params.RequestID)
+		return nil, nil
+
+	case "tools/list":
+		return map[string]interface{}{"tools": []map[string]interface{}{{
+			"name":        mcpAskTool,
+			"description": "Ask a question to the language model configured in si, optionally rendered with one of its prompt templates, and return the answer.",
+			"inputSchema": json.RawMessage(mcpAskSchema),
+		}}}, nil
+
+	case "tools/call":
+		var params struct {
+			Name      string `json:"name"`
+			Arguments struct {
+				Question string `json:"question"`
+				Prompt   string `json:"prompt"`
+				Input    string `json:"input"`
+				Model    string `json:"model"`
+			} `json:"arguments"`
+		}
+		if err := req.DecodeParams(&params); err != nil {
+			return nil, err
+		}
+		if params.Name != mcpAskTool {
+			return nil, rpc.Errorf(rpc.CodeInvalidParams, "unknown tool: %s", params.Name)
+		}
+
+		args := params.Arguments
+		question, err := renderQuestion(s.cfg, args.Prompt, args.Question, args.Input)
+		if err == nil {
+			var result *askResult
+			if result, err = s.ask(ctx, askParams{Question: question, Model: args.Model}, nil); err == nil {
+				return mcpToolResult{Content: []mcpContent{{Type: "text", Text: result.Answer}}}, nil
+			}
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		// Failures of the tool are reported to the model, not as protocol errors
+		return mcpToolResult{Content: []mcpContent{{Type: "text", Text: err.Error()}}, IsError: true}, nil
+
+	case "prompts/list":
+		prompts := []map[string]interface{}{}
+		for _, name := range prompt.Names(s.cfg.Prompts) {
+			prompts = append(prompts, map[string]interface{}{
+				"name":        name,
+				"description": fmt.Sprintf("The %q prompt template of si", name),
+				"arguments":   mcpPromptArguments,
+			})
+		}
+		return map[string]interface{}{"prompts": prompts}, nil
+
+	case "prompts/get":
+		var params struct {
+			Name      string            `json:"name"`
+			Arguments map[string]string `json:"arguments"`
+		}
+		if err := req.DecodeParams(&params); err != nil {
+			return nil, err
+		}
+		text, err := renderQuestion(s.cfg, params.Name, params.Arguments["args"], params.Arguments["input"])
+		if err != nil {
+			return nil, rpc.Errorf(rpc.CodeInvalidParams, "%v", err)
+		}
+		return map[string]interface{}{
+			"messages": []map[string]interface{}{{
+				"role":    "user",
+				"content": mcpContent{Type: "text", Text: text},
+			}},
+		}, nil
+	}
+
+	return nil, rpc.Errorf(rpc.CodeMethodNotFound, "method not found: %s", req.Method)
+}
+
+// renderQuestion renders the named prompt template with the question as its
+// arguments, like `si -p name question < input`. Without a template the
+// question is asked as is.
+func renderQuestion(cfg *config.Config, name, question, input string) (string, error) {
+	if name == "" {
+		if input != "" {
+			return fmt.Sprintf("%s\n\nContext:\n%s", question, input), nil
+		}
+		return question, nil
+	}
+
+	return prompt.Lookup(cfg.Prompts, name, prompt.Data{
+		Input:   input,
+		Args:    question,
+		ArgList: strings.Fields(question),
+	})
+}
+
+// mcpProtocolVersion returns the requested protocol version if the server
+// speaks it, or the newest one it does
+func mcpProtocolVersion(requested string) string {
+	for _, v := range mcpProtocolVersions {
+		if v == requested {
+			return v
+		}
+	}
+	return mcpProtocolVersions[0]
+}
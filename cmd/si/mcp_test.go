@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/Turee/si/pkg/config"
+	"github.com/Turee/si/pkg/rpc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// serveMCP sends the requests to an MCP server and returns the responses by
+// their ID
+func serveMCP(t *testing.T, srv *server, requests ...string) map[string]string {
+	t.Helper()
+
+	var out strings.Builder
+	conn := rpc.NewConn(strings.NewReader(strings.Join(requests, "\n")), &out)
+	require.NoError(t, conn.Serve(context.Background(), (&mcpServer{server: srv}).handle))
+
+	responses := make(map[string]string)
+	for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+		var resp struct {
+			ID json.RawMessage `json:"id"`
+		}
+		require.NoError(t, json.Unmarshal([]byte(line), &resp))
+		responses[string(resp.ID)] = line
+	}
+	return responses
+}
+
+// TestMCPServe tests the MCP handshake and the ask tool
+func TestMCPServe(t *testing.T) {
+	provider := &MockProvider{AskResponse: "Paris"}
+	srv := mockServer(t, provider)
+	srv.cfg.Prompts = map[string]config.PromptConfig{"translate": {Template: "Translate to {{.Args}}: {{.Input}}"}}
+
+	responses := serveMCP(t, srv,
+		`{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocolVersion":"2025-03-26","capabilities":{},"clientInfo":{"name":"test"}}}`,
+		`{"jsonrpc":"2.0","method":"notifications/initialized"}`,
+		`{"jsonrpc":"2.0","id":2,"method":"tools/list"}`,
+		`{"jsonrpc":"2.0","id":3,"method":"tools/call","params":{"name":"ask","arguments":{"question":"capital of France?"}}}`,
+		`{"jsonrpc":"2.0","id":4,"method":"tools/call","params":{"name":"delete"}}`,
+	)
+	assert.Len(t, responses, 4)
+	assert.Contains(t, responses["1"], `"protocolVersion":"2025-03-26"`)
+	assert.Contains(t, responses["1"], `"serverInfo":{"name":"si"`)
+	assert.Contains(t, responses["2"], `"name":"ask"`)
+	assert.Contains(t, responses["2"], `"inputSchema":{`)
+	assert.Equal(t, `{"jsonrpc":"2.0","id":3,"result":{"content":[{"type":"text","text":"Paris"}],"isError":false}}`, responses["3"])
+	assert.Contains(t, responses["4"], `"message":"unknown tool: delete"`)
+	assert.Equal(t, "capital of France?", provider.QuestionAsked)
+
+	// Questions can be rendered with prompt templates
+	serveMCP(t, srv, `{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"ask","arguments":{"question":"German","prompt":"translate","input":"hello"}}}`)
+	assert.Equal(t, "Translate to German: hello", provider.QuestionAsked)
+
+	// Failures are reported as tool errors
+	provider.AskError = errors.New("rate limited")
+	responses = serveMCP(t, srv, `{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"ask","arguments":{"question":"hi"}}}`)
+	assert.Equal(t, `{"jsonrpc":"2.0","id":1,"result":{"content":[{"type":"text","text":"rate limited"}],"isError":true}}`, responses["1"])
+}
+
+// TestMCPPrompts tests listing and rendering prompt templates
+func TestMCPPrompts(t *testing.T) {
+	srv := mockServer(t, &MockProvider{})
+	srv.cfg.Prompts = map[string]config.PromptConfig{
+		"translate": {Template: "Translate to {{.Args}}: {{.Input}}"},
+		"explain":   {Template: "Explain {{.Args}}"},
+	}
+
+	responses := serveMCP(t, srv,
+		`{"jsonrpc":"2.0","id":1,"method":"prompts/list"}`,
+		`{"jsonrpc":"2.0","id":2,"method":"prompts/get","params":{"name":"translate","arguments":{"args":"German","input":"hello"}}}`,
+		`{"jsonrpc":"2.0","id":3,"method":"prompts/get","params":{"name":"summarize"}}`,
+	)
+	assert.Regexp(t, `"prompts":\[\{"arguments":.*"name":"explain".*"name":"translate"`, responses["1"])
+	assert.Equal(t, `{"jsonrpc":"2.0","id":2,"result":{"messages":[{"content":{"type":"text","text":"Translate to German: hello"},"role":"user"}]}}`, responses["2"])
+	assert.Contains(t, responses["3"], `unknown prompt \"summarize\" (available: explain, translate)`)
+}
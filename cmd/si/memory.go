@@ -0,0 +1,43 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/Turee/si/pkg/config"
+	"github.com/Turee/si/pkg/prompt"
+	"github.com/Turee/si/pkg/workspace"
+)
+
+// workingDir returns the directory si runs in, it can be replaced in tests
+var workingDir = os.Getwd
+
+// workspaceMemory returns the system prompt part with the instructions of the
+// workspace memory file. Problems with the file are reported, but never keep
+// a request from being made.
+func workspaceMemory(cfg *config.Config) prompt.SystemPart {
+	part := prompt.SystemPart{Name: prompt.PartMemory}
+	if CLI.NoMemory || cfg.Memory.Disabled {
+		return part
+	}
+
+	dir, err := workingDir()
+	if err != nil {
+		return part
+	}
+	memory, err := workspace.LoadMemory(dir, cfg.Memory.SizeLimit())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to read the workspace memory: %v\n", err)
+		return part
+	}
+	if memory == nil {
+		return part
+	}
+
+	if memory.Truncated {
+		fmt.Fprintf(os.Stderr, "Warning: %s is larger than %d bytes, the rest is ignored\n", memory.Path, cfg.Memory.SizeLimit())
+	}
+	part.Source = memory.Path
+	part.Content = "Follow these instructions for the current project:\n" + memory.Content
+	return part
+}
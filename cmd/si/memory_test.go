@@ -0,0 +1,75 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Turee/si/pkg/config"
+	"github.com/Turee/si/pkg/llm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// systemProvider is a mock provider that records its system prompt
+type systemProvider struct {
+	*MockProvider
+	system string
+}
+
+func (p *systemProvider) SetSystemPrompt(prompt string) {
+	p.system = prompt
+}
+
+// mockWorkspace runs commands in a temporary directory with the given memory
+// file content and returns the provider
+func mockWorkspace(t *testing.T, memory string) *systemProvider {
+	mockCommandEnvironment(t, "Done", false, "")
+	mockUsagePath(t)
+
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "SI.md"), []byte(memory), 0644))
+	oldWorkingDir := workingDir
+	t.Cleanup(func() { workingDir = oldWorkingDir })
+	workingDir = func() (string, error) { return dir, nil }
+
+	provider := &systemProvider{MockProvider: &MockProvider{AskResponse: "Done"}}
+	llm.NewProvider = func(cfg *config.Config) (llm.Provider, error) {
+		return provider, nil
+	}
+	return provider
+}
+
+// TestWorkspaceMemory tests adding the memory file to the system prompt
+func TestWorkspaceMemory(t *testing.T) {
+	provider := mockWorkspace(t, "Answer in British English.\n")
+
+	runMain(t, "hello")
+	assert.True(t, strings.HasPrefix(provider.system, llm.DefaultSystemPrompt))
+	assert.True(t, strings.HasSuffix(provider.system, "\nAnswer in British English."))
+
+	// The shell command mode follows the instructions as well
+	provider.system = ""
+	runMain(t, "sh", "list", "files")
+	assert.Contains(t, provider.system, "Answer in British English.")
+
+	defer func() { CLI.NoMemory = false }()
+	runMain(t, "--no-memory", "hello")
+	assert.Equal(t, llm.DefaultSystemPrompt, provider.system)
+}
+
+// TestWorkspaceMemoryLimit tests that large memory files are cut off
+func TestWorkspaceMemoryLimit(t *testing.T) {
+	provider := mockWorkspace(t, strings.Repeat("a", 20)+"b")
+	loadConfigFunc = func(path string) (*config.Config, error) {
+		return &config.Config{
+			LLM:    config.LLMConfig{OpenAI: config.OpenAIConfig{APIKey: "test-api-key"}},
+			Memory: config.MemoryConfig{MaxSize: 20},
+		}, nil
+	}
+
+	_, stderr := runMainOutput(t, "hello")
+	assert.Contains(t, stderr, "is larger than 20 bytes, the rest is ignored")
+	assert.True(t, strings.HasSuffix(provider.system, "\n"+strings.Repeat("a", 20)))
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Turee/si/pkg/config"
+	"github.com/Turee/si/pkg/llm"
+)
+
+// pickModel lets the user choose an available model after the provider
+// rejected the configured one, and offers to save the choice to the config
+// file, as the model of the applied profile and provider. It returns an
+// empty string when no model was picked, e.g. because there is no terminal
+// or the models can't be listed.
+func pickModel(cfg *config.Config, provider llm.Provider) (string, error) {
+	lister, ok := provider.(llm.ModelLister)
+	if !ok {
+		return "", nil
+	}
+
+	term, err := newTerminal()
+	if err != nil {
+		return "", nil
+	}
+	defer term.Close()
+
+	models, err := lister.ListModels(context.Background())
+	if err != nil || len(models) == 0 {
+		return "", nil
+	}
+
+	fmt.Fprintf(term.out, "The model %q is not available. Available models:\n", cfg.LLM.OpenAI.ModelName)
+	model, err := term.pick("Select a model", models)
+	if err != nil || model == "" {
+		return "", err
+	}
+
+	key := cfg.ModelKey()
+	answer, err := term.choose("Save "+model+" as "+key, []string{"yes", "no"}, "no")
+	if err != nil {
+		return "", err
+	}
+	if answer == "yes" {
+		configPath := configFilePath()
+		if err := config.SaveValue(configPath, key, model); err != nil {
+			return "", err
+		}
+		fmt.Fprintf(term.out, "Saved model %s as %s to %s\n", model, key, configPath)
+	}
+
+	return model, nil
+}
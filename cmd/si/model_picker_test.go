@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Turee/si/pkg/config"
+	"github.com/Turee/si/pkg/llm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// modelProvider rejects models that are not in its list of models
+type modelProvider struct {
+	model  string
+	models []string
+}
+
+func (p *modelProvider) Ask(ctx context.Context, question string) (string, error) {
+	for _, model := range p.models {
+		if model == p.model {
+			return "answer from " + model, nil
+		}
+	}
+	return "", &llm.APIError{StatusCode: http.StatusNotFound, Code: "model_not_found"}
+}
+
+func (p *modelProvider) AskStream(ctx context.Context, question string, callback func(chunk string) error) error {
+	answer, err := p.Ask(ctx, question)
+	if err != nil {
+		return err
+	}
+	return callback(answer)
+}
+
+func (p *modelProvider) Chat(ctx context.Context, messages []llm.Message) (string, error) {
+	return p.Ask(ctx, messages[len(messages)-1].Text())
+}
+
+func (p *modelProvider) ChatStream(ctx context.Context, messages []llm.Message, callback func(chunk string) error) error {
+	return p.AskStream(ctx, messages[len(messages)-1].Text(), callback)
+}
+
+func (p *modelProvider) ListModels(ctx context.Context) ([]string, error) {
+	return p.models, nil
+}
+
+// mockModelProvider makes every created provider use the model from the config
+func mockModelProvider(t *testing.T, models ...string) {
+	t.Helper()
+
+	oldNewProvider := llm.NewProvider
+	t.Cleanup(func() { llm.NewProvider = oldNewProvider })
+	llm.NewProvider = func(cfg *config.Config) (llm.Provider, error) {
+		return &modelProvider{model: cfg.LLM.OpenAI.ModelName, models: models}, nil
+	}
+}
+
+// TestModelPicker tests picking and saving a model when the configured one doesn't exist
+func TestModelPicker(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "si.yaml")
+	require.NoError(t, os.WriteFile(configPath, []byte("llm:\n  openai:\n    api_key: test-api-key\n    model_name: gpt-5-typo\n"), 0600))
+
+	mockCommandEnvironment(t, "", true, "2\ny\n")
+	mockModelProvider(t, "gpt-4o", "gpt-4o-mini")
+
+	output := runMain(t, "--config", configPath, "--model", "gpt-5-typo", "hello")
+	assert.Equal(t, "answer from gpt-4o-mini\n", output)
+
+	cfg, err := config.LoadConfig(configPath)
+	require.NoError(t, err)
+	assert.Equal(t, "gpt-4o-mini", cfg.LLM.OpenAI.ModelName)
+}
+
+// TestModelPickerProfile tests that the model is saved to the applied profile
+func TestModelPickerProfile(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "si.yaml")
+	require.NoError(t, os.WriteFile(configPath, []byte("llm:\n  openai:\n    api_key: test-api-key\n    model_name: gpt-4o\nprofiles:\n  work:\n    llm:\n      openai:\n        model_name: gpt-5-typo\n"), 0600))
+
+	mockCommandEnvironment(t, "", true, "2\ny\n")
+	mockModelProvider(t, "gpt-4o", "gpt-4o-mini")
+	loadConfigFunc = config.LoadConfig
+	t.Cleanup(func() { CLI.Profile, CLI.ConfigPath = "", "" })
+
+	output, stderr := runMainOutput(t, "--config", configPath, "--profile", "work", "hello")
+	assert.Equal(t, "answer from gpt-4o-mini\n", output)
+	assert.Contains(t, stderr, "Save gpt-4o-mini as profiles.work.llm.openai.model_name [y]es / [n]o?")
+
+	cfg, err := config.LoadConfig(configPath)
+	require.NoError(t, err)
+	assert.Equal(t, "gpt-4o", cfg.LLM.OpenAI.ModelName)
+	assert.Equal(t, "gpt-4o-mini", cfg.Profiles["work"].LLM.OpenAI.ModelName)
+}
+
+// TestModelPickerCancel tests that the original error is reported when no model is picked
+func TestModelPickerCancel(t *testing.T) {
+	mockCommandEnvironment(t, "", true, "\n")
+	mockModelProvider(t, "gpt-4o")
+
+	output, stderr := runMainOutput(t, "--model", "gpt-5-typo", "hello")
+	assert.Empty(t, output)
+	assert.Contains(t, stderr, "Error: error asking question: API request failed with status 404")
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/Turee/si/pkg/config"
+	"github.com/Turee/si/pkg/llm"
+	"github.com/Turee/si/pkg/tokens"
+	"github.com/alecthomas/kong"
+)
+
+// ModelsCmd lists the models the configured provider offers
+type ModelsCmd struct {
+	JSON bool `name:"json" help:"Print the models as a JSON array"`
+}
+
+// Run queries the provider for its models and prints them with their
+// context windows where known
+func (c *ModelsCmd) Run(kongCtx *kong.Context) error {
+	cfg := loadConfiguration(kongCtx)
+	if cfg == nil {
+		return nil
+	}
+
+	provider, err := llm.NewProvider(cfg)
+	if err != nil {
+		return fmt.Errorf("error creating LLM provider: %w", err)
+	}
+	describer, ok := provider.(llm.ModelDescriber)
+	if !ok {
+		return fmt.Errorf("the configured provider can't list its models")
+	}
+
+	ctx, stop := notifyInterrupt(context.Background())
+	defer stop()
+
+	models, err := describer.DescribeModels(ctx)
+	if err != nil {
+		return fmt.Errorf("error listing models: %w", err)
+	}
+	for i := range models {
+		models[i].ContextWindow = modelContextWindow(cfg, models[i])
+	}
+
+	if c.JSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(models)
+	}
+
+	if len(models) == 0 {
+		fmt.Fprintln(os.Stderr, "The provider lists no models")
+		return nil
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "MODEL\tCONTEXT\tOWNED BY")
+	for _, model := range models {
+		window, ownedBy := "-", "-"
+		if model.ContextWindow > 0 {
+			window = strconv.Itoa(model.ContextWindow)
+		}
+		if model.OwnedBy != "" {
+			ownedBy = model.OwnedBy
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", model.ID, window, ownedBy)
+	}
+	return w.Flush()
+}
+
+// modelContextWindow returns the context window of a listed model: the one
+// the provider reported, the configured one of the configured model, or the
+// one si knows for the model, or zero
+func modelContextWindow(cfg *config.Config, model llm.Model) int {
+	if model.ContextWindow > 0 {
+		return model.ContextWindow
+	}
+	if model.ID == modelName(cfg) && cfg.LLM.OpenAI.ContextWindow > 0 {
+		return cfg.LLM.OpenAI.ContextWindow
+	}
+	return tokens.ContextWindow(model.ID)
+}
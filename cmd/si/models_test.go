@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/Turee/si/pkg/config"
+	"github.com/Turee/si/pkg/llm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// describingProvider is a MockProvider that lists models
+type describingProvider struct {
+	MockProvider
+	models []llm.Model
+}
+
+// DescribeModels implements the ModelDescriber interface
+func (p *describingProvider) DescribeModels(ctx context.Context) ([]llm.Model, error) {
+	return p.models, nil
+}
+
+// TestModels tests listing the models with their context windows
+func TestModels(t *testing.T) {
+	mockCommandEnvironment(t, "", false, "")
+	loadConfigFunc = func(path string) (*config.Config, error) {
+		return &config.Config{LLM: config.LLMConfig{OpenAI: config.OpenAIConfig{
+			APIKey:        "test-api-key",
+			ModelName:     "qwen2.5-coder",
+			ContextWindow: 32768,
+		}}}, nil
+	}
+	provider := &describingProvider{models: []llm.Model{
+		{ID: "gpt-4o", OwnedBy: "system"},
+		{ID: "llama-3.3-70b", ContextWindow: 131072},
+		{ID: "my-finetune"},
+		{ID: "qwen2.5-coder"},
+	}}
+	llm.NewProvider = func(cfg *config.Config) (llm.Provider, error) {
+		return provider, nil
+	}
+
+	output := runMain(t, "models")
+	assert.Equal(t, "MODEL          CONTEXT  OWNED BY\n"+
+		"gpt-4o         128000   system\n"+
+		"llama-3.3-70b  131072   -\n"+
+		"my-finetune    -        -\n"+
+		"qwen2.5-coder  32768    -\n", output)
+
+	var models []llm.Model
+	require.NoError(t, json.Unmarshal([]byte(runMain(t, "models", "--json")), &models))
+	assert.Equal(t, []llm.Model{
+		{ID: "gpt-4o", OwnedBy: "system", ContextWindow: 128000},
+		{ID: "llama-3.3-70b", ContextWindow: 131072},
+		{ID: "my-finetune"},
+		{ID: "qwen2.5-coder", ContextWindow: 32768},
+	}, models)
+}
+
+// TestModelsUnsupported tests providers that can't list their models
+func TestModelsUnsupported(t *testing.T) {
+	mockCommandEnvironment(t, "", false, "")
+
+	_, stderr := runMainOutput(t, "models")
+	assert.Contains(t, stderr, "the configured provider can't list its models")
+}
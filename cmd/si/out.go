@@ -0,0 +1,88 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+
+	"github.com/Turee/si/pkg/output"
+)
+
+// answerFile is the file of --out the answer is copied into while it is
+// printed, nil without --out
+var answerFile *os.File
+
+// openAnswerFile opens the file of --out, creating its directory, and returns
+// a function that closes it. The file is replaced unless --append is given.
+func openAnswerFile() (func(), error) {
+	if CLI.Out == "" {
+		if CLI.Append {
+			return nil, errors.New("--append requires --out")
+		}
+		return func() {}, nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(CLI.Out), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create the directory of --out: %w", err)
+	}
+	flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if CLI.Append {
+		flags = os.O_WRONLY | os.O_CREATE | os.O_APPEND
+	}
+	file, err := os.OpenFile(CLI.Out, flags, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open --out: %w", err)
+	}
+
+	answerFile = file
+	return func() {
+		answerFile = nil
+		file.Close()
+	}, nil
+}
+
+// answerOutput returns where the answer is printed: stdout, and the file of
+// --out if one is open
+func answerOutput() io.Writer {
+	if answerFile == nil {
+		return os.Stdout
+	}
+	return io.MultiWriter(os.Stdout, answerFile)
+}
+
+// stderr is where notices and the debug log are written. While an answer is
+// streamed they wait for the segment of the answer being written, so the two
+// don't end up mixed on a terminal.
+var stderr = &streamStderr{}
+
+// streamStderr writes to os.Stderr through the Exclusive of the stream of the
+// answer, while one is printed
+type streamStderr struct {
+	stream atomic.Pointer[output.StreamWriter]
+}
+
+// Write implements io.Writer
+func (s *streamStderr) Write(p []byte) (n int, err error) {
+	s.exclusive(func() { n, err = os.Stderr.Write(p) })
+	return n, err
+}
+
+// exclusive runs fn while no part of the answer is being written. fn must
+// write to os.Stderr, not to s.
+func (s *streamStderr) exclusive(fn func()) {
+	if stream := s.stream.Load(); stream != nil {
+		stream.Exclusive(fn)
+		return
+	}
+	fn()
+}
+
+// streaming routes the writes through the stream until the returned function
+// is called
+func (s *streamStderr) streaming(stream *output.StreamWriter) func() {
+	s.stream.Store(stream)
+	return func() { s.stream.Store(nil) }
+}
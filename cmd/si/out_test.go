@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Turee/si/pkg/output"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestOutFlag tests writing the answer to a file while printing it
+func TestOutFlag(t *testing.T) {
+	provider := mockCommandEnvironment(t, "", false, "")
+	provider.AskStreamChunks = []string{"The capital ", "is Paris."}
+	mockUsagePath(t)
+	path := filepath.Join(t.TempDir(), "answers", "france.md")
+
+	output, _ := runMainOutput(t, "--out", path, "capital", "of", "France?")
+	assert.Equal(t, "The capital is Paris.\n", output)
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "The capital is Paris.\n", string(data))
+
+	provider.AskResponse = "Berlin"
+	output, _ = runMainOutput(t, "--no-stream", "--out", path, "--append", "capital", "of", "Germany?")
+	assert.Equal(t, "Berlin\n", output)
+	data, err = os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "The capital is Paris.\nBerlin\n", string(data))
+
+	// The file is replaced without --append, and written in the output mode
+	output, _ = runMainOutput(t, "--no-stream", "--output", "json", "--out", path, "capital", "of", "Germany?")
+	data, err = os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, output, string(data))
+	assert.Contains(t, string(data), `"answer":"Berlin"`)
+
+	_, stderr := runMainOutput(t, "--append", "capital", "of", "Germany?")
+	assert.Contains(t, stderr, "Error: --append requires --out")
+}
+
+// TestStderrWaitsForStream tests that notices aren't written while a segment
+// of the streamed answer is
+func TestStderrWaitsForStream(t *testing.T) {
+	r, w, err := os.Pipe()
+	require.NoError(t, err)
+	oldStderr := os.Stderr
+	t.Cleanup(func() { os.Stderr = oldStderr })
+	os.Stderr = w
+
+	stream := output.NewStreamWriter(w, output.FlushLine)
+	reset := stderr.streaming(stream)
+	_, err = stream.WriteString("The capital ")
+	require.NoError(t, err)
+
+	written := make(chan struct{})
+	stream.Exclusive(func() {
+		go func() {
+			fmt.Fprintln(stderr, "Calling read_file")
+			close(written)
+		}()
+		select {
+		case <-written:
+			t.Error("the notice was written while the stream was")
+		case <-time.After(20 * time.Millisecond):
+		}
+	})
+	<-written
+	_, err = stream.WriteString("is Paris.\n")
+	require.NoError(t, err)
+
+	// Without a stream notices are written right away
+	reset()
+	fmt.Fprintln(stderr, "Done")
+	w.Close()
+	combined, err := io.ReadAll(r)
+	require.NoError(t, err)
+	assert.Equal(t, "Calling read_file\nThe capital is Paris.\nDone\n", string(combined))
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/Turee/si/pkg/config"
+	"github.com/Turee/si/pkg/git"
+	"github.com/Turee/si/pkg/llm"
+	"github.com/Turee/si/pkg/prompt"
+	"github.com/alecthomas/kong"
+)
+
+// prTemplates are the paths of pull request templates in a repository, in
+// the order GitHub looks for them
+var prTemplates = []string{
+	".github/pull_request_template.md",
+	".github/PULL_REQUEST_TEMPLATE.md",
+	"pull_request_template.md",
+	"PULL_REQUEST_TEMPLATE.md",
+	"docs/pull_request_template.md",
+	"docs/PULL_REQUEST_TEMPLATE.md",
+}
+
+// For testing purposes, we can override these functions
+var (
+	gitLog           = git.Log
+	gitDefaultBranch = git.DefaultBranch
+	gitRoot          = git.Root
+	ghCreatePR       = createPR
+)
+
+// PRCmd writes the title and description of a pull request for the branch
+type PRCmd struct {
+	Base   string `name:"base" help:"Branch the pull request merges into (default: the branch origin/HEAD points to, or main or master)"`
+	Create bool   `name:"create" help:"Open the pull request with gh pr create instead of printing it"`
+	Draft  bool   `name:"draft" help:"Open the pull request as a draft"`
+}
+
+// pullRequest is the title and description of a pull request as it is
+// printed with --output json
+type pullRequest struct {
+	Title string `json:"title"`
+	Body  string `json:"body"`
+	Base  string `json:"base"`
+}
+
+// Run summarizes the commits and the diff of the branch into a pull request
+// and prints it, or opens it with gh
+func (c *PRCmd) Run(kongCtx *kong.Context) error {
+	ctx, stop := notifyInterrupt(context.Background())
+	defer stop()
+
+	base := c.Base
+	if base == "" {
+		var err error
+		if base, err = gitDefaultBranch(ctx); err != nil {
+			return fmt.Errorf("can't find the branch to merge into, give it with --base: %w", err)
+		}
+	}
+	messages, err := gitLog(ctx, base+"..HEAD")
+	if err != nil {
+		return err
+	}
+	if len(messages) == 0 {
+		return fmt.Errorf("the branch has no commits that aren't on %s", base)
+	}
+	diff, err := gitDiff(ctx, base+"...HEAD")
+	if err != nil {
+		return err
+	}
+
+	cfg := loadConfiguration(kongCtx)
+	if cfg == nil {
+		return nil
+	}
+	redactor, err := newRedactor(cfg)
+	if err != nil {
+		return err
+	}
+	for i, message := range messages {
+		messages[i] = redactor.Redact(message)
+	}
+	diff = redactor.Redact(diff)
+	warnRedacted(redactor)
+	if limit := inputLimit(cfg); limit > 0 && len(diff) > limit {
+		fmt.Fprintf(os.Stderr, "Warning: the diff is longer than the limit of %d tokens, describing the pull request from its start and the commits (see --max-input)\n", limit/4)
+		diff = prompt.Truncate(diff, limit, prompt.TruncateHead).Join("")
+	}
+
+	pr, err := describePR(ctx, cfg, prPrompt(cfg.PR, prTemplate(ctx, cfg.PR), messages, diff))
+	if err != nil {
+		return err
+	}
+	pr.Base = base
+
+	if c.Create {
+		args := []string{"--title", pr.Title, "--body", pr.Body, "--base", strings.TrimPrefix(base, "origin/")}
+		if c.Draft {
+			args = append(args, "--draft")
+		}
+		return ghCreatePR(ctx, args...)
+	}
+	if CLI.Output == outputJSON {
+		return json.NewEncoder(os.Stdout).Encode(pr)
+	}
+	fmt.Printf("%s\n\n%s\n", pr.Title, pr.Body)
+	return nil
+}
+
+// describePR asks the model for the title and description
+func describePR(ctx context.Context, cfg *config.Config, question string) (pullRequest, error) {
+	system, err := systemPrompt(cfg)
+	if err != nil {
+		return pullRequest{}, err
+	}
+	provider, err := llm.NewProvider(cfg)
+	if err != nil {
+		return pullRequest{}, fmt.Errorf("error creating LLM provider: %w", err)
+	}
+	useSystemPrompt(provider, system)
+	var usage usageTracker
+	usage.track(provider)
+
+	answer, err := provider.Ask(ctx, question)
+	usage.save(modelName(cfg))
+	if err != nil {
+		return pullRequest{}, fmt.Errorf("error asking question: %w", err)
+	}
+
+	pr := parsePR(answer)
+	if pr.Title == "" {
+		return pullRequest{}, errors.New("the model did not return a pull request title")
+	}
+	return pr, nil
+}
+
+// prTemplate returns the configured template, or else the pull request
+// template of the repository if it has one
+func prTemplate(ctx context.Context, cfg config.PRConfig) string {
+	if cfg.Template != "" {
+		return cfg.Template
+	}
+
+	root, err := gitRoot(ctx)
+	if err != nil {
+		return ""
+	}
+	for _, name := range prTemplates {
+		if data, err := os.ReadFile(filepath.Join(root, filepath.FromSlash(name))); err == nil {
+			return string(data)
+		}
+	}
+	return ""
+}
+
+// prPrompt builds the prompt asking for a pull request for the commits and
+// the diff of a branch
+func prPrompt(cfg config.PRConfig, template string, messages []string, diff string) string {
+	var b strings.Builder
+
+	b.WriteString("Write the title and description of a pull request for the following commits and changes of a branch.\n\n")
+	b.WriteString("Rules:\n")
+	b.WriteString("- The first line is the title: a summary in the imperative mood of at most 72 characters, without markdown.\n")
+	b.WriteString("- After a blank line follows the description in Markdown, for a reviewer who hasn't seen the changes: what changed and why, and what to check.\n")
+	if strings.TrimSpace(template) != "" {
+		b.WriteString("- The description follows the template below, filling in its sections and replacing its comments and placeholders.\n")
+	} else {
+		b.WriteString("- The description starts with one or two sentences on what the change does and why, followed by a list of the main changes.\n")
+	}
+	b.WriteString("- Don't invent issue numbers, links or test results.\n")
+	b.WriteString("- Respond with only the title and the description, without a code fence.\n")
+	if cfg.Instructions != "" {
+		fmt.Fprintf(&b, "- %s\n", strings.TrimSpace(cfg.Instructions))
+	}
+
+	if strings.TrimSpace(template) != "" {
+		fmt.Fprintf(&b, "\nTemplate:\n%s\n", strings.TrimRight(template, "\n"))
+	}
+	b.WriteString("\nCommits, oldest first:\n")
+	for _, message := range messages {
+		fmt.Fprintf(&b, "---\n%s\n", message)
+	}
+	fmt.Fprintf(&b, "\nDiff:\n%s", diff)
+	return b.String()
+}
+
+// parsePR splits the answer into the title on its first line and the
+// description, removing formatting the model may have added to the title
+func parsePR(answer string) pullRequest {
+	text := cleanCommitMessage(answer)
+	title, body, _ := strings.Cut(text, "\n")
+
+	title = strings.TrimSpace(strings.TrimLeft(title, "# "))
+	if rest, ok := strings.CutPrefix(title, "Title:"); ok {
+		title = strings.TrimSpace(rest)
+	}
+	title = strings.Trim(title, "*`")
+	return pullRequest{Title: title, Body: strings.TrimSpace(body)}
+}
+
+// createPR runs gh pr create with the arguments, passing its output through
+// so the address of the pull request is printed
+func createPR(ctx context.Context, args ...string) error {
+	cmd := exec.CommandContext(ctx, "gh", append([]string{"pr", "create"}, args...)...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	if err := cmd.Run(); err != nil {
+		if errors.Is(err, exec.ErrNotFound) {
+			return errors.New("gh is not installed, see https://cli.github.com")
+		}
+		return fmt.Errorf("gh pr create failed: %w", err)
+	}
+	return nil
+}
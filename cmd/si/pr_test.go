@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Turee/si/pkg/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// mockBranch replaces the git functions used by the pr command with a branch
+// of the commits based on origin/main in a repository at root, and records
+// the arguments of gh pr create
+func mockBranch(t *testing.T, root string, messages ...string) (*string, *[]string) {
+	t.Helper()
+
+	oldLog, oldDefaultBranch, oldRoot, oldCreatePR := gitLog, gitDefaultBranch, gitRoot, ghCreatePR
+	t.Cleanup(func() {
+		gitLog, gitDefaultBranch, gitRoot, ghCreatePR = oldLog, oldDefaultBranch, oldRoot, oldCreatePR
+		CLI.PR = PRCmd{}
+	})
+
+	logRange := new(string)
+	gitLog = func(ctx context.Context, revRange string) ([]string, error) {
+		*logRange = revRange
+		return messages, nil
+	}
+	gitDefaultBranch = func(ctx context.Context) (string, error) {
+		return "origin/main", nil
+	}
+	gitRoot = func(ctx context.Context) (string, error) {
+		return root, nil
+	}
+	created := new([]string)
+	ghCreatePR = func(ctx context.Context, args ...string) error {
+		*created = args
+		return nil
+	}
+	return logRange, created
+}
+
+// TestPR tests describing the branch as a pull request
+func TestPR(t *testing.T) {
+	provider := mockCommandEnvironment(t, "# Title: Add greeting\n\nGreets the user.\n\n- Add `hello`\n", false, "")
+	mockUsagePath(t)
+	diffRef := mockGitDiff(t, "+hello\n")
+	logRange, created := mockBranch(t, t.TempDir(), "Add hello\n\nIt greets.", "Fix typo")
+
+	output := runMain(t, "pr")
+	assert.Equal(t, "Add greeting\n\nGreets the user.\n\n- Add `hello`\n", output)
+	assert.Equal(t, "origin/main..HEAD", *logRange)
+	assert.Equal(t, "origin/main...HEAD", *diffRef)
+	assert.Contains(t, provider.QuestionAsked, "a list of the main changes")
+	assert.Contains(t, provider.QuestionAsked, "Commits, oldest first:\n---\nAdd hello\n\nIt greets.\n---\nFix typo\n\nDiff:\n+hello\n")
+	assert.Nil(t, *created)
+
+	// --create opens the pull request against the base branch
+	runMain(t, "pr", "--create", "--draft", "--base", "upstream/develop")
+	assert.Equal(t, []string{"--title", "Add greeting", "--body", "Greets the user.\n\n- Add `hello`", "--base", "upstream/develop", "--draft"}, *created)
+	assert.Equal(t, "upstream/develop..HEAD", *logRange)
+	runMain(t, "pr", "--create")
+	assert.Equal(t, []string{"--title", "Add greeting", "--body", "Greets the user.\n\n- Add `hello`", "--base", "main"}, *created)
+
+	t.Cleanup(func() { CLI.Output = "text" })
+	output = runMain(t, "--output", "json", "pr")
+	var pr pullRequest
+	require.NoError(t, json.Unmarshal([]byte(output), &pr))
+	assert.Equal(t, pullRequest{Title: "Add greeting", Body: "Greets the user.\n\n- Add `hello`", Base: "origin/main"}, pr)
+}
+
+// TestPRTemplate tests following the template of the repository or of the
+// config
+func TestPRTemplate(t *testing.T) {
+	provider := mockCommandEnvironment(t, "Add greeting\n\n## Summary\nGreets.", false, "")
+	mockUsagePath(t)
+	mockGitDiff(t, "+hello\n")
+	root := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(root, ".github"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(root, ".github", "pull_request_template.md"), []byte("## Summary\n\n## Testing\n"), 0644))
+	mockBranch(t, root, "Add hello")
+
+	runMain(t, "pr")
+	assert.Contains(t, provider.QuestionAsked, "follows the template below")
+	assert.Contains(t, provider.QuestionAsked, "Template:\n## Summary\n\n## Testing\n\nCommits")
+
+	loadConfigFunc = func(path string) (*config.Config, error) {
+		return &config.Config{
+			LLM: config.LLMConfig{OpenAI: config.OpenAIConfig{APIKey: "test-api-key"}},
+			PR:  config.PRConfig{Template: "## Why\n", Instructions: "Mention the ticket."},
+		}, nil
+	}
+	runMain(t, "pr")
+	assert.Contains(t, provider.QuestionAsked, "Template:\n## Why\n\nCommits")
+	assert.Contains(t, provider.QuestionAsked, "- Mention the ticket.\n")
+}
+
+// TestPRErrors tests branches without commits of their own or a base
+func TestPRErrors(t *testing.T) {
+	mockCommandEnvironment(t, "Add greeting", false, "")
+	mockUsagePath(t)
+	mockGitDiff(t, "")
+	mockBranch(t, t.TempDir())
+
+	_, stderr := runMainOutput(t, "pr")
+	assert.Contains(t, stderr, "the branch has no commits that aren't on origin/main")
+
+	mockBranch(t, t.TempDir(), "Add hello")
+	gitDefaultBranch = func(ctx context.Context) (string, error) {
+		return "", errors.New("no default branch found")
+	}
+	_, stderr = runMainOutput(t, "pr")
+	assert.Contains(t, stderr, "can't find the branch to merge into, give it with --base: no default branch found")
+}
+
+// TestParsePR tests splitting answers into title and description
+func TestParsePR(t *testing.T) {
+	assert.Equal(t, pullRequest{Title: "Add greeting", Body: "Body"}, parsePR("```markdown\n**Add greeting**\n\nBody\n```"))
+	assert.Equal(t, pullRequest{Title: "Add greeting"}, parsePR("Add greeting\n"))
+}
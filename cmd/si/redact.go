@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/Turee/si/pkg/config"
+	"github.com/Turee/si/pkg/redact"
+)
+
+// newRedactor creates the redactor of the input with the patterns of the
+// config followed by the built-in ones, or returns nil when redaction is
+// turned off
+func newRedactor(cfg *config.Config) (*redact.Redactor, error) {
+	if CLI.NoRedact || cfg.Redact.Disabled {
+		return nil, nil
+	}
+
+	names := make([]string, 0, len(cfg.Redact.Patterns))
+	for name := range cfg.Redact.Patterns {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var patterns []redact.Pattern
+	for _, name := range names {
+		pattern, err := redact.Compile(name, cfg.Redact.Patterns[name])
+		if err != nil {
+			return nil, err
+		}
+		patterns = append(patterns, pattern)
+	}
+	return redact.New(append(patterns, redact.Builtin...)), nil
+}
+
+// warnRedacted tells on stderr which secrets were replaced in the input
+func warnRedacted(redactor *redact.Redactor) {
+	if count := redactor.Count(); count > 0 {
+		fmt.Fprintf(os.Stderr, "Warning: replaced %d %s (%s) in the input with placeholders, --no-redact sends them as they are\n",
+			count, plural(count, "secret", "secrets"), strings.Join(redactor.Names(), ", "))
+	}
+}
+
+// newScrubber creates the scrubber of personal data in the prompt, or
+// returns nil unless scrubbing is turned on
+func newScrubber(cfg *config.Config) *redact.Redactor {
+	if !CLI.ScrubPII && !cfg.Redact.PII {
+		return nil
+	}
+	return redact.New(redact.PII)
+}
+
+// warnScrubbed tells on stderr which personal data was replaced in the
+// prompt
+func warnScrubbed(scrubber *redact.Redactor) {
+	if count := scrubber.Count(); count > 0 {
+		fmt.Fprintf(os.Stderr, "Scrubbed %d %s (%s) from the prompt\n",
+			count, plural(count, "item", "items"), strings.Join(scrubber.Names(), ", "))
+	}
+}
+
+// plural returns the singular form for a count of one, else the plural form
+func plural(count int, singular, plural string) string {
+	if count == 1 {
+		return singular
+	}
+	return plural
+}
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/Turee/si/pkg/config"
+	"github.com/Turee/si/pkg/llm"
+	"github.com/Turee/si/pkg/prompt"
+	"github.com/alecthomas/kong"
+)
+
+// Severities of review findings, from the most to the least severe
+var severities = []string{"error", "warning", "info"}
+
+// reviewSchema is the JSON Schema of the answer of a review, requested from
+// providers with structured output
+const reviewSchema = `{
+  "type": "object",
+  "properties": {
+    "findings": {
+      "type": "array",
+      "items": {
+        "type": "object",
+        "properties": {
+          "file": {"type": "string"},
+          "line": {"type": "integer"},
+          "severity": {"type": "string", "enum": ["error", "warning", "info"]},
+          "comment": {"type": "string"}
+        },
+        "required": ["file", "line", "severity", "comment"],
+        "additionalProperties": false
+      }
+    }
+  },
+  "required": ["findings"],
+  "additionalProperties": false
+}`
+
+// ReviewCmd reviews the changes of a diff
+type ReviewCmd struct {
+	Range  string `arg:"" optional:"" help:"Revision or range to review, e.g. main...HEAD (default: the staged changes, or the diff piped via stdin)"`
+	FailOn string `name:"fail-on" enum:"none,error,warning,info" default:"none" help:"Exit with an error if there are findings of this severity or a higher one: none, error, warning or info"`
+}
+
+// finding is a problem found in a review
+type finding struct {
+	File     string `json:"file"`
+	Line     int    `json:"line"`
+	Severity string `json:"severity"`
+	Comment  string `json:"comment"`
+}
+
+// Run asks the model to review the diff piped via stdin, the diff of the
+// range or the staged changes, and prints the findings as lines like
+// compiler errors, or as JSON with --output
+func (c *ReviewCmd) Run(kongCtx *kong.Context) error {
+	ctx, stop := notifyInterrupt(context.Background())
+	defer stop()
+
+	diff, err := checkStdin()
+	if err != nil {
+		return err
+	}
+	if diff == "" {
+		if diff, err = c.gitDiff(ctx); err != nil {
+			return err
+		}
+	}
+
+	cfg := loadConfiguration(kongCtx)
+	if cfg == nil {
+		return nil
+	}
+	redactor, err := newRedactor(cfg)
+	if err != nil {
+		return err
+	}
+	diff = redactor.Redact(diff)
+	warnRedacted(redactor)
+	if limit := inputLimit(cfg); limit > 0 && len(diff) > limit {
+		fmt.Fprintf(os.Stderr, "Warning: the diff is longer than the limit of %d tokens, reviewing its start (see --max-input)\n", limit/4)
+		diff = prompt.Truncate(diff, limit, prompt.TruncateHead).Join("")
+	}
+
+	findings, err := review(ctx, cfg, diff)
+	if err != nil {
+		return err
+	}
+	if err := printFindings(findings); err != nil {
+		return err
+	}
+	return c.check(findings)
+}
+
+// gitDiff returns the diff of the range, or the staged changes
+func (c *ReviewCmd) gitDiff(ctx context.Context) (string, error) {
+	if c.Range != "" {
+		diff, err := gitDiff(ctx, c.Range)
+		if err != nil {
+			return "", err
+		}
+		if strings.TrimSpace(diff) == "" {
+			return "", fmt.Errorf("git diff %s shows no changes", c.Range)
+		}
+		return diff, nil
+	}
+
+	diff, err := gitStagedDiff(ctx)
+	if err != nil {
+		return "", err
+	}
+	if strings.TrimSpace(diff) == "" {
+		return "", fmt.Errorf("no staged changes, stage changes with git add, give a range or pipe a diff")
+	}
+	return diff, nil
+}
+
+// check returns an error if there are findings of the --fail-on severity or
+// a more severe one
+func (c *ReviewCmd) check(findings []finding) error {
+	if c.FailOn == "none" {
+		return nil
+	}
+
+	failing := 0
+	for _, f := range findings {
+		if severityRank(f.Severity) <= severityRank(c.FailOn) {
+			failing++
+		}
+	}
+	if failing > 0 {
+		return fmt.Errorf("%d findings of severity %s or higher", failing, c.FailOn)
+	}
+	return nil
+}
+
+// review asks the model for the findings in the diff, re-prompting it while
+// the answer isn't valid JSON
+func review(ctx context.Context, cfg *config.Config, diff string) ([]finding, error) {
+	system, err := systemPrompt(cfg)
+	if err != nil {
+		return nil, err
+	}
+	provider, err := llm.NewProvider(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("error creating LLM provider: %w", err)
+	}
+	useSystemPrompt(provider, system)
+	if structured, ok := provider.(llm.StructuredOutputProvider); ok {
+		structured.SetResponseSchema(json.RawMessage(reviewSchema))
+	}
+	var usage usageTracker
+	usage.track(provider)
+
+	answer, err := askValidated(ctx, provider, reviewPrompt(cfg.Review, diff), nil, config.ValidationConfig{JSON: true})
+	usage.save(modelName(cfg))
+	if err != nil {
+		return nil, err
+	}
+	return parseFindings(answer)
+}
+
+// reviewPrompt builds the prompt asking for a review of the diff
+func reviewPrompt(cfg config.ReviewConfig, diff string) string {
+	var b strings.Builder
+
+	b.WriteString("Review the following changes like an experienced reviewer of a pull request.\n\n")
+	b.WriteString("Rules:\n")
+	b.WriteString("- Report bugs, security problems, missing error handling, race conditions and changes that break callers; skip matters of taste.\n")
+	b.WriteString("- Only comment on the changed lines and what they affect.\n")
+	b.WriteString("- file is the path of the changed file and line the line number in its new version, counted from the hunk headers; use 0 for the whole file.\n")
+	b.WriteString("- severity is error for bugs and security problems, warning for likely problems and info for suggestions.\n")
+	b.WriteString("- comment explains the problem and how to fix it in one or two sentences.\n")
+	b.WriteString(`- Respond with only a JSON object like {"findings": [{"file": "main.go", "line": 12, "severity": "error", "comment": "..."}]}, with an empty list if there is nothing to report.` + "\n")
+	if cfg.Instructions != "" {
+		fmt.Fprintf(&b, "- %s\n", strings.TrimSpace(cfg.Instructions))
+	}
+
+	fmt.Fprintf(&b, "\nDiff:\n%s", diff)
+	return b.String()
+}
+
+// parseFindings decodes the findings of the answer, ordered by severity and
+// position. Unknown severities are taken as info.
+func parseFindings(answer string) ([]finding, error) {
+	var result struct {
+		Findings []finding `json:"findings"`
+	}
+	if err := json.Unmarshal([]byte(prompt.Unfence(answer)), &result); err != nil {
+		return nil, fmt.Errorf("the model did not return findings: %w", err)
+	}
+
+	findings := result.Findings
+	for i := range findings {
+		findings[i].Severity = strings.ToLower(strings.TrimSpace(findings[i].Severity))
+		if severityRank(findings[i].Severity) == len(severities) {
+			findings[i].Severity = "info"
+		}
+	}
+	sort.SliceStable(findings, func(i, j int) bool {
+		a, b := findings[i], findings[j]
+		if a.Severity != b.Severity {
+			return severityRank(a.Severity) < severityRank(b.Severity)
+		}
+		if a.File != b.File {
+			return a.File < b.File
+		}
+		return a.Line < b.Line
+	})
+	if findings == nil {
+		findings = []finding{}
+	}
+	return findings, nil
+}
+
+// severityRank returns the position of the severity in severities, the most
+// severe first
+func severityRank(severity string) int {
+	for i, s := range severities {
+		if s == severity {
+			return i
+		}
+	}
+	return len(severities)
+}
+
+// printFindings prints the findings as FILE:LINE: SEVERITY: COMMENT lines,
+// or as a JSON object or a JSON object per finding with --output
+func printFindings(findings []finding) error {
+	encoder := json.NewEncoder(os.Stdout)
+	switch CLI.Output {
+	case outputJSON:
+		return encoder.Encode(map[string][]finding{"findings": findings})
+	case outputNDJSON:
+		for _, f := range findings {
+			if err := encoder.Encode(f); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if len(findings) == 0 {
+		fmt.Println("No findings.")
+		return nil
+	}
+	for _, f := range findings {
+		location := f.File
+		if f.Line > 0 {
+			location += fmt.Sprintf(":%d", f.Line)
+		}
+		fmt.Printf("%s: %s: %s\n", location, f.Severity, strings.Join(strings.Fields(f.Comment), " "))
+	}
+	return nil
+}
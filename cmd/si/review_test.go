@@ -0,0 +1,85 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/Turee/si/pkg/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// reviewAnswer is an answer of the model with findings of every severity
+const reviewAnswer = "```json\n" + `{"findings": [
+	{"file": "util.go", "line": 3, "severity": "info", "comment": "Consider a shorter name."},
+	{"file": "main.go", "line": 12, "severity": "Error", "comment": "The error of\n Open is ignored."},
+	{"file": "main.go", "line": 0, "severity": "warning", "comment": "The package has no tests."}
+]}` + "\n```"
+
+// TestReviewStaged tests reviewing the staged changes
+func TestReviewStaged(t *testing.T) {
+	provider := mockCommandEnvironment(t, reviewAnswer, false, "")
+	mockUsagePath(t)
+	mockGit(t, "+f, _ := os.Open(name)\n")
+	t.Cleanup(func() { CLI.Review = ReviewCmd{} })
+
+	output := runMain(t, "review")
+	assert.Equal(t, "main.go:12: error: The error of Open is ignored.\nmain.go: warning: The package has no tests.\nutil.go:3: info: Consider a shorter name.\n", output)
+	assert.Contains(t, provider.QuestionAsked, "Diff:\n+f, _ := os.Open(name)\n")
+
+	// --fail-on fails CI on findings of a severity or a higher one
+	_, stderr := runMainOutput(t, "review", "--fail-on", "warning")
+	assert.Contains(t, stderr, "2 findings of severity warning or higher")
+}
+
+// TestReviewRange tests reviewing a range as JSON
+func TestReviewRange(t *testing.T) {
+	provider := mockCommandEnvironment(t, `{"findings": []}`, false, "")
+	mockUsagePath(t)
+	ref := mockGitDiff(t, "+return nil\n")
+	loadConfigFunc = func(path string) (*config.Config, error) {
+		return &config.Config{
+			LLM:    config.LLMConfig{OpenAI: config.OpenAIConfig{APIKey: "test-api-key"}},
+			Review: config.ReviewConfig{Instructions: "Errors must be wrapped."},
+		}, nil
+	}
+	t.Cleanup(func() { CLI.Review, CLI.Output = ReviewCmd{}, "text" })
+
+	output := runMain(t, "--output", "json", "review", "main...HEAD", "--fail-on", "info")
+	var result struct {
+		Findings []finding `json:"findings"`
+	}
+	require.NoError(t, json.Unmarshal([]byte(output), &result))
+	assert.NotNil(t, result.Findings)
+	assert.Empty(t, result.Findings)
+	assert.Equal(t, "main...HEAD", *ref)
+	assert.Contains(t, provider.QuestionAsked, "- Errors must be wrapped.\n")
+}
+
+// TestReviewStdin tests reviewing a piped diff, as a finding per line
+func TestReviewStdin(t *testing.T) {
+	mockCommandEnvironment(t, reviewAnswer, false, "")
+	mockUsagePath(t)
+	mockPipedInput(t, "+x := 1\n")
+	t.Cleanup(func() { CLI.Output = "text" })
+
+	output := runMain(t, "--output", "ndjson", "review")
+	assert.Equal(t, `{"file":"main.go","line":12,"severity":"error","comment":"The error of\n Open is ignored."}
+{"file":"main.go","line":0,"severity":"warning","comment":"The package has no tests."}
+{"file":"util.go","line":3,"severity":"info","comment":"Consider a shorter name."}
+`, output)
+}
+
+// TestReviewErrors tests reviews without changes or findings
+func TestReviewErrors(t *testing.T) {
+	mockCommandEnvironment(t, "Looks good to me!", false, "")
+	mockUsagePath(t)
+	mockGit(t, "")
+
+	_, stderr := runMainOutput(t, "review")
+	assert.Contains(t, stderr, "no staged changes, stage changes with git add, give a range or pipe a diff")
+
+	mockGit(t, "+x := 1\n")
+	_, stderr = runMainOutput(t, "review")
+	assert.Contains(t, stderr, "answer failed validation after 3 attempts: the answer must be valid JSON")
+}
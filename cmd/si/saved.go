@@ -0,0 +1,166 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/Turee/si/pkg/config"
+	"github.com/Turee/si/pkg/prompt"
+	"github.com/alecthomas/kong"
+)
+
+// savedName matches valid names of saved queries, which are keys of the
+// saved section of the config
+var savedName = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// SavedCmd manages saved queries: questions with {{name}} parameters that are
+// filled in when the query is run
+type SavedCmd struct {
+	Add  SavedAddCmd  `cmd:"" help:"Save a query, with {{name}} placeholders for its parameters"`
+	Run  SavedRunCmd  `cmd:"" help:"Run a saved query, asking for the values of its parameters"`
+	List SavedListCmd `cmd:"" help:"List the saved queries"`
+}
+
+// SavedAddCmd saves a query to the config file
+type SavedAddCmd struct {
+	Name  string   `arg:"" help:"Name of the query"`
+	Query []string `arg:"" optional:"" help:"The query, read from stdin if not given"`
+	Force bool     `name:"force" short:"f" help:"Replace a saved query of the same name"`
+}
+
+// Run saves the query under its name
+func (c *SavedAddCmd) Run() error {
+	if !savedName.MatchString(c.Name) {
+		return fmt.Errorf("invalid name %q, use letters, digits, - and _", c.Name)
+	}
+
+	query := strings.Join(c.Query, " ")
+	if query == "" {
+		stdinContent, err := checkStdin()
+		if err != nil {
+			return err
+		}
+		query = strings.TrimSpace(stdinContent)
+	}
+	if query == "" {
+		return fmt.Errorf("no query given, pass it as arguments or via stdin")
+	}
+
+	if cfg, err := loadConfigFunc(CLI.ConfigPath); err == nil && !c.Force {
+		if _, ok := cfg.Saved[c.Name]; ok {
+			return fmt.Errorf("a query named %q is already saved, use --force to replace it", c.Name)
+		}
+	}
+
+	path := configFilePath()
+	if err := config.SaveValue(path, "saved."+c.Name, query); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Saved query %s to %s\n", c.Name, path)
+	if params := prompt.Params(query); len(params) > 0 {
+		fmt.Fprintf(os.Stderr, "Parameters: %s\n", strings.Join(params, ", "))
+	}
+	return nil
+}
+
+// SavedRunCmd asks a saved query
+type SavedRunCmd struct {
+	Name   string   `arg:"" help:"Name of the query"`
+	Values []string `arg:"" optional:"" help:"Values of parameters as name=value; the others are asked for"`
+}
+
+// Run fills in the parameters of the query and asks it like a question
+func (c *SavedRunCmd) Run(kongCtx *kong.Context) error {
+	stdinContent, err := checkStdin()
+	if err != nil {
+		return err
+	}
+
+	cfg := loadConfiguration(kongCtx)
+	if cfg == nil {
+		return nil
+	}
+
+	query, ok := cfg.Saved[c.Name]
+	if !ok {
+		if len(cfg.Saved) == 0 {
+			return fmt.Errorf("unknown saved query %q, no queries are saved", c.Name)
+		}
+		return fmt.Errorf("unknown saved query %q (available: %s)", c.Name, strings.Join(savedNames(cfg), ", "))
+	}
+
+	values, err := c.paramValues(prompt.Params(query))
+	if err != nil {
+		return err
+	}
+	return handleQuestion(cfg, []string{prompt.Fill(query, values)}, stdinContent)
+}
+
+// paramValues returns the values of the parameters, taken from the command
+// line or asked for on the terminal
+func (c *SavedRunCmd) paramValues(params []string) (map[string]string, error) {
+	values := make(map[string]string)
+	for _, arg := range c.Values {
+		name, value, ok := strings.Cut(arg, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid parameter value %q, use name=value", arg)
+		}
+		if !slices.Contains(params, name) {
+			return nil, fmt.Errorf("unknown parameter %q of %s (parameters: %s)", name, c.Name, strings.Join(params, ", "))
+		}
+		values[name] = value
+	}
+
+	var missing []string
+	for _, name := range params {
+		if _, ok := values[name]; !ok {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) == 0 {
+		return values, nil
+	}
+
+	term, err := newTerminal()
+	if err != nil {
+		return nil, fmt.Errorf("missing values of %s, pass them as name=value", strings.Join(missing, ", "))
+	}
+	defer term.Close()
+	for _, name := range missing {
+		answer, err := term.ask(name + ": ")
+		if err != nil {
+			return nil, err
+		}
+		values[name] = answer
+	}
+	return values, nil
+}
+
+// SavedListCmd lists the saved queries
+type SavedListCmd struct{}
+
+// Run prints the name and query of every saved query
+func (c *SavedListCmd) Run() error {
+	cfg, err := loadConfigFunc(CLI.ConfigPath)
+	if err != nil {
+		return fmt.Errorf("error loading configuration: %w", err)
+	}
+	for _, name := range savedNames(cfg) {
+		fmt.Printf("%s\t%s\n", name, strings.ReplaceAll(cfg.Saved[name], "\n", " "))
+	}
+	return nil
+}
+
+// savedNames returns the names of the saved queries, sorted
+func savedNames(cfg *config.Config) []string {
+	names := make([]string, 0, len(cfg.Saved))
+	for name := range cfg.Saved {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
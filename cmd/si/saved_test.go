@@ -0,0 +1,71 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Turee/si/pkg/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// mockSavedEnvironment sets up a config file with an API key and a provider
+// that records the question it is asked
+func mockSavedEnvironment(t *testing.T, terminalAnswers string) (*MockProvider, string) {
+	t.Helper()
+
+	provider := mockCommandEnvironment(t, "Checklist", false, terminalAnswers)
+	loadConfigFunc = config.LoadConfig
+	configPath := filepath.Join(t.TempDir(), "si.yaml")
+	require.NoError(t, os.WriteFile(configPath, []byte("llm:\n  openai:\n    api_key: test-api-key\n"), 0600))
+	t.Cleanup(func() { CLI.ConfigPath = "" })
+	return provider, configPath
+}
+
+// TestSavedQueries tests saving a query and running it with parameters from
+// the command line and the terminal
+func TestSavedQueries(t *testing.T) {
+	provider, configPath := mockSavedEnvironment(t, "production\n")
+
+	_, stderr := runMainOutput(t, "--config", configPath, "saved", "add", "deploy-checklist", "Write a deploy checklist for {{service}} to {{env}}")
+	assert.Contains(t, stderr, "Saved query deploy-checklist to "+configPath)
+	assert.Contains(t, stderr, "Parameters: service, env")
+
+	cfg, err := config.LoadConfig(configPath)
+	require.NoError(t, err)
+	assert.Equal(t, "Write a deploy checklist for {{service}} to {{env}}", cfg.Saved["deploy-checklist"])
+
+	// A query isn't replaced by accident
+	_, stderr = runMainOutput(t, "--config", configPath, "saved", "add", "deploy-checklist", "Something else")
+	assert.Contains(t, stderr, "use --force to replace it")
+
+	output := runMain(t, "--config", configPath, "saved", "list")
+	assert.Equal(t, "deploy-checklist\tWrite a deploy checklist for {{service}} to {{env}}\n", output)
+
+	output, stderr = runMainOutput(t, "--config", configPath, "saved", "run", "deploy-checklist", "service=billing")
+	assert.Equal(t, "Checklist\n", output)
+	assert.Contains(t, stderr, "env: ")
+	assert.Equal(t, "Write a deploy checklist for billing to production", provider.QuestionAsked)
+}
+
+// TestSavedRunErrors tests running saved queries without the values of
+// their parameters
+func TestSavedRunErrors(t *testing.T) {
+	_, configPath := mockSavedEnvironment(t, "")
+	require.NoError(t, config.SaveValue(configPath, "saved.greet", "Greet {{name}}"))
+	openTerminal = func() (io.ReadCloser, error) {
+		return nil, errors.New("no terminal")
+	}
+
+	_, stderr := runMainOutput(t, "--config", configPath, "saved", "run", "greet")
+	assert.Contains(t, stderr, "missing values of name, pass them as name=value")
+
+	_, stderr = runMainOutput(t, "--config", configPath, "saved", "run", "greet", "nme=Ada")
+	assert.Contains(t, stderr, `unknown parameter "nme" of greet (parameters: name)`)
+
+	_, stderr = runMainOutput(t, "--config", configPath, "saved", "run", "welcome")
+	assert.Contains(t, stderr, `unknown saved query "welcome" (available: greet)`)
+}
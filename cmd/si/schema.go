@@ -0,0 +1,35 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/Turee/si/pkg/config"
+	"github.com/Turee/si/pkg/llm"
+	"github.com/Turee/si/pkg/schema"
+)
+
+// loadResponseSchema loads the JSON Schema of the validation rules, so an
+// invalid schema is reported before the question is asked. It returns nil if
+// the rules have no schema.
+func loadResponseSchema(rules config.ValidationConfig) (*schema.Schema, error) {
+	if rules.Schema == "" {
+		return nil, nil
+	}
+	return schema.Load(config.ExpandPath(rules.Schema))
+}
+
+// useResponseSchema requests structured output conforming to the schema.
+// Providers without structured output still get their answers validated.
+func useResponseSchema(provider llm.Provider, s *schema.Schema) {
+	if s == nil {
+		return
+	}
+
+	structured, ok := provider.(llm.StructuredOutputProvider)
+	if !ok {
+		fmt.Fprintln(os.Stderr, "Warning: the provider doesn't support structured output, answers are only validated against the schema")
+		return
+	}
+	structured.SetResponseSchema(s.JSON())
+}
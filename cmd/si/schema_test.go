@@ -0,0 +1,51 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Turee/si/pkg/config"
+	"github.com/Turee/si/pkg/llm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// schemaProvider is a sequenceProvider that supports structured output
+type schemaProvider struct {
+	*sequenceProvider
+	schema json.RawMessage
+}
+
+func (p *schemaProvider) SetResponseSchema(schema json.RawMessage) {
+	p.schema = schema
+}
+
+// TestSchemaFlag tests enforcing a JSON Schema on the answer
+func TestSchemaFlag(t *testing.T) {
+	mockCommandEnvironment(t, "", false, "")
+	mockUsagePath(t)
+	defer func() { CLI.Schema = "" }()
+
+	schemaPath := filepath.Join(t.TempDir(), "person.json")
+	require.NoError(t, os.WriteFile(schemaPath, []byte(`{"type":"object","required":["name"]}`), 0644))
+
+	provider := &schemaProvider{sequenceProvider: &sequenceProvider{answers: []string{`{"nome": "Ada"}`, `{"name": "Ada"}`}}}
+	llm.NewProvider = func(cfg *config.Config) (llm.Provider, error) {
+		return provider, nil
+	}
+
+	output, stderr := runMainOutput(t, "--schema", schemaPath, "extract", "the", "person")
+	assert.Equal(t, "{\"name\": \"Ada\"}\n", output)
+	assert.JSONEq(t, `{"type":"object","required":["name"]}`, string(provider.schema))
+	assert.Contains(t, stderr, `Answer failed validation, retrying: the answer must conform to the JSON schema:`)
+	require.Len(t, provider.questions, 2)
+	assert.Contains(t, provider.questions[1], `/: missing required property "name"`)
+
+	// Invalid schemas are reported before asking
+	require.NoError(t, os.WriteFile(schemaPath, []byte(`{"type":`), 0644))
+	_, stderr = runMainOutput(t, "--schema", schemaPath, "extract", "the", "person")
+	assert.Contains(t, stderr, "invalid schema")
+	assert.Len(t, provider.questions, 2)
+}
@@ -0,0 +1,278 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+
+	"github.com/Turee/si/pkg/config"
+	"github.com/Turee/si/pkg/llm"
+	"github.com/Turee/si/pkg/rpc"
+	"github.com/alecthomas/kong"
+)
+
+// ServeCmd runs si as a backend process for editor plugins, or as a local
+// OpenAI-compatible API for other tools
+type ServeCmd struct {
+	Stdio bool   `name:"stdio" help:"Speak JSON-RPC over stdin and stdout"`
+	HTTP  string `name:"http" placeholder:"ADDR" help:"Serve an OpenAI-compatible API on the address, e.g. localhost:8080"`
+	Token string `name:"token" help:"Bearer token clients of --http have to send"`
+}
+
+// Run serves requests until stdin is closed, or until interrupted with --http
+func (c *ServeCmd) Run(kongCtx *kong.Context) error {
+	if c.Stdio == (c.HTTP != "") {
+		if c.Stdio {
+			return fmt.Errorf("--stdio and --http can't be used together")
+		}
+		return fmt.Errorf("no transport selected, use --stdio or --http ADDR")
+	}
+
+	cfg := loadConfiguration(kongCtx)
+	if cfg == nil {
+		return nil
+	}
+
+	s, err := newServer(cfg)
+	if err != nil {
+		return err
+	}
+	if c.HTTP != "" {
+		return s.serveHTTP(c.HTTP, c.Token)
+	}
+	return rpc.NewConn(os.Stdin, os.Stdout).Serve(context.Background(), s.handle)
+}
+
+// askParams are the parameters of the ask and stream methods
+type askParams struct {
+	Question string `json:"question"`
+
+	// Session continues a conversation created with session/new
+	Session string `json:"session,omitempty"`
+
+	// Model overrides the configured model for a question outside a session
+	Model string `json:"model,omitempty"`
+}
+
+// askResult is the result of the ask and stream methods
+type askResult struct {
+	Answer       string     `json:"answer"`
+	Model        string     `json:"model"`
+	Session      string     `json:"session,omitempty"`
+	ID           string     `json:"id,omitempty"`
+	FinishReason string     `json:"finish_reason,omitempty"`
+	Usage        *llm.Usage `json:"usage"`
+}
+
+// deltaParams are the parameters of the stream/delta notification
+type deltaParams struct {
+	ID      json.RawMessage `json:"id"`
+	Content string          `json:"content"`
+}
+
+// sessionParams are the parameters of session/new and session/close
+type sessionParams struct {
+	Session string `json:"session,omitempty"`
+	Model   string `json:"model,omitempty"`
+	System  string `json:"system,omitempty"`
+}
+
+// sessionInfo describes a session in the result of session/list
+type sessionInfo struct {
+	Session string `json:"session"`
+	Model   string `json:"model"`
+}
+
+// session is a conversation kept by the server. Questions of a session are
+// answered one at a time.
+type session struct {
+	mu           sync.Mutex
+	model        string
+	conversation *llm.Conversation
+}
+
+// server answers the requests of an editor plugin
+type server struct {
+	cfg *config.Config
+
+	// system is the system prompt of questions and sessions that don't
+	// bring their own
+	system string
+
+	mu       sync.Mutex
+	sessions map[string]*session
+}
+
+func newServer(cfg *config.Config) (*server, error) {
+	system, err := systemPrompt(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &server{cfg: cfg, system: system, sessions: make(map[string]*session)}, nil
+}
+
+// handle dispatches a request to its method
+func (s *server) handle(ctx context.Context, conn *rpc.Conn, req *rpc.Request) (interface{}, error) {
+	switch req.Method {
+	case "ask", "stream":
+		var params askParams
+		if err := req.DecodeParams(&params); err != nil {
+			return nil, err
+		}
+		var callback func(chunk string) error
+		if req.Method == "stream" {
+			callback = func(chunk string) error {
+				return conn.Notify("stream/delta", deltaParams{ID: req.ID, Content: chunk})
+			}
+		}
+		return s.ask(ctx, params, callback)
+
+	case "cancel":
+		var params struct {
+			ID json.RawMessage `json:"id"`
+		}
+		if err := req.DecodeParams(&params); err != nil {
+			return nil, err
+		}
+		return map[string]bool{"canceled": conn.Cancel(params.ID)}, nil
+
+	case "session/new":
+		var params sessionParams
+		if err := req.DecodeParams(&params); err != nil {
+			return nil, err
+		}
+		return map[string]string{"session": s.newSession(params.Model, params.System)}, nil
+
+	case "session/list":
+		return map[string][]sessionInfo{"sessions": s.listSessions()}, nil
+
+	case "session/close":
+		var params sessionParams
+		if err := req.DecodeParams(&params); err != nil {
+			return nil, err
+		}
+		if err := s.closeSession(params.Session); err != nil {
+			return nil, err
+		}
+		return map[string]string{}, nil
+	}
+
+	return nil, rpc.Errorf(rpc.CodeMethodNotFound, "method not found: %s", req.Method)
+}
+
+// ask answers a question, streaming the answer to the callback if it is not
+// nil. Questions of a session are answered in the context of the session.
+func (s *server) ask(ctx context.Context, params askParams, callback func(chunk string) error) (*askResult, error) {
+	if params.Question == "" {
+		return nil, rpc.Errorf(rpc.CodeInvalidParams, "question is required")
+	}
+
+	model := params.Model
+	conversation := llm.NewConversation(model, "")
+	if params.Session != "" {
+		sess, err := s.session(params.Session)
+		if err != nil {
+			return nil, err
+		}
+		sess.mu.Lock()
+		defer sess.mu.Unlock()
+		model, conversation = sess.model, sess.conversation
+	}
+
+	// Every request gets its own provider, so usage and metadata can't get
+	// mixed up between concurrent requests
+	cfg := *s.cfg
+	if model != "" {
+		cfg.SetModel(model)
+	}
+	provider, err := llm.NewProvider(&cfg)
+	if err != nil {
+		return nil, fmt.Errorf("error creating LLM provider: %w", err)
+	}
+	useSystemPrompt(provider, s.system)
+	var usage usageTracker
+	usage.track(provider)
+
+	var answer string
+	if callback != nil {
+		answer, err = conversation.SendStream(ctx, provider, params.Question, callback)
+	} else {
+		answer, err = conversation.Send(ctx, provider, params.Question)
+	}
+	usage.save(modelName(&cfg))
+	if err != nil {
+		return nil, err
+	}
+
+	result := &askResult{
+		Answer:       answer,
+		Model:        modelName(&cfg),
+		Session:      params.Session,
+		ID:           usage.metadata.ID,
+		FinishReason: usage.metadata.FinishReason,
+	}
+	if len(usage.requests) > 0 {
+		result.Usage = &usage.usage
+	}
+	return result, nil
+}
+
+// newSession starts a conversation and returns its ID. The history is
+// trimmed to the context window of the model, if it is known.
+func (s *server) newSession(model, system string) string {
+	cfg := *s.cfg
+	if model != "" {
+		cfg.SetModel(model)
+	}
+
+	conversation := llm.NewConversation(modelName(&cfg), system)
+	conversation.MaxTokens = contextWindow(&cfg)
+
+	id := newConversationID()
+	s.mu.Lock()
+	s.sessions[id] = &session{model: model, conversation: conversation}
+	s.mu.Unlock()
+	return id
+}
+
+// session returns the session with the given ID
+func (s *server) session(id string) (*session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sess, ok := s.sessions[id]
+	if !ok {
+		return nil, rpc.Errorf(rpc.CodeInvalidParams, "unknown session %q", id)
+	}
+	return sess, nil
+}
+
+// listSessions describes the open sessions
+func (s *server) listSessions() []sessionInfo {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// The model of a conversation never changes, so it can be read while a
+	// question of the session is being answered
+	sessions := []sessionInfo{}
+	for id, sess := range s.sessions {
+		sessions = append(sessions, sessionInfo{Session: id, Model: sess.conversation.Model})
+	}
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].Session < sessions[j].Session })
+	return sessions
+}
+
+// closeSession forgets a session
+func (s *server) closeSession(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.sessions[id]; !ok {
+		return rpc.Errorf(rpc.CodeInvalidParams, "unknown session %q", id)
+	}
+	delete(s.sessions, id)
+	return nil
+}
@@ -0,0 +1,258 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/Turee/si/pkg/config"
+	"github.com/Turee/si/pkg/llm"
+)
+
+// chatRequest is the part of an OpenAI chat completion request si serves
+type chatRequest struct {
+	Model       string        `json:"model"`
+	Messages    []llm.Message `json:"messages"`
+	Stream      bool          `json:"stream"`
+	Temperature *float64      `json:"temperature"`
+	TopP        *float64      `json:"top_p"`
+	MaxTokens   int           `json:"max_tokens"`
+	Tools       []interface{} `json:"tools"`
+}
+
+// chatChoice is a choice of a chat completion or of a streamed chunk
+type chatChoice struct {
+	Index        int          `json:"index"`
+	Message      *chatMessage `json:"message,omitempty"`
+	Delta        *chatMessage `json:"delta,omitempty"`
+	FinishReason *string      `json:"finish_reason"`
+}
+
+// chatMessage is the answer of a chat completion
+type chatMessage struct {
+	Role    string `json:"role,omitempty"`
+	Content string `json:"content,omitempty"`
+}
+
+// chatCompletion is a chat completion or a streamed chunk of one
+type chatCompletion struct {
+	ID      string       `json:"id"`
+	Object  string       `json:"object"`
+	Created int64        `json:"created"`
+	Model   string       `json:"model"`
+	Choices []chatChoice `json:"choices"`
+	Usage   *llm.Usage   `json:"usage,omitempty"`
+}
+
+// serveHTTP serves the OpenAI-compatible API on the address until si is
+// interrupted, then waits for the running requests to finish
+func (s *server) serveHTTP(addr, token string) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("error listening on %s: %w", addr, err)
+	}
+
+	httpServer := &http.Server{Handler: s.newHTTPHandler(token)}
+	ctx, stop := notifyInterrupt(context.Background())
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		httpServer.Shutdown(context.Background())
+	}()
+
+	fmt.Fprintf(os.Stderr, "Listening on http://%s/v1\n", listener.Addr())
+	if err := httpServer.Serve(listener); err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
+
+// newHTTPHandler returns the OpenAI-compatible API of the server. With a
+// token, requests have to authenticate with it as their bearer token, so the
+// API key of the provider stays hidden from the clients.
+func (s *server) newHTTPHandler(token string) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /v1/chat/completions", s.handleChatCompletions)
+	mux.HandleFunc("GET /v1/models", s.handleModels)
+
+	if token == "" {
+		return mux
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		given := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+			writeHTTPError(w, http.StatusUnauthorized, "invalid_api_key", "invalid API key")
+			return
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
+
+// handleChatCompletions answers a chat completion request with the
+// configured provider, streaming the answer if requested
+func (s *server) handleChatCompletions(w http.ResponseWriter, r *http.Request) {
+	var req chatRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeHTTPError(w, http.StatusBadRequest, "invalid_request_error", "invalid request: "+err.Error())
+		return
+	}
+	if len(req.Messages) == 0 {
+		writeHTTPError(w, http.StatusBadRequest, "invalid_request_error", "messages are required")
+		return
+	}
+	if len(req.Tools) > 0 {
+		writeHTTPError(w, http.StatusBadRequest, "invalid_request_error", "tools are not supported")
+		return
+	}
+
+	// Every request gets its own provider, like the requests of --stdio
+	cfg := *s.cfg
+	if req.Model != "" {
+		cfg.SetModel(req.Model)
+	}
+	cfg.SetSampling(config.SamplingConfig{Temperature: req.Temperature, TopP: req.TopP, MaxTokens: req.MaxTokens})
+	if err := cfg.LLM.OpenAI.SamplingConfig.Validate(); err != nil {
+		writeHTTPError(w, http.StatusBadRequest, "invalid_request_error", err.Error())
+		return
+	}
+
+	provider, err := llm.NewProvider(&cfg)
+	if err != nil {
+		writeHTTPError(w, http.StatusInternalServerError, "server_error", err.Error())
+		return
+	}
+	useSystemPrompt(provider, s.system)
+	var usage usageTracker
+	usage.track(provider)
+	defer func() { usage.save(modelName(&cfg)) }()
+
+	completion := chatCompletion{
+		ID:      "chatcmpl-" + newConversationID(),
+		Created: now().Unix(),
+		Model:   modelName(&cfg),
+	}
+
+	if !req.Stream {
+		answer, err := provider.Chat(r.Context(), req.Messages)
+		if err != nil {
+			writeProviderError(w, err)
+			return
+		}
+
+		completion.Object = "chat.completion"
+		completion.Choices = []chatChoice{{
+			Message:      &chatMessage{Role: llm.RoleAssistant, Content: answer},
+			FinishReason: finishReason(usage.metadata),
+		}}
+		if len(usage.requests) > 0 {
+			completion.Usage = &usage.usage
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(completion)
+		return
+	}
+
+	// Stream the answer as server-sent events. Errors before the first chunk
+	// can still be reported with a status; later ones end the stream with an
+	// error event.
+	completion.Object = "chat.completion.chunk"
+	flusher, _ := w.(http.Flusher)
+	started := false
+	writeEvent := func(payload interface{}) {
+		data, _ := json.Marshal(payload)
+		fmt.Fprintf(w, "data: %s\n\n", data)
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+	start := func() {
+		if !started {
+			started = true
+			w.Header().Set("Content-Type", "text/event-stream")
+			w.Header().Set("Cache-Control", "no-cache")
+		}
+	}
+
+	err = provider.ChatStream(r.Context(), req.Messages, func(chunk string) error {
+		delta := &chatMessage{Content: chunk}
+		if !started {
+			delta.Role = llm.RoleAssistant
+		}
+		start()
+		chunkCompletion := completion
+		chunkCompletion.Choices = []chatChoice{{Delta: delta}}
+		writeEvent(chunkCompletion)
+		return nil
+	})
+	if err != nil {
+		if !started {
+			writeProviderError(w, err)
+			return
+		}
+		writeEvent(map[string]interface{}{"error": map[string]string{"message": err.Error(), "type": "server_error"}})
+		return
+	}
+
+	start()
+	final := completion
+	final.Choices = []chatChoice{{Delta: &chatMessage{}, FinishReason: finishReason(usage.metadata)}}
+	if len(usage.requests) > 0 {
+		final.Usage = &usage.usage
+	}
+	writeEvent(final)
+	fmt.Fprint(w, "data: [DONE]\n\n")
+}
+
+// handleModels lists the configured model, and the models of the provider if
+// it can list them
+func (s *server) handleModels(w http.ResponseWriter, r *http.Request) {
+	models := []string{modelName(s.cfg)}
+	if provider, err := llm.NewProvider(s.cfg); err == nil {
+		if lister, ok := provider.(llm.ModelLister); ok {
+			if listed, err := lister.ListModels(r.Context()); err == nil {
+				models = listed
+			}
+		}
+	}
+
+	data := make([]map[string]string, len(models))
+	for i, model := range models {
+		data[i] = map[string]string{"id": model, "object": "model", "owned_by": "si"}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"object": "list", "data": data})
+}
+
+// finishReason returns the finish reason of the answer, "stop" if the
+// provider didn't report one
+func finishReason(metadata llm.Metadata) *string {
+	reason := metadata.FinishReason
+	if reason == "" {
+		reason = "stop"
+	}
+	return &reason
+}
+
+// writeProviderError responds with an error of the provider, passing the
+// status of API errors on
+func writeProviderError(w http.ResponseWriter, err error) {
+	status := http.StatusBadGateway
+	if apiErr, ok := err.(*llm.APIError); ok {
+		status = apiErr.StatusCode
+	}
+	writeHTTPError(w, status, "server_error", err.Error())
+}
+
+// writeHTTPError responds with an error in the format of the OpenAI API
+func writeHTTPError(w http.ResponseWriter, status int, kind, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"error": map[string]string{"message": message, "type": kind},
+	})
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Turee/si/pkg/llm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// postChat sends a chat completion request to the handler
+func postChat(t *testing.T, handler http.Handler, body, token string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(body))
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec
+}
+
+// TestServeHTTPChat tests answering a chat completion request
+func TestServeHTTPChat(t *testing.T) {
+	srv := mockServer(t, &MockProvider{AskResponse: "Paris"})
+
+	rec := postChat(t, srv.newHTTPHandler(""), `{"model":"gpt-4o-mini","messages":[{"role":"user","content":"capital of France?"}]}`, "")
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var completion chatCompletion
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &completion))
+	assert.Equal(t, "chat.completion", completion.Object)
+	assert.True(t, strings.HasPrefix(completion.ID, "chatcmpl-"))
+	assert.Equal(t, "gpt-4o-mini", completion.Model)
+	require.Len(t, completion.Choices, 1)
+	assert.Equal(t, &chatMessage{Role: llm.RoleAssistant, Content: "Paris"}, completion.Choices[0].Message)
+	assert.Equal(t, "stop", *completion.Choices[0].FinishReason)
+}
+
+// TestServeHTTPStream tests streaming an answer as server-sent events
+func TestServeHTTPStream(t *testing.T) {
+	srv := mockServer(t, &MockProvider{AskStreamChunks: []string{"Par", "is"}})
+
+	rec := postChat(t, srv.newHTTPHandler(""), `{"stream":true,"messages":[{"role":"user","content":"capital of France?"}]}`, "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "text/event-stream", rec.Header().Get("Content-Type"))
+
+	events := strings.Split(strings.TrimSpace(rec.Body.String()), "\n\n")
+	require.Len(t, events, 4)
+	assert.Equal(t, "data: [DONE]", events[3])
+
+	var answer strings.Builder
+	for i, event := range events[:3] {
+		var chunk chatCompletion
+		require.NoError(t, json.Unmarshal([]byte(strings.TrimPrefix(event, "data: ")), &chunk))
+		assert.Equal(t, "chat.completion.chunk", chunk.Object)
+		assert.Equal(t, "gpt-4o", chunk.Model)
+		answer.WriteString(chunk.Choices[0].Delta.Content)
+		if i < 2 {
+			assert.Nil(t, chunk.Choices[0].FinishReason)
+		} else {
+			assert.Equal(t, "stop", *chunk.Choices[0].FinishReason)
+		}
+	}
+	assert.Equal(t, "Paris", answer.String())
+}
+
+// TestServeHTTPErrors tests that failures are reported like the OpenAI API
+// reports them
+func TestServeHTTPErrors(t *testing.T) {
+	provider := &MockProvider{AskError: &llm.APIError{StatusCode: http.StatusTooManyRequests, Body: "rate limited"}}
+	handler := mockServer(t, provider).newHTTPHandler("secret")
+
+	tests := []struct {
+		name   string
+		body   string
+		token  string
+		status int
+		error  string
+	}{
+		{"missing token", `{"messages":[{"role":"user","content":"hi"}]}`, "", http.StatusUnauthorized, "invalid API key"},
+		{"wrong token", `{"messages":[{"role":"user","content":"hi"}]}`, "wrong", http.StatusUnauthorized, "invalid API key"},
+		{"invalid JSON", `{`, "secret", http.StatusBadRequest, "invalid request"},
+		{"no messages", `{"messages":[]}`, "secret", http.StatusBadRequest, "messages are required"},
+		{"invalid sampling", `{"temperature":5,"messages":[{"role":"user","content":"hi"}]}`, "secret", http.StatusBadRequest, "temperature"},
+		{"provider error", `{"messages":[{"role":"user","content":"hi"}]}`, "secret", http.StatusTooManyRequests, "rate limited"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := postChat(t, handler, tt.body, tt.token)
+			assert.Equal(t, tt.status, rec.Code)
+
+			var body struct {
+				Error struct {
+					Message string `json:"message"`
+				} `json:"error"`
+			}
+			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+			assert.Contains(t, body.Error.Message, tt.error)
+		})
+	}
+}
+
+// TestServeHTTPModels tests listing the configured model
+func TestServeHTTPModels(t *testing.T) {
+	srv := mockServer(t, &MockProvider{})
+
+	rec := httptest.NewRecorder()
+	srv.newHTTPHandler("").ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/models", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"object":"list","data":[{"id":"gpt-4o","object":"model","owned_by":"si"}]}`, rec.Body.String())
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/Turee/si/pkg/config"
+	"github.com/Turee/si/pkg/llm"
+	"github.com/Turee/si/pkg/rpc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// mockServer creates a server answering with the mock provider
+func mockServer(t *testing.T, provider *MockProvider) *server {
+	t.Helper()
+	mockUsagePath(t)
+
+	oldNewProvider := llm.NewProvider
+	t.Cleanup(func() { llm.NewProvider = oldNewProvider })
+
+	llm.NewProvider = func(cfg *config.Config) (llm.Provider, error) {
+		return provider, nil
+	}
+	srv, err := newServer(&config.Config{LLM: config.LLMConfig{OpenAI: config.OpenAIConfig{APIKey: "test-api-key", ModelName: "gpt-4o"}}})
+	require.NoError(t, err)
+	return srv
+}
+
+// TestServeStdio tests answering and streaming over JSON-RPC
+func TestServeStdio(t *testing.T) {
+	srv := mockServer(t, &MockProvider{AskResponse: "Paris", AskStreamChunks: []string{"Par", "is"}})
+
+	input := strings.Join([]string{
+		`{"jsonrpc":"2.0","id":1,"method":"stream","params":{"question":"capital of France?"}}`,
+		`{"jsonrpc":"2.0","id":2,"method":"unknown"}`,
+	}, "\n")
+	var out strings.Builder
+	require.NoError(t, rpc.NewConn(strings.NewReader(input), &out).Serve(context.Background(), srv.handle))
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	assert.ElementsMatch(t, []string{
+		`{"jsonrpc":"2.0","method":"stream/delta","params":{"id":1,"content":"Par"}}`,
+		`{"jsonrpc":"2.0","method":"stream/delta","params":{"id":1,"content":"is"}}`,
+		`{"jsonrpc":"2.0","id":1,"result":{"answer":"Paris","model":"gpt-4o","usage":null}}`,
+		`{"jsonrpc":"2.0","id":2,"error":{"code":-32601,"message":"method not found: unknown"}}`,
+	}, lines)
+	assert.Less(t, strings.Index(out.String(), `"content":"is"`), strings.Index(out.String(), `"id":1,"result"`))
+}
+
+// TestServeSessions tests conversations spanning several questions
+func TestServeSessions(t *testing.T) {
+	provider := &MockProvider{AskResponse: "Paris"}
+	srv := mockServer(t, provider)
+	ctx := context.Background()
+
+	id := srv.newSession("gpt-4o-mini", "Be brief.")
+	result, err := srv.ask(ctx, askParams{Question: "capital of France?", Session: id}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, &askResult{Answer: "Paris", Model: "gpt-4o-mini", Session: id}, result)
+
+	provider.AskResponse = "About 2 million"
+	_, err = srv.ask(ctx, askParams{Question: "population?", Session: id}, nil)
+	require.NoError(t, err)
+	require.Len(t, provider.MessagesSent, 4)
+	assert.Equal(t, "Be brief.", provider.MessagesSent[0].Text())
+	assert.Equal(t, "Paris", provider.MessagesSent[2].Text())
+
+	assert.Equal(t, []sessionInfo{{Session: id, Model: "gpt-4o-mini"}}, srv.listSessions())
+
+	// Questions outside a session have no history
+	_, err = srv.ask(ctx, askParams{Question: "population?"}, nil)
+	require.NoError(t, err)
+	assert.Len(t, provider.MessagesSent, 1)
+
+	require.NoError(t, srv.closeSession(id))
+	_, err = srv.ask(ctx, askParams{Question: "population?", Session: id}, nil)
+	assert.ErrorContains(t, err, "unknown session")
+	assert.Error(t, srv.closeSession(id))
+
+	_, err = srv.ask(ctx, askParams{}, nil)
+	assert.ErrorContains(t, err, "question is required")
+}
+
+// TestServeRequiresTransport tests that serve needs exactly one transport
+func TestServeRequiresTransport(t *testing.T) {
+	mockCommandEnvironment(t, "", false, "")
+
+	_, stderr := runMainOutput(t, "serve")
+	assert.Contains(t, stderr, "no transport selected, use --stdio or --http ADDR")
+}
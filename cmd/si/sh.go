@@ -0,0 +1,198 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"runtime"
+	"strings"
+
+	"github.com/Turee/si/pkg/clipboard"
+	"github.com/Turee/si/pkg/llm"
+	"github.com/Turee/si/pkg/termcap"
+	"github.com/alecthomas/kong"
+)
+
+// ShCmd generates a single shell command and optionally runs it
+type ShCmd struct {
+	Request []string `arg:"" name:"request" help:"Description of what the command should do"`
+}
+
+// For testing purposes, we can override these functions
+var (
+	runShellCommand = func(shell []string, command string) (int, error) {
+		cmd := exec.Command(shell[0], append(shell[1:], command)...)
+		cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+		if tty, err := openTerminal(); err == nil {
+			defer tty.Close()
+			if f, ok := tty.(*os.File); ok {
+				cmd.Stdin = f
+			}
+		}
+
+		err := cmd.Run()
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return exitErr.ExitCode(), nil
+		}
+		return 0, err
+	}
+	copyToClipboard = clipboard.Write
+)
+
+// dangerousCommand matches commands that deserve an extra warning before running
+var dangerousCommand = regexp.MustCompile(`rm\s+-[a-zA-Z]*[rf][a-zA-Z]*\s+(/|~|\*|\$HOME)(\s|$)|\bmkfs\b|\bdd\b.*\bof=/dev/|>\s*/dev/sd|:\(\)\s*\{|chmod\s+-R\s+777\s+/|\bshutdown\b|\breboot\b`)
+
+// Run asks the LLM for a shell command, shows it and offers to run, edit or copy it
+func (c *ShCmd) Run(kongCtx *kong.Context) error {
+	stdinContent, err := checkStdin()
+	if err != nil {
+		return err
+	}
+
+	cfg := loadConfiguration(kongCtx)
+	if cfg == nil {
+		return nil
+	}
+	redactor, err := newRedactor(cfg)
+	if err != nil {
+		return err
+	}
+	stdinContent = redactor.Redact(stdinContent)
+	warnRedacted(redactor)
+
+	system, err := systemPrompt(cfg)
+	if err != nil {
+		return err
+	}
+	provider, err := llm.NewProvider(cfg)
+	if err != nil {
+		return fmt.Errorf("error creating LLM provider: %w", err)
+	}
+	useSystemPrompt(provider, system)
+	var usage usageTracker
+	usage.track(provider)
+
+	shell := userShell()
+	answer, err := provider.Ask(context.Background(), shellPrompt(strings.Join(c.Request, " "), shell, stdinContent))
+	usage.save(modelName(cfg))
+	if err != nil {
+		return fmt.Errorf("error asking question: %w", err)
+	}
+
+	command := extractCommand(answer)
+	if command == "" {
+		return fmt.Errorf("the model did not return a command")
+	}
+
+	// Without a terminal there is nobody to confirm, so only print the command
+	if !isTerminal(stdoutStat) {
+		fmt.Println(command)
+		return nil
+	}
+	term, err := newTerminal()
+	if err != nil {
+		fmt.Println(command)
+		return nil
+	}
+	defer term.Close()
+
+	caps := stderrCapabilities(cfg)
+	for {
+		fmt.Fprintf(os.Stderr, "\n  %s\n\n", caps.Bold(command))
+		if dangerousCommand.MatchString(command) {
+			fmt.Fprintln(os.Stderr, caps.Foreground("Warning: this command looks destructive, review it carefully.", termcap.Yellow))
+		}
+
+		choice, err := term.choose("", []string{"run", "edit", "copy", "abort"}, "abort")
+		if err != nil {
+			return err
+		}
+
+		switch choice {
+		case "run":
+			code, err := runShellCommand(shell, command)
+			if err != nil {
+				return fmt.Errorf("failed to run command: %w", err)
+			}
+			if code != 0 {
+				osExit(code)
+			}
+			return nil
+		case "edit":
+			edited, err := editText(command+"\n", "si-command-*.sh")
+			if errors.Is(err, errNoEditor) {
+				edited, err = term.ask("Command: ")
+			}
+			if err != nil {
+				return err
+			}
+			if edited = strings.TrimSpace(edited); edited != "" {
+				command = edited
+			}
+		case "copy":
+			if err := copyToClipboard(command); err != nil {
+				return err
+			}
+			fmt.Fprintln(os.Stderr, "Copied to clipboard.")
+			return nil
+		default:
+			return nil
+		}
+	}
+}
+
+// userShell returns the command line used to run a command in the user's shell
+func userShell() []string {
+	if runtime.GOOS == "windows" {
+		if comspec := os.Getenv("COMSPEC"); comspec != "" {
+			return []string{comspec, "/C"}
+		}
+		return []string{"cmd.exe", "/C"}
+	}
+
+	if shell := os.Getenv("SHELL"); shell != "" {
+		return []string{shell, "-c"}
+	}
+	return []string{"/bin/sh", "-c"}
+}
+
+// shellPrompt builds the constrained prompt asking for a single command
+func shellPrompt(request string, shell []string, context string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Write a single %s command for %s that does the following: %s\n\n", shellName(shell), runtime.GOOS, request)
+	b.WriteString("Respond with only the command itself, without any explanation and without markdown formatting. ")
+	b.WriteString("If several steps are needed, combine them into one command line.")
+	if context != "" {
+		fmt.Fprintf(&b, "\n\nContext:\n%s", context)
+	}
+	return b.String()
+}
+
+// shellName returns the base name of the shell executable
+func shellName(shell []string) string {
+	name := shell[0]
+	if i := strings.LastIndexAny(name, `/\`); i >= 0 {
+		name = name[i+1:]
+	}
+	return strings.TrimSuffix(name, ".exe")
+}
+
+// fencedBlock matches the first markdown code block in an answer
+var fencedBlock = regexp.MustCompile("(?s)```[a-zA-Z0-9_+-]*\\n(.*?)```")
+
+// extractCommand extracts the command from the model's answer, removing any
+// markdown formatting or prompt characters the model added anyway
+func extractCommand(answer string) string {
+	command := strings.TrimSpace(answer)
+	if match := fencedBlock.FindStringSubmatch(command); match != nil {
+		command = strings.TrimSpace(match[1])
+	}
+
+	command = strings.Trim(command, "`")
+	command = strings.TrimPrefix(command, "$ ")
+	return strings.TrimSpace(command)
+}
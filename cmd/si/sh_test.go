@@ -0,0 +1,196 @@
+package main
+
+import (
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/Turee/si/pkg/config"
+	"github.com/Turee/si/pkg/llm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestExtractCommand tests extracting the command from different answer formats
+func TestExtractCommand(t *testing.T) {
+	testCases := []struct {
+		name     string
+		answer   string
+		expected string
+	}{
+		{name: "Plain command", answer: "ls -la\n", expected: "ls -la"},
+		{name: "Inline code", answer: "`find . -name '*.go'`", expected: "find . -name '*.go'"},
+		{name: "Prompt character", answer: "$ du -sh *", expected: "du -sh *"},
+		{name: "Fenced block", answer: "Here you go:\n```bash\ntar -czf out.tgz dir\n```\nThis creates an archive.", expected: "tar -czf out.tgz dir"},
+		{name: "Empty answer", answer: "  \n", expected: ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, extractCommand(tc.answer))
+		})
+	}
+}
+
+// TestShellPrompt tests that the prompt constrains the answer to a single command
+func TestShellPrompt(t *testing.T) {
+	prompt := shellPrompt("list large files", []string{"/usr/bin/zsh", "-c"}, "")
+	assert.Contains(t, prompt, "single zsh command")
+	assert.Contains(t, prompt, "list large files")
+	assert.Contains(t, prompt, "without markdown formatting")
+	assert.NotContains(t, prompt, "Context:")
+
+	prompt = shellPrompt("delete these", []string{"/bin/bash", "-c"}, "a.txt\nb.txt")
+	assert.Contains(t, prompt, "Context:\na.txt\nb.txt")
+}
+
+// mockCommandEnvironment sets up config, provider, stdin, stdout and terminal
+// mocks for running a command; answers are what the user types on the terminal
+func mockCommandEnvironment(t *testing.T, modelAnswer string, stdoutIsTerminal bool, answers string) *MockProvider {
+	t.Helper()
+
+	oldLoadConfig, oldNewProvider := loadConfigFunc, llm.NewProvider
+	oldStdinStat, oldStdoutStat, oldOpenTerminal := stdinStat, stdoutStat, openTerminal
+	t.Cleanup(func() {
+		loadConfigFunc, llm.NewProvider = oldLoadConfig, oldNewProvider
+		stdinStat, stdoutStat, openTerminal = oldStdinStat, oldStdoutStat, oldOpenTerminal
+	})
+
+	loadConfigFunc = func(path string) (*config.Config, error) {
+		return &config.Config{LLM: config.LLMConfig{OpenAI: config.OpenAIConfig{APIKey: "test-api-key"}}}, nil
+	}
+	provider := &MockProvider{AskResponse: modelAnswer}
+	llm.NewProvider = func(cfg *config.Config) (llm.Provider, error) {
+		return provider, nil
+	}
+	stdinStat = func() (os.FileInfo, error) {
+		return mockFileInfo{mode: os.ModeCharDevice}, nil
+	}
+	stdoutStat = func() (os.FileInfo, error) {
+		if stdoutIsTerminal {
+			return mockFileInfo{mode: os.ModeCharDevice}, nil
+		}
+		return mockFileInfo{mode: 0}, nil
+	}
+	openTerminal = func() (io.ReadCloser, error) {
+		return io.NopCloser(strings.NewReader(answers)), nil
+	}
+
+	return provider
+}
+
+// TestShPipedOutput tests that the command is only printed when stdout is not a terminal
+func TestShPipedOutput(t *testing.T) {
+	mockCommandEnvironment(t, "```sh\nls -la\n```", false, "")
+
+	output := runMain(t, "sh", "list", "all", "files")
+	assert.Equal(t, "ls -la\n", output)
+}
+
+// TestShRun tests running the generated command after confirmation
+func TestShRun(t *testing.T) {
+	mockCommandEnvironment(t, "echo hello", true, "r\n")
+
+	var ranCommand string
+	oldRunShellCommand := runShellCommand
+	defer func() { runShellCommand = oldRunShellCommand }()
+	runShellCommand = func(shell []string, command string) (int, error) {
+		ranCommand = command
+		return 0, nil
+	}
+
+	runMain(t, "sh", "say", "hello")
+	assert.Equal(t, "echo hello", ranCommand)
+}
+
+// TestShEditAndCopy tests editing the command before copying it
+func TestShEditAndCopy(t *testing.T) {
+	mockCommandEnvironment(t, "echo hello", true, "e\necho goodbye\nc\n")
+	t.Setenv("VISUAL", "")
+	t.Setenv("EDITOR", "")
+
+	var copied string
+	oldCopy := copyToClipboard
+	defer func() { copyToClipboard = oldCopy }()
+	copyToClipboard = func(text string) error {
+		copied = text
+		return nil
+	}
+
+	runMain(t, "sh", "say", "hello")
+	assert.Equal(t, "echo goodbye", copied)
+}
+
+// TestShAbort tests that nothing is run when the user aborts
+func TestShAbort(t *testing.T) {
+	mockCommandEnvironment(t, "rm -rf /", true, "\n")
+
+	oldRunShellCommand := runShellCommand
+	defer func() { runShellCommand = oldRunShellCommand }()
+	runShellCommand = func(shell []string, command string) (int, error) {
+		t.Fatal("command should not have been run")
+		return 0, nil
+	}
+
+	output := runMain(t, "sh", "clean", "up")
+	assert.Empty(t, output)
+	assert.True(t, dangerousCommand.MatchString("rm -rf /"))
+	assert.False(t, dangerousCommand.MatchString("rm -rf ./build"))
+}
+
+// TestShStyledPreview tests that the command preview is styled according to
+// the capabilities of the terminal
+func TestShStyledPreview(t *testing.T) {
+	mockCommandEnvironment(t, "rm -rf /", true, "\n\n")
+	t.Setenv("TERM", "xterm-256color")
+	t.Setenv("COLORTERM", "truecolor")
+	t.Setenv("NO_COLOR", "")
+
+	oldStderrStat := stderrStat
+	defer func() { stderrStat = oldStderrStat }()
+	stderrStat = func() (os.FileInfo, error) {
+		return mockFileInfo{mode: os.ModeCharDevice}, nil
+	}
+
+	// The configuration overrides the detected colors
+	loadConfigFunc = func(path string) (*config.Config, error) {
+		return &config.Config{
+			LLM: config.LLMConfig{OpenAI: config.OpenAIConfig{APIKey: "test-api-key"}},
+			UI:  config.UIConfig{Color: "16"},
+		}, nil
+	}
+
+	_, stderr := runMainOutput(t, "sh", "clean", "up")
+	assert.Contains(t, stderr, "\x1b[1mrm -rf /\x1b[22m")
+	assert.Contains(t, stderr, "\x1b[33mWarning: this command looks destructive")
+
+	// Without a terminal on stderr nothing is styled
+	stderrStat = oldStderrStat
+	_, stderr = runMainOutput(t, "sh", "clean", "up")
+	assert.Contains(t, stderr, "\n  rm -rf /\n")
+	assert.NotContains(t, stderr, "\x1b[")
+}
+
+// TestEditText tests editing text with the configured editor
+func TestEditText(t *testing.T) {
+	t.Setenv("VISUAL", "")
+	t.Setenv("EDITOR", "fake-editor --wait")
+
+	oldRunEditor := runEditor
+	defer func() { runEditor = oldRunEditor }()
+	runEditor = func(editor, path string) error {
+		assert.Equal(t, "fake-editor --wait", editor)
+		content, err := os.ReadFile(path)
+		require.NoError(t, err)
+		return os.WriteFile(path, append(content, []byte("edited\n")...), 0644)
+	}
+
+	edited, err := editText("original\n", "si-test-*.txt")
+	require.NoError(t, err)
+	assert.Equal(t, "original\nedited\n", edited)
+
+	t.Setenv("EDITOR", "")
+	_, err = editText("original\n", "si-test-*.txt")
+	assert.ErrorIs(t, err, errNoEditor)
+}
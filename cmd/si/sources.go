@@ -0,0 +1,39 @@
+package main
+
+import "github.com/Turee/si/pkg/output"
+
+// sourceList collects the files and URLs an answer is based on, numbered in
+// the order they were first used, for the footnotes of the answer
+type sourceList struct {
+	sources []output.Source
+}
+
+// add adds a source unless it is already listed
+func (l *sourceList) add(source output.Source) {
+	for _, s := range l.sources {
+		if s == source {
+			return
+		}
+	}
+	l.sources = append(l.sources, source)
+}
+
+// number returns the footnote number of a listed source, or zero
+func (l *sourceList) number(source output.Source) int {
+	for i, s := range l.sources {
+		if s == source {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// printFootnotes lists the sources after a plain-text answer. Agent answers
+// print their own, and structured output and templates include the sources
+// in the response instead.
+func printFootnotes(printer *answerPrinter, sources *sourceList) error {
+	if printer != nil || CLI.Agent {
+		return nil
+	}
+	return output.WriteFootnotes(answerOutput(), sources.sources)
+}
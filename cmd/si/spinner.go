@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/Turee/si/pkg/config"
+)
+
+// spinnerDelay is how long si waits for the first chunk before showing the
+// spinner, so fast answers don't flicker
+const spinnerDelay = 150 * time.Millisecond
+
+// spinnerInterval is the time between the frames of the spinner
+const spinnerInterval = 100 * time.Millisecond
+
+// spinner shows an animation on stderr while si waits for the first chunk of
+// an answer. It can be started again after it was stopped, e.g. when another
+// model answers. A nil spinner does nothing.
+type spinner struct {
+	out      io.Writer
+	frames   []string
+	label    string
+	delay    time.Duration
+	interval time.Duration
+
+	mu   sync.Mutex
+	stop chan struct{}
+	done chan struct{}
+}
+
+// newSpinner returns the spinner of the question, or nil if it is disabled
+// with --no-spinner or would get in the way: when the answer isn't written to
+// a terminal, stderr isn't one either, or the debug log is written to stderr
+func newSpinner(cfg *config.Config) *spinner {
+	if CLI.NoSpinner || CLI.DryRun || !isTerminal(stdoutStat) || !isTerminal(stderrStat) {
+		return nil
+	}
+	if cfg.LogLevel != "" && cfg.LogFile == "" {
+		return nil
+	}
+
+	caps := stderrCapabilities(cfg)
+	return &spinner{
+		out:      os.Stderr,
+		frames:   caps.SpinnerFrames(),
+		label:    "Thinking" + caps.Ellipsis(),
+		delay:    spinnerDelay,
+		interval: spinnerInterval,
+	}
+}
+
+// Start shows the spinner after the delay unless it is stopped before
+func (s *spinner) Start() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stop != nil {
+		return
+	}
+	s.stop, s.done = make(chan struct{}), make(chan struct{})
+	go s.run(s.stop, s.done)
+}
+
+// Stop removes the spinner from the terminal and waits until it is gone, so
+// nothing is written over the answer
+func (s *spinner) Stop() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stop == nil {
+		return
+	}
+	close(s.stop)
+	<-s.done
+	s.stop, s.done = nil, nil
+}
+
+// run draws the frames until stop is closed
+func (s *spinner) run(stop, done chan struct{}) {
+	defer close(done)
+
+	select {
+	case <-stop:
+		return
+	case <-time.After(s.delay):
+	}
+
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+	for i := 0; ; i++ {
+		fmt.Fprintf(s.out, "\r%s %s", s.frames[i%len(s.frames)], s.label)
+		select {
+		case <-stop:
+			// Overwrite the spinner with spaces, which works without
+			// escape sequences
+			width := utf8.RuneCountInString(s.frames[0]) + 1 + utf8.RuneCountInString(s.label)
+			fmt.Fprintf(s.out, "\r%s\r", strings.Repeat(" ", width))
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/Turee/si/pkg/config"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestSpinner tests drawing and removing the spinner
+func TestSpinner(t *testing.T) {
+	var out bytes.Buffer
+	s := &spinner{out: &out, frames: []string{"|", "/"}, label: "Thinking...", interval: time.Millisecond}
+
+	s.Start()
+	time.Sleep(20 * time.Millisecond)
+	s.Stop()
+
+	drawn := out.String()
+	assert.Contains(t, drawn, "\r| Thinking...")
+	assert.Contains(t, drawn, "\r/ Thinking...")
+	assert.Contains(t, drawn, "\r             \r", "the spinner is overwritten when it stops")
+
+	// Stopping again does nothing, and the spinner can be restarted
+	s.Stop()
+	assert.Equal(t, drawn, out.String())
+	s.Start()
+	s.Stop()
+}
+
+// TestSpinnerDelay tests that answers starting within the delay show no
+// spinner
+func TestSpinnerDelay(t *testing.T) {
+	var out bytes.Buffer
+	s := &spinner{out: &out, frames: []string{"|"}, label: "Thinking...", delay: time.Hour, interval: time.Millisecond}
+
+	s.Start()
+	s.Stop()
+	assert.Empty(t, out.String())
+
+	// A nil spinner is disabled
+	var disabled *spinner
+	disabled.Start()
+	disabled.Stop()
+}
+
+// TestNewSpinner tests when the spinner is shown
+func TestNewSpinner(t *testing.T) {
+	mockCommandEnvironment(t, "", true, "")
+	oldStderrStat := stderrStat
+	t.Cleanup(func() {
+		stderrStat = oldStderrStat
+		CLI.NoSpinner = false
+	})
+	stderrStat = func() (os.FileInfo, error) {
+		return mockFileInfo{mode: os.ModeCharDevice}, nil
+	}
+
+	assert.NotNil(t, newSpinner(&config.Config{}))
+	assert.Nil(t, newSpinner(&config.Config{LogLevel: "debug"}), "the debug log on stderr would be garbled")
+	assert.NotNil(t, newSpinner(&config.Config{LogLevel: "debug", LogFile: "si.log"}))
+
+	CLI.NoSpinner = true
+	assert.Nil(t, newSpinner(&config.Config{}))
+	CLI.NoSpinner = false
+
+	stdoutStat = func() (os.FileInfo, error) {
+		return mockFileInfo{mode: 0}, nil
+	}
+	assert.Nil(t, newSpinner(&config.Config{}), "piped answers show no spinner")
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/Turee/si/pkg/config"
+	"github.com/Turee/si/pkg/llm"
+	"github.com/Turee/si/pkg/tools"
+	"github.com/Turee/si/pkg/trace"
+)
+
+// Defaults of sub-agents
+const (
+	defaultSubagentTool     = tools.ReadFile
+	defaultSubagentMaxSteps = 5
+)
+
+// subagentPrompt is added to the instructions of every sub-agent
+const subagentPrompt = "You are a sub-agent working on a task delegated by another agent, which only sees your final answer. Work on the task with your tools, then answer with your findings, concisely and completely. You can't ask questions."
+
+// subagentParameters is the JSON Schema of the arguments of a delegation
+const subagentParameters = `{"type":"object","properties":{"task":{"type":"string","description":"The task, with everything needed to work on it, as the sub-agent can't see this conversation"}},"required":["task"]}`
+
+// tracePath returns the path of the trace log of sub-agents. It is a variable
+// so tests can redirect it.
+var tracePath = trace.DefaultPath
+
+// registerSubagents adds a delegate_<name> tool to the toolbox for every
+// sub-agent of the config. A sub-agent runs its own tool loop with its tools
+// and budget; its usage is tracked by usage, so it counts against the budget
+// of the parent as well. Sub-agents can't delegate further. onCall returns the
+// progress callback of the tool calls of an agent, given the prefix of its
+// messages.
+func registerSubagents(toolbox *llm.Toolbox, cfg *config.Config, caller llm.ToolCaller, opts tools.Options, usage *usageTracker, onCall func(agent string) func(llm.ToolCall)) error {
+	for _, name := range sortedKeys(cfg.Agent.Subagents) {
+		sub := cfg.Agent.Subagents[name]
+
+		names := sub.Tools
+		if len(names) == 0 {
+			names = []string{defaultSubagentTool}
+		}
+		subToolbox := llm.NewToolbox()
+		if err := tools.Register(subToolbox, names, opts); err != nil {
+			return fmt.Errorf("agent.subagents.%s.tools: %w", name, err)
+		}
+
+		s := &subagent{
+			name:    name,
+			cfg:     sub,
+			model:   modelName(cfg),
+			caller:  caller,
+			toolbox: subToolbox,
+			usage:   usage,
+			onCall:  onCall("[" + name + "] "),
+		}
+		toolbox.Add(llm.Tool{
+			Name:        "delegate_" + name,
+			Description: fmt.Sprintf("Delegate a task to the %s sub-agent: %s", name, sub.Description),
+			Parameters:  json.RawMessage(subagentParameters),
+		}, s.run)
+	}
+	return nil
+}
+
+// subagent is an agent the model delegates tasks to
+type subagent struct {
+	name    string
+	cfg     config.SubagentConfig
+	model   string
+	caller  llm.ToolCaller
+	toolbox *llm.Toolbox
+	usage   *usageTracker
+	onCall  func(llm.ToolCall)
+}
+
+// run works on the delegated task and returns the answer of the sub-agent.
+// The conversation is recorded in the trace log.
+func (s *subagent) run(ctx context.Context, arguments json.RawMessage) (string, error) {
+	var args struct {
+		Task string `json:"task"`
+	}
+	if err := json.Unmarshal(arguments, &args); err != nil || strings.TrimSpace(args.Task) == "" {
+		return "", fmt.Errorf("a task is required")
+	}
+
+	maxSteps := s.cfg.MaxSteps
+	if maxSteps == 0 {
+		maxSteps = defaultSubagentMaxSteps
+	}
+	budget := &agentBudget{
+		maxTokens: s.cfg.MaxTokens,
+		maxCost:   s.cfg.MaxCost,
+		model:     s.model,
+		usage:     s.usage,
+		settings:  fmt.Sprintf("agent.subagents.%s", s.name),
+		start:     s.usage.usage,
+		grants:    1,
+	}
+	loop := &llm.ToolLoop{
+		Provider:   s.caller,
+		Toolbox:    s.toolbox,
+		MaxSteps:   maxSteps,
+		OnCall:     s.onCall,
+		BeforeStep: budget.check,
+	}
+
+	system := subagentPrompt
+	if s.cfg.Instructions != "" {
+		system = s.cfg.Instructions + "\n\n" + subagentPrompt
+	}
+	messages := []llm.Message{
+		{Role: llm.RoleSystem, Content: system},
+		llm.NewUserMessage(args.Task),
+	}
+
+	messages, err := loop.Run(ctx, messages, func(string) error { return nil })
+	record := trace.Record{
+		Time:     now(),
+		Agent:    s.name,
+		Model:    s.model,
+		Task:     args.Task,
+		Messages: messages,
+		Usage:    budget.used(),
+	}
+	if err != nil {
+		record.Error = err.Error()
+	}
+	if traceErr := trace.Append(tracePath(), record); traceErr != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to record the trace of the sub-agent: %v\n", traceErr)
+	}
+	if err != nil {
+		return "", fmt.Errorf("the %s sub-agent stopped: %w", s.name, err)
+	}
+
+	answer := strings.TrimSpace(messages[len(messages)-1].Content)
+	if answer == "" {
+		return "", fmt.Errorf("the %s sub-agent gave no answer", s.name)
+	}
+	return answer, nil
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Turee/si/pkg/config"
+	"github.com/Turee/si/pkg/llm"
+	"github.com/Turee/si/pkg/trace"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// delegatingProvider delegates the question to the search sub-agent, which
+// reads a file, and answers with what the sub-agent reported
+type delegatingProvider struct {
+	*MockProvider
+	path    string
+	tools   map[string][]string
+	tokens  int
+	onUsage func(llm.Usage)
+}
+
+func (p *delegatingProvider) SetUsageCallback(callback func(llm.Usage)) {
+	p.onUsage = callback
+}
+
+func (p *delegatingProvider) ChatTools(ctx context.Context, messages []llm.Message, tools []llm.Tool, callback func(chunk string) error) ([]llm.ToolCall, error) {
+	p.onUsage(llm.Usage{TotalTokens: p.tokens})
+
+	agent := "parent"
+	if messages[0].Role == llm.RoleSystem && strings.Contains(messages[0].Content, subagentPrompt) {
+		agent = "search"
+	}
+	for _, tool := range tools {
+		p.tools[agent] = append(p.tools[agent], tool.Name)
+	}
+
+	last := messages[len(messages)-1]
+	switch {
+	case last.Role != llm.RoleTool && agent == "parent":
+		return []llm.ToolCall{{ID: "call_1", Name: "delegate_search", Arguments: `{"task":"find the notes"}`}}, nil
+	case last.Role != llm.RoleTool:
+		return []llm.ToolCall{{ID: "call_2", Name: "read_file", Arguments: `{"path":"` + p.path + `"}`}}, nil
+	case agent == "parent":
+		return nil, callback("Parent: " + last.Text())
+	default:
+		return nil, callback("found " + last.Text())
+	}
+}
+
+// mockSubagentEnvironment sets up a config with the search sub-agent and a
+// provider delegating to it
+func mockSubagentEnvironment(t *testing.T, sub config.SubagentConfig) (*delegatingProvider, string) {
+	mockCommandEnvironment(t, "", false, "")
+	mockUsagePath(t)
+	t.Cleanup(func() { CLI.Agent = false })
+
+	traces := filepath.Join(t.TempDir(), "traces.jsonl")
+	oldTracePath := tracePath
+	t.Cleanup(func() { tracePath = oldTracePath })
+	tracePath = func() string { return traces }
+
+	loadConfigFunc = func(path string) (*config.Config, error) {
+		return &config.Config{
+			LLM: config.LLMConfig{OpenAI: config.OpenAIConfig{APIKey: "test-api-key", ModelName: "gpt-4o"}},
+			Agent: config.AgentConfig{
+				Tools:     []string{"fetch"},
+				Subagents: map[string]config.SubagentConfig{"search": sub},
+			},
+		}, nil
+	}
+
+	notes := filepath.Join(t.TempDir(), "notes.txt")
+	require.NoError(t, os.WriteFile(notes, []byte("buy milk"), 0644))
+	provider := &delegatingProvider{MockProvider: &MockProvider{}, path: notes, tools: map[string][]string{}, tokens: 10}
+	llm.NewProvider = func(cfg *config.Config) (llm.Provider, error) {
+		return provider, nil
+	}
+	return provider, traces
+}
+
+// TestSubagent tests delegating a task to a sub-agent with its own tools,
+// and recording its conversation in the trace log
+func TestSubagent(t *testing.T) {
+	provider, traces := mockSubagentEnvironment(t, config.SubagentConfig{Description: "Searches files", Instructions: "Search thoroughly."})
+
+	stdout, stderr := runMainOutput(t, "--agent", "what", "is", "in", "my", "notes?")
+	assert.True(t, strings.HasPrefix(stdout, "Parent: found buy milk\n"), stdout)
+	assert.Contains(t, stderr, "Calling delegate_search")
+	assert.Contains(t, stderr, "[search] Calling read_file")
+
+	// The sub-agent only gets its own tools, and can't delegate further
+	assert.Equal(t, []string{"delegate_search", "fetch"}, provider.tools["parent"][:2])
+	assert.Equal(t, []string{"read_file"}, provider.tools["search"][:1])
+
+	records, err := trace.Load(traces)
+	require.NoError(t, err)
+	require.Len(t, records, 1)
+	assert.Equal(t, "search", records[0].Agent)
+	assert.Equal(t, "find the notes", records[0].Task)
+	assert.Equal(t, 20, records[0].Usage.TotalTokens)
+	assert.Empty(t, records[0].Error)
+	require.Len(t, records[0].Messages, 5)
+	assert.True(t, strings.HasPrefix(records[0].Messages[0].Content, "Search thoroughly.\n\n"))
+	assert.Equal(t, "buy milk", records[0].Messages[3].Content)
+}
+
+// TestSubagentBudget tests that a sub-agent stops when its budget is used up
+// and the parent is told why
+func TestSubagentBudget(t *testing.T) {
+	_, traces := mockSubagentEnvironment(t, config.SubagentConfig{Description: "Searches files", MaxTokens: 5})
+
+	stdout := runMain(t, "--agent", "what", "is", "in", "my", "notes?")
+	assert.Contains(t, stdout, "Parent: error: the search sub-agent stopped: the agent stopped after using 10 tokens (estimated cost $0.0000), the budget of a task set by agent.subagents.search")
+
+	records, err := trace.Load(traces)
+	require.NoError(t, err)
+	require.Len(t, records, 1)
+	assert.Contains(t, records[0].Error, "the agent stopped after using 10 tokens")
+}
+
+// TestSubagentInvalidTools tests that unknown tools of a sub-agent are
+// reported
+func TestSubagentInvalidTools(t *testing.T) {
+	mockSubagentEnvironment(t, config.SubagentConfig{Description: "Searches files", Tools: []string{"browser"}})
+
+	_, stderr := runMainOutput(t, "--agent", "hello")
+	assert.Contains(t, stderr, `agent.subagents.search.tools: unknown tool "browser"`)
+}
+
+// TestSubagentArguments tests that a delegation needs a task
+func TestSubagentArguments(t *testing.T) {
+	s := &subagent{name: "search"}
+	_, err := s.run(context.Background(), json.RawMessage(`{"task":" "}`))
+	assert.EqualError(t, err, "a task is required")
+}
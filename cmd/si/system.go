@@ -0,0 +1,124 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Turee/si/pkg/config"
+	"github.com/Turee/si/pkg/llm"
+	"github.com/Turee/si/pkg/prompt"
+)
+
+// now returns the current time, it can be replaced in tests
+var now = time.Now
+
+// systemParts assembles the system prompt: the built-in prompt, the prompt
+// from the config, the selected role, the workspace memory and the
+// environment, in that order
+func systemParts(cfg *config.Config) (*prompt.System, error) {
+	var system prompt.System
+	system.Add(prompt.SystemPart{Name: prompt.PartBuiltin, Content: llm.DefaultSystemPrompt})
+	system.Add(prompt.SystemPart{Name: prompt.PartConfig, Source: "system.prompt", Content: cfg.System.Prompt})
+
+	if CLI.Role != "" {
+		role, ok := cfg.Roles[CLI.Role]
+		if !ok {
+			return nil, unknownRoleError(cfg.Roles, CLI.Role)
+		}
+		system.Add(prompt.SystemPart{Name: prompt.PartRole, Source: "roles." + CLI.Role, Content: role})
+	}
+
+	system.Add(workspaceMemory(cfg))
+
+	if cfg.System.Environment {
+		system.Add(prompt.SystemPart{Name: prompt.PartEnvironment, Content: environmentContext()})
+	}
+
+	return &system, nil
+}
+
+// systemPrompt returns the assembled system prompt for requests
+func systemPrompt(cfg *config.Config) (string, error) {
+	system, err := systemParts(cfg)
+	if err != nil {
+		return "", err
+	}
+	return system.String(), nil
+}
+
+// useSystemPrompt gives the provider the system prompt, if it supports one
+func useSystemPrompt(provider llm.Provider, prompt string) {
+	if prompter, ok := provider.(llm.SystemPrompter); ok {
+		prompter.SetSystemPrompt(prompt)
+	}
+}
+
+// useExamples gives the provider the example exchanges of a prompt template,
+// if it supports them
+func useExamples(provider llm.Provider, examples []config.PromptExample) {
+	prompter, ok := provider.(llm.ExamplePrompter)
+	if !ok || len(examples) == 0 {
+		return
+	}
+
+	messages := make([]llm.Message, 0, 2*len(examples))
+	for _, example := range examples {
+		messages = append(messages,
+			llm.Message{Role: llm.RoleUser, Content: example.User},
+			llm.Message{Role: llm.RoleAssistant, Content: example.Assistant})
+	}
+	prompter.SetExamples(messages)
+}
+
+// printSystem prints the system prompt requests would be sent with. The parts
+// it consists of are listed on stderr.
+func printSystem(cfg *config.Config) error {
+	system, err := systemParts(cfg)
+	if err != nil {
+		return err
+	}
+
+	var names []string
+	for _, part := range system.Parts() {
+		name := part.Name
+		if part.Source != "" {
+			name += " (" + part.Source + ")"
+		}
+		names = append(names, name)
+	}
+	fmt.Fprintf(os.Stderr, "System prompt parts: %s\n", strings.Join(names, ", "))
+	fmt.Println(system.String())
+	return nil
+}
+
+// environmentContext describes the environment si runs in to the model
+func environmentContext() string {
+	lines := []string{
+		"The user's environment:",
+		fmt.Sprintf("- Operating system: %s/%s", runtime.GOOS, runtime.GOARCH),
+		"- Shell: " + shellName(userShell()),
+	}
+	if dir, err := workingDir(); err == nil {
+		lines = append(lines, "- Working directory: "+dir)
+	}
+	lines = append(lines, "- Date: "+now().Format("Monday, 2 January 2006"))
+	return strings.Join(lines, "\n")
+}
+
+// unknownRoleError reports a role that isn't in the config
+func unknownRoleError(roles map[string]string, name string) error {
+	if len(roles) == 0 {
+		return fmt.Errorf("unknown role %q: no roles are configured", name)
+	}
+
+	names := make([]string, 0, len(roles))
+	for role := range roles {
+		names = append(names, role)
+	}
+	sort.Strings(names)
+	return fmt.Errorf("unknown role %q (available: %s)", name, strings.Join(names, ", "))
+}
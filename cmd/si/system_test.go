@@ -0,0 +1,106 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/Turee/si/pkg/config"
+	"github.com/Turee/si/pkg/llm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestPrintSystem tests assembling and printing the system prompt
+func TestPrintSystem(t *testing.T) {
+	provider := mockCommandEnvironment(t, "Done", false, "")
+	mockUsagePath(t)
+	t.Setenv("SHELL", "/bin/zsh")
+	defer func() { CLI.PrintSystem, CLI.Role = false, "" }()
+
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "SI.md"), []byte("Use tabs."), 0644))
+	oldWorkingDir, oldNow := workingDir, now
+	defer func() { workingDir, now = oldWorkingDir, oldNow }()
+	workingDir = func() (string, error) { return dir, nil }
+	now = func() time.Time { return time.Date(2025, 3, 14, 12, 0, 0, 0, time.UTC) }
+
+	loadConfigFunc = func(path string) (*config.Config, error) {
+		return &config.Config{
+			LLM:    config.LLMConfig{OpenAI: config.OpenAIConfig{APIKey: "test-api-key"}},
+			System: config.SystemConfig{Prompt: "Answer in British English.", Environment: true},
+			Roles:  map[string]string{"reviewer": "You review code strictly."},
+		}, nil
+	}
+
+	output, stderr := runMainOutput(t, "--print-system", "--role", "reviewer")
+	assert.Equal(t, llm.DefaultSystemPrompt+"\n\n"+
+		"Answer in British English.\n\n"+
+		"You review code strictly.\n\n"+
+		"Follow these instructions for the current project:\nUse tabs.\n\n"+
+		"The user's environment:\n"+
+		"- Operating system: "+runtime.GOOS+"/"+runtime.GOARCH+"\n"+
+		"- Shell: zsh\n"+
+		"- Working directory: "+dir+"\n"+
+		"- Date: Friday, 14 March 2025\n", output)
+	assert.Contains(t, stderr, "System prompt parts: builtin, config (system.prompt), role (roles.reviewer), memory ("+filepath.Join(dir, "SI.md")+"), environment")
+	assert.Empty(t, provider.QuestionAsked)
+
+	// Unknown roles are reported
+	CLI.PrintSystem = false
+	_, stderr = runMainOutput(t, "--role", "poet", "hello")
+	assert.Contains(t, stderr, `unknown role "poet" (available: reviewer)`)
+	assert.Empty(t, provider.QuestionAsked)
+}
+
+// TestPromptExamples tests that the examples of a prompt template are sent as
+// messages of their own
+func TestPromptExamples(t *testing.T) {
+	mockCommandEnvironment(t, "", false, "")
+	mockUsagePath(t)
+	defer func() { CLI.DryRun, CLI.Prompt = false, "" }()
+
+	loadConfigFunc = func(path string) (*config.Config, error) {
+		return &config.Config{
+			LLM: config.LLMConfig{OpenAI: config.OpenAIConfig{APIKey: "test-api-key", BaseURL: "http://127.0.0.1:1/v1"}},
+			Prompts: map[string]config.PromptConfig{"sql": {
+				Template: "Write a query: {{.Args}}",
+				Examples: []config.PromptExample{
+					{User: "Write a query: count users", Assistant: "SELECT count(*) FROM users;"},
+					{User: "Write a query: newest order", Assistant: "SELECT * FROM orders ORDER BY created_at DESC LIMIT 1;"},
+				},
+			}},
+		}, nil
+	}
+	llm.NewProvider = func(cfg *config.Config) (llm.Provider, error) {
+		return llm.NewOpenAIProvider(&cfg.LLM.OpenAI)
+	}
+
+	output, _ := runMainOutput(t, "--dry-run", "-p", "sql", "count orders")
+	var request struct {
+		Body struct {
+			Messages []struct {
+				Role    string `json:"role"`
+				Content string `json:"content"`
+			} `json:"messages"`
+		} `json:"body"`
+	}
+	require.NoError(t, json.Unmarshal([]byte(output), &request))
+	require.Len(t, request.Body.Messages, 6)
+	assert.Equal(t, "system", request.Body.Messages[0].Role)
+	assert.Equal(t, "user", request.Body.Messages[1].Role)
+	assert.Equal(t, "Write a query: count users", request.Body.Messages[1].Content)
+	assert.Equal(t, "assistant", request.Body.Messages[2].Role)
+	assert.Equal(t, "SELECT count(*) FROM users;", request.Body.Messages[2].Content)
+	assert.Equal(t, "assistant", request.Body.Messages[4].Role)
+	assert.Equal(t, "Write a query: count orders", request.Body.Messages[5].Content)
+
+	// Without a prompt template no examples are sent
+	CLI.Prompt = ""
+	output, _ = runMainOutput(t, "--dry-run", "count orders")
+	require.NoError(t, json.Unmarshal([]byte(output), &request))
+	assert.Len(t, request.Body.Messages, 2)
+}
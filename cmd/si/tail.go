@@ -0,0 +1,297 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/Turee/si/pkg/llm"
+	"github.com/Turee/si/pkg/redact"
+	"github.com/alecthomas/kong"
+)
+
+// tailQuiet is the answer of the model when a window of lines has nothing
+// worth reporting
+const tailQuiet = "NOTHING TO REPORT"
+
+// maxLogLine is the longest log line that is read, longer lines are cut
+const maxLogLine = 64 * 1024
+
+// For testing purposes, we can override these
+var (
+	tailStdin        io.Reader = os.Stdin
+	tailPollInterval           = 500 * time.Millisecond
+)
+
+// TailCmd reviews log lines in windows and prints the anomalies the model
+// finds, following a growing file like tail -f
+type TailCmd struct {
+	File     string        `arg:"" optional:"" type:"path" help:"Log file to review, or - for stdin (default)"`
+	Follow   bool          `name:"follow" short:"f" help:"Keep reviewing the lines appended to the file, starting at its end"`
+	Interval time.Duration `name:"interval" default:"30s" help:"How often the new lines are reviewed when following"`
+	Lines    int           `name:"lines" short:"n" default:"200" help:"Maximum number of lines reviewed at once; a full window is reviewed right away"`
+	Focus    string        `name:"focus" help:"What to look out for, e.g. \"failed logins\""`
+	Summary  bool          `name:"summary" help:"Summarize every window, not only the ones with anomalies"`
+}
+
+// logWindow is a run of consecutive log lines
+type logWindow struct {
+	first int
+	lines []string
+}
+
+// Run reads the log and reviews it window by window until the input ends or
+// the user presses Ctrl-C
+func (c *TailCmd) Run(kongCtx *kong.Context) error {
+	if c.Lines < 1 {
+		return fmt.Errorf("--lines must be at least 1, got %d", c.Lines)
+	}
+	if c.Interval <= 0 {
+		return fmt.Errorf("--interval must be positive, got %s", c.Interval)
+	}
+
+	var input io.Reader = tailStdin
+	if c.File != "" && c.File != "-" {
+		f, err := openLog(c.File, c.Follow)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		input = f
+	}
+
+	cfg := loadConfiguration(kongCtx)
+	if cfg == nil {
+		return nil
+	}
+	redactor, err := newRedactor(cfg)
+	if err != nil {
+		return err
+	}
+	provider, err := llm.NewProvider(cfg)
+	if err != nil {
+		return fmt.Errorf("error creating LLM provider: %w", err)
+	}
+	var usage usageTracker
+	usage.track(provider)
+	defer usage.save(modelName(cfg))
+
+	ctx, stop := notifyInterrupt(context.Background())
+	defer stop()
+
+	lines := make(chan string)
+	readErr := make(chan error, 1)
+	go func() {
+		readErr <- readLogLines(ctx, input, lines)
+		close(lines)
+	}()
+
+	// The lines are only closed once the reader is done
+	if err := c.review(ctx, provider, redactor, lines); err != nil || ctx.Err() != nil {
+		return err
+	}
+	return <-readErr
+}
+
+// review collects the lines into windows and reviews each window when it is
+// full, when the interval passed or when the input ended. Secrets in the
+// lines are redacted by redactor.
+func (c *TailCmd) review(ctx context.Context, provider llm.Provider, redactor *redact.Redactor, lines <-chan string) error {
+	ticker := time.NewTicker(c.Interval)
+	defer ticker.Stop()
+
+	window := logWindow{first: 1}
+	flush := func() error {
+		if len(window.lines) == 0 {
+			return nil
+		}
+		err := c.reviewWindow(ctx, provider, redactor, window)
+		window = logWindow{first: window.first + len(window.lines)}
+		return err
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case line, ok := <-lines:
+			if !ok {
+				return flush()
+			}
+			window.lines = append(window.lines, line)
+			if len(window.lines) >= c.Lines {
+				if err := flush(); err != nil {
+					return err
+				}
+			}
+		case <-ticker.C:
+			// Without --follow the input is read as fast as possible, so
+			// windows are only cut by size
+			if c.Follow {
+				if err := flush(); err != nil {
+					return err
+				}
+			}
+		}
+	}
+}
+
+// reviewWindow asks the model about a window of lines and prints its alerts.
+// New secrets in the window are reported before it is sent.
+func (c *TailCmd) reviewWindow(ctx context.Context, provider llm.Provider, redactor *redact.Redactor, window logWindow) error {
+	redacted := redactor.Count()
+	question := redactor.Redact(c.prompt(window.lines))
+	if redactor.Count() > redacted {
+		warnRedacted(redactor)
+	}
+
+	answer, err := provider.Ask(ctx, question)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil
+		}
+		return fmt.Errorf("error reviewing lines %d-%d: %w", window.first, window.first+len(window.lines)-1, err)
+	}
+
+	answer = strings.TrimSpace(answer)
+	if answer == "" || strings.EqualFold(strings.Trim(answer, ".* "), tailQuiet) {
+		return nil
+	}
+	fmt.Printf("[%s] lines %d-%d:\n%s\n\n", now().Format("15:04:05"), window.first, window.first+len(window.lines)-1, answer)
+	return nil
+}
+
+// prompt builds the question about a window of log lines
+func (c *TailCmd) prompt(lines []string) string {
+	var b strings.Builder
+	b.WriteString("You are triaging application logs. Review the log lines below for errors, anomalies, unusual patterns and security concerns.\n")
+	if c.Focus != "" {
+		fmt.Fprintf(&b, "Pay particular attention to: %s\n", c.Focus)
+	}
+	if c.Summary {
+		b.WriteString("Summarize what happened in a few bullet points, starting with the problems, if any.\n")
+	} else {
+		b.WriteString("Report each problem as a short bullet point with the relevant line quoted. If there is nothing worth reporting, reply with exactly " + tailQuiet + ".\n")
+	}
+	b.WriteString("\nLog lines:\n")
+	for _, line := range lines {
+		b.WriteString(line)
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
+
+// openLog opens the log file, positioned at its end when it is followed
+func openLog(path string, follow bool) (io.ReadCloser, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open log: %w", err)
+	}
+	if !follow {
+		return f, nil
+	}
+
+	if _, err := f.Seek(0, io.SeekEnd); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to seek to the end of the log: %w", err)
+	}
+	return &logFollower{path: path, file: f}, nil
+}
+
+// logFollower reads a log file that is appended to, waiting for new data at
+// the end instead of returning io.EOF. A file that is truncated is read
+// again from its start, and a file that is rotated is reopened.
+type logFollower struct {
+	path string
+	file *os.File
+}
+
+// Read implements io.Reader
+func (l *logFollower) Read(p []byte) (int, error) {
+	for {
+		n, err := l.file.Read(p)
+		if n > 0 || (err != nil && err != io.EOF) {
+			return n, err
+		}
+
+		time.Sleep(tailPollInterval)
+		if err := l.checkRotation(); err != nil {
+			return 0, err
+		}
+	}
+}
+
+// checkRotation reopens the file if it was replaced and rewinds it if it was
+// truncated
+func (l *logFollower) checkRotation() error {
+	current, err := l.file.Stat()
+	if err != nil {
+		return err
+	}
+
+	latest, err := os.Stat(l.path)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		// Rotated but not created again yet
+		return nil
+	case err != nil:
+		return err
+	case !os.SameFile(current, latest):
+		f, err := os.Open(l.path)
+		if err != nil {
+			return nil
+		}
+		l.file.Close()
+		l.file = f
+		return nil
+	}
+
+	offset, err := l.file.Seek(0, io.SeekCurrent)
+	if err == nil && latest.Size() < offset {
+		_, err = l.file.Seek(0, io.SeekStart)
+	}
+	return err
+}
+
+// Close implements io.Closer
+func (l *logFollower) Close() error {
+	return l.file.Close()
+}
+
+// readLogLines sends the lines of the input to the channel until it ends or
+// the context is canceled
+func readLogLines(ctx context.Context, input io.Reader, lines chan<- string) error {
+	reader := bufio.NewReaderSize(input, maxLogLine)
+	for {
+		line, err := readLogLine(reader)
+		if line != "" || err == nil {
+			select {
+			case lines <- line:
+			case <-ctx.Done():
+				return nil
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read log: %w", err)
+		}
+	}
+}
+
+// readLogLine reads a line without its line break, cutting lines longer than
+// maxLogLine
+func readLogLine(reader *bufio.Reader) (string, error) {
+	line, isPrefix, err := reader.ReadLine()
+	text := strings.TrimRight(string(line), "\r")
+	for isPrefix && err == nil {
+		_, isPrefix, err = reader.ReadLine()
+	}
+	return text, err
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Turee/si/pkg/config"
+	"github.com/Turee/si/pkg/llm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// tailProvider reports the lines with errors in the windows it is asked about
+type tailProvider struct {
+	MockProvider
+	mu      sync.Mutex
+	windows []string
+	onAsk   func()
+}
+
+// Ask implements the Provider interface
+func (p *tailProvider) Ask(ctx context.Context, question string) (string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	_, lines, _ := strings.Cut(question, "Log lines:\n")
+	p.windows = append(p.windows, lines)
+	if p.onAsk != nil {
+		p.onAsk()
+	}
+
+	var alerts []string
+	for _, line := range strings.Split(lines, "\n") {
+		if strings.Contains(line, "ERROR") {
+			alerts = append(alerts, "- "+line)
+		}
+	}
+	if len(alerts) == 0 {
+		return tailQuiet + ".", nil
+	}
+	return strings.Join(alerts, "\n"), nil
+}
+
+// mockTailEnvironment sets up the configuration and the provider for si tail
+func mockTailEnvironment(t *testing.T) *tailProvider {
+	mockCommandEnvironment(t, "", false, "")
+	mockUsagePath(t)
+	t.Cleanup(func() { CLI.Tail = TailCmd{} })
+
+	oldNow := now
+	t.Cleanup(func() { now = oldNow })
+	now = func() time.Time { return time.Date(2025, 3, 14, 12, 0, 0, 0, time.UTC) }
+
+	provider := &tailProvider{}
+	llm.NewProvider = func(cfg *config.Config) (llm.Provider, error) {
+		return provider, nil
+	}
+	return provider
+}
+
+// TestTail tests reviewing a log in windows and printing only the alerts
+func TestTail(t *testing.T) {
+	provider := mockTailEnvironment(t)
+
+	path := filepath.Join(t.TempDir(), "app.log")
+	require.NoError(t, os.WriteFile(path, []byte("started\nERROR disk full\nrequest ok\r\nrequest ok\nstopped"), 0600))
+
+	output := runMain(t, "tail", "-n", "2", "--focus", "disk usage", path)
+	assert.Equal(t, "[12:00:00] lines 1-2:\n- ERROR disk full\n\n", output)
+	assert.Equal(t, []string{"started\nERROR disk full\n", "request ok\nrequest ok\n", "stopped\n"}, provider.windows)
+
+	// Stdin is read by default
+	provider.windows = nil
+	oldStdin := tailStdin
+	defer func() { tailStdin = oldStdin }()
+	tailStdin = strings.NewReader("ERROR one\nERROR two\n")
+	output = runMain(t, "tail")
+	assert.Equal(t, "[12:00:00] lines 1-2:\n- ERROR one\n- ERROR two\n\n", output)
+}
+
+// TestTailPrompt tests the question about a window
+func TestTailPrompt(t *testing.T) {
+	cmd := &TailCmd{Focus: "failed logins"}
+	prompt := cmd.prompt([]string{"a", "b"})
+	assert.Contains(t, prompt, "Pay particular attention to: failed logins\n")
+	assert.Contains(t, prompt, "reply with exactly "+tailQuiet)
+	assert.True(t, strings.HasSuffix(prompt, "Log lines:\na\nb\n"))
+
+	cmd.Summary = true
+	assert.Contains(t, cmd.prompt(nil), "Summarize what happened")
+}
+
+// TestTailFollow tests reviewing the lines appended to a file, including
+// after it was truncated
+func TestTailFollow(t *testing.T) {
+	provider := mockTailEnvironment(t)
+
+	oldPoll := tailPollInterval
+	defer func() { tailPollInterval = oldPoll }()
+	tailPollInterval = time.Millisecond
+
+	path := filepath.Join(t.TempDir(), "app.log")
+	require.NoError(t, os.WriteFile(path, []byte("ERROR old, already handled\n"), 0600))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	oldNotifyInterrupt := notifyInterrupt
+	defer func() { notifyInterrupt = oldNotifyInterrupt }()
+	notifyInterrupt = func(parent context.Context) (context.Context, context.CancelFunc) {
+		return ctx, cancel
+	}
+
+	// The log grows while si follows it, and is truncated after the first
+	// window; the user stops after the second one
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		appendFile(t, path, "ERROR new\nrequest ok\n")
+	}()
+	provider.onAsk = func() {
+		if !strings.Contains(provider.windows[len(provider.windows)-1], "truncation") {
+			go func() {
+				require.NoError(t, os.WriteFile(path, []byte("ERROR after truncation\n"), 0600))
+			}()
+		} else {
+			cancel()
+		}
+	}
+
+	output := runMain(t, "tail", "--follow", "--interval", "50ms", path)
+	require.NotEmpty(t, provider.windows)
+	assert.Equal(t, "ERROR new\nrequest ok\nERROR after truncation\n", strings.Join(provider.windows, ""))
+	assert.Contains(t, output, "- ERROR new\n")
+	assert.NotContains(t, output, "old")
+}
+
+// appendFile appends text to the file at path
+func appendFile(t *testing.T, path, text string) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	require.NoError(t, err)
+	defer f.Close()
+	_, err = f.WriteString(text)
+	require.NoError(t, err)
+}
+
+// TestTailInvalidFlags tests rejecting windows that can't be reviewed
+func TestTailInvalidFlags(t *testing.T) {
+	mockTailEnvironment(t)
+
+	_, stderr := runMainOutput(t, "tail", "--lines", "0")
+	assert.Contains(t, stderr, "--lines must be at least 1")
+}
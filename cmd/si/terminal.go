@@ -0,0 +1,190 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"github.com/Turee/si/pkg/config"
+	"github.com/Turee/si/pkg/termcap"
+)
+
+// errNoEditor is returned when neither $VISUAL nor $EDITOR is set
+var errNoEditor = errors.New("no editor configured, set $VISUAL or $EDITOR")
+
+// For testing purposes, we can override these functions
+var (
+	openTerminal = func() (io.ReadCloser, error) {
+		if runtime.GOOS == "windows" {
+			return os.Open("CONIN$")
+		}
+		return os.Open("/dev/tty")
+	}
+	runEditor = func(editor, path string) error {
+		// The editor may contain arguments, e.g. "code --wait"
+		args := strings.Fields(editor)
+		cmd := exec.Command(args[0], append(args[1:], path)...)
+		cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stderr, os.Stderr
+		if tty, err := openTerminal(); err == nil {
+			defer tty.Close()
+			if f, ok := tty.(*os.File); ok {
+				cmd.Stdin = f
+			}
+		}
+		return cmd.Run()
+	}
+)
+
+// terminal asks the user questions on the controlling terminal. Questions are
+// written to stderr so they never end up in piped output.
+type terminal struct {
+	in  *bufio.Reader
+	out io.Writer
+	tty io.Closer
+}
+
+// newTerminal opens the controlling terminal for interactive questions
+func newTerminal() (*terminal, error) {
+	tty, err := openTerminal()
+	if err != nil {
+		return nil, fmt.Errorf("no terminal available for interactive input: %w", err)
+	}
+	return &terminal{in: bufio.NewReader(tty), out: os.Stderr, tty: tty}, nil
+}
+
+// Close closes the terminal
+func (t *terminal) Close() error {
+	return t.tty.Close()
+}
+
+// ask prints the prompt and returns the line entered by the user
+func (t *terminal) ask(prompt string) (string, error) {
+	fmt.Fprint(t.out, prompt)
+	line, err := t.in.ReadString('\n')
+	if err != nil && (err != io.EOF || line == "") {
+		return "", err
+	}
+	return strings.TrimSpace(line), nil
+}
+
+// choose asks the user to pick one of the options by its first letter. An
+// empty answer selects the default option.
+func (t *terminal) choose(prompt string, options []string, def string) (string, error) {
+	labels := make([]string, len(options))
+	for i, option := range options {
+		labels[i] = "[" + option[:1] + "]" + option[1:]
+	}
+	question := fmt.Sprintf("%s %s? ", prompt, strings.Join(labels, " / "))
+
+	for {
+		answer, err := t.ask(question)
+		if err != nil {
+			return "", err
+		}
+		if answer == "" {
+			return def, nil
+		}
+		for _, option := range options {
+			if strings.EqualFold(answer, option) || strings.EqualFold(answer, option[:1]) {
+				return option, nil
+			}
+		}
+		fmt.Fprintf(t.out, "Please answer one of: %s\n", strings.Join(options, ", "))
+	}
+}
+
+// pick asks the user to select one of the options from a numbered list, by
+// number or by name. An empty answer selects nothing.
+func (t *terminal) pick(prompt string, options []string) (string, error) {
+	for i, option := range options {
+		fmt.Fprintf(t.out, "%3d) %s\n", i+1, option)
+	}
+	question := fmt.Sprintf("%s [1-%d, empty to cancel]: ", prompt, len(options))
+
+	for {
+		answer, err := t.ask(question)
+		if err != nil {
+			return "", err
+		}
+		if answer == "" {
+			return "", nil
+		}
+		if n, err := strconv.Atoi(answer); err == nil && n >= 1 && n <= len(options) {
+			return options[n-1], nil
+		}
+		for _, option := range options {
+			if answer == option {
+				return option, nil
+			}
+		}
+		fmt.Fprintf(t.out, "Please enter a number between 1 and %d\n", len(options))
+	}
+}
+
+// editText lets the user edit text in $VISUAL or $EDITOR and returns the result
+func editText(text, pattern string) (string, error) {
+	editor := os.Getenv("VISUAL")
+	if editor == "" {
+		editor = os.Getenv("EDITOR")
+	}
+	if strings.TrimSpace(editor) == "" {
+		return "", errNoEditor
+	}
+
+	file, err := os.CreateTemp("", pattern)
+	if err != nil {
+		return "", fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	defer os.Remove(file.Name())
+
+	if _, err := file.WriteString(text); err != nil {
+		file.Close()
+		return "", fmt.Errorf("failed to write temporary file: %w", err)
+	}
+	if err := file.Close(); err != nil {
+		return "", fmt.Errorf("failed to write temporary file: %w", err)
+	}
+
+	if err := runEditor(editor, file.Name()); err != nil {
+		return "", fmt.Errorf("editor failed: %w", err)
+	}
+
+	edited, err := os.ReadFile(file.Name())
+	if err != nil {
+		return "", fmt.Errorf("failed to read edited file: %w", err)
+	}
+	return string(edited), nil
+}
+
+// isTerminal reports whether the file described by stat is a terminal
+func isTerminal(stat func() (os.FileInfo, error)) bool {
+	info, err := stat()
+	return err == nil && (info.Mode()&os.ModeCharDevice) != 0
+}
+
+// stderrCapabilities returns what the terminal on stderr, where all
+// interactive output goes, can display, with the overrides of the
+// configuration. Output redirected to a file is never colored.
+func stderrCapabilities(cfg *config.Config) termcap.Capabilities {
+	return capabilities(cfg, stderrStat)
+}
+
+// capabilities returns what the terminal described by stat can display, with
+// the overrides of the configuration
+func capabilities(cfg *config.Config, stat func() (os.FileInfo, error)) termcap.Capabilities {
+	terminal := isTerminal(stat)
+	caps := termcap.Detect(os.Getenv, runtime.GOOS, terminal)
+
+	// The configuration has been validated, so the override can't fail
+	caps, _ = caps.Override(cfg.UI.Unicode, cfg.UI.Color)
+	if !terminal {
+		caps.Color = termcap.ColorNone
+	}
+	return caps
+}
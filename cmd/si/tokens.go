@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/Turee/si/pkg/config"
+	"github.com/Turee/si/pkg/tokens"
+	"github.com/alecthomas/kong"
+)
+
+// countTokens counts the tokens of a text, it can be replaced in tests
+var countTokens = tokens.Count
+
+// TokensCmd counts the tokens of the text piped via stdin
+type TokensCmd struct {
+	Text []string `arg:"" optional:"" help:"Text to count when nothing is piped via stdin"`
+}
+
+// Run prints the number of tokens of the input for the selected model
+func (c *TokensCmd) Run(kongCtx *kong.Context) error {
+	text, err := checkStdin()
+	if err != nil {
+		return err
+	}
+	if text == "" {
+		text = strings.Join(c.Text, " ")
+	}
+	if text == "" {
+		printUsage(kongCtx)
+		return nil
+	}
+
+	// Counting tokens doesn't need a valid configuration, only the model
+	cfg, err := loadConfigFunc(CLI.ConfigPath)
+	if err != nil {
+		cfg = &config.Config{}
+	}
+	if err := applySelection(kongCtx, cfg); err != nil {
+		return err
+	}
+
+	count, err := countTokens(modelName(cfg), text)
+	if err != nil {
+		count = tokens.Estimate(text)
+		fmt.Fprintf(os.Stderr, "Warning: %v, showing an estimate\n", err)
+	}
+
+	fmt.Println(count)
+	return nil
+}
+
+// modelName returns the model that is used for requests
+func modelName(cfg *config.Config) string {
+	if cfg.LLM.OpenAI.ModelName != "" {
+		return cfg.LLM.OpenAI.ModelName
+	}
+	return config.DefaultModelName
+}
+
+// contextWindow returns the context window of the configured model in tokens,
+// or zero if it is unknown
+func contextWindow(cfg *config.Config) int {
+	if cfg.LLM.OpenAI.ContextWindow > 0 {
+		return cfg.LLM.OpenAI.ContextWindow
+	}
+	return tokens.ContextWindow(modelName(cfg))
+}
+
+// warnContextWindow warns on stderr when the prompt doesn't fit into the
+// context window of the model. The request is still sent, as the provider
+// has the final say.
+func warnContextWindow(cfg *config.Config, prompt string) {
+	window := contextWindow(cfg)
+	if !tokens.MayExceed(prompt, window) {
+		return
+	}
+
+	count, err := countTokens(modelName(cfg), prompt)
+	if err != nil {
+		count = tokens.Estimate(prompt)
+	}
+	if count > window {
+		fmt.Fprintf(os.Stderr, "Warning: the prompt has %d tokens, which exceeds the context window of %s (%d tokens)\n",
+			count, modelName(cfg), window)
+	}
+}
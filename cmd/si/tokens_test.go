@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/Turee/si/pkg/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// mockCountTokens counts words instead of tokens and records the model used
+func mockCountTokens(t *testing.T) *string {
+	t.Helper()
+
+	var usedModel string
+	oldCountTokens := countTokens
+	t.Cleanup(func() { countTokens = oldCountTokens })
+	countTokens = func(model, text string) (int, error) {
+		usedModel = model
+		return len(strings.Fields(text)), nil
+	}
+	return &usedModel
+}
+
+// TestTokensStdin tests counting the tokens of stdin for the selected model
+func TestTokensStdin(t *testing.T) {
+	mockCommandEnvironment(t, "", false, "")
+	usedModel := mockCountTokens(t)
+
+	oldStdinStat, oldStdinRead := stdinStat, stdinRead
+	defer func() { stdinStat, stdinRead = oldStdinStat, oldStdinRead }()
+	stdinStat = func() (os.FileInfo, error) {
+		return mockFileInfo{mode: 0}, nil
+	}
+	stdinRead = func() ([]byte, error) {
+		return []byte("one two three four"), nil
+	}
+
+	output := runMain(t, "-m", "gpt-4o", "tokens")
+	assert.Equal(t, "4\n", output)
+	assert.Equal(t, "gpt-4o", *usedModel)
+}
+
+// TestTokensProvider tests counting with the model of the selected provider
+func TestTokensProvider(t *testing.T) {
+	mockCommandEnvironment(t, "", false, "")
+	usedModel := mockCountTokens(t)
+	loadConfigFunc = func(path string) (*config.Config, error) {
+		return &config.Config{LLM: config.LLMConfig{
+			OpenAI: config.OpenAIConfig{ModelName: "gpt-4o"},
+			Providers: map[string]config.ProviderConfig{
+				"local": {OpenAIConfig: config.OpenAIConfig{BaseURL: "http://localhost:11434/v1", ModelName: "llama3.1"}},
+			},
+		}}, nil
+	}
+	t.Cleanup(func() { CLI.Provider = "" })
+
+	output := runMain(t, "--provider", "local", "tokens", "one two")
+	assert.Equal(t, "2\n", output)
+	assert.Equal(t, "llama3.1", *usedModel)
+}
+
+// TestTokensEstimate tests falling back to an estimate when the tokenizer is unavailable
+func TestTokensEstimate(t *testing.T) {
+	mockCommandEnvironment(t, "", false, "")
+
+	oldCountTokens := countTokens
+	defer func() { countTokens = oldCountTokens }()
+	countTokens = func(model, text string) (int, error) {
+		return 0, errors.New("failed to load tokenizer: offline")
+	}
+
+	output := runMain(t, "tokens", "twelve chars")
+	assert.Equal(t, "3\n", output)
+}
+
+// TestWarnContextWindow tests warning about prompts that exceed the context window
+func TestWarnContextWindow(t *testing.T) {
+	mockCountTokens(t)
+	cfg := &config.Config{LLM: config.LLMConfig{OpenAI: config.OpenAIConfig{ModelName: "my-model", ContextWindow: 3}}}
+
+	// Capture stderr
+	oldStderr := os.Stderr
+	r, w, _ := os.Pipe()
+	os.Stderr = w
+	defer func() { os.Stderr = oldStderr }()
+
+	warnContextWindow(cfg, "fits")
+	warnContextWindow(cfg, "this prompt is too long")
+	w.Close()
+
+	var buf bytes.Buffer
+	_, err := buf.ReadFrom(r)
+	require.NoError(t, err)
+	assert.Equal(t, "Warning: the prompt has 5 tokens, which exceeds the context window of my-model (3 tokens)\n", buf.String())
+}
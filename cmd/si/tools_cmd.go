@@ -0,0 +1,161 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/Turee/si/pkg/config"
+	"github.com/Turee/si/pkg/llm"
+	"github.com/Turee/si/pkg/openapi"
+	"github.com/Turee/si/pkg/tools"
+)
+
+// apiName matches valid names of APIs, which are keys of agent.apis and
+// prefix the names of their tools
+var apiName = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// ToolsCmd manages the tools the model can call in agent mode
+type ToolsCmd struct {
+	Import ToolsImportCmd `cmd:"" help:"Let the model call operations of a REST API described by an OpenAPI spec"`
+}
+
+// ToolsImportCmd adds an API described by an OpenAPI spec to the config, so
+// its operations become tools in agent mode
+type ToolsImportCmd struct {
+	Spec       string   `arg:"" type:"path" help:"Path of the OpenAPI 3 spec, in YAML or JSON"`
+	Name       string   `name:"name" help:"Name of the API, prefixing the names of its tools (default: the file name of the spec)"`
+	Operations []string `name:"operation" short:"o" help:"ID of an operation the model may call, can be repeated (default: all)"`
+	List       bool     `name:"list" help:"List the operations of the spec instead of importing it"`
+	BaseURL    string   `name:"base-url" help:"URL of the API, overriding the server URL of the spec"`
+	Auth       string   `name:"auth" enum:"none,bearer,basic,header,query" default:"none" help:"How requests are authenticated: none, bearer, basic, header or query"`
+	AuthName   string   `name:"auth-name" help:"Name of the header or query parameter of the token"`
+	SecretEnv  string   `name:"secret-env" placeholder:"VAR" help:"Environment variable holding the token, or the password of basic auth"`
+	Username   string   `name:"username" help:"User name of basic auth"`
+	Force      bool     `name:"force" short:"f" help:"Replace an imported API of the same name"`
+}
+
+// Run lists the operations of the spec or saves the API to the config file
+func (c *ToolsImportCmd) Run() error {
+	spec, err := openapi.Load(c.Spec)
+	if err != nil {
+		return err
+	}
+	if c.List {
+		return listOperations(spec)
+	}
+
+	name := c.Name
+	if name == "" {
+		name = strings.TrimSuffix(filepath.Base(c.Spec), filepath.Ext(c.Spec))
+	}
+	if !apiName.MatchString(name) {
+		return fmt.Errorf("invalid API name %q, use letters, digits, - and _ or give one with --name", name)
+	}
+
+	api := config.APIConfig{Spec: c.Spec, Operations: c.Operations, BaseURL: c.BaseURL}
+	if api.Auth, err = c.auth(); err != nil {
+		return err
+	}
+
+	// Registering the tools checks the operations and the server URL
+	toolbox := llm.NewToolbox()
+	if err := tools.RegisterAPI(toolbox, newToolsAPI(name, spec, api), tools.Options{}); err != nil {
+		return err
+	}
+
+	if cfg, err := loadConfigFunc(CLI.ConfigPath); err == nil && !c.Force {
+		if _, ok := cfg.Agent.APIs[name]; ok {
+			return fmt.Errorf("an API named %q is already imported, use --force to replace it", name)
+		}
+	}
+
+	path := configFilePath()
+	if err := config.SaveSection(path, "agent.apis."+name, api); err != nil {
+		return err
+	}
+
+	var names []string
+	for _, tool := range toolbox.Tools() {
+		names = append(names, tool.Name)
+	}
+	fmt.Fprintf(os.Stderr, "Imported %d operations of %s to agent.apis.%s in %s\n", len(names), apiTitle(spec, name), name, path)
+	fmt.Fprintf(os.Stderr, "Tools: %s\n", strings.Join(names, ", "))
+	return nil
+}
+
+// auth returns the auth configuration of the flags. Secrets are stored as
+// references to the environment variable, never in the file.
+func (c *ToolsImportCmd) auth() (config.APIAuthConfig, error) {
+	if c.Auth == "none" {
+		return config.APIAuthConfig{}, nil
+	}
+	if c.SecretEnv == "" {
+		return config.APIAuthConfig{}, fmt.Errorf("--secret-env is required for %s auth", c.Auth)
+	}
+
+	auth := config.APIAuthConfig{Type: c.Auth, Name: c.AuthName}
+	secret := "${" + c.SecretEnv + "}"
+	if c.Auth == "basic" {
+		auth.Username, auth.Password = c.Username, secret
+	} else {
+		auth.Token = secret
+	}
+	if err := auth.Validate(); err != nil {
+		return config.APIAuthConfig{}, fmt.Errorf("%w, give it with --auth-name", err)
+	}
+	return auth, nil
+}
+
+// listOperations prints the IDs, methods, paths and summaries of the
+// operations of the spec
+func listOperations(spec *openapi.Spec) error {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for _, op := range spec.Operations() {
+		fmt.Fprintf(w, "%s\t%s %s\t%s\n", op.ID, op.Method, op.Path, strings.TrimSpace(op.Summary))
+	}
+	return w.Flush()
+}
+
+// apiTitle returns the title of the spec, or the name of the API
+func apiTitle(spec *openapi.Spec, name string) string {
+	if title := spec.Title(); title != "" {
+		return title
+	}
+	return name
+}
+
+// registerAPIs adds the operations of the configured APIs to the toolbox
+func registerAPIs(toolbox *llm.Toolbox, apis map[string]config.APIConfig, opts tools.Options) error {
+	for _, name := range sortedKeys(apis) {
+		api := apis[name]
+		spec, err := openapi.Load(config.ExpandPath(api.Spec))
+		if err != nil {
+			return fmt.Errorf("agent.apis.%s: %w", name, err)
+		}
+		if err := tools.RegisterAPI(toolbox, newToolsAPI(name, spec, api), opts); err != nil {
+			return fmt.Errorf("agent.apis.%s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// newToolsAPI describes a configured API to the tools package
+func newToolsAPI(name string, spec *openapi.Spec, api config.APIConfig) tools.API {
+	return tools.API{
+		Name:       name,
+		Spec:       spec,
+		Operations: api.Operations,
+		BaseURL:    api.BaseURL,
+		Auth: openapi.Auth{
+			Type:     api.Auth.Type,
+			Name:     api.Auth.Name,
+			Token:    api.Auth.Token,
+			Username: api.Auth.Username,
+			Password: api.Auth.Password,
+		},
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Turee/si/pkg/config"
+	"github.com/Turee/si/pkg/llm"
+	"github.com/Turee/si/pkg/tools"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// todoSpec is the spec of a todo API
+const todoSpec = `openapi: 3.0.0
+info:
+  title: Todo API
+servers:
+  - url: https://todo.example.com
+paths:
+  /todos:
+    get:
+      operationId: listTodos
+      summary: List the todos
+    post:
+      operationId: addTodo
+`
+
+// importTools runs si tools import with the arguments
+func importTools(t *testing.T, args ...string) (string, string) {
+	t.Helper()
+	defer func() { CLI.Tools = ToolsCmd{} }()
+	return runMainOutput(t, append([]string{"tools", "import"}, args...)...)
+}
+
+// TestToolsImport tests adding the operations of an OpenAPI spec to the
+// config
+func TestToolsImport(t *testing.T) {
+	_, configPath := mockSavedEnvironment(t, "")
+	specPath := filepath.Join(t.TempDir(), "todo.yaml")
+	require.NoError(t, os.WriteFile(specPath, []byte(todoSpec), 0600))
+
+	output, _ := importTools(t, specPath, "--list")
+	assert.Equal(t, "listTodos  GET /todos   List the todos\naddTodo    POST /todos  \n", output)
+
+	_, stderr := importTools(t, "--config", configPath, specPath, "--auth", "header")
+	assert.Contains(t, stderr, "--secret-env is required for header auth")
+	_, stderr = importTools(t, "--config", configPath, specPath, "--auth", "header", "--secret-env", "TODO_TOKEN")
+	assert.Contains(t, stderr, "auth.name is required for header auth, give it with --auth-name")
+	_, stderr = importTools(t, "--config", configPath, specPath, "-o", "deleteTodo")
+	assert.Contains(t, stderr, `the API todo has no operation "deleteTodo"`)
+
+	_, stderr = importTools(t, "--config", configPath, specPath, "-o", "listTodos", "--auth", "bearer", "--secret-env", "TODO_TOKEN")
+	assert.Contains(t, stderr, "Imported 1 operations of Todo API to agent.apis.todo in "+configPath)
+	assert.Contains(t, stderr, "Tools: todo_listTodos")
+
+	value, ok, err := config.GetValue(configPath, "agent.apis.todo.auth.token")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, "${TODO_TOKEN}", value)
+
+	// An API isn't replaced by accident
+	_, stderr = importTools(t, "--config", configPath, specPath)
+	assert.Contains(t, stderr, "use --force to replace it")
+	_, stderr = importTools(t, "--config", configPath, specPath, "--force", "--name", "todos")
+	assert.Contains(t, stderr, "Imported 2 operations of Todo API to agent.apis.todos")
+
+	// The imported operations are tools in agent mode
+	cfg, err := config.LoadConfig(configPath)
+	require.NoError(t, err)
+	toolbox := llm.NewToolbox()
+	require.NoError(t, registerAPIs(toolbox, cfg.Agent.APIs, tools.Options{}))
+	var names []string
+	for _, tool := range toolbox.Tools() {
+		names = append(names, tool.Name)
+	}
+	assert.Equal(t, []string{"todo_listTodos", "todos_addTodo", "todos_listTodos"}, names)
+}
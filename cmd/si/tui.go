@@ -0,0 +1,477 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/Turee/si/pkg/config"
+	"github.com/Turee/si/pkg/llm"
+	"github.com/Turee/si/pkg/termcap"
+	"github.com/alecthomas/kong"
+	"github.com/charmbracelet/bubbles/key"
+	"github.com/charmbracelet/bubbles/textarea"
+	"github.com/charmbracelet/bubbles/viewport"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// TUICmd chats with the model in a full-screen terminal interface
+type TUICmd struct{}
+
+// tuiHelp lists the key bindings of the chat
+const tuiHelp = "enter send · alt+enter newline · ↑/↓ history · pgup/pgdn scroll · ctrl+n new session · tab switch session · ctrl+o model · esc cancel · ctrl+c quit"
+
+// inputHeight is the number of lines of the input box
+const inputHeight = 3
+
+// newTUIProgram creates the program running the chat, it can be replaced in
+// tests
+var newTUIProgram = func(model tea.Model) interface{ Run() (tea.Model, error) } {
+	return tea.NewProgram(model, tea.WithAltScreen(), tea.WithMouseCellMotion())
+}
+
+// Run opens the chat until the user quits
+func (c *TUICmd) Run(kongCtx *kong.Context) error {
+	cfg := loadConfiguration(kongCtx)
+	if cfg == nil {
+		return nil
+	}
+	if !isTerminal(stdoutStat) {
+		return fmt.Errorf("si tui needs a terminal")
+	}
+
+	system, err := systemPrompt(cfg)
+	if err != nil {
+		return err
+	}
+
+	_, err = newTUIProgram(newChatModel(cfg, system, capabilities(cfg, stdoutStat))).Run()
+	return err
+}
+
+// chatEntry is a message shown in the conversation view
+type chatEntry struct {
+	role string
+	text string
+
+	// model is the model that answered, empty for questions
+	model string
+
+	// failed tells that the text is an error rather than a message
+	failed bool
+}
+
+// chatSession is a conversation of the chat with the model answering it
+type chatSession struct {
+	model        string
+	conversation *llm.Conversation
+	entries      []chatEntry
+}
+
+// chatChunkMsg carries a streamed chunk of the answer
+type chatChunkMsg string
+
+// chatAnswerMsg tells that the answer is complete or failed
+type chatAnswerMsg struct {
+	err error
+}
+
+// chatModelsMsg carries the models of the provider for the model picker
+type chatModelsMsg struct {
+	models []string
+	err    error
+}
+
+// modelPicker lets the user choose the model of the session
+type modelPicker struct {
+	models []string
+	cursor int
+}
+
+// chatModel is the state of the chat
+type chatModel struct {
+	cfg    *config.Config
+	system string
+	caps   termcap.Capabilities
+
+	sessions []*chatSession
+	current  int
+
+	viewport viewport.Model
+	input    textarea.Model
+	width    int
+	height   int
+
+	// history holds the questions sent, browsing starts after the last one
+	history      []string
+	historyIndex int
+
+	// events receives the chunks of the answer being streamed, nil while
+	// no question is answered
+	events chan tea.Msg
+	cancel context.CancelFunc
+
+	picker *modelPicker
+	status string
+}
+
+// newChatModel creates the chat with an empty session
+func newChatModel(cfg *config.Config, system string, caps termcap.Capabilities) *chatModel {
+	input := textarea.New()
+	input.Placeholder = "Ask a question"
+	input.ShowLineNumbers = false
+	input.CharLimit = 0
+	input.SetHeight(inputHeight)
+	input.KeyMap.InsertNewline = key.NewBinding(key.WithKeys("alt+enter", "ctrl+j"))
+	input.Focus()
+
+	m := &chatModel{cfg: cfg, system: system, caps: caps, viewport: viewport.New(0, 0), input: input}
+	m.newSession(modelName(cfg))
+	return m
+}
+
+// newSession starts a conversation with the model and switches to it. The
+// history is trimmed to the context window of the model, if it is known.
+func (m *chatModel) newSession(model string) {
+	cfg := *m.cfg
+	cfg.SetModel(model)
+
+	conversation := llm.NewConversation(model, "")
+	conversation.MaxTokens = contextWindow(&cfg)
+	m.sessions = append(m.sessions, &chatSession{model: model, conversation: conversation})
+	m.current = len(m.sessions) - 1
+}
+
+// session returns the session shown
+func (m *chatModel) session() *chatSession {
+	return m.sessions[m.current]
+}
+
+// Init implements tea.Model
+func (m *chatModel) Init() tea.Cmd {
+	return textarea.Blink
+}
+
+// Update implements tea.Model
+func (m *chatModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.width, m.height = msg.Width, msg.Height
+		m.input.SetWidth(msg.Width)
+		m.viewport.Width = msg.Width
+		m.viewport.Height = max(msg.Height-inputHeight-2, 1)
+		m.render()
+		return m, nil
+
+	case tea.MouseMsg:
+		var cmd tea.Cmd
+		m.viewport, cmd = m.viewport.Update(msg)
+		return m, cmd
+
+	case chatChunkMsg:
+		entries := m.session().entries
+		entries[len(entries)-1].text += string(msg)
+		m.render()
+		return m, waitForChatEvent(m.events)
+
+	case chatAnswerMsg:
+		m.events, m.cancel = nil, nil
+		sess := m.session()
+		if last := sess.entries[len(sess.entries)-1]; msg.err != nil && last.text == "" {
+			sess.entries = sess.entries[:len(sess.entries)-1]
+		}
+		switch {
+		case errors.Is(msg.err, context.Canceled):
+			m.status = "Canceled, the question is not part of the conversation"
+		case msg.err != nil:
+			m.addEntry(chatEntry{role: "error", text: msg.err.Error(), failed: true})
+		}
+		m.render()
+		return m, nil
+
+	case chatModelsMsg:
+		switch {
+		case msg.err != nil:
+			m.status = "Failed to list the models: " + msg.err.Error()
+		case len(msg.models) == 0:
+			m.status = "The provider lists no models"
+		default:
+			m.status = ""
+			m.picker = &modelPicker{models: msg.models}
+			for i, model := range msg.models {
+				if model == m.session().model {
+					m.picker.cursor = i
+				}
+			}
+		}
+		m.render()
+		return m, nil
+
+	case tea.KeyMsg:
+		if m.picker != nil {
+			return m, m.updatePicker(msg)
+		}
+		return m.updateKey(msg)
+	}
+
+	var cmd tea.Cmd
+	m.input, cmd = m.input.Update(msg)
+	return m, cmd
+}
+
+// updateKey handles a key pressed in the conversation
+func (m *chatModel) updateKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	m.status = ""
+	switch msg.String() {
+	case "ctrl+c":
+		if m.cancel != nil {
+			m.cancel()
+			return m, nil
+		}
+		return m, tea.Quit
+	case "ctrl+d":
+		if m.input.Value() == "" {
+			return m, tea.Quit
+		}
+	case "esc":
+		if m.cancel != nil {
+			m.cancel()
+		}
+		return m, nil
+	case "enter":
+		return m, m.submit()
+	case "pgup", "pgdown":
+		var cmd tea.Cmd
+		m.viewport, cmd = m.viewport.Update(msg)
+		return m, cmd
+	case "up":
+		if m.input.Line() == 0 && m.historyIndex > 0 {
+			m.historyIndex--
+			m.input.SetValue(m.history[m.historyIndex])
+			return m, nil
+		}
+	case "down":
+		if m.input.Line() == m.input.LineCount()-1 && m.historyIndex < len(m.history) {
+			m.historyIndex++
+			m.input.SetValue("")
+			if m.historyIndex < len(m.history) {
+				m.input.SetValue(m.history[m.historyIndex])
+			}
+			return m, nil
+		}
+	case "ctrl+n", "tab", "shift+tab", "ctrl+o":
+		if m.events != nil {
+			m.status = "Wait for the answer or cancel it with esc"
+			return m, nil
+		}
+		return m, m.switchSession(msg.String())
+	}
+
+	var cmd tea.Cmd
+	m.input, cmd = m.input.Update(msg)
+	return m, cmd
+}
+
+// switchSession starts or switches sessions, or lists the models to pick
+// the model of the session from
+func (m *chatModel) switchSession(key string) tea.Cmd {
+	switch key {
+	case "ctrl+n":
+		m.newSession(m.session().model)
+	case "tab":
+		m.current = (m.current + 1) % len(m.sessions)
+	case "shift+tab":
+		m.current = (m.current + len(m.sessions) - 1) % len(m.sessions)
+	case "ctrl+o":
+		m.status = "Listing the models..."
+		return m.listModels()
+	}
+	m.render()
+	return nil
+}
+
+// updatePicker handles a key pressed in the model picker
+func (m *chatModel) updatePicker(msg tea.KeyMsg) tea.Cmd {
+	switch msg.String() {
+	case "up", "k":
+		m.picker.cursor = max(m.picker.cursor-1, 0)
+	case "down", "j":
+		m.picker.cursor = min(m.picker.cursor+1, len(m.picker.models)-1)
+	case "enter":
+		m.setModel(m.picker.models[m.picker.cursor])
+		m.picker = nil
+	case "esc", "ctrl+o":
+		m.picker = nil
+	case "ctrl+c":
+		return tea.Quit
+	}
+	m.render()
+	return nil
+}
+
+// setModel switches the model of the session. The model answers the next
+// question with the history of the session.
+func (m *chatModel) setModel(model string) {
+	sess := m.session()
+	sess.model = model
+	sess.conversation.Model = model
+
+	cfg := *m.cfg
+	cfg.SetModel(model)
+	sess.conversation.MaxTokens = contextWindow(&cfg)
+	m.status = "Switched to " + model
+}
+
+// submit sends the question in the input box, or runs a command: /model NAME
+// switches the model of the session
+func (m *chatModel) submit() tea.Cmd {
+	question := strings.TrimSpace(m.input.Value())
+	if question == "" || m.events != nil {
+		return nil
+	}
+	m.input.Reset()
+	m.history = append(m.history, question)
+	m.historyIndex = len(m.history)
+
+	if model, ok := strings.CutPrefix(question, "/model "); ok {
+		m.setModel(strings.TrimSpace(model))
+		m.render()
+		return nil
+	}
+
+	sess := m.session()
+	m.addEntry(chatEntry{role: "user", text: question})
+	m.addEntry(chatEntry{role: "assistant", model: sess.model})
+	m.render()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	m.events, m.cancel = make(chan tea.Msg, 64), cancel
+	go ask(ctx, m.cfg, m.system, sess, question, m.events)
+	return waitForChatEvent(m.events)
+}
+
+// ask answers the question in the session, sending the chunks of the answer
+// and then the outcome to events
+func ask(ctx context.Context, base *config.Config, system string, sess *chatSession, question string, events chan<- tea.Msg) {
+	defer close(events)
+
+	cfg := *base
+	cfg.SetModel(sess.model)
+	provider, err := llm.NewProvider(&cfg)
+	if err != nil {
+		events <- chatAnswerMsg{err: fmt.Errorf("error creating LLM provider: %w", err)}
+		return
+	}
+	useSystemPrompt(provider, system)
+	var usage usageTracker
+	usage.track(provider)
+
+	_, err = sess.conversation.SendStream(ctx, provider, question, func(chunk string) error {
+		events <- chatChunkMsg(chunk)
+		return nil
+	})
+	usage.save(modelName(&cfg))
+	events <- chatAnswerMsg{err: err}
+}
+
+// waitForChatEvent waits for the next chunk or the outcome of the answer
+func waitForChatEvent(events <-chan tea.Msg) tea.Cmd {
+	return func() tea.Msg {
+		msg, ok := <-events
+		if !ok {
+			return nil
+		}
+		return msg
+	}
+}
+
+// listModels lists the models of the provider for the picker
+func (m *chatModel) listModels() tea.Cmd {
+	cfg := *m.cfg
+	return func() tea.Msg {
+		provider, err := llm.NewProvider(&cfg)
+		if err != nil {
+			return chatModelsMsg{err: err}
+		}
+		lister, ok := provider.(llm.ModelLister)
+		if !ok {
+			return chatModelsMsg{err: fmt.Errorf("the provider can't list its models, type /model NAME")}
+		}
+		models, err := lister.ListModels(context.Background())
+		return chatModelsMsg{models: models, err: err}
+	}
+}
+
+// addEntry adds a message to the conversation view of the session
+func (m *chatModel) addEntry(entry chatEntry) {
+	sess := m.session()
+	sess.entries = append(sess.entries, entry)
+}
+
+// render updates the conversation view, following the end of the
+// conversation unless the user scrolled up
+func (m *chatModel) render() {
+	if m.width == 0 {
+		return
+	}
+
+	atBottom := m.viewport.AtBottom()
+	wrap := lipgloss.NewStyle().Width(m.width)
+	var b strings.Builder
+	if m.picker != nil {
+		b.WriteString(m.caps.Bold("Select the model of the session") + "\n\n")
+		for i, model := range m.picker.models {
+			if i == m.picker.cursor {
+				b.WriteString(m.caps.Foreground("> "+model, termcap.Green) + "\n")
+			} else {
+				b.WriteString("  " + model + "\n")
+			}
+		}
+		m.viewport.SetContent(b.String())
+		m.viewport.SetYOffset(m.picker.cursor - m.viewport.Height/2)
+		return
+	}
+
+	for _, entry := range m.session().entries {
+		switch {
+		case entry.failed:
+			b.WriteString(m.caps.Foreground(wrap.Render("Error: "+entry.text), termcap.Red) + "\n\n")
+			continue
+		case entry.role == "user":
+			b.WriteString(m.caps.Bold(m.caps.Foreground("You", termcap.Cyan)) + "\n")
+		default:
+			b.WriteString(m.caps.Bold(m.caps.Foreground(entry.model, termcap.Green)) + "\n")
+		}
+		b.WriteString(wrap.Render(strings.TrimRight(entry.text, "\n")) + "\n\n")
+	}
+	m.viewport.SetContent(b.String())
+	if atBottom {
+		m.viewport.GotoBottom()
+	}
+}
+
+// View implements tea.Model
+func (m *chatModel) View() string {
+	if m.width == 0 {
+		return ""
+	}
+
+	header := fmt.Sprintf("si · session %d/%d · %s", m.current+1, len(m.sessions), m.session().model)
+	if m.events != nil {
+		header += " · answering"
+	}
+	footer := m.status
+	if footer == "" {
+		footer = tuiHelp
+	}
+	footer = lipgloss.NewStyle().MaxWidth(m.width).Render(footer)
+
+	return strings.Join([]string{
+		m.caps.Bold(lipgloss.NewStyle().MaxWidth(m.width).Render(header)),
+		m.viewport.View(),
+		m.input.View(),
+		m.caps.Dim(footer),
+	}, "\n")
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"errors"
+	"regexp"
+	"testing"
+
+	"github.com/Turee/si/pkg/config"
+	"github.com/Turee/si/pkg/termcap"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeTUIProgram records the model instead of running it
+type fakeTUIProgram struct {
+	model tea.Model
+}
+
+func (p *fakeTUIProgram) Run() (tea.Model, error) {
+	return p.model, nil
+}
+
+// newTestChat creates a chat sized like a terminal
+func newTestChat(t *testing.T) *chatModel {
+	t.Helper()
+
+	cfg := &config.Config{LLM: config.LLMConfig{OpenAI: config.OpenAIConfig{APIKey: "test-api-key", ModelName: "gpt-4o"}}}
+	m := newChatModel(cfg, "", termcap.Capabilities{})
+	m.Update(tea.WindowSizeMsg{Width: 80, Height: 24})
+	return m
+}
+
+// trailingSpace matches the padding of the lines of the view
+var trailingSpace = regexp.MustCompile(`(?m) +$`)
+
+// chatView returns the view of the chat without the padding of its lines
+func chatView(m *chatModel) string {
+	return trailingSpace.ReplaceAllString(m.View(), "")
+}
+
+// runChatCmd feeds the messages of the command back into the chat until no
+// command is left
+func runChatCmd(m *chatModel, cmd tea.Cmd) {
+	for cmd != nil {
+		msg := cmd()
+		if msg == nil {
+			return
+		}
+		_, cmd = m.Update(msg)
+	}
+}
+
+// typeQuestion types the question and presses enter
+func typeQuestion(m *chatModel, question string) {
+	m.input.SetValue(question)
+	_, cmd := m.Update(tea.KeyMsg{Type: tea.KeyEnter})
+	runChatCmd(m, cmd)
+}
+
+// TestTUIChat tests asking questions with the history of the session
+func TestTUIChat(t *testing.T) {
+	provider := mockCommandEnvironment(t, "", true, "")
+	provider.AskStreamChunks = []string{"Ber", "lin"}
+	mockUsagePath(t)
+
+	m := newTestChat(t)
+	typeQuestion(m, "capital of Germany?")
+	view := m.View()
+	assert.Contains(t, view, "You")
+	assert.Contains(t, view, "capital of Germany?")
+	assert.Contains(t, view, "Berlin")
+	assert.Contains(t, view, "session 1/1 · gpt-4o")
+	assert.Empty(t, m.input.Value())
+
+	typeQuestion(m, "and of France?")
+	require.Len(t, provider.MessagesSent, 3)
+	assert.Equal(t, "capital of Germany?", provider.MessagesSent[0].Text())
+	assert.Equal(t, "Berlin", provider.MessagesSent[1].Text())
+	assert.Equal(t, "and of France?", provider.MessagesSent[2].Text())
+
+	m.Update(tea.KeyMsg{Type: tea.KeyUp})
+	assert.Equal(t, "and of France?", m.input.Value())
+	m.Update(tea.KeyMsg{Type: tea.KeyUp})
+	assert.Equal(t, "capital of Germany?", m.input.Value())
+	m.Update(tea.KeyMsg{Type: tea.KeyDown})
+	m.Update(tea.KeyMsg{Type: tea.KeyDown})
+	assert.Empty(t, m.input.Value())
+}
+
+// TestTUIError tests that a failed answer is shown and left out of the history
+func TestTUIError(t *testing.T) {
+	provider := mockCommandEnvironment(t, "", true, "")
+	provider.AskStreamError = errors.New("connection reset")
+	mockUsagePath(t)
+
+	m := newTestChat(t)
+	typeQuestion(m, "capital of Germany?")
+	assert.Contains(t, m.View(), "Error: connection reset")
+	assert.Nil(t, m.events)
+
+	provider.AskStreamError = nil
+	provider.AskStreamChunks = []string{"Berlin"}
+	typeQuestion(m, "capital of Germany?")
+	assert.Len(t, provider.MessagesSent, 1)
+}
+
+// TestTUISessions tests starting and switching sessions
+func TestTUISessions(t *testing.T) {
+	provider := mockCommandEnvironment(t, "", true, "")
+	provider.AskStreamChunks = []string{"Berlin"}
+	mockUsagePath(t)
+
+	m := newTestChat(t)
+	typeQuestion(m, "capital of Germany?")
+
+	m.Update(tea.KeyMsg{Type: tea.KeyCtrlN})
+	assert.Contains(t, m.View(), "session 2/2")
+	assert.NotContains(t, m.View(), "Berlin")
+
+	provider.AskStreamChunks = []string{"Paris"}
+	typeQuestion(m, "capital of France?")
+	assert.Len(t, provider.MessagesSent, 1)
+
+	m.Update(tea.KeyMsg{Type: tea.KeyTab})
+	assert.Contains(t, m.View(), "session 1/2")
+	assert.Contains(t, m.View(), "Berlin")
+	assert.NotContains(t, m.View(), "Paris")
+
+	m.Update(tea.KeyMsg{Type: tea.KeyShiftTab})
+	assert.Contains(t, m.View(), "Paris")
+}
+
+// TestTUIModel tests switching the model of the session
+func TestTUIModel(t *testing.T) {
+	mockModelProvider(t, "gpt-4o", "gpt-4o-mini")
+	mockUsagePath(t)
+
+	m := newTestChat(t)
+	_, cmd := m.Update(tea.KeyMsg{Type: tea.KeyCtrlO})
+	runChatCmd(m, cmd)
+	require.NotNil(t, m.picker)
+	assert.Contains(t, chatView(m), "> gpt-4o\n")
+
+	m.Update(tea.KeyMsg{Type: tea.KeyDown})
+	m.Update(tea.KeyMsg{Type: tea.KeyEnter})
+	assert.Nil(t, m.picker)
+	assert.Contains(t, m.View(), "session 1/1 · gpt-4o-mini")
+
+	typeQuestion(m, "hello")
+	assert.Contains(t, m.View(), "answer from gpt-4o-mini")
+
+	typeQuestion(m, "/model gpt-4o")
+	typeQuestion(m, "hello again")
+	assert.Contains(t, chatView(m), "gpt-4o-mini\nanswer from gpt-4o-mini")
+	assert.Contains(t, chatView(m), "gpt-4o\nanswer from gpt-4o\n")
+}
+
+// TestTUICommand tests that the chat only opens in a terminal
+func TestTUICommand(t *testing.T) {
+	mockCommandEnvironment(t, "", false, "")
+
+	_, stderr := runMainOutput(t, "tui")
+	assert.Contains(t, stderr, "Error: si tui needs a terminal")
+
+	mockCommandEnvironment(t, "", true, "")
+	program := &fakeTUIProgram{}
+	oldNewTUIProgram := newTUIProgram
+	t.Cleanup(func() { newTUIProgram = oldNewTUIProgram })
+	newTUIProgram = func(model tea.Model) interface{ Run() (tea.Model, error) } {
+		program.model = model
+		return program
+	}
+
+	runMainOutput(t, "tui")
+	require.IsType(t, &chatModel{}, program.model)
+	assert.Equal(t, modelName(program.model.(*chatModel).cfg), program.model.(*chatModel).session().model)
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/Turee/si/pkg/config"
+	"github.com/Turee/si/pkg/fetch"
+	"github.com/Turee/si/pkg/prompt"
+	"github.com/Turee/si/pkg/tokens"
+)
+
+// fetchTimeout limits how long fetching a page for --url may take
+const fetchTimeout = 30 * time.Second
+
+// pageCacheDir returns the directory of the page cache
+var pageCacheDir = fetch.DefaultPageCacheDir
+
+// backticks matches runs of backticks, which the fence around a page must be
+// longer than
+var backticks = regexp.MustCompile("`{3,}")
+
+// attachURLs fetches the pages of --url and appends their readable text to
+// the question as framed context. Pages are cached unless --no-cache or
+// --ephemeral is given, and text beyond fetch.max_tokens is cut off.
+func attachURLs(ctx context.Context, cfg *config.Config, question string) (string, error) {
+	if len(CLI.URL) == 0 {
+		return question, nil
+	}
+
+	policy := cfg.Fetch.Policy(false)
+	client := policy.Client(&http.Client{Timeout: fetchTimeout})
+	dir := pageCacheDir()
+	if CLI.NoCache || CLI.Ephemeral {
+		dir = ""
+	}
+	cache := fetch.NewPageCache(dir, cfg.Fetch.PageTTL())
+	limit := 4 * cfg.Fetch.PageTokens()
+
+	var parts []string
+	if question != "" {
+		parts = append(parts, question)
+	}
+	for _, rawURL := range CLI.URL {
+		if err := policy.Check(rawURL); err != nil {
+			return "", err
+		}
+
+		page, ok := cache.Load(rawURL)
+		if !ok {
+			var err error
+			if page, err = fetch.Get(ctx, client, rawURL); err != nil {
+				return "", err
+			}
+			if err := cache.Store(page); err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: failed to cache %s: %v\n", rawURL, err)
+			}
+		}
+		if strings.TrimSpace(page.Text) == "" {
+			return "", fmt.Errorf("%s has no readable text", rawURL)
+		}
+
+		text := page.Text
+		if len(text) > limit {
+			fmt.Fprintf(os.Stderr, "Warning: %s has about %d tokens, keeping the first %d (see fetch.max_tokens)\n",
+				rawURL, tokens.Estimate(text), limit/4)
+			text = prompt.Truncate(text, limit, prompt.TruncateHead).Join("")
+		}
+		parts = append(parts, framePage(page, text))
+	}
+	return strings.Join(parts, "\n\n"), nil
+}
+
+// framePage frames the text of a page with its URL and title in a fence that
+// code blocks in the text can't close
+func framePage(page fetch.Page, text string) string {
+	fence := fenceFor(text)
+	heading := "Content of " + page.URL
+	if page.Title != "" {
+		heading += fmt.Sprintf(" (%s)", page.Title)
+	}
+	return fmt.Sprintf("%s:\n%s\n%s\n%s", heading, fence, strings.TrimRight(text, "\n"), fence)
+}
+
+// fenceFor returns a fence longer than any run of backticks in the text
+func fenceFor(text string) string {
+	fence := "```"
+	for _, run := range backticks.FindAllString(text, -1) {
+		if len(run) >= len(fence) {
+			fence = strings.Repeat("`", len(run)+1)
+		}
+	}
+	return fence
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Turee/si/pkg/config"
+	"github.com/Turee/si/pkg/fetch"
+	"github.com/stretchr/testify/assert"
+)
+
+// mockPageServer serves HTML pages by path and counts the requests
+func mockPageServer(t *testing.T, pages map[string]string) (*httptest.Server, *int) {
+	t.Helper()
+
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		page, ok := pages[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(page))
+	}))
+	t.Cleanup(server.Close)
+
+	oldPageCacheDir := pageCacheDir
+	t.Cleanup(func() { pageCacheDir = oldPageCacheDir })
+	dir := t.TempDir()
+	pageCacheDir = func() string { return dir }
+	return server, &requests
+}
+
+// TestURLContext tests adding the text of web pages to the question
+func TestURLContext(t *testing.T) {
+	provider := mockCommandEnvironment(t, "Answer", false, "")
+	mockUsagePath(t)
+	server, requests := mockPageServer(t, map[string]string{
+		"/release": "<title>Release</title><nav>Menu</nav><main><h1>2.0</h1><p>Faster builds.</p></main>",
+		"/docs":    "<p>Use <code>```</code> fences.</p>",
+	})
+	t.Cleanup(func() { CLI.URL, CLI.NoCache = nil, false })
+
+	runMain(t, "--no-stream", "--url", server.URL+"/release", "summarize")
+	assert.Equal(t, "summarize\n\nContent of "+server.URL+"/release (Release):\n```\n# 2.0\n\nFaster builds.\n```", provider.QuestionAsked)
+	assert.Equal(t, 1, *requests)
+
+	// Pages are cached, unless --no-cache is given
+	runMain(t, "--no-stream", "--url", server.URL+"/release", "summarize")
+	assert.Equal(t, 1, *requests)
+	runMain(t, "--no-stream", "--no-cache", "--url", server.URL+"/release", "summarize")
+	assert.Equal(t, 2, *requests)
+
+	// Several pages can be given, and fences in the text are kept intact
+	runMain(t, "--no-stream", "--url", server.URL+"/release", "--url", server.URL+"/docs", "contrast")
+	assert.Contains(t, provider.QuestionAsked, "(Release):\n```\n# 2.0\n\nFaster builds.\n```\n\nContent of "+server.URL+"/docs:\n````\nUse ``` fences.\n````")
+
+	_, stderr := runMainOutput(t, "--no-stream", "--url", server.URL+"/missing", "summarize")
+	assert.Contains(t, stderr, "404 Not Found")
+}
+
+// TestURLLimits tests cutting off long pages and blocking untrusted hosts
+func TestURLLimits(t *testing.T) {
+	provider := mockCommandEnvironment(t, "Answer", false, "")
+	mockUsagePath(t)
+	server, _ := mockPageServer(t, map[string]string{
+		"/long": "<p>first paragraph</p><p>second paragraph that is cut off</p>",
+	})
+	t.Cleanup(func() { CLI.URL = nil })
+
+	fetchConfig := config.FetchConfig{MaxTokens: 5}
+	loadConfigFunc = func(path string) (*config.Config, error) {
+		return &config.Config{
+			LLM:   config.LLMConfig{OpenAI: config.OpenAIConfig{APIKey: "test-api-key", ModelName: "gpt-4o"}},
+			Fetch: fetchConfig,
+		}, nil
+	}
+
+	_, stderr := runMainOutput(t, "--no-stream", "--url", server.URL+"/long", "summarize")
+	assert.Contains(t, stderr, "Warning: "+server.URL+"/long has about 13 tokens, keeping the first 5 (see fetch.max_tokens)")
+	assert.Equal(t, "summarize\n\nContent of "+server.URL+"/long:\n```\nfirst paragraph\n\n[... 32 bytes omitted ...]\n```", provider.QuestionAsked)
+
+	fetchConfig = config.FetchConfig{AllowedDomains: []string{"example.com"}}
+	_, stderr = runMainOutput(t, "--no-stream", "--url", server.URL+"/long", "summarize")
+	assert.Contains(t, stderr, "fetching from 127.0.0.1 is not allowed")
+
+	assert.Equal(t, "Content of https://example.com:\n```\ntext\n```", framePage(fetch.Page{URL: "https://example.com"}, "text\n"))
+}
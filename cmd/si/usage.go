@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/Turee/si/pkg/usage"
+)
+
+// UsageCmd reports the recorded token usage and cost
+type UsageCmd struct {
+	Days     int  `name:"days" default:"30" help:"Number of days to report, 0 for all recorded usage"`
+	Sessions bool `name:"sessions" help:"Report the usage per session instead of per day and model"`
+}
+
+// Run prints the usage per day and model, or per session, with totals
+func (c *UsageCmd) Run() error {
+	records, err := usage.Load(usagePath())
+	if err != nil {
+		return err
+	}
+
+	var since time.Time
+	if c.Days > 0 {
+		now := time.Now()
+		since = time.Date(now.Year(), now.Month(), now.Day()-c.Days+1, 0, 0, 0, 0, time.Local)
+	}
+
+	summarize := usage.Summarize
+	if c.Sessions {
+		summarize = usage.SummarizeSessions
+	}
+	summaries, total := summarize(records, since)
+	if total.Requests == 0 {
+		fmt.Fprintln(os.Stderr, "No usage recorded")
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	if c.Sessions {
+		fmt.Fprintln(w, "SESSION\tSTARTED\tMODEL\tREQUESTS\tPROMPT\tCACHED\tCOMPLETION\tCOST")
+		for _, s := range summaries {
+			writeSummary(w, s, s.Session, s.Date, s.Model)
+		}
+		writeSummary(w, total, "TOTAL", "", "")
+		return w.Flush()
+	}
+
+	fmt.Fprintln(w, "DATE\tMODEL\tREQUESTS\tPROMPT\tCACHED\tCOMPLETION\tCOST")
+	for _, s := range summaries {
+		writeSummary(w, s, s.Date, s.Model)
+	}
+	writeSummary(w, total, "TOTAL", "")
+	return w.Flush()
+}
+
+// writeSummary writes a row of the usage table, starting with the columns
+// naming what is summarized
+func writeSummary(w io.Writer, s usage.Summary, columns ...string) {
+	cached := fmt.Sprintf("%d (%.0f%%)", s.CachedTokens, s.CacheHitRate()*100)
+
+	// Requests to models with unknown prices are not part of the cost
+	cost := fmt.Sprintf("$%.4f", s.Cost)
+	if s.Unpriced == s.Requests {
+		cost = "-"
+	} else if s.Unpriced > 0 {
+		cost += "+"
+	}
+
+	fmt.Fprintf(w, "%s\t%d\t%d\t%s\t%d\t%s\n",
+		strings.Join(columns, "\t"), s.Requests, s.PromptTokens, cached, s.CompletionTokens, cost)
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Turee/si/pkg/config"
+	"github.com/Turee/si/pkg/llm"
+	"github.com/Turee/si/pkg/usage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestUsageCommand tests reporting the recorded usage
+func TestUsageCommand(t *testing.T) {
+	path := mockUsagePath(t)
+
+	output, stderr := runMainOutput(t, "usage")
+	assert.Empty(t, output)
+	assert.Equal(t, "No usage recorded\n", stderr)
+
+	old := usage.NewRecord("gpt-4", llm.Usage{PromptTokens: 5000})
+	old.Time = time.Now().AddDate(0, 0, -60)
+	require.NoError(t, usage.Append(path,
+		old,
+		usage.NewRecord("gpt-4", llm.Usage{PromptTokens: 1000, CachedTokens: 250, CompletionTokens: 500}),
+		usage.NewRecord("llama3", llm.Usage{PromptTokens: 10, CompletionTokens: 5}),
+	))
+
+	output = runMain(t, "usage")
+	today := time.Now().Format("2006-01-02")
+	assert.Contains(t, output, today+"  gpt-4   1         1000    250 (25%)  500         $0.0600\n")
+	assert.Contains(t, output, today+"  llama3  1         10      0 (0%)     5           -\n")
+	assert.Contains(t, output, "TOTAL               2         1010")
+	assert.Contains(t, output, "$0.0600+\n")
+
+	// Older usage is included on request
+	output = runMain(t, "usage", "--days", "0")
+	assert.Contains(t, output, "TOTAL               3         6010")
+}
+
+// TestUsageSessions tests recording usage under sessions and reporting the
+// cache hit rate per session
+func TestUsageSessions(t *testing.T) {
+	mockCommandEnvironment(t, "Paris", false, "")
+	provider := &usageProvider{MockProvider: &MockProvider{AskResponse: "Paris"}, usage: llm.Usage{PromptTokens: 1000, CachedTokens: 800, CompletionTokens: 10, TotalTokens: 1010}}
+	llm.NewProvider = func(cfg *config.Config) (llm.Provider, error) {
+		return provider, nil
+	}
+	mockUsagePath(t)
+	t.Cleanup(func() { CLI.Session = "" })
+
+	runMain(t, "capital", "of", "France?")
+	runMain(t, "--session", "docs", "capital", "of", "France?")
+	runMain(t, "--session", "docs", "capital", "of", "France?")
+
+	output := runMain(t, "usage", "--sessions")
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	require.Len(t, lines, 4)
+	assert.Regexp(t, `^SESSION\s+STARTED\s+MODEL\s+REQUESTS`, lines[0])
+	assert.Regexp(t, `^\d{8}-\d{6}-[0-9a-f]{6} .* 1 +1000 +800 \(80%\)`, lines[1])
+	assert.Regexp(t, `^docs .* 2 +2000 +1600 \(80%\)`, lines[2])
+	assert.Regexp(t, `^TOTAL .* 3 +3000 +2400 \(80%\)`, lines[3])
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/Turee/si/pkg/version"
+)
+
+// VersionCmd prints version information
+type VersionCmd struct {
+	JSON bool `name:"json" help:"Print version information as JSON"`
+}
+
+// Run prints the version information
+func (c *VersionCmd) Run() error {
+	if !c.JSON {
+		printVersion()
+		return nil
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(version.Get())
+}
+
+// printVersion prints the version information in a human readable format
+func printVersion() {
+	info := version.Get()
+	fmt.Println("si version", version.Info())
+	fmt.Printf("Go: %s %s/%s\n", info.GoVersion, info.OS, info.Arch)
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"encoding/json"
+	"runtime"
+	"testing"
+
+	"github.com/Turee/si/pkg/version"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestVersionCommandJSON tests printing version information as JSON
+func TestVersionCommandJSON(t *testing.T) {
+	output := runMain(t, "version", "--json")
+
+	var info version.BuildInfo
+	require.NoError(t, json.Unmarshal([]byte(output), &info))
+	assert.NotEmpty(t, info.Version)
+	assert.Equal(t, runtime.GOOS, info.OS)
+	assert.Equal(t, runtime.GOARCH, info.Arch)
+}
+
+// TestVersionCommand tests printing human readable version information
+func TestVersionCommand(t *testing.T) {
+	output := runMain(t, "version")
+	assert.Contains(t, output, "si version Version:")
+	assert.Contains(t, output, runtime.GOOS+"/"+runtime.GOARCH)
+}
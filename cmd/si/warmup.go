@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/Turee/si/pkg/config"
+	"github.com/Turee/si/pkg/llm"
+	"github.com/alecthomas/kong"
+)
+
+// warmupQuestion is the question sent to load the model, the answer is
+// limited to a single token
+const warmupQuestion = "Reply with OK."
+
+// WarmupCmd sends a tiny request to the provider so a local model is loaded
+// into memory before the first real question
+type WarmupCmd struct {
+	KeepAlive string `name:"keep-alive" placeholder:"DURATION" help:"How long Ollama keeps the model loaded afterwards, e.g. 30m, or -1 to keep it until it is stopped"`
+}
+
+// Run sends the warm-up request and reports how long loading the model took
+func (c *WarmupCmd) Run(kongCtx *kong.Context) error {
+	if c.KeepAlive != "" && !validKeepAlive(c.KeepAlive) {
+		return fmt.Errorf("invalid --keep-alive %q, use a duration like 30m or a number of seconds", c.KeepAlive)
+	}
+
+	cfg := loadConfiguration(kongCtx)
+	if cfg == nil {
+		return nil
+	}
+	warmupCfg := *cfg
+	warmupCfg.SetSampling(config.SamplingConfig{MaxTokens: 1})
+
+	provider, err := llm.NewProvider(&warmupCfg)
+	if err != nil {
+		return fmt.Errorf("error creating LLM provider: %w", err)
+	}
+	if c.KeepAlive != "" {
+		hookable, ok := provider.(llm.HookableProvider)
+		if !ok {
+			return fmt.Errorf("the configured provider does not support --keep-alive")
+		}
+		hookable.SetRequestHook(keepAliveHook(c.KeepAlive))
+	}
+	var usage usageTracker
+	usage.track(provider)
+
+	ctx, stop := notifyInterrupt(context.Background())
+	defer stop()
+
+	start := now()
+	_, err = provider.Chat(ctx, []llm.Message{llm.NewUserMessage(warmupQuestion)})
+	usage.save(modelName(&warmupCfg))
+	if err != nil {
+		return fmt.Errorf("error warming up %s: %w", modelName(&warmupCfg), err)
+	}
+
+	fmt.Fprintf(os.Stderr, "%s is ready (%s)\n", modelName(&warmupCfg), now().Sub(start).Round(time.Millisecond))
+	return nil
+}
+
+// validKeepAlive reports whether Ollama accepts the keep-alive value: a
+// duration or a number of seconds, negative to keep the model loaded
+func validKeepAlive(value string) bool {
+	if _, err := strconv.Atoi(value); err == nil {
+		return true
+	}
+	_, err := time.ParseDuration(value)
+	return err == nil
+}
+
+// keepAliveHook returns a request hook that asks Ollama to keep the model
+// loaded for the duration. Numbers are sent as numbers of seconds.
+func keepAliveHook(value string) llm.RequestHook {
+	return func(payload map[string]interface{}) (map[string]interface{}, error) {
+		if seconds, err := strconv.Atoi(value); err == nil {
+			payload["keep_alive"] = seconds
+		} else {
+			payload["keep_alive"] = value
+		}
+		return payload, nil
+	}
+}
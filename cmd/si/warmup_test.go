@@ -0,0 +1,76 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Turee/si/pkg/config"
+	"github.com/Turee/si/pkg/llm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// hookableMockProvider is a MockProvider that supports request hooks
+type hookableMockProvider struct {
+	MockProvider
+	hook llm.RequestHook
+}
+
+// SetRequestHook implements the HookableProvider interface
+func (p *hookableMockProvider) SetRequestHook(hook llm.RequestHook) {
+	p.hook = hook
+}
+
+// TestWarmup tests loading the model with a single-token request that keeps
+// it loaded
+func TestWarmup(t *testing.T) {
+	mockCommandEnvironment(t, "", false, "")
+	mockUsagePath(t)
+
+	oldNow := now
+	t.Cleanup(func() { now = oldNow })
+	start := time.Date(2025, 3, 14, 12, 0, 0, 0, time.UTC)
+	calls := 0
+	now = func() time.Time {
+		calls++
+		return start.Add(time.Duration(calls-1) * 1500 * time.Millisecond)
+	}
+
+	provider := &hookableMockProvider{MockProvider: MockProvider{AskResponse: "OK"}}
+	var usedCfg *config.Config
+	llm.NewProvider = func(cfg *config.Config) (llm.Provider, error) {
+		usedCfg = cfg
+		return provider, nil
+	}
+
+	output, stderr := runMainOutput(t, "-m", "llama3.2", "warmup", "--keep-alive", "30m")
+	assert.Empty(t, output)
+	assert.Equal(t, "llama3.2 is ready (1.5s)\n", stderr)
+	assert.Equal(t, warmupQuestion, provider.QuestionAsked)
+	assert.Equal(t, 1, usedCfg.LLM.OpenAI.MaxTokens)
+
+	require.NotNil(t, provider.hook)
+	payload, err := provider.hook(map[string]interface{}{})
+	require.NoError(t, err)
+	assert.Equal(t, "30m", payload["keep_alive"])
+
+	// Numbers are seconds
+	payload, _ = keepAliveHook("-1")(map[string]interface{}{})
+	assert.Equal(t, -1, payload["keep_alive"])
+}
+
+// TestWarmupErrors tests invalid keep-alive values and providers that can't
+// pass them on
+func TestWarmupErrors(t *testing.T) {
+	mockCommandEnvironment(t, "OK", false, "")
+	mockUsagePath(t)
+
+	_, stderr := runMainOutput(t, "warmup", "--keep-alive", "forever")
+	assert.Contains(t, stderr, `invalid --keep-alive "forever"`)
+
+	_, stderr = runMainOutput(t, "warmup", "--keep-alive", "5m")
+	assert.Contains(t, stderr, "the configured provider does not support --keep-alive")
+
+	_, stderr = runMainOutput(t, "warmup")
+	assert.Contains(t, stderr, config.DefaultModelName+" is ready")
+}
@@ -0,0 +1,212 @@
+// Package cache stores answers so that repeated questions can be answered
+// without asking the provider again
+package cache
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/Turee/si/pkg/paths"
+	"github.com/Turee/si/pkg/state"
+)
+
+// Entry is a cached answer
+type Entry struct {
+	Time   time.Time `json:"time"`
+	Model  string    `json:"model"`
+	Prompt string    `json:"prompt"`
+	Answer string    `json:"answer"`
+
+	// Embedding is the embedding of the prompt for semantic lookups, computed
+	// with EmbeddingModel
+	Embedding      []float32 `json:"embedding,omitempty"`
+	EmbeddingModel string    `json:"embedding_model,omitempty"`
+}
+
+// Cache is a cache of answers backed by a JSON lines file
+type Cache struct {
+	path    string
+	entries []Entry
+}
+
+// DefaultPath returns the default path of the cache, in paths.CacheDir.
+// A cache at the legacy path is used until MoveLegacy moves it.
+func DefaultPath() string {
+	return paths.Resolve(cacheFile(paths.CacheDir()), cacheFile(paths.LegacyCacheDir()))
+}
+
+// MoveLegacy moves a cache from ~/.cache/si to the default path, keeping the
+// cached answers. It returns the new path if the cache was moved.
+func MoveLegacy() (string, error) {
+	path := cacheFile(paths.CacheDir())
+	moved, err := paths.MoveLegacy(cacheFile(paths.LegacyCacheDir()), path)
+	if !moved {
+		return "", err
+	}
+	return path, err
+}
+
+// cacheFile returns the path of the cache in dir
+func cacheFile(dir string) string {
+	if dir == "" {
+		return ""
+	}
+	return filepath.Join(dir, "responses.jsonl")
+}
+
+// Open loads the cache at path. Entries older than ttl are dropped from the
+// file; a ttl of zero keeps entries forever. A missing file is an empty
+// cache, and lines that can't be parsed are skipped.
+func Open(path string, ttl time.Duration) (*Cache, error) {
+	c := &Cache{path: path}
+
+	file, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open cache: %w", err)
+	}
+	defer file.Close()
+
+	expired := false
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	for scanner.Scan() {
+		var entry Entry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			continue
+		}
+		if ttl > 0 && time.Since(entry.Time) > ttl {
+			expired = true
+			continue
+		}
+		c.entries = append(c.entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read cache: %w", err)
+	}
+
+	// In read-only mode expired entries are only dropped from memory
+	if expired && !state.ReadOnly() {
+		if err := c.rewrite(); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// Lookup returns the newest answer of the model to exactly the same prompt,
+// ignoring surrounding whitespace
+func (c *Cache) Lookup(model, prompt string) (Entry, bool) {
+	prompt = strings.TrimSpace(prompt)
+	for i := len(c.entries) - 1; i >= 0; i-- {
+		entry := c.entries[i]
+		if entry.Model == model && strings.TrimSpace(entry.Prompt) == prompt {
+			return entry, true
+		}
+	}
+	return Entry{}, false
+}
+
+// LookupSimilar returns the answer of the model to the prompt whose embedding
+// is most similar to the given one, if its cosine similarity is at least
+// threshold. Only embeddings computed with the same embedding model are
+// compared.
+func (c *Cache) LookupSimilar(model, embeddingModel string, embedding []float32, threshold float64) (Entry, float64, bool) {
+	var best Entry
+	bestSimilarity := -1.0
+	for _, entry := range c.entries {
+		if entry.Model != model || entry.EmbeddingModel != embeddingModel {
+			continue
+		}
+		if similarity := Similarity(entry.Embedding, embedding); similarity > bestSimilarity {
+			best, bestSimilarity = entry, similarity
+		}
+	}
+
+	if bestSimilarity < threshold {
+		return Entry{}, 0, false
+	}
+	return best, bestSimilarity, true
+}
+
+// Add adds an entry to the cache and appends it to the file. In read-only
+// mode the entry is only kept in memory.
+func (c *Cache) Add(entry Entry) error {
+	if state.ReadOnly() {
+		c.entries = append(c.entries, entry)
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(c.path), 0755); err != nil {
+		return fmt.Errorf("failed to create cache directory: %w", err)
+	}
+
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to encode cache entry: %w", err)
+	}
+
+	file, err := os.OpenFile(c.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open cache: %w", err)
+	}
+	defer file.Close()
+
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to write cache: %w", err)
+	}
+
+	c.entries = append(c.entries, entry)
+	return nil
+}
+
+// rewrite replaces the file with the entries in memory
+func (c *Cache) rewrite() error {
+	var data []byte
+	for _, entry := range c.entries {
+		line, err := json.Marshal(entry)
+		if err != nil {
+			return fmt.Errorf("failed to encode cache entry: %w", err)
+		}
+		data = append(append(data, line...), '\n')
+	}
+
+	// Write to a temporary file first so the cache is never left truncated
+	tmp := c.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("failed to write cache: %w", err)
+	}
+	if err := os.Rename(tmp, c.path); err != nil {
+		return fmt.Errorf("failed to write cache: %w", err)
+	}
+	return nil
+}
+
+// Similarity returns the cosine similarity of two vectors, or zero if they
+// differ in length or either is zero
+func Similarity(a, b []float32) float64 {
+	if len(a) != len(b) || len(a) == 0 {
+		return 0
+	}
+
+	var dot, normA, normB float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		normA += float64(a[i]) * float64(a[i])
+		normB += float64(b[i]) * float64(b[i])
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(normA) * math.Sqrt(normB))
+}
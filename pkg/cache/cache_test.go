@@ -0,0 +1,106 @@
+package cache
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Turee/si/pkg/state"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestCacheLookup tests exact and similar lookups
+func TestCacheLookup(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "si", "responses.jsonl")
+
+	c, err := Open(path, time.Hour)
+	require.NoError(t, err)
+
+	_, ok := c.Lookup("gpt-4o", "capital of France?")
+	assert.False(t, ok)
+
+	require.NoError(t, c.Add(Entry{Time: time.Now(), Model: "gpt-4o", Prompt: "capital of France?", Answer: "Paris",
+		Embedding: []float32{1, 0, 0}, EmbeddingModel: "small"}))
+	require.NoError(t, c.Add(Entry{Time: time.Now(), Model: "gpt-4o", Prompt: "capital of Spain?", Answer: "Madrid",
+		Embedding: []float32{0, 1, 0}, EmbeddingModel: "small"}))
+
+	// Entries are read back from the file
+	c, err = Open(path, time.Hour)
+	require.NoError(t, err)
+
+	entry, ok := c.Lookup("gpt-4o", " capital of France?\n")
+	require.True(t, ok)
+	assert.Equal(t, "Paris", entry.Answer)
+
+	_, ok = c.Lookup("gpt-4o-mini", "capital of France?")
+	assert.False(t, ok)
+
+	entry, similarity, ok := c.LookupSimilar("gpt-4o", "small", []float32{0.9, 0.1, 0}, 0.95)
+	require.True(t, ok)
+	assert.Equal(t, "Paris", entry.Answer)
+	assert.InDelta(t, 0.994, similarity, 0.001)
+
+	_, _, ok = c.LookupSimilar("gpt-4o", "small", []float32{0.5, 0.5, 0}, 0.95)
+	assert.False(t, ok)
+
+	_, _, ok = c.LookupSimilar("gpt-4o", "large", []float32{1, 0, 0}, 0.95)
+	assert.False(t, ok)
+}
+
+// TestCacheExpiry tests that expired entries are dropped from the file
+func TestCacheExpiry(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "responses.jsonl")
+	old := time.Now().Add(-2 * time.Hour)
+	require.NoError(t, os.WriteFile(path, []byte(strings.Join([]string{
+		`{"time":"` + old.Format(time.RFC3339) + `","model":"gpt-4o","prompt":"old","answer":"old"}`,
+		`not json`,
+		`{"time":"` + time.Now().Format(time.RFC3339) + `","model":"gpt-4o","prompt":"new","answer":"new"}`,
+	}, "\n")+"\n"), 0600))
+
+	c, err := Open(path, time.Hour)
+	require.NoError(t, err)
+
+	_, ok := c.Lookup("gpt-4o", "old")
+	assert.False(t, ok)
+	_, ok = c.Lookup("gpt-4o", "new")
+	assert.True(t, ok)
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, 1, strings.Count(string(data), "\n"))
+	assert.Contains(t, string(data), `"prompt":"new"`)
+}
+
+// TestCacheReadOnly tests that the file is left alone in read-only mode
+func TestCacheReadOnly(t *testing.T) {
+	state.SetReadOnly(true)
+	defer state.SetReadOnly(false)
+
+	path := filepath.Join(t.TempDir(), "responses.jsonl")
+	expired := `{"time":"` + time.Now().Add(-2*time.Hour).Format(time.RFC3339) + `","model":"gpt-4o","prompt":"old","answer":"old"}` + "\n"
+	require.NoError(t, os.WriteFile(path, []byte(expired), 0600))
+
+	c, err := Open(path, time.Hour)
+	require.NoError(t, err)
+	require.NoError(t, c.Add(Entry{Time: time.Now(), Model: "gpt-4o", Prompt: "new", Answer: "new"}))
+
+	// The entry is used for the rest of the run
+	_, ok := c.Lookup("gpt-4o", "new")
+	assert.True(t, ok)
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, expired, string(data))
+}
+
+// TestSimilarity tests the cosine similarity
+func TestSimilarity(t *testing.T) {
+	assert.InDelta(t, 1, Similarity([]float32{1, 2}, []float32{2, 4}), 1e-9)
+	assert.InDelta(t, 0, Similarity([]float32{1, 0}, []float32{0, 1}), 1e-9)
+	assert.InDelta(t, -1, Similarity([]float32{1, 0}, []float32{-1, 0}), 1e-9)
+	assert.Equal(t, 0.0, Similarity([]float32{1}, []float32{1, 0}))
+	assert.Equal(t, 0.0, Similarity([]float32{0, 0}, []float32{1, 0}))
+}
@@ -0,0 +1,108 @@
+package clipboard
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// ErrUnavailable is returned when no clipboard tool is available
+var ErrUnavailable = errors.New("no clipboard tool found (install pbcopy, wl-clipboard, xclip or xsel)")
+
+// command is an external program used to access the clipboard
+type command struct {
+	name string
+	args []string
+}
+
+// For testing purposes, we can override these functions
+var (
+	lookPath = exec.LookPath
+	goos     = runtime.GOOS
+	getenv   = os.Getenv
+)
+
+// writeCommands returns the candidate programs that copy stdin to the clipboard
+func writeCommands() []command {
+	switch goos {
+	case "darwin":
+		return []command{{name: "pbcopy"}}
+	case "windows":
+		return []command{{name: "clip.exe"}}
+	}
+
+	var commands []command
+	if getenv("WAYLAND_DISPLAY") != "" {
+		commands = append(commands, command{name: "wl-copy"})
+	}
+	return append(commands,
+		command{name: "xclip", args: []string{"-selection", "clipboard"}},
+		command{name: "xsel", args: []string{"--clipboard", "--input"}},
+	)
+}
+
+// readCommands returns the candidate programs that print the clipboard
+func readCommands() []command {
+	switch goos {
+	case "darwin":
+		return []command{{name: "pbpaste"}}
+	case "windows":
+		return []command{{name: "powershell.exe", args: []string{"-NoProfile", "-Command", "Get-Clipboard -Raw"}}}
+	}
+
+	var commands []command
+	if getenv("WAYLAND_DISPLAY") != "" {
+		commands = append(commands, command{name: "wl-paste", args: []string{"--no-newline"}})
+	}
+	return append(commands,
+		command{name: "xclip", args: []string{"-selection", "clipboard", "-out"}},
+		command{name: "xsel", args: []string{"--clipboard", "--output"}},
+	)
+}
+
+// find returns the first of the commands that is installed
+func find(commands []command) (command, error) {
+	for _, cmd := range commands {
+		if _, err := lookPath(cmd.name); err == nil {
+			return cmd, nil
+		}
+	}
+	return command{}, ErrUnavailable
+}
+
+// Write copies text to the system clipboard
+func Write(text string) error {
+	cmd, err := find(writeCommands())
+	if err != nil {
+		return err
+	}
+
+	c := exec.Command(cmd.name, cmd.args...)
+	c.Stdin = strings.NewReader(text)
+	if out, err := c.CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to copy to clipboard with %s: %w: %s", cmd.name, err, strings.TrimSpace(string(out)))
+	}
+
+	return nil
+}
+
+// Read returns the text on the system clipboard
+func Read() (string, error) {
+	cmd, err := find(readCommands())
+	if err != nil {
+		return "", err
+	}
+
+	var stderr strings.Builder
+	c := exec.Command(cmd.name, cmd.args...)
+	c.Stderr = &stderr
+	out, err := c.Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to paste from clipboard with %s: %w: %s", cmd.name, err, strings.TrimSpace(stderr.String()))
+	}
+
+	return string(out), nil
+}
@@ -0,0 +1,83 @@
+package clipboard
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// withEnvironment fakes the operating system, environment and installed programs
+func withEnvironment(t *testing.T, os string, env map[string]string, installed ...string) {
+	t.Helper()
+
+	oldLookPath, oldGoos, oldGetenv := lookPath, goos, getenv
+	t.Cleanup(func() {
+		lookPath, goos, getenv = oldLookPath, oldGoos, oldGetenv
+	})
+
+	goos = os
+	getenv = func(key string) string { return env[key] }
+	lookPath = func(name string) (string, error) {
+		for _, program := range installed {
+			if program == name {
+				return "/usr/bin/" + name, nil
+			}
+		}
+		return "", errors.New("not found")
+	}
+}
+
+// TestWriteCommandSelection tests choosing the clipboard program per platform
+func TestWriteCommandSelection(t *testing.T) {
+	withEnvironment(t, "darwin", nil, "pbcopy")
+	cmd, err := find(writeCommands())
+	require.NoError(t, err)
+	assert.Equal(t, "pbcopy", cmd.name)
+
+	withEnvironment(t, "linux", map[string]string{"WAYLAND_DISPLAY": "wayland-0"}, "wl-copy", "xclip")
+	cmd, err = find(writeCommands())
+	require.NoError(t, err)
+	assert.Equal(t, "wl-copy", cmd.name)
+
+	withEnvironment(t, "linux", nil, "wl-copy", "xsel")
+	cmd, err = find(writeCommands())
+	require.NoError(t, err)
+	assert.Equal(t, "xsel", cmd.name)
+	assert.Equal(t, []string{"--clipboard", "--input"}, cmd.args)
+
+	withEnvironment(t, "linux", nil)
+	_, err = find(writeCommands())
+	assert.ErrorIs(t, err, ErrUnavailable)
+}
+
+// TestReadCommandSelection tests choosing the program that prints the
+// clipboard per platform
+func TestReadCommandSelection(t *testing.T) {
+	withEnvironment(t, "darwin", nil, "pbpaste")
+	cmd, err := find(readCommands())
+	require.NoError(t, err)
+	assert.Equal(t, "pbpaste", cmd.name)
+
+	withEnvironment(t, "windows", nil, "powershell.exe")
+	cmd, err = find(readCommands())
+	require.NoError(t, err)
+	assert.Equal(t, []string{"-NoProfile", "-Command", "Get-Clipboard -Raw"}, cmd.args)
+
+	withEnvironment(t, "linux", map[string]string{"WAYLAND_DISPLAY": "wayland-0"}, "wl-paste", "xclip")
+	cmd, err = find(readCommands())
+	require.NoError(t, err)
+	assert.Equal(t, "wl-paste", cmd.name)
+	assert.Equal(t, []string{"--no-newline"}, cmd.args)
+
+	withEnvironment(t, "linux", nil, "wl-paste", "xclip")
+	cmd, err = find(readCommands())
+	require.NoError(t, err)
+	assert.Equal(t, "xclip", cmd.name)
+	assert.Equal(t, []string{"-selection", "clipboard", "-out"}, cmd.args)
+
+	withEnvironment(t, "linux", nil)
+	_, err = find(readCommands())
+	assert.ErrorIs(t, err, ErrUnavailable)
+}
@@ -2,63 +2,1327 @@ package config
 
 import (
 	"fmt"
+	"net/url"
 	"os"
 	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+	"time"
 
+	"github.com/Turee/si/pkg/fetch"
+	"github.com/Turee/si/pkg/logging"
+	"github.com/Turee/si/pkg/paths"
+	"github.com/Turee/si/pkg/search"
+	"github.com/Turee/si/pkg/state"
 	"gopkg.in/yaml.v3"
 )
 
+// Default values used when the configuration does not specify them
+const (
+	DefaultBaseURL   = "https://api.openai.com/v1"
+	DefaultModelName = "gpt-4"
+
+	// DefaultAzureAPIVersion is the generally available version of the
+	// Azure OpenAI API used unless azure_api_version is set
+	DefaultAzureAPIVersion = "2024-10-21"
+
+	// OpenRouterBaseURL is the base URL of OpenRouter, which gives access
+	// to the models of many providers with one API key
+	OpenRouterBaseURL = "https://openrouter.ai/api/v1"
+)
+
+// azureAPIVersion matches the api-versions of Azure OpenAI
+var azureAPIVersion = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}(-preview)?$`)
+
+// subagentName matches the names of sub-agents, which become part of the
+// names of their tools
+var subagentName = regexp.MustCompile(`^[A-Za-z0-9_-]{1,48}$`)
+
 // Config represents the application configuration
 type Config struct {
 	LLM LLMConfig `yaml:"llm"`
+
+	// Prompts contains reusable named prompt templates
+	Prompts map[string]PromptConfig `yaml:"prompts,omitempty"`
+
+	// Script is the path of a Starlark script that can modify requests and responses
+	Script string `yaml:"script,omitempty"`
+
+	// Hooks are commands that can change or reject questions and answers
+	Hooks HooksConfig `yaml:"hooks,omitempty"`
+
+	// Redact configures replacing secrets in the input before it is sent
+	Redact RedactConfig `yaml:"redact,omitempty"`
+
+	// Input limits the size of piped input
+	Input InputConfig `yaml:"input,omitempty"`
+
+	// Commit configures commit message generation
+	Commit CommitConfig `yaml:"commit,omitempty"`
+
+	// Review configures the code review of si review
+	Review ReviewConfig `yaml:"review,omitempty"`
+
+	// PR configures the pull request descriptions of si pr
+	PR PRConfig `yaml:"pr,omitempty"`
+
+	// Formats contains named output templates that can be selected with --format
+	Formats map[string]string `yaml:"formats,omitempty"`
+
+	// UI overrides the detected capabilities of the terminal
+	UI UIConfig `yaml:"ui,omitempty"`
+
+	// Cache configures reusing answers to repeated questions
+	Cache CacheConfig `yaml:"cache,omitempty"`
+
+	// Embed configures computing embeddings with si embed
+	Embed EmbedConfig `yaml:"embed,omitempty"`
+
+	// RAG configures indexing files with si index and retrieving them with
+	// --rag
+	RAG RAGConfig `yaml:"rag,omitempty"`
+
+	// Fetch restricts the URLs si fetches
+	Fetch FetchConfig `yaml:"fetch,omitempty"`
+
+	// Search configures the search engine of the web_search tool
+	Search SearchConfig `yaml:"search,omitempty"`
+
+	// Agent configures the tools the model may call with --agent
+	Agent AgentConfig `yaml:"agent,omitempty"`
+
+	// Memory configures the workspace memory file
+	Memory MemoryConfig `yaml:"memory,omitempty"`
+
+	// System configures the system prompt
+	System SystemConfig `yaml:"system,omitempty"`
+
+	// Roles are named instructions that --role adds to the system prompt
+	Roles map[string]string `yaml:"roles,omitempty"`
+
+	// Saved are named queries with {{name}} parameters, run with si saved run
+	Saved map[string]string `yaml:"saved,omitempty"`
+
+	// Profile is the profile used when none is selected with --profile
+	Profile string `yaml:"profile,omitempty"`
+
+	// Profiles are named sets of settings, e.g. for work and personal
+	// accounts, that are applied over the rest of the configuration
+	Profiles map[string]ProfileConfig `yaml:"profiles,omitempty" explain:"-"`
+
+	// LogLevel enables the debug log at debug, info, warn or error level.
+	// --debug sets it to debug.
+	LogLevel string `yaml:"log_level,omitempty"`
+
+	// LogFile is the file the log is appended to instead of stderr
+	LogFile string `yaml:"log_file,omitempty"`
+
+	// Version is the version of the config schema, see CurrentVersion
+	Version int `yaml:"version,omitempty"`
+
+	// missingEnv are the unset environment variables the file referenced
+	missingEnv []string
+
+	// envFallbacks are the settings that were taken from the environment
+	envFallbacks []EnvFallback
+
+	// migration is the migration applied to the file while loading it
+	migration *Migration
+
+	// project is the project config file merged into the config
+	project *Layer
+}
+
+// SystemConfig configures the parts of the system prompt besides the
+// built-in one
+type SystemConfig struct {
+	// Prompt is added to the built-in system prompt of every request
+	Prompt string `yaml:"prompt,omitempty"`
+
+	// Environment describes the operating system, shell, working directory
+	// and date to the model
+	Environment bool `yaml:"environment,omitempty"`
+}
+
+// DefaultMemoryMaxSize is the default size limit of the workspace memory
+// file in bytes
+const DefaultMemoryMaxSize = 16 * 1024
+
+// MemoryConfig configures the workspace memory: the instructions of an SI.md
+// or .si/instructions.md file in the repository, added to every request
+type MemoryConfig struct {
+	// Disabled ignores memory files
+	Disabled bool `yaml:"disabled,omitempty"`
+
+	// MaxSize is the number of bytes of the file that are used (default:
+	// 16384)
+	MaxSize int `yaml:"max_size,omitempty"`
+}
+
+// SizeLimit returns the configured size limit of the memory file or the
+// default
+func (m *MemoryConfig) SizeLimit() int {
+	if m.MaxSize == 0 {
+		return DefaultMemoryMaxSize
+	}
+	return m.MaxSize
+}
+
+// AgentConfig configures agent mode, in which the model calls tools until it
+// can answer the question
+type AgentConfig struct {
+	// Tools lists the built-in tools the model may call (default: all)
+	Tools []string `yaml:"tools,omitempty"`
+
+	// MaxSteps limits the rounds of tool calls per question (default: 10)
+	MaxSteps int `yaml:"max_steps,omitempty"`
+
+	// MaxTokens is the number of tokens a question may use across all its
+	// requests before the user is asked whether to continue; zero means
+	// unlimited
+	MaxTokens int `yaml:"max_tokens,omitempty"`
+
+	// MaxCost is like MaxTokens for the estimated cost in dollars, for models
+	// with known prices
+	MaxCost float64 `yaml:"max_cost,omitempty"`
+
+	// APIs are REST APIs described by OpenAPI specs whose operations the
+	// model may call, by name; si tools import adds them
+	APIs map[string]APIConfig `yaml:"apis,omitempty"`
+
+	// Subagents are agents with narrower tools and budgets of their own that
+	// the model may delegate subtasks to, by name
+	Subagents map[string]SubagentConfig `yaml:"subagents,omitempty"`
+}
+
+// SubagentConfig configures an agent the model may delegate subtasks to
+type SubagentConfig struct {
+	// Description tells the model what the sub-agent does and when to
+	// delegate to it
+	Description string `yaml:"description"`
+
+	// Instructions are the system prompt of the sub-agent
+	Instructions string `yaml:"instructions,omitempty"`
+
+	// Tools lists the built-in tools the sub-agent may call (default:
+	// read_file)
+	Tools []string `yaml:"tools,omitempty"`
+
+	// MaxSteps limits the rounds of tool calls per task (default: 5)
+	MaxSteps int `yaml:"max_steps,omitempty"`
+
+	// MaxTokens and MaxCost are the budget of a task; the sub-agent stops
+	// when it is used up. Zero means unlimited.
+	MaxTokens int     `yaml:"max_tokens,omitempty"`
+	MaxCost   float64 `yaml:"max_cost,omitempty"`
+}
+
+// Validate checks the settings of the sub-agent
+func (s *SubagentConfig) Validate() error {
+	if s.Description == "" {
+		return fmt.Errorf("description is required")
+	}
+	if s.MaxSteps < 0 {
+		return fmt.Errorf("max_steps must not be negative, got %d", s.MaxSteps)
+	}
+	if s.MaxTokens < 0 {
+		return fmt.Errorf("max_tokens must not be negative, got %d", s.MaxTokens)
+	}
+	if s.MaxCost < 0 {
+		return fmt.Errorf("max_cost must not be negative, got %g", s.MaxCost)
+	}
+	return nil
+}
+
+// APIConfig configures a REST API the model may call in agent mode
+type APIConfig struct {
+	// Spec is the path of the OpenAPI 3 spec of the API
+	Spec string `yaml:"spec"`
+
+	// Operations are the IDs of the operations the model may call (default:
+	// all)
+	Operations []string `yaml:"operations,omitempty"`
+
+	// BaseURL overrides the server URL of the spec
+	BaseURL string `yaml:"base_url,omitempty"`
+
+	// Auth configures the credentials sent with every request
+	Auth APIAuthConfig `yaml:"auth,omitempty"`
+}
+
+// APIAuthConfig configures how requests to an API are authenticated
+type APIAuthConfig struct {
+	// Type is bearer, basic, header or query; unset sends no credentials
+	Type string `yaml:"type,omitempty"`
+
+	// Name is the name of the header or query parameter of the token
+	Name string `yaml:"name,omitempty"`
+
+	// Token is the bearer token or the value of the header or query
+	// parameter, usually a ${VAR} reference
+	Token string `yaml:"token,omitempty" secret:"true"`
+
+	// Username and Password are the credentials of basic auth
+	Username string `yaml:"username,omitempty"`
+	Password string `yaml:"password,omitempty" secret:"true"`
+}
+
+// Validate checks the auth type and that its settings are given
+func (a *APIAuthConfig) Validate() error {
+	switch a.Type {
+	case "", "bearer", "basic":
+	case "header", "query":
+		if a.Name == "" {
+			return fmt.Errorf("auth.name is required for %s auth", a.Type)
+		}
+	default:
+		return fmt.Errorf("auth.type must be bearer, basic, header or query, got %q", a.Type)
+	}
+	return nil
+}
+
+// FetchConfig restricts which hosts si may fetch URLs from, for --url and the
+// web tool. Without an allowlist every host is allowed for URLs given by the
+// user, but nothing may be fetched in agent mode, where the model chooses the
+// URLs.
+type FetchConfig struct {
+	// AllowedDomains lists trusted hosts; "*.example.com" matches the
+	// subdomains of example.com and "*" matches every host
+	AllowedDomains []string `yaml:"allowed_domains,omitempty"`
+
+	// MaxTokens limits the text of each page fetched for --url, longer
+	// text is truncated (default: 8000)
+	MaxTokens int `yaml:"max_tokens,omitempty"`
+
+	// CacheTTL is how long pages fetched for --url are cached (default: 1h)
+	CacheTTL time.Duration `yaml:"cache_ttl,omitempty"`
+}
+
+// Defaults of fetching pages for --url
+const (
+	DefaultFetchMaxTokens = 8000
+	DefaultFetchCacheTTL  = time.Hour
+)
+
+// PageTokens returns the configured limit of the text of a page or the
+// default
+func (f *FetchConfig) PageTokens() int {
+	if f.MaxTokens == 0 {
+		return DefaultFetchMaxTokens
+	}
+	return f.MaxTokens
+}
+
+// PageTTL returns the configured time to cache pages or the default
+func (f *FetchConfig) PageTTL() time.Duration {
+	if f.CacheTTL == 0 {
+		return DefaultFetchCacheTTL
+	}
+	return f.CacheTTL
+}
+
+// SearchConfig configures the search engine the model can query with the
+// web_search tool in agent mode. The tool is only available with a backend.
+type SearchConfig struct {
+	// Backend is searxng, brave or bing
+	Backend string `yaml:"backend,omitempty"`
+
+	// URL is the address of the SearXNG instance, or overrides the endpoint
+	// of the Brave and Bing APIs
+	URL string `yaml:"url,omitempty"`
+
+	// APIKey is the subscription key of the Brave and Bing APIs, usually a
+	// ${VAR} reference
+	APIKey string `yaml:"api_key,omitempty" secret:"true"`
+
+	// MaxResults is the number of results of a search (default: 5)
+	MaxResults int `yaml:"max_results,omitempty"`
+}
+
+// Validate checks the backend and that its settings are given
+func (s *SearchConfig) Validate() error {
+	switch s.Backend {
+	case "":
+		return nil
+	case search.SearXNG:
+		if s.URL == "" {
+			return fmt.Errorf("search.url is required for searxng")
+		}
+	case search.Brave, search.Bing:
+		if s.APIKey == "" {
+			return fmt.Errorf("search.api_key is required for %s", s.Backend)
+		}
+	default:
+		return fmt.Errorf("search.backend must be searxng, brave or bing, got %q", s.Backend)
+	}
+	if s.MaxResults < 0 {
+		return fmt.Errorf("search.max_results must not be negative, got %d", s.MaxResults)
+	}
+	return nil
+}
+
+// Policy returns the fetch policy; strict policies block every host unless
+// it is allowed explicitly
+func (f *FetchConfig) Policy(strict bool) *fetch.Policy {
+	return fetch.NewPolicy(f.AllowedDomains, strict)
+}
+
+// Cache modes
+const (
+	CacheExact    = "exact"
+	CacheSemantic = "semantic"
+)
+
+// Defaults of the answer cache
+const (
+	DefaultCacheTTL        = 24 * time.Hour
+	DefaultCacheSimilarity = 0.95
+)
+
+// CacheConfig configures the answer cache. The cache is disabled unless a
+// mode is set.
+type CacheConfig struct {
+	// Mode is "exact" to reuse answers to identical questions, or "semantic"
+	// to also reuse answers to questions with a similar embedding
+	Mode string `yaml:"mode,omitempty"`
+
+	// TTL is how long answers are kept (default: 24h)
+	TTL time.Duration `yaml:"ttl,omitempty"`
+
+	// Similarity is the cosine similarity a question needs to have to a cached
+	// one in semantic mode, between 0 and 1 (default: 0.95)
+	Similarity float64 `yaml:"similarity,omitempty"`
+
+	// EmbeddingModel is the model used to compute embeddings in semantic mode
+	EmbeddingModel string `yaml:"embedding_model,omitempty"`
+}
+
+// MaxAge returns the configured time to keep answers or the default
+func (c *CacheConfig) MaxAge() time.Duration {
+	if c.TTL == 0 {
+		return DefaultCacheTTL
+	}
+	return c.TTL
+}
+
+// MinSimilarity returns the configured similarity threshold or the default
+func (c *CacheConfig) MinSimilarity() float64 {
+	if c.Similarity == 0 {
+		return DefaultCacheSimilarity
+	}
+	return c.Similarity
+}
+
+// Validate checks the cache mode and thresholds
+func (c *CacheConfig) Validate() error {
+	switch c.Mode {
+	case "", CacheExact, CacheSemantic:
+	default:
+		return fmt.Errorf("cache.mode must be exact or semantic, got %q", c.Mode)
+	}
+
+	if c.Similarity < 0 || c.Similarity > 1 {
+		return fmt.Errorf("cache.similarity must be between 0 and 1, got %g", c.Similarity)
+	}
+
+	if c.TTL < 0 {
+		return fmt.Errorf("cache.ttl must not be negative")
+	}
+
+	return nil
+}
+
+// DefaultEmbedBatchSize is the number of texts embedded per request unless
+// configured otherwise
+const DefaultEmbedBatchSize = 100
+
+// EmbedConfig configures computing embeddings
+type EmbedConfig struct {
+	// Model is the embedding model, also used by the semantic cache unless
+	// it has one of its own (default: text-embedding-3-small)
+	Model string `yaml:"model,omitempty"`
+
+	// BatchSize is the number of texts sent per request (default: 100)
+	BatchSize int `yaml:"batch_size,omitempty"`
+}
+
+// Batch returns the configured batch size or the default
+func (e *EmbedConfig) Batch() int {
+	if e.BatchSize == 0 {
+		return DefaultEmbedBatchSize
+	}
+	return e.BatchSize
+}
+
+// DefaultRAGTopK is the number of chunks retrieved for --rag unless
+// configured otherwise
+const DefaultRAGTopK = 5
+
+// RAGConfig configures the local retrieval index
+type RAGConfig struct {
+	// ChunkTokens is the approximate size of the chunks files are split into
+	// (default: 300)
+	ChunkTokens int `yaml:"chunk_tokens,omitempty"`
+
+	// TopK is the number of chunks added to the question (default: 5)
+	TopK int `yaml:"top_k,omitempty"`
+}
+
+// Results returns the configured number of chunks to retrieve or the default
+func (r *RAGConfig) Results() int {
+	if r.TopK == 0 {
+		return DefaultRAGTopK
+	}
+	return r.TopK
+}
+
+// UIConfig overrides what the terminal is assumed to be able to display.
+// Unset values are detected from the environment.
+type UIConfig struct {
+	// Unicode enables or disables non-ASCII symbols such as spinners
+	Unicode *bool `yaml:"unicode,omitempty"`
+
+	// Color is the color support of the terminal: auto, none, 16, 256 or truecolor
+	Color string `yaml:"color,omitempty"`
 }
 
 // LLMConfig represents the configuration for LLM providers
 type LLMConfig struct {
 	OpenAI OpenAIConfig `yaml:"openai"`
+
+	// Provider is the name of the provider used instead of openai unless
+	// --provider selects another
+	Provider string `yaml:"provider,omitempty"`
+
+	// Providers are named OpenAI-compatible providers, e.g. Groq or a vLLM
+	// server, selected with provider or --provider
+	Providers map[string]ProviderConfig `yaml:"providers,omitempty" explain:"-"`
+
+	// Fallbacks answer in order when the model before them is rate limited
+	// or unavailable
+	Fallbacks []FallbackConfig `yaml:"fallbacks,omitempty" explain:"-"`
 }
 
 // OpenAIConfig represents the configuration for OpenAI
 type OpenAIConfig struct {
 	BaseURL             string `yaml:"base_url"`
-	APIKey              string `yaml:"api_key"`
+	APIKey              string `yaml:"api_key" secret:"true"`
 	ModelName           string `yaml:"model_name,omitempty"`
 	AzureDeploymentName string `yaml:"azure_deployment_name,omitempty"`
+
+	// AzureAPIVersion is the api-version of requests to Azure OpenAI, for
+	// resources pinned to another version (default: DefaultAzureAPIVersion)
+	AzureAPIVersion string `yaml:"azure_api_version,omitempty"`
+
+	// APIKeyCmd is a shell command that prints the API key, e.g. of a
+	// password manager, so the key doesn't have to be stored in the file
+	APIKeyCmd string `yaml:"api_key_cmd,omitempty"`
+
+	// APIKeys are used in turn instead of a single api_key, to spread the
+	// requests over the rate limits of several keys
+	APIKeys []string `yaml:"api_keys,omitempty" secret:"true"`
+
+	// KeyRotation configures how the key of each request is picked from
+	// api_keys
+	KeyRotation KeyRotationConfig `yaml:"key_rotation,omitempty"`
+
+	// OrganizationID and ProjectID are sent in the OpenAI-Organization and
+	// OpenAI-Project headers, so the usage of keys that belong to several
+	// organizations or projects is billed to the right one
+	OrganizationID string `yaml:"organization_id,omitempty"`
+	ProjectID      string `yaml:"project_id,omitempty"`
+
+	// MaxConcurrentRequests limits the number of simultaneous requests to
+	// the provider; zero means unlimited
+	MaxConcurrentRequests int `yaml:"max_concurrent_requests,omitempty"`
+
+	// RateLimit limits the requests and tokens sent to the provider per
+	// minute, so si stays within the quota of the key
+	RateLimit RateLimitConfig `yaml:"rate_limit,omitempty"`
+
+	// ContextWindow is the context window of the model in tokens, for
+	// models whose context window si doesn't know
+	ContextWindow int `yaml:"context_window,omitempty"`
+
+	// Retry configures how failed requests are retried
+	Retry RetryConfig `yaml:"retry,omitempty"`
+
+	// Proxy is the URL of the HTTP, HTTPS or SOCKS5 proxy of requests to the
+	// provider, e.g. http://proxy.example.com:8080. Unset uses the
+	// HTTPS_PROXY, HTTP_PROXY and NO_PROXY environment variables. The URL
+	// may hold the credentials of the proxy, so it is treated as a secret.
+	Proxy string `yaml:"proxy,omitempty" secret:"true"`
+
+	// TLS configures the certificates of connections to the provider
+	TLS TLSConfig `yaml:"tls,omitempty"`
+
+	// Headers are added to every request to the provider, e.g. routing or
+	// authentication headers of an API gateway. They replace headers of the
+	// same name that si sets. Values may hold credentials, so they are
+	// treated as secrets.
+	Headers map[string]string `yaml:"headers,omitempty" secret:"true"`
+
+	// OpenRouter configures requests to OpenRouter, used when base_url
+	// points to it
+	OpenRouter OpenRouterConfig `yaml:"openrouter,omitempty"`
+
+	// Store tells the provider whether it may retain requests and responses,
+	// e.g. for its dashboard and evaluations; false opts out where the
+	// provider supports it. Unset leaves it to the provider's default.
+	Store *bool `yaml:"store,omitempty"`
+
+	SamplingConfig `yaml:",inline"`
+}
+
+// OpenRouterConfig configures the attribution and the provider routing of
+// requests to OpenRouter
+type OpenRouterConfig struct {
+	// SiteURL and AppName identify the application in the HTTP-Referer and
+	// X-Title headers OpenRouter uses for its app rankings (default: the si
+	// repository and "si")
+	SiteURL string `yaml:"site_url,omitempty"`
+	AppName string `yaml:"app_name,omitempty"`
+
+	// Providers are the upstream providers to route requests to, in order
+	// of preference, e.g. ["Azure", "OpenAI"]
+	Providers []string `yaml:"providers,omitempty"`
+
+	// AllowFallbacks lets OpenRouter use other providers when the preferred
+	// ones are unavailable; unset leaves it to OpenRouter, which allows them
+	AllowFallbacks *bool `yaml:"allow_fallbacks,omitempty"`
+}
+
+// TLSConfig configures the certificates of connections to a provider, e.g. a
+// self-hosted gateway whose certificate is signed by a private CA
+type TLSConfig struct {
+	// CAFile is a PEM bundle of CA certificates trusted in addition to those
+	// of the system
+	CAFile string `yaml:"ca_file,omitempty"`
+
+	// CertFile and KeyFile are the PEM client certificate and its key, for
+	// gateways that require mutual TLS
+	CertFile string `yaml:"cert_file,omitempty"`
+	KeyFile  string `yaml:"key_file,omitempty"`
+
+	// InsecureSkipVerify accepts any certificate of the provider. It makes
+	// connections open to interception and is meant for testing only.
+	InsecureSkipVerify bool `yaml:"insecure_skip_verify,omitempty"`
+}
+
+// Validate checks that the client certificate and its key are set together
+func (t *TLSConfig) Validate() error {
+	if (t.CertFile == "") != (t.KeyFile == "") {
+		return fmt.Errorf("tls.cert_file and tls.key_file must be set together")
+	}
+	return nil
+}
+
+// headerName matches valid names of HTTP headers
+var headerName = regexp.MustCompile("^[A-Za-z0-9!#$%&'*+.^_`|~-]+$")
+
+// proxySchemes are the proxy protocols requests can be sent through
+var proxySchemes = map[string]bool{"http": true, "https": true, "socks5": true, "socks5h": true}
+
+// RateLimitConfig limits the requests sent to a provider over a sliding
+// window of one minute. Requests wait until they fit; zero means unlimited.
+type RateLimitConfig struct {
+	// RequestsPerMinute is the number of requests per minute
+	RequestsPerMinute int `yaml:"requests_per_minute,omitempty"`
+
+	// TokensPerMinute is the number of prompt and completion tokens per
+	// minute. The tokens of a request are estimated before it is sent and
+	// corrected when the provider reports its usage.
+	TokensPerMinute int `yaml:"tokens_per_minute,omitempty"`
+}
+
+// Validate checks that the limits are not negative
+func (r *RateLimitConfig) Validate() error {
+	if r.RequestsPerMinute < 0 || r.TokensPerMinute < 0 {
+		return fmt.Errorf("rate_limit must not be negative")
+	}
+	return nil
 }
 
-// DefaultConfigPath returns the default path for the configuration file
+// Strategies of picking the API key of a request
+const (
+	// KeyRotationRoundRobin uses the keys in turn (default)
+	KeyRotationRoundRobin = "round_robin"
+
+	// KeyRotationLeastRecentlyThrottled uses the key that was rate limited
+	// longest ago, or never
+	KeyRotationLeastRecentlyThrottled = "least_recently_throttled"
+)
+
+// DefaultKeyCooldown is how long a rate limited key is set aside when the
+// provider doesn't tell when to retry
+const DefaultKeyCooldown = time.Minute
+
+// KeyRotationConfig configures the rotation of api_keys. Keys that are rate
+// limited are skipped until their cooldown is over, unless every key is.
+type KeyRotationConfig struct {
+	// Strategy is round_robin (default) or least_recently_throttled
+	Strategy string `yaml:"strategy,omitempty"`
+
+	// Cooldown is how long a rate limited key is skipped, unless the
+	// provider sends a Retry-After header (default: 1m)
+	Cooldown time.Duration `yaml:"cooldown,omitempty"`
+}
+
+// CooldownPeriod returns the configured cooldown of rate limited keys or the
+// default
+func (k *KeyRotationConfig) CooldownPeriod() time.Duration {
+	if k.Cooldown == 0 {
+		return DefaultKeyCooldown
+	}
+	return k.Cooldown
+}
+
+// Validate checks the strategy and the cooldown
+func (k *KeyRotationConfig) Validate() error {
+	switch k.Strategy {
+	case "", KeyRotationRoundRobin, KeyRotationLeastRecentlyThrottled:
+	default:
+		return fmt.Errorf("key_rotation.strategy must be %s or %s, got %q", KeyRotationRoundRobin, KeyRotationLeastRecentlyThrottled, k.Strategy)
+	}
+
+	if k.Cooldown < 0 {
+		return fmt.Errorf("key_rotation.cooldown must not be negative")
+	}
+
+	return nil
+}
+
+// Defaults of the retry policy
+const (
+	DefaultMaxRetries      = 2
+	DefaultRetryBackoff    = time.Second
+	DefaultMaxRetryBackoff = 30 * time.Second
+)
+
+// RetryConfig configures retries of requests that failed with a transient
+// error, such as rate limiting or a server error. The wait between attempts
+// doubles with every retry, unless the provider asks for a specific wait
+// with a Retry-After header.
+type RetryConfig struct {
+	// MaxRetries is the number of times a request is retried (default: 2)
+	MaxRetries *int `yaml:"max_retries,omitempty"`
+
+	// Backoff is the wait before the first retry (default: 1s)
+	Backoff time.Duration `yaml:"backoff,omitempty"`
+
+	// MaxBackoff is the longest wait between attempts (default: 30s)
+	MaxBackoff time.Duration `yaml:"max_backoff,omitempty"`
+
+	// Resume repeats a request whose streamed answer was interrupted with
+	// the partial answer, asking the model to continue it (default: true)
+	Resume *bool `yaml:"resume,omitempty"`
+}
+
+// ResumesStreams reports whether interrupted answers are resumed
+func (r *RetryConfig) ResumesStreams() bool {
+	return r.Resume == nil || *r.Resume
+}
+
+// Retries returns the configured number of retries or the default
+func (r *RetryConfig) Retries() int {
+	if r.MaxRetries == nil {
+		return DefaultMaxRetries
+	}
+	return *r.MaxRetries
+}
+
+// InitialBackoff returns the configured wait before the first retry or the default
+func (r *RetryConfig) InitialBackoff() time.Duration {
+	if r.Backoff == 0 {
+		return DefaultRetryBackoff
+	}
+	return r.Backoff
+}
+
+// BackoffLimit returns the configured longest wait between attempts or the default
+func (r *RetryConfig) BackoffLimit() time.Duration {
+	if r.MaxBackoff == 0 {
+		return DefaultMaxRetryBackoff
+	}
+	return r.MaxBackoff
+}
+
+// Validate checks that the retry settings are not negative
+func (r *RetryConfig) Validate() error {
+	if r.Retries() < 0 {
+		return fmt.Errorf("retry.max_retries must not be negative, got %d", r.Retries())
+	}
+
+	if r.Backoff < 0 || r.MaxBackoff < 0 {
+		return fmt.Errorf("retry backoff must not be negative")
+	}
+
+	return nil
+}
+
+// PromptConfig represents a named prompt template. In the config file it can
+// be written either as a plain template string or as a mapping.
+type PromptConfig struct {
+	// Template is the Go template the prompt is rendered from
+	Template string `yaml:"template"`
+
+	// Validate contains rules the answer must satisfy
+	Validate ValidationConfig `yaml:"validate,omitempty"`
+
+	// Examples are exchanges sent ahead of the question as messages of their
+	// own, showing the model how to answer
+	Examples []PromptExample `yaml:"examples,omitempty"`
+}
+
+// PromptExample is an example question and the answer expected for it
+type PromptExample struct {
+	User      string `yaml:"user"`
+	Assistant string `yaml:"assistant"`
+}
+
+// UnmarshalYAML allows a prompt to be given as a plain template string
+func (p *PromptConfig) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		p.Template = node.Value
+		return nil
+	}
+
+	type plain PromptConfig
+	return node.Decode((*plain)(p))
+}
+
+// HooksConfig contains shell commands run around every question. A command
+// gets the text on stdin and replaces it with what it prints, unless it prints
+// nothing; a command that fails rejects the text.
+type HooksConfig struct {
+	// PreRequest is run with the question before it is sent
+	PreRequest string `yaml:"pre_request,omitempty"`
+
+	// PostResponse is run with the complete answer before it is printed
+	PostResponse string `yaml:"post_response,omitempty"`
+}
+
+// RedactConfig configures replacing secrets such as API keys in piped input
+// and attached diffs with placeholders, and scrubbing personal data from
+// the prompt
+type RedactConfig struct {
+	// Disabled sends secrets in the input as they are
+	Disabled bool `yaml:"disabled,omitempty"`
+
+	// Restore puts the secrets back into the answer, which disables
+	// streaming when secrets were found
+	Restore bool `yaml:"restore,omitempty"`
+
+	// PII replaces email addresses, phone numbers and IP addresses in the
+	// whole prompt. They are always put back into the answer.
+	PII bool `yaml:"pii,omitempty"`
+
+	// Patterns are regular expressions of further secrets by name. When an
+	// expression has a capture group, only the group is replaced.
+	Patterns map[string]string `yaml:"patterns,omitempty"`
+}
+
+// DefaultTruncate is the truncation strategy used unless one is configured
+const DefaultTruncate = "head+tail"
+
+// InputConfig limits the size of piped input. Longer input is truncated
+// or summarized in chunks with a warning.
+type InputConfig struct {
+	// MaxTokens is the limit in tokens, by default three quarters of the
+	// context window of the model if it is known
+	MaxTokens int `yaml:"max_tokens,omitempty"`
+
+	// MaxBytes is the limit in bytes, zero means no limit
+	MaxBytes int `yaml:"max_bytes,omitempty"`
+
+	// Truncate is the part of the input that is kept: head, tail, head+tail
+	// or summarize, which keeps the head and tail and asks the model to
+	// summarize the middle (default: head+tail)
+	Truncate string `yaml:"truncate,omitempty"`
+
+	// MapReduce splits longer input into chunks that the model summarizes
+	// with regard to the question one by one instead of truncating it. The
+	// question is then answered from the summaries.
+	MapReduce bool `yaml:"map_reduce,omitempty"`
+
+	// ChunkTokens is the size of the chunks of MapReduce in tokens, by
+	// default the limit
+	ChunkTokens int `yaml:"chunk_tokens,omitempty"`
+}
+
+// Strategy returns the configured truncation strategy or the default
+func (i *InputConfig) Strategy() string {
+	if i.Truncate == "" {
+		return DefaultTruncate
+	}
+	return i.Truncate
+}
+
+// Validate checks the limits and the truncation strategy
+func (i *InputConfig) Validate() error {
+	if i.MaxTokens < 0 || i.MaxBytes < 0 || i.ChunkTokens < 0 {
+		return fmt.Errorf("input.max_tokens, input.max_bytes and input.chunk_tokens must not be negative")
+	}
+	switch i.Strategy() {
+	case "head", "tail", "head+tail", "summarize":
+		return nil
+	default:
+		return fmt.Errorf("input.truncate must be head, tail, head+tail or summarize, got %q", i.Truncate)
+	}
+}
+
+// DefaultValidationRetries is the number of times an invalid answer is re-requested
+const DefaultValidationRetries = 2
+
+// ValidationConfig contains rules an answer must satisfy. When the answer
+// violates them, the model is asked again up to Retries times.
+type ValidationConfig struct {
+	// JSON requires the answer to be valid JSON
+	JSON bool `yaml:"json,omitempty"`
+
+	// CodeFence requires the answer to contain a fenced code block
+	CodeFence bool `yaml:"code_fence,omitempty"`
+
+	// MaxLines limits the number of lines of the answer
+	MaxLines int `yaml:"max_lines,omitempty"`
+
+	// MustMatch is a regular expression the answer must match
+	MustMatch string `yaml:"must_match,omitempty"`
+
+	// MustNotMatch is a regular expression the answer must not match
+	MustNotMatch string `yaml:"must_not_match,omitempty"`
+
+	// Schema is the path of a JSON Schema the answer must conform to
+	Schema string `yaml:"schema,omitempty"`
+
+	// Retries is the number of times to re-prompt (default: 2)
+	Retries *int `yaml:"retries,omitempty"`
+}
+
+// Enabled reports whether any validation rule is configured
+func (v *ValidationConfig) Enabled() bool {
+	return v.JSON || v.CodeFence || v.MaxLines > 0 || v.MustMatch != "" || v.MustNotMatch != "" || v.Schema != ""
+}
+
+// MaxRetries returns the configured number of retries or the default
+func (v *ValidationConfig) MaxRetries() int {
+	if v.Retries == nil {
+		return DefaultValidationRetries
+	}
+	return *v.Retries
+}
+
+// CommitConfig represents the configuration for commit message generation
+type CommitConfig struct {
+	// Conventional requests messages in the Conventional Commits format
+	Conventional bool `yaml:"conventional,omitempty"`
+
+	// Instructions are additional instructions for writing commit messages
+	Instructions string `yaml:"instructions,omitempty"`
+}
+
+// ReviewConfig configures code reviews
+type ReviewConfig struct {
+	// Instructions are additional instructions for reviewing, e.g. the
+	// conventions of the project
+	Instructions string `yaml:"instructions,omitempty"`
+}
+
+// PRConfig configures pull request titles and descriptions
+type PRConfig struct {
+	// Template is the structure of the description, such as its headings;
+	// without it the pull request template of the repository is followed
+	Template string `yaml:"template,omitempty"`
+
+	// Instructions are additional instructions for writing descriptions
+	Instructions string `yaml:"instructions,omitempty"`
+}
+
+// SamplingConfig contains the sampling parameters sent with each request.
+// Unset values are left to the provider's defaults.
+type SamplingConfig struct {
+	Temperature *float64 `yaml:"temperature,omitempty"`
+	TopP        *float64 `yaml:"top_p,omitempty"`
+	MaxTokens   int      `yaml:"max_tokens,omitempty"`
+}
+
+// Defaults returns a configuration containing only the default values
+func Defaults() *Config {
+	return &Config{
+		LLM: LLMConfig{
+			OpenAI: OpenAIConfig{
+				BaseURL:   DefaultBaseURL,
+				ModelName: DefaultModelName,
+			},
+		},
+	}
+}
+
+// DefaultConfigPath returns the default path for the configuration file, see
+// paths.ConfigDir. A file at the legacy path ~/.config/si.yaml is used until
+// MoveLegacyConfig moves it.
 func DefaultConfigPath() string {
+	return paths.Resolve(configFile(paths.ConfigDir()), configFile(paths.LegacyConfigDir()))
+}
+
+// MoveLegacyConfig moves the configuration file from its legacy path to the
+// default path, if only the legacy file exists. It returns the new path if
+// the file was moved.
+func MoveLegacyConfig() (string, error) {
+	path := configFile(paths.ConfigDir())
+	moved, err := paths.MoveLegacy(configFile(paths.LegacyConfigDir()), path)
+	if !moved {
+		return "", err
+	}
+	return path, err
+}
+
+// configFile returns the path of the configuration file in dir
+func configFile(dir string) string {
+	if dir == "" {
+		return ""
+	}
+	return filepath.Join(dir, "si.yaml")
+}
+
+// ExpandPath expands a leading ~ in path to the user's home directory
+func ExpandPath(path string) string {
+	if path != "~" && !strings.HasPrefix(path, "~/") {
+		return path
+	}
+
 	homeDir, err := os.UserHomeDir()
 	if err != nil {
-		return ""
+		return path
 	}
-	return filepath.Join(homeDir, ".config", "si.yaml")
+	return filepath.Join(homeDir, strings.TrimPrefix(path, "~"))
 }
 
-// LoadConfig loads the configuration from the specified path
+// LoadConfig loads the configuration from the specified path. Files of an
+// older version are migrated, see Migrate. References to environment
+// variables like ${OPENAI_API_KEY} in its values are expanded. The settings of
+// a project config file found for the working directory override those of
+// the file, see FindProjectConfig, and settings both leave empty are taken
+// from the EnvFallbacks.
 func LoadConfig(path string) (*Config, error) {
 	if path == "" {
 		path = DefaultConfigPath()
 	}
 
+	config, err := loadFile(path, false)
+	if err != nil {
+		return nil, err
+	}
+	if err := config.loadProject(path); err != nil {
+		return nil, err
+	}
+	config.applyEnvFallbacks()
+
+	return config, nil
+}
+
+// loadFile reads, migrates and decodes a config file. The migrated user
+// config is saved if possible; project files are only migrated in memory and
+// may only contain the ProjectSettings.
+func loadFile(path string, project bool) (*Config, error) {
 	data, err := os.ReadFile(path)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read config file: %w", err)
 	}
 
-	var config Config
-	if err := yaml.Unmarshal(data, &config); err != nil {
+	var document yaml.Node
+	if err := yaml.Unmarshal(data, &document); err != nil {
 		return nil, fmt.Errorf("failed to parse config file: %w", err)
 	}
 
+	// Old files are migrated to the current schema, and saved if possible.
+	// Migrating isn't a reason to write in read-only mode.
+	var config Config
+	migration, err := migrateDocument(&document)
+	if err != nil {
+		return nil, err
+	}
+	if migration != nil && !project {
+		if migration.Err = state.Writable(); migration.Err == nil {
+			migration.Err = writeMigrated(path, data, &document, migration)
+		}
+		config.migration = migration
+	}
+	if project {
+		if err := checkProjectSettings(&document); err != nil {
+			return nil, err
+		}
+	}
+
+	// A project file comes with the repository, so it can't read the
+	// environment, which may hold secrets
+	if !project {
+		if missing := expandEnv(&document); len(missing) > 0 {
+			config.missingEnv = missing
+		}
+	}
+	if document.Kind != 0 {
+		if err := document.Decode(&config); err != nil {
+			return nil, fmt.Errorf("failed to parse config file: %w", err)
+		}
+	}
+
 	return &config, nil
 }
 
+// SetModel overrides the model name used by every configured provider
+func (c *Config) SetModel(name string) {
+	c.LLM.OpenAI.ModelName = name
+}
+
+// ModelKey returns the dotted key of the setting that holds the model of the
+// applied profile and provider, e.g. to save another model there. A provider
+// is changed where it is defined, in the profile or in llm.providers.
+func (c *Config) ModelKey() string {
+	prefix := "llm."
+	profile, inProfile := c.Profiles[c.Profile]
+	if inProfile {
+		prefix = "profiles." + c.Profile + ".llm."
+	}
+	if c.LLM.Provider == "" {
+		return prefix + "openai.model_name"
+	}
+	if _, ok := profile.LLM.Providers[c.LLM.Provider]; !ok {
+		prefix = "llm."
+	}
+	return prefix + "providers." + c.LLM.Provider + ".model_name"
+}
+
+// SetStore sets whether the configured providers may retain requests and
+// responses
+func (c *Config) SetStore(store bool) {
+	c.LLM.OpenAI.Store = &store
+}
+
+// SetSampling overrides the sampling parameters that are set in s for every
+// configured provider
+func (c *Config) SetSampling(s SamplingConfig) {
+	mergeValue(reflect.ValueOf(&c.LLM.OpenAI.SamplingConfig).Elem(), reflect.ValueOf(s))
+}
+
 // Validate checks if the configuration is valid
 func (c *Config) Validate() error {
-	// Check if OpenAI API key is provided
-	if c.LLM.OpenAI.APIKey == "" {
-		return fmt.Errorf("OpenAI API key is required")
+	// Check if OpenAI API key is provided; Copilot uses the GitHub token
+	// saved by si copilot login by default
+	if c.LLM.OpenAI.APIKey == "" && c.LLM.OpenAI.APIKeyCmd == "" && len(c.LLM.OpenAI.APIKeys) == 0 && c.ProviderType() != ProviderTypeCopilot {
+		return fmt.Errorf("OpenAI API key is required, set llm.openai.api_key, llm.openai.api_key_cmd, llm.openai.api_keys or OPENAI_API_KEY")
+	}
+	if c.LLM.OpenAI.APIKey != "" && c.LLM.OpenAI.APIKeyCmd != "" {
+		return fmt.Errorf("llm.openai.api_key and llm.openai.api_key_cmd can't both be set")
+	}
+
+	for name, prompt := range c.Prompts {
+		for _, pattern := range []string{prompt.Validate.MustMatch, prompt.Validate.MustNotMatch} {
+			if _, err := regexp.Compile(pattern); err != nil {
+				return fmt.Errorf("prompt %q has an invalid validation pattern: %w", name, err)
+			}
+		}
+		if prompt.Validate.MaxRetries() < 0 {
+			return fmt.Errorf("prompt %q: retries must not be negative", name)
+		}
+		for i, example := range prompt.Examples {
+			if example.User == "" || example.Assistant == "" {
+				return fmt.Errorf("prompt %q: example %d needs both user and assistant", name, i+1)
+			}
+		}
+	}
+
+	for name, pattern := range c.Redact.Patterns {
+		if _, err := regexp.Compile(pattern); err != nil {
+			return fmt.Errorf("redact.patterns.%s is invalid: %w", name, err)
+		}
+	}
+
+	if err := c.LLM.OpenAI.Validate(); err != nil {
+		return err
+	}
+
+	if err := c.validateProfiles(); err != nil {
+		return err
+	}
+
+	if err := c.validateProviders(); err != nil {
+		return err
+	}
+
+	if err := c.validateFallbacks(); err != nil {
+		return err
+	}
+
+	switch c.UI.Color {
+	case "", "auto", "none", "16", "256", "truecolor":
+	default:
+		return fmt.Errorf("ui.color must be auto, none, 16, 256 or truecolor, got %q", c.UI.Color)
+	}
+
+	if err := c.Cache.Validate(); err != nil {
+		return err
+	}
+
+	if err := c.Input.Validate(); err != nil {
+		return err
+	}
+
+	if c.Embed.BatchSize < 0 {
+		return fmt.Errorf("embed.batch_size must not be negative, got %d", c.Embed.BatchSize)
+	}
+	if c.RAG.ChunkTokens < 0 || c.RAG.TopK < 0 {
+		return fmt.Errorf("rag.chunk_tokens and rag.top_k must not be negative")
+	}
+
+	for _, domain := range c.Fetch.AllowedDomains {
+		if err := fetch.ValidateDomain(domain); err != nil {
+			return fmt.Errorf("fetch.allowed_domains: %w", err)
+		}
+	}
+	if c.Fetch.MaxTokens < 0 || c.Fetch.CacheTTL < 0 {
+		return fmt.Errorf("fetch.max_tokens and fetch.cache_ttl must not be negative")
+	}
+
+	if err := c.Search.Validate(); err != nil {
+		return err
+	}
+
+	if c.Agent.MaxSteps < 0 {
+		return fmt.Errorf("agent.max_steps must not be negative, got %d", c.Agent.MaxSteps)
+	}
+	if c.Agent.MaxTokens < 0 {
+		return fmt.Errorf("agent.max_tokens must not be negative, got %d", c.Agent.MaxTokens)
+	}
+	if c.Agent.MaxCost < 0 {
+		return fmt.Errorf("agent.max_cost must not be negative, got %g", c.Agent.MaxCost)
+	}
+	for name, api := range c.Agent.APIs {
+		if api.Spec == "" {
+			return fmt.Errorf("agent.apis.%s.spec is required", name)
+		}
+		if err := api.Auth.Validate(); err != nil {
+			return fmt.Errorf("agent.apis.%s.%w", name, err)
+		}
+	}
+	for name, subagent := range c.Agent.Subagents {
+		if !subagentName.MatchString(name) {
+			return fmt.Errorf("agent.subagents: name %q may only contain letters, digits, _ and -", name)
+		}
+		if err := subagent.Validate(); err != nil {
+			return fmt.Errorf("agent.subagents.%s.%w", name, err)
+		}
+	}
+
+	if c.Memory.MaxSize < 0 {
+		return fmt.Errorf("memory.max_size must not be negative, got %d", c.Memory.MaxSize)
+	}
+
+	if c.LogLevel != "" {
+		if _, err := logging.ParseLevel(c.LogLevel); err != nil {
+			return fmt.Errorf("log_level: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// AzureVersion returns the api-version of requests to Azure OpenAI
+func (o *OpenAIConfig) AzureVersion() string {
+	if o.AzureAPIVersion == "" {
+		return DefaultAzureAPIVersion
+	}
+	return o.AzureAPIVersion
+}
+
+// IsOpenRouter reports whether the base URL points to OpenRouter
+func (o *OpenAIConfig) IsOpenRouter() bool {
+	u, err := url.Parse(o.BaseURL)
+	if err != nil {
+		return false
+	}
+	host := u.Hostname()
+	return host == "openrouter.ai" || strings.HasSuffix(host, ".openrouter.ai")
+}
+
+// Validate checks the settings of the provider that don't depend on the rest
+// of the configuration
+func (o *OpenAIConfig) Validate() error {
+	if o.AzureAPIVersion != "" && !azureAPIVersion.MatchString(o.AzureAPIVersion) {
+		return fmt.Errorf("azure_api_version must be a date like 2024-10-21, optionally followed by -preview, got %q", o.AzureAPIVersion)
+	}
+
+	openRouter := o.OpenRouter.SiteURL != "" || o.OpenRouter.AppName != "" || len(o.OpenRouter.Providers) > 0 || o.OpenRouter.AllowFallbacks != nil
+	if openRouter && !o.IsOpenRouter() {
+		return fmt.Errorf("openrouter settings require base_url %s, got %q", OpenRouterBaseURL, o.BaseURL)
+	}
+	for _, provider := range o.OpenRouter.Providers {
+		if strings.TrimSpace(provider) == "" {
+			return fmt.Errorf("openrouter.providers must not contain empty names")
+		}
+	}
+
+	if len(o.APIKeys) > 0 && (o.APIKey != "" || o.APIKeyCmd != "") {
+		return fmt.Errorf("api_keys can't be combined with api_key or api_key_cmd")
+	}
+	for _, key := range o.APIKeys {
+		if strings.TrimSpace(key) == "" {
+			return fmt.Errorf("api_keys must not contain empty keys")
+		}
+	}
+	if err := o.KeyRotation.Validate(); err != nil {
+		return err
+	}
+
+	if o.MaxConcurrentRequests < 0 {
+		return fmt.Errorf("max_concurrent_requests must not be negative, got %d", o.MaxConcurrentRequests)
+	}
+
+	if err := o.RateLimit.Validate(); err != nil {
+		return err
+	}
+
+	if o.ContextWindow < 0 {
+		return fmt.Errorf("context_window must not be negative, got %d", o.ContextWindow)
+	}
+
+	if err := o.Retry.Validate(); err != nil {
+		return err
+	}
+
+	if o.Proxy != "" {
+		u, err := url.Parse(o.Proxy)
+		if err != nil || !proxySchemes[u.Scheme] || u.Host == "" {
+			return fmt.Errorf("proxy must be an http, https, socks5 or socks5h URL with a host, got %q", o.Proxy)
+		}
+	}
+
+	if err := o.TLS.Validate(); err != nil {
+		return err
+	}
+
+	for name := range o.Headers {
+		if !headerName.MatchString(name) {
+			return fmt.Errorf("headers: invalid header name %q", name)
+		}
+	}
+
+	return o.SamplingConfig.Validate()
+}
+
+// Validate checks that the sampling parameters are within their valid ranges
+func (s *SamplingConfig) Validate() error {
+	if s.Temperature != nil && (*s.Temperature < 0 || *s.Temperature > 2) {
+		return fmt.Errorf("temperature must be between 0 and 2, got %g", *s.Temperature)
+	}
+
+	if s.TopP != nil && (*s.TopP < 0 || *s.TopP > 1) {
+		return fmt.Errorf("top_p must be between 0 and 1, got %g", *s.TopP)
+	}
+
+	if s.MaxTokens < 0 {
+		return fmt.Errorf("max_tokens must not be negative, got %d", s.MaxTokens)
 	}
 
 	return nil
@@ -3,7 +3,9 @@ package config
 import (
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestLoadConfig(t *testing.T) {
@@ -16,6 +18,8 @@ func TestLoadConfig(t *testing.T) {
     base_url: https://api.openai.com/v1
     api_key: test-api-key
     azure_deployment_name: test-deployment
+prompts:
+  summarize: "Summarize: {{.Input}}"
 `
 	
 	err := os.WriteFile(configPath, []byte(configContent), 0644)
@@ -41,6 +45,10 @@ func TestLoadConfig(t *testing.T) {
 	if config.LLM.OpenAI.AzureDeploymentName != "test-deployment" {
 		t.Errorf("Expected AzureDeploymentName to be 'test-deployment', got '%s'", config.LLM.OpenAI.AzureDeploymentName)
 	}
+	
+	if config.Prompts["summarize"].Template != "Summarize: {{.Input}}" {
+		t.Errorf("Expected summarize prompt to be 'Summarize: {{.Input}}', got '%s'", config.Prompts["summarize"].Template)
+	}
 }
 
 func TestValidate(t *testing.T) {
@@ -71,4 +79,658 @@ func TestValidate(t *testing.T) {
 	if err := invalidConfig.Validate(); err == nil {
 		t.Error("Expected invalid config to fail validation, but it passed")
 	}
-} 
\ No newline at end of file
+
+	// Test invalid config (unknown color level)
+	validConfig.UI.Color = "many"
+	if err := validConfig.Validate(); err == nil {
+		t.Error("Expected unknown color level to fail validation, but it passed")
+	}
+	validConfig.UI.Color = "truecolor"
+
+	// Test invalid config (negative context window)
+	validConfig.LLM.OpenAI.ContextWindow = -1
+	if err := validConfig.Validate(); err == nil {
+		t.Error("Expected negative context window to fail validation, but it passed")
+	}
+}
+
+func TestSetModel(t *testing.T) {
+	config := &Config{
+		LLM: LLMConfig{
+			OpenAI: OpenAIConfig{
+				APIKey:    "test-api-key",
+				ModelName: "gpt-4",
+			},
+		},
+	}
+
+	config.SetModel("gpt-4o-mini")
+
+	if config.LLM.OpenAI.ModelName != "gpt-4o-mini" {
+		t.Errorf("Expected ModelName to be 'gpt-4o-mini', got '%s'", config.LLM.OpenAI.ModelName)
+	}
+}
+
+func TestSamplingConfig(t *testing.T) {
+	tempDir := t.TempDir()
+	configPath := filepath.Join(tempDir, "config.yaml")
+
+	configContent := `llm:
+  openai:
+    api_key: test-api-key
+    temperature: 0
+    top_p: 0.9
+    max_tokens: 256
+`
+
+	if err := os.WriteFile(configPath, []byte(configContent), 0644); err != nil {
+		t.Fatalf("Failed to create test config file: %v", err)
+	}
+
+	config, err := LoadConfig(configPath)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	if config.LLM.OpenAI.Temperature == nil || *config.LLM.OpenAI.Temperature != 0 {
+		t.Errorf("Expected Temperature to be set to 0, got %v", config.LLM.OpenAI.Temperature)
+	}
+
+	if config.LLM.OpenAI.TopP == nil || *config.LLM.OpenAI.TopP != 0.9 {
+		t.Errorf("Expected TopP to be 0.9, got %v", config.LLM.OpenAI.TopP)
+	}
+
+	if config.LLM.OpenAI.MaxTokens != 256 {
+		t.Errorf("Expected MaxTokens to be 256, got %d", config.LLM.OpenAI.MaxTokens)
+	}
+
+	// Flags only override the values they set
+	temperature := 1.2
+	config.SetSampling(SamplingConfig{Temperature: &temperature})
+
+	if *config.LLM.OpenAI.Temperature != 1.2 || *config.LLM.OpenAI.TopP != 0.9 {
+		t.Errorf("Expected only Temperature to be overridden, got %v and %v", *config.LLM.OpenAI.Temperature, *config.LLM.OpenAI.TopP)
+	}
+
+	if err := config.Validate(); err != nil {
+		t.Errorf("Expected valid config to pass validation, got error: %v", err)
+	}
+
+	// Out of range values fail validation
+	temperature = 3
+	if err := config.Validate(); err == nil {
+		t.Error("Expected temperature out of range to fail validation, but it passed")
+	}
+}
+
+func TestRetryConfig(t *testing.T) {
+	tempDir := t.TempDir()
+	configPath := filepath.Join(tempDir, "config.yaml")
+
+	configContent := `llm:
+  openai:
+    api_key: test-api-key
+    retry:
+      max_retries: 0
+      backoff: 500ms
+`
+
+	if err := os.WriteFile(configPath, []byte(configContent), 0644); err != nil {
+		t.Fatalf("Failed to create test config file: %v", err)
+	}
+
+	config, err := LoadConfig(configPath)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	retry := config.LLM.OpenAI.Retry
+	if retry.Retries() != 0 {
+		t.Errorf("Expected retries to be disabled, got %d", retry.Retries())
+	}
+
+	if retry.InitialBackoff() != 500*time.Millisecond {
+		t.Errorf("Expected backoff to be 500ms, got %v", retry.InitialBackoff())
+	}
+
+	if retry.BackoffLimit() != DefaultMaxRetryBackoff {
+		t.Errorf("Expected the default max backoff, got %v", retry.BackoffLimit())
+	}
+
+	if retries := (&RetryConfig{}).Retries(); retries != DefaultMaxRetries {
+		t.Errorf("Expected %d retries by default, got %d", DefaultMaxRetries, retries)
+	}
+
+	retry.Backoff = -time.Second
+	if err := retry.Validate(); err == nil {
+		t.Error("Expected negative backoff to fail validation, but it passed")
+	}
+}
+
+func TestRateLimitConfig(t *testing.T) {
+	config := writeConfig(t, `llm:
+  openai:
+    api_key: test-api-key
+    rate_limit:
+      requests_per_minute: 60
+      tokens_per_minute: 90000
+`)
+
+	limits := config.LLM.OpenAI.RateLimit
+	if limits.RequestsPerMinute != 60 || limits.TokensPerMinute != 90000 {
+		t.Errorf("Expected 60 requests and 90000 tokens per minute, got %d and %d", limits.RequestsPerMinute, limits.TokensPerMinute)
+	}
+
+	if err := config.Validate(); err != nil {
+		t.Errorf("Expected valid config to pass validation, got error: %v", err)
+	}
+
+	config.LLM.OpenAI.RateLimit.TokensPerMinute = -1
+	if err := config.Validate(); err == nil {
+		t.Error("Expected negative rate limit to fail validation, but it passed")
+	}
+}
+
+func TestProxyAndTLSConfig(t *testing.T) {
+	config := writeConfig(t, `llm:
+  openai:
+    api_key: test-api-key
+    proxy: socks5://proxy.example.com:1080
+    tls:
+      ca_file: ~/certs/ca.pem
+      cert_file: client.pem
+      key_file: client-key.pem
+`)
+
+	openai := config.LLM.OpenAI
+	if openai.Proxy != "socks5://proxy.example.com:1080" || openai.TLS.CAFile != "~/certs/ca.pem" || openai.TLS.KeyFile != "client-key.pem" {
+		t.Errorf("Expected proxy and TLS settings to be loaded, got %q and %+v", openai.Proxy, openai.TLS)
+	}
+
+	if err := config.Validate(); err != nil {
+		t.Errorf("Expected valid config to pass validation, got error: %v", err)
+	}
+
+	for _, proxy := range []string{"ftp://proxy.example.com", "proxy.example.com:8080", "http://"} {
+		config.LLM.OpenAI.Proxy = proxy
+		if err := config.Validate(); err == nil {
+			t.Errorf("Expected proxy %q to fail validation, but it passed", proxy)
+		}
+	}
+	config.LLM.OpenAI.Proxy = ""
+
+	config.LLM.OpenAI.TLS.KeyFile = ""
+	if err := config.Validate(); err == nil {
+		t.Error("Expected cert_file without key_file to fail validation, but it passed")
+	}
+}
+
+func TestHeaders(t *testing.T) {
+	config := writeConfig(t, `llm:
+  openai:
+    api_key: test-api-key
+    headers:
+      X-Org: foo
+      x-litellm-tags: si
+`)
+
+	headers := config.LLM.OpenAI.Headers
+	if headers["X-Org"] != "foo" || headers["x-litellm-tags"] != "si" {
+		t.Errorf("Expected the headers to be loaded, got %v", headers)
+	}
+
+	if err := config.Validate(); err != nil {
+		t.Errorf("Expected valid config to pass validation, got error: %v", err)
+	}
+
+	config.LLM.OpenAI.Headers["X Org"] = "foo"
+	if err := config.Validate(); err == nil {
+		t.Error("Expected a header name with a space to fail validation, but it passed")
+	}
+}
+
+func TestAPIKeys(t *testing.T) {
+	config := writeConfig(t, `llm:
+  openai:
+    api_keys:
+      - sk-first
+      - sk-second
+    key_rotation:
+      strategy: least_recently_throttled
+      cooldown: 2m
+`)
+
+	if err := config.Validate(); err != nil {
+		t.Fatalf("Expected api_keys to replace api_key, got error: %v", err)
+	}
+
+	openai := config.LLM.OpenAI
+	if len(openai.APIKeys) != 2 || openai.APIKeys[1] != "sk-second" {
+		t.Errorf("Expected two API keys, got %v", openai.APIKeys)
+	}
+
+	if openai.KeyRotation.Strategy != KeyRotationLeastRecentlyThrottled {
+		t.Errorf("Expected the least recently throttled strategy, got '%s'", openai.KeyRotation.Strategy)
+	}
+
+	if openai.KeyRotation.CooldownPeriod() != 2*time.Minute {
+		t.Errorf("Expected a cooldown of 2m, got %v", openai.KeyRotation.CooldownPeriod())
+	}
+
+	if cooldown := (&KeyRotationConfig{}).CooldownPeriod(); cooldown != DefaultKeyCooldown {
+		t.Errorf("Expected the default cooldown, got %v", cooldown)
+	}
+
+	tests := []struct {
+		name   string
+		modify func(o *OpenAIConfig)
+	}{
+		{"combined with api_key", func(o *OpenAIConfig) { o.APIKey = "sk-third" }},
+		{"empty key", func(o *OpenAIConfig) { o.APIKeys = append(o.APIKeys, "") }},
+		{"unknown strategy", func(o *OpenAIConfig) { o.KeyRotation.Strategy = "random" }},
+		{"negative cooldown", func(o *OpenAIConfig) { o.KeyRotation.Cooldown = -time.Second }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			invalid := *config
+			invalid.LLM.OpenAI.APIKeys = append([]string(nil), openai.APIKeys...)
+			tt.modify(&invalid.LLM.OpenAI)
+			if err := invalid.Validate(); err == nil {
+				t.Error("Expected invalid key rotation to fail validation, but it passed")
+			}
+		})
+	}
+}
+
+func TestCacheConfig(t *testing.T) {
+	cache := CacheConfig{Mode: CacheSemantic}
+	if err := cache.Validate(); err != nil {
+		t.Errorf("Expected semantic cache to be valid, got %v", err)
+	}
+
+	if cache.MaxAge() != DefaultCacheTTL || cache.MinSimilarity() != DefaultCacheSimilarity {
+		t.Errorf("Expected defaults, got %v and %g", cache.MaxAge(), cache.MinSimilarity())
+	}
+
+	cache.Similarity = 1.5
+	if err := cache.Validate(); err == nil {
+		t.Error("Expected similarity above 1 to fail validation, but it passed")
+	}
+
+	cache = CacheConfig{Mode: "fuzzy"}
+	if err := cache.Validate(); err == nil {
+		t.Error("Expected unknown cache mode to fail validation, but it passed")
+	}
+}
+
+func TestPromptConfig(t *testing.T) {
+	tempDir := t.TempDir()
+	configPath := filepath.Join(tempDir, "config.yaml")
+
+	configContent := `llm:
+  openai:
+    api_key: test-api-key
+prompts:
+  short: "Explain: {{.Args}}"
+  extract:
+    template: "Extract the fields as JSON: {{.Input}}"
+    validate:
+      json: true
+      max_lines: 10
+      retries: 1
+  sql:
+    template: "{{.Args}}"
+    examples:
+      - user: count users
+        assistant: SELECT count(*) FROM users;
+`
+
+	if err := os.WriteFile(configPath, []byte(configContent), 0644); err != nil {
+		t.Fatalf("Failed to create test config file: %v", err)
+	}
+
+	config, err := LoadConfig(configPath)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	short := config.Prompts["short"]
+	if short.Template != "Explain: {{.Args}}" || short.Validate.Enabled() {
+		t.Errorf("Expected plain template without validation, got %+v", short)
+	}
+
+	if short.Validate.MaxRetries() != DefaultValidationRetries {
+		t.Errorf("Expected default retries, got %d", short.Validate.MaxRetries())
+	}
+
+	extract := config.Prompts["extract"]
+	if extract.Template != "Extract the fields as JSON: {{.Input}}" {
+		t.Errorf("Expected extract template, got '%s'", extract.Template)
+	}
+
+	if !extract.Validate.JSON || extract.Validate.MaxLines != 10 || extract.Validate.MaxRetries() != 1 {
+		t.Errorf("Expected validation rules to be parsed, got %+v", extract.Validate)
+	}
+
+	sql := config.Prompts["sql"]
+	if len(sql.Examples) != 1 || sql.Examples[0] != (PromptExample{User: "count users", Assistant: "SELECT count(*) FROM users;"}) {
+		t.Errorf("Expected the example to be parsed, got %+v", sql.Examples)
+	}
+
+	if err := config.Validate(); err != nil {
+		t.Errorf("Expected valid config to pass validation, got error: %v", err)
+	}
+
+	config.Prompts["sql"] = PromptConfig{Template: "{{.Args}}", Examples: []PromptExample{{User: "count users"}}}
+	if err := config.Validate(); err == nil || !strings.Contains(err.Error(), "example 1 needs both user and assistant") {
+		t.Errorf("Expected the example without answer to fail validation, got %v", err)
+	}
+	delete(config.Prompts, "sql")
+
+	config.Prompts["broken"] = PromptConfig{Validate: ValidationConfig{MustMatch: "("}}
+	if err := config.Validate(); err == nil {
+		t.Error("Expected invalid pattern to fail validation, but it passed")
+	}
+}
+
+// TestFetchConfig tests loading and validating the fetch allowlist
+func TestFetchConfig(t *testing.T) {
+	tempDir := t.TempDir()
+	configPath := filepath.Join(tempDir, "config.yaml")
+
+	configContent := `llm:
+  openai:
+    api_key: test-api-key
+fetch:
+  allowed_domains:
+    - docs.python.org
+    - "*.go.dev"
+`
+
+	if err := os.WriteFile(configPath, []byte(configContent), 0644); err != nil {
+		t.Fatalf("Failed to create test config file: %v", err)
+	}
+
+	config, err := LoadConfig(configPath)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	if err := config.Validate(); err != nil {
+		t.Errorf("Expected valid config to pass validation, got error: %v", err)
+	}
+
+	policy := config.Fetch.Policy(true)
+	if !policy.Allowed("pkg.go.dev") || policy.Allowed("example.com") {
+		t.Errorf("Expected only allowed domains to be fetched")
+	}
+
+	if !(&FetchConfig{}).Policy(false).Allowed("example.com") {
+		t.Errorf("Expected URLs from the user to be allowed without an allowlist")
+	}
+
+	if (&FetchConfig{}).Policy(true).Allowed("example.com") {
+		t.Errorf("Expected agent mode to block everything without an allowlist")
+	}
+
+	config.Fetch.AllowedDomains = append(config.Fetch.AllowedDomains, "https://example.com")
+	if err := config.Validate(); err == nil {
+		t.Error("Expected an URL in the allowlist to fail validation, but it passed")
+	}
+
+	if config.Fetch.PageTokens() != DefaultFetchMaxTokens || config.Fetch.PageTTL() != DefaultFetchCacheTTL {
+		t.Errorf("Expected the default page limits, got %d and %v", config.Fetch.PageTokens(), config.Fetch.PageTTL())
+	}
+
+	config.Fetch = FetchConfig{MaxTokens: -1}
+	if err := config.Validate(); err == nil {
+		t.Error("Expected a negative page limit to fail validation, but it passed")
+	}
+}
+
+// TestEmbedConfig tests the embedding batch size and its validation
+func TestEmbedConfig(t *testing.T) {
+	config := Config{LLM: LLMConfig{OpenAI: OpenAIConfig{APIKey: "test-api-key"}}}
+	if config.Embed.Batch() != DefaultEmbedBatchSize {
+		t.Errorf("Expected the default batch size, got %d", config.Embed.Batch())
+	}
+
+	config.Embed.BatchSize = -1
+	if err := config.Validate(); err == nil || !strings.Contains(err.Error(), "embed.batch_size must not be negative") {
+		t.Errorf("Expected a negative batch size to fail validation, got %v", err)
+	}
+}
+
+// TestRAGConfig tests the number of retrieved chunks and its validation
+func TestRAGConfig(t *testing.T) {
+	config := Config{LLM: LLMConfig{OpenAI: OpenAIConfig{APIKey: "test-api-key"}}}
+	if config.RAG.Results() != DefaultRAGTopK {
+		t.Errorf("Expected the default number of chunks, got %d", config.RAG.Results())
+	}
+
+	config.RAG.TopK = -1
+	if err := config.Validate(); err == nil || !strings.Contains(err.Error(), "rag.top_k must not be negative") {
+		t.Errorf("Expected a negative number of chunks to fail validation, got %v", err)
+	}
+}
+
+// TestSearchConfig tests validating the search engine settings
+func TestSearchConfig(t *testing.T) {
+	valid := []SearchConfig{
+		{},
+		{Backend: "searxng", URL: "https://searx.example.com"},
+		{Backend: "brave", APIKey: "key", MaxResults: 10},
+		{Backend: "bing", APIKey: "key"},
+	}
+	for _, search := range valid {
+		if err := search.Validate(); err != nil {
+			t.Errorf("Expected %+v to be valid, got %v", search, err)
+		}
+	}
+
+	invalid := map[string]SearchConfig{
+		`search.backend must be searxng, brave or bing, got "google"`: {Backend: "google"},
+		"search.url is required for searxng":                          {Backend: "searxng"},
+		"search.api_key is required for brave":                        {Backend: "brave"},
+		"search.max_results must not be negative":                     {Backend: "bing", APIKey: "key", MaxResults: -1},
+	}
+	for message, search := range invalid {
+		if err := search.Validate(); err == nil || !strings.Contains(err.Error(), message) {
+			t.Errorf("Expected %+v to fail with %q, got %v", search, message, err)
+		}
+	}
+}
+
+// TestAgentConfig tests loading and validating the agent configuration
+func TestAgentConfig(t *testing.T) {
+	tempDir := t.TempDir()
+	configPath := filepath.Join(tempDir, "config.yaml")
+
+	configContent := `llm:
+  openai:
+    api_key: test-api-key
+agent:
+  tools: [read_file, fetch]
+  max_steps: 5
+  subagents:
+    search:
+      description: Searches the codebase
+      tools: [read_file, shell]
+      max_tokens: 20000
+`
+
+	if err := os.WriteFile(configPath, []byte(configContent), 0644); err != nil {
+		t.Fatalf("Failed to create test config file: %v", err)
+	}
+
+	config, err := LoadConfig(configPath)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	if len(config.Agent.Tools) != 2 || config.Agent.Tools[1] != "fetch" {
+		t.Errorf("Expected tools [read_file fetch], got %v", config.Agent.Tools)
+	}
+	if config.Agent.MaxSteps != 5 {
+		t.Errorf("Expected max_steps 5, got %d", config.Agent.MaxSteps)
+	}
+
+	config.Agent.MaxSteps = -1
+	if err := config.Validate(); err == nil {
+		t.Error("Expected negative max_steps to fail validation, but it passed")
+	}
+
+	config.Agent.MaxSteps = 0
+	config.Agent.MaxCost = -0.5
+	if err := config.Validate(); err == nil {
+		t.Error("Expected negative max_cost to fail validation, but it passed")
+	}
+	config.Agent.MaxCost = 0
+
+	search := config.Agent.Subagents["search"]
+	if search.Description != "Searches the codebase" || len(search.Tools) != 2 || search.MaxTokens != 20000 {
+		t.Errorf("Expected the search sub-agent to be loaded, got %+v", search)
+	}
+	if err := config.Validate(); err != nil {
+		t.Errorf("Expected valid config to pass validation, got error: %v", err)
+	}
+
+	config.Agent.Subagents["search"] = SubagentConfig{}
+	if err := config.Validate(); err == nil || err.Error() != "agent.subagents.search.description is required" {
+		t.Errorf("Expected a sub-agent without description to fail validation, got %v", err)
+	}
+
+	config.Agent.Subagents = map[string]SubagentConfig{"code search": {Description: "Searches"}}
+	if err := config.Validate(); err == nil {
+		t.Error("Expected a sub-agent name with a space to fail validation, but it passed")
+	}
+}
+
+// TestAzureAPIVersion tests the default and the validation of the Azure
+// api-version
+func TestAzureAPIVersion(t *testing.T) {
+	config := &Config{LLM: LLMConfig{OpenAI: OpenAIConfig{APIKey: "test-api-key", AzureDeploymentName: "gpt-4o"}}}
+
+	if version := config.LLM.OpenAI.AzureVersion(); version != DefaultAzureAPIVersion {
+		t.Errorf("Expected the default api-version %s, got %s", DefaultAzureAPIVersion, version)
+	}
+
+	config.LLM.OpenAI.AzureAPIVersion = "2025-01-01-preview"
+	if err := config.Validate(); err != nil {
+		t.Errorf("Expected a preview version to pass validation, got error: %v", err)
+	}
+	if version := config.LLM.OpenAI.AzureVersion(); version != "2025-01-01-preview" {
+		t.Errorf("Expected api-version 2025-01-01-preview, got %s", version)
+	}
+
+	config.LLM.OpenAI.AzureAPIVersion = "latest"
+	if err := config.Validate(); err == nil {
+		t.Error("Expected an invalid api-version to fail validation, but it passed")
+	}
+}
+
+// TestOpenRouterConfig tests detecting OpenRouter and validating its settings
+func TestOpenRouterConfig(t *testing.T) {
+	config := &Config{LLM: LLMConfig{OpenAI: OpenAIConfig{APIKey: "test-api-key"}}}
+	if config.LLM.OpenAI.IsOpenRouter() {
+		t.Error("Expected the default base URL not to be OpenRouter")
+	}
+
+	config.LLM.OpenAI.OpenRouter.Providers = []string{"Azure"}
+	if err := config.Validate(); err == nil {
+		t.Error("Expected openrouter settings without the OpenRouter base URL to fail validation, but it passed")
+	}
+
+	config.LLM.OpenAI.BaseURL = OpenRouterBaseURL
+	if !config.LLM.OpenAI.IsOpenRouter() {
+		t.Errorf("Expected %s to be OpenRouter", OpenRouterBaseURL)
+	}
+	if err := config.Validate(); err != nil {
+		t.Errorf("Expected openrouter settings to pass validation, got error: %v", err)
+	}
+
+	config.LLM.OpenAI.OpenRouter.Providers = []string{"Azure", " "}
+	if err := config.Validate(); err == nil {
+		t.Error("Expected an empty provider name to fail validation, but it passed")
+	}
+}
+
+// TestMemoryConfig tests the size limit of the workspace memory
+func TestMemoryConfig(t *testing.T) {
+	config := &Config{LLM: LLMConfig{OpenAI: OpenAIConfig{APIKey: "test-api-key"}}}
+	if limit := config.Memory.SizeLimit(); limit != DefaultMemoryMaxSize {
+		t.Errorf("Expected the default size limit %d, got %d", DefaultMemoryMaxSize, limit)
+	}
+
+	config.Memory.MaxSize = 1024
+	if limit := config.Memory.SizeLimit(); limit != 1024 {
+		t.Errorf("Expected size limit 1024, got %d", limit)
+	}
+
+	config.Memory.MaxSize = -1
+	if err := config.Validate(); err == nil {
+		t.Error("Expected negative max_size to fail validation, but it passed")
+	}
+}
+
+// TestRedactConfig tests loading and validating the redaction settings
+func TestRedactConfig(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "config.yaml")
+	configContent := `llm:
+  openai:
+    api_key: test-api-key
+redact:
+  restore: true
+  pii: true
+  patterns:
+    internal_host: '\b[a-z0-9-]+\.corp\.example\.com\b'
+`
+	if err := os.WriteFile(configPath, []byte(configContent), 0644); err != nil {
+		t.Fatalf("Failed to create test config file: %v", err)
+	}
+
+	config, err := LoadConfig(configPath)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	if config.Redact.Disabled || !config.Redact.Restore || !config.Redact.PII || config.Redact.Patterns["internal_host"] != `\b[a-z0-9-]+\.corp\.example\.com\b` {
+		t.Errorf("Expected the redaction settings to be parsed, got %+v", config.Redact)
+	}
+	if err := config.Validate(); err != nil {
+		t.Errorf("Expected valid config to pass validation, got error: %v", err)
+	}
+
+	config.Redact.Patterns["broken"] = "("
+	if err := config.Validate(); err == nil || !strings.Contains(err.Error(), "redact.patterns.broken is invalid") {
+		t.Errorf("Expected invalid pattern to fail validation, got %v", err)
+	}
+}
+
+// TestInputConfig tests the input limits and their validation
+func TestInputConfig(t *testing.T) {
+	var input InputConfig
+	if input.Strategy() != DefaultTruncate || input.Validate() != nil {
+		t.Errorf("Expected the default strategy to be valid, got %q", input.Strategy())
+	}
+
+	input = InputConfig{MaxTokens: 1000, Truncate: "tail"}
+	if input.Strategy() != "tail" || input.Validate() != nil {
+		t.Errorf("Expected tail to be valid, got %q", input.Strategy())
+	}
+
+	input.Truncate = "middle"
+	if err := input.Validate(); err == nil || !strings.Contains(err.Error(), `input.truncate must be head, tail, head+tail or summarize, got "middle"`) {
+		t.Errorf("Expected an unknown strategy to fail validation, got %v", err)
+	}
+
+	input = InputConfig{MaxBytes: -1}
+	if err := input.Validate(); err == nil {
+		t.Error("Expected a negative limit to fail validation, but it passed")
+	}
+
+	input = InputConfig{MapReduce: true, ChunkTokens: -1}
+	if err := input.Validate(); err == nil {
+		t.Error("Expected a negative chunk size to fail validation, but it passed")
+	}
+}
@@ -0,0 +1,242 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// SaveValue sets the setting with the given dotted key, such as
+// "llm.openai.model_name", in the configuration file at path. The file is
+// created if it doesn't exist. Comments and the order of the other settings
+// are preserved.
+func SaveValue(path, key, value string) error {
+	if path == "" {
+		path = DefaultConfigPath()
+	}
+
+	doc, err := readDocument(path)
+	if err != nil {
+		return err
+	}
+	if err := setNode(doc, key, value); err != nil {
+		return err
+	}
+	return writeDocument(path, doc)
+}
+
+// SaveSection is SaveValue for mappings and lists: the value is encoded as
+// YAML and replaces the setting with the given dotted key
+func SaveSection(path, key string, value interface{}) error {
+	if path == "" {
+		path = DefaultConfigPath()
+	}
+
+	var section yaml.Node
+	if err := section.Encode(value); err != nil {
+		return fmt.Errorf("failed to encode %s: %w", key, err)
+	}
+
+	doc, err := readDocument(path)
+	if err != nil {
+		return err
+	}
+	node, err := keyNode(doc, key)
+	if err != nil {
+		return err
+	}
+	section.HeadComment, section.LineComment = node.HeadComment, node.LineComment
+	*node = section
+	return writeDocument(path, doc)
+}
+
+// SetValue is SaveValue for settings given by the user: the key has to be a
+// known setting and the value has to fit its type
+func SetValue(path, key, value string) error {
+	if path == "" {
+		path = DefaultConfigPath()
+	}
+	if !KnownKey(key) {
+		return fmt.Errorf("unknown setting %s", key)
+	}
+
+	doc, err := readDocument(path)
+	if err != nil {
+		return err
+	}
+	if err := setNode(doc, key, value); err != nil {
+		return err
+	}
+	var config Config
+	if err := doc.Decode(&config); err != nil {
+		return fmt.Errorf("invalid value %q for %s: %w", value, key, err)
+	}
+	return writeDocument(path, doc)
+}
+
+// GetValue returns the value of the setting with the given dotted key as it
+// is written in the configuration file at path, without expanding
+// environment variables. Mappings and lists are returned as YAML. The second
+// result is false if the file doesn't set the key.
+func GetValue(path, key string) (string, bool, error) {
+	if path == "" {
+		path = DefaultConfigPath()
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", false, fmt.Errorf("failed to read config file: %w", err)
+	}
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return "", false, fmt.Errorf("failed to parse config file: %w", err)
+	}
+	if doc.Kind == 0 {
+		return "", false, nil
+	}
+
+	node := doc.Content[0]
+	for _, name := range strings.Split(key, ".") {
+		if node.Kind != yaml.MappingNode {
+			return "", false, nil
+		}
+		if node = lookupNode(node, name); node == nil {
+			return "", false, nil
+		}
+	}
+	if node.Kind == yaml.ScalarNode {
+		return node.Value, true, nil
+	}
+
+	var buf strings.Builder
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(node); err != nil {
+		return "", false, fmt.Errorf("failed to encode %s: %w", key, err)
+	}
+	return strings.TrimSuffix(buf.String(), "\n"), true, nil
+}
+
+// KnownKey reports whether the dotted key is a setting of the configuration
+// file, or a part of one. Any name is accepted below settings that are maps,
+// such as prompts.
+func KnownKey(key string) bool {
+	t := reflect.TypeOf(Config{})
+	for _, name := range strings.Split(key, ".") {
+		for t.Kind() == reflect.Pointer || t.Kind() == reflect.Slice {
+			t = t.Elem()
+		}
+		switch t.Kind() {
+		case reflect.Map:
+			t = t.Elem()
+		case reflect.Struct:
+			field, ok := fieldByYAMLName(t, name)
+			if !ok {
+				return false
+			}
+			t = field.Type
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// fieldByYAMLName returns the field of the struct type, or of its inlined
+// structs, that is serialized with the YAML name
+func fieldByYAMLName(t reflect.Type, name string) (reflect.StructField, bool) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if isInline(field) {
+			if inlined, ok := fieldByYAMLName(field.Type, name); ok {
+				return inlined, true
+			}
+			continue
+		}
+		if yamlName(field) == name {
+			return field, true
+		}
+	}
+	return reflect.StructField{}, false
+}
+
+// readDocument parses the configuration file at path, an empty document if it
+// doesn't exist
+func readDocument(path string) (*yaml.Node, error) {
+	var doc yaml.Node
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse config file: %w", err)
+	}
+	if doc.Kind == 0 {
+		doc = yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{{Kind: yaml.MappingNode}}}
+	}
+	return &doc, nil
+}
+
+// setNode sets the scalar at the dotted key of the document, adding the
+// mappings leading to it
+func setNode(doc *yaml.Node, key, value string) error {
+	node, err := keyNode(doc, key)
+	if err != nil {
+		return err
+	}
+	*node = yaml.Node{Kind: yaml.ScalarNode, Value: value, HeadComment: node.HeadComment, LineComment: node.LineComment}
+	return nil
+}
+
+// keyNode returns the value node of the dotted key of the document, adding
+// the mappings leading to it
+func keyNode(doc *yaml.Node, key string) (*yaml.Node, error) {
+	node := doc.Content[0]
+	names := strings.Split(key, ".")
+	for i, name := range names {
+		if node.Kind != yaml.MappingNode {
+			return nil, fmt.Errorf("cannot set %s: %s is not a mapping", key, strings.Join(names[:i], "."))
+		}
+		node = mappingValue(node, name)
+	}
+	return node, nil
+}
+
+// writeDocument writes the document to the configuration file at path,
+// creating its directory if needed
+func writeDocument(path string, doc *yaml.Node) error {
+	var buf strings.Builder
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(doc); err != nil {
+		return fmt.Errorf("failed to encode config file: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create config directory: %w", err)
+	}
+	if err := os.WriteFile(path, []byte(buf.String()), 0600); err != nil {
+		return fmt.Errorf("failed to write config file: %w", err)
+	}
+	return nil
+}
+
+// mappingValue returns the value node of name in the mapping, adding an empty
+// mapping for it if the key doesn't exist yet
+func mappingValue(mapping *yaml.Node, name string) *yaml.Node {
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == name {
+			return mapping.Content[i+1]
+		}
+	}
+
+	value := &yaml.Node{Kind: yaml.MappingNode}
+	mapping.Content = append(mapping.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: name}, value)
+	return value
+}
@@ -0,0 +1,158 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSaveValue(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "si.yaml")
+	original := `llm:
+  openai:
+    # Your OpenAI API key
+    api_key: test-key
+    model_name: gpt-5-typo # the model
+`
+	if err := os.WriteFile(path, []byte(original), 0600); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+
+	if err := SaveValue(path, "llm.openai.model_name", "gpt-4o"); err != nil {
+		t.Fatalf("SaveValue failed: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read config: %v", err)
+	}
+	if !strings.Contains(string(data), "# Your OpenAI API key") || !strings.Contains(string(data), "# the model") {
+		t.Errorf("Expected comments to be preserved, got:\n%s", data)
+	}
+
+	config, err := LoadConfig(path)
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if config.LLM.OpenAI.ModelName != "gpt-4o" {
+		t.Errorf("Expected ModelName to be 'gpt-4o', got '%s'", config.LLM.OpenAI.ModelName)
+	}
+	if config.LLM.OpenAI.APIKey != "test-key" {
+		t.Errorf("Expected APIKey to be kept as 'test-key', got '%s'", config.LLM.OpenAI.APIKey)
+	}
+
+	// Missing keys and files are created
+	newPath := filepath.Join(t.TempDir(), "nested", "si.yaml")
+	if err := SaveValue(newPath, "llm.openai.model_name", "gpt-4o-mini"); err != nil {
+		t.Fatalf("SaveValue failed: %v", err)
+	}
+	config, err = LoadConfig(newPath)
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if config.LLM.OpenAI.ModelName != "gpt-4o-mini" {
+		t.Errorf("Expected ModelName to be 'gpt-4o-mini', got '%s'", config.LLM.OpenAI.ModelName)
+	}
+
+	// Values can't be nested below scalars
+	if err := SaveValue(path, "llm.openai.model_name.x", "y"); err == nil {
+		t.Error("Expected an error when setting a key below a scalar")
+	}
+}
+
+func TestSetValue(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "si.yaml")
+
+	if err := SetValue(path, "llm.openai.temperature", "0.2"); err != nil {
+		t.Fatalf("SetValue failed: %v", err)
+	}
+	if err := SetValue(path, "prompts.review.template", "Review {{.Input}}"); err != nil {
+		t.Fatalf("SetValue failed for a map entry: %v", err)
+	}
+	config, err := LoadConfig(path)
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if config.LLM.OpenAI.Temperature == nil || *config.LLM.OpenAI.Temperature != 0.2 {
+		t.Errorf("Expected Temperature to be 0.2, got %v", config.LLM.OpenAI.Temperature)
+	}
+	if config.Prompts["review"].Template != "Review {{.Input}}" {
+		t.Errorf("Expected the review prompt to be set, got '%s'", config.Prompts["review"].Template)
+	}
+
+	if err := SetValue(path, "llm.openai.modelname", "gpt-4o"); err == nil || !strings.Contains(err.Error(), "unknown setting") {
+		t.Errorf("Expected an unknown setting to be rejected, got %v", err)
+	}
+	if err := SetValue(path, "llm.openai.max_tokens", "many"); err == nil {
+		t.Error("Expected a value of the wrong type to be rejected")
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read config: %v", err)
+	}
+	if strings.Contains(string(data), "many") {
+		t.Errorf("Expected a rejected value not to be written, got:\n%s", data)
+	}
+}
+
+func TestGetValue(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "si.yaml")
+	if err := os.WriteFile(path, []byte("llm:\n  openai:\n    model_name: gpt-4o\n"), 0600); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+
+	value, ok, err := GetValue(path, "llm.openai.model_name")
+	if err != nil || !ok || value != "gpt-4o" {
+		t.Errorf("Expected gpt-4o, got %q, %v, %v", value, ok, err)
+	}
+	if _, ok, err := GetValue(path, "llm.openai.model_name.x"); ok || err != nil {
+		t.Errorf("Expected a key below a scalar to be unset, got %v, %v", ok, err)
+	}
+	if _, ok, _ := GetValue(path, "cache.mode"); ok {
+		t.Error("Expected cache.mode to be unset")
+	}
+}
+
+func TestKnownKey(t *testing.T) {
+	for _, key := range []string{"llm", "llm.openai.model_name", "llm.openai.temperature", "llm.openai.retry.backoff", "prompts.any.template", "saved.deploy"} {
+		if !KnownKey(key) {
+			t.Errorf("Expected %s to be known", key)
+		}
+	}
+	for _, key := range []string{"llm.anthropic", "llm.openai.model_name.x", "SamplingConfig", "prompts.any.unknown"} {
+		if KnownKey(key) {
+			t.Errorf("Expected %s to be unknown", key)
+		}
+	}
+}
+
+func TestSaveSection(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "si.yaml")
+	if err := os.WriteFile(path, []byte("# My config\nagent:\n  max_steps: 5\n"), 0600); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+
+	api := APIConfig{Spec: "/specs/todo.yaml", Operations: []string{"listTodos"}, Auth: APIAuthConfig{Type: "bearer", Token: "${TODO_TOKEN}"}}
+	if err := SaveSection(path, "agent.apis.todo", api); err != nil {
+		t.Fatalf("SaveSection failed: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read config: %v", err)
+	}
+	if !strings.Contains(string(data), "# My config") || !strings.Contains(string(data), "token: ${TODO_TOKEN}") {
+		t.Errorf("Expected the comment and the token reference to be kept, got:\n%s", data)
+	}
+
+	t.Setenv("TODO_TOKEN", "secret")
+	config, err := LoadConfig(path)
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	saved := config.Agent.APIs["todo"]
+	if config.Agent.MaxSteps != 5 || saved.Spec != "/specs/todo.yaml" || saved.Auth.Token != "secret" || len(saved.Operations) != 1 {
+		t.Errorf("Expected the API to be added to the agent section, got %+v", config.Agent)
+	}
+}
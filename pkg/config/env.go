@@ -0,0 +1,112 @@
+package config
+
+import (
+	"os"
+	"regexp"
+	"sort"
+
+	"gopkg.in/yaml.v3"
+)
+
+// envReference matches a ${VAR} reference to an environment variable in a
+// config value. $${VAR} is kept as the literal text ${VAR}.
+var envReference = regexp.MustCompile(`\$?\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// EnvFallback is a well-known environment variable used for a setting that
+// the config file leaves empty
+type EnvFallback struct {
+	// Key is the dotted YAML path of the setting
+	Key string
+
+	// Var is the name of the environment variable
+	Var string
+
+	// alternatives are settings that make the fallback unnecessary
+	alternatives []string
+
+	set func(c *Config, value string)
+}
+
+// EnvFallbacks are the environment variables other OpenAI clients read too
+var EnvFallbacks = []EnvFallback{
+	{Key: "llm.openai.api_key", Var: "OPENAI_API_KEY", alternatives: []string{"llm.openai.api_key_cmd", "llm.openai.api_keys"}, set: func(c *Config, v string) { c.LLM.OpenAI.APIKey = v }},
+	{Key: "llm.openai.base_url", Var: "OPENAI_BASE_URL", set: func(c *Config, v string) { c.LLM.OpenAI.BaseURL = v }},
+	{Key: "llm.openai.organization_id", Var: "OPENAI_ORG_ID", set: func(c *Config, v string) { c.LLM.OpenAI.OrganizationID = v }},
+	{Key: "llm.openai.project_id", Var: "OPENAI_PROJECT_ID", set: func(c *Config, v string) { c.LLM.OpenAI.ProjectID = v }},
+}
+
+// MissingEnv returns the environment variables the config file referenced
+// that are not set, sorted by name
+func (c *Config) MissingEnv() []string {
+	return c.missingEnv
+}
+
+// EnvLayers returns a layer for every setting that was taken from one of the
+// EnvFallbacks, so explanations can tell where its value comes from
+func (c *Config) EnvLayers() []Layer {
+	var layers []Layer
+	for _, fallback := range c.envFallbacks {
+		layer := Layer{Name: "env " + fallback.Var, Config: &Config{}}
+		fallback.set(layer.Config, os.Getenv(fallback.Var))
+		layers = append(layers, layer)
+	}
+	return layers
+}
+
+// expandEnv replaces the ${VAR} references in the scalar values of the YAML
+// document with the values of the environment variables and returns the
+// names of the variables that are not set. Unset variables expand to an
+// empty string.
+func expandEnv(node *yaml.Node) []string {
+	missing := make(map[string]bool)
+	var walk func(node *yaml.Node)
+	walk = func(node *yaml.Node) {
+		if node.Kind == yaml.ScalarNode {
+			node.Value = envReference.ReplaceAllStringFunc(node.Value, func(ref string) string {
+				if ref[1] == '$' {
+					return ref[1:]
+				}
+				name := envReference.FindStringSubmatch(ref)[1]
+				value, ok := os.LookupEnv(name)
+				if !ok {
+					missing[name] = true
+				}
+				return value
+			})
+		}
+		for _, child := range node.Content {
+			walk(child)
+		}
+	}
+	walk(node)
+
+	names := make([]string, 0, len(missing))
+	for name := range missing {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// applyEnvFallbacks fills the settings the config leaves empty from the
+// well-known environment variables
+func (c *Config) applyEnvFallbacks() {
+	settings := make(map[string]string)
+	for _, s := range c.Settings() {
+		settings[s.Key] = s.Value
+	}
+fallbacks:
+	for _, fallback := range EnvFallbacks {
+		value := os.Getenv(fallback.Var)
+		if settings[fallback.Key] != "" || value == "" {
+			continue
+		}
+		for _, key := range fallback.alternatives {
+			if settings[key] != "" {
+				continue fallbacks
+			}
+		}
+		fallback.set(c, value)
+		c.envFallbacks = append(c.envFallbacks, fallback)
+	}
+}
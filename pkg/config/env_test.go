@@ -0,0 +1,119 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// writeConfig writes a config file to a temporary directory and loads it
+func writeConfig(t *testing.T, content string) *Config {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "si.yaml")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to create test config file: %v", err)
+	}
+	config, err := LoadConfig(path)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	return config
+}
+
+func TestLoadConfigExpandsEnv(t *testing.T) {
+	t.Setenv("SI_TEST_KEY", "sk-from-env")
+	t.Setenv("SI_TEST_HOST", "llm.internal")
+
+	config := writeConfig(t, `llm:
+  openai:
+    api_key: ${SI_TEST_KEY}
+    base_url: https://${SI_TEST_HOST}/v1
+    model_name: ${SI_TEST_MODEL}
+prompts:
+  literal: "Keep $${SI_TEST_KEY} as is"
+`)
+
+	if config.LLM.OpenAI.APIKey != "sk-from-env" {
+		t.Errorf("Expected APIKey to be expanded, got '%s'", config.LLM.OpenAI.APIKey)
+	}
+	if config.LLM.OpenAI.BaseURL != "https://llm.internal/v1" {
+		t.Errorf("Expected BaseURL to be expanded, got '%s'", config.LLM.OpenAI.BaseURL)
+	}
+	if config.LLM.OpenAI.ModelName != "" {
+		t.Errorf("Expected an unset variable to expand to nothing, got '%s'", config.LLM.OpenAI.ModelName)
+	}
+	if config.Prompts["literal"].Template != "Keep ${SI_TEST_KEY} as is" {
+		t.Errorf("Expected an escaped reference to be kept, got '%s'", config.Prompts["literal"].Template)
+	}
+	if missing := config.MissingEnv(); !reflect.DeepEqual(missing, []string{"SI_TEST_MODEL"}) {
+		t.Errorf("Expected SI_TEST_MODEL to be reported missing, got %v", missing)
+	}
+}
+
+func TestLoadConfigEnvFallbacks(t *testing.T) {
+	t.Setenv("OPENAI_API_KEY", "sk-fallback")
+	t.Setenv("OPENAI_BASE_URL", "https://proxy.example.com/v1")
+
+	config := writeConfig(t, `llm:
+  openai:
+    base_url: https://api.openai.com/v1
+`)
+	if config.LLM.OpenAI.APIKey != "sk-fallback" {
+		t.Errorf("Expected APIKey from OPENAI_API_KEY, got '%s'", config.LLM.OpenAI.APIKey)
+	}
+	if config.LLM.OpenAI.BaseURL != "https://api.openai.com/v1" {
+		t.Errorf("Expected BaseURL of the file to win over OPENAI_BASE_URL, got '%s'", config.LLM.OpenAI.BaseURL)
+	}
+
+	layers := config.EnvLayers()
+	if len(layers) != 1 || layers[0].Name != "env OPENAI_API_KEY" || layers[0].Config.LLM.OpenAI.APIKey != "sk-fallback" {
+		t.Errorf("Expected a single layer for OPENAI_API_KEY, got %+v", layers)
+	}
+
+	// The key of the file wins over the environment
+	config = writeConfig(t, `llm:
+  openai:
+    api_key: sk-file
+`)
+	if config.LLM.OpenAI.APIKey != "sk-file" || config.LLM.OpenAI.BaseURL != "https://proxy.example.com/v1" {
+		t.Errorf("Expected the key of the file and the base URL of the environment, got '%s' and '%s'", config.LLM.OpenAI.APIKey, config.LLM.OpenAI.BaseURL)
+	}
+	if len(config.MissingEnv()) != 0 {
+		t.Errorf("Expected no missing variables, got %v", config.MissingEnv())
+	}
+}
+
+func TestLoadConfigOrganizationFallbacks(t *testing.T) {
+	t.Setenv("OPENAI_ORG_ID", "org-env")
+	t.Setenv("OPENAI_PROJECT_ID", "proj_env")
+
+	config := writeConfig(t, `llm:
+  openai:
+    api_key: sk-file
+    project_id: proj_file
+`)
+	if config.LLM.OpenAI.OrganizationID != "org-env" || config.LLM.OpenAI.ProjectID != "proj_file" {
+		t.Errorf("Expected the organization of the environment and the project of the file, got '%s' and '%s'", config.LLM.OpenAI.OrganizationID, config.LLM.OpenAI.ProjectID)
+	}
+}
+
+func TestLoadConfigAPIKeyCmd(t *testing.T) {
+	t.Setenv("OPENAI_API_KEY", "sk-fallback")
+
+	config := writeConfig(t, `llm:
+  openai:
+    api_key_cmd: pass show openai
+`)
+	if config.LLM.OpenAI.APIKey != "" {
+		t.Errorf("Expected no fallback key next to api_key_cmd, got '%s'", config.LLM.OpenAI.APIKey)
+	}
+	if err := config.Validate(); err != nil {
+		t.Errorf("Expected api_key_cmd to be a valid source of the key, got %v", err)
+	}
+
+	config.LLM.OpenAI.APIKey = "sk-file"
+	if err := config.Validate(); err == nil {
+		t.Error("Expected api_key and api_key_cmd together to fail validation, but it passed")
+	}
+}
@@ -0,0 +1,55 @@
+package config
+
+import "fmt"
+
+// FallbackConfig is a model that answers when the models before it in
+// llm.fallbacks are rate limited or unavailable
+type FallbackConfig struct {
+	// Provider is the name of a provider in llm.providers. Without it, the
+	// model of the entry is used with the endpoint of the primary model.
+	Provider string `yaml:"provider,omitempty"`
+
+	// Model overrides the model name of the provider
+	Model string `yaml:"model,omitempty"`
+}
+
+// String returns the provider and model of the fallback
+func (f FallbackConfig) String() string {
+	switch {
+	case f.Provider == "":
+		return f.Model
+	case f.Model == "":
+		return f.Provider
+	}
+	return f.Provider + " " + f.Model
+}
+
+// ApplyFallback uses the fallback for the requests instead of the primary
+// model
+func (c *Config) ApplyFallback(fallback FallbackConfig) error {
+	if fallback.Provider != "" {
+		if err := c.ApplyProvider(fallback.Provider); err != nil {
+			return err
+		}
+	}
+	if fallback.Model != "" {
+		c.SetModel(fallback.Model)
+	}
+	return nil
+}
+
+// validateFallbacks checks that every fallback names a model or a
+// configured provider
+func (c *Config) validateFallbacks() error {
+	for i, fallback := range c.LLM.Fallbacks {
+		if fallback.Provider == "" && fallback.Model == "" {
+			return fmt.Errorf("llm.fallbacks[%d]: provider or model is required", i)
+		}
+		if fallback.Provider != "" {
+			if _, err := c.ProviderLayer(fallback.Provider); err != nil {
+				return fmt.Errorf("llm.fallbacks[%d]: %w", i, err)
+			}
+		}
+	}
+	return nil
+}
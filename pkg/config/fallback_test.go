@@ -0,0 +1,81 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+const fallbacksConfig = `llm:
+  openai:
+    api_key: sk-openai
+    model_name: gpt-4o
+  providers:
+    ollama:
+      base_url: http://localhost:11434/v1
+      api_key: ollama
+      model_name: llama3.2
+  fallbacks:
+    - model: gpt-4o-mini
+    - provider: ollama
+    - provider: ollama
+      model: qwen2.5-coder
+`
+
+func TestApplyFallback(t *testing.T) {
+	config := writeConfig(t, fallbacksConfig)
+	if err := config.Validate(); err != nil {
+		t.Fatalf("Expected the fallbacks to be valid, got %v", err)
+	}
+	fallbacks := config.LLM.Fallbacks
+	if len(fallbacks) != 3 {
+		t.Fatalf("Expected 3 fallbacks, got %d", len(fallbacks))
+	}
+
+	if err := config.ApplyFallback(fallbacks[0]); err != nil {
+		t.Fatalf("Failed to apply fallback: %v", err)
+	}
+	if config.LLM.OpenAI.ModelName != "gpt-4o-mini" || config.LLM.OpenAI.APIKey != "sk-openai" {
+		t.Errorf("Expected the model to be used with the primary endpoint, got '%s' and '%s'", config.LLM.OpenAI.ModelName, config.LLM.OpenAI.APIKey)
+	}
+
+	if err := config.ApplyFallback(fallbacks[1]); err != nil {
+		t.Fatalf("Failed to apply fallback: %v", err)
+	}
+	if config.LLM.OpenAI.BaseURL != "http://localhost:11434/v1" || config.LLM.OpenAI.ModelName != "llama3.2" {
+		t.Errorf("Expected the endpoint and model of the provider, got '%s' and '%s'", config.LLM.OpenAI.BaseURL, config.LLM.OpenAI.ModelName)
+	}
+
+	if err := config.ApplyFallback(fallbacks[2]); err != nil {
+		t.Fatalf("Failed to apply fallback: %v", err)
+	}
+	if config.LLM.OpenAI.ModelName != "qwen2.5-coder" {
+		t.Errorf("Expected the model of the fallback to override the provider, got '%s'", config.LLM.OpenAI.ModelName)
+	}
+
+	for i, expected := range []string{"gpt-4o-mini", "ollama", "ollama qwen2.5-coder"} {
+		if fallbacks[i].String() != expected {
+			t.Errorf("Expected fallback %d to be shown as '%s', got '%s'", i, expected, fallbacks[i].String())
+		}
+	}
+}
+
+func TestValidateFallbacks(t *testing.T) {
+	tests := []struct {
+		name     string
+		fallback string
+		expected string
+	}{
+		{"empty", "    - {}\n", "llm.fallbacks[0]: provider or model is required"},
+		{"unknown provider", "    - provider: groq\n", `llm.fallbacks[0]: unknown provider "groq"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := writeConfig(t, "llm:\n  openai:\n    api_key: sk-test\n  fallbacks:\n"+tt.fallback)
+			err := config.Validate()
+			if err == nil || !strings.Contains(err.Error(), tt.expected) {
+				t.Errorf("Expected error containing '%s', got %v", tt.expected, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,186 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Layer is a named partial configuration, such as the defaults, the config
+// file or values given on the command line
+type Layer struct {
+	// Name describes where the values of the layer come from
+	Name string
+
+	// Config contains the values set by the layer; zero values are unset
+	Config *Config
+}
+
+// Setting is a single flattened configuration value
+type Setting struct {
+	// Key is the dotted YAML path of the value, e.g. llm.openai.model_name
+	Key string
+
+	// Value is the value formatted for display
+	Value string
+
+	// Secret is true when the value must not be shown in clear text
+	Secret bool
+
+	// Source is the name of the layer the value comes from, or empty if unset
+	Source string
+}
+
+// Merge copies every value that is set in other over the values of c
+func (c *Config) Merge(other *Config) {
+	if other == nil {
+		return
+	}
+	mergeValue(reflect.ValueOf(c).Elem(), reflect.ValueOf(other).Elem())
+}
+
+// mergeValue recursively copies the non-zero values of src into dst
+func mergeValue(dst, src reflect.Value) {
+	switch src.Kind() {
+	case reflect.Struct:
+		for i := 0; i < src.NumField(); i++ {
+			if !src.Type().Field(i).IsExported() {
+				continue
+			}
+			mergeValue(dst.Field(i), src.Field(i))
+		}
+	case reflect.Map:
+		if src.Len() == 0 {
+			return
+		}
+		if dst.IsNil() {
+			dst.Set(reflect.MakeMap(src.Type()))
+		}
+		iter := src.MapRange()
+		for iter.Next() {
+			dst.SetMapIndex(iter.Key(), iter.Value())
+		}
+	default:
+		if !src.IsZero() {
+			dst.Set(src)
+		}
+	}
+}
+
+// Settings flattens the configuration into dotted keys in declaration order
+func (c *Config) Settings() []Setting {
+	var settings []Setting
+	flatten("", reflect.ValueOf(c).Elem(), false, func(s Setting) {
+		settings = append(settings, s)
+	})
+	return settings
+}
+
+// flatten walks the value and reports every leaf value under its dotted key
+func flatten(prefix string, v reflect.Value, secret bool, fn func(Setting)) {
+	switch v.Kind() {
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			field := v.Type().Field(i)
+			if isInline(field) {
+				flatten(prefix, v.Field(i), secret, fn)
+				continue
+			}
+			name := yamlName(field)
+			if name == "" || field.Tag.Get("explain") == "-" {
+				continue
+			}
+			flatten(joinKey(prefix, name), v.Field(i), field.Tag.Get("secret") == "true", fn)
+		}
+	case reflect.Map:
+		keys := v.MapKeys()
+		sort.Slice(keys, func(i, j int) bool {
+			return fmt.Sprint(keys[i].Interface()) < fmt.Sprint(keys[j].Interface())
+		})
+		for _, key := range keys {
+			flatten(joinKey(prefix, fmt.Sprint(key.Interface())), v.MapIndex(key), secret, fn)
+		}
+	case reflect.Pointer:
+		if v.IsNil() {
+			fn(Setting{Key: prefix, Secret: secret})
+			return
+		}
+		flatten(prefix, v.Elem(), secret, fn)
+	default:
+		value := ""
+		if !v.IsZero() {
+			value = fmt.Sprint(v.Interface())
+		}
+		fn(Setting{Key: prefix, Value: value, Secret: secret})
+	}
+}
+
+// yamlName returns the YAML key of a struct field, or empty if it is not serialized
+func yamlName(field reflect.StructField) string {
+	if !field.IsExported() {
+		return ""
+	}
+	name, _, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+	if name == "-" {
+		return ""
+	}
+	if name == "" {
+		return strings.ToLower(field.Name)
+	}
+	return name
+}
+
+// isInline reports whether a struct field is inlined into its parent in YAML
+func isInline(field reflect.StructField) bool {
+	_, options, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+	return field.IsExported() && strings.Contains(options, "inline")
+}
+
+func joinKey(prefix, name string) string {
+	if prefix == "" {
+		return name
+	}
+	return prefix + "." + name
+}
+
+// Explain merges the layers in order and returns every setting of the
+// resulting configuration annotated with the layer it was taken from
+func Explain(layers ...Layer) []Setting {
+	var keys []string
+	settings := make(map[string]Setting)
+
+	for _, layer := range layers {
+		if layer.Config == nil {
+			continue
+		}
+		for _, s := range layer.Config.Settings() {
+			if _, seen := settings[s.Key]; !seen {
+				keys = append(keys, s.Key)
+			} else if s.Value == "" {
+				continue
+			}
+			if s.Value != "" {
+				s.Source = layer.Name
+			}
+			settings[s.Key] = s
+		}
+	}
+
+	result := make([]Setting, 0, len(keys))
+	for _, key := range keys {
+		result = append(result, settings[key])
+	}
+	return result
+}
+
+// MaskSecret hides most of a secret value while keeping it recognizable
+func MaskSecret(value string) string {
+	if value == "" {
+		return ""
+	}
+	if len(value) < 12 {
+		return "****"
+	}
+	return value[:3] + "****" + value[len(value)-4:]
+}
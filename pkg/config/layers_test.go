@@ -0,0 +1,103 @@
+package config
+
+import (
+	"testing"
+)
+
+func TestMerge(t *testing.T) {
+	config := &Config{
+		LLM: LLMConfig{
+			OpenAI: OpenAIConfig{
+				BaseURL:   "https://api.openai.com/v1",
+				APIKey:    "file-key",
+				ModelName: "gpt-4",
+			},
+		},
+		Prompts: map[string]PromptConfig{"a": {Template: "file a"}, "b": {Template: "file b"}},
+	}
+
+	config.Merge(&Config{
+		LLM: LLMConfig{
+			OpenAI: OpenAIConfig{
+				ModelName: "gpt-4o",
+			},
+		},
+		Prompts: map[string]PromptConfig{"b": {Template: "override b"}},
+	})
+
+	if config.LLM.OpenAI.ModelName != "gpt-4o" {
+		t.Errorf("Expected ModelName to be 'gpt-4o', got '%s'", config.LLM.OpenAI.ModelName)
+	}
+
+	if config.LLM.OpenAI.APIKey != "file-key" {
+		t.Errorf("Expected APIKey to be kept as 'file-key', got '%s'", config.LLM.OpenAI.APIKey)
+	}
+
+	if config.Prompts["a"].Template != "file a" || config.Prompts["b"].Template != "override b" {
+		t.Errorf("Expected prompts to be merged, got %v", config.Prompts)
+	}
+}
+
+func TestExplain(t *testing.T) {
+	file := &Config{
+		LLM: LLMConfig{
+			OpenAI: OpenAIConfig{
+				APIKey:    "file-key",
+				ModelName: "gpt-4o",
+			},
+		},
+	}
+	flags := &Config{}
+	flags.SetModel("gpt-4o-mini")
+
+	settings := Explain(
+		Layer{Name: "default", Config: Defaults()},
+		Layer{Name: "file", Config: file},
+		Layer{Name: "flag", Config: flags},
+	)
+
+	expected := map[string]Setting{
+		"llm.openai.base_url":              {Key: "llm.openai.base_url", Value: DefaultBaseURL, Source: "default"},
+		"llm.openai.api_key":               {Key: "llm.openai.api_key", Value: "file-key", Secret: true, Source: "file"},
+		"llm.openai.model_name":            {Key: "llm.openai.model_name", Value: "gpt-4o-mini", Source: "flag"},
+		"llm.openai.azure_deployment_name": {Key: "llm.openai.azure_deployment_name"},
+	}
+
+	if len(settings) == 0 {
+		t.Fatal("Expected settings, got none")
+	}
+
+	if settings[0].Key != "llm.openai.base_url" {
+		t.Errorf("Expected settings in declaration order, got '%s' first", settings[0].Key)
+	}
+
+	found := 0
+	for _, s := range settings {
+		want, ok := expected[s.Key]
+		if !ok {
+			continue
+		}
+		found++
+		if s != want {
+			t.Errorf("Expected setting %+v, got %+v", want, s)
+		}
+	}
+
+	if found != len(expected) {
+		t.Errorf("Expected %d of the settings to be reported, got %d: %v", len(expected), found, settings)
+	}
+}
+
+func TestMaskSecret(t *testing.T) {
+	if got := MaskSecret("sk-abcdefghijklmnop"); got != "sk-****mnop" {
+		t.Errorf("Expected 'sk-****mnop', got '%s'", got)
+	}
+
+	if got := MaskSecret("short"); got != "****" {
+		t.Errorf("Expected '****', got '%s'", got)
+	}
+
+	if got := MaskSecret(""); got != "" {
+		t.Errorf("Expected empty string, got '%s'", got)
+	}
+}
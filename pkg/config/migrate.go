@@ -0,0 +1,186 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// CurrentVersion is the version of the config schema this si understands.
+// Files without a version are version 1.
+const CurrentVersion = 2
+
+// migration changes a config document from one version to the next. It
+// returns descriptions of the changes it made.
+type migration func(root *yaml.Node) []string
+
+// migrations[i] migrates version i+1 to version i+2
+var migrations = []migration{
+	migrateBaseURL,
+}
+
+// Migration describes a migration of a config file
+type Migration struct {
+	// From and To are the versions before and after the migration
+	From, To int
+
+	// Changes describe what was changed besides the version
+	Changes []string
+
+	// Backup is the path the previous file was saved to, empty if the
+	// migrated file wasn't written
+	Backup string
+
+	// Err is why the migrated file couldn't be written; the migrated config
+	// is used anyway
+	Err error
+}
+
+// Migrated returns the migration that was applied when the config was
+// loaded, or nil if the file was up to date
+func (c *Config) Migrated() *Migration {
+	return c.migration
+}
+
+// Migrate migrates the config file at path to the current version. The
+// previous file is kept as a backup next to it. It returns nil if the file is
+// up to date.
+func Migrate(path string) (*Migration, error) {
+	if path == "" {
+		path = DefaultConfigPath()
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	var document yaml.Node
+	if err := yaml.Unmarshal(data, &document); err != nil {
+		return nil, fmt.Errorf("failed to parse config file: %w", err)
+	}
+	m, err := migrateDocument(&document)
+	if m == nil || err != nil {
+		return nil, err
+	}
+	if m.Err = writeMigrated(path, data, &document, m); m.Err != nil {
+		return m, fmt.Errorf("failed to save the migrated config file: %w", m.Err)
+	}
+	return m, nil
+}
+
+// migrateDocument migrates the parsed config file to the current version in
+// place. It returns nil if the document is up to date.
+func migrateDocument(document *yaml.Node) (*Migration, error) {
+	if document.Kind == 0 || len(document.Content) == 0 || document.Content[0].Kind != yaml.MappingNode {
+		return nil, nil
+	}
+	root := document.Content[0]
+
+	version := 1
+	versionNode := lookupNode(root, "version")
+	if versionNode != nil {
+		v, err := strconv.Atoi(versionNode.Value)
+		if err != nil || v < 1 {
+			return nil, fmt.Errorf("invalid config version %q", versionNode.Value)
+		}
+		version = v
+	}
+	if version > CurrentVersion {
+		return nil, fmt.Errorf("config version %d is newer than the supported version %d, please update si", version, CurrentVersion)
+	}
+	if version == CurrentVersion {
+		return nil, nil
+	}
+
+	m := &Migration{From: version, To: CurrentVersion}
+	for v := version; v < CurrentVersion; v++ {
+		m.Changes = append(m.Changes, migrations[v-1](root)...)
+	}
+
+	if versionNode == nil {
+		versionNode = &yaml.Node{Kind: yaml.ScalarNode}
+		root.Content = append([]*yaml.Node{{Kind: yaml.ScalarNode, Value: "version"}, versionNode}, root.Content...)
+	}
+	*versionNode = yaml.Node{Kind: yaml.ScalarNode, Tag: "!!int", Value: strconv.Itoa(CurrentVersion), LineComment: versionNode.LineComment}
+	return m, nil
+}
+
+// writeMigrated saves the original file as a backup and writes the migrated
+// document in its place, with the same permissions
+func writeMigrated(path string, original []byte, document *yaml.Node, m *Migration) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+
+	var buf strings.Builder
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(document); err != nil {
+		return err
+	}
+
+	// Never overwrite an earlier backup
+	backup := fmt.Sprintf("%s.v%d.bak", path, m.From)
+	for i := 1; ; i++ {
+		file, err := os.OpenFile(backup, os.O_WRONLY|os.O_CREATE|os.O_EXCL, info.Mode().Perm())
+		if os.IsExist(err) {
+			backup = fmt.Sprintf("%s.v%d.bak.%d", path, m.From, i)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		_, err = file.Write(original)
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return err
+		}
+		break
+	}
+
+	if err := os.WriteFile(path, []byte(buf.String()), info.Mode().Perm()); err != nil {
+		return err
+	}
+	m.Backup = backup
+	return nil
+}
+
+// lookupNode returns the value node of name in the mapping, or nil
+func lookupNode(mapping *yaml.Node, name string) *yaml.Node {
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == name {
+			return mapping.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// migrateBaseURL migrates to version 2, in which llm.openai.base_url is
+// always the base URL of the API. Version 1 also accepted the URL of the chat
+// completions endpoint, which can't be used for the other endpoints.
+func migrateBaseURL(root *yaml.Node) []string {
+	node := root
+	for _, name := range []string{"llm", "openai", "base_url"} {
+		if node.Kind != yaml.MappingNode {
+			return nil
+		}
+		if node = lookupNode(node, name); node == nil {
+			return nil
+		}
+	}
+
+	base, _, found := strings.Cut(node.Value, "/chat/completions")
+	if node.Kind != yaml.ScalarNode || !found {
+		return nil
+	}
+	change := fmt.Sprintf("llm.openai.base_url: %s -> %s", node.Value, base)
+	node.Value = base
+	return []string{change}
+}
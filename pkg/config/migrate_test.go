@@ -0,0 +1,120 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Turee/si/pkg/state"
+)
+
+const versionOneConfig = `# My si config
+llm:
+  openai:
+    base_url: https://api.openai.com/v1/chat/completions # the endpoint
+    api_key: test-api-key
+`
+
+func TestMigrate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "si.yaml")
+	if err := os.WriteFile(path, []byte(versionOneConfig), 0600); err != nil {
+		t.Fatalf("Failed to create test config file: %v", err)
+	}
+
+	m, err := Migrate(path)
+	if err != nil {
+		t.Fatalf("Failed to migrate config: %v", err)
+	}
+	if m == nil || m.From != 1 || m.To != CurrentVersion {
+		t.Fatalf("Expected a migration from 1 to %d, got %+v", CurrentVersion, m)
+	}
+	if len(m.Changes) != 1 || !strings.Contains(m.Changes[0], "llm.openai.base_url") {
+		t.Errorf("Expected the base URL change to be reported, got %v", m.Changes)
+	}
+
+	backup, err := os.ReadFile(m.Backup)
+	if err != nil || string(backup) != versionOneConfig {
+		t.Errorf("Expected the backup %s to contain the previous file, got %q (%v)", m.Backup, backup, err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read migrated config: %v", err)
+	}
+	migrated := string(data)
+	for _, want := range []string{"version: 2\n", "base_url: https://api.openai.com/v1 # the endpoint\n", "# My si config"} {
+		if !strings.Contains(migrated, want) {
+			t.Errorf("Expected the migrated file to contain %q, got:\n%s", want, migrated)
+		}
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("Expected the permissions of the file to be kept, got %v (%v)", info.Mode(), err)
+	}
+
+	// The migrated file is up to date
+	if m, err := Migrate(path); m != nil || err != nil {
+		t.Errorf("Expected no migration of an up to date file, got %+v (%v)", m, err)
+	}
+
+	// Earlier backups are never overwritten
+	if err := os.WriteFile(path, []byte(versionOneConfig), 0600); err != nil {
+		t.Fatalf("Failed to create test config file: %v", err)
+	}
+	if m, err = Migrate(path); err != nil || m.Backup != path+".v1.bak.1" {
+		t.Errorf("Expected a second backup, got %+v (%v)", m, err)
+	}
+}
+
+func TestLoadConfigMigrates(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "si.yaml")
+	if err := os.WriteFile(path, []byte(versionOneConfig), 0644); err != nil {
+		t.Fatalf("Failed to create test config file: %v", err)
+	}
+
+	config, err := LoadConfig(path)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	if config.Version != CurrentVersion || config.LLM.OpenAI.BaseURL != "https://api.openai.com/v1" {
+		t.Errorf("Expected the migrated config, got version %d and base URL %s", config.Version, config.LLM.OpenAI.BaseURL)
+	}
+	if m := config.Migrated(); m == nil || m.Err != nil || m.Backup == "" {
+		t.Errorf("Expected the migration to be saved, got %+v", m)
+	}
+
+	config, err = LoadConfig(path)
+	if err != nil || config.Migrated() != nil {
+		t.Errorf("Expected the saved file to be up to date, got %+v (%v)", config.Migrated(), err)
+	}
+
+	// Files of a newer si are rejected instead of misread
+	if err := os.WriteFile(path, []byte("version: 99\n"), 0644); err != nil {
+		t.Fatalf("Failed to create test config file: %v", err)
+	}
+	if _, err := LoadConfig(path); err == nil || !strings.Contains(err.Error(), "please update si") {
+		t.Errorf("Expected an error for a newer config version, got %v", err)
+	}
+}
+
+func TestLoadConfigMigratesReadOnly(t *testing.T) {
+	state.SetReadOnly(true)
+	defer state.SetReadOnly(false)
+
+	path := filepath.Join(t.TempDir(), "si.yaml")
+	if err := os.WriteFile(path, []byte(versionOneConfig), 0644); err != nil {
+		t.Fatalf("Failed to create test config file: %v", err)
+	}
+
+	config, err := LoadConfig(path)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	if m := config.Migrated(); m == nil || !errors.Is(m.Err, state.ErrReadOnly) {
+		t.Errorf("Expected the migration not to be saved, got %+v", m)
+	}
+	if data, _ := os.ReadFile(path); string(data) != versionOneConfig {
+		t.Errorf("Expected the file to be left alone, got %s", data)
+	}
+}
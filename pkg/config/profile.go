@@ -0,0 +1,83 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ProfileConfig is a named set of settings that replace the settings of the
+// rest of the configuration when the profile is used. Unset values are taken
+// from the rest of the configuration.
+type ProfileConfig struct {
+	// LLM configures the provider and the model of the profile
+	LLM LLMConfig `yaml:"llm,omitempty"`
+
+	// System configures the system prompt of the profile
+	System SystemConfig `yaml:"system,omitempty"`
+
+	// Script is the path of the Starlark hook script of the profile
+	Script string `yaml:"script,omitempty"`
+}
+
+// ProfileNames returns the names of the configured profiles, sorted
+func (c *Config) ProfileNames() []string {
+	names := make([]string, 0, len(c.Profiles))
+	for name := range c.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ProfileLayer returns the settings of the named profile as a layer
+func (c *Config) ProfileLayer(name string) (Layer, error) {
+	profile, ok := c.Profiles[name]
+	if !ok {
+		if len(c.Profiles) == 0 {
+			return Layer{}, fmt.Errorf("unknown profile %q, no profiles are configured", name)
+		}
+		return Layer{}, fmt.Errorf("unknown profile %q (available: %s)", name, strings.Join(c.ProfileNames(), ", "))
+	}
+	return Layer{Name: "profile " + name, Config: &Config{LLM: profile.LLM, System: profile.System, Script: profile.Script}}, nil
+}
+
+// ApplyProfile applies the settings of the named profile over the rest of
+// the configuration. A profile with its own API key, key command or keys
+// replaces all of them, so the key of another account is never combined
+// with it.
+func (c *Config) ApplyProfile(name string) error {
+	layer, err := c.ProfileLayer(name)
+	if err != nil {
+		return err
+	}
+
+	openai := layer.Config.LLM.OpenAI
+	if openai.APIKey != "" || openai.APIKeyCmd != "" || len(openai.APIKeys) > 0 {
+		c.LLM.OpenAI.APIKey, c.LLM.OpenAI.APIKeyCmd, c.LLM.OpenAI.APIKeys = "", "", nil
+	}
+	c.Merge(layer.Config)
+	c.Profile = name
+	return nil
+}
+
+// validateProfiles checks the default profile and the settings of every
+// profile that can be checked on their own
+func (c *Config) validateProfiles() error {
+	if c.Profile != "" {
+		if _, err := c.ProfileLayer(c.Profile); err != nil {
+			return fmt.Errorf("profile: %w", err)
+		}
+	}
+
+	for _, name := range c.ProfileNames() {
+		openai := c.Profiles[name].LLM.OpenAI
+		if openai.APIKey != "" && openai.APIKeyCmd != "" {
+			return fmt.Errorf("profiles.%s: api_key and api_key_cmd can't both be set", name)
+		}
+		if err := openai.Validate(); err != nil {
+			return fmt.Errorf("profiles.%s: %w", name, err)
+		}
+	}
+	return nil
+}
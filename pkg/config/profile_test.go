@@ -0,0 +1,152 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+const profilesConfig = `llm:
+  openai:
+    api_key: sk-personal
+    model_name: gpt-4o
+system:
+  prompt: Be brief.
+profile: personal
+profiles:
+  personal:
+    llm:
+      openai:
+        model_name: gpt-4o-mini
+  work:
+    llm:
+      openai:
+        api_key_cmd: pass show work/openai
+        base_url: https://llm.example.com/v1
+        model_name: gpt-4.1
+    system:
+      prompt: Answer for a software engineer.
+    script: ~/.config/si/work.star
+`
+
+func TestApplyProfile(t *testing.T) {
+	config := writeConfig(t, profilesConfig)
+	if err := config.Validate(); err != nil {
+		t.Fatalf("Expected the profiles to be valid, got %v", err)
+	}
+	if names := config.ProfileNames(); strings.Join(names, ",") != "personal,work" {
+		t.Errorf("Expected sorted profile names, got %v", names)
+	}
+
+	if err := config.ApplyProfile("work"); err != nil {
+		t.Fatalf("Failed to apply profile: %v", err)
+	}
+	openai := config.LLM.OpenAI
+	if openai.APIKey != "" || openai.APIKeyCmd != "pass show work/openai" {
+		t.Errorf("Expected the key command of the profile to replace the key, got '%s' and '%s'", openai.APIKey, openai.APIKeyCmd)
+	}
+	if openai.ModelName != "gpt-4.1" || openai.BaseURL != "https://llm.example.com/v1" {
+		t.Errorf("Expected the model and base URL of the profile, got '%s' and '%s'", openai.ModelName, openai.BaseURL)
+	}
+	if config.System.Prompt != "Answer for a software engineer." {
+		t.Errorf("Expected the system prompt of the profile, got '%s'", config.System.Prompt)
+	}
+	if config.Script != "~/.config/si/work.star" {
+		t.Errorf("Expected the hook script of the profile, got '%s'", config.Script)
+	}
+	if config.Profile != "work" {
+		t.Errorf("Expected the applied profile to be recorded, got '%s'", config.Profile)
+	}
+	if err := config.Validate(); err != nil {
+		t.Errorf("Expected the config to be valid with the profile, got %v", err)
+	}
+
+	// Settings the profile leaves unset are kept
+	config = writeConfig(t, profilesConfig)
+	if err := config.ApplyProfile("personal"); err != nil {
+		t.Fatalf("Failed to apply profile: %v", err)
+	}
+	if config.LLM.OpenAI.APIKey != "sk-personal" || config.LLM.OpenAI.ModelName != "gpt-4o-mini" || config.System.Prompt != "Be brief." || config.Script != "" {
+		t.Errorf("Expected the profile to be merged over the config, got %+v", config)
+	}
+
+	err := config.ApplyProfile("azure")
+	if err == nil || !strings.Contains(err.Error(), `unknown profile "azure" (available: personal, work)`) {
+		t.Errorf("Expected an unknown profile error, got %v", err)
+	}
+}
+
+func TestModelKey(t *testing.T) {
+	config := writeConfig(t, `llm:
+  providers:
+    groq:
+      base_url: https://api.groq.com/openai/v1
+profiles:
+  work:
+    llm:
+      providers:
+        local:
+          base_url: http://localhost:11434/v1
+`)
+	testCases := []struct {
+		profile, provider, key string
+	}{
+		{"", "", "llm.openai.model_name"},
+		{"", "groq", "llm.providers.groq.model_name"},
+		{"work", "", "profiles.work.llm.openai.model_name"},
+		{"work", "groq", "llm.providers.groq.model_name"},
+		{"work", "local", "profiles.work.llm.providers.local.model_name"},
+	}
+	for _, tc := range testCases {
+		config.Profile, config.LLM.Provider = tc.profile, tc.provider
+		if key := config.ModelKey(); key != tc.key {
+			t.Errorf("Expected %q with profile %q and provider %q, got %q", tc.key, tc.profile, tc.provider, key)
+		}
+	}
+}
+
+func TestValidateProfiles(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		error   string
+	}{
+		{
+			name:    "unknown default profile",
+			content: "profile: azure\nprofiles:\n  work: {}\n",
+			error:   `profile: unknown profile "azure"`,
+		},
+		{
+			name:    "no profiles",
+			content: "profile: work\n",
+			error:   "no profiles are configured",
+		},
+		{
+			name:    "invalid profile setting",
+			content: "profiles:\n  work:\n    llm:\n      openai:\n        temperature: 3\n",
+			error:   "profiles.work: temperature",
+		},
+		{
+			name:    "key and key command",
+			content: "profiles:\n  work:\n    llm:\n      openai:\n        api_key: sk-work\n        api_key_cmd: pass show work\n",
+			error:   "profiles.work: api_key and api_key_cmd",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := writeConfig(t, "llm:\n  openai:\n    api_key: sk-test\n"+tt.content)
+			err := config.Validate()
+			if err == nil || !strings.Contains(err.Error(), tt.error) {
+				t.Errorf("Expected an error containing '%s', got %v", tt.error, err)
+			}
+		})
+	}
+}
+
+func TestExplainSkipsProfiles(t *testing.T) {
+	config := writeConfig(t, profilesConfig)
+	for _, s := range config.Settings() {
+		if strings.HasPrefix(s.Key, "profiles") {
+			t.Errorf("Expected profiles to be left out of the settings, got %s", s.Key)
+		}
+	}
+}
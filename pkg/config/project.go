@@ -0,0 +1,145 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ProjectConfigFile is the name of the config file of a project, usually
+// committed to its repository
+const ProjectConfigFile = ".si.yaml"
+
+// ProjectSettings are the settings a project config file may contain, with
+// their sub-settings. Everything else, such as the base URL, the API key or
+// hook scripts, is left to the user config, as a cloned repository must not
+// be able to send questions elsewhere or run commands.
+var ProjectSettings = []string{
+	"version",
+	"llm.openai.model_name",
+	"llm.openai.temperature",
+	"llm.openai.top_p",
+	"llm.openai.max_tokens",
+	"llm.openai.context_window",
+	"prompts",
+	"formats",
+	"commit",
+	"memory",
+	"system",
+	"roles",
+	"saved",
+	"review",
+	"pr",
+}
+
+// FindProjectConfig returns the path of the project config file closest to
+// dir, looking in dir and its parents. It returns an empty path if there is
+// none.
+func FindProjectConfig(dir string) (string, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+
+	for {
+		path := filepath.Join(dir, ProjectConfigFile)
+		if info, err := os.Stat(path); err == nil && info.Mode().IsRegular() {
+			return path, nil
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", nil
+		}
+		dir = parent
+	}
+}
+
+// ProjectLayers returns a layer for the project config file merged into the
+// config, so explanations can tell which settings it overrides
+func (c *Config) ProjectLayers() []Layer {
+	if c.project == nil {
+		return nil
+	}
+	return []Layer{*c.project}
+}
+
+// loadProject merges the project config file of the working directory, if
+// there is one besides the user config at path, into the config
+func (c *Config) loadProject(path string) error {
+	dir, err := os.Getwd()
+	if err != nil {
+		return nil
+	}
+	projectPath, err := FindProjectConfig(dir)
+	if err != nil || projectPath == "" || sameFile(projectPath, path) {
+		return nil
+	}
+
+	project, err := loadFile(projectPath, true)
+	if err != nil {
+		return fmt.Errorf("project config %s: %w", projectPath, err)
+	}
+	c.Merge(project)
+	c.project = &Layer{Name: "project " + projectPath, Config: project}
+	return nil
+}
+
+// checkProjectSettings returns an error if the project config document sets
+// anything but the ProjectSettings
+func checkProjectSettings(document *yaml.Node) error {
+	if document.Kind == 0 || len(document.Content) == 0 || document.Content[0].Kind != yaml.MappingNode {
+		return nil
+	}
+
+	var denied []string
+	var walk func(prefix string, mapping *yaml.Node)
+	walk = func(prefix string, mapping *yaml.Node) {
+		for i := 0; i+1 < len(mapping.Content); i += 2 {
+			key := joinKey(prefix, mapping.Content[i].Value)
+			switch {
+			case projectSetting(key):
+			case mapping.Content[i+1].Kind == yaml.MappingNode && projectParent(key):
+				walk(key, mapping.Content[i+1])
+			default:
+				denied = append(denied, key)
+			}
+		}
+	}
+	walk("", document.Content[0])
+
+	if len(denied) > 0 {
+		return fmt.Errorf("%s can't be set in a project, only in the user config", strings.Join(denied, ", "))
+	}
+	return nil
+}
+
+// projectSetting reports whether key is one of the ProjectSettings or below one
+func projectSetting(key string) bool {
+	for _, allowed := range ProjectSettings {
+		if key == allowed || strings.HasPrefix(key, allowed+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// projectParent reports whether some of the ProjectSettings are below key
+func projectParent(key string) bool {
+	for _, allowed := range ProjectSettings {
+		if strings.HasPrefix(allowed, key+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// sameFile reports whether both paths refer to the same existing file
+func sameFile(a, b string) bool {
+	infoA, errA := os.Stat(a)
+	infoB, errB := os.Stat(b)
+	return errA == nil && errB == nil && os.SameFile(infoA, infoB)
+}
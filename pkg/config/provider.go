@@ -0,0 +1,116 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Types of providers
+const (
+	// ProviderTypeOpenAICompatible is the type of providers that serve the
+	// OpenAI chat completions API, such as Groq, Mistral, DeepSeek, Together
+	// and vLLM
+	ProviderTypeOpenAICompatible = "openai_compatible"
+
+	// ProviderTypeCopilot is the GitHub Copilot chat API, authenticated with
+	// the GitHub token of a subscriber instead of an API key
+	ProviderTypeCopilot = "copilot"
+)
+
+// ProviderConfig is a named provider that replaces the endpoint of
+// llm.openai when it is selected. Settings it leaves unset, such as the
+// sampling parameters and retries, are taken from llm.openai.
+type ProviderConfig struct {
+	// Type is the API the provider serves: openai_compatible (default) or
+	// copilot
+	Type string `yaml:"type,omitempty"`
+
+	OpenAIConfig `yaml:",inline"`
+}
+
+// ProviderNames returns the names of the configured providers, sorted
+func (c *Config) ProviderNames() []string {
+	names := make([]string, 0, len(c.LLM.Providers))
+	for name := range c.LLM.Providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ProviderLayer returns the settings of the named provider as a layer
+func (c *Config) ProviderLayer(name string) (Layer, error) {
+	provider, ok := c.LLM.Providers[name]
+	if !ok {
+		if len(c.LLM.Providers) == 0 {
+			return Layer{}, fmt.Errorf("unknown provider %q, no providers are configured", name)
+		}
+		return Layer{}, fmt.Errorf("unknown provider %q (available: %s)", name, strings.Join(c.ProviderNames(), ", "))
+	}
+	return Layer{Name: "provider " + name, Config: &Config{LLM: LLMConfig{OpenAI: provider.OpenAIConfig}}}, nil
+}
+
+// ProviderType returns the type of the selected provider
+func (c *Config) ProviderType() string {
+	if provider, ok := c.LLM.Providers[c.LLM.Provider]; ok && provider.Type != "" {
+		return provider.Type
+	}
+	return ProviderTypeOpenAICompatible
+}
+
+// ApplyProvider uses the named provider for the requests. Its endpoint, key
+// and model replace those of llm.openai, so they are never mixed with the
+// settings of another provider.
+func (c *Config) ApplyProvider(name string) error {
+	layer, err := c.ProviderLayer(name)
+	if err != nil {
+		return err
+	}
+
+	openai := &c.LLM.OpenAI
+	openai.BaseURL, openai.APIKey, openai.APIKeyCmd, openai.ModelName = "", "", "", ""
+	openai.APIKeys, openai.KeyRotation = nil, KeyRotationConfig{}
+	openai.OrganizationID, openai.ProjectID = "", ""
+	openai.AzureDeploymentName, openai.AzureAPIVersion = "", ""
+	openai.OpenRouter = OpenRouterConfig{}
+	openai.Headers = nil
+	openai.ContextWindow = 0
+	c.Merge(layer.Config)
+	c.LLM.Provider = name
+	return nil
+}
+
+// validateProviders checks the default provider and the settings of every
+// provider that can be checked on their own
+func (c *Config) validateProviders() error {
+	if c.LLM.Provider != "" {
+		if _, err := c.ProviderLayer(c.LLM.Provider); err != nil {
+			return fmt.Errorf("llm.provider: %w", err)
+		}
+	}
+
+	for _, name := range c.ProviderNames() {
+		provider := c.LLM.Providers[name]
+		switch provider.Type {
+		case "", ProviderTypeOpenAICompatible:
+			if provider.BaseURL == "" || provider.ModelName == "" {
+				return fmt.Errorf("llm.providers.%s: base_url and model_name are required", name)
+			}
+		case ProviderTypeCopilot:
+			// The API of the subscription is the default base URL
+			if provider.ModelName == "" {
+				return fmt.Errorf("llm.providers.%s: model_name is required", name)
+			}
+		default:
+			return fmt.Errorf("llm.providers.%s.type must be %s or %s, got %q", name, ProviderTypeOpenAICompatible, ProviderTypeCopilot, provider.Type)
+		}
+		if provider.APIKey != "" && provider.APIKeyCmd != "" {
+			return fmt.Errorf("llm.providers.%s: api_key and api_key_cmd can't both be set", name)
+		}
+		if err := provider.OpenAIConfig.Validate(); err != nil {
+			return fmt.Errorf("llm.providers.%s: %w", name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,143 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+const providersConfig = `llm:
+  openai:
+    api_key: sk-openai
+    model_name: gpt-4o
+    context_window: 128000
+    temperature: 0.2
+    headers:
+      X-Org: openai-org
+  providers:
+    groq:
+      type: openai_compatible
+      base_url: https://api.groq.com/openai/v1
+      api_key_cmd: pass show groq
+      model_name: llama-3.3-70b-versatile
+    vllm:
+      base_url: http://localhost:8000/v1
+      api_key: none
+      model_name: qwen2.5-coder
+      temperature: 0
+      headers:
+        X-Route: gpu
+`
+
+func TestApplyProvider(t *testing.T) {
+	config := writeConfig(t, providersConfig)
+	if err := config.Validate(); err != nil {
+		t.Fatalf("Expected the providers to be valid, got %v", err)
+	}
+	if names := config.ProviderNames(); strings.Join(names, ",") != "groq,vllm" {
+		t.Errorf("Expected sorted provider names, got %v", names)
+	}
+
+	if err := config.ApplyProvider("groq"); err != nil {
+		t.Fatalf("Failed to apply provider: %v", err)
+	}
+	openai := config.LLM.OpenAI
+	if openai.APIKey != "" || openai.APIKeyCmd != "pass show groq" {
+		t.Errorf("Expected the key command of the provider to replace the key, got '%s' and '%s'", openai.APIKey, openai.APIKeyCmd)
+	}
+	if openai.BaseURL != "https://api.groq.com/openai/v1" || openai.ModelName != "llama-3.3-70b-versatile" {
+		t.Errorf("Expected the base URL and model of the provider, got '%s' and '%s'", openai.BaseURL, openai.ModelName)
+	}
+	if openai.ContextWindow != 0 {
+		t.Errorf("Expected the context window of the other model to be dropped, got %d", openai.ContextWindow)
+	}
+	if len(openai.Headers) != 0 {
+		t.Errorf("Expected the headers of llm.openai to be dropped, got %v", openai.Headers)
+	}
+	if openai.Temperature == nil || *openai.Temperature != 0.2 {
+		t.Errorf("Expected the temperature of llm.openai to be kept, got %v", openai.Temperature)
+	}
+	if config.LLM.Provider != "groq" {
+		t.Errorf("Expected the applied provider to be recorded, got '%s'", config.LLM.Provider)
+	}
+	if err := config.Validate(); err != nil {
+		t.Errorf("Expected the config to be valid with the provider, got %v", err)
+	}
+
+	// Settings of the provider override those of llm.openai
+	config = writeConfig(t, providersConfig)
+	if err := config.ApplyProvider("vllm"); err != nil {
+		t.Fatalf("Failed to apply provider: %v", err)
+	}
+	if config.LLM.OpenAI.APIKey != "none" || *config.LLM.OpenAI.Temperature != 0 {
+		t.Errorf("Expected the key and temperature of the provider, got %+v", config.LLM.OpenAI)
+	}
+	if headers := config.LLM.OpenAI.Headers; len(headers) != 1 || headers["X-Route"] != "gpu" {
+		t.Errorf("Expected only the headers of the provider, got %v", headers)
+	}
+
+	err := config.ApplyProvider("mistral")
+	if err == nil || !strings.Contains(err.Error(), `unknown provider "mistral" (available: groq, vllm)`) {
+		t.Errorf("Expected an unknown provider error, got %v", err)
+	}
+}
+
+func TestCopilotProvider(t *testing.T) {
+	config := writeConfig(t, "llm:\n  provider: copilot\n  providers:\n    copilot:\n      type: copilot\n      model_name: gpt-4o\n")
+	if err := config.ApplyProvider("copilot"); err != nil {
+		t.Fatalf("Failed to apply provider: %v", err)
+	}
+	if typ := config.ProviderType(); typ != ProviderTypeCopilot {
+		t.Errorf("Expected the copilot provider type, got '%s'", typ)
+	}
+	if err := config.Validate(); err != nil {
+		t.Errorf("Expected Copilot to need neither an API key nor a base URL, got %v", err)
+	}
+
+	config = writeConfig(t, "llm:\n  openai:\n    api_key: sk-test\n")
+	if typ := config.ProviderType(); typ != ProviderTypeOpenAICompatible {
+		t.Errorf("Expected the openai_compatible provider type by default, got '%s'", typ)
+	}
+}
+
+func TestValidateProviders(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		error   string
+	}{
+		{
+			name:    "unknown default provider",
+			content: "  provider: mistral\n  providers:\n    groq:\n      base_url: https://api.groq.com/openai/v1\n      model_name: llama3\n",
+			error:   `llm.provider: unknown provider "mistral"`,
+		},
+		{
+			name:    "no providers",
+			content: "  provider: groq\n",
+			error:   "no providers are configured",
+		},
+		{
+			name:    "unknown type",
+			content: "  providers:\n    groq:\n      type: anthropic\n      base_url: https://api.groq.com/openai/v1\n      model_name: llama3\n",
+			error:   "llm.providers.groq.type must be openai_compatible or copilot",
+		},
+		{
+			name:    "missing model",
+			content: "  providers:\n    groq:\n      base_url: https://api.groq.com/openai/v1\n",
+			error:   "llm.providers.groq: base_url and model_name are required",
+		},
+		{
+			name:    "invalid provider setting",
+			content: "  providers:\n    groq:\n      base_url: https://api.groq.com/openai/v1\n      model_name: llama3\n      temperature: 3\n",
+			error:   "llm.providers.groq: temperature",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := writeConfig(t, "llm:\n  openai:\n    api_key: sk-test\n"+tt.content)
+			err := config.Validate()
+			if err == nil || !strings.Contains(err.Error(), tt.error) {
+				t.Errorf("Expected an error containing '%s', got %v", tt.error, err)
+			}
+		})
+	}
+}
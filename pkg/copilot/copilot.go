@@ -0,0 +1,332 @@
+// Package copilot signs in to GitHub Copilot with the OAuth device flow and
+// exchanges the GitHub token for the short-lived tokens of the Copilot chat
+// API, so subscribers can use their subscription instead of an API key
+package copilot
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Turee/si/pkg/paths"
+	"github.com/Turee/si/pkg/version"
+)
+
+const (
+	// ClientID is the OAuth app of the Copilot editor plugins, whose GitHub
+	// tokens the Copilot token exchange accepts
+	ClientID = "Iv1.b507a08c87ecfe98"
+
+	// DefaultAPIURL is the Copilot chat API of individual subscriptions;
+	// the token exchange tells the API of other plans
+	DefaultAPIURL = "https://api.githubcopilot.com"
+
+	// integrationID identifies the kind of client to the Copilot API
+	integrationID = "vscode-chat"
+)
+
+// tokenMargin is how long before it expires a Copilot token is renewed
+const tokenMargin = time.Minute
+
+// ErrNotSignedIn is returned when there is no saved GitHub token
+var ErrNotSignedIn = errors.New("not signed in to GitHub Copilot, run si copilot login")
+
+// ErrTokenRejected is returned when GitHub doesn't accept the saved token
+var ErrTokenRejected = errors.New("GitHub rejected the token")
+
+// Client talks to the GitHub endpoints of the sign-in and the token exchange
+type Client struct {
+	HTTPClient *http.Client
+
+	// GitHubURL is the base URL of the device flow (default:
+	// https://github.com)
+	GitHubURL string
+
+	// APIURL is the base URL of the token exchange (default:
+	// https://api.github.com)
+	APIURL string
+}
+
+// NewClient creates a client of github.com
+func NewClient(httpClient *http.Client) *Client {
+	return &Client{HTTPClient: httpClient, GitHubURL: "https://github.com", APIURL: "https://api.github.com"}
+}
+
+// DeviceCode is the code the user enters on GitHub to sign in
+type DeviceCode struct {
+	DeviceCode      string `json:"device_code"`
+	UserCode        string `json:"user_code"`
+	VerificationURI string `json:"verification_uri"`
+	ExpiresIn       int    `json:"expires_in"`
+	Interval        int    `json:"interval"`
+}
+
+// RequestDeviceCode starts the device flow
+func (c *Client) RequestDeviceCode(ctx context.Context) (*DeviceCode, error) {
+	var code DeviceCode
+	form := url.Values{"client_id": {ClientID}, "scope": {"read:user"}}
+	if err := c.postForm(ctx, "/login/device/code", form, &code); err != nil {
+		return nil, fmt.Errorf("failed to start the sign-in: %w", err)
+	}
+	if code.DeviceCode == "" || code.UserCode == "" {
+		return nil, errors.New("failed to start the sign-in: GitHub sent no device code")
+	}
+	return &code, nil
+}
+
+// WaitForToken polls GitHub until the user entered the code and returns the
+// GitHub token, or fails when the code expired or the user denied access
+func (c *Client) WaitForToken(ctx context.Context, code *DeviceCode) (string, error) {
+	interval := time.Duration(code.Interval) * time.Second
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(code.ExpiresIn)*time.Second)
+	defer cancel()
+
+	form := url.Values{
+		"client_id":   {ClientID},
+		"device_code": {code.DeviceCode},
+		"grant_type":  {"urn:ietf:params:oauth:grant-type:device_code"},
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				return "", errors.New("the code expired before it was entered")
+			}
+			return "", ctx.Err()
+		case <-time.After(interval):
+		}
+
+		var resp struct {
+			AccessToken string `json:"access_token"`
+			Error       string `json:"error"`
+			Description string `json:"error_description"`
+		}
+		if err := c.postForm(ctx, "/login/oauth/access_token", form, &resp); err != nil {
+			return "", fmt.Errorf("failed to get the GitHub token: %w", err)
+		}
+
+		switch resp.Error {
+		case "":
+			if resp.AccessToken == "" {
+				return "", errors.New("GitHub sent no token")
+			}
+			return resp.AccessToken, nil
+		case "authorization_pending":
+		case "slow_down":
+			interval += 5 * time.Second
+		case "expired_token":
+			return "", errors.New("the code expired before it was entered")
+		case "access_denied":
+			return "", errors.New("the sign-in was canceled on GitHub")
+		default:
+			return "", fmt.Errorf("the sign-in failed: %s", strings.TrimSpace(resp.Error+" "+resp.Description))
+		}
+	}
+}
+
+// postForm posts the form to the GitHub URL and decodes the JSON response
+func (c *Client) postForm(ctx context.Context, path string, form url.Values, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, "POST", c.GitHubURL+path, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	return c.do(req, v)
+}
+
+// do sends the request and decodes the JSON response
+func (c *Client) do(req *http.Request, v interface{}) error {
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return &statusError{StatusCode: resp.StatusCode, Body: strings.TrimSpace(string(body))}
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// statusError is returned when GitHub responds with an error status
+type statusError struct {
+	StatusCode int
+	Body       string
+}
+
+// Error implements the error interface
+func (e *statusError) Error() string {
+	return fmt.Sprintf("request failed with status %d: %s", e.StatusCode, e.Body)
+}
+
+// Token is a short-lived token of the Copilot chat API
+type Token struct {
+	Value     string
+	ExpiresAt time.Time
+
+	// APIURL is the chat API of the subscription
+	APIURL string
+}
+
+// ExchangeToken exchanges the GitHub token of a Copilot subscriber for a
+// token of the Copilot chat API
+func (c *Client) ExchangeToken(ctx context.Context, githubToken string) (*Token, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", c.APIURL+"/copilot_internal/v2/token", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "token "+githubToken)
+	req.Header.Set("Accept", "application/json")
+	setEditorHeaders(req)
+
+	var resp struct {
+		Token     string `json:"token"`
+		ExpiresAt int64  `json:"expires_at"`
+		Endpoints struct {
+			API string `json:"api"`
+		} `json:"endpoints"`
+	}
+	if err := c.do(req, &resp); err != nil {
+		var statusErr *statusError
+		if errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusUnauthorized {
+			return nil, fmt.Errorf("%w, run si copilot login again: %w", ErrTokenRejected, err)
+		}
+		return nil, fmt.Errorf("failed to get a Copilot token, is Copilot enabled for the account? %w", err)
+	}
+	if resp.Token == "" {
+		return nil, errors.New("failed to get a Copilot token: GitHub sent no token")
+	}
+
+	token := &Token{Value: resp.Token, ExpiresAt: time.Unix(resp.ExpiresAt, 0), APIURL: resp.Endpoints.API}
+	if token.APIURL == "" {
+		token.APIURL = DefaultAPIURL
+	}
+	return token, nil
+}
+
+// TokenSource caches the Copilot token of a GitHub token and renews it
+// before it expires. It is safe for concurrent use.
+type TokenSource struct {
+	client      *Client
+	githubToken string
+
+	mu    sync.Mutex
+	token *Token
+}
+
+// TokenSource returns a source of Copilot tokens for the GitHub token
+func (c *Client) TokenSource(githubToken string) *TokenSource {
+	return &TokenSource{client: c, githubToken: githubToken}
+}
+
+// Token returns a valid Copilot token, exchanging the GitHub token for a new
+// one if needed
+func (s *TokenSource) Token(ctx context.Context) (*Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.token != nil && time.Until(s.token.ExpiresAt) > tokenMargin {
+		return s.token, nil
+	}
+	token, err := s.client.ExchangeToken(ctx, s.githubToken)
+	if err != nil {
+		return nil, err
+	}
+	s.token = token
+	return token, nil
+}
+
+// Transport returns a round tripper that authenticates requests with the
+// Copilot tokens of the source. With useTokenAPI, requests are sent to the
+// chat API the token exchange reported instead of the host of their URL.
+func (s *TokenSource) Transport(base http.RoundTripper, useTokenAPI bool) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &transport{source: s, base: base, useTokenAPI: useTokenAPI}
+}
+
+// transport authenticates requests to the Copilot chat API
+type transport struct {
+	source      *TokenSource
+	base        http.RoundTripper
+	useTokenAPI bool
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	token, err := t.source.Token(req.Context())
+	if err != nil {
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		return nil, err
+	}
+
+	req = req.Clone(req.Context())
+	if t.useTokenAPI {
+		api, err := url.Parse(token.APIURL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid Copilot API URL %q: %w", token.APIURL, err)
+		}
+		req.URL.Scheme, req.URL.Host = api.Scheme, api.Host
+		req.Host = ""
+	}
+	req.Header.Set("Authorization", "Bearer "+token.Value)
+	req.Header.Set("Copilot-Integration-Id", integrationID)
+	setEditorHeaders(req)
+	return t.base.RoundTrip(req)
+}
+
+// setEditorHeaders identifies si to GitHub like an editor plugin
+func setEditorHeaders(req *http.Request) {
+	editor := "si/" + version.Get().Version
+	req.Header.Set("Editor-Version", editor)
+	req.Header.Set("Editor-Plugin-Version", editor)
+	req.Header.Set("User-Agent", editor)
+}
+
+// DefaultTokenPath returns the path of the GitHub token saved by si copilot
+// login, in paths.ConfigDir
+func DefaultTokenPath() string {
+	return filepath.Join(paths.ConfigDir(), "copilot_token")
+}
+
+// LoadGitHubToken reads the saved GitHub token
+func LoadGitHubToken(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", ErrNotSignedIn
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to read the GitHub token: %w", err)
+	}
+	token := strings.TrimSpace(string(data))
+	if token == "" {
+		return "", ErrNotSignedIn
+	}
+	return token, nil
+}
+
+// SaveGitHubToken saves the GitHub token, readable only by the user
+func SaveGitHubToken(path, token string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("failed to create the config directory: %w", err)
+	}
+	if err := os.WriteFile(path, []byte(token+"\n"), 0600); err != nil {
+		return fmt.Errorf("failed to save the GitHub token: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,151 @@
+package copilot
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeGitHub serves the device flow and the token exchange. The token is
+// granted on the second poll, and Copilot tokens expire after expiresIn.
+type fakeGitHub struct {
+	polls     atomic.Int32
+	exchanges atomic.Int32
+	expiresIn atomic.Int64
+	apiURL    string
+}
+
+// ServeHTTP implements http.Handler
+func (f *fakeGitHub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	switch r.URL.Path {
+	case "/login/device/code":
+		if r.FormValue("client_id") != ClientID {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		io.WriteString(w, `{"device_code":"dev-1","user_code":"ABCD-1234","verification_uri":"https://github.com/login/device","expires_in":60,"interval":0}`)
+	case "/login/oauth/access_token":
+		if f.polls.Add(1) == 1 {
+			io.WriteString(w, `{"error":"authorization_pending"}`)
+			return
+		}
+		io.WriteString(w, `{"access_token":"ghu_test","token_type":"bearer"}`)
+	case "/copilot_internal/v2/token":
+		if r.Header.Get("Authorization") != "token ghu_test" {
+			w.WriteHeader(http.StatusUnauthorized)
+			io.WriteString(w, `{"message":"Bad credentials"}`)
+			return
+		}
+		n := f.exchanges.Add(1)
+		fmt.Fprintf(w, `{"token":"cop-%d","expires_at":%d,"endpoints":{"api":%q}}`, n, time.Now().Add(time.Duration(f.expiresIn.Load())).Unix(), f.apiURL)
+	case "/chat/completions":
+		fmt.Fprintf(w, `{"authorization":%q,"integration":%q}`, r.Header.Get("Authorization"), r.Header.Get("Copilot-Integration-Id"))
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+// newFakeGitHub starts a fake GitHub whose token exchange reports itself as
+// the chat API
+func newFakeGitHub(t *testing.T) (*fakeGitHub, *Client) {
+	fake := &fakeGitHub{}
+	fake.expiresIn.Store(int64(time.Hour))
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+	fake.apiURL = server.URL
+
+	client := NewClient(server.Client())
+	client.GitHubURL, client.APIURL = server.URL, server.URL
+	return fake, client
+}
+
+// TestDeviceFlow tests signing in with a device code
+func TestDeviceFlow(t *testing.T) {
+	fake, client := newFakeGitHub(t)
+
+	code, err := client.RequestDeviceCode(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "ABCD-1234", code.UserCode)
+	assert.Equal(t, "https://github.com/login/device", code.VerificationURI)
+
+	token, err := client.WaitForToken(context.Background(), code)
+	require.NoError(t, err)
+	assert.Equal(t, "ghu_test", token)
+	assert.Equal(t, int32(2), fake.polls.Load())
+}
+
+// TestExchangeToken tests exchanging the GitHub token for Copilot tokens,
+// which are cached until shortly before they expire
+func TestExchangeToken(t *testing.T) {
+	fake, client := newFakeGitHub(t)
+
+	token, err := client.ExchangeToken(context.Background(), "ghu_test")
+	require.NoError(t, err)
+	assert.Equal(t, "cop-1", token.Value)
+	assert.Equal(t, fake.apiURL, token.APIURL)
+
+	_, err = client.ExchangeToken(context.Background(), "ghu_revoked")
+	assert.ErrorContains(t, err, "run si copilot login again")
+
+	source := client.TokenSource("ghu_test")
+	for i := 0; i < 2; i++ {
+		token, err = source.Token(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, "cop-2", token.Value)
+	}
+
+	// Tokens about to expire are renewed
+	fake.expiresIn.Store(int64(30 * time.Second))
+	source = client.TokenSource("ghu_test")
+	first, err := source.Token(context.Background())
+	require.NoError(t, err)
+	second, err := source.Token(context.Background())
+	require.NoError(t, err)
+	assert.NotEqual(t, first.Value, second.Value)
+}
+
+// TestTransport tests authenticating requests and sending them to the chat
+// API of the subscription
+func TestTransport(t *testing.T) {
+	_, client := newFakeGitHub(t)
+
+	httpClient := &http.Client{Transport: client.TokenSource("ghu_test").Transport(nil, true)}
+	req, err := http.NewRequest("POST", DefaultAPIURL+"/chat/completions", nil)
+	require.NoError(t, err)
+	req.Header.Set("Authorization", "Bearer placeholder")
+
+	resp, err := httpClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"authorization":"Bearer cop-1","integration":"vscode-chat"}`, string(body))
+}
+
+// TestGitHubToken tests saving and loading the GitHub token
+func TestGitHubToken(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "si", "copilot_token")
+
+	_, err := LoadGitHubToken(path)
+	assert.ErrorIs(t, err, ErrNotSignedIn)
+
+	require.NoError(t, SaveGitHubToken(path, "ghu_test"))
+	token, err := LoadGitHubToken(path)
+	require.NoError(t, err)
+	assert.Equal(t, "ghu_test", token)
+
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+}
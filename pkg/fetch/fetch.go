@@ -0,0 +1,126 @@
+// Package fetch decides which URLs si may fetch and extracts the readable
+// text of fetched pages. URLs can come from the model, e.g. through tool
+// calls, so a prompt injection could otherwise make si send data to any host.
+package fetch
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Policy allows fetching URLs from a list of trusted domains
+type Policy struct {
+	domains []string
+	strict  bool
+}
+
+// NewPolicy creates a policy that allows the given domains. A domain
+// "example.com" matches only that host, "*.example.com" matches its
+// subdomains and "*" matches every host. With an empty list everything is
+// allowed, unless the policy is strict; strict policies are used when the
+// model decides what to fetch, e.g. in agent mode.
+func NewPolicy(domains []string, strict bool) *Policy {
+	normalized := make([]string, len(domains))
+	for i, domain := range domains {
+		normalized[i] = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(domain)), ".")
+	}
+	return &Policy{domains: normalized, strict: strict}
+}
+
+// ValidateDomain checks that a domain of the allowlist is a host name, with
+// an optional leading wildcard label
+func ValidateDomain(domain string) error {
+	if domain == "*" {
+		return nil
+	}
+
+	host := strings.TrimPrefix(domain, "*.")
+	if host == "" || strings.ContainsAny(host, "*/:@ ") {
+		return fmt.Errorf("invalid domain %q, expected a host name like example.com or *.example.com", domain)
+	}
+	return nil
+}
+
+// Allowed tells if the host may be fetched
+func (p *Policy) Allowed(host string) bool {
+	if len(p.domains) == 0 {
+		return !p.strict
+	}
+
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	for _, domain := range p.domains {
+		switch {
+		case domain == "*":
+			return true
+		case strings.HasPrefix(domain, "*."):
+			if strings.HasSuffix(host, domain[1:]) {
+				return true
+			}
+		case host == domain:
+			return true
+		}
+	}
+	return false
+}
+
+// Check returns an error if the URL may not be fetched. Only http and https
+// URLs are ever allowed.
+func (p *Policy) Check(rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return fmt.Errorf("invalid URL %q: %w", rawURL, err)
+	}
+	return p.check(u)
+}
+
+func (p *Policy) check(u *url.URL) error {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("fetching %s URLs is not allowed: %s", u.Scheme, u.Redacted())
+	}
+	if !p.Allowed(u.Hostname()) {
+		return &BlockedError{Host: u.Hostname()}
+	}
+	return nil
+}
+
+// Client returns a copy of the HTTP client that refuses requests to, and
+// redirects to, hosts that the policy doesn't allow
+func (p *Policy) Client(client *http.Client) *http.Client {
+	c := *client
+	next := client.Transport
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	c.Transport = roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		if err := p.check(req.URL); err != nil {
+			return nil, err
+		}
+		return next.RoundTrip(req)
+	})
+	return &c
+}
+
+// BlockedError is returned for URLs on hosts that aren't allowed
+type BlockedError struct {
+	Host string
+}
+
+func (e *BlockedError) Error() string {
+	return fmt.Sprintf("fetching from %s is not allowed, add it to fetch.allowed_domains in the config to trust it", e.Host)
+}
+
+// IsBlocked tells if the error is caused by the policy blocking a host
+func IsBlocked(err error) bool {
+	var blocked *BlockedError
+	return errors.As(err, &blocked)
+}
+
+// roundTripperFunc adapts a function to http.RoundTripper
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
@@ -0,0 +1,90 @@
+package fetch
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestPolicyAllowed tests matching hosts against the allowlist
+func TestPolicyAllowed(t *testing.T) {
+	policy := NewPolicy([]string{"example.com", "*.Docs.Go.dev."}, true)
+
+	testCases := []struct {
+		host    string
+		allowed bool
+	}{
+		{host: "example.com", allowed: true},
+		{host: "EXAMPLE.com.", allowed: true},
+		{host: "www.example.com", allowed: false},
+		{host: "evilexample.com", allowed: false},
+		{host: "pkg.docs.go.dev", allowed: true},
+		{host: "a.b.docs.go.dev", allowed: true},
+		{host: "docs.go.dev", allowed: false},
+		{host: "evildocs.go.dev", allowed: false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.host, func(t *testing.T) {
+			assert.Equal(t, tc.allowed, policy.Allowed(tc.host))
+		})
+	}
+
+	assert.True(t, NewPolicy([]string{"*"}, true).Allowed("anything.test"))
+
+	// Without an allowlist only strict policies block
+	assert.True(t, NewPolicy(nil, false).Allowed("example.com"))
+	assert.False(t, NewPolicy(nil, true).Allowed("example.com"))
+}
+
+// TestPolicyCheck tests checking URLs
+func TestPolicyCheck(t *testing.T) {
+	policy := NewPolicy([]string{"example.com"}, true)
+
+	assert.NoError(t, policy.Check("https://example.com/page"))
+	assert.NoError(t, policy.Check("http://example.com:8080/page"))
+
+	err := policy.Check("https://attacker.test/?secret=1")
+	assert.True(t, IsBlocked(err))
+	assert.EqualError(t, err, "fetching from attacker.test is not allowed, add it to fetch.allowed_domains in the config to trust it")
+
+	assert.ErrorContains(t, NewPolicy(nil, false).Check("file:///etc/passwd"), "fetching file URLs is not allowed")
+}
+
+// TestPolicyClient tests that the client blocks requests and redirects
+func TestPolicyClient(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/redirect" {
+			http.Redirect(w, r, "http://attacker.test/", http.StatusFound)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	client := NewPolicy([]string{"127.0.0.1"}, true).Client(server.Client())
+
+	resp, err := client.Get(server.URL)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	_, err = client.Get(server.URL + "/redirect")
+	assert.True(t, IsBlocked(err))
+
+	_, err = client.Get("http://attacker.test/")
+	assert.True(t, IsBlocked(err))
+}
+
+// TestValidateDomain tests validating allowlist entries
+func TestValidateDomain(t *testing.T) {
+	for _, domain := range []string{"example.com", "*.example.com", "*", "localhost"} {
+		assert.NoError(t, ValidateDomain(domain), domain)
+	}
+	for _, domain := range []string{"", "*.", "ex*ample.com", "https://example.com", "example.com/path", "*.*.example.com"} {
+		assert.Error(t, ValidateDomain(domain), domain)
+	}
+}
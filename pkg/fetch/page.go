@@ -0,0 +1,288 @@
+package fetch
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/Turee/si/pkg/paths"
+	"github.com/Turee/si/pkg/state"
+)
+
+// MaxPageBytes limits how much of a page is downloaded
+const MaxPageBytes = 10 << 20
+
+// Page is the readable text of a fetched page
+type Page struct {
+	URL   string    `json:"url"`
+	Title string    `json:"title,omitempty"`
+	Text  string    `json:"text"`
+	Time  time.Time `json:"time"`
+}
+
+// Get fetches the page at the URL with the client. HTML is reduced to the
+// text of its main content, other text formats are returned as they are and
+// anything else is an error.
+func Get(ctx context.Context, client *http.Client, rawURL string) (Page, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return Page{}, err
+	}
+	req.Header.Set("Accept", "text/html, text/plain;q=0.9, */*;q=0.5")
+	resp, err := client.Do(req)
+	if err != nil {
+		return Page{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		return Page{}, fmt.Errorf("fetching %s failed: %s", rawURL, resp.Status)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, MaxPageBytes))
+	if err != nil {
+		return Page{}, fmt.Errorf("error reading %s: %w", rawURL, err)
+	}
+
+	page := Page{URL: rawURL, Time: time.Now()}
+	kind, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if kind == "" {
+		kind, _, _ = mime.ParseMediaType(http.DetectContentType(body))
+	}
+	switch {
+	case kind == "text/html" || kind == "application/xhtml+xml":
+		page.Title, page.Text = Readable(string(body))
+	case strings.HasPrefix(kind, "text/") || kind == "application/json" || strings.HasSuffix(kind, "+json") ||
+		kind == "application/xml" || strings.HasSuffix(kind, "+xml"):
+		page.Text = strings.TrimSpace(string(body))
+	default:
+		return Page{}, fmt.Errorf("%s is %s, not a web page or text", rawURL, kind)
+	}
+	return page, nil
+}
+
+var (
+	// tagPattern matches comments and start and end tags
+	tagPattern = regexp.MustCompile(`(?s)<!--.*?-->|<(/?)([a-zA-Z][a-zA-Z0-9]*)([^>]*)>`)
+
+	// boilerPattern matches the classes and ids of navigation, ads and other
+	// boilerplate around the content
+	boilerPattern = regexp.MustCompile(`(?i)\b(?:class|id)\s*=\s*["'][^"']*\b(?:ads?|advert\w*|banner|breadcrumbs?|cookie\w*|menu|nav\w*|newsletter|popup|promo\w*|share|sidebar|social|sponsor\w*)\b`)
+
+	// titlePattern matches the title element
+	titlePattern = regexp.MustCompile(`(?is)<title\b[^>]*>(.*?)</title`)
+
+	// mainPatterns match the start tag and the end tags of the elements
+	// holding the content, in the order they are preferred
+	mainPatterns = [][2]*regexp.Regexp{
+		{regexp.MustCompile(`(?i)<main\b`), regexp.MustCompile(`(?i)</main\s*>`)},
+		{regexp.MustCompile(`(?i)<article\b`), regexp.MustCompile(`(?i)</article\s*>`)},
+	}
+
+	// rawEndPatterns match the end tags of elements whose content isn't HTML
+	rawEndPatterns = map[string]*regexp.Regexp{
+		"script": regexp.MustCompile(`(?i)</script\s*>`),
+		"style":  regexp.MustCompile(`(?i)</style\s*>`),
+	}
+
+	// spacePattern matches runs of spaces within a line
+	spacePattern = regexp.MustCompile(`[ \t\f\v\r\x{a0}]+`)
+)
+
+// skippedTags are elements left out with their content
+var skippedTags = map[string]bool{
+	"aside": true, "button": true, "dialog": true, "footer": true, "form": true,
+	"iframe": true, "nav": true, "noscript": true, "script": true, "select": true, "style": true,
+	"svg": true, "template": true, "title": true,
+}
+
+// voidTags are elements without content or end tag
+var voidTags = map[string]bool{
+	"area": true, "base": true, "br": true, "col": true, "embed": true, "hr": true, "img": true,
+	"input": true, "link": true, "meta": true, "source": true, "track": true, "wbr": true,
+}
+
+// blockTags are elements that start on a line of their own, and the text
+// put in front of their content
+var blockTags = map[string]string{
+	"address": "\n", "article": "\n", "blockquote": "\n\n", "dd": "\n", "div": "\n", "dl": "\n\n",
+	"dt": "\n", "figcaption": "\n", "figure": "\n\n", "h1": "\n\n# ", "h2": "\n\n## ", "h3": "\n\n### ",
+	"h4": "\n\n#### ", "h5": "\n\n##### ", "h6": "\n\n###### ", "hr": "\n\n", "li": "\n- ", "main": "\n",
+	"ol": "\n\n", "p": "\n\n", "pre": "\n\n", "section": "\n\n", "table": "\n\n", "tr": "\n", "ul": "\n\n",
+	"br": "\n", "td": " ", "th": " ",
+}
+
+// Readable returns the title and the readable text of an HTML page. The text
+// is taken from the main or article element if there is one, without
+// scripts, navigation, forms and elements whose class or id suggests ads or
+// other boilerplate. Headings and list items are kept as Markdown.
+func Readable(page string) (title, content string) {
+	if m := titlePattern.FindStringSubmatch(page); m != nil {
+		title = strings.TrimSpace(spacePattern.ReplaceAllString(html.UnescapeString(m[1]), " "))
+	}
+	for _, patterns := range mainPatterns {
+		start := patterns[0].FindStringIndex(page)
+		ends := patterns[1].FindAllStringIndex(page, -1)
+		if start != nil && len(ends) > 0 && ends[len(ends)-1][1] > start[0] {
+			page = page[start[0]:ends[len(ends)-1][1]]
+			break
+		}
+	}
+
+	var b strings.Builder
+	skipped, depth := "", 0
+	pos := 0
+	for _, m := range tagPattern.FindAllStringSubmatchIndex(page, -1) {
+		if m[0] < pos {
+			// Inside the content of a raw text element that was jumped over
+			continue
+		}
+		if depth == 0 {
+			b.WriteString(text(page[pos:m[0]]))
+		}
+		pos = m[1]
+		if m[4] < 0 {
+			// A comment
+			continue
+		}
+
+		closing := m[3] > m[2]
+		name := strings.ToLower(page[m[4]:m[5]])
+		attrs := page[m[6]:m[7]]
+		selfClosing := voidTags[name] || strings.HasSuffix(attrs, "/")
+
+		if depth > 0 {
+			switch {
+			case name != skipped || selfClosing:
+			case closing:
+				depth--
+			default:
+				depth++
+			}
+			continue
+		}
+
+		if endPattern := rawEndPatterns[name]; endPattern != nil && !closing {
+			// Their content is not HTML, so it is jumped over as a whole
+			end := endPattern.FindStringIndex(page[pos:])
+			if end == nil {
+				pos = len(page)
+				break
+			}
+			pos += end[1]
+			continue
+		}
+		if !closing && !selfClosing && (skippedTags[name] || boilerPattern.MatchString(attrs)) {
+			skipped, depth = name, 1
+			continue
+		}
+		if prefix, ok := blockTags[name]; ok {
+			switch {
+			case !closing:
+				b.WriteString(prefix)
+			case name != "li":
+				// Closing list items would put blank lines between them
+				b.WriteString(strings.TrimRight(prefix, "# "))
+			}
+		}
+	}
+	if depth == 0 && pos < len(page) {
+		b.WriteString(text(page[pos:]))
+	}
+	return title, tidy(b.String())
+}
+
+// text decodes the text between tags, where line breaks are spaces
+func text(raw string) string {
+	return strings.ReplaceAll(html.UnescapeString(raw), "\n", " ")
+}
+
+// tidy collapses spaces within lines and runs of blank lines
+func tidy(text string) string {
+	var lines []string
+	blank := false
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(spacePattern.ReplaceAllString(line, " "))
+		if line == "" || line == "-" || strings.Trim(line, "#") == "" {
+			blank = len(lines) > 0
+			continue
+		}
+		if blank {
+			lines = append(lines, "")
+			blank = false
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// PageCache keeps fetched pages on disk for a while, so that repeated
+// questions about a page don't download it again. Nothing is written in
+// read-only mode.
+type PageCache struct {
+	dir string
+	ttl time.Duration
+}
+
+// DefaultPageCacheDir returns the directory of the page cache in
+// paths.CacheDir, or "" if there is no cache directory
+func DefaultPageCacheDir() string {
+	dir := paths.CacheDir()
+	if dir == "" {
+		return ""
+	}
+	return filepath.Join(dir, "pages")
+}
+
+// NewPageCache creates a cache of pages in dir that keeps them for ttl. A
+// cache without a directory keeps nothing.
+func NewPageCache(dir string, ttl time.Duration) *PageCache {
+	return &PageCache{dir: dir, ttl: ttl}
+}
+
+// file returns the path of the cached page of a URL
+func (c *PageCache) file(rawURL string) string {
+	sum := sha256.Sum256([]byte(rawURL))
+	return filepath.Join(c.dir, hex.EncodeToString(sum[:16])+".json")
+}
+
+// Load returns the cached page of the URL if it is fresh
+func (c *PageCache) Load(rawURL string) (Page, bool) {
+	if c.dir == "" {
+		return Page{}, false
+	}
+	data, err := os.ReadFile(c.file(rawURL))
+	if err != nil {
+		return Page{}, false
+	}
+	var page Page
+	if json.Unmarshal(data, &page) != nil || page.URL != rawURL || time.Since(page.Time) > c.ttl {
+		return Page{}, false
+	}
+	return page, true
+}
+
+// Store adds the page to the cache
+func (c *PageCache) Store(page Page) error {
+	if c.dir == "" || state.ReadOnly() {
+		return nil
+	}
+	data, err := json.Marshal(page)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(c.dir, 0o700); err != nil {
+		return fmt.Errorf("failed to create the page cache: %w", err)
+	}
+	return os.WriteFile(c.file(page.URL), data, 0o600)
+}
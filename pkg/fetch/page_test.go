@@ -0,0 +1,117 @@
+package fetch
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Turee/si/pkg/state"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testPage = `<!DOCTYPE html>
+<html>
+<head>
+  <title>Release &amp; Notes</title>
+  <style>body { color: red; }</style>
+  <script>var nav = "<nav>";</script>
+</head>
+<body>
+  <nav><a href="/">Home</a> <a href="/docs">Docs</a></nav>
+  <div class="cookie-banner">We use cookies</div>
+  <main>
+    <h1>Version 2.0</h1>
+    <!-- a comment -->
+    <p>The   new release
+      brings <b>faster</b> builds.</p>
+    <div class="ad-slot"><div>Buy now</div> still an ad</div>
+    <ul>
+      <li>Caching</li>
+      <li>Parallel tests</li>
+    </ul>
+    <p>Fish&nbsp;&amp;&nbsp;chips<br>on a new line</p>
+  </main>
+  <footer>Copyright</footer>
+</body>
+</html>`
+
+// TestReadable tests extracting the readable text of a page
+func TestReadable(t *testing.T) {
+	title, text := Readable(testPage)
+	assert.Equal(t, "Release & Notes", title)
+	assert.Equal(t, "# Version 2.0\n\nThe new release brings faster builds.\n\n- Caching\n- Parallel tests\n\nFish & chips\non a new line", text)
+
+	// Without a main element the body is used, without its boilerplate
+	_, text = Readable(`<body><header><h1>Blog</h1></header><aside>Related</aside><p>Hello <i>world</i></p><script>x()`)
+	assert.Equal(t, "# Blog\n\nHello world", text)
+}
+
+// TestGet tests fetching pages of different types
+func TestGet(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/page":
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			w.Write([]byte(testPage))
+		case "/notes.txt":
+			w.Header().Set("Content-Type", "text/plain")
+			w.Write([]byte("  plain text\n"))
+		case "/image.png":
+			w.Header().Set("Content-Type", "image/png")
+			w.Write([]byte("\x89PNG"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	page, err := Get(context.Background(), server.Client(), server.URL+"/page")
+	require.NoError(t, err)
+	assert.Equal(t, server.URL+"/page", page.URL)
+	assert.Equal(t, "Release & Notes", page.Title)
+	assert.Contains(t, page.Text, "# Version 2.0")
+
+	page, err = Get(context.Background(), server.Client(), server.URL+"/notes.txt")
+	require.NoError(t, err)
+	assert.Equal(t, "plain text", page.Text)
+
+	_, err = Get(context.Background(), server.Client(), server.URL+"/image.png")
+	assert.ErrorContains(t, err, "/image.png is image/png, not a web page or text")
+
+	_, err = Get(context.Background(), server.Client(), server.URL+"/missing")
+	assert.ErrorContains(t, err, "404 Not Found")
+}
+
+// TestPageCache tests keeping pages until they expire
+func TestPageCache(t *testing.T) {
+	cache := NewPageCache(t.TempDir(), time.Hour)
+	_, ok := cache.Load("https://example.com")
+	assert.False(t, ok)
+
+	page := Page{URL: "https://example.com", Title: "Example", Text: "Hello", Time: time.Now()}
+	require.NoError(t, cache.Store(page))
+	cached, ok := cache.Load("https://example.com")
+	require.True(t, ok)
+	assert.Equal(t, "Hello", cached.Text)
+	_, ok = cache.Load("https://example.org")
+	assert.False(t, ok)
+
+	// Expired pages are fetched again
+	page.Time = time.Now().Add(-2 * time.Hour)
+	require.NoError(t, cache.Store(page))
+	_, ok = cache.Load("https://example.com")
+	assert.False(t, ok)
+
+	// Nothing is written in read-only mode
+	state.SetReadOnly(true)
+	t.Cleanup(func() { state.SetReadOnly(false) })
+	page.URL = "https://example.net"
+	require.NoError(t, cache.Store(page))
+	_, ok = cache.Load("https://example.net")
+	assert.False(t, ok)
+
+	assert.NoError(t, NewPageCache("", time.Hour).Store(page))
+}
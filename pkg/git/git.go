@@ -0,0 +1,148 @@
+package git
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// Run runs git with the given arguments in the current directory and returns its output
+func Run(ctx context.Context, args ...string) (string, error) {
+	var stdout, stderr bytes.Buffer
+
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("git %s failed: %s", args[0], msg)
+		}
+		return "", fmt.Errorf("git %s failed: %w", args[0], err)
+	}
+
+	return stdout.String(), nil
+}
+
+// StagedDiff returns the diff of the changes staged for commit
+func StagedDiff(ctx context.Context) (string, error) {
+	return Run(ctx, "diff", "--cached", "--no-color")
+}
+
+// Diff returns the diff of the working tree against the index, or against
+// ref if it is not empty. A ref can also be a range such as main...HEAD.
+func Diff(ctx context.Context, ref string) (string, error) {
+	args := []string{"diff", "--no-color"}
+	if ref != "" {
+		args = append(args, ref, "--")
+	}
+	return Run(ctx, args...)
+}
+
+// IsRevision reports whether rev names a commit or a range of commits
+func IsRevision(ctx context.Context, rev string) bool {
+	if rev == "" || strings.HasPrefix(rev, "-") {
+		return false
+	}
+
+	// Either side of a range may be omitted and defaults to HEAD
+	sep := ".."
+	if strings.Contains(rev, "...") {
+		sep = "..."
+	}
+	for _, side := range strings.Split(rev, sep) {
+		if side == "" {
+			continue
+		}
+		if _, err := Run(ctx, "rev-parse", "--verify", "--quiet", side+"^{commit}"); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// RecentSubjects returns the subject lines of the last n commits
+func RecentSubjects(ctx context.Context, n int) ([]string, error) {
+	out, err := Run(ctx, "log", fmt.Sprintf("-n%d", n), "--pretty=format:%s")
+	if err != nil {
+		return nil, err
+	}
+
+	var subjects []string
+	for _, line := range strings.Split(out, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			subjects = append(subjects, line)
+		}
+	}
+	return subjects, nil
+}
+
+// Log returns the messages of the commits of a range such as main..HEAD,
+// oldest first, without merge commits
+func Log(ctx context.Context, revRange string) ([]string, error) {
+	out, err := Run(ctx, "log", "--no-merges", "--reverse", "--format=%B%x00", revRange, "--")
+	if err != nil {
+		return nil, err
+	}
+
+	var messages []string
+	for _, message := range strings.Split(out, "\x00") {
+		if message = strings.TrimSpace(message); message != "" {
+			messages = append(messages, message)
+		}
+	}
+	return messages, nil
+}
+
+// DefaultBranch returns the branch pull requests are merged into: the one
+// origin/HEAD points to, such as origin/main, or else a local main or master
+// branch
+func DefaultBranch(ctx context.Context) (string, error) {
+	if out, err := Run(ctx, "symbolic-ref", "--quiet", "--short", "refs/remotes/origin/HEAD"); err == nil {
+		return strings.TrimSpace(out), nil
+	}
+	for _, branch := range []string{"main", "master"} {
+		if _, err := Run(ctx, "rev-parse", "--verify", "--quiet", "refs/heads/"+branch); err == nil {
+			return branch, nil
+		}
+	}
+	return "", fmt.Errorf("no default branch found")
+}
+
+// Root returns the top-level directory of the working tree
+func Root(ctx context.Context) (string, error) {
+	out, err := Run(ctx, "rev-parse", "--show-toplevel")
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(out), nil
+}
+
+// HooksDir returns the directory git runs hooks from, honoring core.hooksPath
+func HooksDir(ctx context.Context) (string, error) {
+	out, err := Run(ctx, "rev-parse", "--git-path", "hooks")
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(out), nil
+}
+
+// Commit commits the staged changes with the given message. Output of git and
+// its hooks is passed through to the user on stderr, keeping stdout free for
+// the output of the caller.
+func Commit(ctx context.Context, message string, extraArgs ...string) error {
+	args := append([]string{"commit", "-m", message}, extraArgs...)
+
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("git commit failed: %w", err)
+	}
+	return nil
+}
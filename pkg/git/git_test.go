@@ -0,0 +1,159 @@
+package git
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// initRepo creates a temporary git repository and changes into it
+func initRepo(t *testing.T) string {
+	t.Helper()
+
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	dir := t.TempDir()
+	oldDir, err := os.Getwd()
+	require.NoError(t, err)
+	require.NoError(t, os.Chdir(dir))
+	t.Cleanup(func() { os.Chdir(oldDir) })
+
+	ctx := context.Background()
+	for _, args := range [][]string{
+		{"init", "-q"},
+		{"config", "user.name", "Test"},
+		{"config", "user.email", "test@example.com"},
+		{"config", "commit.gpgsign", "false"},
+	} {
+		_, err := Run(ctx, args...)
+		require.NoError(t, err)
+	}
+
+	return dir
+}
+
+// TestStagedDiffAndCommit tests reading staged changes and committing them
+func TestStagedDiffAndCommit(t *testing.T) {
+	dir := initRepo(t)
+	ctx := context.Background()
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "hello.txt"), []byte("hello\n"), 0644))
+
+	diff, err := StagedDiff(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, diff)
+
+	_, err = Run(ctx, "add", "hello.txt")
+	require.NoError(t, err)
+
+	diff, err = StagedDiff(ctx)
+	require.NoError(t, err)
+	assert.Contains(t, diff, "+hello")
+
+	require.NoError(t, Commit(ctx, "feat: add greeting", "--quiet"))
+
+	subjects, err := RecentSubjects(ctx, 5)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"feat: add greeting"}, subjects)
+}
+
+// TestRunError tests that git errors include git's message
+func TestRunError(t *testing.T) {
+	initRepo(t)
+
+	_, err := Run(context.Background(), "log")
+	assert.ErrorContains(t, err, "git log failed")
+}
+
+// TestHooksDir tests finding the hooks directory
+func TestHooksDir(t *testing.T) {
+	initRepo(t)
+	ctx := context.Background()
+
+	dir, err := HooksDir(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(".git", "hooks"), dir)
+
+	_, err = Run(ctx, "config", "core.hooksPath", "githooks")
+	require.NoError(t, err)
+	dir, err = HooksDir(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "githooks", dir)
+}
+
+// TestDiff tests diffing the working tree against revisions
+func TestDiff(t *testing.T) {
+	dir := initRepo(t)
+	ctx := context.Background()
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "hello.txt"), []byte("hello\n"), 0644))
+	_, err := Run(ctx, "add", "hello.txt")
+	require.NoError(t, err)
+	require.NoError(t, Commit(ctx, "add greeting", "--quiet"))
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "hello.txt"), []byte("hello world\n"), 0644))
+
+	diff, err := Diff(ctx, "")
+	require.NoError(t, err)
+	assert.Contains(t, diff, "+hello world")
+
+	diff, err = Diff(ctx, "HEAD")
+	require.NoError(t, err)
+	assert.Contains(t, diff, "+hello world")
+
+	_, err = Diff(ctx, "nonexistent")
+	assert.Error(t, err)
+
+	assert.True(t, IsRevision(ctx, "HEAD"))
+	assert.True(t, IsRevision(ctx, "HEAD..HEAD"))
+	assert.True(t, IsRevision(ctx, "HEAD..."))
+	assert.False(t, IsRevision(ctx, "HEAD~5"))
+	assert.False(t, IsRevision(ctx, "hello.txt"))
+	assert.False(t, IsRevision(ctx, "write release notes"))
+	assert.False(t, IsRevision(ctx, "--all"))
+}
+
+// TestLogAndDefaultBranch tests reading the commits of a branch and finding
+// the branch it is based on
+func TestLogAndDefaultBranch(t *testing.T) {
+	dir := initRepo(t)
+	ctx := context.Background()
+
+	_, err := DefaultBranch(ctx)
+	assert.EqualError(t, err, "no default branch found")
+
+	commit := func(name, message string) {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(name), 0644))
+		_, err := Run(ctx, "add", name)
+		require.NoError(t, err)
+		require.NoError(t, Commit(ctx, message, "--quiet"))
+	}
+	_, err = Run(ctx, "symbolic-ref", "HEAD", "refs/heads/main")
+	require.NoError(t, err)
+	commit("a.txt", "Initial commit")
+	_, err = Run(ctx, "checkout", "-q", "-b", "feature")
+	require.NoError(t, err)
+	commit("b.txt", "Add b\n\nB is needed.")
+	commit("c.txt", "Add c")
+
+	branch, err := DefaultBranch(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "main", branch)
+
+	root, err := Root(ctx)
+	require.NoError(t, err)
+	resolved, err := filepath.EvalSymlinks(dir)
+	require.NoError(t, err)
+	assert.Equal(t, filepath.ToSlash(resolved), root)
+
+	messages, err := Log(ctx, "main..HEAD")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Add b\n\nB is needed.", "Add c"}, messages)
+}
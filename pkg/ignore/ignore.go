@@ -0,0 +1,205 @@
+// Package ignore matches paths against .gitignore patterns and walks
+// directory trees without the files they ignore
+package ignore
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// pattern is a compiled line of a .gitignore file
+type pattern struct {
+	re      *regexp.Regexp
+	negate  bool
+	dirOnly bool
+}
+
+// Matcher matches slash-separated paths relative to a root against
+// .gitignore patterns. The last matching pattern decides, so negated
+// patterns can re-include what earlier ones ignore.
+type Matcher struct {
+	patterns []pattern
+}
+
+// Add adds the patterns of the lines of a .gitignore file in the directory
+// base, relative to the root; base is empty for the root itself. Blank lines
+// and comments are skipped.
+func (m *Matcher) Add(base string, lines []string) {
+	for _, line := range lines {
+		if p, ok := compile(base, line); ok {
+			m.patterns = append(m.patterns, p)
+		}
+	}
+}
+
+// Match reports whether the path is ignored, either itself or because one of
+// the directories it is in is ignored
+func (m *Matcher) Match(name string, isDir bool) bool {
+	parts := strings.Split(name, "/")
+	for i := 1; i < len(parts); i++ {
+		if m.match(strings.Join(parts[:i], "/"), true) {
+			return true
+		}
+	}
+	return m.match(name, isDir)
+}
+
+// match reports whether the last pattern matching the path ignores it
+func (m *Matcher) match(name string, isDir bool) bool {
+	for i := len(m.patterns) - 1; i >= 0; i-- {
+		p := m.patterns[i]
+		if p.dirOnly && !isDir {
+			continue
+		}
+		if p.re.MatchString(name) {
+			return !p.negate
+		}
+	}
+	return false
+}
+
+// compile translates a .gitignore line into a regular expression matching
+// paths relative to the root
+func compile(base, line string) (pattern, bool) {
+	line = strings.TrimRight(strings.TrimSuffix(line, "\r"), " ")
+	if line == "" || strings.HasPrefix(line, "#") {
+		return pattern{}, false
+	}
+
+	var p pattern
+	if strings.HasPrefix(line, "!") {
+		p.negate = true
+		line = line[1:]
+	} else if strings.HasPrefix(line, `\!`) || strings.HasPrefix(line, `\#`) {
+		line = line[1:]
+	}
+	if strings.HasSuffix(line, "/") {
+		p.dirOnly = true
+		line = strings.TrimRight(line, "/")
+	}
+	if line == "" {
+		return pattern{}, false
+	}
+
+	// Patterns with a slash other than at the end are relative to the
+	// directory of the .gitignore file, others match at any depth
+	anchored := strings.Contains(line, "/")
+	line = strings.TrimPrefix(line, "/")
+
+	var re strings.Builder
+	re.WriteString("^")
+	if base != "" {
+		re.WriteString(regexp.QuoteMeta(base) + "/")
+	}
+	if !anchored {
+		re.WriteString("(?:.*/)?")
+	}
+	re.WriteString(translate(line))
+	re.WriteString("$")
+
+	compiled, err := regexp.Compile(re.String())
+	if err != nil {
+		return pattern{}, false
+	}
+	p.re = compiled
+	return p, true
+}
+
+// translate translates the wildcards of a glob into a regular expression
+func translate(glob string) string {
+	var re strings.Builder
+	for i := 0; i < len(glob); i++ {
+		switch c := glob[i]; {
+		case strings.HasPrefix(glob[i:], "**/"):
+			// Any number of directories, including none
+			re.WriteString("(?:.*/)?")
+			i += 2
+		case strings.HasPrefix(glob[i:], "**") && i+2 == len(glob):
+			re.WriteString(".*")
+			i++
+		case c == '*':
+			re.WriteString("[^/]*")
+		case c == '?':
+			re.WriteString("[^/]")
+		case c == '\\' && i+1 < len(glob):
+			i++
+			re.WriteString(regexp.QuoteMeta(glob[i : i+1]))
+		case c == '[':
+			end := strings.IndexByte(glob[i+1:], ']')
+			if end < 0 {
+				re.WriteString(`\[`)
+				continue
+			}
+			class := glob[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			re.WriteString("[" + strings.ReplaceAll(class, `\`, `\\`) + "]")
+			i += end + 1
+		default:
+			re.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	return re.String()
+}
+
+// Walk walks the tree at root like filepath.WalkDir, calling fn with the
+// slash-separated path relative to root of every file and directory that
+// isn't ignored. .git directories are skipped, as is what the .gitignore
+// files in the tree and the exclude patterns ignore.
+func Walk(root string, exclude []string, fn func(name string, d fs.DirEntry) error) error {
+	var ignored, excluded Matcher
+	excluded.Add("", exclude)
+
+	return filepath.WalkDir(root, func(file string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, file)
+		if err != nil {
+			return err
+		}
+		name := filepath.ToSlash(rel)
+
+		if name != "." {
+			if d.IsDir() && d.Name() == ".git" {
+				return filepath.SkipDir
+			}
+			if ignored.match(name, d.IsDir()) || excluded.match(name, d.IsDir()) {
+				if d.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+		}
+
+		if d.IsDir() {
+			lines, err := readLines(filepath.Join(file, ".gitignore"))
+			if err != nil {
+				return err
+			}
+			base := name
+			if base == "." {
+				base = ""
+			}
+			ignored.Add(base, lines)
+		}
+		return fn(name, d)
+	})
+}
+
+// readLines reads the lines of a .gitignore file; a missing file has none
+func readLines(file string) ([]string, error) {
+	data, err := os.ReadFile(file)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return strings.Split(string(data), "\n"), nil
+}
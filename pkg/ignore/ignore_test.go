@@ -0,0 +1,90 @@
+package ignore
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestMatch tests the patterns of .gitignore files
+func TestMatch(t *testing.T) {
+	var m Matcher
+	m.Add("", []string{
+		"# build output",
+		"",
+		"*.log",
+		"!keep.log",
+		"/bin",
+		"build/",
+		"docs/**/*.tmp",
+		"data?.[ch]sv  ",
+		`\#notes`,
+	})
+	m.Add("web", []string{"dist", "/local.txt"})
+
+	tests := []struct {
+		name    string
+		isDir   bool
+		ignored bool
+	}{
+		{"debug.log", false, true},
+		{"logs/debug.log", false, true},
+		{"keep.log", false, false},
+		{"bin", true, true},
+		{"cmd/bin", true, false},
+		{"bin/tool", false, true},
+		{"build", true, true},
+		{"build", false, false},
+		{"src/build/out.o", false, true},
+		{"docs/a/b/c.tmp", false, true},
+		{"docs/c.tmp", false, true},
+		{"c.tmp", false, false},
+		{"data1.csv", false, true},
+		{"data1.tsv", false, false},
+		{"#notes", false, true},
+		{"web/dist/app.js", false, true},
+		{"dist", true, false},
+		{"web/local.txt", false, true},
+		{"web/src/local.txt", false, false},
+		{"main.go", false, false},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.ignored, m.Match(tt.name, tt.isDir), tt.name)
+	}
+}
+
+// TestWalk tests walking a tree without ignored files
+func TestWalk(t *testing.T) {
+	root := t.TempDir()
+	files := map[string]string{
+		".gitignore":         "*.log\nvendor/\n",
+		".git/config":        "",
+		"main.go":            "",
+		"debug.log":          "",
+		"vendor/lib/lib.go":  "",
+		"web/.gitignore":     "dist/\n!important.log\n",
+		"web/app.js":         "",
+		"web/important.log":  "",
+		"web/dist/bundle.js": "",
+		"testdata/big.json":  "",
+	}
+	for name, content := range files {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	}
+
+	var walked []string
+	err := Walk(root, []string{"testdata/"}, func(name string, d fs.DirEntry) error {
+		if !d.IsDir() {
+			walked = append(walked, name)
+		}
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{".gitignore", "main.go", "web/.gitignore", "web/app.js", "web/important.log"}, walked)
+}
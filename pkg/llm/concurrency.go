@@ -0,0 +1,41 @@
+package llm
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// semaphores holds one semaphore per endpoint and limit, so every provider
+// instance talking to the same endpoint shares the same limit
+var (
+	semaphoresMu sync.Mutex
+	semaphores   = map[string]chan struct{}{}
+)
+
+// acquireSlot waits until fewer than limit requests are in flight for the
+// endpoint and returns a function that releases the slot. A limit of zero or
+// less means unlimited.
+func acquireSlot(ctx context.Context, endpoint string, limit int) (func(), error) {
+	if limit <= 0 {
+		return func() {}, nil
+	}
+
+	key := fmt.Sprintf("%s#%d", endpoint, limit)
+
+	semaphoresMu.Lock()
+	sem, ok := semaphores[key]
+	if !ok {
+		sem = make(chan struct{}, limit)
+		semaphores[key] = sem
+	}
+	semaphoresMu.Unlock()
+
+	select {
+	case sem <- struct{}{}:
+		var once sync.Once
+		return func() { once.Do(func() { <-sem }) }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
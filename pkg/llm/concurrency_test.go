@@ -0,0 +1,86 @@
+package llm
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Turee/si/pkg/config"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestAcquireSlot tests that slots are limited and released
+func TestAcquireSlot(t *testing.T) {
+	release1, err := acquireSlot(context.Background(), "test-endpoint", 1)
+	assert.NoError(t, err)
+
+	// A second request has to wait for the first one
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err = acquireSlot(ctx, "test-endpoint", 1)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	// Other endpoints are not affected
+	release2, err := acquireSlot(context.Background(), "other-endpoint", 1)
+	assert.NoError(t, err)
+	release2()
+
+	// Releasing twice only frees one slot
+	release1()
+	release1()
+	release3, err := acquireSlot(context.Background(), "test-endpoint", 1)
+	assert.NoError(t, err)
+	release3()
+
+	// Zero means unlimited
+	release4, err := acquireSlot(context.Background(), "test-endpoint", 0)
+	assert.NoError(t, err)
+	release4()
+}
+
+// TestOpenAIProviderMaxConcurrentRequests tests that providers share the concurrency limit
+func TestOpenAIProviderMaxConcurrentRequests(t *testing.T) {
+	var inFlight, maxInFlight int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		current := atomic.AddInt32(&inFlight, 1)
+		defer atomic.AddInt32(&inFlight, -1)
+		for {
+			max := atomic.LoadInt32(&maxInFlight)
+			if current <= max || atomic.CompareAndSwapInt32(&maxInFlight, max, current) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("data: [DONE]\n"))
+	}))
+	defer server.Close()
+
+	cfg := &config.OpenAIConfig{
+		BaseURL:               server.URL,
+		APIKey:                "test-api-key",
+		MaxConcurrentRequests: 2,
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// Every request uses its own provider instance
+			provider, err := NewOpenAIProvider(cfg)
+			assert.NoError(t, err)
+			_, err = provider.Ask(context.Background(), "test question")
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+
+	assert.LessOrEqual(t, atomic.LoadInt32(&maxInFlight), int32(2))
+}
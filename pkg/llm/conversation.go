@@ -0,0 +1,179 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/Turee/si/pkg/tokens"
+)
+
+// messageOverhead is the number of tokens every message costs in addition to
+// its content, for the role and the message delimiters
+const messageOverhead = 4
+
+// countTokens counts the tokens of text for the model, falling back to an
+// estimate when the tokenizer is unavailable
+var countTokens = func(model, text string) int {
+	n, err := tokens.Count(model, text)
+	if err != nil {
+		return tokens.Estimate(text)
+	}
+	return n
+}
+
+// Conversation is the message history of a multi-turn conversation. When
+// MaxTokens is set, the oldest messages are dropped as new ones are added so
+// the history stays within the budget; system messages are always kept.
+//
+// A conversation can be saved and restored with encoding/json.
+type Conversation struct {
+	// Model is the model used to count tokens; the tokenizer of the default
+	// encoding is used when it is empty or unknown
+	Model string `json:"model,omitempty"`
+
+	// MaxTokens is the token budget of the history, zero means unlimited
+	MaxTokens int `json:"max_tokens,omitempty"`
+
+	// Messages are the messages of the conversation, oldest first
+	Messages []Message `json:"messages"`
+}
+
+// NewConversation creates a conversation for the model, starting with the
+// system prompt if it is not empty
+func NewConversation(model, systemPrompt string) *Conversation {
+	c := &Conversation{Model: model, Messages: []Message{}}
+	if systemPrompt != "" {
+		c.Messages = append(c.Messages, Message{Role: RoleSystem, Content: systemPrompt})
+	}
+	return c
+}
+
+// LoadConversation reads a conversation saved as JSON
+func LoadConversation(r io.Reader) (*Conversation, error) {
+	var c Conversation
+	if err := json.NewDecoder(r).Decode(&c); err != nil {
+		return nil, fmt.Errorf("failed to load conversation: %w", err)
+	}
+	return &c, nil
+}
+
+// Save writes the conversation as JSON
+func (c *Conversation) Save(w io.Writer) error {
+	if err := json.NewEncoder(w).Encode(c); err != nil {
+		return fmt.Errorf("failed to save conversation: %w", err)
+	}
+	return nil
+}
+
+// Append adds messages to the conversation and drops the oldest messages that
+// no longer fit the token budget
+func (c *Conversation) Append(messages ...Message) {
+	c.Messages = append(c.Messages, messages...)
+	c.Trim()
+}
+
+// AddUser adds a user message with the text and any extra content parts
+func (c *Conversation) AddUser(text string, parts ...ContentPart) {
+	c.Append(NewUserMessage(text, parts...))
+}
+
+// AddAssistant adds an assistant message
+func (c *Conversation) AddAssistant(text string) {
+	c.Append(Message{Role: RoleAssistant, Content: text})
+}
+
+// Tokens returns the number of tokens of the conversation. Only text content
+// is counted, images are not.
+func (c *Conversation) Tokens() int {
+	total := 0
+	for _, msg := range c.Messages {
+		total += c.messageTokens(msg)
+	}
+	return total
+}
+
+// Trim drops the oldest messages other than system messages until the
+// conversation fits its token budget. Replies whose question was dropped are
+// dropped as well, and the latest message is always kept, even when it exceeds
+// the budget on its own.
+func (c *Conversation) Trim() {
+	if c.MaxTokens <= 0 {
+		return
+	}
+
+	total := c.Tokens()
+	for total > c.MaxTokens {
+		i := c.oldest()
+		if i < 0 || i == len(c.Messages)-1 {
+			return
+		}
+		total -= c.messageTokens(c.Messages[i])
+		c.Messages = append(c.Messages[:i], c.Messages[i+1:]...)
+
+		// Drop replies whose question is gone
+		for i = c.oldest(); i >= 0 && i < len(c.Messages)-1 && c.Messages[i].Role == RoleAssistant; i = c.oldest() {
+			total -= c.messageTokens(c.Messages[i])
+			c.Messages = append(c.Messages[:i], c.Messages[i+1:]...)
+		}
+	}
+}
+
+// Send adds the question to the conversation, sends the conversation to the
+// provider and adds the answer. When the request fails, the question is
+// removed again so it can be retried.
+func (c *Conversation) Send(ctx context.Context, provider Provider, question string, parts ...ContentPart) (string, error) {
+	restore := c.snapshot()
+	c.AddUser(question, parts...)
+
+	answer, err := provider.Chat(ctx, c.Messages)
+	if err != nil {
+		restore()
+		return "", err
+	}
+
+	c.AddAssistant(answer)
+	return answer, nil
+}
+
+// SendStream is like Send but streams the answer to the callback
+func (c *Conversation) SendStream(ctx context.Context, provider Provider, question string, callback func(chunk string) error, parts ...ContentPart) (string, error) {
+	restore := c.snapshot()
+	c.AddUser(question, parts...)
+
+	var answer []byte
+	err := provider.ChatStream(ctx, c.Messages, func(chunk string) error {
+		answer = append(answer, chunk...)
+		return callback(chunk)
+	})
+	if err != nil {
+		restore()
+		return "", err
+	}
+
+	c.AddAssistant(string(answer))
+	return string(answer), nil
+}
+
+// snapshot returns a function that restores the current messages
+func (c *Conversation) snapshot() func() {
+	messages := append([]Message(nil), c.Messages...)
+	return func() { c.Messages = messages }
+}
+
+// oldest returns the index of the oldest message that isn't a system
+// message, or -1 if there is none
+func (c *Conversation) oldest() int {
+	for i, msg := range c.Messages {
+		if msg.Role != RoleSystem {
+			return i
+		}
+	}
+	return -1
+}
+
+// messageTokens returns the number of tokens of a single message
+func (c *Conversation) messageTokens(msg Message) int {
+	return countTokens(c.Model, msg.Text()) + messageOverhead
+}
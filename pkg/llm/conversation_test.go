@@ -0,0 +1,145 @@
+package llm
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// mockCountTokens counts one token per word so tests don't load a tokenizer
+func mockCountTokens(t *testing.T) {
+	old := countTokens
+	t.Cleanup(func() { countTokens = old })
+	countTokens = func(model, text string) int { return len(strings.Fields(text)) }
+}
+
+// chatProvider answers every conversation with the next answer and records
+// the messages it was sent
+type chatProvider struct {
+	Provider
+	answers []string
+	err     error
+	sent    [][]Message
+}
+
+func (p *chatProvider) Chat(ctx context.Context, messages []Message) (string, error) {
+	p.sent = append(p.sent, append([]Message(nil), messages...))
+	if p.err != nil {
+		return "", p.err
+	}
+	answer := p.answers[0]
+	p.answers = p.answers[1:]
+	return answer, nil
+}
+
+func (p *chatProvider) ChatStream(ctx context.Context, messages []Message, callback func(chunk string) error) error {
+	answer, err := p.Chat(ctx, messages)
+	if err != nil {
+		return err
+	}
+	for _, word := range strings.SplitAfter(answer, " ") {
+		if err := callback(word); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// TestConversationSend tests that questions and answers are added to the history
+func TestConversationSend(t *testing.T) {
+	mockCountTokens(t)
+	provider := &chatProvider{answers: []string{"Paris", "About two million"}}
+	c := NewConversation("gpt-4o", "Be brief")
+
+	answer, err := c.Send(context.Background(), provider, "capital of France?")
+	require.NoError(t, err)
+	assert.Equal(t, "Paris", answer)
+
+	var chunks []string
+	answer, err = c.SendStream(context.Background(), provider, "population?", func(chunk string) error {
+		chunks = append(chunks, chunk)
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "About two million", answer)
+	assert.Equal(t, []string{"About ", "two ", "million"}, chunks)
+
+	assert.Equal(t, []Message{
+		{Role: RoleSystem, Content: "Be brief"},
+		{Role: RoleUser, Content: "capital of France?"},
+		{Role: RoleAssistant, Content: "Paris"},
+		{Role: RoleUser, Content: "population?"},
+	}, provider.sent[1])
+	assert.Len(t, c.Messages, 5)
+	assert.Equal(t, 5*messageOverhead+2+3+1+1+3, c.Tokens())
+
+	// A failed request leaves the history unchanged
+	provider.err = errors.New("connection refused")
+	_, err = c.Send(context.Background(), provider, "and Germany?")
+	assert.EqualError(t, err, "connection refused")
+	assert.Len(t, c.Messages, 5)
+}
+
+// TestConversationTrim tests that old messages are dropped to fit the token budget
+func TestConversationTrim(t *testing.T) {
+	mockCountTokens(t)
+	c := NewConversation("", "system prompt")
+	c.MaxTokens = 4*messageOverhead + 8
+
+	c.AddUser("one two")
+	c.AddAssistant("three four")
+	c.AddUser("five six")
+	assert.Len(t, c.Messages, 4)
+	assert.Equal(t, c.MaxTokens, c.Tokens())
+
+	// The reply to a dropped question is dropped as well
+	c.AddAssistant("seven eight")
+	assert.Equal(t, []Message{
+		{Role: RoleSystem, Content: "system prompt"},
+		{Role: RoleUser, Content: "five six"},
+		{Role: RoleAssistant, Content: "seven eight"},
+	}, c.Messages)
+
+	c.AddUser("nine ten eleven")
+	assert.Equal(t, []Message{
+		{Role: RoleSystem, Content: "system prompt"},
+		{Role: RoleUser, Content: "nine ten eleven"},
+	}, c.Messages)
+
+	// The latest message is kept even if it exceeds the budget
+	c.AddUser(strings.Repeat("word ", 50))
+	assert.Len(t, c.Messages, 2)
+	assert.Greater(t, c.Tokens(), c.MaxTokens)
+}
+
+// TestConversationJSON tests saving and loading a conversation
+func TestConversationJSON(t *testing.T) {
+	mockCountTokens(t)
+	c := NewConversation("gpt-4o", "Be brief")
+	c.MaxTokens = 1000
+	c.AddUser("what is this?", ImagePart("https://example.com/cat.png"))
+	c.AddAssistant("a cat")
+
+	var buf bytes.Buffer
+	require.NoError(t, c.Save(&buf))
+	assert.JSONEq(t, `{"model":"gpt-4o","max_tokens":1000,"messages":[
+		{"role":"system","content":"Be brief"},
+		{"role":"user","content":[
+			{"type":"text","text":"what is this?"},
+			{"type":"image_url","image_url":{"url":"https://example.com/cat.png"}}
+		]},
+		{"role":"assistant","content":"a cat"}
+	]}`, buf.String())
+
+	loaded, err := LoadConversation(&buf)
+	require.NoError(t, err)
+	assert.Equal(t, c, loaded)
+
+	_, err = LoadConversation(strings.NewReader("{"))
+	assert.ErrorContains(t, err, "failed to load conversation")
+}
@@ -0,0 +1,51 @@
+package llm
+
+import (
+	"net/http"
+
+	"github.com/Turee/si/pkg/config"
+	"github.com/Turee/si/pkg/copilot"
+	"github.com/Turee/si/pkg/logging"
+)
+
+// newCopilotClient creates the client of the Copilot token exchange. It is a
+// variable so tests can redirect it.
+var newCopilotClient = func(httpClient *http.Client) *copilot.Client {
+	return copilot.NewClient(httpClient)
+}
+
+// NewCopilotProvider creates a provider for the GitHub Copilot chat API. The
+// API key is the GitHub token of a Copilot subscriber; without one the token
+// saved by si copilot login is used. It is exchanged for short-lived Copilot
+// tokens as needed. Unless a base URL is configured, requests go to the API
+// of the subscription.
+func NewCopilotProvider(cfg *config.OpenAIConfig) (Provider, error) {
+	githubToken := cfg.APIKey
+	if githubToken == "" {
+		var err error
+		if githubToken, err = copilot.LoadGitHubToken(copilot.DefaultTokenPath()); err != nil {
+			return nil, err
+		}
+	}
+
+	base, err := newTransport(cfg)
+	if err != nil {
+		return nil, err
+	}
+	httpClient := &http.Client{Transport: logging.Transport(base)}
+	source := newCopilotClient(httpClient).TokenSource(githubToken)
+
+	// The Copilot token replaces the key in every request, so the GitHub
+	// token is never sent to the chat API
+	copilotCfg := *cfg
+	copilotCfg.APIKey = ""
+	useTokenAPI := cfg.BaseURL == ""
+	if useTokenAPI {
+		copilotCfg.BaseURL = copilot.DefaultAPIURL
+	}
+
+	return &openAIProvider{
+		cfg:    &copilotCfg,
+		client: &http.Client{Transport: source.Transport(logging.Transport(base), useTokenAPI)},
+	}, nil
+}
@@ -0,0 +1,58 @@
+package llm
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Turee/si/pkg/config"
+	"github.com/Turee/si/pkg/copilot"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestCopilotProvider tests exchanging the GitHub token and sending requests
+// to the chat API of the subscription with the Copilot token
+func TestCopilotProvider(t *testing.T) {
+	var authorization string
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/copilot_internal/v2/token":
+			assert.Equal(t, "token ghu_test", r.Header.Get("Authorization"))
+			fmt.Fprintf(w, `{"token":"cop-1","expires_at":%d,"endpoints":{"api":%q}}`, time.Now().Add(time.Hour).Unix(), server.URL)
+		case "/chat/completions":
+			authorization = r.Header.Get("Authorization")
+			w.Header().Set("Content-Type", "text/event-stream")
+			io.WriteString(w, "data: {\"choices\":[{\"index\":0,\"delta\":{\"content\":\"Hi\"}}]}\n\ndata: [DONE]\n\n")
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	oldClient := newCopilotClient
+	defer func() { newCopilotClient = oldClient }()
+	newCopilotClient = func(httpClient *http.Client) *copilot.Client {
+		client := copilot.NewClient(httpClient)
+		client.APIURL = server.URL
+		return client
+	}
+
+	cfg := &config.Config{LLM: config.LLMConfig{
+		OpenAI:    config.OpenAIConfig{APIKey: "ghu_test", ModelName: "gpt-4o"},
+		Provider:  "copilot",
+		Providers: map[string]config.ProviderConfig{"copilot": {Type: config.ProviderTypeCopilot}},
+	}}
+	provider, err := NewProvider(cfg)
+	require.NoError(t, err)
+
+	answer, err := provider.Ask(context.Background(), "test question")
+	require.NoError(t, err)
+	assert.Equal(t, "Hi", answer)
+	assert.Equal(t, "Bearer cop-1", authorization)
+}
@@ -0,0 +1,59 @@
+package llm
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/Turee/si/pkg/logging"
+)
+
+// ErrDryRun is returned instead of an answer by providers in dry-run mode,
+// after they printed the request
+var ErrDryRun = errors.New("dry run, the request was not sent")
+
+// DryRunner is implemented by providers that can print their requests
+// instead of sending them
+type DryRunner interface {
+	// SetDryRun makes the provider write the requests it would send to w
+	// and return ErrDryRun instead of sending them
+	SetDryRun(w io.Writer)
+}
+
+// dryRunRequest is a request as printed in dry-run mode
+type dryRunRequest struct {
+	Method  string            `json:"method"`
+	URL     string            `json:"url"`
+	Headers map[string]string `json:"headers"`
+	Body    json.RawMessage   `json:"body,omitempty"`
+}
+
+// SetDryRun implements the DryRunner interface
+func (p *openAIProvider) SetDryRun(w io.Writer) {
+	p.dryRun = w
+}
+
+// printRequest writes the request with the JSON body to the dry-run writer,
+// with the API key redacted, and returns ErrDryRun
+func (p *openAIProvider) printRequest(req *http.Request, body []byte) error {
+	headers := map[string]string{}
+	for name, values := range logging.RedactHeaders(req.Header) {
+		headers[name] = values[0]
+	}
+
+	data, err := json.MarshalIndent(dryRunRequest{
+		Method:  req.Method,
+		URL:     logging.RedactURL(req.URL),
+		Headers: headers,
+		Body:    body,
+	}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to print request: %w", err)
+	}
+	if _, err := fmt.Fprintln(p.dryRun, string(data)); err != nil {
+		return fmt.Errorf("failed to print request: %w", err)
+	}
+	return ErrDryRun
+}
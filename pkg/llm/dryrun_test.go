@@ -0,0 +1,43 @@
+package llm
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Turee/si/pkg/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestDryRun tests that requests are printed, after the request hook, and
+// not sent
+func TestDryRun(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("the request was sent")
+	}))
+	defer server.Close()
+
+	provider, err := NewOpenAIProvider(&config.OpenAIConfig{BaseURL: server.URL, APIKey: "sk-secret", AzureDeploymentName: "gpt4"})
+	require.NoError(t, err)
+
+	var out bytes.Buffer
+	provider.(DryRunner).SetDryRun(&out)
+	provider.(HookableProvider).SetRequestHook(func(payload map[string]interface{}) (map[string]interface{}, error) {
+		payload["seed"] = 42
+		return payload, nil
+	})
+
+	_, err = provider.Ask(context.Background(), "capital of France?")
+	assert.ErrorIs(t, err, ErrDryRun)
+
+	printed := out.String()
+	assert.Contains(t, printed, `"url": "`+server.URL+`/openai/deployments/gpt4/chat/completions?api-version=`)
+	assert.Contains(t, printed, `"Api-Key": "[redacted]"`)
+	assert.Contains(t, printed, `"Content-Type": "application/json"`)
+	assert.Contains(t, printed, `"seed": 42`)
+	assert.Contains(t, printed, `capital of France?`)
+	assert.NotContains(t, printed, "sk-secret")
+}
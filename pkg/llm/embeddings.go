@@ -0,0 +1,126 @@
+package llm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/Turee/si/pkg/config"
+	"github.com/Turee/si/pkg/tokens"
+)
+
+// DefaultEmbeddingModel is used when no embedding model is configured
+const DefaultEmbeddingModel = "text-embedding-3-small"
+
+// Embedder is implemented by providers that can compute embeddings
+type Embedder interface {
+	// Embed returns the embedding vector of every text, in the same order
+	Embed(ctx context.Context, model string, texts []string) ([][]float32, error)
+}
+
+// Embed implements the Embedder interface. Servers without the embeddings
+// endpoint of OpenAI are asked at the one of Ollama.
+func (p *openAIProvider) Embed(ctx context.Context, model string, texts []string) ([][]float32, error) {
+	if p.cfg.AzureDeploymentName != "" {
+		return nil, fmt.Errorf("embeddings are not supported for Azure deployments")
+	}
+
+	if model == "" {
+		model = DefaultEmbeddingModel
+	}
+
+	baseURL := p.cfg.BaseURL
+	if baseURL == "" {
+		baseURL = config.DefaultBaseURL
+	}
+
+	// The texts count towards the same rate limits as questions
+	limiter := sharedRateLimiter(baseURL, p.cfg.RateLimit)
+	if _, err := limiter.wait(ctx, tokens.Estimate(strings.Join(texts, "\n"))); err != nil {
+		return nil, fmt.Errorf("failed waiting for the rate limit: %w", err)
+	}
+
+	var embeddingsResp struct {
+		Data []struct {
+			Index     int       `json:"index"`
+			Embedding []float32 `json:"embedding"`
+		} `json:"data"`
+	}
+	err := p.postEmbeddings(ctx, p.endpoint(baseURL, "embeddings"), model, texts, &embeddingsResp)
+
+	// Ollama versions without the OpenAI-compatible endpoint only have
+	// their own, which returns the embeddings in order
+	var apiErr *APIError
+	if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound {
+		if endpoint, ok := ollamaEmbedEndpoint(baseURL); ok {
+			var ollamaResp struct {
+				Embeddings [][]float32 `json:"embeddings"`
+			}
+			if p.postEmbeddings(ctx, endpoint, model, texts, &ollamaResp) == nil && len(ollamaResp.Embeddings) == len(texts) {
+				return ollamaResp.Embeddings, nil
+			}
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	embeddings := make([][]float32, len(texts))
+	for _, data := range embeddingsResp.Data {
+		if data.Index < 0 || data.Index >= len(texts) {
+			return nil, fmt.Errorf("error parsing response: embedding index %d out of range", data.Index)
+		}
+		embeddings[data.Index] = data.Embedding
+	}
+	for i, embedding := range embeddings {
+		if embedding == nil {
+			return nil, fmt.Errorf("error parsing response: missing embedding %d", i)
+		}
+	}
+	return embeddings, nil
+}
+
+// postEmbeddings sends the texts to an embeddings endpoint and decodes the
+// response into v
+func (p *openAIProvider) postEmbeddings(ctx context.Context, endpoint, model string, texts []string, v any) error {
+	reqJSON, err := json.Marshal(struct {
+		Model string   `json:"model"`
+		Input []string `json:"input"`
+	}{model, texts})
+	if err != nil {
+		return fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	resp, err := doWithRetry(ctx, p.client, p.cfg.Retry, func() (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, "POST", endpoint, bytes.NewReader(reqJSON))
+		if err != nil {
+			return nil, fmt.Errorf("failed to create request: %w", err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		p.setHeaders(req)
+		return req, nil
+	})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("error parsing response: %w", err)
+	}
+	return nil
+}
+
+// ollamaEmbedEndpoint returns the native embeddings endpoint of Ollama for
+// the base URL of its OpenAI-compatible API, which ends in /v1
+func ollamaEmbedEndpoint(baseURL string) (string, bool) {
+	trimmed := strings.TrimSuffix(strings.TrimSuffix(baseURL, "/"), "/v1")
+	if trimmed == strings.TrimSuffix(baseURL, "/") {
+		return "", false
+	}
+	return trimmed + "/api/embed", true
+}
@@ -0,0 +1,80 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Turee/si/pkg/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestOpenAIProviderEmbed tests computing embeddings
+func TestOpenAIProviderEmbed(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/embeddings", r.URL.Path)
+		assert.Equal(t, "Bearer test-api-key", r.Header.Get("Authorization"))
+
+		var req struct {
+			Model string   `json:"model"`
+			Input []string `json:"input"`
+		}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		assert.Equal(t, DefaultEmbeddingModel, req.Model)
+		assert.Equal(t, []string{"first", "second"}, req.Input)
+
+		// The results may come in any order
+		w.Write([]byte(`{"data":[
+			{"index":1,"embedding":[0,1]},
+			{"index":0,"embedding":[1,0.5]}
+		]}`))
+	}))
+	defer server.Close()
+
+	provider, err := NewOpenAIProvider(&config.OpenAIConfig{BaseURL: server.URL + "/v1", APIKey: "test-api-key"})
+	require.NoError(t, err)
+
+	embeddings, err := provider.(Embedder).Embed(context.Background(), "", []string{"first", "second"})
+	require.NoError(t, err)
+	assert.Equal(t, [][]float32{{1, 0.5}, {0, 1}}, embeddings)
+
+	azure, err := NewOpenAIProvider(&config.OpenAIConfig{BaseURL: server.URL, AzureDeploymentName: "gpt"})
+	require.NoError(t, err)
+	_, err = azure.(Embedder).Embed(context.Background(), "", []string{"first"})
+	assert.EqualError(t, err, "embeddings are not supported for Azure deployments")
+}
+
+// TestOllamaEmbed tests falling back to the embeddings endpoint of Ollama
+func TestOllamaEmbed(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/embed" {
+			http.NotFound(w, r)
+			return
+		}
+
+		var req struct {
+			Model string   `json:"model"`
+			Input []string `json:"input"`
+		}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		assert.Equal(t, "nomic-embed-text", req.Model)
+		assert.Equal(t, []string{"first", "second"}, req.Input)
+		w.Write([]byte(`{"model":"nomic-embed-text","embeddings":[[1,0],[0,1]]}`))
+	}))
+	defer server.Close()
+
+	provider, err := NewOpenAIProvider(&config.OpenAIConfig{BaseURL: server.URL + "/v1/"})
+	require.NoError(t, err)
+	embeddings, err := provider.(Embedder).Embed(context.Background(), "nomic-embed-text", []string{"first", "second"})
+	require.NoError(t, err)
+	assert.Equal(t, [][]float32{{1, 0}, {0, 1}}, embeddings)
+
+	// Other servers report the error of their OpenAI-compatible endpoint
+	provider, err = NewOpenAIProvider(&config.OpenAIConfig{BaseURL: server.URL + "/openai"})
+	require.NoError(t, err)
+	_, err = provider.(Embedder).Embed(context.Background(), "nomic-embed-text", []string{"first"})
+	assert.ErrorContains(t, err, "status 404")
+}
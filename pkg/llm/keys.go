@@ -0,0 +1,169 @@
+package llm
+
+import (
+	"io"
+	"math/rand"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Turee/si/pkg/config"
+)
+
+// keyPool hands out the API keys of a provider and sets rate limited keys
+// aside until their cooldown is over. It is safe for concurrent use.
+type keyPool struct {
+	keys     []string
+	strategy string
+	cooldown time.Duration
+
+	mu sync.Mutex
+	// next is the key to try first
+	next int
+	// throttled is when each key was last rate limited
+	throttled []time.Time
+	// until is when the cooldown of each key is over
+	until []time.Time
+}
+
+var (
+	// keyPools are shared by all providers of the same endpoint and keys, so
+	// cooldowns hold for every request of the process
+	keyPools   = make(map[string]*keyPool)
+	keyPoolsMu sync.Mutex
+)
+
+// newKeyPool creates a pool of the keys. The rotation starts with a random
+// key, so separate runs of si spread their requests over the keys too.
+func newKeyPool(keys []string, rotation config.KeyRotationConfig) *keyPool {
+	return &keyPool{
+		keys:      keys,
+		strategy:  rotation.Strategy,
+		cooldown:  rotation.CooldownPeriod(),
+		next:      rand.Intn(len(keys)),
+		throttled: make([]time.Time, len(keys)),
+		until:     make([]time.Time, len(keys)),
+	}
+}
+
+// sharedKeyPool returns the pool of the keys configured for the endpoint
+func sharedKeyPool(cfg *config.OpenAIConfig) *keyPool {
+	id := cfg.BaseURL + "\x00" + strings.Join(cfg.APIKeys, "\x00")
+
+	keyPoolsMu.Lock()
+	defer keyPoolsMu.Unlock()
+	pool, ok := keyPools[id]
+	if !ok {
+		pool = newKeyPool(cfg.APIKeys, cfg.KeyRotation)
+		keyPools[id] = pool
+	}
+	return pool
+}
+
+// pick returns the index of the key to use for a request. Keys in their
+// cooldown are skipped; when every key is, the one whose cooldown is over
+// first is used.
+func (p *keyPool) pick() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now()
+	index := -1
+	for i := range p.keys {
+		candidate := (p.next + i) % len(p.keys)
+		if p.until[candidate].After(now) {
+			continue
+		}
+		if index == -1 {
+			index = candidate
+			if p.strategy != config.KeyRotationLeastRecentlyThrottled {
+				break
+			}
+		} else if p.throttled[candidate].Before(p.throttled[index]) {
+			index = candidate
+		}
+	}
+
+	if index == -1 {
+		index = 0
+		for i := range p.keys {
+			if p.until[i].Before(p.until[index]) {
+				index = i
+			}
+		}
+	}
+	p.next = (index + 1) % len(p.keys)
+	return index
+}
+
+// throttle starts the cooldown of the key that was rate limited. wait is
+// when the provider asked to retry, or zero for the default cooldown.
+func (p *keyPool) throttle(index int, wait time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if wait <= 0 {
+		wait = p.cooldown
+	}
+	now := time.Now()
+	p.throttled[index] = now
+	p.until[index] = now.Add(wait)
+}
+
+// ready reports whether any key is out of its cooldown
+func (p *keyPool) ready() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now()
+	for _, until := range p.until {
+		if !until.After(now) {
+			return true
+		}
+	}
+	return false
+}
+
+// keyTransport authenticates every request with a key of the pool. A
+// request that is rate limited is sent again right away with the next key
+// that isn't in its cooldown; only when there is none is the response
+// returned, so the caller backs off as usual.
+type keyTransport struct {
+	pool  *keyPool
+	base  http.RoundTripper
+	azure bool
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *keyTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	for attempt := 1; ; attempt++ {
+		index := t.pool.pick()
+		keyed := req.Clone(req.Context())
+		if attempt > 1 {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			keyed.Body = body
+		}
+		if t.azure {
+			keyed.Header.Set("api-key", t.pool.keys[index])
+		} else {
+			keyed.Header.Set("Authorization", "Bearer "+t.pool.keys[index])
+		}
+
+		resp, err := t.base.RoundTrip(keyed)
+		if err != nil || resp.StatusCode != http.StatusTooManyRequests {
+			return resp, err
+		}
+
+		wait, _ := retryAfter(resp.Header)
+		t.pool.throttle(index, wait)
+		if req.GetBody == nil || attempt >= len(t.pool.keys) || !t.pool.ready() {
+			return resp, nil
+		}
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+	}
+}
@@ -0,0 +1,110 @@
+package llm
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Turee/si/pkg/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// picks returns the keys of the next n requests
+func picks(pool *keyPool, n int) []string {
+	var keys []string
+	for i := 0; i < n; i++ {
+		keys = append(keys, pool.keys[pool.pick()])
+	}
+	return keys
+}
+
+// TestKeyPoolRoundRobin tests using the keys in turn, skipping keys in their
+// cooldown
+func TestKeyPoolRoundRobin(t *testing.T) {
+	pool := newKeyPool([]string{"a", "b", "c"}, config.KeyRotationConfig{})
+	pool.next = 0
+	assert.Equal(t, []string{"a", "b", "c", "a"}, picks(pool, 4))
+
+	pool.throttle(2, time.Hour)
+	assert.Equal(t, []string{"b", "a", "b"}, picks(pool, 3))
+
+	// When every key is in its cooldown, the one that is ready first is used
+	pool.throttle(0, time.Hour)
+	pool.throttle(1, time.Minute)
+	assert.False(t, pool.ready())
+	assert.Equal(t, []string{"b", "b"}, picks(pool, 2))
+}
+
+// TestKeyPoolLeastRecentlyThrottled tests preferring keys that were rate
+// limited longest ago
+func TestKeyPoolLeastRecentlyThrottled(t *testing.T) {
+	pool := newKeyPool([]string{"a", "b", "c"}, config.KeyRotationConfig{Strategy: config.KeyRotationLeastRecentlyThrottled})
+	pool.next = 0
+	assert.Equal(t, []string{"a", "b", "c"}, picks(pool, 3))
+
+	// The cooldowns are over, but b was throttled last and c never
+	pool.throttle(0, time.Nanosecond)
+	time.Sleep(time.Millisecond)
+	pool.throttle(1, time.Nanosecond)
+	time.Sleep(time.Millisecond)
+	assert.Equal(t, []string{"c", "c"}, picks(pool, 2))
+	pool.throttle(2, time.Nanosecond)
+	time.Sleep(time.Millisecond)
+	assert.Equal(t, []string{"a", "a"}, picks(pool, 2))
+}
+
+// TestKeyRotation tests that a rate limited request is sent again with
+// another key, and the limited key is skipped during its cooldown
+func TestKeyRotation(t *testing.T) {
+	var mu sync.Mutex
+	var used []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		used = append(used, r.Header.Get("Authorization"))
+		mu.Unlock()
+		if r.Header.Get("Authorization") == "Bearer sk-limited" {
+			w.Header().Set("Retry-After", "120")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte("data: {\"choices\":[{\"delta\":{\"content\":\"Paris\"}}]}\n\ndata: [DONE]\n\n"))
+	}))
+	t.Cleanup(server.Close)
+
+	cfg := &config.OpenAIConfig{BaseURL: server.URL, APIKeys: []string{"sk-limited", "sk-ok"}}
+	provider, err := NewOpenAIProvider(cfg)
+	require.NoError(t, err)
+	sharedKeyPool(cfg).next = 0
+
+	for i := 0; i < 3; i++ {
+		answer, err := provider.Ask(context.Background(), "capital of France?")
+		require.NoError(t, err)
+		assert.Equal(t, "Paris", answer)
+	}
+	assert.Equal(t, []string{"Bearer sk-limited", "Bearer sk-ok", "Bearer sk-ok", "Bearer sk-ok"}, used)
+}
+
+// TestKeyRotationAllThrottled tests that the rate limit is returned for the
+// caller to back off when every key is limited
+func TestKeyRotationAllThrottled(t *testing.T) {
+	waits := mockSleep(t)
+	server, requests := failingServer(t, nil, http.StatusTooManyRequests, http.StatusTooManyRequests)
+
+	provider, err := NewOpenAIProvider(&config.OpenAIConfig{
+		BaseURL:     server.URL,
+		APIKeys:     []string{"sk-a", "sk-b"},
+		KeyRotation: config.KeyRotationConfig{Cooldown: time.Millisecond},
+	})
+	require.NoError(t, err)
+
+	answer, err := provider.Ask(context.Background(), "capital of France?")
+	require.NoError(t, err)
+	assert.Equal(t, "Paris", answer)
+	assert.Equal(t, 3, *requests)
+	assert.Equal(t, []time.Duration{time.Second}, *waits)
+}
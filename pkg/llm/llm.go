@@ -1,15 +1,22 @@
 package llm
 
 import (
-	"bufio"
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
+	"slices"
 	"strings"
+	"time"
 
 	"github.com/Turee/si/pkg/config"
+	"github.com/Turee/si/pkg/logging"
+	"github.com/Turee/si/pkg/sse"
+	"github.com/Turee/si/pkg/tokens"
 )
 
 // Provider defines the interface for LLM providers
@@ -19,6 +26,222 @@ type Provider interface {
 
 	// AskStream sends a question to the LLM and streams the response
 	AskStream(ctx context.Context, question string, callback func(chunk string) error) error
+
+	// Chat sends a conversation to the LLM and returns the response
+	Chat(ctx context.Context, messages []Message) (string, error)
+
+	// ChatStream sends a conversation to the LLM and streams the response
+	ChatStream(ctx context.Context, messages []Message, callback func(chunk string) error) error
+}
+
+// DefaultSystemPrompt is used for conversations that don't start with a
+// system message, unless the provider was given another system prompt
+const DefaultSystemPrompt = "You are an AI assistant being used from a terminal. Provide concise, direct responses optimized for command-line viewing. Prioritize brevity and clarity. Use markdown formatting when helpful for readability. Avoid unnecessary pleasantries or verbose explanations unless specifically requested."
+
+// RequestHook can inspect and modify the JSON payload of a request before it
+// is sent to the provider
+type RequestHook func(payload map[string]interface{}) (map[string]interface{}, error)
+
+// HookableProvider is implemented by providers that support request hooks
+type HookableProvider interface {
+	// SetRequestHook installs a hook that is applied to every request payload
+	SetRequestHook(hook RequestHook)
+}
+
+// StructuredOutputProvider is implemented by providers that can constrain
+// answers to a JSON Schema
+type StructuredOutputProvider interface {
+	// SetResponseSchema requests answers that are JSON documents conforming
+	// to the schema
+	SetResponseSchema(schema json.RawMessage)
+}
+
+// SystemPrompter is implemented by providers whose system prompt can be
+// replaced
+type SystemPrompter interface {
+	// SetSystemPrompt replaces the default system prompt for conversations
+	// that don't start with a system message
+	SetSystemPrompt(prompt string)
+}
+
+// ExamplePrompter is implemented by providers that can send example
+// exchanges ahead of every conversation
+type ExamplePrompter interface {
+	// SetExamples sets user and assistant messages that are sent after the
+	// system prompt, showing the model how to answer
+	SetExamples(examples []Message)
+}
+
+// ModelLister is implemented by providers that can list the available models
+type ModelLister interface {
+	// ListModels returns the names of the models available to the user
+	ListModels(ctx context.Context) ([]string, error)
+}
+
+// APIError is returned when the provider responds with an error status
+type APIError struct {
+	StatusCode int
+	// Code is the machine readable error code from the response, if any
+	Code string
+	Body string
+}
+
+// Error implements the error interface
+func (e *APIError) Error() string {
+	return fmt.Sprintf("API request failed with status %d: %s", e.StatusCode, e.Body)
+}
+
+// newAPIError creates an APIError from an error response
+func newAPIError(resp *http.Response) *APIError {
+	body, _ := io.ReadAll(resp.Body)
+
+	var errResp struct {
+		Error struct {
+			Code string `json:"code"`
+		} `json:"error"`
+	}
+	json.Unmarshal(body, &errResp)
+
+	return &APIError{StatusCode: resp.StatusCode, Code: errResp.Error.Code, Body: string(body)}
+}
+
+// StreamError is returned when the provider reports an error in the middle
+// of a streamed response, after it has responded with a success status
+type StreamError struct {
+	// Type is the kind of error, e.g. "server_error" or "overloaded_error"
+	Type string
+	// Code is the machine readable error code, if any
+	Code    string
+	Message string
+}
+
+// Error implements the error interface
+func (e *StreamError) Error() string {
+	kind := e.Code
+	if kind == "" {
+		kind = e.Type
+	}
+	if kind == "" {
+		return fmt.Sprintf("the provider reported an error while streaming: %s", e.Message)
+	}
+	return fmt.Sprintf("the provider reported an error while streaming: %s (%s)", e.Message, kind)
+}
+
+// Temporary reports whether the request may succeed when it is repeated
+func (e *StreamError) Temporary() bool {
+	for _, kind := range []string{e.Type, e.Code} {
+		switch kind {
+		case "server_error", "api_error", "overloaded_error", "overloaded", "rate_limit_error", "rate_limit_exceeded", "timeout":
+			return true
+		}
+	}
+	return false
+}
+
+// parseStreamError returns the error reported by a data line of a stream, or
+// nil if the line isn't an error. The data of error events is an error even
+// if it isn't JSON.
+func parseStreamError(data []byte, errorEvent bool) *StreamError {
+	var payload struct {
+		Error json.RawMessage `json:"error"`
+	}
+	if err := json.Unmarshal(data, &payload); err != nil || len(payload.Error) == 0 || string(payload.Error) == "null" {
+		if errorEvent {
+			return &StreamError{Message: string(data)}
+		}
+		return nil
+	}
+
+	var details struct {
+		Type    string          `json:"type"`
+		Code    json.RawMessage `json:"code"`
+		Message string          `json:"message"`
+	}
+	if err := json.Unmarshal(payload.Error, &details); err != nil {
+		// Some providers send the message as a plain string
+		var message string
+		if json.Unmarshal(payload.Error, &message) != nil {
+			message = string(payload.Error)
+		}
+		return &StreamError{Message: message}
+	}
+
+	code := strings.Trim(string(details.Code), `"`)
+	if code == "null" {
+		code = ""
+	}
+	return &StreamError{Type: details.Type, Code: code, Message: details.Message}
+}
+
+// ErrStreamInterrupted is returned when a streamed answer ends before the
+// provider completed it, e.g. because the connection dropped
+var ErrStreamInterrupted = errors.New("the stream ended before the answer was complete")
+
+// partialError wraps the error of a stream that failed after a part of the
+// answer was passed to the callback, so it isn't answered again elsewhere
+type partialError struct {
+	error
+}
+
+// Unwrap returns the error of the stream
+func (e *partialError) Unwrap() error {
+	return e.error
+}
+
+// RefusalError is returned when the model declines to answer, with a refusal
+// or because the content filter of the provider stopped the answer
+type RefusalError struct {
+	// Refusal is the explanation of the model, empty if the content filter
+	// stopped the answer
+	Refusal string
+}
+
+// Error implements the error interface
+func (e *RefusalError) Error() string {
+	if e.Refusal == "" {
+		return "the model refused to answer: the content filter of the provider stopped the answer"
+	}
+	return "the model refused to answer: " + e.Refusal
+}
+
+// IsModelNotFound reports whether err means the requested model doesn't exist
+// or isn't available to the user
+func IsModelNotFound(err error) bool {
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+	return apiErr.StatusCode == http.StatusNotFound ||
+		apiErr.Code == "model_not_found" || apiErr.Code == "DeploymentNotFound"
+}
+
+// IsUnauthorized reports whether err means the provider rejected the API key
+// or the key lacks the permission for the request
+func IsUnauthorized(err error) bool {
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+	return apiErr.StatusCode == http.StatusUnauthorized || apiErr.StatusCode == http.StatusForbidden
+}
+
+// IsRateLimited reports whether err means the provider rate limited the
+// request, or the quota of the account is used up
+func IsRateLimited(err error) bool {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.StatusCode == http.StatusTooManyRequests
+	}
+
+	var streamErr *StreamError
+	if errors.As(err, &streamErr) {
+		for _, kind := range []string{streamErr.Type, streamErr.Code} {
+			if kind == "rate_limit_error" || kind == "rate_limit_exceeded" {
+				return true
+			}
+		}
+	}
+	return false
 }
 
 // ProviderFactory is a function type that creates a Provider from a config
@@ -30,35 +253,104 @@ var NewProvider ProviderFactory = newProvider
 
 // newProvider is the actual implementation of NewProvider
 func newProvider(cfg *config.Config) (Provider, error) {
-	// For now, we only support OpenAI
+	if cfg.ProviderType() == config.ProviderTypeCopilot {
+		return NewCopilotProvider(&cfg.LLM.OpenAI)
+	}
 	return NewOpenAIProvider(&cfg.LLM.OpenAI)
 }
 
 // NewOpenAIProvider creates a new OpenAI provider
 func NewOpenAIProvider(cfg *config.OpenAIConfig) (Provider, error) {
+	base, err := newTransport(cfg)
+	if err != nil {
+		return nil, err
+	}
+	transport := logging.Transport(base)
+	if len(cfg.APIKeys) > 0 {
+		transport = &keyTransport{pool: sharedKeyPool(cfg), base: transport, azure: cfg.AzureDeploymentName != ""}
+	}
+
 	return &openAIProvider{
 		cfg:    cfg,
-		client: &http.Client{},
+		client: &http.Client{Transport: transport},
 	}, nil
 }
 
 // openAIProvider implements the Provider interface for OpenAI
 type openAIProvider struct {
-	cfg    *config.OpenAIConfig
-	client *http.Client
+	cfg              *config.OpenAIConfig
+	client           *http.Client
+	requestHook      RequestHook
+	usageCallback    func(Usage)
+	metadataCallback func(Metadata)
+	responseSchema   json.RawMessage
+	systemPrompt     string
+	examples         []Message
+
+	// dryRun receives the requests instead of the provider in dry-run mode
+	dryRun io.Writer
+}
+
+// SetRequestHook implements the HookableProvider interface
+func (p *openAIProvider) SetRequestHook(hook RequestHook) {
+	p.requestHook = hook
+}
+
+// SetResponseSchema implements the StructuredOutputProvider interface
+func (p *openAIProvider) SetResponseSchema(schema json.RawMessage) {
+	p.responseSchema = schema
+}
+
+// SetSystemPrompt implements the SystemPrompter interface
+func (p *openAIProvider) SetSystemPrompt(prompt string) {
+	p.systemPrompt = prompt
+}
+
+// SetExamples implements the ExamplePrompter interface
+func (p *openAIProvider) SetExamples(examples []Message) {
+	p.examples = examples
+}
+
+// SetUsageCallback implements the UsageReporter interface
+func (p *openAIProvider) SetUsageCallback(callback func(Usage)) {
+	p.usageCallback = callback
+}
+
+// SetMetadataCallback implements the MetadataReporter interface
+func (p *openAIProvider) SetMetadataCallback(callback func(Metadata)) {
+	p.metadataCallback = callback
 }
 
 // OpenAI API request and response structures
 type openAIRequest struct {
-	Model       string    `json:"model"`
-	Messages    []message `json:"messages"`
-	Stream      bool      `json:"stream"`
-	Temperature float64   `json:"temperature,omitempty"`
+	Model          string          `json:"model"`
+	Messages       []Message       `json:"messages"`
+	Stream         bool            `json:"stream"`
+	StreamOptions  *streamOptions  `json:"stream_options,omitempty"`
+	Temperature    *float64        `json:"temperature,omitempty"`
+	TopP           *float64        `json:"top_p,omitempty"`
+	MaxTokens      int             `json:"max_tokens,omitempty"`
+	ResponseFormat *responseFormat `json:"response_format,omitempty"`
+	Tools          []toolJSON      `json:"tools,omitempty"`
+	Store          *bool           `json:"store,omitempty"`
+
+	// Provider routes the request on OpenRouter
+	Provider *providerPreferences `json:"provider,omitempty"`
+}
+
+type streamOptions struct {
+	IncludeUsage bool `json:"include_usage"`
 }
 
-type message struct {
-	Role    string `json:"role"`
-	Content string `json:"content"`
+// responseFormat requests structured output conforming to a JSON Schema
+type responseFormat struct {
+	Type       string     `json:"type"`
+	JSONSchema jsonSchema `json:"json_schema"`
+}
+
+type jsonSchema struct {
+	Name   string          `json:"name"`
+	Schema json.RawMessage `json:"schema"`
 }
 
 type openAIResponse struct {
@@ -71,7 +363,7 @@ type openAIResponse struct {
 
 type choice struct {
 	Index        int     `json:"index"`
-	Message      message `json:"message"`
+	Message      Message `json:"message"`
 	FinishReason string  `json:"finish_reason"`
 }
 
@@ -82,6 +374,11 @@ type streamResponse struct {
 	Created int64          `json:"created"`
 	Model   string         `json:"model"`
 	Choices []streamChoice `json:"choices"`
+	Usage   *apiUsage      `json:"usage,omitempty"`
+
+	// Provider is the upstream provider that served the request, reported
+	// by OpenRouter
+	Provider string `json:"provider,omitempty"`
 }
 
 type streamChoice struct {
@@ -91,15 +388,30 @@ type streamChoice struct {
 }
 
 type streamDelta struct {
-	Role    string `json:"role,omitempty"`
-	Content string `json:"content,omitempty"`
+	Role      string          `json:"role,omitempty"`
+	Content   string          `json:"content,omitempty"`
+	ToolCalls []toolCallDelta `json:"tool_calls,omitempty"`
+
+	// Refusal is sent instead of the content when the model declines to
+	// answer
+	Refusal string `json:"refusal,omitempty"`
 }
 
 // Ask implements the Provider interface
 func (p *openAIProvider) Ask(ctx context.Context, question string) (string, error) {
+	return p.Chat(ctx, []Message{NewUserMessage(question)})
+}
+
+// AskStream implements the Provider interface for streaming responses
+func (p *openAIProvider) AskStream(ctx context.Context, question string, callback func(chunk string) error) error {
+	return p.ChatStream(ctx, []Message{NewUserMessage(question)}, callback)
+}
+
+// Chat implements the Provider interface
+func (p *openAIProvider) Chat(ctx context.Context, messages []Message) (string, error) {
 	var result strings.Builder
 
-	err := p.AskStream(ctx, question, func(chunk string) error {
+	err := p.ChatStream(ctx, messages, func(chunk string) error {
 		result.WriteString(chunk)
 		return nil
 	})
@@ -111,132 +423,437 @@ func (p *openAIProvider) Ask(ctx context.Context, question string) (string, erro
 	return result.String(), nil
 }
 
-// AskStream implements the Provider interface for streaming responses
-func (p *openAIProvider) AskStream(ctx context.Context, question string, callback func(chunk string) error) error {
+// ChatStream implements the Provider interface for streaming responses
+func (p *openAIProvider) ChatStream(ctx context.Context, messages []Message, callback func(chunk string) error) error {
+	_, err := p.ChatTools(ctx, messages, nil, callback)
+	return err
+}
+
+// ChatTools implements the ToolCaller interface
+func (p *openAIProvider) ChatTools(ctx context.Context, messages []Message, tools []Tool, callback func(chunk string) error) ([]ToolCall, error) {
+	answer, err := p.chat(ctx, messages, tools, callback, false)
+	if err != nil {
+		return nil, err
+	}
+	return answer.calls, nil
+}
+
+// ChatResult implements the ResultProvider interface
+func (p *openAIProvider) ChatResult(ctx context.Context, messages []Message, callback func(chunk string) error) (*Result, error) {
+	var text strings.Builder
+	answer, err := p.chat(ctx, messages, nil, func(chunk string) error {
+		text.WriteString(chunk)
+		if callback == nil {
+			return nil
+		}
+		return callback(chunk)
+	}, true)
+	if err != nil {
+		return nil, err
+	}
+	return &Result{Text: text.String(), Usage: answer.usage, Metadata: answer.metadata}, nil
+}
+
+// chat sends the conversation and streams the answer to the callback. With
+// includeUsage, the usage is requested even if no usage callback is set.
+func (p *openAIProvider) chat(ctx context.Context, messages []Message, tools []Tool, callback func(chunk string) error, includeUsage bool) (*streamAnswer, error) {
 	// Determine the API endpoint
 	baseURL := p.cfg.BaseURL
 	if baseURL == "" {
-		baseURL = "https://api.openai.com/v1"
+		baseURL = config.DefaultBaseURL
 	}
 
 	// Determine the model to use
 	model := p.cfg.ModelName
 	if model == "" {
-		model = "gpt-4"
+		model = config.DefaultModelName
 	}
 
 	// Create the request
 	reqBody := openAIRequest{
-		Model: model,
-		Messages: []message{
-			{
-				Role:    "system",
-				Content: "You are an AI assistant being used from a terminal. Provide concise, direct responses optimized for command-line viewing. Prioritize brevity and clarity. Use markdown formatting when helpful for readability. Avoid unnecessary pleasantries or verbose explanations unless specifically requested.",
-			},
-			{
-				Role:    "user",
-				Content: question,
-			},
-		},
-		Stream: true,
-	}
-
-	reqJSON, err := json.Marshal(reqBody)
+		Model:       model,
+		Stream:      true,
+		Temperature: p.cfg.Temperature,
+		TopP:        p.cfg.TopP,
+		MaxTokens:   p.cfg.MaxTokens,
+		Tools:       newToolsJSON(tools),
+		Store:       p.cfg.Store,
+		Provider:    p.providerPreferences(),
+	}
+
+	// The usage is only sent in a final chunk when it is requested. The
+	// rate limit counts the tokens of the usage too.
+	if includeUsage || p.usageCallback != nil || p.cfg.RateLimit.TokensPerMinute > 0 {
+		reqBody.StreamOptions = &streamOptions{IncludeUsage: true}
+	}
+
+	if p.responseSchema != nil {
+		reqBody.ResponseFormat = &responseFormat{
+			Type:       "json_schema",
+			JSONSchema: jsonSchema{Name: "response", Schema: p.responseSchema},
+		}
+	}
+
+	// encode creates the payload of the conversation and lets the request
+	// hook modify it
+	encode := func(messages []Message) ([]byte, error) {
+		reqBody.Messages = withExamples(withSystemPrompt(messages, p.systemPrompt), p.examples)
+		reqJSON, err := json.Marshal(reqBody)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal request: %w", err)
+		}
+		if p.requestHook != nil {
+			return applyRequestHook(p.requestHook, reqJSON)
+		}
+		return reqJSON, nil
+	}
+	reqJSON, err := encode(messages)
 	if err != nil {
-		return fmt.Errorf("failed to marshal request: %w", err)
+		return nil, err
 	}
 
-	// Determine the API endpoint based on whether we're using Azure or standard OpenAI
-	var endpoint string
-	if p.cfg.AzureDeploymentName != "" {
-		// Azure OpenAI endpoint format
-		if !strings.HasSuffix(baseURL, "/") {
-			baseURL += "/"
+	endpoint := p.endpoint(baseURL, "chat/completions")
+	newRequest := func() (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, "POST", endpoint, bytes.NewReader(reqJSON))
+		if err != nil {
+			return nil, fmt.Errorf("failed to create request: %w", err)
 		}
-		endpoint = fmt.Sprintf("%sopenai/deployments/%s/chat/completions?api-version=2024-12-01-preview",
-			baseURL, p.cfg.AzureDeploymentName)
-	} else {
-		// Standard OpenAI endpoint
-		// If the user provided a complete URL including the endpoint, use it directly
-		if strings.Contains(baseURL, "/chat/completions") {
-			endpoint = baseURL
-		} else {
-			// Otherwise, ensure the URL doesn't have a trailing slash and add the endpoint
-			baseURL = strings.TrimSuffix(baseURL, "/")
-			endpoint = fmt.Sprintf("%s/chat/completions", baseURL)
+
+		req.Header.Set("Content-Type", "application/json")
+		p.setHeaders(req)
+		return req, nil
+	}
+
+	if p.dryRun != nil {
+		req, err := newRequest()
+		if err != nil {
+			return nil, err
 		}
+		return nil, p.printRequest(req, reqJSON)
 	}
 
-	// Create the HTTP request
-	req, err := http.NewRequestWithContext(ctx, "POST", endpoint, strings.NewReader(string(reqJSON)))
+	// Wait until the request fits into the rate limits, counting the tokens
+	// of the prompt and the longest answer
+	limiter := sharedRateLimiter(baseURL, p.cfg.RateLimit)
+	countTokens, err := limiter.wait(ctx, tokens.Estimate(string(reqJSON))+p.cfg.MaxTokens)
 	if err != nil {
-		return fmt.Errorf("failed to create request: %w", err)
+		return nil, fmt.Errorf("failed waiting for the rate limit: %w", err)
 	}
 
-	// Set headers
-	req.Header.Set("Content-Type", "application/json")
+	// Wait for a free slot if the number of concurrent requests is limited
+	release, err := acquireSlot(ctx, endpoint, p.cfg.MaxConcurrentRequests)
+	if err != nil {
+		return nil, fmt.Errorf("failed waiting for a request slot: %w", err)
+	}
+	defer release()
+
+	// Send the request, retrying transient errors. Errors the provider
+	// reports in the stream and dropped connections are retried as well,
+	// sharing the attempts with the transient errors.
+	// Once a part of the answer has been passed to the callback, the request
+	// is repeated with the partial answer, so the model continues it instead
+	// of starting over.
+	var partial strings.Builder
+	record := func(chunk string) error {
+		partial.WriteString(chunk)
+		return callback(chunk)
+	}
+	start := time.Now()
+	var attempt int
+	for {
+		resp, err := doWithAttempts(ctx, p.client, p.cfg.Retry, &attempt, newRequest)
+		if err != nil {
+			return nil, streamFailed(err, partial.Len() > 0)
+		}
+
+		answer, _, err := p.readStream(ctx, resp.Body, start, record)
+		resp.Body.Close()
+		if answer.usage != nil {
+			countTokens(answer.usage.TotalTokens)
+		}
 
-	// Set the API key header based on whether we're using Azure or not
-	if p.cfg.AzureDeploymentName != "" {
-		req.Header.Set("api-key", p.cfg.APIKey)
-	} else {
-		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", p.cfg.APIKey))
+		if err == nil {
+			return &answer, nil
+		}
+		if !p.retryableStream(ctx, err, partial.Len() > 0) {
+			return nil, streamFailed(err, partial.Len() > 0)
+		}
+		if attempt > p.cfg.Retry.Retries() {
+			return nil, streamFailed(giveUp(err, attempt), partial.Len() > 0)
+		}
+
+		wait := backoff(p.cfg.Retry, attempt)
+		if partial.Len() > 0 {
+			logging.Logger().Info("resuming stream", "attempt", attempt, "wait", wait, "received", partial.Len(), "error", err)
+			var encErr error
+			if reqJSON, encErr = encode(resumeMessages(messages, partial.String())); encErr != nil {
+				return nil, encErr
+			}
+		} else {
+			logging.Logger().Info("retrying stream", "attempt", attempt, "wait", wait, "error", err)
+		}
+		if sleepErr := sleep(ctx, wait); sleepErr != nil {
+			return nil, fmt.Errorf("%w (retry canceled: %w)", err, sleepErr)
+		}
 	}
+}
 
-	// Send the request
-	resp, err := p.client.Do(req)
-	if err != nil {
-		return fmt.Errorf("failed to send request: %w", err)
+// retryableStream reports whether a stream that failed with err may be
+// repeated: it was interrupted or the provider reported a temporary error.
+// With partial, a part of the answer was received, and the request may only
+// be repeated if answers are resumed. Answers constrained to a schema are
+// never resumed, as the continuation wouldn't conform to it on its own.
+func (p *openAIProvider) retryableStream(ctx context.Context, err error, partial bool) bool {
+	if ctx.Err() != nil {
+		return false
 	}
-	defer resp.Body.Close()
+	var streamErr *StreamError
+	if !errors.Is(err, ErrStreamInterrupted) && !(errors.As(err, &streamErr) && streamErr.Temporary()) {
+		return false
+	}
+	return !partial || (p.cfg.Retry.ResumesStreams() && p.responseSchema == nil)
+}
 
-	// Check for errors
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("API request failed with status %d: %s", resp.StatusCode, string(body))
+// streamFailed returns the error of a stream that is given up, marked if a
+// part of the answer was received
+func streamFailed(err error, partial bool) error {
+	if partial {
+		return &partialError{err}
 	}
+	return err
+}
+
+// resumePrompt asks the model to continue an interrupted answer
+const resumePrompt = "Your answer was cut off. Continue it exactly where it stopped, without repeating anything you already wrote."
 
-	// Process the streaming response
-	reader := bufio.NewReader(resp.Body)
+// resumeMessages returns the conversation with the partial answer and a
+// request to continue it
+func resumeMessages(messages []Message, partial string) []Message {
+	resumed := append([]Message(nil), messages...)
+	return append(resumed, Message{Role: RoleAssistant, Content: partial}, NewUserMessage(resumePrompt))
+}
+
+// streamAnswer is what was read from a streamed response besides the content
+type streamAnswer struct {
+	calls []ToolCall
+	// usage is nil if the provider didn't report it
+	usage    *Usage
+	metadata Metadata
+}
+
+// readStream reads a streamed response, passing the content to the callback,
+// and returns the tool calls, usage and metadata of the answer. streamed
+// tells whether anything has been passed to the callback, so a failed
+// request can't be repeated without repeating output. The timings of the
+// metadata are measured from start.
+//
+// Canceling ctx closes the body, so a read that is waiting for the provider
+// returns right away, even with transports that don't cancel reads of the
+// body themselves.
+func (p *openAIProvider) readStream(ctx context.Context, body io.ReadCloser, start time.Time, callback func(chunk string) error) (answer streamAnswer, streamed bool, err error) {
+	stop := context.AfterFunc(ctx, func() { body.Close() })
+	defer stop()
+
+	decoder := sse.NewDecoder(body)
+	metadata := &answer.metadata
+	var accumulator toolCallAccumulator
+	var refusal strings.Builder
+
+	// done is set when the stream was ended by the provider rather than by
+	// a dropped connection
+	done := false
 
 	for {
-		// Read a line from the response
-		line, err := reader.ReadString('\n')
+		event, err := decoder.Next()
+		if ctx.Err() != nil {
+			return streamAnswer{}, streamed, ctx.Err()
+		}
+		if err == io.EOF {
+			break
+		}
 		if err != nil {
-			if err == io.EOF {
-				break
-			}
-			return fmt.Errorf("error reading response: %w", err)
+			return streamAnswer{}, streamed, fmt.Errorf("%w: error reading response: %w", ErrStreamInterrupted, err)
 		}
 
-		// Skip empty lines and "data: [DONE]"
-		line = strings.TrimSpace(line)
-		if line == "" || line == "data: [DONE]" {
+		// "[DONE]" ends the stream
+		data := []byte(strings.TrimSpace(event.Data))
+		if string(data) == "[DONE]" {
+			done = true
 			continue
 		}
 
-		// Remove "data: " prefix
-		if strings.HasPrefix(line, "data: ") {
-			line = strings.TrimPrefix(line, "data: ")
-		} else {
-			continue // Skip non-data lines
+		// Providers report errors in the middle of the stream as error
+		// events or data with an error object
+		if streamErr := parseStreamError(data, event.Type == "error"); streamErr != nil {
+			return streamAnswer{}, streamed, streamErr
 		}
 
 		// Parse the JSON
 		var streamResp streamResponse
-		if err := json.Unmarshal([]byte(line), &streamResp); err != nil {
-			return fmt.Errorf("error parsing response: %w", err)
+		if err := json.Unmarshal(data, &streamResp); err != nil {
+			return streamAnswer{}, streamed, fmt.Errorf("error parsing response: %w", err)
+		}
+
+		if streamResp.ID != "" {
+			metadata.ID = streamResp.ID
+		}
+		if streamResp.Model != "" {
+			metadata.Model = streamResp.Model
+		}
+		if streamResp.Provider != "" {
+			metadata.Provider = streamResp.Provider
 		}
 
 		// Process the choices
 		for _, choice := range streamResp.Choices {
+			if choice.FinishReason != "" {
+				metadata.FinishReason = choice.FinishReason
+			}
 			if choice.Delta.Content != "" {
+				if !streamed {
+					metadata.TimeToFirstToken = time.Since(start)
+				}
+				streamed = true
 				if err := callback(choice.Delta.Content); err != nil {
-					return err
+					return streamAnswer{}, streamed, err
 				}
 			}
+			refusal.WriteString(choice.Delta.Refusal)
+			for _, delta := range choice.Delta.ToolCalls {
+				accumulator.add(delta)
+			}
 		}
+
+		if streamResp.Usage != nil {
+			reported := streamResp.Usage.usage()
+			answer.usage = &reported
+			if p.usageCallback != nil {
+				p.usageCallback(reported)
+			}
+		}
+	}
+
+	if streamed && !done && metadata.FinishReason == "" {
+		return streamAnswer{}, streamed, ErrStreamInterrupted
+	}
+
+	// A refusal or filtered response carries no answer
+	if !streamed && len(accumulator.calls) == 0 && (refusal.Len() > 0 || metadata.FinishReason == "content_filter") {
+		return streamAnswer{}, streamed, &RefusalError{Refusal: refusal.String()}
 	}
 
-	return nil
+	metadata.Duration = time.Since(start)
+	if p.metadataCallback != nil {
+		p.metadataCallback(*metadata)
+	}
+
+	answer.calls = accumulator.calls
+	return answer, streamed, nil
+}
+
+// endpoint returns the URL of an API path, based on whether we're using Azure
+// or standard OpenAI
+func (p *openAIProvider) endpoint(baseURL, path string) string {
+	if p.cfg.AzureDeploymentName != "" {
+		// Azure OpenAI endpoint format
+		if !strings.HasSuffix(baseURL, "/") {
+			baseURL += "/"
+		}
+		return fmt.Sprintf("%sopenai/deployments/%s/%s?api-version=%s",
+			baseURL, p.cfg.AzureDeploymentName, path, url.QueryEscape(p.cfg.AzureVersion()))
+	}
+
+	// Standard OpenAI endpoint
+	// If the user provided a complete URL including the endpoint, use it directly
+	if strings.Contains(baseURL, "/chat/completions") {
+		if path == "chat/completions" {
+			return baseURL
+		}
+		baseURL = baseURL[:strings.Index(baseURL, "/chat/completions")]
+	}
+
+	// Otherwise, ensure the URL doesn't have a trailing slash and add the endpoint
+	baseURL = strings.TrimSuffix(baseURL, "/")
+	return fmt.Sprintf("%s/%s", baseURL, path)
+}
+
+// setHeaders sets the API key header, the headers specific to the provider
+// and the custom headers of the configuration
+func (p *openAIProvider) setHeaders(req *http.Request) {
+	p.setAuthHeader(req)
+	p.setOrganizationHeaders(req)
+	p.setOpenRouterHeaders(req)
+	for name, value := range p.cfg.Headers {
+		req.Header.Set(name, value)
+	}
+}
+
+// setAuthHeader sets the API key header based on whether we're using Azure or not
+func (p *openAIProvider) setAuthHeader(req *http.Request) {
+	if p.cfg.AzureDeploymentName != "" {
+		req.Header.Set("api-key", p.cfg.APIKey)
+	} else {
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", p.cfg.APIKey))
+	}
+}
+
+// setOrganizationHeaders sets the organization and project the usage of the
+// request is billed to. Azure OpenAI bills the resource instead.
+func (p *openAIProvider) setOrganizationHeaders(req *http.Request) {
+	if p.cfg.AzureDeploymentName != "" {
+		return
+	}
+	if p.cfg.OrganizationID != "" {
+		req.Header.Set("OpenAI-Organization", p.cfg.OrganizationID)
+	}
+	if p.cfg.ProjectID != "" {
+		req.Header.Set("OpenAI-Project", p.cfg.ProjectID)
+	}
+}
+
+// applyRequestHook passes the JSON payload through the hook and returns the
+// re-encoded result
+func applyRequestHook(hook RequestHook, reqJSON []byte) ([]byte, error) {
+	var payload map[string]interface{}
+	if err := json.Unmarshal(reqJSON, &payload); err != nil {
+		return nil, fmt.Errorf("failed to decode request for hook: %w", err)
+	}
+
+	payload, err := hook(payload)
+	if err != nil {
+		return nil, fmt.Errorf("request hook failed: %w", err)
+	}
+
+	reqJSON, err = json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request from hook: %w", err)
+	}
+
+	return reqJSON, nil
+}
+
+// withSystemPrompt prepends the system prompt, or the default one if it is
+// empty, unless the conversation already starts with a system message
+func withSystemPrompt(messages []Message, prompt string) []Message {
+	if len(messages) > 0 && messages[0].Role == RoleSystem {
+		return messages
+	}
+	if prompt == "" {
+		prompt = DefaultSystemPrompt
+	}
+
+	return append([]Message{{Role: RoleSystem, Content: prompt}}, messages...)
+}
+
+// withExamples inserts the example messages after the leading system messages
+func withExamples(messages []Message, examples []Message) []Message {
+	if len(examples) == 0 {
+		return messages
+	}
+
+	i := 0
+	for i < len(messages) && messages[i].Role == RoleSystem {
+		i++
+	}
+	return slices.Concat(messages[:i], examples, messages[i:])
 }
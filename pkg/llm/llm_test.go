@@ -2,13 +2,18 @@ package llm
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/Turee/si/pkg/config"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 // TestNewProvider tests the NewProvider function
@@ -83,7 +88,9 @@ func TestOpenAIProviderBaseURLHandling(t *testing.T) {
 		name            string
 		baseURL         string
 		azureDeployment string
+		apiVersion      string
 		expectedPath    string
+		expectedQuery   string
 	}{
 		{
 			name:            "Standard OpenAI Base URL",
@@ -108,21 +115,32 @@ func TestOpenAIProviderBaseURLHandling(t *testing.T) {
 			baseURL:         "https://myresource.openai.azure.com",
 			azureDeployment: "my-deployment",
 			expectedPath:    "/openai/deployments/my-deployment/chat/completions",
+			expectedQuery:   "api-version=" + config.DefaultAzureAPIVersion,
+		},
+		{
+			name:            "Azure OpenAI URL with API Version",
+			baseURL:         "https://myresource.openai.azure.com",
+			azureDeployment: "my-deployment",
+			apiVersion:      "2025-01-01-preview",
+			expectedPath:    "/openai/deployments/my-deployment/chat/completions",
+			expectedQuery:   "api-version=2025-01-01-preview",
 		},
 		{
 			name:            "Azure OpenAI URL with Trailing Slash",
 			baseURL:         "https://myresource.openai.azure.com/",
 			azureDeployment: "my-deployment",
 			expectedPath:    "/openai/deployments/my-deployment/chat/completions",
+			expectedQuery:   "api-version=" + config.DefaultAzureAPIVersion,
 		},
 	}
 
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
 			// Create a test server to capture the request
-			var capturedPath string
+			var capturedPath, capturedQuery string
 			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 				capturedPath = r.URL.Path
+				capturedQuery = r.URL.RawQuery
 
 				// Simulate a streaming response
 				w.Header().Set("Content-Type", "text/event-stream")
@@ -145,6 +163,7 @@ data: [DONE]
 				BaseURL:             tc.baseURL,
 				APIKey:              "test-api-key",
 				AzureDeploymentName: tc.azureDeployment,
+				AzureAPIVersion:     tc.apiVersion,
 			}
 
 			// Replace the base URL with our test server URL while preserving the path
@@ -169,7 +188,445 @@ data: [DONE]
 			// Verify the request was made to the expected path
 			assert.NoError(t, err)
 			assert.Contains(t, capturedPath, tc.expectedPath)
+			assert.Equal(t, tc.expectedQuery, capturedQuery)
 			assert.Equal(t, "Hello", result.String())
 		})
 	}
 }
+
+// TestOpenAIProviderSamplingParameters tests that sampling parameters are sent with the request
+func TestOpenAIProviderSamplingParameters(t *testing.T) {
+	var captured map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		captured = nil
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&captured))
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("data: [DONE]\n"))
+	}))
+	defer server.Close()
+
+	temperature := 0.0
+	topP := 0.5
+	cfg := &config.OpenAIConfig{
+		BaseURL: server.URL,
+		APIKey:  "test-api-key",
+		SamplingConfig: config.SamplingConfig{
+			Temperature: &temperature,
+			TopP:        &topP,
+			MaxTokens:   100,
+		},
+	}
+
+	provider, err := NewOpenAIProvider(cfg)
+	assert.NoError(t, err)
+
+	_, err = provider.Ask(context.Background(), "test question")
+	assert.NoError(t, err)
+	assert.Equal(t, 0.0, captured["temperature"])
+	assert.Equal(t, 0.5, captured["top_p"])
+	assert.Equal(t, 100.0, captured["max_tokens"])
+
+	// Unset parameters are left to the provider
+	cfg.SamplingConfig = config.SamplingConfig{}
+	_, err = provider.Ask(context.Background(), "test question")
+	assert.NoError(t, err)
+	assert.NotContains(t, captured, "temperature")
+	assert.NotContains(t, captured, "top_p")
+	assert.NotContains(t, captured, "max_tokens")
+	assert.NotContains(t, captured, "response_format")
+	assert.NotContains(t, captured, "store")
+
+	// Opting out of retention is sent explicitly
+	store := false
+	cfg.Store = &store
+	_, err = provider.Ask(context.Background(), "test question")
+	assert.NoError(t, err)
+	assert.Equal(t, false, captured["store"])
+	cfg.Store = nil
+
+	// A response schema requests structured output
+	provider.(StructuredOutputProvider).SetResponseSchema(json.RawMessage(`{"type":"object"}`))
+	_, err = provider.Ask(context.Background(), "test question")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"type":        "json_schema",
+		"json_schema": map[string]interface{}{"name": "response", "schema": map[string]interface{}{"type": "object"}},
+	}, captured["response_format"])
+}
+
+// TestOpenAIProviderRequestHook tests that request hooks can modify the payload
+func TestOpenAIProviderRequestHook(t *testing.T) {
+	var captured map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&captured))
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("data: [DONE]\n"))
+	}))
+	defer server.Close()
+
+	provider, err := NewOpenAIProvider(&config.OpenAIConfig{
+		BaseURL: server.URL,
+		APIKey:  "test-api-key",
+	})
+	assert.NoError(t, err)
+
+	hookable, ok := provider.(HookableProvider)
+	assert.True(t, ok)
+	hookable.SetRequestHook(func(payload map[string]interface{}) (map[string]interface{}, error) {
+		payload["model"] = "hooked-model"
+		payload["user"] = "si"
+		return payload, nil
+	})
+
+	_, err = provider.Ask(context.Background(), "test question")
+	assert.NoError(t, err)
+	assert.Equal(t, "hooked-model", captured["model"])
+	assert.Equal(t, "si", captured["user"])
+	assert.Equal(t, true, captured["stream"])
+}
+
+// TestOpenAIProviderChat tests sending conversations with multi-part messages
+func TestOpenAIProviderChat(t *testing.T) {
+	var captured struct {
+		Messages []Message `json:"messages"`
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		captured.Messages = nil
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&captured))
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("data: {\"choices\":[{\"index\":0,\"delta\":{\"content\":\"A cat\"}}]}\n\ndata: [DONE]\n"))
+	}))
+	defer server.Close()
+
+	provider, err := NewOpenAIProvider(&config.OpenAIConfig{BaseURL: server.URL, APIKey: "test-api-key"})
+	assert.NoError(t, err)
+
+	image := ImagePart("data:image/png;base64,iVBORw0KGgo=")
+	answer, err := provider.Chat(context.Background(), []Message{NewUserMessage("what is this?", image)})
+	assert.NoError(t, err)
+	assert.Equal(t, "A cat", answer)
+
+	// The default system prompt is added in front of the conversation
+	if assert.Len(t, captured.Messages, 2) {
+		assert.Equal(t, DefaultSystemPrompt, captured.Messages[0].Content)
+		assert.Equal(t, []ContentPart{TextPart("what is this?"), image}, captured.Messages[1].Parts)
+	}
+
+	// A system message given by the caller replaces the default one
+	_, err = provider.Chat(context.Background(), []Message{
+		{Role: RoleSystem, Content: "Answer in French."},
+		NewUserMessage("what is this?"),
+	})
+	assert.NoError(t, err)
+	if assert.Len(t, captured.Messages, 2) {
+		assert.Equal(t, "Answer in French.", captured.Messages[0].Content)
+	}
+
+	// The provider's system prompt replaces the default one
+	provider.(SystemPrompter).SetSystemPrompt("Answer in German.")
+	_, err = provider.Ask(context.Background(), "what is this?")
+	assert.NoError(t, err)
+	if assert.Len(t, captured.Messages, 2) {
+		assert.Equal(t, "Answer in German.", captured.Messages[0].Content)
+	}
+}
+
+// TestOpenAIProviderExamples tests sending example exchanges after the system prompt
+func TestOpenAIProviderExamples(t *testing.T) {
+	var captured struct {
+		Messages []Message `json:"messages"`
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		captured.Messages = nil
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&captured))
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("data: {\"choices\":[{\"index\":0,\"delta\":{\"content\":\"SELECT 1\"}}]}\n\ndata: [DONE]\n"))
+	}))
+	defer server.Close()
+
+	provider, err := NewOpenAIProvider(&config.OpenAIConfig{BaseURL: server.URL, APIKey: "test-api-key"})
+	require.NoError(t, err)
+	provider.(ExamplePrompter).SetExamples([]Message{
+		{Role: RoleUser, Content: "count users"},
+		{Role: RoleAssistant, Content: "SELECT count(*) FROM users"},
+	})
+
+	_, err = provider.Ask(context.Background(), "count orders")
+	require.NoError(t, err)
+	roles := make([]string, len(captured.Messages))
+	for i, msg := range captured.Messages {
+		roles[i] = msg.Role
+	}
+	assert.Equal(t, []string{RoleSystem, RoleUser, RoleAssistant, RoleUser}, roles)
+	assert.Equal(t, "count users", captured.Messages[1].Content)
+	assert.Equal(t, "SELECT count(*) FROM users", captured.Messages[2].Content)
+	assert.Equal(t, "count orders", captured.Messages[3].Text())
+
+	// The examples follow a system message given by the caller as well
+	_, err = provider.Chat(context.Background(), []Message{
+		{Role: RoleSystem, Content: "Use PostgreSQL."},
+		NewUserMessage("count orders"),
+	})
+	require.NoError(t, err)
+	if assert.Len(t, captured.Messages, 4) {
+		assert.Equal(t, "Use PostgreSQL.", captured.Messages[0].Content)
+		assert.Equal(t, "count users", captured.Messages[1].Content)
+	}
+}
+
+// TestOpenAIProviderModelNotFound tests detecting unknown models and listing the available ones
+func TestOpenAIProviderModelNotFound(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer test-api-key", r.Header.Get("Authorization"))
+
+		switch r.URL.Path {
+		case "/v1/models":
+			w.Write([]byte(`{"object":"list","data":[{"id":"gpt-4o"},{"id":"gpt-4o-mini"},{"id":"dall-e-3"}]}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"error":{"message":"The model does not exist","code":"model_not_found"}}`))
+		}
+	}))
+	defer server.Close()
+
+	provider, err := NewOpenAIProvider(&config.OpenAIConfig{
+		BaseURL:   server.URL + "/v1/chat/completions",
+		APIKey:    "test-api-key",
+		ModelName: "gpt-5-typo",
+	})
+	assert.NoError(t, err)
+
+	_, err = provider.Ask(context.Background(), "test question")
+	assert.True(t, IsModelNotFound(err))
+	assert.ErrorContains(t, err, "API request failed with status 404")
+
+	models, err := provider.(ModelLister).ListModels(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"dall-e-3", "gpt-4o", "gpt-4o-mini"}, models)
+
+	// Other errors are not mistaken for unknown models
+	assert.False(t, IsModelNotFound(&APIError{StatusCode: http.StatusUnauthorized}))
+	assert.False(t, IsModelNotFound(assert.AnError))
+}
+
+// TestOpenAIProviderUsage tests reporting the token usage of streamed responses
+func TestOpenAIProviderUsage(t *testing.T) {
+	var captured map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		captured = nil
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&captured))
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`data: {"choices":[{"index":0,"delta":{"content":"Hi"}}]}
+
+data: {"id":"chatcmpl-1","model":"gpt-4o-2024-08-06","choices":[{"index":0,"delta":{},"finish_reason":"stop"}]}
+
+data: {"choices":[],"usage":{"prompt_tokens":20,"completion_tokens":1,"total_tokens":21,"prompt_tokens_details":{"cached_tokens":16}}}
+
+data: [DONE]
+`))
+	}))
+	defer server.Close()
+
+	provider, err := NewOpenAIProvider(&config.OpenAIConfig{BaseURL: server.URL, APIKey: "test-api-key"})
+	assert.NoError(t, err)
+
+	// Usage is not requested without a callback
+	_, err = provider.Ask(context.Background(), "test question")
+	assert.NoError(t, err)
+	assert.NotContains(t, captured, "stream_options")
+
+	var usage Usage
+	provider.(UsageReporter).SetUsageCallback(func(u Usage) { usage.Add(u) })
+	answer, err := provider.Ask(context.Background(), "test question")
+	assert.NoError(t, err)
+	assert.Equal(t, "Hi", answer)
+	assert.Equal(t, map[string]interface{}{"include_usage": true}, captured["stream_options"])
+	assert.Equal(t, Usage{PromptTokens: 20, CompletionTokens: 1, TotalTokens: 21, CachedTokens: 16}, usage)
+
+	var metadata Metadata
+	provider.(MetadataReporter).SetMetadataCallback(func(m Metadata) { metadata = m })
+	_, err = provider.Ask(context.Background(), "test question")
+	assert.NoError(t, err)
+	assert.Positive(t, metadata.TimeToFirstToken)
+	assert.GreaterOrEqual(t, metadata.Duration, metadata.TimeToFirstToken)
+	metadata.TimeToFirstToken, metadata.Duration = 0, 0
+	assert.Equal(t, Metadata{ID: "chatcmpl-1", Model: "gpt-4o-2024-08-06", FinishReason: "stop"}, metadata)
+}
+
+// TestOpenAIProviderStreamFormat tests reading streams with CRLF line ends,
+// comments, event fields and data fields split over several lines
+func TestOpenAIProviderStreamFormat(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte(": OPENROUTER PROCESSING\r\n\r\n" +
+			"event: message\r\nid: 1\r\ndata: {\"choices\":[{\"delta\":\r\ndata: {\"content\":\"Par\"}}]}\r\n\r\n" +
+			"data:{\"choices\":[{\"delta\":{\"content\":\"is\"}}]}\r\n\r\n" +
+			"data: [DONE]"))
+	}))
+	defer server.Close()
+
+	provider, err := NewOpenAIProvider(&config.OpenAIConfig{BaseURL: server.URL, APIKey: "test-api-key"})
+	require.NoError(t, err)
+
+	answer, err := provider.Ask(context.Background(), "capital of France?")
+	require.NoError(t, err)
+	assert.Equal(t, "Paris", answer)
+}
+
+// pipeTransport answers every request with a stream that is written to the
+// pipe and ignores the context of the request
+type pipeTransport struct{ body *io.PipeReader }
+
+// RoundTrip implements http.RoundTripper
+func (t pipeTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return &http.Response{StatusCode: http.StatusOK, Header: http.Header{"Content-Type": {"text/event-stream"}}, Body: t.body}, nil
+}
+
+// TestOpenAIProviderStreamCanceled tests that canceling the context ends a
+// stream that is waiting for the provider
+func TestOpenAIProviderStreamCanceled(t *testing.T) {
+	body, stream := io.Pipe()
+	t.Cleanup(func() { stream.Close() })
+
+	provider, err := NewOpenAIProvider(&config.OpenAIConfig{BaseURL: "http://localhost", APIKey: "test-api-key"})
+	require.NoError(t, err)
+	provider.(*openAIProvider).client.Transport = pipeTransport{body: body}
+
+	go stream.Write([]byte(`data: {"choices":[{"delta":{"content":"The capital "}}]}` + "\n\n"))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- provider.AskStream(ctx, "capital of France?", func(chunk string) error {
+			// The provider never sends the rest of the answer
+			cancel()
+			return nil
+		})
+	}()
+
+	select {
+	case err := <-done:
+		assert.ErrorIs(t, err, context.Canceled)
+		assert.NotErrorIs(t, err, ErrStreamInterrupted)
+	case <-time.After(5 * time.Second):
+		t.Fatal("the stream wasn't ended by canceling the context")
+	}
+}
+
+// TestOpenAIProviderHeaders tests that the custom headers are sent with every
+// request and replace those of si
+func TestOpenAIProviderHeaders(t *testing.T) {
+	var header http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte(`data: {"choices":[{"delta":{"content":"Paris"},"finish_reason":"stop"}]}` + "\n\ndata: [DONE]\n\n"))
+	}))
+	t.Cleanup(server.Close)
+
+	provider, err := NewOpenAIProvider(&config.OpenAIConfig{
+		BaseURL: server.URL,
+		APIKey:  "test-api-key",
+		Headers: map[string]string{"X-Org": "foo", "Authorization": "Token gateway-key"},
+	})
+	require.NoError(t, err)
+
+	_, err = provider.Ask(context.Background(), "capital of France?")
+	require.NoError(t, err)
+	assert.Equal(t, "foo", header.Get("X-Org"))
+	assert.Equal(t, "Token gateway-key", header.Get("Authorization"))
+	assert.Equal(t, "application/json", header.Get("Content-Type"))
+}
+
+// TestOpenAIProviderOrganization tests the organization and project headers
+func TestOpenAIProviderOrganization(t *testing.T) {
+	var header http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte(`data: {"choices":[{"delta":{"content":"Paris"},"finish_reason":"stop"}]}` + "\n\ndata: [DONE]\n\n"))
+	}))
+	t.Cleanup(server.Close)
+
+	ask := func(cfg *config.OpenAIConfig) {
+		provider, err := NewOpenAIProvider(cfg)
+		require.NoError(t, err)
+		_, err = provider.Ask(context.Background(), "capital of France?")
+		require.NoError(t, err)
+	}
+
+	ask(&config.OpenAIConfig{BaseURL: server.URL, APIKey: "test-api-key", OrganizationID: "org-1", ProjectID: "proj_1"})
+	assert.Equal(t, "org-1", header.Get("OpenAI-Organization"))
+	assert.Equal(t, "proj_1", header.Get("OpenAI-Project"))
+
+	// Unset IDs leave the key's defaults
+	ask(&config.OpenAIConfig{BaseURL: server.URL, APIKey: "test-api-key"})
+	assert.NotContains(t, header, "Openai-Organization")
+	assert.NotContains(t, header, "Openai-Project")
+
+	// Azure OpenAI doesn't take them
+	ask(&config.OpenAIConfig{BaseURL: server.URL, APIKey: "test-api-key", AzureDeploymentName: "gpt-4o", OrganizationID: "org-1"})
+	assert.NotContains(t, header, "Openai-Organization")
+}
+
+// TestOpenAIProviderRefusal tests reporting refusals and filtered answers
+func TestOpenAIProviderRefusal(t *testing.T) {
+	testCases := []struct {
+		name   string
+		stream string
+		err    string
+	}{
+		{
+			name:   "Refusal",
+			stream: `data: {"choices":[{"delta":{"refusal":"I can't "}}]}` + "\n\n" + `data: {"choices":[{"delta":{"refusal":"help with that."},"finish_reason":"stop"}]}` + "\n\ndata: [DONE]\n\n",
+			err:    "the model refused to answer: I can't help with that.",
+		},
+		{
+			name:   "Content filter",
+			stream: `data: {"choices":[{"delta":{},"finish_reason":"content_filter"}]}` + "\n\ndata: [DONE]\n\n",
+			err:    "the model refused to answer: the content filter of the provider stopped the answer",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "text/event-stream")
+				w.Write([]byte(tc.stream))
+			}))
+			t.Cleanup(server.Close)
+
+			provider, err := NewOpenAIProvider(&config.OpenAIConfig{BaseURL: server.URL, APIKey: "test-api-key"})
+			require.NoError(t, err)
+
+			_, err = provider.Ask(context.Background(), "capital of France?")
+			assert.EqualError(t, err, tc.err)
+			var refusal *RefusalError
+			assert.ErrorAs(t, err, &refusal)
+		})
+	}
+}
+
+// TestErrorClasses tests detecting rejected keys and rate limits
+func TestErrorClasses(t *testing.T) {
+	assert.True(t, IsUnauthorized(&APIError{StatusCode: http.StatusUnauthorized}))
+	assert.True(t, IsUnauthorized(fmt.Errorf("error asking question: %w", &APIError{StatusCode: http.StatusForbidden})))
+	assert.False(t, IsUnauthorized(&APIError{StatusCode: http.StatusTooManyRequests}))
+	assert.False(t, IsUnauthorized(assert.AnError))
+
+	assert.True(t, IsRateLimited(&APIError{StatusCode: http.StatusTooManyRequests, Code: "insufficient_quota"}))
+	assert.True(t, IsRateLimited(&StreamError{Code: "rate_limit_exceeded"}))
+	assert.False(t, IsRateLimited(&StreamError{Type: "server_error"}))
+	assert.False(t, IsRateLimited(&APIError{StatusCode: http.StatusServiceUnavailable}))
+	assert.False(t, IsRateLimited(assert.AnError))
+}
@@ -0,0 +1,164 @@
+package llm
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// Message roles
+const (
+	RoleSystem    = "system"
+	RoleUser      = "user"
+	RoleAssistant = "assistant"
+	RoleTool      = "tool"
+)
+
+// MaxImageSize is the largest image file that can be attached to a message
+const MaxImageSize = 20 * 1024 * 1024
+
+// Message is a single message of a conversation. A message either has plain
+// text content or, for multi-modal input, a list of content parts.
+type Message struct {
+	Role    string
+	Content string
+	Parts   []ContentPart
+
+	// ToolCalls are the tools an assistant message asks to call
+	ToolCalls []ToolCall
+
+	// ToolCallID is the call a tool message holds the result of
+	ToolCallID string
+}
+
+// ContentPart is one part of a multi-part message
+type ContentPart struct {
+	Type     string    `json:"type"`
+	Text     string    `json:"text,omitempty"`
+	ImageURL *ImageURL `json:"image_url,omitempty"`
+}
+
+// ImageURL references an image by URL or as a base64 data URL
+type ImageURL struct {
+	URL    string `json:"url"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// TextPart creates a text content part
+func TextPart(text string) ContentPart {
+	return ContentPart{Type: "text", Text: text}
+}
+
+// ImagePart creates an image content part referencing the given URL
+func ImagePart(url string) ContentPart {
+	return ContentPart{Type: "image_url", ImageURL: &ImageURL{URL: url}}
+}
+
+// LoadImage reads an image file and returns it as a content part with the
+// image embedded as a base64 data URL. HTTP(S) URLs are passed through as is.
+func LoadImage(path string) (ContentPart, error) {
+	if strings.HasPrefix(path, "http://") || strings.HasPrefix(path, "https://") {
+		return ImagePart(path), nil
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return ContentPart{}, fmt.Errorf("failed to read image: %w", err)
+	}
+	if info.Size() > MaxImageSize {
+		return ContentPart{}, fmt.Errorf("image %s is too large (%d bytes, maximum is %d)", path, info.Size(), MaxImageSize)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ContentPart{}, fmt.Errorf("failed to read image: %w", err)
+	}
+
+	mimeType := http.DetectContentType(data)
+	if !strings.HasPrefix(mimeType, "image/") {
+		return ContentPart{}, fmt.Errorf("%s is not an image (detected %s)", path, mimeType)
+	}
+
+	return ImagePart("data:" + mimeType + ";base64," + base64.StdEncoding.EncodeToString(data)), nil
+}
+
+// NewUserMessage creates a user message with the text and any extra content
+// parts, such as images
+func NewUserMessage(text string, parts ...ContentPart) Message {
+	if len(parts) == 0 {
+		return Message{Role: RoleUser, Content: text}
+	}
+
+	return Message{Role: RoleUser, Parts: append([]ContentPart{TextPart(text)}, parts...)}
+}
+
+// Text returns the text content of the message, joining the text parts of a
+// multi-part message
+func (m Message) Text() string {
+	if len(m.Parts) == 0 {
+		return m.Content
+	}
+
+	var texts []string
+	for _, part := range m.Parts {
+		if part.Type == "text" {
+			texts = append(texts, part.Text)
+		}
+	}
+	return strings.Join(texts, "\n")
+}
+
+// messageJSON is the wire format of a message, where the content is either a
+// string or a list of content parts
+type messageJSON struct {
+	Role       string          `json:"role"`
+	Content    json.RawMessage `json:"content"`
+	ToolCalls  []toolCallJSON  `json:"tool_calls,omitempty"`
+	ToolCallID string          `json:"tool_call_id,omitempty"`
+}
+
+// MarshalJSON encodes the content as a string, or as a list of parts for
+// multi-part messages. Assistant messages that only call tools have no
+// content.
+func (m Message) MarshalJSON() ([]byte, error) {
+	var content interface{} = m.Content
+	if len(m.Parts) > 0 {
+		content = m.Parts
+	} else if m.Content == "" && len(m.ToolCalls) > 0 {
+		content = nil
+	}
+
+	contentJSON, err := json.Marshal(content)
+	if err != nil {
+		return nil, err
+	}
+
+	raw := messageJSON{Role: m.Role, Content: contentJSON, ToolCallID: m.ToolCallID}
+	for _, call := range m.ToolCalls {
+		raw.ToolCalls = append(raw.ToolCalls, newToolCallJSON(call))
+	}
+	return json.Marshal(raw)
+}
+
+// UnmarshalJSON decodes messages with either string or multi-part content
+func (m *Message) UnmarshalJSON(data []byte) error {
+	var raw messageJSON
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	*m = Message{Role: raw.Role, ToolCallID: raw.ToolCallID}
+	for _, call := range raw.ToolCalls {
+		m.ToolCalls = append(m.ToolCalls, call.toolCall())
+	}
+	if len(raw.Content) == 0 || string(raw.Content) == "null" {
+		return nil
+	}
+	if raw.Content[0] == '[' {
+		return json.Unmarshal(raw.Content, &m.Parts)
+	}
+	return json.Unmarshal(raw.Content, &m.Content)
+}
@@ -0,0 +1,61 @@
+package llm
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestMessageJSON tests encoding plain and multi-part messages
+func TestMessageJSON(t *testing.T) {
+	data, err := json.Marshal(NewUserMessage("hello"))
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"role":"user","content":"hello"}`, string(data))
+
+	msg := NewUserMessage("what is this?", ImagePart("https://example.com/cat.png"))
+	data, err = json.Marshal(msg)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"role":"user","content":[
+		{"type":"text","text":"what is this?"},
+		{"type":"image_url","image_url":{"url":"https://example.com/cat.png"}}
+	]}`, string(data))
+
+	// Both content formats can be decoded again
+	var decoded Message
+	require.NoError(t, json.Unmarshal(data, &decoded))
+	assert.Equal(t, msg, decoded)
+	assert.Equal(t, "what is this?", decoded.Text())
+
+	require.NoError(t, json.Unmarshal([]byte(`{"role":"assistant","content":"a cat"}`), &decoded))
+	assert.Equal(t, Message{Role: RoleAssistant, Content: "a cat"}, decoded)
+}
+
+// TestLoadImage tests loading images as data URLs
+func TestLoadImage(t *testing.T) {
+	dir := t.TempDir()
+
+	pngPath := filepath.Join(dir, "image.png")
+	require.NoError(t, os.WriteFile(pngPath, []byte("\x89PNG\r\n\x1a\n"), 0644))
+	part, err := LoadImage(pngPath)
+	require.NoError(t, err)
+	assert.Equal(t, "image_url", part.Type)
+	assert.Equal(t, "data:image/png;base64,iVBORw0KGgo=", part.ImageURL.URL)
+
+	// URLs are passed through
+	part, err = LoadImage("https://example.com/cat.png")
+	require.NoError(t, err)
+	assert.Equal(t, "https://example.com/cat.png", part.ImageURL.URL)
+
+	// Other files are rejected
+	textPath := filepath.Join(dir, "notes.txt")
+	require.NoError(t, os.WriteFile(textPath, []byte("hello"), 0644))
+	_, err = LoadImage(textPath)
+	assert.ErrorContains(t, err, "is not an image")
+
+	_, err = LoadImage(filepath.Join(dir, "missing.png"))
+	assert.ErrorContains(t, err, "failed to read image")
+}
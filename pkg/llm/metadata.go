@@ -0,0 +1,37 @@
+package llm
+
+import "time"
+
+// Metadata describes a completed response
+type Metadata struct {
+	// ID is the identifier the provider assigned to the response
+	ID string `json:"id,omitempty"`
+
+	// Model is the model that generated the response, as reported by the
+	// provider; it may be more specific than the requested model
+	Model string `json:"model,omitempty"`
+
+	// Provider is the upstream provider a router like OpenRouter sent the
+	// request to, e.g. "Azure"; empty for providers serving their own models
+	Provider string `json:"provider,omitempty"`
+
+	// FinishReason tells why the model stopped generating, e.g. "stop" or
+	// "length" when the token limit was reached
+	FinishReason string `json:"finish_reason,omitempty"`
+
+	// TimeToFirstToken is the time from sending the request until the first
+	// chunk of the answer arrived, including retries; zero if the response
+	// had no content
+	TimeToFirstToken time.Duration `json:"-"`
+
+	// Duration is the time from sending the request until the response was
+	// complete
+	Duration time.Duration `json:"-"`
+}
+
+// MetadataReporter is implemented by providers that report response metadata
+type MetadataReporter interface {
+	// SetMetadataCallback installs a callback that receives the metadata of
+	// every completed response
+	SetMetadataCallback(callback func(Metadata))
+}
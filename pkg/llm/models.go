@@ -0,0 +1,100 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/Turee/si/pkg/config"
+)
+
+// Model describes a model available from the provider
+type Model struct {
+	// ID is the name of the model in requests
+	ID string `json:"id"`
+
+	// OwnedBy is the organization that owns the model, if reported
+	OwnedBy string `json:"owned_by,omitempty"`
+
+	// ContextWindow is the context window in tokens the provider reported,
+	// or zero
+	ContextWindow int `json:"context_window,omitempty"`
+}
+
+// ModelDescriber is implemented by providers that can list the available
+// models with their details
+type ModelDescriber interface {
+	// DescribeModels returns the models available to the user, sorted by ID
+	DescribeModels(ctx context.Context) ([]Model, error)
+}
+
+// ListModels implements the ModelLister interface
+func (p *openAIProvider) ListModels(ctx context.Context) ([]string, error) {
+	if p.cfg.AzureDeploymentName != "" {
+		return nil, fmt.Errorf("listing models is not supported for Azure deployments")
+	}
+
+	described, err := p.DescribeModels(ctx)
+	if err != nil {
+		return nil, err
+	}
+	models := make([]string, 0, len(described))
+	for _, model := range described {
+		models = append(models, model.ID)
+	}
+	return models, nil
+}
+
+// DescribeModels implements the ModelDescriber interface. For Azure OpenAI,
+// it lists the models of the resource rather than its deployments.
+func (p *openAIProvider) DescribeModels(ctx context.Context) ([]Model, error) {
+	baseURL := p.cfg.BaseURL
+	if baseURL == "" {
+		baseURL = config.DefaultBaseURL
+	}
+
+	endpoint := p.endpoint(baseURL, "models")
+	if p.cfg.AzureDeploymentName != "" {
+		endpoint = fmt.Sprintf("%s/openai/models?api-version=%s", strings.TrimSuffix(baseURL, "/"), url.QueryEscape(p.cfg.AzureVersion()))
+	}
+
+	resp, err := doWithRetry(ctx, p.client, p.cfg.Retry, func() (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, "GET", endpoint, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create request: %w", err)
+		}
+		p.setHeaders(req)
+		return req, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	// Providers that report the context window name it differently
+	var modelsResp struct {
+		Data []struct {
+			ID               string `json:"id"`
+			OwnedBy          string `json:"owned_by"`
+			ContextLength    int    `json:"context_length"`     // OpenRouter, Together
+			ContextWindow    int    `json:"context_window"`     // Groq
+			MaxModelLen      int    `json:"max_model_len"`      // vLLM
+			MaxContextLength int    `json:"max_context_length"` // LM Studio
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&modelsResp); err != nil {
+		return nil, fmt.Errorf("error parsing response: %w", err)
+	}
+
+	models := make([]Model, 0, len(modelsResp.Data))
+	for _, model := range modelsResp.Data {
+		window := max(model.ContextLength, model.ContextWindow, model.MaxModelLen, model.MaxContextLength)
+		models = append(models, Model{ID: model.ID, OwnedBy: model.OwnedBy, ContextWindow: window})
+	}
+	sort.Slice(models, func(i, j int) bool { return models[i].ID < models[j].ID })
+	return models, nil
+}
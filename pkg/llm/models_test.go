@@ -0,0 +1,55 @@
+package llm
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Turee/si/pkg/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestDescribeModels tests reading the context windows of the models in the
+// formats of several providers
+func TestDescribeModels(t *testing.T) {
+	var path, query string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path, query = r.URL.Path, r.URL.RawQuery
+		w.Write([]byte(`{"object":"list","data":[
+			{"id":"qwen2.5-coder","owned_by":"vllm","max_model_len":32768},
+			{"id":"gpt-4o","owned_by":"system"},
+			{"id":"meta-llama/llama-3.3-70b","context_length":131072},
+			{"id":"llama-3.1-8b-instant","owned_by":"Meta","context_window":131072},
+			{"id":"phi-4","max_context_length":16384}
+		]}`))
+	}))
+	t.Cleanup(server.Close)
+
+	provider, err := NewOpenAIProvider(&config.OpenAIConfig{BaseURL: server.URL + "/v1", APIKey: "test-api-key"})
+	require.NoError(t, err)
+
+	models, err := provider.(ModelDescriber).DescribeModels(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "/v1/models", path)
+	assert.Equal(t, []Model{
+		{ID: "gpt-4o", OwnedBy: "system"},
+		{ID: "llama-3.1-8b-instant", OwnedBy: "Meta", ContextWindow: 131072},
+		{ID: "meta-llama/llama-3.3-70b", ContextWindow: 131072},
+		{ID: "phi-4", ContextWindow: 16384},
+		{ID: "qwen2.5-coder", OwnedBy: "vllm", ContextWindow: 32768},
+	}, models)
+
+	// Azure OpenAI lists the models of the resource
+	provider, err = NewOpenAIProvider(&config.OpenAIConfig{BaseURL: server.URL, APIKey: "test-api-key", AzureDeploymentName: "gpt-4o"})
+	require.NoError(t, err)
+	_, err = provider.(ModelDescriber).DescribeModels(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "/openai/models", path)
+	assert.Equal(t, "api-version="+config.DefaultAzureAPIVersion, query)
+
+	// Picking a model doesn't apply to deployments
+	_, err = provider.(ModelLister).ListModels(context.Background())
+	assert.ErrorContains(t, err, "not supported for Azure deployments")
+}
@@ -0,0 +1,45 @@
+package llm
+
+import "net/http"
+
+// The attribution of requests to OpenRouter unless openrouter.site_url and
+// openrouter.app_name are set
+const (
+	openRouterSiteURL = "https://github.com/Turee/si"
+	openRouterAppName = "si"
+)
+
+// providerPreferences tells OpenRouter which upstream providers to route a
+// request to
+type providerPreferences struct {
+	Order          []string `json:"order,omitempty"`
+	AllowFallbacks *bool    `json:"allow_fallbacks,omitempty"`
+}
+
+// providerPreferences returns the routing preferences of requests to
+// OpenRouter, or nil if there are none
+func (p *openAIProvider) providerPreferences() *providerPreferences {
+	cfg := p.cfg.OpenRouter
+	if !p.cfg.IsOpenRouter() || (len(cfg.Providers) == 0 && cfg.AllowFallbacks == nil) {
+		return nil
+	}
+	return &providerPreferences{Order: cfg.Providers, AllowFallbacks: cfg.AllowFallbacks}
+}
+
+// setOpenRouterHeaders sets the headers OpenRouter attributes requests to
+// applications by
+func (p *openAIProvider) setOpenRouterHeaders(req *http.Request) {
+	if !p.cfg.IsOpenRouter() {
+		return
+	}
+
+	siteURL, appName := p.cfg.OpenRouter.SiteURL, p.cfg.OpenRouter.AppName
+	if siteURL == "" {
+		siteURL = openRouterSiteURL
+	}
+	if appName == "" {
+		appName = openRouterAppName
+	}
+	req.Header.Set("HTTP-Referer", siteURL)
+	req.Header.Set("X-Title", appName)
+}
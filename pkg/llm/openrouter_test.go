@@ -0,0 +1,91 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/Turee/si/pkg/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// redirectTransport sends all requests to a test server
+type redirectTransport struct {
+	target *url.URL
+}
+
+// RoundTrip implements http.RoundTripper
+func (t redirectTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.URL.Scheme, req.URL.Host = t.target.Scheme, t.target.Host
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+// TestOpenRouter tests the attribution headers, the provider routing and the
+// route metadata of requests to OpenRouter
+func TestOpenRouter(t *testing.T) {
+	var header http.Header
+	var captured map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header
+		body, _ := io.ReadAll(r.Body)
+		require.NoError(t, json.Unmarshal(body, &captured))
+		assert.Equal(t, "/api/v1/chat/completions", r.URL.Path)
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		io.WriteString(w, `data: {"id":"gen-1","provider":"Azure","model":"openai/gpt-4o","choices":[{"index":0,"delta":{"content":"Hi"}}]}
+
+data: {"id":"gen-1","provider":"Azure","model":"openai/gpt-4o","choices":[{"index":0,"delta":{},"finish_reason":"stop"}]}
+
+data: [DONE]
+`)
+	}))
+	defer server.Close()
+	target, err := url.Parse(server.URL)
+	require.NoError(t, err)
+
+	allowFallbacks := false
+	provider, err := NewOpenAIProvider(&config.OpenAIConfig{
+		BaseURL:   config.OpenRouterBaseURL,
+		APIKey:    "sk-or-test",
+		ModelName: "openai/gpt-4o",
+		OpenRouter: config.OpenRouterConfig{
+			AppName:        "my-tool",
+			Providers:      []string{"Azure", "OpenAI"},
+			AllowFallbacks: &allowFallbacks,
+		},
+	})
+	require.NoError(t, err)
+	provider.(*openAIProvider).client = &http.Client{Transport: redirectTransport{target}}
+
+	var metadata Metadata
+	provider.(MetadataReporter).SetMetadataCallback(func(m Metadata) { metadata = m })
+	answer, err := provider.Ask(context.Background(), "test question")
+	require.NoError(t, err)
+	assert.Equal(t, "Hi", answer)
+
+	assert.Equal(t, "Bearer sk-or-test", header.Get("Authorization"))
+	assert.Equal(t, "https://github.com/Turee/si", header.Get("HTTP-Referer"))
+	assert.Equal(t, "my-tool", header.Get("X-Title"))
+	assert.Equal(t, "openai/gpt-4o", captured["model"])
+	assert.Equal(t, map[string]interface{}{"order": []interface{}{"Azure", "OpenAI"}, "allow_fallbacks": false}, captured["provider"])
+	assert.Equal(t, "Azure", metadata.Provider)
+	assert.Equal(t, "openai/gpt-4o", metadata.Model)
+}
+
+// TestNotOpenRouter tests that other providers get no OpenRouter headers
+func TestNotOpenRouter(t *testing.T) {
+	provider, err := NewOpenAIProvider(&config.OpenAIConfig{APIKey: "test-api-key"})
+	require.NoError(t, err)
+
+	req := httptest.NewRequest("POST", config.DefaultBaseURL, nil)
+	provider.(*openAIProvider).setHeaders(req)
+	assert.Empty(t, req.Header.Get("HTTP-Referer"))
+	assert.Empty(t, req.Header.Get("X-Title"))
+	assert.Nil(t, provider.(*openAIProvider).providerPreferences())
+}
@@ -0,0 +1,127 @@
+package llm
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/Turee/si/pkg/config"
+	"github.com/Turee/si/pkg/logging"
+)
+
+// now returns the current time. It is a variable so tests can move the
+// clock of the rate limits.
+var now = time.Now
+
+// rateWindow is the period the rate limits apply to
+const rateWindow = time.Minute
+
+// rateLimiters holds one limiter per base URL and limits, so every provider
+// instance talking to the same provider shares the same quota
+var (
+	rateLimitersMu sync.Mutex
+	rateLimiters   = map[string]*rateLimiter{}
+)
+
+// rateLimiter keeps the requests and tokens sent to a provider within the
+// limits of a sliding window of one minute. It is safe for concurrent use.
+type rateLimiter struct {
+	limits config.RateLimitConfig
+
+	mu sync.Mutex
+	// sent are the requests of the last minute
+	sent []*sentRequest
+}
+
+// sentRequest is a request counted by the limiter
+type sentRequest struct {
+	at     time.Time
+	tokens int
+}
+
+// sharedRateLimiter returns the limiter of the base URL, or nil if no
+// limits are configured
+func sharedRateLimiter(baseURL string, limits config.RateLimitConfig) *rateLimiter {
+	if limits.RequestsPerMinute <= 0 && limits.TokensPerMinute <= 0 {
+		return nil
+	}
+
+	key := fmt.Sprintf("%s#%d#%d", baseURL, limits.RequestsPerMinute, limits.TokensPerMinute)
+
+	rateLimitersMu.Lock()
+	defer rateLimitersMu.Unlock()
+	limiter, ok := rateLimiters[key]
+	if !ok {
+		limiter = &rateLimiter{limits: limits}
+		rateLimiters[key] = limiter
+	}
+	return limiter
+}
+
+// wait blocks until a request of the estimated number of tokens fits into
+// the limits and counts it. The returned function replaces the estimate
+// with the actual number of tokens once the provider reported them. A nil
+// limiter never waits.
+func (l *rateLimiter) wait(ctx context.Context, tokens int) (func(actual int), error) {
+	if l == nil {
+		return func(int) {}, nil
+	}
+
+	for {
+		request, delay := l.reserve(tokens)
+		if request != nil {
+			return func(actual int) {
+				l.mu.Lock()
+				defer l.mu.Unlock()
+				request.tokens = actual
+			}, nil
+		}
+
+		logging.Logger().Info("waiting for the rate limit", "wait", delay)
+		if err := sleep(ctx, delay); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// reserve counts the request if it fits into the limits, or returns how long
+// to wait until requests of the last minute make room for it. A request
+// with more tokens than the limit is sent once no other tokens are counted.
+func (l *rateLimiter) reserve(tokens int) (*sentRequest, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	current := now()
+	for len(l.sent) > 0 && current.Sub(l.sent[0].at) >= rateWindow {
+		l.sent = l.sent[1:]
+	}
+
+	var delay time.Duration
+	if limit := l.limits.RequestsPerMinute; limit > 0 && len(l.sent) >= limit {
+		delay = l.sent[len(l.sent)-limit].at.Add(rateWindow).Sub(current)
+	}
+
+	if limit := l.limits.TokensPerMinute; limit > 0 {
+		used := 0
+		for _, request := range l.sent {
+			used += request.tokens
+		}
+		// Wait for the oldest requests to leave the window until the
+		// tokens fit
+		for _, request := range l.sent {
+			if used+tokens <= limit || used == 0 {
+				break
+			}
+			used -= request.tokens
+			delay = max(delay, request.at.Add(rateWindow).Sub(current))
+		}
+	}
+
+	if delay > 0 {
+		return nil, delay
+	}
+	request := &sentRequest{at: current, tokens: tokens}
+	l.sent = append(l.sent, request)
+	return request, 0
+}
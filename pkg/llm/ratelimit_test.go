@@ -0,0 +1,107 @@
+package llm
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Turee/si/pkg/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// mockClock replaces the clock with one that only moves when sleeping and
+// records the waits
+func mockClock(t *testing.T) *[]time.Duration {
+	current := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	var waits []time.Duration
+
+	oldNow, oldSleep := now, sleep
+	t.Cleanup(func() { now, sleep = oldNow, oldSleep })
+	now = func() time.Time { return current }
+	sleep = func(ctx context.Context, d time.Duration) error {
+		waits = append(waits, d)
+		current = current.Add(d)
+		return ctx.Err()
+	}
+	return &waits
+}
+
+// TestRequestsPerMinute tests that requests wait until the oldest request of
+// the last minute leaves the window
+func TestRequestsPerMinute(t *testing.T) {
+	waits := mockClock(t)
+	limiter := &rateLimiter{limits: config.RateLimitConfig{RequestsPerMinute: 2}}
+
+	for i := 0; i < 2; i++ {
+		_, err := limiter.wait(context.Background(), 0)
+		require.NoError(t, err)
+	}
+	assert.Empty(t, *waits)
+
+	_, err := limiter.wait(context.Background(), 0)
+	require.NoError(t, err)
+	assert.Equal(t, []time.Duration{time.Minute}, *waits)
+}
+
+// TestTokensPerMinute tests that requests wait until their tokens fit, and
+// that the estimate is replaced by the reported usage
+func TestTokensPerMinute(t *testing.T) {
+	waits := mockClock(t)
+	limiter := &rateLimiter{limits: config.RateLimitConfig{TokensPerMinute: 1000}}
+
+	count, err := limiter.wait(context.Background(), 900)
+	require.NoError(t, err)
+
+	// The answer was shorter than estimated
+	count(300)
+	_, err = limiter.wait(context.Background(), 600)
+	require.NoError(t, err)
+	assert.Empty(t, *waits)
+
+	sleep(context.Background(), 10*time.Second)
+	_, err = limiter.wait(context.Background(), 500)
+	require.NoError(t, err)
+	assert.Equal(t, []time.Duration{10 * time.Second, 50 * time.Second}, *waits)
+
+	// Requests over the limit are sent when no other tokens are counted
+	_, err = limiter.wait(context.Background(), 5000)
+	require.NoError(t, err)
+	assert.Equal(t, []time.Duration{10 * time.Second, 50 * time.Second, time.Minute}, *waits)
+}
+
+// TestRateLimitCanceled tests that waiting ends with the context
+func TestRateLimitCanceled(t *testing.T) {
+	mockClock(t)
+	limiter := &rateLimiter{limits: config.RateLimitConfig{RequestsPerMinute: 1}}
+	_, err := limiter.wait(context.Background(), 0)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = limiter.wait(ctx, 0)
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+// TestRateLimitedProvider tests that the requests of providers of the same
+// endpoint share the limits
+func TestRateLimitedProvider(t *testing.T) {
+	waits := mockClock(t)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte("data: {\"choices\":[{\"delta\":{\"content\":\"Paris\"}}]}\n\ndata: [DONE]\n\n"))
+	}))
+	t.Cleanup(server.Close)
+
+	cfg := &config.OpenAIConfig{BaseURL: server.URL, APIKey: "test-api-key", RateLimit: config.RateLimitConfig{RequestsPerMinute: 1}}
+	for i := 0; i < 2; i++ {
+		provider, err := NewOpenAIProvider(cfg)
+		require.NoError(t, err)
+		answer, err := provider.Ask(context.Background(), "capital of France?")
+		require.NoError(t, err)
+		assert.Equal(t, "Paris", answer)
+	}
+	assert.Equal(t, []time.Duration{time.Minute}, *waits)
+}
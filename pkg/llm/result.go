@@ -0,0 +1,52 @@
+package llm
+
+import (
+	"context"
+	"strings"
+)
+
+// Result is an answer together with what the provider reported about it
+type Result struct {
+	// Text is the answer
+	Text string
+
+	// Usage is the token usage of the request, or nil if the provider didn't
+	// report it
+	Usage *Usage
+
+	// Metadata has the ID of the response, the model that answered and the
+	// finish reason
+	Metadata
+}
+
+// ResultProvider is implemented by providers that return the usage and
+// metadata of an answer along with its text
+type ResultProvider interface {
+	// ChatResult sends a conversation to the LLM and returns the answer with
+	// its usage and metadata. The answer is streamed to the callback unless
+	// it is nil.
+	ChatResult(ctx context.Context, messages []Message, callback func(chunk string) error) (*Result, error)
+}
+
+// AskWithResult sends the conversation to the provider and returns the
+// answer with its usage, finish reason, model and response ID. The answer is
+// streamed to the callback unless it is nil. For providers that don't
+// report these, the result only has the text.
+func AskWithResult(ctx context.Context, provider Provider, messages []Message, callback func(chunk string) error) (*Result, error) {
+	if resulter, ok := provider.(ResultProvider); ok {
+		return resulter.ChatResult(ctx, messages, callback)
+	}
+
+	var text strings.Builder
+	err := provider.ChatStream(ctx, messages, func(chunk string) error {
+		text.WriteString(chunk)
+		if callback == nil {
+			return nil
+		}
+		return callback(chunk)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &Result{Text: text.String()}, nil
+}
@@ -0,0 +1,84 @@
+package llm
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Turee/si/pkg/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// textProvider streams a fixed answer and reports nothing else
+type textProvider struct{ answer string }
+
+// Ask implements the Provider interface
+func (p *textProvider) Ask(ctx context.Context, question string) (string, error) {
+	return p.answer, nil
+}
+
+// AskStream implements the Provider interface
+func (p *textProvider) AskStream(ctx context.Context, question string, callback func(chunk string) error) error {
+	return callback(p.answer)
+}
+
+// Chat implements the Provider interface
+func (p *textProvider) Chat(ctx context.Context, messages []Message) (string, error) {
+	return p.answer, nil
+}
+
+// ChatStream implements the Provider interface
+func (p *textProvider) ChatStream(ctx context.Context, messages []Message, callback func(chunk string) error) error {
+	return callback(p.answer)
+}
+
+// TestAskWithResult tests returning the usage and metadata with the answer
+func TestAskWithResult(t *testing.T) {
+	var body string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		request, _ := io.ReadAll(r.Body)
+		body = string(request)
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte(`data: {"id":"chatcmpl-1","model":"gpt-4o-2024-08-06","choices":[{"delta":{"content":"Par"}}]}` + "\n\n"))
+		w.Write([]byte(`data: {"id":"chatcmpl-1","choices":[{"delta":{"content":"is"},"finish_reason":"stop"}]}` + "\n\n"))
+		w.Write([]byte(`data: {"id":"chatcmpl-1","choices":[],"usage":{"prompt_tokens":12,"completion_tokens":2,"total_tokens":14}}` + "\n\n"))
+		w.Write([]byte("data: [DONE]\n\n"))
+	}))
+	t.Cleanup(server.Close)
+
+	provider, err := NewOpenAIProvider(&config.OpenAIConfig{BaseURL: server.URL, APIKey: "test-api-key"})
+	require.NoError(t, err)
+
+	var chunks []string
+	result, err := AskWithResult(context.Background(), provider, []Message{NewUserMessage("capital of France?")}, func(chunk string) error {
+		chunks = append(chunks, chunk)
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "Paris", result.Text)
+	assert.Equal(t, []string{"Par", "is"}, chunks)
+	assert.Equal(t, &Usage{PromptTokens: 12, CompletionTokens: 2, TotalTokens: 14}, result.Usage)
+	assert.Equal(t, "chatcmpl-1", result.ID)
+	assert.Equal(t, "gpt-4o-2024-08-06", result.Model)
+	assert.Equal(t, "stop", result.FinishReason)
+	assert.Positive(t, result.Duration)
+
+	// The usage is requested without a usage callback
+	assert.Contains(t, body, `"include_usage":true`)
+
+	// Without a callback, the answer is only returned
+	result, err = AskWithResult(context.Background(), provider, []Message{NewUserMessage("capital of France?")}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "Paris", result.Text)
+}
+
+// TestAskWithResultText tests the result of providers that only return text
+func TestAskWithResultText(t *testing.T) {
+	result, err := AskWithResult(context.Background(), &textProvider{answer: "Paris"}, []Message{NewUserMessage("capital of France?")}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, &Result{Text: "Paris"}, result)
+}
@@ -0,0 +1,162 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/Turee/si/pkg/config"
+	"github.com/Turee/si/pkg/logging"
+)
+
+// sleep waits for the duration or until the context is done. It is a
+// variable so tests don't have to wait.
+var sleep = func(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// doWithRetry sends the request created by newRequest and retries it when it
+// fails with a transient error, as configured by policy. Only successful
+// responses are returned; error responses are returned as *APIError. Since
+// nothing has been read from the response when a request is retried, a
+// partially streamed answer is never repeated.
+func doWithRetry(ctx context.Context, client *http.Client, policy config.RetryConfig, newRequest func() (*http.Request, error)) (*http.Response, error) {
+	var attempts int
+	return doWithAttempts(ctx, client, policy, &attempts, newRequest)
+}
+
+// doWithAttempts is doWithRetry for requests that are also repeated for
+// other reasons, such as interrupted streams. attempts counts the requests
+// sent so far, so all repetitions share the retries of the policy.
+func doWithAttempts(ctx context.Context, client *http.Client, policy config.RetryConfig, attempts *int, newRequest func() (*http.Request, error)) (*http.Response, error) {
+	for {
+		*attempts++
+		attempt := *attempts
+
+		req, err := newRequest()
+		if err != nil {
+			return nil, err
+		}
+
+		resp, err := client.Do(req)
+		if err == nil && resp.StatusCode == http.StatusOK {
+			return resp, nil
+		}
+
+		wait := backoff(policy, attempt)
+		if err != nil {
+			err = fmt.Errorf("failed to send request: %w", err)
+			if ctx.Err() != nil {
+				return nil, err
+			}
+		} else {
+			apiErr := newAPIError(resp)
+			resp.Body.Close()
+			err = apiErr
+
+			if !isRetryableStatus(resp.StatusCode) {
+				return nil, err
+			}
+			if after, ok := retryAfter(resp.Header); ok {
+				if after > policy.BackoffLimit() {
+					return nil, fmt.Errorf("%w (retry after %s)", err, after)
+				}
+				wait = after
+			}
+		}
+
+		if attempt > policy.Retries() {
+			return nil, giveUp(err, attempt)
+		}
+
+		logging.Logger().Info("retrying request", "attempt", attempt, "wait", wait, "error", err)
+		if sleepErr := sleep(ctx, wait); sleepErr != nil {
+			return nil, fmt.Errorf("%w (retry canceled: %w)", err, sleepErr)
+		}
+	}
+}
+
+// giveUp annotates the error of the last attempt with the number of attempts
+func giveUp(err error, attempts int) error {
+	if attempts == 1 {
+		return err
+	}
+	return fmt.Errorf("%w (gave up after %d attempts)", err, attempts)
+}
+
+// isRetryableStatus reports whether a request that failed with the status
+// may succeed when it is repeated
+func isRetryableStatus(status int) bool {
+	switch status {
+	case http.StatusTooManyRequests, http.StatusInternalServerError, http.StatusBadGateway,
+		http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// backoff returns the wait before retrying after the given attempt, doubling
+// the initial backoff with every attempt up to the limit
+func backoff(policy config.RetryConfig, attempt int) time.Duration {
+	wait := policy.InitialBackoff()
+	for i := 1; i < attempt && wait < policy.BackoffLimit(); i++ {
+		wait *= 2
+	}
+	return min(wait, policy.BackoffLimit())
+}
+
+// retryAfter parses the Retry-After header, which is either a number of
+// seconds or an HTTP date
+func retryAfter(header http.Header) (time.Duration, bool) {
+	value := header.Get("Retry-After")
+	if value == "" {
+		return 0, false
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+
+	if date, err := http.ParseTime(value); err == nil {
+		return max(time.Until(date), 0), true
+	}
+
+	return 0, false
+}
+
+// IsUnavailable reports whether err means the provider is rate limited,
+// overloaded or can't be reached, even after retrying, so another provider
+// may answer instead. Errors of the stream count if repeating the request
+// may succeed, but only before any part of the answer is received, and
+// canceled requests never count.
+func IsUnavailable(err error) bool {
+	var partialErr *partialError
+	if err == nil || errors.Is(err, context.Canceled) || errors.As(err, &partialErr) {
+		return false
+	}
+
+	var streamErr *StreamError
+	if errors.Is(err, ErrStreamInterrupted) || errors.As(err, &streamErr) && streamErr.Temporary() {
+		return true
+	}
+
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return isRetryableStatus(apiErr.StatusCode)
+	}
+
+	var urlErr *url.Error
+	return errors.As(err, &urlErr)
+}
@@ -0,0 +1,442 @@
+package llm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/Turee/si/pkg/config"
+	"github.com/Turee/si/pkg/logging"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// mockSleep records the waits between attempts instead of sleeping
+func mockSleep(t *testing.T) *[]time.Duration {
+	var waits []time.Duration
+	old := sleep
+	t.Cleanup(func() { sleep = old })
+	sleep = func(ctx context.Context, d time.Duration) error {
+		waits = append(waits, d)
+		return ctx.Err()
+	}
+	return &waits
+}
+
+// failingServer responds with the given statuses before answering normally
+func failingServer(t *testing.T, header http.Header, statuses ...int) (*httptest.Server, *int) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests <= len(statuses) {
+			for key, values := range header {
+				w.Header()[key] = values
+			}
+			w.WriteHeader(statuses[requests-1])
+			w.Write([]byte(`{"error":{"message":"try again"}}`))
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte("data: {\"choices\":[{\"delta\":{\"content\":\"Paris\"}}]}\n\ndata: [DONE]\n\n"))
+	}))
+	t.Cleanup(server.Close)
+	return server, &requests
+}
+
+// TestRetryTransientErrors tests that rate limits and server errors are retried with backoff
+func TestRetryTransientErrors(t *testing.T) {
+	waits := mockSleep(t)
+	server, requests := failingServer(t, nil, http.StatusTooManyRequests, http.StatusServiceUnavailable)
+
+	provider, err := NewOpenAIProvider(&config.OpenAIConfig{BaseURL: server.URL, APIKey: "test-api-key"})
+	require.NoError(t, err)
+
+	answer, err := provider.Ask(context.Background(), "capital of France?")
+	require.NoError(t, err)
+	assert.Equal(t, "Paris", answer)
+	assert.Equal(t, 3, *requests)
+	assert.Equal(t, []time.Duration{time.Second, 2 * time.Second}, *waits)
+}
+
+// TestRetryLogged tests that the requests and retries are in the debug log
+// without the API key
+func TestRetryLogged(t *testing.T) {
+	mockSleep(t)
+	server, _ := failingServer(t, nil, http.StatusTooManyRequests)
+
+	var log bytes.Buffer
+	require.NoError(t, logging.Setup(logging.LevelDebug, &log))
+	defer logging.Setup("", nil)
+
+	provider, err := NewOpenAIProvider(&config.OpenAIConfig{BaseURL: server.URL, APIKey: "test-api-key"})
+	require.NoError(t, err)
+	_, err = provider.Ask(context.Background(), "capital of France?")
+	require.NoError(t, err)
+
+	assert.Contains(t, log.String(), "status=429")
+	assert.Contains(t, log.String(), `msg="retrying request" attempt=1 wait=1s`)
+	assert.Contains(t, log.String(), "capital of France?")
+	assert.Contains(t, log.String(), `msg="sse event"`)
+	assert.NotContains(t, log.String(), "test-api-key")
+}
+
+// TestRetryGivesUp tests that the last error is returned when the retries are used up
+func TestRetryGivesUp(t *testing.T) {
+	mockSleep(t)
+	server, requests := failingServer(t, nil, 500, 500, 500, 500)
+
+	retries := 1
+	provider, err := NewOpenAIProvider(&config.OpenAIConfig{
+		BaseURL: server.URL,
+		APIKey:  "test-api-key",
+		Retry:   config.RetryConfig{MaxRetries: &retries},
+	})
+	require.NoError(t, err)
+
+	_, err = provider.Ask(context.Background(), "capital of France?")
+	assert.EqualError(t, err, `API request failed with status 500: {"error":{"message":"try again"}} (gave up after 2 attempts)`)
+	assert.Equal(t, 2, *requests)
+
+	var apiErr *APIError
+	assert.ErrorAs(t, err, &apiErr)
+}
+
+// TestRetryNotRetryable tests that client errors fail immediately
+func TestRetryNotRetryable(t *testing.T) {
+	waits := mockSleep(t)
+	server, requests := failingServer(t, nil, http.StatusUnauthorized)
+
+	provider, err := NewOpenAIProvider(&config.OpenAIConfig{BaseURL: server.URL, APIKey: "test-api-key"})
+	require.NoError(t, err)
+
+	_, err = provider.Ask(context.Background(), "capital of France?")
+	assert.EqualError(t, err, `API request failed with status 401: {"error":{"message":"try again"}}`)
+	assert.Equal(t, 1, *requests)
+	assert.Empty(t, *waits)
+}
+
+// TestRetryAfter tests that the Retry-After header sets the wait
+func TestRetryAfter(t *testing.T) {
+	waits := mockSleep(t)
+	server, _ := failingServer(t, http.Header{"Retry-After": {"7"}}, http.StatusTooManyRequests)
+
+	provider, err := NewOpenAIProvider(&config.OpenAIConfig{BaseURL: server.URL, APIKey: "test-api-key"})
+	require.NoError(t, err)
+
+	_, err = provider.Ask(context.Background(), "capital of France?")
+	require.NoError(t, err)
+	assert.Equal(t, []time.Duration{7 * time.Second}, *waits)
+
+	// Waits longer than the maximum backoff are not sat out
+	server, requests := failingServer(t, http.Header{"Retry-After": {"3600"}}, http.StatusTooManyRequests)
+	provider, err = NewOpenAIProvider(&config.OpenAIConfig{BaseURL: server.URL, APIKey: "test-api-key"})
+	require.NoError(t, err)
+
+	_, err = provider.Ask(context.Background(), "capital of France?")
+	assert.ErrorContains(t, err, "(retry after 1h0m0s)")
+	assert.Equal(t, 1, *requests)
+}
+
+// TestBackoff tests that the backoff doubles up to the limit
+func TestBackoff(t *testing.T) {
+	policy := config.RetryConfig{Backoff: time.Second, MaxBackoff: 5 * time.Second}
+	assert.Equal(t, time.Second, backoff(policy, 1))
+	assert.Equal(t, 2*time.Second, backoff(policy, 2))
+	assert.Equal(t, 4*time.Second, backoff(policy, 3))
+	assert.Equal(t, 5*time.Second, backoff(policy, 4))
+	assert.Equal(t, 5*time.Second, backoff(policy, 40))
+
+	wait, ok := retryAfter(http.Header{"Retry-After": {time.Now().Add(-time.Minute).UTC().Format(http.TimeFormat)}})
+	assert.True(t, ok)
+	assert.Equal(t, time.Duration(0), wait)
+
+	_, ok = retryAfter(http.Header{"Retry-After": {"soon"}})
+	assert.False(t, ok)
+}
+
+// streamServer responds to successive requests with the given streams
+func streamServer(t *testing.T, streams ...string) (*httptest.Server, *int) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte(streams[min(requests, len(streams)-1)]))
+		requests++
+	}))
+	t.Cleanup(server.Close)
+	return server, &requests
+}
+
+// TestStreamErrors tests that errors reported in the stream are surfaced and
+// retried while nothing has been streamed
+func TestStreamErrors(t *testing.T) {
+	const answer = "data: {\"choices\":[{\"delta\":{\"content\":\"Paris\"}}]}\n\ndata: [DONE]\n\n"
+	noResume := false
+
+	testCases := []struct {
+		name     string
+		stream   string
+		retry    config.RetryConfig
+		err      string
+		requests int
+	}{
+		{
+			name:     "Temporary error frame",
+			stream:   "data: {\"error\":{\"message\":\"The server had an error\",\"type\":\"server_error\",\"code\":null}}\n\n",
+			requests: 2,
+		},
+		{
+			name:     "Temporary error event",
+			stream:   "event: error\ndata: {\"type\":\"error\",\"error\":{\"type\":\"overloaded_error\",\"message\":\"Overloaded\"}}\n\n",
+			requests: 2,
+		},
+		{
+			name:     "Permanent error frame",
+			stream:   "data: {\"error\":{\"message\":\"Content filtered\",\"type\":\"invalid_request_error\",\"code\":\"content_filter\"}}\n\n",
+			err:      "the provider reported an error while streaming: Content filtered (content_filter)",
+			requests: 1,
+		},
+		{
+			name:     "Plain text error event",
+			stream:   "event: error\ndata: upstream connection reset\n\n",
+			err:      "the provider reported an error while streaming: upstream connection reset",
+			requests: 1,
+		},
+		{
+			name:     "Error after content without resuming",
+			stream:   "data: {\"choices\":[{\"delta\":{\"content\":\"Par\"}}]}\n\ndata: {\"error\":{\"message\":\"Overloaded\",\"type\":\"server_error\"}}\n\n",
+			retry:    config.RetryConfig{Resume: &noResume},
+			err:      "the provider reported an error while streaming: Overloaded (server_error)",
+			requests: 1,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockSleep(t)
+			server, requests := streamServer(t, tc.stream, answer)
+
+			provider, err := NewOpenAIProvider(&config.OpenAIConfig{BaseURL: server.URL, APIKey: "test-api-key", Retry: tc.retry})
+			require.NoError(t, err)
+
+			result, err := provider.Ask(context.Background(), "capital of France?")
+			if tc.err == "" {
+				require.NoError(t, err)
+				assert.Equal(t, "Paris", result)
+			} else {
+				assert.EqualError(t, err, tc.err)
+				var streamErr *StreamError
+				assert.ErrorAs(t, err, &streamErr)
+			}
+			assert.Equal(t, tc.requests, *requests)
+		})
+	}
+}
+
+// TestStreamErrorsGiveUp tests that stream errors count against the retries
+func TestStreamErrorsGiveUp(t *testing.T) {
+	mockSleep(t)
+	server, requests := streamServer(t, "data: {\"error\":{\"message\":\"Overloaded\",\"type\":\"server_error\"}}\n\n")
+
+	retries := 1
+	provider, err := NewOpenAIProvider(&config.OpenAIConfig{
+		BaseURL: server.URL,
+		APIKey:  "test-api-key",
+		Retry:   config.RetryConfig{MaxRetries: &retries},
+	})
+	require.NoError(t, err)
+
+	_, err = provider.Ask(context.Background(), "capital of France?")
+	assert.EqualError(t, err, "the provider reported an error while streaming: Overloaded (server_error) (gave up after 2 attempts)")
+	assert.True(t, IsUnavailable(err), "Expected another provider to be allowed to answer")
+	assert.Equal(t, 2, *requests)
+}
+
+// TestStreamErrorsShareRetries tests that errors in the stream and failed
+// requests count against the same retries
+func TestStreamErrorsShareRetries(t *testing.T) {
+	waits := mockSleep(t)
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests%2 == 0 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte("data: {\"error\":{\"message\":\"Overloaded\",\"type\":\"server_error\"}}\n\n"))
+	}))
+	t.Cleanup(server.Close)
+
+	retries := 3
+	provider, err := NewOpenAIProvider(&config.OpenAIConfig{
+		BaseURL: server.URL,
+		APIKey:  "test-api-key",
+		Retry:   config.RetryConfig{MaxRetries: &retries},
+	})
+	require.NoError(t, err)
+
+	_, err = provider.Ask(context.Background(), "capital of France?")
+	assert.ErrorContains(t, err, "gave up after 4 attempts")
+	assert.Equal(t, 4, requests)
+	assert.Len(t, *waits, 3)
+}
+
+// TestResumeStream tests that an interrupted answer is continued from where
+// it stopped
+func TestResumeStream(t *testing.T) {
+	testCases := []struct {
+		name   string
+		stream string
+	}{
+		{
+			name:   "Connection dropped",
+			stream: "data: {\"choices\":[{\"delta\":{\"content\":\"The capital \"}}]}\n\n",
+		},
+		{
+			name:   "Temporary error after content",
+			stream: "data: {\"choices\":[{\"delta\":{\"content\":\"The capital \"}}]}\n\ndata: {\"error\":{\"message\":\"Overloaded\",\"type\":\"server_error\"}}\n\n",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockSleep(t)
+			var bodies []string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, _ := io.ReadAll(r.Body)
+				bodies = append(bodies, string(body))
+
+				w.Header().Set("Content-Type", "text/event-stream")
+				if len(bodies) == 1 {
+					w.Write([]byte(tc.stream))
+					return
+				}
+				w.Write([]byte("data: {\"choices\":[{\"delta\":{\"content\":\"is Paris.\"},\"finish_reason\":\"stop\"}]}\n\ndata: [DONE]\n\n"))
+			}))
+			t.Cleanup(server.Close)
+
+			provider, err := NewOpenAIProvider(&config.OpenAIConfig{BaseURL: server.URL, APIKey: "test-api-key"})
+			require.NoError(t, err)
+
+			var chunks []string
+			err = provider.AskStream(context.Background(), "capital of France?", func(chunk string) error {
+				chunks = append(chunks, chunk)
+				return nil
+			})
+			require.NoError(t, err)
+			assert.Equal(t, []string{"The capital ", "is Paris."}, chunks)
+
+			// The second request has the partial answer to continue
+			require.Len(t, bodies, 2)
+			var request struct {
+				Messages []Message `json:"messages"`
+			}
+			require.NoError(t, json.Unmarshal([]byte(bodies[1]), &request))
+			require.Len(t, request.Messages, 4)
+			assert.Equal(t, []Message{
+				NewUserMessage("capital of France?"),
+				{Role: RoleAssistant, Content: "The capital "},
+				NewUserMessage(resumePrompt),
+			}, request.Messages[1:])
+		})
+	}
+}
+
+// TestResumeStreamGiveUp tests that resumed answers count against the
+// retries, and that interrupted streams without content start over
+func TestResumeStreamGiveUp(t *testing.T) {
+	mockSleep(t)
+	server, requests := streamServer(t, "data: {\"choices\":[{\"delta\":{\"content\":\"The capital \"}}]}\n\n")
+
+	retries := 2
+	provider, err := NewOpenAIProvider(&config.OpenAIConfig{
+		BaseURL: server.URL,
+		APIKey:  "test-api-key",
+		Retry:   config.RetryConfig{MaxRetries: &retries},
+	})
+	require.NoError(t, err)
+
+	_, err = provider.Ask(context.Background(), "capital of France?")
+	assert.ErrorIs(t, err, ErrStreamInterrupted)
+	assert.ErrorContains(t, err, "gave up after 3 attempts")
+	assert.False(t, IsUnavailable(err), "Expected a part of the answer to keep other providers from answering")
+	assert.Equal(t, 3, *requests)
+}
+
+// TestResumeStreamUnavailable tests that other providers don't answer when
+// resuming a part of the answer fails
+func TestResumeStreamUnavailable(t *testing.T) {
+	mockSleep(t)
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests > 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte("data: {\"choices\":[{\"delta\":{\"content\":\"The capital \"}}]}\n\n"))
+	}))
+	t.Cleanup(server.Close)
+
+	provider, err := NewOpenAIProvider(&config.OpenAIConfig{BaseURL: server.URL, APIKey: "test-api-key"})
+	require.NoError(t, err)
+
+	_, err = provider.Ask(context.Background(), "capital of France?")
+	var apiErr *APIError
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, http.StatusServiceUnavailable, apiErr.StatusCode)
+	assert.False(t, IsUnavailable(err), "Expected a part of the answer to keep other providers from answering")
+}
+
+// TestResumeStreamCanceled tests that the error of the stream is kept when
+// the wait before resuming it is canceled
+func TestResumeStreamCanceled(t *testing.T) {
+	old := sleep
+	t.Cleanup(func() { sleep = old })
+	sleep = func(ctx context.Context, d time.Duration) error {
+		return context.Canceled
+	}
+	server, requests := streamServer(t, "data: {\"choices\":[{\"delta\":{\"content\":\"The capital \"}}]}\n\n")
+
+	provider, err := NewOpenAIProvider(&config.OpenAIConfig{BaseURL: server.URL, APIKey: "test-api-key"})
+	require.NoError(t, err)
+
+	_, err = provider.Ask(context.Background(), "capital of France?")
+	assert.ErrorIs(t, err, ErrStreamInterrupted)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, 1, *requests)
+}
+
+// TestIsUnavailable tests which errors let another provider answer
+func TestIsUnavailable(t *testing.T) {
+	assert.True(t, IsUnavailable(&APIError{StatusCode: http.StatusTooManyRequests}))
+	assert.True(t, IsUnavailable(fmt.Errorf("%w (gave up after 3 attempts)", &APIError{StatusCode: http.StatusServiceUnavailable})))
+	assert.False(t, IsUnavailable(&APIError{StatusCode: http.StatusUnauthorized}))
+	assert.False(t, IsUnavailable(&APIError{StatusCode: http.StatusNotFound, Code: "model_not_found"}))
+
+	// The provider can't be reached
+	server := httptest.NewServer(http.NotFoundHandler())
+	server.Close()
+	_, err := server.Client().Get(server.URL)
+	require.Error(t, err)
+	assert.True(t, IsUnavailable(fmt.Errorf("failed to send request: %w", err)))
+
+	// Errors of the stream count if repeating the request may succeed, but
+	// not after a part of the answer
+	assert.True(t, IsUnavailable(&StreamError{Type: "server_error"}))
+	assert.True(t, IsUnavailable(fmt.Errorf("%w (gave up after 3 attempts)", &StreamError{Code: "rate_limit_exceeded"})))
+	assert.True(t, IsUnavailable(fmt.Errorf("%w: error reading response: %w", ErrStreamInterrupted, io.ErrUnexpectedEOF)))
+	assert.False(t, IsUnavailable(&StreamError{Type: "invalid_request_error"}))
+	assert.False(t, IsUnavailable(&partialError{&StreamError{Type: "server_error"}}))
+	assert.False(t, IsUnavailable(&partialError{ErrStreamInterrupted}))
+	assert.False(t, IsUnavailable(&url.Error{Op: "Post", URL: "http://localhost", Err: context.Canceled}))
+	assert.False(t, IsUnavailable(nil))
+}
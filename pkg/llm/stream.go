@@ -0,0 +1,62 @@
+package llm
+
+import (
+	"context"
+	"io"
+)
+
+// Chunk is a part of an answer streamed by AskStreamChan. The last chunk of
+// a stream that failed carries the error instead of text.
+type Chunk struct {
+	Text string
+	Err  error
+}
+
+// AskStreamWriter sends the conversation to the provider and writes the
+// answer to w as it is streamed. The stream ends with the first write that
+// fails.
+func AskStreamWriter(ctx context.Context, provider Provider, messages []Message, w io.Writer) error {
+	return stream(ctx, provider, messages, func(text string) error {
+		_, err := io.WriteString(w, text)
+		return err
+	})
+}
+
+// AskStreamChan sends the conversation to the provider and returns a
+// channel of the parts of the answer, which is closed when the answer is
+// complete. Callers that stop reading early must cancel the context to end
+// the request.
+func AskStreamChan(ctx context.Context, provider Provider, messages []Message) <-chan Chunk {
+	chunks := make(chan Chunk)
+	send := func(chunk Chunk) error {
+		select {
+		case chunks <- chunk:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	go func() {
+		defer close(chunks)
+		err := stream(ctx, provider, messages, func(text string) error {
+			return send(Chunk{Text: text})
+		})
+		if err != nil {
+			send(Chunk{Err: err})
+		}
+	}()
+	return chunks
+}
+
+// stream is the core of the streaming APIs. It passes the parts of the
+// answer to emit and ends the stream when the context is canceled, even if
+// the provider doesn't notice.
+func stream(ctx context.Context, provider Provider, messages []Message, emit func(text string) error) error {
+	return provider.ChatStream(ctx, messages, func(text string) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		return emit(text)
+	})
+}
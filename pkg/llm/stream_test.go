@@ -0,0 +1,99 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Turee/si/pkg/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// streamingProvider creates a provider of a server that streams the chunks
+func streamingProvider(t *testing.T, status int, chunks ...string) Provider {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if status != http.StatusOK {
+			w.WriteHeader(status)
+			w.Write([]byte(`{"error":{"message":"invalid key"}}`))
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, chunk := range chunks {
+			w.Write([]byte(`data: {"choices":[{"delta":{"content":"` + chunk + `"}}]}` + "\n\n"))
+		}
+		w.Write([]byte("data: [DONE]\n\n"))
+	}))
+	t.Cleanup(server.Close)
+
+	provider, err := NewOpenAIProvider(&config.OpenAIConfig{BaseURL: server.URL, APIKey: "test-api-key", Retry: config.RetryConfig{MaxRetries: new(int)}})
+	require.NoError(t, err)
+	return provider
+}
+
+// failingWriter fails every write
+type failingWriter struct{ writes int }
+
+// Write implements io.Writer
+func (w *failingWriter) Write(p []byte) (int, error) {
+	w.writes++
+	return 0, errors.New("disk full")
+}
+
+// TestAskStreamWriter tests writing the streamed answer
+func TestAskStreamWriter(t *testing.T) {
+	provider := streamingProvider(t, http.StatusOK, "The capital ", "is ", "Paris.")
+	messages := []Message{NewUserMessage("capital of France?")}
+
+	var answer strings.Builder
+	require.NoError(t, AskStreamWriter(context.Background(), provider, messages, &answer))
+	assert.Equal(t, "The capital is Paris.", answer.String())
+
+	// The first failed write ends the stream
+	writer := &failingWriter{}
+	err := AskStreamWriter(context.Background(), provider, messages, writer)
+	assert.ErrorContains(t, err, "disk full")
+	assert.Equal(t, 1, writer.writes)
+}
+
+// TestAskStreamChan tests receiving the streamed answer from a channel
+func TestAskStreamChan(t *testing.T) {
+	provider := streamingProvider(t, http.StatusOK, "The capital ", "is ", "Paris.")
+
+	var texts []string
+	for chunk := range AskStreamChan(context.Background(), provider, []Message{NewUserMessage("capital of France?")}) {
+		require.NoError(t, chunk.Err)
+		texts = append(texts, chunk.Text)
+	}
+	assert.Equal(t, []string{"The capital ", "is ", "Paris."}, texts)
+
+	// The error ends the stream
+	provider = streamingProvider(t, http.StatusUnauthorized)
+	var chunks []Chunk
+	for chunk := range AskStreamChan(context.Background(), provider, []Message{NewUserMessage("capital of France?")}) {
+		chunks = append(chunks, chunk)
+	}
+	require.Len(t, chunks, 1)
+	assert.Empty(t, chunks[0].Text)
+	var apiErr *APIError
+	assert.ErrorAs(t, chunks[0].Err, &apiErr)
+}
+
+// TestAskStreamChanCanceled tests that the channel is closed when the
+// reader cancels the context
+func TestAskStreamChanCanceled(t *testing.T) {
+	provider := streamingProvider(t, http.StatusOK, "The capital ", "is ", "Paris.")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	chunks := AskStreamChan(ctx, provider, []Message{NewUserMessage("capital of France?")})
+	first := <-chunks
+	assert.Equal(t, "The capital ", first.Text)
+	cancel()
+
+	for chunk := range chunks {
+		assert.NotEqual(t, "Paris.", chunk.Text)
+	}
+}
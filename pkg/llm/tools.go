@@ -0,0 +1,237 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+)
+
+// DefaultMaxToolSteps is the number of rounds of tool calls a model may make
+// before it has to answer
+const DefaultMaxToolSteps = 10
+
+// Tool describes a function the model can call
+type Tool struct {
+	Name        string
+	Description string
+
+	// Parameters is the JSON Schema of the arguments
+	Parameters json.RawMessage
+}
+
+// ToolCall is a call of a tool requested by the model
+type ToolCall struct {
+	ID   string
+	Name string
+
+	// Arguments are the arguments as a JSON object, as generated by the model
+	Arguments string
+}
+
+// NewToolMessage creates the message with the result of a tool call
+func NewToolMessage(callID, result string) Message {
+	return Message{Role: RoleTool, Content: result, ToolCallID: callID}
+}
+
+// ToolCaller is implemented by providers that support tool calling
+type ToolCaller interface {
+	// ChatTools sends the conversation together with the tools the model
+	// may call and streams the text of the answer to the callback. It
+	// returns the tool calls the model requested, if any.
+	ChatTools(ctx context.Context, messages []Message, tools []Tool, callback func(chunk string) error) ([]ToolCall, error)
+}
+
+// ToolFunc executes a tool with the arguments given by the model and returns
+// the result for the model
+type ToolFunc func(ctx context.Context, arguments json.RawMessage) (string, error)
+
+// Toolbox holds the tools available to the model
+type Toolbox struct {
+	tools map[string]Tool
+	funcs map[string]ToolFunc
+}
+
+// NewToolbox creates an empty toolbox
+func NewToolbox() *Toolbox {
+	return &Toolbox{tools: make(map[string]Tool), funcs: make(map[string]ToolFunc)}
+}
+
+// Add adds a tool, replacing a tool with the same name
+func (t *Toolbox) Add(tool Tool, fn ToolFunc) {
+	t.tools[tool.Name] = tool
+	t.funcs[tool.Name] = fn
+}
+
+// Tools returns the tools sorted by name
+func (t *Toolbox) Tools() []Tool {
+	tools := make([]Tool, 0, len(t.tools))
+	for _, tool := range t.tools {
+		tools = append(tools, tool)
+	}
+	sort.Slice(tools, func(i, j int) bool { return tools[i].Name < tools[j].Name })
+	return tools
+}
+
+// Call executes a tool call and returns the result for the model. Failures
+// are reported to the model, so it can correct the call or try another way.
+func (t *Toolbox) Call(ctx context.Context, call ToolCall) string {
+	fn, ok := t.funcs[call.Name]
+	if !ok {
+		return fmt.Sprintf("error: unknown tool %q", call.Name)
+	}
+
+	arguments := json.RawMessage(call.Arguments)
+	if call.Arguments == "" {
+		arguments = json.RawMessage("{}")
+	}
+	if !json.Valid(arguments) {
+		return "error: the arguments are not valid JSON"
+	}
+
+	result, err := fn(ctx, arguments)
+	if err != nil {
+		return "error: " + err.Error()
+	}
+	return result
+}
+
+// ToolLoop lets the model call tools iteratively until it produces an answer
+// without tool calls
+type ToolLoop struct {
+	Provider ToolCaller
+	Toolbox  *Toolbox
+
+	// MaxSteps limits the rounds of tool calls (default: DefaultMaxToolSteps)
+	MaxSteps int
+
+	// OnCall is called before every tool call, e.g. to show progress
+	OnCall func(call ToolCall)
+
+	// BeforeStep is called before every request after the first one, e.g. to
+	// enforce a budget. An error stops the loop.
+	BeforeStep func() error
+}
+
+// Run sends the conversation and executes the tool calls of the model until
+// it answers. The text of every response is streamed to the callback. It
+// returns the conversation including the tool calls, their results and the
+// final answer.
+func (l *ToolLoop) Run(ctx context.Context, messages []Message, callback func(chunk string) error) ([]Message, error) {
+	maxSteps := l.MaxSteps
+	if maxSteps <= 0 {
+		maxSteps = DefaultMaxToolSteps
+	}
+	messages = append([]Message(nil), messages...)
+
+	for step := 0; ; step++ {
+		if step > 0 && l.BeforeStep != nil {
+			if err := l.BeforeStep(); err != nil {
+				return messages, err
+			}
+		}
+
+		// The last round gets no tools, so the model has to answer
+		tools := l.Toolbox.Tools()
+		if step == maxSteps {
+			tools = nil
+		}
+
+		var text []byte
+		calls, err := l.Provider.ChatTools(ctx, messages, tools, func(chunk string) error {
+			text = append(text, chunk...)
+			return callback(chunk)
+		})
+		if err != nil {
+			return messages, err
+		}
+
+		messages = append(messages, Message{Role: RoleAssistant, Content: string(text), ToolCalls: calls})
+		if len(calls) == 0 {
+			return messages, nil
+		}
+		if step == maxSteps {
+			return messages, fmt.Errorf("the model kept calling tools after %d steps", maxSteps)
+		}
+
+		for _, call := range calls {
+			if l.OnCall != nil {
+				l.OnCall(call)
+			}
+			result := l.Toolbox.Call(ctx, call)
+			if err := ctx.Err(); err != nil {
+				return messages, err
+			}
+			messages = append(messages, NewToolMessage(call.ID, result))
+		}
+	}
+}
+
+// toolJSON is the wire format of a tool definition
+type toolJSON struct {
+	Type     string       `json:"type"`
+	Function functionJSON `json:"function"`
+}
+
+type functionJSON struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	Parameters  json.RawMessage `json:"parameters,omitempty"`
+}
+
+// toolCallJSON is the wire format of a tool call
+type toolCallJSON struct {
+	ID       string           `json:"id"`
+	Type     string           `json:"type"`
+	Function functionCallJSON `json:"function"`
+}
+
+type functionCallJSON struct {
+	Name      string `json:"name"`
+	Arguments string `json:"arguments"`
+}
+
+func newToolsJSON(tools []Tool) []toolJSON {
+	var out []toolJSON
+	for _, tool := range tools {
+		out = append(out, toolJSON{Type: "function", Function: functionJSON{
+			Name:        tool.Name,
+			Description: tool.Description,
+			Parameters:  tool.Parameters,
+		}})
+	}
+	return out
+}
+
+func newToolCallJSON(call ToolCall) toolCallJSON {
+	return toolCallJSON{ID: call.ID, Type: "function", Function: functionCallJSON{Name: call.Name, Arguments: call.Arguments}}
+}
+
+func (c toolCallJSON) toolCall() ToolCall {
+	return ToolCall{ID: c.ID, Name: c.Function.Name, Arguments: c.Function.Arguments}
+}
+
+// toolCallDelta is a fragment of a tool call in a streamed response. The
+// fragments of a call share its index; the arguments arrive in pieces.
+type toolCallDelta struct {
+	Index    int              `json:"index"`
+	ID       string           `json:"id,omitempty"`
+	Function functionCallJSON `json:"function"`
+}
+
+// toolCallAccumulator assembles tool calls from streamed fragments
+type toolCallAccumulator struct {
+	calls []ToolCall
+}
+
+func (a *toolCallAccumulator) add(delta toolCallDelta) {
+	for len(a.calls) <= delta.Index {
+		a.calls = append(a.calls, ToolCall{})
+	}
+	call := &a.calls[delta.Index]
+	if delta.ID != "" {
+		call.ID = delta.ID
+	}
+	call.Name += delta.Function.Name
+	call.Arguments += delta.Function.Arguments
+}
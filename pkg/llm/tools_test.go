@@ -0,0 +1,179 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Turee/si/pkg/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestOpenAIProviderChatTools tests sending tools and assembling streamed
+// tool calls
+func TestOpenAIProviderChatTools(t *testing.T) {
+	var captured map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		captured = nil
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&captured))
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`data: {"choices":[{"index":0,"delta":{"content":"Let me look."}}]}
+
+data: {"choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"id":"call_1","type":"function","function":{"name":"read_file","arguments":""}}]}}]}
+
+data: {"choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"function":{"arguments":"{\"path\":"}}]}}]}
+
+data: {"choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"function":{"arguments":"\"go.mod\"}"}},{"index":1,"id":"call_2","function":{"name":"shell","arguments":"{}"}}]}}]}
+
+data: {"choices":[{"index":0,"delta":{},"finish_reason":"tool_calls"}]}
+
+data: [DONE]
+`))
+	}))
+	defer server.Close()
+
+	provider, err := NewOpenAIProvider(&config.OpenAIConfig{BaseURL: server.URL, APIKey: "test-api-key"})
+	require.NoError(t, err)
+
+	tools := []Tool{{Name: "read_file", Description: "Read a file", Parameters: json.RawMessage(`{"type":"object"}`)}}
+	var text string
+	calls, err := provider.(ToolCaller).ChatTools(context.Background(), []Message{NewUserMessage("what module?")}, tools, func(chunk string) error {
+		text += chunk
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "Let me look.", text)
+	assert.Equal(t, []ToolCall{
+		{ID: "call_1", Name: "read_file", Arguments: `{"path":"go.mod"}`},
+		{ID: "call_2", Name: "shell", Arguments: `{}`},
+	}, calls)
+	assert.Equal(t, []interface{}{map[string]interface{}{
+		"type":     "function",
+		"function": map[string]interface{}{"name": "read_file", "description": "Read a file", "parameters": map[string]interface{}{"type": "object"}},
+	}}, captured["tools"])
+
+	// Requests without tools don't mention them
+	_, err = provider.Ask(context.Background(), "hi")
+	require.NoError(t, err)
+	assert.NotContains(t, captured, "tools")
+}
+
+// TestToolMessageJSON tests the wire format of tool calls and results
+func TestToolMessageJSON(t *testing.T) {
+	messages := []Message{
+		{Role: RoleAssistant, ToolCalls: []ToolCall{{ID: "call_1", Name: "shell", Arguments: `{"command":"ls"}`}}},
+		NewToolMessage("call_1", "go.mod"),
+	}
+	data, err := json.Marshal(messages)
+	require.NoError(t, err)
+	assert.JSONEq(t, `[
+		{"role":"assistant","content":null,"tool_calls":[{"id":"call_1","type":"function","function":{"name":"shell","arguments":"{\"command\":\"ls\"}"}}]},
+		{"role":"tool","content":"go.mod","tool_call_id":"call_1"}
+	]`, string(data))
+
+	var decoded []Message
+	require.NoError(t, json.Unmarshal(data, &decoded))
+	assert.Equal(t, messages, decoded)
+}
+
+// scriptedToolCaller returns the prepared tool calls, one round per request,
+// and then answers
+type scriptedToolCaller struct {
+	rounds   [][]ToolCall
+	requests [][]Message
+	tools    [][]Tool
+}
+
+func (s *scriptedToolCaller) ChatTools(ctx context.Context, messages []Message, tools []Tool, callback func(chunk string) error) ([]ToolCall, error) {
+	s.requests = append(s.requests, messages)
+	s.tools = append(s.tools, tools)
+	if len(s.rounds) > 0 && len(tools) > 0 {
+		calls := s.rounds[0]
+		s.rounds = s.rounds[1:]
+		return calls, nil
+	}
+	return nil, callback("done")
+}
+
+// TestToolLoop tests executing tool calls until the model answers
+func TestToolLoop(t *testing.T) {
+	toolbox := NewToolbox()
+	toolbox.Add(Tool{Name: "echo"}, func(ctx context.Context, arguments json.RawMessage) (string, error) {
+		var args struct {
+			Text string `json:"text"`
+		}
+		if err := json.Unmarshal(arguments, &args); err != nil {
+			return "", err
+		}
+		return args.Text, nil
+	})
+	toolbox.Add(Tool{Name: "fail"}, func(ctx context.Context, arguments json.RawMessage) (string, error) {
+		return "", errors.New("broken")
+	})
+
+	caller := &scriptedToolCaller{rounds: [][]ToolCall{
+		{{ID: "1", Name: "echo", Arguments: `{"text":"hello"}`}, {ID: "2", Name: "fail"}},
+		{{ID: "3", Name: "missing"}, {ID: "4", Name: "echo", Arguments: `{`}},
+	}}
+	var called []string
+	loop := &ToolLoop{Provider: caller, Toolbox: toolbox, OnCall: func(call ToolCall) { called = append(called, call.Name) }}
+
+	messages, err := loop.Run(context.Background(), []Message{NewUserMessage("go")}, func(chunk string) error { return nil })
+	require.NoError(t, err)
+	assert.Equal(t, []string{"echo", "fail", "missing", "echo"}, called)
+	assert.Len(t, caller.requests, 3)
+
+	var results []string
+	for _, message := range messages {
+		if message.Role == RoleTool {
+			results = append(results, message.ToolCallID+": "+message.Content)
+		}
+	}
+	assert.Equal(t, []string{"1: hello", "2: error: broken", `3: error: unknown tool "missing"`, "4: error: the arguments are not valid JSON"}, results)
+	assert.Equal(t, Message{Role: RoleAssistant, Content: "done"}, messages[len(messages)-1])
+}
+
+// TestToolLoopMaxSteps tests that the last round forces an answer
+func TestToolLoopMaxSteps(t *testing.T) {
+	toolbox := NewToolbox()
+	toolbox.Add(Tool{Name: "echo"}, func(ctx context.Context, arguments json.RawMessage) (string, error) {
+		return "again", nil
+	})
+	caller := &scriptedToolCaller{rounds: [][]ToolCall{{{ID: "1", Name: "echo"}}, {{ID: "2", Name: "echo"}}, {{ID: "3", Name: "echo"}}}}
+
+	loop := &ToolLoop{Provider: caller, Toolbox: toolbox, MaxSteps: 2}
+	messages, err := loop.Run(context.Background(), []Message{NewUserMessage("go")}, func(chunk string) error { return nil })
+	require.NoError(t, err)
+	assert.Len(t, caller.requests, 3)
+	assert.Nil(t, caller.tools[2])
+	assert.Equal(t, "done", messages[len(messages)-1].Content)
+}
+
+// TestToolLoopBeforeStep tests that BeforeStep can stop the loop between
+// requests
+func TestToolLoopBeforeStep(t *testing.T) {
+	toolbox := NewToolbox()
+	toolbox.Add(Tool{Name: "echo"}, func(ctx context.Context, arguments json.RawMessage) (string, error) {
+		return "again", nil
+	})
+	caller := &scriptedToolCaller{rounds: [][]ToolCall{{{ID: "1", Name: "echo"}}, {{ID: "2", Name: "echo"}}}}
+
+	var steps int
+	loop := &ToolLoop{Provider: caller, Toolbox: toolbox, BeforeStep: func() error {
+		steps++
+		if steps == 2 {
+			return errors.New("over budget")
+		}
+		return nil
+	}}
+	messages, err := loop.Run(context.Background(), []Message{NewUserMessage("go")}, func(chunk string) error { return nil })
+	assert.EqualError(t, err, "over budget")
+	assert.Len(t, caller.requests, 2)
+	assert.Equal(t, RoleTool, messages[len(messages)-1].Role)
+}
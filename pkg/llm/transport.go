@@ -0,0 +1,96 @@
+package llm
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+
+	"github.com/Turee/si/pkg/config"
+)
+
+// transports holds one transport per proxy and TLS configuration, so
+// providers with the same settings share their connections
+var (
+	transportsMu sync.Mutex
+	transports   = map[transportKey]*http.Transport{}
+)
+
+// transportKey identifies the network settings of a provider
+type transportKey struct {
+	proxy string
+	tls   config.TLSConfig
+}
+
+// newTransport returns the transport of requests to the provider: the
+// default transport, or one with the proxy and TLS settings of cfg
+func newTransport(cfg *config.OpenAIConfig) (http.RoundTripper, error) {
+	key := transportKey{proxy: cfg.Proxy, tls: cfg.TLS}
+	if key == (transportKey{}) {
+		return http.DefaultTransport, nil
+	}
+
+	transportsMu.Lock()
+	defer transportsMu.Unlock()
+	if transport, ok := transports[key]; ok {
+		return transport, nil
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if cfg.Proxy != "" {
+		proxy, err := url.Parse(cfg.Proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy: %w", err)
+		}
+		transport.Proxy = http.ProxyURL(proxy)
+	}
+
+	tlsConfig, err := NewTLSConfig(&cfg.TLS)
+	if err != nil {
+		return nil, err
+	}
+	if tlsConfig != nil {
+		transport.TLSClientConfig = tlsConfig
+	}
+
+	transports[key] = transport
+	return transport, nil
+}
+
+// NewTLSConfig loads the certificates of the configuration, or returns nil
+// if it doesn't change the defaults
+func NewTLSConfig(cfg *config.TLSConfig) (*tls.Config, error) {
+	if *cfg == (config.TLSConfig{}) {
+		return nil, nil
+	}
+
+	tlsConfig := &tls.Config{InsecureSkipVerify: cfg.InsecureSkipVerify}
+
+	if cfg.CAFile != "" {
+		pem, err := os.ReadFile(config.ExpandPath(cfg.CAFile))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA bundle: %w", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in CA bundle %s", cfg.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if cfg.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(config.ExpandPath(cfg.CertFile), config.ExpandPath(cfg.KeyFile))
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig, nil
+}
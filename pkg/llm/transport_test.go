@@ -0,0 +1,98 @@
+package llm
+
+import (
+	"context"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Turee/si/pkg/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// parisHandler streams a short answer
+func parisHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Write([]byte(`data: {"choices":[{"delta":{"content":"Paris"},"finish_reason":"stop"}]}` + "\n\ndata: [DONE]\n\n"))
+}
+
+// TestProxy tests that requests are sent through the configured proxy
+func TestProxy(t *testing.T) {
+	var target string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// A proxy receives the absolute URL of the request
+		target = r.URL.String()
+		parisHandler(w, r)
+	}))
+	t.Cleanup(proxy.Close)
+
+	provider, err := NewOpenAIProvider(&config.OpenAIConfig{
+		BaseURL: "http://gateway.internal/v1",
+		APIKey:  "test-api-key",
+		Proxy:   proxy.URL,
+	})
+	require.NoError(t, err)
+
+	result, err := provider.Ask(context.Background(), "capital of France?")
+	require.NoError(t, err)
+	assert.Equal(t, "Paris", result)
+	assert.Equal(t, "http://gateway.internal/v1/chat/completions", target)
+}
+
+// TestTLS tests trusting a private CA and skipping the verification
+func TestTLS(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(parisHandler))
+	t.Cleanup(server.Close)
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	certificate := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	require.NoError(t, os.WriteFile(caFile, certificate, 0o600))
+
+	ask := func(tlsConfig config.TLSConfig) error {
+		provider, err := NewOpenAIProvider(&config.OpenAIConfig{
+			BaseURL: server.URL,
+			APIKey:  "test-api-key",
+			TLS:     tlsConfig,
+			Retry:   config.RetryConfig{MaxRetries: new(int)},
+		})
+		if err != nil {
+			return err
+		}
+		_, err = provider.Ask(context.Background(), "capital of France?")
+		return err
+	}
+
+	// The certificate of the server isn't trusted by default
+	assert.ErrorContains(t, ask(config.TLSConfig{}), "certificate")
+
+	assert.NoError(t, ask(config.TLSConfig{CAFile: caFile}))
+	assert.NoError(t, ask(config.TLSConfig{InsecureSkipVerify: true}))
+
+	// Missing or invalid files are reported when the provider is created
+	assert.ErrorContains(t, ask(config.TLSConfig{CAFile: filepath.Join(t.TempDir(), "missing.pem")}), "failed to read CA bundle")
+	assert.ErrorContains(t, ask(config.TLSConfig{CAFile: os.Args[0]}), "no certificates found")
+	assert.ErrorContains(t, ask(config.TLSConfig{CertFile: caFile, KeyFile: caFile}), "failed to load client certificate")
+}
+
+// TestTransportShared tests that providers with the same settings share
+// their transport
+func TestTransportShared(t *testing.T) {
+	cfg := &config.OpenAIConfig{Proxy: "http://proxy.example.com:8080"}
+	first, err := newTransport(cfg)
+	require.NoError(t, err)
+	second, err := newTransport(&config.OpenAIConfig{Proxy: "http://proxy.example.com:8080"})
+	require.NoError(t, err)
+	assert.Same(t, first, second)
+
+	other, err := newTransport(&config.OpenAIConfig{Proxy: "http://proxy.example.com:3128"})
+	require.NoError(t, err)
+	assert.NotSame(t, first, other)
+
+	defaults, err := newTransport(&config.OpenAIConfig{})
+	require.NoError(t, err)
+	assert.Equal(t, http.DefaultTransport, defaults)
+}
@@ -0,0 +1,47 @@
+package llm
+
+// Usage is the number of tokens used by a request
+type Usage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+
+	// CachedTokens is the part of the prompt tokens that was served from the
+	// provider's prompt cache
+	CachedTokens int `json:"cached_tokens,omitempty"`
+}
+
+// Add adds the token counts of other to the usage
+func (u *Usage) Add(other Usage) {
+	u.PromptTokens += other.PromptTokens
+	u.CompletionTokens += other.CompletionTokens
+	u.TotalTokens += other.TotalTokens
+	u.CachedTokens += other.CachedTokens
+}
+
+// UsageReporter is implemented by providers that report token usage
+type UsageReporter interface {
+	// SetUsageCallback installs a callback that receives the usage of every
+	// completed request
+	SetUsageCallback(callback func(Usage))
+}
+
+// apiUsage is the usage object of the OpenAI API
+type apiUsage struct {
+	PromptTokens        int `json:"prompt_tokens"`
+	CompletionTokens    int `json:"completion_tokens"`
+	TotalTokens         int `json:"total_tokens"`
+	PromptTokensDetails struct {
+		CachedTokens int `json:"cached_tokens"`
+	} `json:"prompt_tokens_details"`
+}
+
+// usage converts the API usage object
+func (u *apiUsage) usage() Usage {
+	return Usage{
+		PromptTokens:     u.PromptTokens,
+		CompletionTokens: u.CompletionTokens,
+		TotalTokens:      u.TotalTokens,
+		CachedTokens:     u.PromptTokensDetails.CachedTokens,
+	}
+}
@@ -0,0 +1,251 @@
+// Package logging is the debug log of si: the HTTP traffic with the
+// providers, the events of streamed responses, timings and retries. The log
+// is off unless a level is configured with log_level or --debug.
+package logging
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Log levels
+const (
+	LevelDebug = "debug"
+	LevelInfo  = "info"
+	LevelWarn  = "warn"
+	LevelError = "error"
+)
+
+// maxBody is the number of bytes of a request body that are logged
+const maxBody = 16 * 1024
+
+// redacted replaces secrets in the log
+const redacted = "[redacted]"
+
+// secretHeaders are headers whose values are never logged
+var secretHeaders = []string{"Authorization", "Api-Key", "X-Api-Key", "Proxy-Authorization", "Cookie", "Set-Cookie"}
+
+var logger atomic.Pointer[slog.Logger]
+
+func init() {
+	logger.Store(slog.New(slog.NewTextHandler(io.Discard, &slog.HandlerOptions{Level: slog.LevelError + 1})))
+}
+
+// ParseLevel returns the slog level of a log level name
+func ParseLevel(level string) (slog.Level, error) {
+	switch level {
+	case LevelDebug:
+		return slog.LevelDebug, nil
+	case LevelInfo:
+		return slog.LevelInfo, nil
+	case LevelWarn:
+		return slog.LevelWarn, nil
+	case LevelError:
+		return slog.LevelError, nil
+	}
+	return 0, fmt.Errorf("log level must be debug, info, warn or error, got %q", level)
+}
+
+// Setup starts logging at the level to w. An empty level turns the log off.
+func Setup(level string, w io.Writer) error {
+	if level == "" {
+		logger.Store(slog.New(slog.NewTextHandler(io.Discard, &slog.HandlerOptions{Level: slog.LevelError + 1})))
+		return nil
+	}
+
+	l, err := ParseLevel(level)
+	if err != nil {
+		return err
+	}
+	logger.Store(slog.New(slog.NewTextHandler(w, &slog.HandlerOptions{Level: l})))
+	return nil
+}
+
+// SetupFile starts logging at the level to the file at path, appending to
+// it, or to stderr if path is empty
+func SetupFile(level, path string, stderr io.Writer) error {
+	if level == "" || path == "" {
+		return Setup(level, stderr)
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open log file: %w", err)
+	}
+	return Setup(level, f)
+}
+
+// Logger returns the logger
+func Logger() *slog.Logger {
+	return logger.Load()
+}
+
+// Enabled reports whether messages of the level are logged
+func Enabled(level slog.Level) bool {
+	return Logger().Enabled(context.Background(), level)
+}
+
+// Transport wraps an HTTP transport, logging every request and response: the
+// method, URL and status with the timing at info level, the headers, bodies
+// of requests and events of streamed responses at debug level. Secrets in
+// headers and query parameters are redacted.
+func Transport(base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &transport{base: base}
+}
+
+type transport struct {
+	base http.RoundTripper
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	log := Logger()
+	if !Enabled(slog.LevelInfo) {
+		return t.base.RoundTrip(req)
+	}
+
+	target := RedactURL(req.URL)
+	if Enabled(slog.LevelDebug) {
+		log.Debug("http request", "method", req.Method, "url", target, "headers", RedactHeaders(req.Header), "body", requestBody(req))
+	}
+
+	start := time.Now()
+	resp, err := t.base.RoundTrip(req)
+	elapsed := time.Since(start)
+	if err != nil {
+		log.Warn("http request failed", "method", req.Method, "url", target, "duration", elapsed, "error", err)
+		return nil, err
+	}
+
+	log.Info("http response", "method", req.Method, "url", target, "status", resp.StatusCode, "duration", elapsed)
+	if Enabled(slog.LevelDebug) {
+		log.Debug("http response headers", "url", target, "headers", RedactHeaders(resp.Header))
+		if strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream") {
+			resp.Body = &eventLogger{ReadCloser: resp.Body, url: target, start: start}
+		}
+	}
+	return resp, nil
+}
+
+// requestBody returns the body of the request for the log, leaving the
+// request able to send it
+func requestBody(req *http.Request) string {
+	if req.Body == nil || req.Body == http.NoBody {
+		return ""
+	}
+
+	var body io.ReadCloser
+	var err error
+	if req.GetBody != nil {
+		body, err = req.GetBody()
+	} else {
+		var data []byte
+		data, err = io.ReadAll(req.Body)
+		req.Body.Close()
+		req.Body = io.NopCloser(bytes.NewReader(data))
+		body = io.NopCloser(bytes.NewReader(data))
+	}
+	if err != nil {
+		return fmt.Sprintf("[unreadable: %v]", err)
+	}
+	defer body.Close()
+
+	data, _ := io.ReadAll(io.LimitReader(body, maxBody+1))
+	if len(data) > maxBody {
+		return string(data[:maxBody]) + "[truncated]"
+	}
+	return string(data)
+}
+
+// RedactHeaders returns the headers with the values of secret headers
+// replaced, including custom headers whose names suggest they hold a secret,
+// such as X-Gateway-Token
+func RedactHeaders(header http.Header) http.Header {
+	h := header.Clone()
+	for _, name := range secretHeaders {
+		if h.Get(name) != "" {
+			h.Set(name, redacted)
+		}
+	}
+	for name := range h {
+		if isSecretName(name) {
+			h.Set(name, redacted)
+		}
+	}
+	return h
+}
+
+// isSecretName reports whether the name of a header or query parameter
+// suggests that its value is a secret
+func isSecretName(name string) bool {
+	lower := strings.ToLower(name)
+	return strings.Contains(lower, "key") || strings.Contains(lower, "token") || strings.Contains(lower, "secret") || strings.Contains(lower, "password")
+}
+
+// RedactURL returns the URL with the values of query parameters that may
+// hold secrets, such as api_key or token, replaced
+func RedactURL(u *url.URL) string {
+	query := u.Query()
+	changed := false
+	for name := range query {
+		if isSecretName(name) {
+			query.Set(name, redacted)
+			changed = true
+		}
+	}
+
+	redactedURL := *u
+	redactedURL.User = nil
+	if changed {
+		redactedURL.RawQuery = query.Encode()
+	}
+	return redactedURL.String()
+}
+
+// eventLogger logs the lines of a server-sent events stream as they are read
+type eventLogger struct {
+	io.ReadCloser
+	url     string
+	start   time.Time
+	partial []byte
+}
+
+// Read implements io.Reader
+func (e *eventLogger) Read(p []byte) (int, error) {
+	n, err := e.ReadCloser.Read(p)
+	e.partial = append(e.partial, p[:n]...)
+	for {
+		i := bytes.IndexByte(e.partial, '\n')
+		if i < 0 {
+			break
+		}
+		e.log(e.partial[:i])
+		e.partial = e.partial[i+1:]
+	}
+	if err == io.EOF {
+		e.log(e.partial)
+		e.partial = nil
+		Logger().Debug("sse end", "url", e.url, "duration", time.Since(e.start))
+	}
+	return n, err
+}
+
+// log logs a line of the stream, skipping the empty lines between events
+func (e *eventLogger) log(line []byte) {
+	line = bytes.TrimSpace(line)
+	if len(line) > 0 {
+		Logger().Debug("sse event", "line", string(line), "elapsed", time.Since(e.start))
+	}
+}
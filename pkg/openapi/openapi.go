@@ -0,0 +1,483 @@
+// Package openapi reads OpenAPI 3 specs and turns their operations into
+// tools the model can call: a JSON Schema of the arguments and the HTTP
+// request made from the arguments the model generated.
+package openapi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// maxRefDepth limits how deeply $refs are resolved, so recursive schemas end
+// in a schema that accepts anything
+const maxRefDepth = 16
+
+// methods are the HTTP methods of path items, in the order operations are
+// listed
+var methods = []string{"get", "put", "post", "delete", "options", "head", "patch", "trace"}
+
+// Spec is an OpenAPI 3 document, in YAML or JSON
+type Spec struct {
+	doc map[string]interface{}
+}
+
+// Operation is an API operation, with the $refs of its parameters and body
+// resolved
+type Operation struct {
+	// ID is the operationId, or one derived from the method and path
+	ID          string
+	Method      string
+	Path        string
+	Summary     string
+	Description string
+	Parameters  []Parameter
+
+	// Body is the JSON Schema of the JSON request body, nil without one
+	Body         map[string]interface{}
+	BodyRequired bool
+}
+
+// Parameter is a path, query or header parameter of an operation
+type Parameter struct {
+	Name        string
+	In          string
+	Description string
+	Required    bool
+	Schema      map[string]interface{}
+}
+
+// Load reads the spec at path
+func Load(path string) (*Spec, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read OpenAPI spec: %w", err)
+	}
+	spec, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return spec, nil
+}
+
+// Parse parses a spec in YAML or JSON
+func Parse(data []byte) (*Spec, error) {
+	var doc interface{}
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse OpenAPI spec: %w", err)
+	}
+
+	m, ok := normalize(doc).(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("the OpenAPI spec is not a mapping")
+	}
+	if _, ok := m["swagger"]; ok {
+		return nil, fmt.Errorf("Swagger 2.0 specs are not supported, convert the spec to OpenAPI 3")
+	}
+	if version, _ := m["openapi"].(string); !strings.HasPrefix(version, "3.") {
+		return nil, fmt.Errorf("not an OpenAPI 3 spec, openapi is %q", version)
+	}
+	return &Spec{doc: m}, nil
+}
+
+// Title returns the title of the API
+func (s *Spec) Title() string {
+	info, _ := s.doc["info"].(map[string]interface{})
+	title, _ := info["title"].(string)
+	return title
+}
+
+// ServerURL returns the URL of the first server of the spec, with its
+// variables replaced by their defaults. It may be relative or empty.
+func (s *Spec) ServerURL() string {
+	servers, _ := s.doc["servers"].([]interface{})
+	if len(servers) == 0 {
+		return ""
+	}
+	server, _ := servers[0].(map[string]interface{})
+	serverURL, _ := server["url"].(string)
+
+	variables, _ := server["variables"].(map[string]interface{})
+	for name, v := range variables {
+		variable, _ := v.(map[string]interface{})
+		serverURL = strings.ReplaceAll(serverURL, "{"+name+"}", fmt.Sprint(variable["default"]))
+	}
+	return serverURL
+}
+
+// Operations returns the operations of the spec, ordered by path and method
+func (s *Spec) Operations() []Operation {
+	paths, _ := s.doc["paths"].(map[string]interface{})
+	names := make([]string, 0, len(paths))
+	for path := range paths {
+		names = append(names, path)
+	}
+	sort.Strings(names)
+
+	var operations []Operation
+	for _, path := range names {
+		item, _ := s.resolve(paths[path], 0).(map[string]interface{})
+		for _, method := range methods {
+			op, ok := item[method].(map[string]interface{})
+			if !ok {
+				continue
+			}
+			operations = append(operations, s.operation(path, method, item, op))
+		}
+	}
+	return operations
+}
+
+// Operation returns the operation with the ID
+func (s *Spec) Operation(id string) (Operation, bool) {
+	for _, op := range s.Operations() {
+		if op.ID == id {
+			return op, true
+		}
+	}
+	return Operation{}, false
+}
+
+// operation converts an operation object of the path item
+func (s *Spec) operation(path, method string, item, op map[string]interface{}) Operation {
+	operation := Operation{
+		Method:      strings.ToUpper(method),
+		Path:        path,
+		Summary:     stringValue(op["summary"]),
+		Description: stringValue(op["description"]),
+	}
+	operation.ID = stringValue(op["operationId"])
+	if operation.ID == "" {
+		operation.ID = sanitizeName(method + path)
+	}
+
+	// Parameters of the operation override those of the path with the same
+	// name and location
+	params := map[string]Parameter{}
+	var order []string
+	for _, list := range []interface{}{item["parameters"], op["parameters"]} {
+		entries, _ := list.([]interface{})
+		for _, entry := range entries {
+			p, _ := s.resolve(entry, 0).(map[string]interface{})
+			param := Parameter{
+				Name:        stringValue(p["name"]),
+				In:          stringValue(p["in"]),
+				Description: stringValue(p["description"]),
+				Required:    p["required"] == true || p["in"] == "path",
+			}
+			if param.Name == "" || (param.In != "path" && param.In != "query" && param.In != "header") {
+				continue
+			}
+			param.Schema, _ = s.resolve(p["schema"], 0).(map[string]interface{})
+
+			key := param.In + " " + param.Name
+			if _, ok := params[key]; !ok {
+				order = append(order, key)
+			}
+			params[key] = param
+		}
+	}
+	for _, key := range order {
+		operation.Parameters = append(operation.Parameters, params[key])
+	}
+
+	body, _ := s.resolve(op["requestBody"], 0).(map[string]interface{})
+	content, _ := body["content"].(map[string]interface{})
+	for mediaType, media := range content {
+		if mediaType != "application/json" && !strings.HasSuffix(mediaType, "+json") {
+			continue
+		}
+		m, _ := media.(map[string]interface{})
+		schema, ok := s.resolve(m["schema"], 0).(map[string]interface{})
+		if !ok {
+			schema = map[string]interface{}{}
+		}
+		operation.Body = schema
+		operation.BodyRequired = body["required"] == true
+		break
+	}
+
+	return operation
+}
+
+// Safe reports whether the operation only reads data, according to the
+// semantics of its method
+func (op Operation) Safe() bool {
+	switch op.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	}
+	return false
+}
+
+// Summarize describes the operation for the model: its method and path,
+// followed by its summary and description
+func (op Operation) Summarize() string {
+	parts := []string{op.Method + " " + op.Path}
+	for _, text := range []string{op.Summary, op.Description} {
+		if text = strings.TrimSpace(text); text != "" {
+			parts = append(parts, text)
+		}
+	}
+	return strings.Join(parts, ": ")
+}
+
+// Schema returns the JSON Schema of the arguments of the operation: an
+// object with a property per parameter, and the request body as "body"
+func (op Operation) Schema() json.RawMessage {
+	properties := map[string]interface{}{}
+	var required []string
+	for _, p := range op.Parameters {
+		schema := map[string]interface{}{"type": "string"}
+		if p.Schema != nil {
+			schema = make(map[string]interface{}, len(p.Schema)+1)
+			for key, value := range p.Schema {
+				schema[key] = value
+			}
+		}
+		if p.Description != "" {
+			schema["description"] = p.Description
+		}
+		properties[p.Name] = schema
+		if p.Required {
+			required = append(required, p.Name)
+		}
+	}
+	if op.Body != nil {
+		properties["body"] = op.Body
+		if op.BodyRequired {
+			required = append(required, "body")
+		}
+	}
+
+	schema := map[string]interface{}{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	data, _ := json.Marshal(schema)
+	return data
+}
+
+// NewRequest creates the request of the operation from the arguments the
+// model generated for its Schema. Paths of the operation are relative to
+// baseURL.
+func (op Operation) NewRequest(ctx context.Context, baseURL string, arguments json.RawMessage) (*http.Request, error) {
+	args := map[string]json.RawMessage{}
+	if len(bytes.TrimSpace(arguments)) > 0 {
+		if err := json.Unmarshal(arguments, &args); err != nil {
+			return nil, fmt.Errorf("the arguments must be a JSON object: %w", err)
+		}
+	}
+
+	path := op.Path
+	query := url.Values{}
+	header := http.Header{}
+	for _, p := range op.Parameters {
+		raw, ok := args[p.Name]
+		if !ok || string(raw) == "null" {
+			if p.Required {
+				return nil, fmt.Errorf("the parameter %s is required", p.Name)
+			}
+			continue
+		}
+
+		values := argumentValues(raw)
+		switch p.In {
+		case "path":
+			path = strings.ReplaceAll(path, "{"+p.Name+"}", url.PathEscape(strings.Join(values, ",")))
+		case "query":
+			query[p.Name] = values
+		case "header":
+			header.Set(p.Name, strings.Join(values, ","))
+		}
+	}
+
+	var body []byte
+	if raw, ok := args["body"]; ok && op.Body != nil && string(raw) != "null" {
+		body = raw
+	} else if op.BodyRequired {
+		return nil, fmt.Errorf("the request body is required")
+	}
+
+	target := strings.TrimSuffix(baseURL, "/") + path
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, op.Method, target, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header = header
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	return req, nil
+}
+
+// Auth types
+const (
+	AuthBearer = "bearer"
+	AuthBasic  = "basic"
+	AuthHeader = "header"
+	AuthQuery  = "query"
+)
+
+// Auth authenticates the requests to an API
+type Auth struct {
+	// Type is bearer, basic, header or query; empty sends no credentials
+	Type string
+
+	// Name is the name of the header or query parameter of the token
+	Name string
+
+	// Token is the bearer token or the value of the header or query
+	// parameter
+	Token string
+
+	// Username and Password are the credentials of basic auth
+	Username string
+	Password string
+}
+
+// Apply adds the credentials to the request
+func (a Auth) Apply(req *http.Request) {
+	switch a.Type {
+	case AuthBearer:
+		req.Header.Set("Authorization", "Bearer "+a.Token)
+	case AuthBasic:
+		req.SetBasicAuth(a.Username, a.Password)
+	case AuthHeader:
+		req.Header.Set(a.Name, a.Token)
+	case AuthQuery:
+		query := req.URL.Query()
+		query.Set(a.Name, a.Token)
+		req.URL.RawQuery = query.Encode()
+	}
+}
+
+// ToolName returns the name of the tool of an operation of the API, made of
+// the characters and length function names may have
+func ToolName(api, operationID string) string {
+	name := sanitizeName(api + "_" + operationID)
+	if len(name) > 64 {
+		name = name[:64]
+	}
+	return name
+}
+
+// argumentValues returns the values of an argument: the elements of an
+// array, or a single value. Strings are unquoted, other values are used as
+// they are written in JSON.
+func argumentValues(raw json.RawMessage) []string {
+	var list []json.RawMessage
+	if json.Unmarshal(raw, &list) != nil {
+		list = []json.RawMessage{raw}
+	}
+
+	values := make([]string, len(list))
+	for i, item := range list {
+		var s string
+		if json.Unmarshal(item, &s) == nil {
+			values[i] = s
+		} else {
+			values[i] = string(item)
+		}
+	}
+	return values
+}
+
+// resolve returns the node with its local $refs replaced by what they refer
+// to. Refs to other documents and refs nested deeper than maxRefDepth are
+// replaced by an empty schema.
+func (s *Spec) resolve(node interface{}, depth int) interface{} {
+	switch n := node.(type) {
+	case map[string]interface{}:
+		if ref, ok := n["$ref"].(string); ok {
+			target, found := s.lookup(ref)
+			if !found || depth >= maxRefDepth {
+				return map[string]interface{}{}
+			}
+			return s.resolve(target, depth+1)
+		}
+		resolved := make(map[string]interface{}, len(n))
+		for key, value := range n {
+			resolved[key] = s.resolve(value, depth)
+		}
+		return resolved
+	case []interface{}:
+		resolved := make([]interface{}, len(n))
+		for i, value := range n {
+			resolved[i] = s.resolve(value, depth)
+		}
+		return resolved
+	}
+	return node
+}
+
+// lookup returns the node a local $ref such as #/components/schemas/Pet
+// refers to
+func (s *Spec) lookup(ref string) (interface{}, bool) {
+	if !strings.HasPrefix(ref, "#/") {
+		return nil, false
+	}
+
+	var node interface{} = s.doc
+	for _, name := range strings.Split(strings.TrimPrefix(ref, "#/"), "/") {
+		name = strings.ReplaceAll(strings.ReplaceAll(name, "~1", "/"), "~0", "~")
+		m, ok := node.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if node, ok = m[name]; !ok {
+			return nil, false
+		}
+	}
+	return node, true
+}
+
+// normalize converts mappings with keys that aren't strings, such as the
+// status codes of responses, to mappings with string keys
+func normalize(node interface{}) interface{} {
+	switch n := node.(type) {
+	case map[string]interface{}:
+		for key, value := range n {
+			n[key] = normalize(value)
+		}
+		return n
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(n))
+		for key, value := range n {
+			m[fmt.Sprint(key)] = normalize(value)
+		}
+		return m
+	case []interface{}:
+		for i, value := range n {
+			n[i] = normalize(value)
+		}
+	}
+	return node
+}
+
+// invalidNameChars matches the characters tool names can't contain
+var invalidNameChars = regexp.MustCompile(`[^A-Za-z0-9_-]+`)
+
+// sanitizeName replaces the characters tool names can't contain
+func sanitizeName(name string) string {
+	return strings.Trim(invalidNameChars.ReplaceAllString(name, "_"), "_")
+}
+
+// stringValue returns the value if it is a string
+func stringValue(value interface{}) string {
+	s, _ := value.(string)
+	return s
+}
@@ -0,0 +1,193 @@
+package openapi
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// petstore is a small spec with refs, path parameters and a request body
+const petstore = `openapi: 3.0.3
+info:
+  title: Petstore
+servers:
+  - url: https://{region}.pets.example.com/v1
+    variables:
+      region:
+        default: eu
+paths:
+  /pets:
+    get:
+      operationId: listPets
+      summary: List all pets
+      parameters:
+        - $ref: '#/components/parameters/limit'
+        - name: tag
+          in: query
+          schema:
+            type: array
+            items:
+              type: string
+        - name: session
+          in: cookie
+      responses:
+        200:
+          description: The pets
+    post:
+      summary: Create a pet
+      requestBody:
+        required: true
+        content:
+          application/json:
+            schema:
+              $ref: '#/components/schemas/Pet'
+  /pets/{petId}:
+    parameters:
+      - name: petId
+        in: path
+        description: ID of the pet
+        schema:
+          type: integer
+    get:
+      operationId: showPetById
+      parameters:
+        - name: X-Trace
+          in: header
+          schema:
+            type: string
+components:
+  parameters:
+    limit:
+      name: limit
+      in: query
+      schema:
+        type: integer
+  schemas:
+    Pet:
+      type: object
+      required: [name]
+      properties:
+        name:
+          type: string
+        parent:
+          $ref: '#/components/schemas/Pet'
+`
+
+// TestParse tests reading operations with their parameters and bodies
+func TestParse(t *testing.T) {
+	spec, err := Parse([]byte(petstore))
+	require.NoError(t, err)
+	assert.Equal(t, "Petstore", spec.Title())
+	assert.Equal(t, "https://eu.pets.example.com/v1", spec.ServerURL())
+
+	ops := spec.Operations()
+	require.Len(t, ops, 3)
+	assert.Equal(t, "listPets", ops[0].ID)
+	assert.Equal(t, "post_pets", ops[1].ID)
+	assert.Equal(t, "showPetById", ops[2].ID)
+
+	// Refs are resolved and cookie parameters are skipped
+	require.Len(t, ops[0].Parameters, 2)
+	assert.Equal(t, Parameter{Name: "limit", In: "query", Schema: map[string]interface{}{"type": "integer"}}, ops[0].Parameters[0])
+	assert.True(t, ops[0].Safe())
+
+	assert.Equal(t, "POST", ops[1].Method)
+	assert.True(t, ops[1].BodyRequired)
+	assert.Equal(t, []interface{}{"name"}, ops[1].Body["required"])
+	assert.False(t, ops[1].Safe())
+
+	// Path parameters are inherited and always required
+	op, ok := spec.Operation("showPetById")
+	require.True(t, ok)
+	assert.Equal(t, "GET /pets/{petId}", op.Summarize())
+	assert.JSONEq(t, `{"type":"object","properties":{
+		"petId":{"type":"integer","description":"ID of the pet"},
+		"X-Trace":{"type":"string"}
+	},"required":["petId"]}`, string(op.Schema()))
+
+	_, ok = spec.Operation("deletePet")
+	assert.False(t, ok)
+}
+
+// TestParseInvalid tests rejecting documents that aren't OpenAPI 3 specs
+func TestParseInvalid(t *testing.T) {
+	_, err := Parse([]byte(`swagger: "2.0"`))
+	assert.ErrorContains(t, err, "Swagger 2.0")
+
+	_, err = Parse([]byte(`{"openapi": "2.5"}`))
+	assert.ErrorContains(t, err, "not an OpenAPI 3 spec")
+
+	_, err = Parse([]byte(`- a list`))
+	assert.Error(t, err)
+}
+
+// TestNewRequest tests building requests from the arguments of the model
+func TestNewRequest(t *testing.T) {
+	spec, err := Parse([]byte(petstore))
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	op, _ := spec.Operation("listPets")
+	req, err := op.NewRequest(ctx, "https://api.example.com/v1/", json.RawMessage(`{"limit":10,"tag":["cat","small dog"]}`))
+	require.NoError(t, err)
+	assert.Equal(t, "GET", req.Method)
+	assert.Equal(t, "https://api.example.com/v1/pets?limit=10&tag=cat&tag=small+dog", req.URL.String())
+
+	op, _ = spec.Operation("showPetById")
+	req, err = op.NewRequest(ctx, "https://api.example.com", json.RawMessage(`{"petId":"a/b","X-Trace":"abc"}`))
+	require.NoError(t, err)
+	assert.Equal(t, "https://api.example.com/pets/a%2Fb", req.URL.String())
+	assert.Equal(t, "abc", req.Header.Get("X-Trace"))
+
+	_, err = op.NewRequest(ctx, "https://api.example.com", json.RawMessage(`{}`))
+	assert.EqualError(t, err, "the parameter petId is required")
+
+	op, _ = spec.Operation("post_pets")
+	req, err = op.NewRequest(ctx, "https://api.example.com", json.RawMessage(`{"body":{"name":"Rex"}}`))
+	require.NoError(t, err)
+	assert.Equal(t, "application/json", req.Header.Get("Content-Type"))
+	body, _ := io.ReadAll(req.Body)
+	assert.JSONEq(t, `{"name":"Rex"}`, string(body))
+
+	_, err = op.NewRequest(ctx, "https://api.example.com", nil)
+	assert.EqualError(t, err, "the request body is required")
+}
+
+// TestAuth tests adding credentials to requests
+func TestAuth(t *testing.T) {
+	newRequest := func() *http.Request {
+		req, _ := http.NewRequest("GET", "https://api.example.com/pets?limit=1", nil)
+		return req
+	}
+
+	req := newRequest()
+	Auth{Type: AuthBearer, Token: "secret"}.Apply(req)
+	assert.Equal(t, "Bearer secret", req.Header.Get("Authorization"))
+
+	req = newRequest()
+	Auth{Type: AuthBasic, Username: "me", Password: "pw"}.Apply(req)
+	user, password, ok := req.BasicAuth()
+	assert.True(t, ok)
+	assert.Equal(t, "me:pw", user+":"+password)
+
+	req = newRequest()
+	Auth{Type: AuthHeader, Name: "X-API-Key", Token: "secret"}.Apply(req)
+	assert.Equal(t, "secret", req.Header.Get("X-API-Key"))
+
+	req = newRequest()
+	Auth{Type: AuthQuery, Name: "key", Token: "secret"}.Apply(req)
+	assert.Equal(t, "key=secret&limit=1", req.URL.RawQuery)
+}
+
+// TestToolName tests that tool names only contain valid characters
+func TestToolName(t *testing.T) {
+	assert.Equal(t, "petstore_listPets", ToolName("petstore", "listPets"))
+	assert.Equal(t, "my-api_get_pets_id", ToolName("my-api", "get /pets/{id}"))
+	assert.Len(t, ToolName("api", strings.Repeat("x", 100)), 64)
+}
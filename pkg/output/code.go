@@ -0,0 +1,93 @@
+package output
+
+import "strings"
+
+// CodeBlock is a fenced code block of a markdown answer
+type CodeBlock struct {
+	// Language is the first word of the info string after the opening
+	// fence, e.g. "go" or "bash"; empty if none was given
+	Language string
+
+	// Code is the content between the fences without the indentation of
+	// the fence, ending with a newline
+	Code string
+}
+
+// CodeBlocks returns the fenced code blocks of an answer in order. Fences are
+// three or more backticks or tildes, and a block is closed by a fence of the
+// same character that is at least as long. A block that isn't closed runs to
+// the end of the answer, as an answer may be cut off.
+func CodeBlocks(answer string) []CodeBlock {
+	var blocks []CodeBlock
+	var current *CodeBlock
+	var fence string
+	var indent int
+	var code strings.Builder
+
+	answer = strings.ReplaceAll(answer, "\r\n", "\n")
+	for _, line := range strings.SplitAfter(answer, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if current == nil {
+			if open := openingFence(trimmed); open != "" {
+				current = &CodeBlock{Language: language(trimmed[len(open):])}
+				fence = open
+				indent = len(line) - len(strings.TrimLeft(line, " "))
+				code.Reset()
+			}
+			continue
+		}
+
+		if strings.HasPrefix(trimmed, fence) && strings.Trim(trimmed, fence[:1]) == "" {
+			current.Code = code.String()
+			blocks = append(blocks, *current)
+			current = nil
+			continue
+		}
+		code.WriteString(unindent(line, indent))
+	}
+
+	if current != nil && code.Len() > 0 {
+		current.Code = code.String()
+		if !strings.HasSuffix(current.Code, "\n") {
+			current.Code += "\n"
+		}
+		blocks = append(blocks, *current)
+	}
+	return blocks
+}
+
+// openingFence returns the fence a line opens a code block with, or an empty
+// string if it doesn't open one
+func openingFence(line string) string {
+	for _, char := range []string{"`", "~"} {
+		fence := line[:len(line)-len(strings.TrimLeft(line, char))]
+		if len(fence) < 3 {
+			continue
+		}
+		// Backtick fences can't have backticks in the info string
+		if char == "`" && strings.Contains(line[len(fence):], "`") {
+			return ""
+		}
+		return fence
+	}
+	return ""
+}
+
+// unindent removes up to n spaces from the start of line, the indentation of
+// the fence of its block
+func unindent(line string, n int) string {
+	for i := 0; i < n && strings.HasPrefix(line, " "); i++ {
+		line = line[1:]
+	}
+	return line
+}
+
+// language returns the language of an info string, e.g. "python" of
+// "python title=example.py"
+func language(info string) string {
+	fields := strings.Fields(info)
+	if len(fields) == 0 {
+		return ""
+	}
+	return strings.Trim(fields[0], "{}.")
+}
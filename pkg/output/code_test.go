@@ -0,0 +1,64 @@
+package output
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestCodeBlocks tests extracting the fenced code blocks of answers
+func TestCodeBlocks(t *testing.T) {
+	testCases := []struct {
+		name   string
+		answer string
+		want   []CodeBlock
+	}{
+		{
+			name:   "No code",
+			answer: "Paris is the capital of France.",
+		},
+		{
+			name:   "Blocks with languages",
+			answer: "Sum the column:\n\n```awk\n{ s += $2 } END { print s }\n```\n\nOr in Python:\n\n```python title=sum.py\nprint(sum(rows))\n```\n",
+			want: []CodeBlock{
+				{Language: "awk", Code: "{ s += $2 } END { print s }\n"},
+				{Language: "python", Code: "print(sum(rows))\n"},
+			},
+		},
+		{
+			name:   "Without language",
+			answer: "```\nls -la\n\n```",
+			want:   []CodeBlock{{Code: "ls -la\n\n"}},
+		},
+		{
+			name:   "Longer fence containing a shorter one",
+			answer: "````markdown\n```go\nfmt.Println()\n```\n````\n",
+			want:   []CodeBlock{{Language: "markdown", Code: "```go\nfmt.Println()\n```\n"}},
+		},
+		{
+			name:   "Tildes and indentation",
+			answer: "1. Run:\n   ~~~ {.sh}\n   make\n     -j4\n   ~~~\n",
+			want:   []CodeBlock{{Language: "sh", Code: "make\n  -j4\n"}},
+		},
+		{
+			name:   "Carriage returns",
+			answer: "```bash\r\necho hi\r\n```\r\n",
+			want:   []CodeBlock{{Language: "bash", Code: "echo hi\n"}},
+		},
+		{
+			name:   "Inline backticks are no fence",
+			answer: "Use ```go``` blocks.",
+		},
+		{
+			name:   "Cut off",
+			answer: "```sql\nSELECT *\nFROM users",
+			want:   []CodeBlock{{Language: "sql", Code: "SELECT *\nFROM users\n"}},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, CodeBlocks(tc.answer))
+		})
+	}
+}
@@ -0,0 +1,123 @@
+package output
+
+import (
+	"encoding/json"
+	"io"
+	"math"
+	"sync"
+
+	"github.com/Turee/si/pkg/llm"
+)
+
+// JSON output is part of the scripting interface of si, the field names and
+// event types must stay stable.
+
+// jsonMetadata holds the metadata of a response in JSON output
+type jsonMetadata struct {
+	ConversationID string     `json:"conversation_id"`
+	ID             string     `json:"id,omitempty"`
+	Model          string     `json:"model"`
+	Provider       string     `json:"provider,omitempty"`
+	FinishReason   string     `json:"finish_reason,omitempty"`
+	Usage          *llm.Usage `json:"usage"`
+	LatencyMS      int64      `json:"latency_ms"`
+	Cached         string     `json:"cached,omitempty"`
+	Sources        []Source   `json:"sources,omitempty"`
+
+	// Timings for comparing providers; latency_ms is the same as
+	// total_duration_ms and kept for existing scripts
+	TimeToFirstTokenMS int64   `json:"time_to_first_token_ms,omitempty"`
+	TokensPerSecond    float64 `json:"tokens_per_second,omitempty"`
+	TotalDurationMS    int64   `json:"total_duration_ms"`
+}
+
+// newJSONMetadata returns the metadata of the response. The usage is nil if
+// the provider didn't report it.
+func newJSONMetadata(response Response) *jsonMetadata {
+	metadata := &jsonMetadata{
+		ConversationID: response.ConversationID,
+		ID:             response.ID,
+		Model:          response.Model,
+		Provider:       response.Provider,
+		FinishReason:   response.FinishReason,
+		LatencyMS:      response.Duration.Milliseconds(),
+		Cached:         response.Cached,
+		Sources:        response.Sources,
+
+		TimeToFirstTokenMS: response.TimeToFirstToken.Milliseconds(),
+		TokensPerSecond:    math.Round(response.TokensPerSecond*10) / 10,
+		TotalDurationMS:    response.Duration.Milliseconds(),
+	}
+	if response.Usage != (llm.Usage{}) {
+		usage := response.Usage
+		metadata.Usage = &usage
+	}
+	return metadata
+}
+
+// jsonResponse is a complete response in JSON output
+type jsonResponse struct {
+	Answer string `json:"answer"`
+	*jsonMetadata
+}
+
+// WriteJSON writes the response as a single JSON object on one line. The
+// usage is null if the provider didn't report it.
+func WriteJSON(w io.Writer, response Response) error {
+	return json.NewEncoder(w).Encode(jsonResponse{Answer: response.Content, jsonMetadata: newJSONMetadata(response)})
+}
+
+// Types of the events written by EventWriter
+const (
+	// EventDelta carries a chunk of the answer
+	EventDelta = "delta"
+
+	// EventDone ends the stream with the metadata of the response
+	EventDone = "done"
+)
+
+// jsonEvent is a line of newline-delimited JSON output
+type jsonEvent struct {
+	Type    string `json:"type"`
+	Content string `json:"content,omitempty"`
+	*jsonMetadata
+}
+
+// EventWriter writes a streamed answer as newline-delimited JSON: a delta
+// event for every chunk and a done event with the metadata of the response.
+// Concatenating the content of the delta events gives the answer.
+type EventWriter struct {
+	mu       sync.Mutex
+	enc      *json.Encoder
+	streamed bool
+}
+
+// NewEventWriter creates a new EventWriter writing to w
+func NewEventWriter(w io.Writer) *EventWriter {
+	return &EventWriter{enc: json.NewEncoder(w)}
+}
+
+// WriteDelta writes a chunk of the answer
+func (e *EventWriter) WriteDelta(content string) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.streamed = true
+	return e.enc.Encode(jsonEvent{Type: EventDelta, Content: content})
+}
+
+// WriteDone ends the stream. If no chunks were written, e.g. because the
+// answer wasn't streamed, the whole answer is written as a single delta
+// first, so consumers always get the answer from delta events.
+func (e *EventWriter) WriteDone(response Response) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if !e.streamed && response.Content != "" {
+		if err := e.enc.Encode(jsonEvent{Type: EventDelta, Content: response.Content}); err != nil {
+			return err
+		}
+	}
+	e.streamed = true
+	return e.enc.Encode(jsonEvent{Type: EventDone, jsonMetadata: newJSONMetadata(response)})
+}
@@ -0,0 +1,67 @@
+package output
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Turee/si/pkg/llm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestWriteJSON tests writing responses as JSON objects
+func TestWriteJSON(t *testing.T) {
+	var out strings.Builder
+	require.NoError(t, WriteJSON(&out, Response{
+		ConversationID: "c0ffee",
+		ID:             "chatcmpl-1",
+		Model:          "gpt-4o",
+		Prompt:         "capital of France?",
+		Content:        "Paris",
+		FinishReason:   "stop",
+		Usage:          llm.Usage{PromptTokens: 12, CompletionTokens: 1, TotalTokens: 13},
+		Duration:       1500 * time.Millisecond,
+
+		TimeToFirstToken: 400 * time.Millisecond,
+		TokensPerSecond:  52.345,
+	}))
+	assert.Equal(t, `{"answer":"Paris","conversation_id":"c0ffee","id":"chatcmpl-1","model":"gpt-4o","finish_reason":"stop",`+
+		`"usage":{"prompt_tokens":12,"completion_tokens":1,"total_tokens":13},"latency_ms":1500,`+
+		`"time_to_first_token_ms":400,"tokens_per_second":52.3,"total_duration_ms":1500}`+"\n", out.String())
+
+	// Routers like OpenRouter report the upstream provider
+	out.Reset()
+	require.NoError(t, WriteJSON(&out, Response{ConversationID: "c0ffee", Model: "openai/gpt-4o", Provider: "Azure", Content: "Paris"}))
+	assert.Contains(t, out.String(), `"model":"openai/gpt-4o","provider":"Azure",`)
+
+	// Unknown usage is null rather than zero
+	out.Reset()
+	require.NoError(t, WriteJSON(&out, Response{ConversationID: "c0ffee", Model: "gpt-4o", Content: "Paris", Cached: "exact"}))
+	assert.Equal(t, `{"answer":"Paris","conversation_id":"c0ffee","model":"gpt-4o","usage":null,"latency_ms":0,"cached":"exact","total_duration_ms":0}`+"\n", out.String())
+
+	// Sources are listed in the order of their footnotes
+	out.Reset()
+	sources := []Source{{URL: "https://go.dev/doc"}, {Path: "main.go", Line: 12}}
+	require.NoError(t, WriteJSON(&out, Response{ConversationID: "c0ffee", Model: "gpt-4o", Content: "Paris", Sources: sources}))
+	assert.Contains(t, out.String(), `"sources":[{"url":"https://go.dev/doc"},{"path":"main.go","line":12}]`)
+}
+
+// TestEventWriter tests writing streamed answers as JSON events
+func TestEventWriter(t *testing.T) {
+	var out strings.Builder
+	events := NewEventWriter(&out)
+	require.NoError(t, events.WriteDelta("Par"))
+	require.NoError(t, events.WriteDelta("is"))
+	require.NoError(t, events.WriteDone(Response{ConversationID: "c0ffee", Model: "gpt-4o", Content: "Paris", FinishReason: "stop"}))
+	assert.Equal(t, `{"type":"delta","content":"Par"}`+"\n"+
+		`{"type":"delta","content":"is"}`+"\n"+
+		`{"type":"done","conversation_id":"c0ffee","model":"gpt-4o","finish_reason":"stop","usage":null,"latency_ms":0,"total_duration_ms":0}`+"\n", out.String())
+
+	// Answers that weren't streamed are written as a single delta
+	out.Reset()
+	events = NewEventWriter(&out)
+	require.NoError(t, events.WriteDone(Response{ConversationID: "c0ffee", Model: "gpt-4o", Content: "Paris"}))
+	assert.Equal(t, `{"type":"delta","content":"Paris"}`+"\n"+
+		`{"type":"done","conversation_id":"c0ffee","model":"gpt-4o","usage":null,"latency_ms":0,"total_duration_ms":0}`+"\n", out.String())
+}
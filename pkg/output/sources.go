@@ -0,0 +1,51 @@
+package output
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// Source is a file or URL an answer is based on, cited in footnotes after the
+// answer so it can be verified
+type Source struct {
+	// URL is the address of a fetched page
+	URL string `json:"url,omitempty"`
+
+	// Path is the path of a file that was read
+	Path string `json:"path,omitempty"`
+
+	// Line is the first line of the part of the file that was used, zero if
+	// the whole file was used
+	Line int `json:"line,omitempty"`
+}
+
+// String returns the URL of the source, or its path with the line number
+func (s Source) String() string {
+	switch {
+	case s.URL != "":
+		return s.URL
+	case s.Line > 0:
+		return s.Path + ":" + strconv.Itoa(s.Line)
+	default:
+		return s.Path
+	}
+}
+
+// WriteFootnotes writes the sources as a numbered list after an answer. It
+// writes nothing if there are no sources.
+func WriteFootnotes(w io.Writer, sources []Source) error {
+	if len(sources) == 0 {
+		return nil
+	}
+
+	if _, err := io.WriteString(w, "\nSources:\n"); err != nil {
+		return err
+	}
+	for i, source := range sources {
+		if _, err := fmt.Fprintf(w, "[%d] %s\n", i+1, source); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,20 @@
+package output
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestWriteFootnotes tests listing the sources of an answer
+func TestWriteFootnotes(t *testing.T) {
+	var out strings.Builder
+	require.NoError(t, WriteFootnotes(&out, nil))
+	assert.Empty(t, out.String())
+
+	sources := []Source{{URL: "https://go.dev/doc"}, {Path: "main.go", Line: 12}, {Path: "README.md"}}
+	require.NoError(t, WriteFootnotes(&out, sources))
+	assert.Equal(t, "\nSources:\n[1] https://go.dev/doc\n[2] main.go:12\n[3] README.md\n", out.String())
+}
@@ -0,0 +1,123 @@
+package output
+
+import (
+	"bytes"
+	"io"
+	"sync"
+)
+
+// FlushMode controls at which boundaries streamed output is written out
+type FlushMode int
+
+const (
+	// FlushChunk writes every chunk as soon as it arrives
+	FlushChunk FlushMode = iota
+
+	// FlushSentence buffers output until the end of a line or sentence
+	FlushSentence
+
+	// FlushLine buffers output until a complete line is available
+	FlushLine
+)
+
+// maxBuffered is the amount of output buffered before it is written out
+// regardless of boundaries, so very long lines still make progress
+const maxBuffered = 64 * 1024
+
+// StreamWriter writes streamed chunks to an underlying writer, flushing them
+// at boundaries determined by its FlushMode. All writes are serialized so
+// diagnostics emitted through Exclusive never end up in the middle of a
+// partially written line.
+type StreamWriter struct {
+	mu   sync.Mutex
+	out  io.Writer
+	mode FlushMode
+	buf  []byte
+}
+
+// NewStreamWriter creates a new StreamWriter writing to out
+func NewStreamWriter(out io.Writer, mode FlushMode) *StreamWriter {
+	return &StreamWriter{out: out, mode: mode}
+}
+
+// Write buffers p and writes out everything up to the last flush boundary
+func (w *StreamWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.mode == FlushChunk {
+		return w.out.Write(p)
+	}
+
+	w.buf = append(w.buf, p...)
+
+	n := w.boundary()
+	if n == 0 && len(w.buf) >= maxBuffered {
+		n = len(w.buf)
+	}
+	if n > 0 {
+		if err := w.writeBuffered(n); err != nil {
+			return 0, err
+		}
+	}
+
+	return len(p), nil
+}
+
+// WriteString writes a string chunk
+func (w *StreamWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// Flush writes out any buffered output
+func (w *StreamWriter) Flush() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.writeBuffered(len(w.buf))
+}
+
+// Exclusive runs fn while no stream output is being written, so anything fn
+// prints (e.g. to stderr) is ordered between complete flushed segments
+func (w *StreamWriter) Exclusive(fn func()) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	fn()
+}
+
+// writeBuffered writes the first n buffered bytes
+func (w *StreamWriter) writeBuffered(n int) error {
+	if n == 0 {
+		return nil
+	}
+
+	_, err := w.out.Write(w.buf[:n])
+	w.buf = append(w.buf[:0], w.buf[n:]...)
+	return err
+}
+
+// boundary returns the length of the buffered prefix that ends at the last
+// flush boundary, or 0 if there is none
+func (w *StreamWriter) boundary() int {
+	if w.mode == FlushLine {
+		return bytes.LastIndexByte(w.buf, '\n') + 1
+	}
+
+	for i := len(w.buf) - 1; i >= 0; i-- {
+		switch w.buf[i] {
+		case '\n':
+			return i + 1
+		case ' ':
+			if i > 0 && isSentenceEnd(w.buf[i-1]) {
+				return i + 1
+			}
+		}
+	}
+
+	return 0
+}
+
+func isSentenceEnd(c byte) bool {
+	return c == '.' || c == '!' || c == '?' || c == ':' || c == ';'
+}
@@ -0,0 +1,78 @@
+package output
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recordingWriter records every individual write
+type recordingWriter struct {
+	writes []string
+}
+
+func (r *recordingWriter) Write(p []byte) (int, error) {
+	r.writes = append(r.writes, string(p))
+	return len(p), nil
+}
+
+func writeChunks(t *testing.T, w *StreamWriter, chunks ...string) {
+	t.Helper()
+	for _, chunk := range chunks {
+		_, err := w.WriteString(chunk)
+		require.NoError(t, err)
+	}
+	require.NoError(t, w.Flush())
+}
+
+// TestStreamWriterChunk tests that chunk mode writes every chunk immediately
+func TestStreamWriterChunk(t *testing.T) {
+	out := &recordingWriter{}
+	writeChunks(t, NewStreamWriter(out, FlushChunk), "Hel", "lo\nwor", "ld")
+
+	assert.Equal(t, []string{"Hel", "lo\nwor", "ld"}, out.writes)
+}
+
+// TestStreamWriterLine tests that line mode only writes complete lines
+func TestStreamWriterLine(t *testing.T) {
+	out := &recordingWriter{}
+	writeChunks(t, NewStreamWriter(out, FlushLine), "first ", "line\nsecond", " line\nthird", " line")
+
+	assert.Equal(t, []string{"first line\n", "second line\n", "third line"}, out.writes)
+}
+
+// TestStreamWriterSentence tests that sentence mode writes at sentence and line ends
+func TestStreamWriterSentence(t *testing.T) {
+	out := &recordingWriter{}
+	writeChunks(t, NewStreamWriter(out, FlushSentence), "One. Tw", "o! Three", "\nfour", " five")
+
+	assert.Equal(t, []string{"One. ", "Two! ", "Three\n", "four five"}, out.writes)
+}
+
+// TestStreamWriterLongLine tests that very long lines are still written out
+func TestStreamWriterLongLine(t *testing.T) {
+	out := &recordingWriter{}
+	w := NewStreamWriter(out, FlushLine)
+
+	_, err := w.WriteString(strings.Repeat("x", maxBuffered))
+	require.NoError(t, err)
+	assert.Len(t, out.writes, 1)
+}
+
+// TestStreamWriterExclusive tests that diagnostics are ordered between flushed lines
+func TestStreamWriterExclusive(t *testing.T) {
+	var combined bytes.Buffer
+	w := NewStreamWriter(&combined, FlushLine)
+
+	_, err := w.WriteString("partial")
+	require.NoError(t, err)
+	w.Exclusive(func() {
+		combined.WriteString("[warning]\n")
+	})
+	writeChunks(t, w, " line\n")
+
+	assert.Equal(t, "[warning]\npartial line\n", combined.String())
+}
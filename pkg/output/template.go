@@ -0,0 +1,114 @@
+package output
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/Turee/si/pkg/llm"
+)
+
+// Response is an answer with its metadata, as available to output templates
+type Response struct {
+	// ConversationID identifies the invocation of si that produced the answer
+	ConversationID string
+
+	// ID is the identifier the provider assigned to the response, if any
+	ID string
+
+	// Model is the model that generated the answer
+	Model string
+
+	// Provider is the upstream provider a router like OpenRouter sent the
+	// request to, if it reports one
+	Provider string
+
+	// Prompt is the question that was sent to the model
+	Prompt string
+
+	// Content is the answer of the model
+	Content string
+
+	// FinishReason tells why the model stopped generating, if the provider
+	// reports it
+	FinishReason string
+
+	// Usage is the token usage of the request, if the provider reports it
+	Usage llm.Usage
+
+	// Duration is the time it took to get the answer
+	Duration time.Duration
+
+	// TimeToFirstToken is the time from sending the request until the first
+	// chunk of the answer arrived, if known
+	TimeToFirstToken time.Duration
+
+	// TokensPerSecond is the rate the answer was generated at after its
+	// first chunk, if known
+	TokensPerSecond float64
+
+	// Cached tells how the answer was found in the answer cache: "exact" or
+	// "similar", or empty if the model was asked
+	Cached string
+
+	// Sources are the files and URLs the answer is based on, in the order
+	// of their footnotes
+	Sources []Source
+}
+
+// templateFuncs contains the helper functions available inside output templates
+var templateFuncs = template.FuncMap{
+	"trim":  strings.TrimSpace,
+	"upper": strings.ToUpper,
+	"lower": strings.ToLower,
+	"default": func(def, value string) string {
+		if strings.TrimSpace(value) == "" {
+			return def
+		}
+		return value
+	},
+	// trunc shortens the text to at most n characters
+	"trunc": func(n int, value string) string {
+		runes := []rune(value)
+		if n < 0 || len(runes) <= n {
+			return value
+		}
+		return string(runes[:n])
+	},
+	"json": func(value interface{}) (string, error) {
+		data, err := json.Marshal(value)
+		return string(data), err
+	},
+}
+
+// Template renders responses with a Go template
+type Template struct {
+	tmpl *template.Template
+}
+
+// ParseTemplate parses an output template
+func ParseTemplate(name, text string) (*Template, error) {
+	tmpl, err := template.New(name).Funcs(templateFuncs).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse output template %q: %w", name, err)
+	}
+	return &Template{tmpl: tmpl}, nil
+}
+
+// Execute renders the response, ending the output with a newline
+func (t *Template) Execute(w io.Writer, response Response) error {
+	var out strings.Builder
+	if err := t.tmpl.Execute(&out, response); err != nil {
+		return fmt.Errorf("failed to render output template %q: %w", t.tmpl.Name(), err)
+	}
+
+	text := out.String()
+	if !strings.HasSuffix(text, "\n") {
+		text += "\n"
+	}
+	_, err := io.WriteString(w, text)
+	return err
+}
@@ -0,0 +1,55 @@
+package output
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Turee/si/pkg/llm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestTemplate tests rendering responses with output templates
+func TestTemplate(t *testing.T) {
+	response := Response{
+		Model:    "gpt-4o",
+		Prompt:   "capital of France?",
+		Content:  "The capital of France is Paris.",
+		Usage:    llm.Usage{PromptTokens: 12, CompletionTokens: 8, TotalTokens: 20},
+		Duration: 1500 * time.Millisecond,
+	}
+
+	testCases := []struct {
+		name     string
+		template string
+		expected string
+	}{
+		{name: "Fields", template: "{{.Model}}: {{.Content | trunc 10}}", expected: "gpt-4o: The capita\n"},
+		{name: "Usage", template: "{{.Usage.TotalTokens}} tokens in {{.Duration}}", expected: "20 tokens in 1.5s\n"},
+		{name: "Functions", template: "{{.Model | upper}} {{json .Prompt}}", expected: "GPT-4O \"capital of France?\"\n"},
+		{name: "Trailing newline", template: "{{.Content}}\n", expected: "The capital of France is Paris.\n"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tmpl, err := ParseTemplate("test", tc.template)
+			require.NoError(t, err)
+
+			var out strings.Builder
+			require.NoError(t, tmpl.Execute(&out, response))
+			assert.Equal(t, tc.expected, out.String())
+		})
+	}
+}
+
+// TestTemplateErrors tests that template errors name the template
+func TestTemplateErrors(t *testing.T) {
+	_, err := ParseTemplate("broken", "{{.Content")
+	assert.ErrorContains(t, err, `failed to parse output template "broken"`)
+
+	tmpl, err := ParseTemplate("unknown", "{{.Missing}}")
+	require.NoError(t, err)
+	err = tmpl.Execute(&strings.Builder{}, Response{})
+	assert.ErrorContains(t, err, `failed to render output template "unknown"`)
+}
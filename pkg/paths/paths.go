@@ -0,0 +1,205 @@
+// Package paths locates the files si keeps, following the XDG Base Directory
+// specification on Linux and the BSDs and the platform conventions on macOS
+// and Windows. The XDG variables are respected on every platform.
+package paths
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+)
+
+// goos is the operating system whose conventions are followed, it can be
+// replaced in tests
+var goos = runtime.GOOS
+
+// ConfigDir returns the directory of the configuration file: $XDG_CONFIG_HOME
+// or ~/.config, the si directory in Application Support on macOS and in
+// %AppData% on Windows
+func ConfigDir() string {
+	if dir := xdgDir("XDG_CONFIG_HOME"); dir != "" {
+		return dir
+	}
+	switch goos {
+	case "darwin":
+		return join(home(), "Library", "Application Support", "si")
+	case "windows":
+		return join(windowsDir("AppData", "Roaming"), "si")
+	}
+	return join(home(), ".config")
+}
+
+// CacheDir returns the directory of si's cached data, which can be deleted
+// at any time: $XDG_CACHE_HOME/si or ~/.cache/si, ~/Library/Caches/si on
+// macOS and %LocalAppData%\si\cache on Windows
+func CacheDir() string {
+	if dir := xdgDir("XDG_CACHE_HOME"); dir != "" {
+		return filepath.Join(dir, "si")
+	}
+	switch goos {
+	case "darwin":
+		return join(home(), "Library", "Caches", "si")
+	case "windows":
+		return join(windowsDir("LocalAppData", "Local"), "si", "cache")
+	}
+	return join(home(), ".cache", "si")
+}
+
+// StateDir returns the directory of the state si keeps between runs, such as
+// the usage log: $XDG_STATE_HOME/si or ~/.local/state/si, the si directory in
+// Application Support on macOS and %LocalAppData%\si on Windows
+func StateDir() string {
+	if dir := xdgDir("XDG_STATE_HOME"); dir != "" {
+		return filepath.Join(dir, "si")
+	}
+	return platformDataDir(".local", "state")
+}
+
+// DataDir returns the directory of data si creates for the user:
+// $XDG_DATA_HOME/si or ~/.local/share/si, and the same directories as
+// StateDir on macOS and Windows
+func DataDir() string {
+	if dir := xdgDir("XDG_DATA_HOME"); dir != "" {
+		return filepath.Join(dir, "si")
+	}
+	return platformDataDir(".local", "share")
+}
+
+// LegacyConfigDir returns the directory the configuration file was read from
+// before si followed the conventions of every platform. The legacy
+// directories only differ from the current ones on macOS and Windows, and
+// when the XDG variables are set to other directories.
+func LegacyConfigDir() string {
+	return join(home(), ".config")
+}
+
+// LegacyCacheDir returns the former directory of the answer cache
+func LegacyCacheDir() string {
+	return join(home(), ".cache", "si")
+}
+
+// LegacyStateDir returns the former directory of the usage log
+func LegacyStateDir() string {
+	return join(home(), ".local", "state", "si")
+}
+
+// Resolve returns the legacy location of a file if only the legacy file
+// exists, as it is until MoveLegacy moves it, otherwise path
+func Resolve(path, legacy string) string {
+	if legacy == "" || path == "" || exists(path) || !exists(legacy) {
+		return path
+	}
+	return legacy
+}
+
+// MoveLegacy moves the file at legacy to path, unless path exists already or
+// there is nothing to move. It reports whether the file was moved.
+func MoveLegacy(legacy, path string) (bool, error) {
+	if legacy == "" || path == "" || filepath.Clean(legacy) == filepath.Clean(path) {
+		return false, nil
+	}
+	if _, err := os.Stat(path); !errors.Is(err, fs.ErrNotExist) {
+		return false, err
+	}
+	if _, err := os.Stat(legacy); err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return false, fmt.Errorf("failed to create %s: %w", filepath.Dir(path), err)
+	}
+	if err := os.Rename(legacy, path); err == nil {
+		return true, nil
+	}
+
+	// Renaming fails across file systems, the file is copied there instead
+	if err := copyFile(legacy, path); err != nil {
+		return false, fmt.Errorf("failed to move %s to %s: %w", legacy, path, err)
+	}
+	return true, os.Remove(legacy)
+}
+
+// copyFile copies the file at src to dst with the same permissions
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		os.Remove(dst)
+		return err
+	}
+	return out.Close()
+}
+
+// exists reports whether there is a file at path
+func exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// xdgDir returns the directory of an XDG variable. Relative paths are
+// invalid according to the specification and ignored.
+func xdgDir(name string) string {
+	dir := os.Getenv(name)
+	if !filepath.IsAbs(dir) {
+		return ""
+	}
+	return dir
+}
+
+// platformDataDir returns si's directory for data and state on macOS and
+// Windows, elsewhere the directory below the home directory
+func platformDataDir(unix ...string) string {
+	switch goos {
+	case "darwin":
+		return join(home(), "Library", "Application Support", "si")
+	case "windows":
+		return join(windowsDir("LocalAppData", "Local"), "si")
+	}
+	return join(home(), append(unix, "si")...)
+}
+
+// windowsDir returns the directory in the environment variable, or its
+// default below AppData in the home directory
+func windowsDir(name, fallback string) string {
+	if dir := os.Getenv(name); dir != "" {
+		return dir
+	}
+	return join(home(), "AppData", fallback)
+}
+
+// home returns the home directory of the user, or empty if it is unknown
+func home() string {
+	dir, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return dir
+}
+
+// join joins the elements to dir, or returns empty if dir is unknown
+func join(dir string, elem ...string) string {
+	if dir == "" {
+		return ""
+	}
+	return filepath.Join(append([]string{dir}, elem...)...)
+}
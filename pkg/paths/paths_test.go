@@ -0,0 +1,114 @@
+package paths
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// setPlatform replaces the operating system and home directory for a test
+func setPlatform(t *testing.T, os, home string) {
+	t.Helper()
+	saved := goos
+	t.Cleanup(func() { goos = saved })
+	goos = os
+
+	t.Setenv("HOME", home)
+	t.Setenv("USERPROFILE", home)
+	for _, name := range []string{"XDG_CONFIG_HOME", "XDG_CACHE_HOME", "XDG_STATE_HOME", "XDG_DATA_HOME", "AppData", "LocalAppData"} {
+		t.Setenv(name, "")
+	}
+}
+
+// TestDirs tests the directories on each platform
+func TestDirs(t *testing.T) {
+	home := t.TempDir()
+
+	setPlatform(t, "linux", home)
+	assert.Equal(t, filepath.Join(home, ".config"), ConfigDir())
+	assert.Equal(t, filepath.Join(home, ".cache", "si"), CacheDir())
+	assert.Equal(t, filepath.Join(home, ".local", "state", "si"), StateDir())
+	assert.Equal(t, filepath.Join(home, ".local", "share", "si"), DataDir())
+
+	setPlatform(t, "darwin", home)
+	support := filepath.Join(home, "Library", "Application Support", "si")
+	assert.Equal(t, support, ConfigDir())
+	assert.Equal(t, filepath.Join(home, "Library", "Caches", "si"), CacheDir())
+	assert.Equal(t, support, StateDir())
+	assert.Equal(t, support, DataDir())
+
+	setPlatform(t, "windows", home)
+	assert.Equal(t, filepath.Join(home, "AppData", "Roaming", "si"), ConfigDir())
+	assert.Equal(t, filepath.Join(home, "AppData", "Local", "si", "cache"), CacheDir())
+	assert.Equal(t, filepath.Join(home, "AppData", "Local", "si"), StateDir())
+
+	t.Setenv("LocalAppData", filepath.Join(home, "local"))
+	assert.Equal(t, filepath.Join(home, "local", "si"), DataDir())
+}
+
+// TestDirsXDG tests that the XDG variables take precedence on every platform
+// and that relative paths are ignored
+func TestDirsXDG(t *testing.T) {
+	home := t.TempDir()
+	xdg := t.TempDir()
+
+	for _, platform := range []string{"linux", "darwin", "windows"} {
+		setPlatform(t, platform, home)
+		t.Setenv("XDG_CONFIG_HOME", filepath.Join(xdg, "config"))
+		t.Setenv("XDG_CACHE_HOME", filepath.Join(xdg, "cache"))
+		t.Setenv("XDG_STATE_HOME", filepath.Join(xdg, "state"))
+		t.Setenv("XDG_DATA_HOME", filepath.Join(xdg, "data"))
+
+		assert.Equal(t, filepath.Join(xdg, "config"), ConfigDir(), platform)
+		assert.Equal(t, filepath.Join(xdg, "cache", "si"), CacheDir(), platform)
+		assert.Equal(t, filepath.Join(xdg, "state", "si"), StateDir(), platform)
+		assert.Equal(t, filepath.Join(xdg, "data", "si"), DataDir(), platform)
+	}
+
+	setPlatform(t, "linux", home)
+	t.Setenv("XDG_CACHE_HOME", "relative")
+	assert.Equal(t, filepath.Join(home, ".cache", "si"), CacheDir())
+}
+
+// TestMoveLegacy tests resolving and moving a file from its legacy path
+func TestMoveLegacy(t *testing.T) {
+	dir := t.TempDir()
+	legacy := filepath.Join(dir, "old", "si.yaml")
+	path := filepath.Join(dir, "new", "si", "si.yaml")
+
+	// Nothing to move
+	assert.Equal(t, path, Resolve(path, legacy))
+	moved, err := MoveLegacy(legacy, path)
+	require.NoError(t, err)
+	assert.False(t, moved)
+
+	// Only the legacy file exists, it is used until it is moved
+	require.NoError(t, os.MkdirAll(filepath.Dir(legacy), 0755))
+	require.NoError(t, os.WriteFile(legacy, []byte("model: gpt-4o\n"), 0600))
+	assert.Equal(t, legacy, Resolve(path, legacy))
+
+	moved, err = MoveLegacy(legacy, path)
+	require.NoError(t, err)
+	assert.True(t, moved)
+	assert.NoFileExists(t, legacy)
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "model: gpt-4o\n", string(data))
+	assert.Equal(t, path, Resolve(path, legacy))
+
+	// An existing file is never replaced
+	require.NoError(t, os.WriteFile(legacy, []byte("model: gpt-4o-mini\n"), 0600))
+	assert.Equal(t, path, Resolve(path, legacy))
+	moved, err = MoveLegacy(legacy, path)
+	require.NoError(t, err)
+	assert.False(t, moved)
+	assert.FileExists(t, legacy)
+
+	// Moving a file to itself does nothing
+	moved, err = MoveLegacy(path, path)
+	require.NoError(t, err)
+	assert.False(t, moved)
+}
@@ -0,0 +1,84 @@
+// Package pricing estimates the cost of requests from their token usage
+package pricing
+
+import (
+	"strings"
+
+	"github.com/Turee/si/pkg/llm"
+)
+
+// Price is the price of a model in US dollars per million tokens
+type Price struct {
+	Input float64
+	// CachedInput is the price of prompt tokens served from the prompt
+	// cache; zero means cached tokens cost the same as other input tokens
+	CachedInput float64
+	Output      float64
+}
+
+// prices maps model name prefixes to their price. The longest matching
+// prefix wins, so dated snapshots like gpt-4o-2024-08-06 use the price of
+// their model.
+var prices = map[string]Price{
+	"gpt-3.5-turbo": {Input: 0.50, Output: 1.50},
+	"gpt-4":         {Input: 30, Output: 60},
+	"gpt-4-32k":     {Input: 60, Output: 120},
+	"gpt-4-turbo":   {Input: 10, Output: 30},
+	"gpt-4o":        {Input: 2.50, CachedInput: 1.25, Output: 10},
+	"gpt-4o-mini":   {Input: 0.15, CachedInput: 0.075, Output: 0.60},
+	"gpt-4.1":       {Input: 2, CachedInput: 0.50, Output: 8},
+	"gpt-4.1-mini":  {Input: 0.40, CachedInput: 0.10, Output: 1.60},
+	"gpt-4.1-nano":  {Input: 0.10, CachedInput: 0.025, Output: 0.40},
+	"gpt-4.5":       {Input: 75, CachedInput: 37.50, Output: 150},
+	"gpt-5":         {Input: 1.25, CachedInput: 0.125, Output: 10},
+	"gpt-5-mini":    {Input: 0.25, CachedInput: 0.025, Output: 2},
+	"gpt-5-nano":    {Input: 0.05, CachedInput: 0.005, Output: 0.40},
+	"o1":            {Input: 15, CachedInput: 7.50, Output: 60},
+	"o1-mini":       {Input: 1.10, CachedInput: 0.55, Output: 4.40},
+	"o3":            {Input: 2, CachedInput: 0.50, Output: 8},
+	"o3-mini":       {Input: 1.10, CachedInput: 0.55, Output: 4.40},
+	"o4-mini":       {Input: 1.10, CachedInput: 0.275, Output: 4.40},
+}
+
+// Lookup returns the price of the model. OpenRouter names models after their
+// vendor, e.g. openai/gpt-4o, and adds variants like openai/gpt-4o:nitro;
+// these cost the same as the upstream model, except for the :free variants.
+func Lookup(model string) (Price, bool) {
+	model, variant, _ := strings.Cut(model, ":")
+	if variant == "free" {
+		return Price{}, true
+	}
+	if _, name, ok := strings.Cut(model, "/"); ok {
+		model = name
+	}
+
+	price, matched := Price{}, ""
+	for prefix, p := range prices {
+		if strings.HasPrefix(model, prefix) && len(prefix) > len(matched) {
+			price, matched = p, prefix
+		}
+	}
+	return price, matched != ""
+}
+
+// Cost returns the cost of the usage in US dollars
+func (p Price) Cost(usage llm.Usage) float64 {
+	cachedPrice := p.CachedInput
+	if cachedPrice == 0 {
+		cachedPrice = p.Input
+	}
+
+	uncached := usage.PromptTokens - usage.CachedTokens
+	cost := float64(uncached)*p.Input + float64(usage.CachedTokens)*cachedPrice + float64(usage.CompletionTokens)*p.Output
+	return cost / 1_000_000
+}
+
+// Estimate returns the cost of the usage for the model, and whether the price
+// of the model is known
+func Estimate(model string, usage llm.Usage) (float64, bool) {
+	price, ok := Lookup(model)
+	if !ok {
+		return 0, false
+	}
+	return price.Cost(usage), true
+}
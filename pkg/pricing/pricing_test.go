@@ -0,0 +1,59 @@
+package pricing
+
+import (
+	"testing"
+
+	"github.com/Turee/si/pkg/llm"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestLookup tests finding the price of a model by its longest prefix
+func TestLookup(t *testing.T) {
+	price, ok := Lookup("gpt-4o-mini-2024-07-18")
+	assert.True(t, ok)
+	assert.Equal(t, 0.15, price.Input)
+
+	price, ok = Lookup("gpt-4o-2024-08-06")
+	assert.True(t, ok)
+	assert.Equal(t, 2.50, price.Input)
+
+	_, ok = Lookup("llama3")
+	assert.False(t, ok)
+
+	// OpenRouter model names
+	price, ok = Lookup("openai/gpt-4o-mini")
+	assert.True(t, ok)
+	assert.Equal(t, 0.15, price.Input)
+
+	price, ok = Lookup("openai/gpt-4o:nitro")
+	assert.True(t, ok)
+	assert.Equal(t, 2.50, price.Input)
+
+	price, ok = Lookup("meta-llama/llama-3.3-70b-instruct:free")
+	assert.True(t, ok)
+	assert.Zero(t, price.Cost(llm.Usage{PromptTokens: 1000}))
+
+	_, ok = Lookup("anthropic/claude-sonnet-4")
+	assert.False(t, ok)
+}
+
+// TestCost tests computing the cost of the token usage
+func TestCost(t *testing.T) {
+	price := Price{Input: 2, CachedInput: 1, Output: 8}
+	usage := llm.Usage{PromptTokens: 1_000_000, CachedTokens: 500_000, CompletionTokens: 250_000}
+	assert.InDelta(t, 1.0+0.5+2.0, price.Cost(usage), 1e-9)
+
+	// Cached tokens cost the input price when there is no cached price
+	price.CachedInput = 0
+	assert.InDelta(t, 2.0+2.0, price.Cost(usage), 1e-9)
+}
+
+// TestEstimate tests estimating the cost for a model
+func TestEstimate(t *testing.T) {
+	cost, ok := Estimate("gpt-4", llm.Usage{PromptTokens: 1000, CompletionTokens: 500})
+	assert.True(t, ok)
+	assert.InDelta(t, 0.06, cost, 1e-9)
+
+	_, ok = Estimate("my-local-model", llm.Usage{PromptTokens: 1000})
+	assert.False(t, ok)
+}
@@ -0,0 +1,35 @@
+package prompt
+
+import (
+	"regexp"
+	"strings"
+)
+
+// paramReference matches a {{name}} parameter of a saved query
+var paramReference = regexp.MustCompile(`\{\{\s*([A-Za-z_][A-Za-z0-9_-]*)\s*\}\}`)
+
+// Params returns the names of the {{name}} parameters of a saved query in
+// the order they first appear
+func Params(query string) []string {
+	var names []string
+	seen := make(map[string]bool)
+	for _, match := range paramReference.FindAllStringSubmatch(query, -1) {
+		if !seen[match[1]] {
+			seen[match[1]] = true
+			names = append(names, match[1])
+		}
+	}
+	return names
+}
+
+// Fill replaces the parameters of a saved query with their values.
+// Parameters without a value are left as they are.
+func Fill(query string, values map[string]string) string {
+	return paramReference.ReplaceAllStringFunc(query, func(ref string) string {
+		name := strings.TrimSpace(ref[2 : len(ref)-2])
+		if value, ok := values[name]; ok {
+			return value
+		}
+		return ref
+	})
+}
@@ -0,0 +1,18 @@
+package prompt
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestParams tests finding and filling in the parameters of a saved query
+func TestParams(t *testing.T) {
+	query := "Write a deploy checklist for {{service}} to {{ env }}, {{service}} runs on {{platform}}. Keep {not-a-param} and {{.Input}}."
+
+	assert.Equal(t, []string{"service", "env", "platform"}, Params(query))
+	assert.Empty(t, Params("no parameters"))
+
+	filled := Fill(query, map[string]string{"service": "billing", "env": "production"})
+	assert.Equal(t, "Write a deploy checklist for billing to production, billing runs on {{platform}}. Keep {not-a-param} and {{.Input}}.", filled)
+}
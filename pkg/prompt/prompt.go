@@ -0,0 +1,77 @@
+package prompt
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/Turee/si/pkg/config"
+)
+
+// Data holds the values that can be referenced from a prompt template
+type Data struct {
+	// Input is the content piped into si via stdin
+	Input string
+
+	// Inputs are the segments of the input split with --stdin-delimiter, or
+	// the whole input as a single segment
+	Inputs []string
+
+	// Args is the command line question joined into a single string
+	Args string
+
+	// ArgList contains the individual command line question arguments
+	ArgList []string
+}
+
+// funcs contains the helper functions available inside prompt templates
+var funcs = template.FuncMap{
+	"trim":  strings.TrimSpace,
+	"upper": strings.ToUpper,
+	"lower": strings.ToLower,
+	"default": func(def, value string) string {
+		if strings.TrimSpace(value) == "" {
+			return def
+		}
+		return value
+	},
+}
+
+// Render parses the named template and executes it with the given data
+func Render(name, text string, data Data) (string, error) {
+	tmpl, err := template.New(name).Funcs(funcs).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse prompt %q: %w", name, err)
+	}
+
+	var out strings.Builder
+	if err := tmpl.Execute(&out, data); err != nil {
+		return "", fmt.Errorf("failed to render prompt %q: %w", name, err)
+	}
+
+	return out.String(), nil
+}
+
+// Lookup finds a named prompt and renders it with the given data
+func Lookup(prompts map[string]config.PromptConfig, name string, data Data) (string, error) {
+	p, ok := prompts[name]
+	if !ok {
+		if len(prompts) == 0 {
+			return "", fmt.Errorf("unknown prompt %q: no prompts are configured", name)
+		}
+		return "", fmt.Errorf("unknown prompt %q (available: %s)", name, strings.Join(Names(prompts), ", "))
+	}
+
+	return Render(name, p.Template, data)
+}
+
+// Names returns the sorted names of the given prompts
+func Names(prompts map[string]config.PromptConfig) []string {
+	names := make([]string, 0, len(prompts))
+	for name := range prompts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
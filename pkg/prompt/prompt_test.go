@@ -0,0 +1,57 @@
+package prompt
+
+import (
+	"testing"
+
+	"github.com/Turee/si/pkg/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestRender tests rendering templates with input and arguments
+func TestRender(t *testing.T) {
+	data := Data{
+		Input:   "line one\nline two\n",
+		Args:    "in french",
+		ArgList: []string{"in", "french"},
+	}
+
+	out, err := Render("summarize", "Summarize the following {{.Args}}:\n{{.Input | trim}}", data)
+	require.NoError(t, err)
+	assert.Equal(t, "Summarize the following in french:\nline one\nline two", out)
+
+	out, err = Render("first", "{{index .ArgList 0 | upper}}", data)
+	require.NoError(t, err)
+	assert.Equal(t, "IN", out)
+
+	out, err = Render("default", `{{default "briefly" .Args}}`, Data{})
+	require.NoError(t, err)
+	assert.Equal(t, "briefly", out)
+}
+
+// TestRenderErrors tests that invalid templates produce errors
+func TestRenderErrors(t *testing.T) {
+	_, err := Render("broken", "{{.Input", Data{})
+	assert.ErrorContains(t, err, "failed to parse prompt \"broken\"")
+
+	_, err = Render("unknown-field", "{{.Missing}}", Data{})
+	assert.ErrorContains(t, err, "failed to render prompt \"unknown-field\"")
+}
+
+// TestLookup tests looking up named prompts
+func TestLookup(t *testing.T) {
+	prompts := map[string]config.PromptConfig{
+		"summarize": {Template: "Summarize: {{.Input}}"},
+		"explain":   {Template: "Explain: {{.Args}}"},
+	}
+
+	out, err := Lookup(prompts, "explain", Data{Args: "kubectl"})
+	require.NoError(t, err)
+	assert.Equal(t, "Explain: kubectl", out)
+
+	_, err = Lookup(prompts, "translate", Data{})
+	assert.ErrorContains(t, err, "available: explain, summarize")
+
+	_, err = Lookup(nil, "translate", Data{})
+	assert.ErrorContains(t, err, "no prompts are configured")
+}
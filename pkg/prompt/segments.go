@@ -0,0 +1,36 @@
+package prompt
+
+import "strings"
+
+// NULDelimiter is the delimiter that splits input at NUL bytes, as written by
+// find -print0 and similar tools
+const NULDelimiter = `\0`
+
+// Split splits piped input into segments at the delimiter: at NUL bytes for
+// NULDelimiter, otherwise at lines that consist of the delimiter only. Empty
+// segments, such as the one after a trailing NUL byte, are dropped.
+func Split(input, delimiter string) []string {
+	var parts []string
+	if delimiter == NULDelimiter {
+		parts = strings.Split(input, "\x00")
+	} else {
+		var current strings.Builder
+		for _, line := range strings.SplitAfter(input, "\n") {
+			if strings.TrimRight(line, "\r\n") == delimiter {
+				parts = append(parts, current.String())
+				current.Reset()
+				continue
+			}
+			current.WriteString(line)
+		}
+		parts = append(parts, current.String())
+	}
+
+	segments := make([]string, 0, len(parts))
+	for _, part := range parts {
+		if strings.TrimSpace(part) != "" {
+			segments = append(segments, part)
+		}
+	}
+	return segments
+}
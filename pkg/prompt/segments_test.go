@@ -0,0 +1,29 @@
+package prompt
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestSplit tests splitting input at marker lines and NUL bytes
+func TestSplit(t *testing.T) {
+	tests := []struct {
+		name      string
+		input     string
+		delimiter string
+		want      []string
+	}{
+		{"marker lines", "package a\n---\npackage b\n", "---", []string{"package a\n", "package b\n"}},
+		{"marker inside a line", "a --- b\n", "---", []string{"a --- b\n"}},
+		{"CRLF", "a\r\n---\r\nb\r\n", "---", []string{"a\r\n", "b\r\n"}},
+		{"empty segments", "---\na\n---\n---\n", "---", []string{"a\n"}},
+		{"NUL bytes", "a\x00b\x00", NULDelimiter, []string{"a", "b"}},
+		{"no delimiter", "a\nb\n", "---", []string{"a\nb\n"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, Split(tt.input, tt.delimiter))
+		})
+	}
+}
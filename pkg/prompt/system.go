@@ -0,0 +1,77 @@
+package prompt
+
+import "strings"
+
+// Parts of the system prompt, in the order they are assembled
+const (
+	// PartBuiltin is the built-in prompt for answers in a terminal
+	PartBuiltin = "builtin"
+
+	// PartConfig is the system prompt from the config
+	PartConfig = "config"
+
+	// PartRole is the prompt of the role selected with --role
+	PartRole = "role"
+
+	// PartMemory are the instructions of the workspace memory file
+	PartMemory = "memory"
+
+	// PartEnvironment describes the environment si runs in
+	PartEnvironment = "environment"
+)
+
+// partOrder is the order of the parts in the system prompt
+var partOrder = []string{PartBuiltin, PartConfig, PartRole, PartMemory, PartEnvironment}
+
+// SystemPart is a part of the system prompt
+type SystemPart struct {
+	// Name is one of the Part constants
+	Name string
+
+	// Source describes where the content comes from, e.g. a file path
+	Source string
+
+	// Content is the text of the part
+	Content string
+}
+
+// System assembles the system prompt from its parts. Parts are always
+// ordered by their kind, regardless of the order they are added in, so
+// general instructions come before more specific ones.
+type System struct {
+	parts map[string]SystemPart
+}
+
+// Add sets a part of the system prompt, replacing a previous part of the same
+// kind. Parts without content are left out.
+func (s *System) Add(part SystemPart) {
+	if s.parts == nil {
+		s.parts = make(map[string]SystemPart)
+	}
+	if strings.TrimSpace(part.Content) == "" {
+		delete(s.parts, part.Name)
+		return
+	}
+	s.parts[part.Name] = part
+}
+
+// Parts returns the parts of the system prompt in order
+func (s *System) Parts() []SystemPart {
+	var parts []SystemPart
+	for _, name := range partOrder {
+		if part, ok := s.parts[name]; ok {
+			parts = append(parts, part)
+		}
+	}
+	return parts
+}
+
+// String returns the assembled system prompt, with the parts separated by
+// blank lines
+func (s *System) String() string {
+	var contents []string
+	for _, part := range s.Parts() {
+		contents = append(contents, strings.TrimSpace(part.Content))
+	}
+	return strings.Join(contents, "\n\n")
+}
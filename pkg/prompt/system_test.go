@@ -0,0 +1,27 @@
+package prompt
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestSystem tests assembling the system prompt in order
+func TestSystem(t *testing.T) {
+	var system System
+	assert.Empty(t, system.String())
+
+	system.Add(SystemPart{Name: PartEnvironment, Content: "Shell: zsh"})
+	system.Add(SystemPart{Name: PartMemory, Source: "SI.md", Content: "Use tabs.\n"})
+	system.Add(SystemPart{Name: PartBuiltin, Content: "Be brief."})
+	system.Add(SystemPart{Name: PartRole, Content: "  "})
+	assert.Equal(t, "Be brief.\n\nUse tabs.\n\nShell: zsh", system.String())
+
+	// Parts replace earlier parts of the same kind, empty parts remove them
+	system.Add(SystemPart{Name: PartBuiltin, Content: "Be verbose."})
+	system.Add(SystemPart{Name: PartEnvironment})
+	assert.Equal(t, []SystemPart{
+		{Name: PartBuiltin, Content: "Be verbose."},
+		{Name: PartMemory, Source: "SI.md", Content: "Use tabs.\n"},
+	}, system.Parts())
+}
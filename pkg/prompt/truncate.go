@@ -0,0 +1,130 @@
+package prompt
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// Strategies of Truncate, naming the part of the text that is kept
+const (
+	TruncateHead      = "head"
+	TruncateTail      = "tail"
+	TruncateHeadTail  = "head+tail"
+	TruncateSummarize = "summarize"
+)
+
+// TruncateStrategies are the valid strategies of Truncate
+var TruncateStrategies = []string{TruncateHead, TruncateTail, TruncateHeadTail, TruncateSummarize}
+
+// Truncation is a text cut to a limit: the head and tail that are kept and
+// the omitted part between them
+type Truncation struct {
+	Head    string
+	Omitted string
+	Tail    string
+}
+
+// Truncate cuts the text to at most limit bytes, keeping the head, the tail
+// or both halves depending on the strategy; summarize keeps both halves like
+// head+tail, as the omitted middle is summarized by the caller. Cuts are made
+// at line ends where the kept part keeps at least half of its size, and never
+// inside a UTF-8 sequence. The text is returned as the head when it fits.
+func Truncate(text string, limit int, strategy string) Truncation {
+	if len(text) <= limit {
+		return Truncation{Head: text}
+	}
+	limit = max(limit, 0)
+
+	switch strategy {
+	case TruncateHead:
+		end := headCut(text, limit)
+		return Truncation{Head: text[:end], Omitted: text[end:]}
+	case TruncateTail:
+		start := tailCut(text, limit)
+		return Truncation{Omitted: text[:start], Tail: text[start:]}
+	default:
+		end := headCut(text, limit/2)
+		start := tailCut(text, limit-end)
+		return Truncation{Head: text[:end], Omitted: text[end:start], Tail: text[start:]}
+	}
+}
+
+// headCut returns where the head of at most limit bytes ends
+func headCut(text string, limit int) int {
+	end := limit
+	for end > 0 && !utf8.RuneStart(text[end]) {
+		end--
+	}
+	if i := strings.LastIndexByte(text[:end], '\n'); i >= end/2 {
+		end = i + 1
+	}
+	return end
+}
+
+// tailCut returns where the tail of at most limit bytes starts
+func tailCut(text string, limit int) int {
+	start := len(text) - limit
+	for start < len(text) && !utf8.RuneStart(text[start]) {
+		start++
+	}
+	if i := strings.IndexByte(text[start:], '\n'); i >= 0 && i < (len(text)-start)/2 {
+		start += i + 1
+	}
+	return start
+}
+
+// Chunk splits the text into chunks of at most size bytes, cut at line ends
+// like the head of Truncate
+func Chunk(text string, size int) []string {
+	if size <= 0 {
+		return []string{text}
+	}
+
+	var chunks []string
+	for len(text) > size {
+		end := headCut(text, size)
+		for end == 0 || end < len(text) && !utf8.RuneStart(text[end]) {
+			// A character longer than the size forms a chunk of its own
+			end++
+		}
+		chunks = append(chunks, text[:end])
+		text = text[end:]
+	}
+	if text != "" {
+		chunks = append(chunks, text)
+	}
+	return chunks
+}
+
+// Join joins the kept parts with a marker telling what was omitted, followed
+// by a summary of the omitted part if there is one
+func (t Truncation) Join(summary string) string {
+	if t.Omitted == "" {
+		return t.Head + t.Tail
+	}
+
+	lines := strings.Count(t.Omitted, "\n")
+	marker := fmt.Sprintf("[... %d bytes omitted ...]", len(t.Omitted))
+	switch {
+	case lines == 1:
+		marker = "[... 1 line omitted ...]"
+	case lines > 1:
+		marker = fmt.Sprintf("[... %d lines omitted ...]", lines)
+	}
+	if summary = strings.TrimSpace(summary); summary != "" {
+		marker = strings.TrimSuffix(marker, " ...]") + ", summary:\n" + summary + "\n...]"
+	}
+
+	var b strings.Builder
+	b.WriteString(t.Head)
+	if t.Head != "" && !strings.HasSuffix(t.Head, "\n") {
+		b.WriteString("\n")
+	}
+	b.WriteString(marker)
+	if t.Tail != "" {
+		b.WriteString("\n")
+	}
+	b.WriteString(t.Tail)
+	return b.String()
+}
@@ -0,0 +1,55 @@
+package prompt
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestTruncate tests keeping the head, the tail or both at line ends
+func TestTruncate(t *testing.T) {
+	text := "line 1\nline 2\nline 3\nline 4\nline 5\nline 6\n"
+
+	assert.Equal(t, Truncation{Head: text}, Truncate(text, len(text), TruncateHeadTail))
+
+	assert.Equal(t, Truncation{Head: "line 1\nline 2\n", Omitted: "line 3\nline 4\nline 5\nline 6\n"},
+		Truncate(text, 16, TruncateHead))
+	assert.Equal(t, Truncation{Omitted: "line 1\nline 2\nline 3\nline 4\n", Tail: "line 5\nline 6\n"},
+		Truncate(text, 16, TruncateTail))
+	assert.Equal(t, Truncation{Head: "line 1\nline 2\n", Omitted: "line 3\nline 4\n", Tail: "line 5\nline 6\n"},
+		Truncate(text, 30, TruncateHeadTail))
+	assert.Equal(t, Truncate(text, 30, TruncateHeadTail), Truncate(text, 30, TruncateSummarize))
+
+	// Long lines are cut within the line, but not within a character
+	long := strings.Repeat("ä", 10)
+	truncated := Truncate(long, 5, TruncateHead)
+	assert.Equal(t, "ää", truncated.Head)
+	assert.Equal(t, long, truncated.Head+truncated.Omitted)
+	truncated = Truncate(long, 5, TruncateTail)
+	assert.Equal(t, "ää", truncated.Tail)
+}
+
+// TestChunk tests splitting text into chunks at line ends
+func TestChunk(t *testing.T) {
+	text := "line 1\nline 2\nline 3\nline 4\nline 5\n"
+	assert.Equal(t, []string{"line 1\nline 2\n", "line 3\nline 4\n", "line 5\n"}, Chunk(text, 16))
+	assert.Equal(t, []string{text}, Chunk(text, len(text)))
+	assert.Equal(t, []string{text}, Chunk(text, 0))
+	assert.Empty(t, Chunk("", 10))
+
+	// Characters are never split, even when they exceed the size
+	assert.Equal(t, []string{"ä", "ä", "ä"}, Chunk("äää", 1))
+	assert.Equal(t, []string{"abc", "def", "g"}, Chunk("abcdefg", 3))
+}
+
+// TestTruncationJoin tests marking what was omitted
+func TestTruncationJoin(t *testing.T) {
+	truncated := Truncation{Head: "line 1\n", Omitted: "line 2\nline 3\n", Tail: "line 4\n"}
+	assert.Equal(t, "line 1\n[... 2 lines omitted ...]\nline 4\n", truncated.Join(""))
+	assert.Equal(t, "line 1\n[... 2 lines omitted, summary:\nLines 2 and 3.\n...]\nline 4\n", truncated.Join("Lines 2 and 3.\n"))
+
+	assert.Equal(t, "abc\n[... 3 bytes omitted ...]", Truncation{Head: "abc", Omitted: "def"}.Join(""))
+	assert.Equal(t, "[... 1 line omitted ...]\nend", Truncation{Omitted: "start\n", Tail: "end"}.Join(""))
+	assert.Equal(t, "complete", Truncation{Head: "complete"}.Join(""))
+}
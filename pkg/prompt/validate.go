@@ -0,0 +1,87 @@
+package prompt
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/Turee/si/pkg/config"
+	"github.com/Turee/si/pkg/schema"
+)
+
+// fencePattern matches a fenced markdown code block
+var fencePattern = regexp.MustCompile("(?s)```[^\\n]*\\n.*?```")
+
+// Validate checks the answer against the rules and returns an error
+// describing every rule it violates
+func Validate(rules config.ValidationConfig, answer string) error {
+	var errs []error
+
+	if rules.JSON && !json.Valid([]byte(Unfence(answer))) {
+		errs = append(errs, errors.New("the answer must be valid JSON"))
+	}
+
+	if rules.CodeFence && !fencePattern.MatchString(answer) {
+		errs = append(errs, errors.New("the answer must contain a fenced code block"))
+	}
+
+	if rules.MaxLines > 0 {
+		if lines := strings.Count(strings.TrimRight(answer, "\n"), "\n") + 1; lines > rules.MaxLines {
+			errs = append(errs, fmt.Errorf("the answer must not exceed %d lines, it has %d", rules.MaxLines, lines))
+		}
+	}
+
+	if rules.MustMatch != "" {
+		re, err := regexp.Compile(rules.MustMatch)
+		if err != nil {
+			return fmt.Errorf("invalid must_match pattern: %w", err)
+		}
+		if !re.MatchString(answer) {
+			errs = append(errs, fmt.Errorf("the answer must match the pattern %s", rules.MustMatch))
+		}
+	}
+
+	if rules.MustNotMatch != "" {
+		re, err := regexp.Compile(rules.MustNotMatch)
+		if err != nil {
+			return fmt.Errorf("invalid must_not_match pattern: %w", err)
+		}
+		if match := re.FindString(answer); match != "" {
+			errs = append(errs, fmt.Errorf("the answer must not contain %q", match))
+		}
+	}
+
+	if rules.Schema != "" {
+		s, err := schema.Load(config.ExpandPath(rules.Schema))
+		if err != nil {
+			return err
+		}
+		if err := s.Validate([]byte(Unfence(answer))); err != nil {
+			errs = append(errs, fmt.Errorf("the answer must conform to the JSON schema:\n%w", err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// RetryQuestion builds the follow-up question asking the model to fix an answer
+func RetryQuestion(question, answer string, err error) string {
+	return fmt.Sprintf("%s\n\nYour previous answer was:\n%s\n\nIt was rejected because:\n%s\n\nAnswer again, following all of the requirements.",
+		question, answer, err)
+}
+
+// Unfence returns the content of the answer without a surrounding code fence
+func Unfence(answer string) string {
+	trimmed := strings.TrimSpace(answer)
+	if !strings.HasPrefix(trimmed, "```") || !strings.HasSuffix(trimmed, "```") || len(trimmed) < 6 {
+		return trimmed
+	}
+
+	trimmed = strings.TrimSuffix(trimmed, "```")
+	if i := strings.IndexByte(trimmed, '\n'); i >= 0 {
+		return trimmed[i+1:]
+	}
+	return strings.TrimPrefix(trimmed, "```")
+}
@@ -0,0 +1,76 @@
+package prompt
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Turee/si/pkg/config"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestValidate tests the individual validation rules
+func TestValidate(t *testing.T) {
+	testCases := []struct {
+		name    string
+		rules   config.ValidationConfig
+		answer  string
+		wantErr string
+	}{
+		{name: "No rules", rules: config.ValidationConfig{}, answer: "anything"},
+		{name: "Valid JSON", rules: config.ValidationConfig{JSON: true}, answer: `{"a": 1}`},
+		{name: "Fenced JSON", rules: config.ValidationConfig{JSON: true}, answer: "```json\n{\"a\": 1}\n```"},
+		{name: "Invalid JSON", rules: config.ValidationConfig{JSON: true}, answer: "Sure! {\"a\": 1}", wantErr: "must be valid JSON"},
+		{name: "Code fence", rules: config.ValidationConfig{CodeFence: true}, answer: "Run:\n```sh\nls\n```"},
+		{name: "Missing code fence", rules: config.ValidationConfig{CodeFence: true}, answer: "ls", wantErr: "fenced code block"},
+		{name: "Within line limit", rules: config.ValidationConfig{MaxLines: 2}, answer: "one\ntwo\n"},
+		{name: "Too many lines", rules: config.ValidationConfig{MaxLines: 2}, answer: "one\ntwo\nthree", wantErr: "must not exceed 2 lines, it has 3"},
+		{name: "Matches pattern", rules: config.ValidationConfig{MustMatch: `^SELECT`}, answer: "SELECT 1"},
+		{name: "Does not match pattern", rules: config.ValidationConfig{MustMatch: `^SELECT`}, answer: "DROP TABLE x", wantErr: "must match the pattern ^SELECT"},
+		{name: "Forbidden words", rules: config.ValidationConfig{MustNotMatch: `(?i)\b(darn|heck)\b`}, answer: "Oh heck", wantErr: `must not contain "heck"`},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := Validate(tc.rules, tc.answer)
+			if tc.wantErr == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorContains(t, err, tc.wantErr)
+			}
+		})
+	}
+}
+
+// TestValidateSchema tests validating answers against a JSON Schema
+func TestValidateSchema(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "schema.json")
+	if err := os.WriteFile(path, []byte(`{"type":"object","required":["name"]}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	rules := config.ValidationConfig{Schema: path}
+
+	assert.True(t, rules.Enabled())
+	assert.NoError(t, Validate(rules, "```json\n{\"name\": \"Ada\"}\n```"))
+	assert.EqualError(t, Validate(rules, `{}`), "the answer must conform to the JSON schema:\n/: missing required property \"name\"")
+	assert.ErrorContains(t, Validate(rules, `Sure!`), "invalid JSON")
+
+	rules.Schema = filepath.Join(t.TempDir(), "missing.json")
+	assert.ErrorContains(t, Validate(rules, `{}`), "failed to read schema")
+}
+
+// TestValidateMultipleViolations tests that all violations are reported
+func TestValidateMultipleViolations(t *testing.T) {
+	err := Validate(config.ValidationConfig{JSON: true, MaxLines: 1}, "not\njson")
+	assert.ErrorContains(t, err, "valid JSON")
+	assert.ErrorContains(t, err, "must not exceed 1 lines")
+}
+
+// TestRetryQuestion tests the follow-up question for invalid answers
+func TestRetryQuestion(t *testing.T) {
+	question := RetryQuestion("Give me JSON", "Sure!", errors.New("the answer must be valid JSON"))
+	assert.Contains(t, question, "Give me JSON")
+	assert.Contains(t, question, "Your previous answer was:\nSure!")
+	assert.Contains(t, question, "It was rejected because:\nthe answer must be valid JSON")
+}
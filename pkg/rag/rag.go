@@ -0,0 +1,381 @@
+// Package rag indexes the files of a directory by the embeddings of their
+// chunks, so the chunks most relevant to a question can be retrieved and
+// given to the model as context
+package rag
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/Turee/si/pkg/cache"
+	"github.com/Turee/si/pkg/ignore"
+	"github.com/Turee/si/pkg/paths"
+	"github.com/Turee/si/pkg/prompt"
+	"github.com/Turee/si/pkg/state"
+)
+
+// Defaults of the options
+const (
+	DefaultChunkTokens  = 300
+	DefaultMaxFileBytes = 1 << 20
+	DefaultBatchSize    = 100
+)
+
+// binarySniffLen is how much of a file is checked for NUL bytes
+const binarySniffLen = 8 << 10
+
+// ErrNoIndex is returned by Find when no directory is indexed
+var ErrNoIndex = errors.New("no index found")
+
+// Chunk is a range of lines of a file with its embedding
+type Chunk struct {
+	// Path is the slash-separated path of the file relative to the root
+	Path      string    `json:"path"`
+	StartLine int       `json:"start_line"`
+	EndLine   int       `json:"end_line"`
+	Text      string    `json:"text"`
+	Embedding []float32 `json:"embedding"`
+}
+
+// File is an indexed file; it is indexed again when its size or
+// modification time changes
+type File struct {
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+	Chunks  []Chunk   `json:"chunks"`
+}
+
+// Index is the index of the files of a root directory, stored as a JSON file
+type Index struct {
+	Root  string           `json:"root"`
+	Model string           `json:"model"`
+	Time  time.Time        `json:"time"`
+	Files map[string]*File `json:"files"`
+
+	path string
+}
+
+// Options configures indexing
+type Options struct {
+	// Model is the embedding model; the index is rebuilt when it changes
+	Model string
+
+	// Include are .gitignore patterns of the files to index; without them
+	// every file is
+	Include []string
+
+	// Exclude are .gitignore patterns of files to skip in addition to those
+	// the .gitignore files ignore
+	Exclude []string
+
+	// ChunkTokens is the approximate size of the chunks in tokens
+	ChunkTokens int
+
+	// MaxFileBytes skips larger files
+	MaxFileBytes int64
+
+	// BatchSize is the number of chunks embedded per request
+	BatchSize int
+
+	// Embed computes the embeddings of texts
+	Embed func(ctx context.Context, texts []string) ([][]float32, error)
+
+	// Progress is called before every batch with the number of chunks
+	// embedded so far and the number of chunks to embed
+	Progress func(done, total int)
+}
+
+// Stats tells what an update did
+type Stats struct {
+	// Indexed is the number of new and changed files
+	Indexed int
+
+	// Unchanged files kept their chunks
+	Unchanged int
+
+	// Removed files were deleted or are ignored now
+	Removed int
+
+	// Skipped files are binary or too large
+	Skipped int
+
+	// Chunks is the number of chunks in the index
+	Chunks int
+}
+
+// Result is a chunk retrieved for a query
+type Result struct {
+	Chunk
+	Score float64
+}
+
+// DefaultDir returns the directory the indexes are stored in, in
+// paths.DataDir
+func DefaultDir() string {
+	dir := paths.DataDir()
+	if dir == "" {
+		return ""
+	}
+	return filepath.Join(dir, "index")
+}
+
+// indexFile returns the path of the index of root in dir, named after a hash
+// of the absolute path of root
+func indexFile(dir, root string) string {
+	sum := sha256.Sum256([]byte(root))
+	return filepath.Join(dir, hex.EncodeToString(sum[:8])+".json")
+}
+
+// Open loads the index of the root directory from dir; an index that
+// doesn't exist yet is empty
+func Open(dir, root string) (*Index, error) {
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+
+	ix := &Index{Root: root, Files: map[string]*File{}, path: indexFile(dir, root)}
+	data, err := os.ReadFile(ix.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return ix, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read index: %w", err)
+	}
+	if err := json.Unmarshal(data, ix); err != nil {
+		return nil, fmt.Errorf("failed to read index %s: %w", ix.path, err)
+	}
+	if ix.Files == nil {
+		ix.Files = map[string]*File{}
+	}
+	return ix, nil
+}
+
+// Find loads the index of start or of the closest of its parent directories
+// that is indexed. It returns ErrNoIndex if none is.
+func Find(dir, start string) (*Index, error) {
+	start, err := filepath.Abs(start)
+	if err != nil {
+		return nil, err
+	}
+
+	for root := start; ; root = filepath.Dir(root) {
+		if _, err := os.Stat(indexFile(dir, root)); err == nil {
+			return Open(dir, root)
+		}
+		if filepath.Dir(root) == root {
+			return nil, ErrNoIndex
+		}
+	}
+}
+
+// Save writes the index. Nothing is written in read-only mode.
+func (ix *Index) Save() error {
+	if err := state.Writable(); err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(ix)
+	if err != nil {
+		return fmt.Errorf("failed to encode index: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(ix.path), 0755); err != nil {
+		return fmt.Errorf("failed to create index directory: %w", err)
+	}
+
+	// Write to a temporary file first so the index is never left truncated
+	tmp := ix.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("failed to write index: %w", err)
+	}
+	if err := os.Rename(tmp, ix.path); err != nil {
+		return fmt.Errorf("failed to write index: %w", err)
+	}
+	return nil
+}
+
+// Update indexes the files of the root directory that are new or changed
+// and drops the files that are gone. Files are chunked at line ends and the
+// chunks are embedded with their paths.
+func (ix *Index) Update(ctx context.Context, opts Options) (Stats, error) {
+	if opts.ChunkTokens <= 0 {
+		opts.ChunkTokens = DefaultChunkTokens
+	}
+	if opts.MaxFileBytes <= 0 {
+		opts.MaxFileBytes = DefaultMaxFileBytes
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = DefaultBatchSize
+	}
+
+	// Embeddings of different models can't be compared
+	if ix.Model != opts.Model {
+		ix.Model = opts.Model
+		ix.Files = map[string]*File{}
+	}
+
+	var included ignore.Matcher
+	included.Add("", opts.Include)
+
+	var stats Stats
+	files := map[string]*File{}
+	var pending []*Chunk
+	err := ignore.Walk(ix.Root, opts.Exclude, func(name string, d fs.DirEntry) error {
+		if !d.Type().IsRegular() || len(opts.Include) > 0 && !included.Match(name, false) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if info.Size() > opts.MaxFileBytes {
+			stats.Skipped++
+			return nil
+		}
+
+		if old, ok := ix.Files[name]; ok && old.Size == info.Size() && old.ModTime.Equal(info.ModTime()) {
+			files[name] = old
+			stats.Unchanged++
+			return nil
+		}
+
+		data, err := os.ReadFile(filepath.Join(ix.Root, filepath.FromSlash(name)))
+		if err != nil {
+			return err
+		}
+		if isBinary(data) {
+			stats.Skipped++
+			return nil
+		}
+
+		file := &File{Size: info.Size(), ModTime: info.ModTime(), Chunks: chunkLines(name, string(data), 4*opts.ChunkTokens)}
+		for i := range file.Chunks {
+			pending = append(pending, &file.Chunks[i])
+		}
+		files[name] = file
+		stats.Indexed++
+		return nil
+	})
+	if err != nil {
+		return stats, err
+	}
+
+	for start := 0; start < len(pending); start += opts.BatchSize {
+		if opts.Progress != nil {
+			opts.Progress(start, len(pending))
+		}
+		batch := pending[start:min(start+opts.BatchSize, len(pending))]
+		texts := make([]string, len(batch))
+		for i, chunk := range batch {
+			texts[i] = chunk.Path + "\n\n" + chunk.Text
+		}
+		embeddings, err := opts.Embed(ctx, texts)
+		if err != nil {
+			return stats, err
+		}
+		if len(embeddings) != len(batch) {
+			return stats, fmt.Errorf("expected %d embeddings, got %d", len(batch), len(embeddings))
+		}
+		for i, chunk := range batch {
+			chunk.Embedding = embeddings[i]
+		}
+	}
+
+	for name := range ix.Files {
+		if _, ok := files[name]; !ok {
+			stats.Removed++
+		}
+	}
+	for _, file := range files {
+		stats.Chunks += len(file.Chunks)
+	}
+	ix.Files = files
+	ix.Time = time.Now()
+	return stats, nil
+}
+
+// Search returns the k chunks most similar to the embedding of a query, most
+// similar first
+func (ix *Index) Search(embedding []float32, k int) []Result {
+	var results []Result
+	for _, file := range ix.Files {
+		for _, chunk := range file.Chunks {
+			results = append(results, Result{Chunk: chunk, Score: cache.Similarity(chunk.Embedding, embedding)})
+		}
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		if results[i].Path != results[j].Path {
+			return results[i].Path < results[j].Path
+		}
+		return results[i].StartLine < results[j].StartLine
+	})
+	if k > 0 && len(results) > k {
+		results = results[:k]
+	}
+	return results
+}
+
+// chunkLines splits the text of a file into chunks of at most size bytes,
+// cut at line ends, with their line numbers. Blank lines don't start chunks,
+// and lines longer than size are cut into chunks of their own.
+func chunkLines(name, text string, size int) []Chunk {
+	var chunks []Chunk
+	var b strings.Builder
+	start, end := 0, 0
+	flush := func() {
+		if b.Len() > 0 {
+			chunks = append(chunks, Chunk{Path: name, StartLine: start, EndLine: end, Text: b.String()})
+			b.Reset()
+		}
+	}
+
+	for i, line := range strings.SplitAfter(text, "\n") {
+		if line == "" {
+			break
+		}
+		if b.Len() > 0 && b.Len()+len(line) > size {
+			flush()
+		}
+		if b.Len() == 0 {
+			if strings.TrimSpace(line) == "" {
+				continue
+			}
+			start = i + 1
+		}
+		if len(line) > size {
+			for _, part := range prompt.Chunk(line, size) {
+				chunks = append(chunks, Chunk{Path: name, StartLine: i + 1, EndLine: i + 1, Text: part})
+			}
+			continue
+		}
+		b.WriteString(line)
+		end = i + 1
+	}
+	flush()
+	return chunks
+}
+
+// isBinary reports whether the data has NUL bytes near its start or isn't
+// UTF-8, like images and compiled files
+func isBinary(data []byte) bool {
+	if bytes.IndexByte(data[:min(len(data), binarySniffLen)], 0) >= 0 {
+		return true
+	}
+	return !utf8.Valid(data)
+}
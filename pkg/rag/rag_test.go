@@ -0,0 +1,134 @@
+package rag
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Turee/si/pkg/state"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// wordEmbedder embeds texts by whether they contain the words, and counts
+// the embedded texts
+type wordEmbedder struct {
+	words    []string
+	embedded int
+}
+
+func (e *wordEmbedder) embed(ctx context.Context, texts []string) ([][]float32, error) {
+	e.embedded += len(texts)
+	embeddings := make([][]float32, len(texts))
+	for i, text := range texts {
+		embeddings[i] = e.vector(text)
+	}
+	return embeddings, nil
+}
+
+func (e *wordEmbedder) vector(text string) []float32 {
+	vector := make([]float32, len(e.words)+1)
+	vector[len(e.words)] = 0.1
+	for i, word := range e.words {
+		if strings.Contains(text, word) {
+			vector[i] = 1
+		}
+	}
+	return vector
+}
+
+// writeFiles creates the files in root
+func writeFiles(t *testing.T, root string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	}
+}
+
+// TestIndex tests indexing a directory, updating and searching the index
+func TestIndex(t *testing.T) {
+	root := t.TempDir()
+	dir := t.TempDir()
+	writeFiles(t, root, map[string]string{
+		".gitignore":    "secret.txt\n",
+		"auth.go":       "package auth\n\nfunc login() {}\n",
+		"db/db.go":      "package db\n\nfunc query() {}\n",
+		"secret.txt":    "login password\n",
+		"logo.png":      "\x89PNG\x00\x00",
+		"empty.txt":     "\n\n",
+		"docs/large.md": strings.Repeat("x", 100),
+	})
+	embedder := &wordEmbedder{words: []string{"login", "query"}}
+	opts := Options{Model: "test-model", MaxFileBytes: 50, BatchSize: 2, Embed: embedder.embed}
+
+	ix, err := Open(dir, root)
+	require.NoError(t, err)
+	stats, err := ix.Update(context.Background(), opts)
+	require.NoError(t, err)
+	assert.Equal(t, Stats{Indexed: 4, Skipped: 2, Chunks: 3}, stats)
+	require.NoError(t, ix.Save())
+
+	results := ix.Search(embedder.vector("how do I login"), 1)
+	require.Len(t, results, 1)
+	assert.Equal(t, "auth.go", results[0].Path)
+	assert.Equal(t, 1, results[0].StartLine)
+	assert.Equal(t, 3, results[0].EndLine)
+	assert.Greater(t, results[0].Score, 0.9)
+
+	// The index is found from subdirectories, and unchanged files keep their
+	// embeddings
+	ix, err = Find(dir, filepath.Join(root, "db"))
+	require.NoError(t, err)
+	assert.Equal(t, "test-model", ix.Model)
+	require.NoError(t, os.Remove(filepath.Join(root, "db", "db.go")))
+	writeFiles(t, root, map[string]string{"auth.go": "package auth\n\nfunc login(user string) {}\n"})
+	embedder.embedded = 0
+	stats, err = ix.Update(context.Background(), opts)
+	require.NoError(t, err)
+	assert.Equal(t, Stats{Indexed: 1, Unchanged: 2, Removed: 1, Skipped: 2, Chunks: 2}, stats)
+	assert.Equal(t, 1, embedder.embedded)
+
+	// Another model embeds everything again
+	opts.Model = "other-model"
+	stats, err = ix.Update(context.Background(), opts)
+	require.NoError(t, err)
+	assert.Equal(t, 3, stats.Indexed)
+
+	// With include patterns only the matching files are kept
+	opts.Include = []string{"*.go"}
+	stats, err = ix.Update(context.Background(), opts)
+	require.NoError(t, err)
+	assert.Equal(t, Stats{Unchanged: 1, Removed: 2, Chunks: 1}, stats)
+
+	_, err = Find(dir, t.TempDir())
+	assert.ErrorIs(t, err, ErrNoIndex)
+}
+
+// TestChunkLines tests splitting files into chunks with line numbers
+func TestChunkLines(t *testing.T) {
+	chunks := chunkLines("a.txt", "one\ntwo\n\n\n\nthree\nfour", 8)
+	assert.Equal(t, []Chunk{
+		{Path: "a.txt", StartLine: 1, EndLine: 2, Text: "one\ntwo\n"},
+		{Path: "a.txt", StartLine: 6, EndLine: 6, Text: "three\n"},
+		{Path: "a.txt", StartLine: 7, EndLine: 7, Text: "four"},
+	}, chunks)
+}
+
+// TestSaveReadOnly tests that nothing is written in read-only mode
+func TestSaveReadOnly(t *testing.T) {
+	state.SetReadOnly(true)
+	t.Cleanup(func() { state.SetReadOnly(false) })
+
+	dir := t.TempDir()
+	ix, err := Open(dir, t.TempDir())
+	require.NoError(t, err)
+	assert.ErrorIs(t, ix.Save(), state.ErrReadOnly)
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+}
@@ -0,0 +1,164 @@
+// Package redact replaces secrets such as API keys, credentials and private
+// keys, or personal data such as email addresses, in text with placeholders
+// before the text is sent to a model. The placeholders can be put back into
+// the answer.
+package redact
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Pattern finds one kind of secret. When the expression has a capture group,
+// only the first group is the secret, e.g. the value of an assignment.
+type Pattern struct {
+	Name   string
+	Regexp *regexp.Regexp
+}
+
+// Builtin are the patterns used unless they are disabled. The generic
+// secret pattern only covers assignments to upper case names like those of
+// .env files and shell exports, as code is full of lower case tokens.
+var Builtin = []Pattern{
+	{"private_key", regexp.MustCompile(`-----BEGIN [A-Z0-9 ]*PRIVATE KEY( BLOCK)?-----[\s\S]*?-----END [A-Z0-9 ]*PRIVATE KEY( BLOCK)?-----`)},
+	{"aws_access_key", regexp.MustCompile(`\b(?:AKIA|ASIA|AGPA|AIDA|AROA)[0-9A-Z]{16}\b`)},
+	{"aws_secret_key", regexp.MustCompile(`(?i)aws_?secret_?(?:access_?)?key["']?\s*[:=]\s*["']?([A-Za-z0-9/+=]{40})\b`)},
+	{"jwt", regexp.MustCompile(`\beyJ[A-Za-z0-9_-]{8,}\.eyJ[A-Za-z0-9_-]{8,}\.[A-Za-z0-9_-]{8,}`)},
+	{"github_token", regexp.MustCompile(`\b(?:gh[pousr]_[A-Za-z0-9]{36,}|github_pat_[A-Za-z0-9_]{22,})\b`)},
+	{"api_key", regexp.MustCompile(`\b(?:sk-[A-Za-z0-9_-]{20,}|AIza[0-9A-Za-z_-]{35}|xox[abposr]-[A-Za-z0-9-]{10,})`)},
+	{"secret", regexp.MustCompile(`\b[A-Z0-9_]*(?:API_?KEY|SECRET|TOKEN|PASSWORD|PASSWD)[A-Z0-9_]*\s*=\s*["']?([^\s"'$\[\]]{8,})`)},
+}
+
+// PII are the patterns of personal data: email addresses, phone numbers and
+// IP addresses. Phone numbers need separators between their groups, so dates,
+// versions and other numbers are left alone.
+var PII = []Pattern{
+	{"email", regexp.MustCompile(`\b[A-Za-z0-9._%+-]+@[A-Za-z0-9-]+(?:\.[A-Za-z0-9-]+)*\.[A-Za-z]{2,}\b`)},
+	{"ip_address", regexp.MustCompile(`\b(?:(?:25[0-5]|2[0-4]\d|1?\d?\d)\.){3}(?:25[0-5]|2[0-4]\d|1?\d?\d)\b|\b(?:[0-9A-Fa-f]{1,4}:){7}[0-9A-Fa-f]{1,4}\b|\b(?:[0-9A-Fa-f]{1,4}:){1,6}:[0-9A-Fa-f]{1,4}(?::[0-9A-Fa-f]{1,4}){0,5}\b`)},
+	{"phone", regexp.MustCompile(`(?:\+\d{1,3}[\s.-]?)?(?:\(\d{2,4}\)\s?|\b\d{2,4}[\s.-])\d{3,4}[\s.-]\d{4}\b`)},
+}
+
+// Compile creates a pattern from a regular expression of the config
+func Compile(name, expr string) (Pattern, error) {
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return Pattern{}, fmt.Errorf("invalid redaction pattern %q: %w", name, err)
+	}
+	return Pattern{Name: name, Regexp: re}, nil
+}
+
+// Redactor replaces secrets with placeholders and remembers them, so the
+// same secret always gets the same placeholder and can be restored
+type Redactor struct {
+	patterns []Pattern
+
+	// secrets maps placeholders to the secrets they replace
+	secrets map[string]string
+
+	// placeholders maps secrets to their placeholders
+	placeholders map[string]string
+
+	// counts is the number of distinct secrets found per pattern
+	counts map[string]int
+}
+
+// New creates a redactor finding the secrets of the patterns
+func New(patterns []Pattern) *Redactor {
+	return &Redactor{
+		patterns:     patterns,
+		secrets:      map[string]string{},
+		placeholders: map[string]string{},
+		counts:       map[string]int{},
+	}
+}
+
+// Redact returns the text with its secrets replaced by placeholders like
+// [REDACTED_JWT_1]. A nil redactor returns the text as it is.
+func (r *Redactor) Redact(text string) string {
+	if r == nil {
+		return text
+	}
+
+	for _, pattern := range r.patterns {
+		text = r.replace(text, pattern)
+	}
+	return text
+}
+
+// replace replaces the secrets found by the pattern
+func (r *Redactor) replace(text string, pattern Pattern) string {
+	var b strings.Builder
+	last := 0
+	for _, match := range pattern.Regexp.FindAllStringSubmatchIndex(text, -1) {
+		start, end := match[0], match[1]
+		if len(match) >= 4 && match[2] >= 0 {
+			start, end = match[2], match[3]
+		}
+		secret := text[start:end]
+		if start == end || r.secrets[secret] != "" {
+			// Empty or already a placeholder
+			continue
+		}
+
+		b.WriteString(text[last:start])
+		b.WriteString(r.placeholder(pattern.Name, secret))
+		last = end
+	}
+	if last == 0 {
+		return text
+	}
+	b.WriteString(text[last:])
+	return b.String()
+}
+
+// placeholder returns the placeholder of the secret, creating one for new
+// secrets
+func (r *Redactor) placeholder(name, secret string) string {
+	if placeholder, ok := r.placeholders[secret]; ok {
+		return placeholder
+	}
+
+	r.counts[name]++
+	placeholder := fmt.Sprintf("[REDACTED_%s_%d]", strings.ToUpper(name), r.counts[name])
+	r.placeholders[secret] = placeholder
+	r.secrets[placeholder] = secret
+	return placeholder
+}
+
+// Restore puts the secrets back in place of their placeholders, e.g. into
+// the answer of the model
+func (r *Redactor) Restore(text string) string {
+	if r == nil || len(r.secrets) == 0 {
+		return text
+	}
+
+	pairs := make([]string, 0, 2*len(r.secrets))
+	for placeholder, secret := range r.secrets {
+		pairs = append(pairs, placeholder, secret)
+	}
+	return strings.NewReplacer(pairs...).Replace(text)
+}
+
+// Count returns the number of distinct secrets found
+func (r *Redactor) Count() int {
+	if r == nil {
+		return 0
+	}
+	return len(r.secrets)
+}
+
+// Names returns the sorted names of the patterns that found secrets
+func (r *Redactor) Names() []string {
+	if r == nil {
+		return nil
+	}
+
+	names := make([]string, 0, len(r.counts))
+	for name := range r.counts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,229 @@
+// Package rpc implements JSON-RPC 2.0 over a stream of newline-delimited
+// messages, the protocol `si serve` speaks with editor plugins.
+package rpc
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// Version is the JSON-RPC version of all messages
+const Version = "2.0"
+
+// Error codes of JSON-RPC, and the code of the Language Server Protocol for
+// canceled requests
+const (
+	CodeParseError       = -32700
+	CodeInvalidRequest   = -32600
+	CodeMethodNotFound   = -32601
+	CodeInvalidParams    = -32602
+	CodeInternalError    = -32603
+	CodeRequestCancelled = -32800
+)
+
+// maxMessageSize is the size of the largest message that can be read
+const maxMessageSize = 16 * 1024 * 1024
+
+// Request is a request or, without an ID, a notification
+type Request struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+// IsNotification tells if the request expects no response
+func (r *Request) IsNotification() bool {
+	return r.ID == nil
+}
+
+// DecodeParams decodes the parameters of the request into v. Invalid
+// parameters are reported with CodeInvalidParams.
+func (r *Request) DecodeParams(v interface{}) error {
+	if len(r.Params) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(r.Params, v); err != nil {
+		return Errorf(CodeInvalidParams, "invalid params: %v", err)
+	}
+	return nil
+}
+
+// Error is an error response
+type Error struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// Errorf creates an error with the given code
+func Errorf(code int, format string, args ...interface{}) *Error {
+	return &Error{Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+// response is the response to a request
+type response struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *Error          `json:"error,omitempty"`
+}
+
+// notification is a message sent by the server without a request
+type notification struct {
+	JSONRPC string      `json:"jsonrpc"`
+	Method  string      `json:"method"`
+	Params  interface{} `json:"params,omitempty"`
+}
+
+// Handler handles a request and returns its result. Errors of type *Error are
+// sent as they are, other errors as internal errors. The context is canceled
+// when the request is canceled with Conn.Cancel.
+type Handler func(ctx context.Context, conn *Conn, req *Request) (interface{}, error)
+
+// Conn is a JSON-RPC connection. Requests are handled concurrently, so a
+// long running request doesn't block others, such as the one canceling it.
+type Conn struct {
+	r io.Reader
+
+	writeMu sync.Mutex
+	w       io.Writer
+
+	mu      sync.Mutex
+	pending map[string]context.CancelFunc
+}
+
+// NewConn creates a connection reading requests from r and writing responses
+// to w
+func NewConn(r io.Reader, w io.Writer) *Conn {
+	return &Conn{r: r, w: w, pending: make(map[string]context.CancelFunc)}
+}
+
+// Serve handles requests until the input ends or the context is canceled,
+// and waits for the requests in progress to finish
+func (c *Conn) Serve(ctx context.Context, handler Handler) error {
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	scanner := bufio.NewScanner(c.r)
+	scanner.Buffer(make([]byte, 64*1024), maxMessageSize)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+
+		var req Request
+		if err := json.Unmarshal(line, &req); err != nil {
+			c.reply(nil, nil, Errorf(CodeParseError, "parse error: %v", err))
+			continue
+		}
+		if req.JSONRPC != Version || req.Method == "" {
+			c.reply(req.ID, nil, Errorf(CodeInvalidRequest, "invalid request"))
+			continue
+		}
+
+		reqCtx, cancel := context.WithCancel(ctx)
+		if !req.IsNotification() {
+			c.mu.Lock()
+			c.pending[string(req.ID)] = cancel
+			c.mu.Unlock()
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			result, err := handler(reqCtx, c, &req)
+			c.finish(&req, cancel)
+			if !req.IsNotification() {
+				c.reply(req.ID, result, err)
+			}
+		}()
+	}
+
+	return scanner.Err()
+}
+
+// Cancel cancels the request with the given ID and tells if it was running
+func (c *Conn) Cancel(id json.RawMessage) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	cancel, ok := c.pending[string(id)]
+	if ok {
+		cancel()
+	}
+	return ok
+}
+
+// Notify sends a notification to the client
+func (c *Conn) Notify(method string, params interface{}) error {
+	return c.write(notification{JSONRPC: Version, Method: method, Params: params})
+}
+
+// finish forgets a handled request
+func (c *Conn) finish(req *Request, cancel context.CancelFunc) {
+	cancel()
+	if req.IsNotification() {
+		return
+	}
+
+	c.mu.Lock()
+	delete(c.pending, string(req.ID))
+	c.mu.Unlock()
+}
+
+// reply sends the response to a request
+func (c *Conn) reply(id json.RawMessage, result interface{}, err error) {
+	if id == nil {
+		id = json.RawMessage("null")
+	}
+	resp := response{JSONRPC: Version, ID: id}
+
+	if err == nil {
+		data, marshalErr := json.Marshal(result)
+		if marshalErr != nil {
+			err = marshalErr
+		}
+		resp.Result = data
+	}
+
+	if err != nil {
+		var rpcErr *Error
+		switch {
+		case errors.As(err, &rpcErr):
+			resp.Error = rpcErr
+		case errors.Is(err, context.Canceled):
+			resp.Error = &Error{Code: CodeRequestCancelled, Message: "request canceled"}
+		default:
+			resp.Error = &Error{Code: CodeInternalError, Message: err.Error()}
+		}
+		resp.Result = nil
+	}
+
+	// There is nobody to report a failed write to, the input will end soon
+	_ = c.write(resp)
+}
+
+// write writes a message on its own line
+func (c *Conn) write(message interface{}) error {
+	data, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	_, err = c.w.Write(append(data, '\n'))
+	return err
+}
@@ -0,0 +1,128 @@
+package rpc
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testHandler echoes its params, fails on request and blocks until canceled
+func testHandler(ctx context.Context, conn *Conn, req *Request) (interface{}, error) {
+	switch req.Method {
+	case "echo":
+		var params struct {
+			Text string `json:"text"`
+		}
+		if err := req.DecodeParams(&params); err != nil {
+			return nil, err
+		}
+		if err := conn.Notify("progress", map[string]string{"text": params.Text}); err != nil {
+			return nil, err
+		}
+		return params.Text, nil
+	case "fail":
+		return nil, errors.New("something broke")
+	case "block":
+		<-ctx.Done()
+		return nil, ctx.Err()
+	case "cancel":
+		var params struct {
+			ID json.RawMessage `json:"id"`
+		}
+		if err := req.DecodeParams(&params); err != nil {
+			return nil, err
+		}
+		return conn.Cancel(params.ID), nil
+	}
+	return nil, Errorf(CodeMethodNotFound, "method not found: %s", req.Method)
+}
+
+// TestServe tests handling requests and errors
+func TestServe(t *testing.T) {
+	input := strings.Join([]string{
+		`{"jsonrpc":"2.0","id":1,"method":"echo","params":{"text":"hello"}}`,
+		`{"jsonrpc":"2.0","id":2,"method":"fail"}`,
+		`{"jsonrpc":"2.0","id":3,"method":"missing"}`,
+		`{"jsonrpc":"2.0","id":4,"method":"echo","params":{"text":1}}`,
+		`{"jsonrpc":"1.0","id":5,"method":"echo"}`,
+		`{"jsonrpc":"2.0","method":"echo","params":{"text":"notification"}}`,
+		`not json`,
+		``,
+	}, "\n")
+
+	var out strings.Builder
+	require.NoError(t, NewConn(strings.NewReader(input), &out).Serve(context.Background(), testHandler))
+
+	// Requests are handled concurrently, so responses can be in any order
+	responses := map[string]string{}
+	var notifications []string
+	for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+		var message struct {
+			ID     json.RawMessage `json:"id"`
+			Method string          `json:"method"`
+		}
+		require.NoError(t, json.Unmarshal([]byte(line), &message))
+		if message.Method != "" {
+			notifications = append(notifications, line)
+			continue
+		}
+		responses[string(message.ID)] = line
+	}
+
+	assert.Equal(t, `{"jsonrpc":"2.0","id":1,"result":"hello"}`, responses["1"])
+	assert.Equal(t, `{"jsonrpc":"2.0","id":2,"error":{"code":-32603,"message":"something broke"}}`, responses["2"])
+	assert.Equal(t, `{"jsonrpc":"2.0","id":3,"error":{"code":-32601,"message":"method not found: missing"}}`, responses["3"])
+	assert.Contains(t, responses["4"], `"code":-32602`)
+	assert.Equal(t, `{"jsonrpc":"2.0","id":5,"error":{"code":-32600,"message":"invalid request"}}`, responses["5"])
+	assert.Contains(t, responses["null"], `"code":-32700`)
+	assert.Len(t, responses, 6)
+
+	// Notifications get no response, but the handler runs
+	assert.ElementsMatch(t, []string{
+		`{"jsonrpc":"2.0","method":"progress","params":{"text":"hello"}}`,
+		`{"jsonrpc":"2.0","method":"progress","params":{"text":"notification"}}`,
+	}, notifications)
+}
+
+// TestCancel tests canceling a running request
+func TestCancel(t *testing.T) {
+	inR, inW := io.Pipe()
+	outR, outW := io.Pipe()
+
+	done := make(chan error)
+	go func() {
+		done <- NewConn(inR, outW).Serve(context.Background(), testHandler)
+		outW.Close()
+	}()
+	responses := bufio.NewScanner(outR)
+
+	_, err := io.WriteString(inW, `{"jsonrpc":"2.0","id":"a","method":"block"}`+"\n")
+	require.NoError(t, err)
+	_, err = io.WriteString(inW, `{"jsonrpc":"2.0","id":"b","method":"cancel","params":{"id":"a"}}`+"\n")
+	require.NoError(t, err)
+
+	var lines []string
+	for len(lines) < 2 && responses.Scan() {
+		lines = append(lines, responses.Text())
+	}
+	assert.ElementsMatch(t, []string{
+		`{"jsonrpc":"2.0","id":"b","result":true}`,
+		`{"jsonrpc":"2.0","id":"a","error":{"code":-32800,"message":"request canceled"}}`,
+	}, lines)
+
+	// Finished requests can't be canceled anymore
+	_, err = io.WriteString(inW, `{"jsonrpc":"2.0","id":"c","method":"cancel","params":{"id":"a"}}`+"\n")
+	require.NoError(t, err)
+	require.True(t, responses.Scan())
+	assert.Equal(t, `{"jsonrpc":"2.0","id":"c","result":false}`, responses.Text())
+
+	inW.Close()
+	assert.NoError(t, <-done)
+}
@@ -0,0 +1,464 @@
+// Package schema validates JSON documents against a JSON Schema. It supports
+// the commonly used subset of the specification: types, enums and consts,
+// object properties, array items, string, number and size limits, the
+// combinators allOf, anyOf, oneOf and not, and local references.
+package schema
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// Schema is a parsed JSON Schema
+type Schema struct {
+	root interface{}
+	raw  json.RawMessage
+
+	// patterns caches the compiled regular expressions of the schema
+	patterns map[string]*regexp.Regexp
+}
+
+// Load reads a schema from a file
+func Load(path string) (*Schema, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read schema: %w", err)
+	}
+	s, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return s, nil
+}
+
+// Parse parses a schema and checks its regular expressions
+func Parse(data []byte) (*Schema, error) {
+	var root interface{}
+	if err := decode(data, &root); err != nil {
+		return nil, fmt.Errorf("invalid schema: %w", err)
+	}
+	switch root.(type) {
+	case map[string]interface{}, bool:
+	default:
+		return nil, errors.New("invalid schema: must be an object or a boolean")
+	}
+
+	s := &Schema{root: root, raw: json.RawMessage(bytes.TrimSpace(data)), patterns: make(map[string]*regexp.Regexp)}
+	if err := s.compilePatterns(root); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// JSON returns the schema as it was parsed
+func (s *Schema) JSON() json.RawMessage {
+	return s.raw
+}
+
+// Validate checks that the JSON document conforms to the schema. The error
+// lists every violation with the location in the document.
+func (s *Schema) Validate(data []byte) error {
+	var value interface{}
+	if err := decode(data, &value); err != nil {
+		return fmt.Errorf("invalid JSON: %w", err)
+	}
+
+	var violations []string
+	s.validate(s.root, value, "", &violations)
+	if len(violations) == 0 {
+		return nil
+	}
+	return errors.New(strings.Join(violations, "\n"))
+}
+
+// decode decodes JSON keeping numbers exact
+func decode(data []byte, v interface{}) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(v); err != nil {
+		return err
+	}
+	if dec.More() {
+		return errors.New("unexpected data after the JSON value")
+	}
+	return nil
+}
+
+// compilePatterns compiles the pattern keywords of the schema
+func (s *Schema) compilePatterns(node interface{}) error {
+	switch n := node.(type) {
+	case map[string]interface{}:
+		for key, value := range n {
+			if pattern, ok := value.(string); ok && key == "pattern" {
+				re, err := regexp.Compile(pattern)
+				if err != nil {
+					return fmt.Errorf("invalid schema: pattern %q: %w", pattern, err)
+				}
+				s.patterns[pattern] = re
+				continue
+			}
+			if err := s.compilePatterns(value); err != nil {
+				return err
+			}
+		}
+	case []interface{}:
+		for _, value := range n {
+			if err := s.compilePatterns(value); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// validate appends the violations of value against the schema node
+func (s *Schema) validate(node, value interface{}, path string, violations *[]string) {
+	fail := func(format string, args ...interface{}) {
+		location := path
+		if location == "" {
+			location = "/"
+		}
+		*violations = append(*violations, location+": "+fmt.Sprintf(format, args...))
+	}
+
+	switch n := node.(type) {
+	case bool:
+		if !n {
+			fail("no value is allowed here")
+		}
+		return
+	case map[string]interface{}:
+		node := n
+		if ref, ok := node["$ref"].(string); ok {
+			target, err := s.resolve(ref)
+			if err != nil {
+				fail("%v", err)
+				return
+			}
+			s.validate(target, value, path, violations)
+		}
+
+		s.validateType(node, value, fail)
+		s.validateGeneric(node, value, path, violations, fail)
+
+		switch v := value.(type) {
+		case map[string]interface{}:
+			s.validateObject(node, v, path, violations, fail)
+		case []interface{}:
+			s.validateArray(node, v, path, violations, fail)
+		case string:
+			s.validateString(node, v, fail)
+		case json.Number:
+			validateNumber(node, v, fail)
+		}
+	}
+}
+
+// validateType checks the type keyword
+func (s *Schema) validateType(node map[string]interface{}, value interface{}, fail func(string, ...interface{})) {
+	var types []string
+	switch t := node["type"].(type) {
+	case string:
+		types = []string{t}
+	case []interface{}:
+		for _, name := range t {
+			if name, ok := name.(string); ok {
+				types = append(types, name)
+			}
+		}
+	default:
+		return
+	}
+
+	actual := typeOf(value)
+	for _, t := range types {
+		if t == actual || (t == "number" && actual == "integer") {
+			return
+		}
+	}
+	fail("must be %s, got %s", strings.Join(types, " or "), actual)
+}
+
+// validateGeneric checks the keywords that apply to every type
+func (s *Schema) validateGeneric(node map[string]interface{}, value interface{}, path string, violations *[]string, fail func(string, ...interface{})) {
+	if enum, ok := node["enum"].([]interface{}); ok {
+		found := false
+		for _, allowed := range enum {
+			if equal(allowed, value) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			fail("must be one of %s", compact(enum))
+		}
+	}
+
+	if constant, ok := node["const"]; ok && !equal(constant, value) {
+		fail("must be %s", compact(constant))
+	}
+
+	if all, ok := node["allOf"].([]interface{}); ok {
+		for _, sub := range all {
+			s.validate(sub, value, path, violations)
+		}
+	}
+
+	if anyOf, ok := node["anyOf"].([]interface{}); ok && s.matching(anyOf, value, path) == 0 {
+		fail("must match at least one of the anyOf schemas")
+	}
+
+	if oneOf, ok := node["oneOf"].([]interface{}); ok {
+		if matches := s.matching(oneOf, value, path); matches != 1 {
+			fail("must match exactly one of the oneOf schemas, matches %d", matches)
+		}
+	}
+
+	if not, ok := node["not"]; ok && s.matching([]interface{}{not}, value, path) == 1 {
+		fail("must not match the not schema")
+	}
+}
+
+// matching returns the number of schemas the value conforms to
+func (s *Schema) matching(schemas []interface{}, value interface{}, path string) int {
+	matches := 0
+	for _, sub := range schemas {
+		var violations []string
+		s.validate(sub, value, path, &violations)
+		if len(violations) == 0 {
+			matches++
+		}
+	}
+	return matches
+}
+
+// validateObject checks the keywords for objects
+func (s *Schema) validateObject(node map[string]interface{}, object map[string]interface{}, path string, violations *[]string, fail func(string, ...interface{})) {
+	if required, ok := node["required"].([]interface{}); ok {
+		for _, name := range required {
+			if name, ok := name.(string); ok {
+				if _, present := object[name]; !present {
+					fail("missing required property %q", name)
+				}
+			}
+		}
+	}
+
+	if min, ok := intKeyword(node, "minProperties"); ok && len(object) < min {
+		fail("must have at least %d properties", min)
+	}
+	if max, ok := intKeyword(node, "maxProperties"); ok && len(object) > max {
+		fail("must have at most %d properties", max)
+	}
+
+	properties, _ := node["properties"].(map[string]interface{})
+	additional, hasAdditional := node["additionalProperties"]
+
+	names := make([]string, 0, len(object))
+	for name := range object {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		propertyPath := path + "/" + escapePointer(name)
+		if sub, ok := properties[name]; ok {
+			s.validate(sub, object[name], propertyPath, violations)
+			continue
+		}
+		if !hasAdditional {
+			continue
+		}
+		if allowed, ok := additional.(bool); ok && !allowed {
+			fail("property %q is not allowed", name)
+			continue
+		}
+		s.validate(additional, object[name], propertyPath, violations)
+	}
+}
+
+// validateArray checks the keywords for arrays
+func (s *Schema) validateArray(node map[string]interface{}, array []interface{}, path string, violations *[]string, fail func(string, ...interface{})) {
+	if min, ok := intKeyword(node, "minItems"); ok && len(array) < min {
+		fail("must have at least %d items, has %d", min, len(array))
+	}
+	if max, ok := intKeyword(node, "maxItems"); ok && len(array) > max {
+		fail("must have at most %d items, has %d", max, len(array))
+	}
+
+	if unique, _ := node["uniqueItems"].(bool); unique {
+		for i := range array {
+			for j := i + 1; j < len(array); j++ {
+				if equal(array[i], array[j]) {
+					fail("items %d and %d must be unique", i, j)
+				}
+			}
+		}
+	}
+
+	if items, ok := node["items"]; ok {
+		for i, item := range array {
+			s.validate(items, item, fmt.Sprintf("%s/%d", path, i), violations)
+		}
+	}
+}
+
+// validateString checks the keywords for strings
+func (s *Schema) validateString(node map[string]interface{}, str string, fail func(string, ...interface{})) {
+	length := utf8.RuneCountInString(str)
+	if min, ok := intKeyword(node, "minLength"); ok && length < min {
+		fail("must be at least %d characters long", min)
+	}
+	if max, ok := intKeyword(node, "maxLength"); ok && length > max {
+		fail("must be at most %d characters long", max)
+	}
+	if pattern, ok := node["pattern"].(string); ok && !s.patterns[pattern].MatchString(str) {
+		fail("must match the pattern %s", pattern)
+	}
+}
+
+// validateNumber checks the keywords for numbers
+func validateNumber(node map[string]interface{}, number json.Number, fail func(string, ...interface{})) {
+	value, err := number.Float64()
+	if err != nil {
+		return
+	}
+
+	if min, ok := floatKeyword(node, "minimum"); ok && value < min {
+		fail("must be at least %v", min)
+	}
+	if max, ok := floatKeyword(node, "maximum"); ok && value > max {
+		fail("must be at most %v", max)
+	}
+	if min, ok := floatKeyword(node, "exclusiveMinimum"); ok && value <= min {
+		fail("must be greater than %v", min)
+	}
+	if max, ok := floatKeyword(node, "exclusiveMaximum"); ok && value >= max {
+		fail("must be less than %v", max)
+	}
+	if multiple, ok := floatKeyword(node, "multipleOf"); ok && multiple > 0 {
+		if quotient := value / multiple; math.Abs(quotient-math.Round(quotient)) > 1e-9 {
+			fail("must be a multiple of %v", multiple)
+		}
+	}
+}
+
+// resolve returns the schema node a local reference like "#/$defs/item"
+// points to
+func (s *Schema) resolve(ref string) (interface{}, error) {
+	if !strings.HasPrefix(ref, "#") {
+		return nil, fmt.Errorf("unsupported reference %q, only references within the schema are supported", ref)
+	}
+
+	node := s.root
+	for _, token := range strings.Split(strings.TrimPrefix(ref, "#"), "/")[1:] {
+		token = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+		object, ok := node.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("unresolvable reference %q", ref)
+		}
+		if node, ok = object[token]; !ok {
+			return nil, fmt.Errorf("unresolvable reference %q", ref)
+		}
+	}
+	return node, nil
+}
+
+// typeOf returns the JSON Schema type of a decoded value
+func typeOf(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	case json.Number:
+		if f, err := v.Float64(); err == nil && f == math.Trunc(f) {
+			return "integer"
+		}
+		return "number"
+	}
+	return "unknown"
+}
+
+// equal compares decoded values, numbers by their value
+func equal(a, b interface{}) bool {
+	if x, ok := a.(json.Number); ok {
+		y, ok := b.(json.Number)
+		if !ok {
+			return false
+		}
+		fx, errX := x.Float64()
+		fy, errY := y.Float64()
+		return errX == nil && errY == nil && fx == fy
+	}
+	switch x := a.(type) {
+	case []interface{}:
+		y, ok := b.([]interface{})
+		if !ok || len(x) != len(y) {
+			return false
+		}
+		for i := range x {
+			if !equal(x[i], y[i]) {
+				return false
+			}
+		}
+		return true
+	case map[string]interface{}:
+		y, ok := b.(map[string]interface{})
+		if !ok || len(x) != len(y) {
+			return false
+		}
+		for key, value := range x {
+			if other, ok := y[key]; !ok || !equal(value, other) {
+				return false
+			}
+		}
+		return true
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+// intKeyword returns a non-negative integer keyword
+func intKeyword(node map[string]interface{}, key string) (int, bool) {
+	f, ok := floatKeyword(node, key)
+	return int(f), ok && f >= 0
+}
+
+// floatKeyword returns a numeric keyword
+func floatKeyword(node map[string]interface{}, key string) (float64, bool) {
+	number, ok := node[key].(json.Number)
+	if !ok {
+		return 0, false
+	}
+	f, err := number.Float64()
+	return f, err == nil
+}
+
+// compact formats a decoded value as JSON for error messages
+func compact(value interface{}) string {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	return string(data)
+}
+
+// escapePointer escapes a property name for a JSON pointer
+func escapePointer(name string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(name, "~", "~0"), "/", "~1")
+}
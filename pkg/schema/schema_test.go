@@ -0,0 +1,105 @@
+package schema
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const personSchema = `{
+  "type": "object",
+  "required": ["name", "email"],
+  "additionalProperties": false,
+  "properties": {
+    "name": {"type": "string", "minLength": 1},
+    "email": {"type": "string", "pattern": "^[^@]+@[^@]+$"},
+    "age": {"type": "integer", "minimum": 0, "maximum": 150},
+    "role": {"enum": ["admin", "user"]},
+    "tags": {"type": "array", "items": {"$ref": "#/$defs/tag"}, "maxItems": 2, "uniqueItems": true}
+  },
+  "$defs": {
+    "tag": {"type": "string", "maxLength": 5}
+  }
+}`
+
+// TestValidate tests validating documents against a schema
+func TestValidate(t *testing.T) {
+	s, err := Parse([]byte(personSchema))
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name     string
+		document string
+		expected string
+	}{
+		{name: "Valid", document: `{"name":"Ada","email":"ada@example.com","age":36,"role":"admin","tags":["math"]}`},
+		{name: "Missing", document: `{"name":"Ada"}`, expected: `/: missing required property "email"`},
+		{name: "Type", document: `{"name":"Ada","email":"ada@example.com","age":36.5}`, expected: "/age: must be integer, got number"},
+		{name: "Range", document: `{"name":"Ada","email":"ada@example.com","age":200}`, expected: "/age: must be at most 150"},
+		{name: "Pattern", document: `{"name":"Ada","email":"ada"}`, expected: "/email: must match the pattern ^[^@]+@[^@]+$"},
+		{name: "Enum", document: `{"name":"Ada","email":"a@b","role":"root"}`, expected: `/role: must be one of ["admin","user"]`},
+		{name: "Additional", document: `{"name":"Ada","email":"a@b","x":1}`, expected: `/: property "x" is not allowed`},
+		{name: "Reference", document: `{"name":"Ada","email":"a@b","tags":["toolong"]}`, expected: "/tags/0: must be at most 5 characters long"},
+		{name: "Items", document: `{"name":"Ada","email":"a@b","tags":["a","a","b"]}`, expected: "/tags: must have at most 2 items, has 3\n/tags: items 0 and 1 must be unique"},
+		{name: "Several", document: `{"name":"","email":1}`, expected: "/email: must be string, got integer\n/name: must be at least 1 characters long"},
+		{name: "Root type", document: `[]`, expected: "/: must be object, got array"},
+		{name: "Invalid JSON", document: `{"name":`, expected: "invalid JSON: unexpected EOF"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := s.Validate([]byte(tc.document))
+			if tc.expected == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.EqualError(t, err, tc.expected)
+		})
+	}
+}
+
+// TestCombinators tests allOf, anyOf, oneOf and not
+func TestCombinators(t *testing.T) {
+	s, err := Parse([]byte(`{
+	  "anyOf": [{"type": "string"}, {"type": "number"}],
+	  "allOf": [{"not": {"const": "no"}}]
+	}`))
+	require.NoError(t, err)
+
+	assert.NoError(t, s.Validate([]byte(`1`)))
+	assert.NoError(t, s.Validate([]byte(`"yes"`)))
+	assert.EqualError(t, s.Validate([]byte(`true`)), "/: must match at least one of the anyOf schemas")
+	assert.EqualError(t, s.Validate([]byte(`"no"`)), "/: must not match the not schema")
+
+	s, err = Parse([]byte(`{"oneOf": [{"type": "integer"}, {"type": "number", "maximum": 10}]}`))
+	require.NoError(t, err)
+
+	assert.NoError(t, s.Validate([]byte(`1.5`)))
+	assert.NoError(t, s.Validate([]byte(`20`)))
+	assert.EqualError(t, s.Validate([]byte(`1`)), "/: must match exactly one of the oneOf schemas, matches 2")
+	assert.EqualError(t, s.Validate([]byte(`"1"`)), "/: must match exactly one of the oneOf schemas, matches 0")
+}
+
+// TestParseErrors tests that invalid schemas are rejected
+func TestParseErrors(t *testing.T) {
+	_, err := Parse([]byte(`{"type":`))
+	assert.ErrorContains(t, err, "invalid schema")
+
+	_, err = Parse([]byte(`"string"`))
+	assert.EqualError(t, err, "invalid schema: must be an object or a boolean")
+
+	_, err = Parse([]byte(`{"properties":{"a":{"pattern":"("}}}`))
+	assert.ErrorContains(t, err, `invalid schema: pattern "("`)
+
+	path := filepath.Join(t.TempDir(), "schema.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{"type":"object"}`), 0644))
+	s, err := Load(path)
+	require.NoError(t, err)
+	assert.Equal(t, `{"type":"object"}`, string(s.JSON()))
+
+	_, err = Load(filepath.Join(t.TempDir(), "missing.json"))
+	assert.ErrorContains(t, err, "failed to read schema")
+}
@@ -0,0 +1,260 @@
+package script
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+
+	"go.starlark.net/lib/json"
+	"go.starlark.net/starlark"
+	"go.starlark.net/syntax"
+)
+
+// Names of the functions a hook script can define
+const (
+	requestFunc  = "on_request"
+	responseFunc = "on_response"
+)
+
+// Hook is a loaded Starlark script that can mutate outgoing requests and
+// incoming responses.
+//
+// A script may define either or both of the following functions:
+//
+//	def on_request(request):
+//	    # request is the JSON payload as a dict; return the modified dict
+//	    return request
+//
+//	def on_response(response):
+//	    # response is the answer text; return the modified text
+//	    return response
+type Hook struct {
+	path    string
+	globals starlark.StringDict
+	stderr  io.Writer
+}
+
+// Load reads and executes the hook script at path
+func Load(path string) (*Hook, error) {
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read hook script: %w", err)
+	}
+
+	return LoadSource(path, src)
+}
+
+// LoadSource executes the hook script source; path is only used in messages
+func LoadSource(path string, src []byte) (*Hook, error) {
+	h := &Hook{path: path, stderr: os.Stderr}
+
+	predeclared := starlark.StringDict{
+		"json": json.Module,
+	}
+
+	globals, err := starlark.ExecFileOptions(&syntax.FileOptions{}, h.thread(), path, src, predeclared)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load hook script %s: %w", path, err)
+	}
+	h.globals = globals
+
+	for _, name := range []string{requestFunc, responseFunc} {
+		if fn, ok := globals[name]; ok {
+			if _, callable := fn.(starlark.Callable); !callable {
+				return nil, fmt.Errorf("hook script %s: %s must be a function", path, name)
+			}
+		}
+	}
+
+	return h, nil
+}
+
+// HasRequestHook reports whether the script defines on_request
+func (h *Hook) HasRequestHook() bool {
+	if h == nil {
+		return false
+	}
+	_, ok := h.globals[requestFunc]
+	return ok
+}
+
+// HasResponseHook reports whether the script defines on_response
+func (h *Hook) HasResponseHook() bool {
+	if h == nil {
+		return false
+	}
+	_, ok := h.globals[responseFunc]
+	return ok
+}
+
+// OnRequest passes the request payload through the script's on_request function
+func (h *Hook) OnRequest(payload map[string]interface{}) (map[string]interface{}, error) {
+	if !h.HasRequestHook() {
+		return payload, nil
+	}
+
+	arg, err := toStarlark(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := h.call(requestFunc, arg)
+	if err != nil {
+		return nil, err
+	}
+
+	value, err := fromStarlark(result)
+	if err != nil {
+		return nil, fmt.Errorf("%s returned an invalid request: %w", requestFunc, err)
+	}
+
+	modified, ok := value.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%s must return a dict, got %s", requestFunc, result.Type())
+	}
+
+	return modified, nil
+}
+
+// OnResponse passes the response text through the script's on_response function
+func (h *Hook) OnResponse(response string) (string, error) {
+	if !h.HasResponseHook() {
+		return response, nil
+	}
+
+	result, err := h.call(responseFunc, starlark.String(response))
+	if err != nil {
+		return "", err
+	}
+
+	text, ok := starlark.AsString(result)
+	if !ok {
+		return "", fmt.Errorf("%s must return a string, got %s", responseFunc, result.Type())
+	}
+
+	return text, nil
+}
+
+// call invokes a global function of the script with a single argument
+func (h *Hook) call(name string, arg starlark.Value) (starlark.Value, error) {
+	result, err := starlark.Call(h.thread(), h.globals[name], starlark.Tuple{arg}, nil)
+	if err != nil {
+		return nil, fmt.Errorf("hook script %s: %s failed: %w", h.path, name, err)
+	}
+	return result, nil
+}
+
+// thread creates a Starlark thread whose print output goes to stderr
+func (h *Hook) thread() *starlark.Thread {
+	return &starlark.Thread{
+		Name: h.path,
+		Print: func(_ *starlark.Thread, msg string) {
+			fmt.Fprintln(h.stderr, msg)
+		},
+	}
+}
+
+// toStarlark converts a decoded JSON value to a Starlark value
+func toStarlark(v interface{}) (starlark.Value, error) {
+	switch v := v.(type) {
+	case nil:
+		return starlark.None, nil
+	case bool:
+		return starlark.Bool(v), nil
+	case string:
+		return starlark.String(v), nil
+	case float64:
+		if v == math.Trunc(v) && math.Abs(v) < 1<<53 {
+			return starlark.MakeInt64(int64(v)), nil
+		}
+		return starlark.Float(v), nil
+	case []interface{}:
+		elems := make([]starlark.Value, 0, len(v))
+		for _, item := range v {
+			elem, err := toStarlark(item)
+			if err != nil {
+				return nil, err
+			}
+			elems = append(elems, elem)
+		}
+		return starlark.NewList(elems), nil
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		dict := starlark.NewDict(len(v))
+		for _, key := range keys {
+			value, err := toStarlark(v[key])
+			if err != nil {
+				return nil, err
+			}
+			if err := dict.SetKey(starlark.String(key), value); err != nil {
+				return nil, err
+			}
+		}
+		return dict, nil
+	default:
+		return nil, fmt.Errorf("unsupported value of type %T", v)
+	}
+}
+
+// fromStarlark converts a Starlark value to a value that can be encoded as JSON
+func fromStarlark(v starlark.Value) (interface{}, error) {
+	switch v := v.(type) {
+	case starlark.NoneType:
+		return nil, nil
+	case starlark.Bool:
+		return bool(v), nil
+	case starlark.String:
+		return string(v), nil
+	case starlark.Int:
+		i, ok := v.Int64()
+		if !ok {
+			return nil, fmt.Errorf("integer %s out of range", v)
+		}
+		return i, nil
+	case starlark.Float:
+		return float64(v), nil
+	case *starlark.List:
+		return fromIterable(v)
+	case starlark.Tuple:
+		return fromIterable(v)
+	case *starlark.Dict:
+		m := make(map[string]interface{}, v.Len())
+		for _, item := range v.Items() {
+			key, ok := starlark.AsString(item[0])
+			if !ok {
+				return nil, fmt.Errorf("dict keys must be strings, got %s", item[0].Type())
+			}
+			value, err := fromStarlark(item[1])
+			if err != nil {
+				return nil, err
+			}
+			m[key] = value
+		}
+		return m, nil
+	default:
+		return nil, fmt.Errorf("unsupported value of type %s", v.Type())
+	}
+}
+
+func fromIterable(v starlark.Iterable) ([]interface{}, error) {
+	items := []interface{}{}
+	iter := v.Iterate()
+	defer iter.Done()
+
+	var elem starlark.Value
+	for iter.Next(&elem) {
+		item, err := fromStarlark(elem)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
@@ -0,0 +1,114 @@
+package script
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestOnRequest tests mutating the request payload
+func TestOnRequest(t *testing.T) {
+	hook, err := LoadSource("hook.star", []byte(`
+def on_request(request):
+    request["temperature"] = 0.2
+    for message in request["messages"]:
+        message["content"] = message["content"].replace("secret", "[REDACTED]")
+    if request["model"] == "fast":
+        request["model"] = "gpt-4o-mini"
+    return request
+`))
+	require.NoError(t, err)
+	assert.True(t, hook.HasRequestHook())
+	assert.False(t, hook.HasResponseHook())
+
+	payload, err := hook.OnRequest(map[string]interface{}{
+		"model":  "fast",
+		"stream": true,
+		"messages": []interface{}{
+			map[string]interface{}{"role": "user", "content": "my secret is 42"},
+		},
+		"max_tokens": float64(100),
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, "gpt-4o-mini", payload["model"])
+	assert.Equal(t, true, payload["stream"])
+	assert.Equal(t, 0.2, payload["temperature"])
+	assert.Equal(t, int64(100), payload["max_tokens"])
+	assert.Equal(t, []interface{}{
+		map[string]interface{}{"role": "user", "content": "my [REDACTED] is 42"},
+	}, payload["messages"])
+}
+
+// TestOnResponse tests mutating the response text
+func TestOnResponse(t *testing.T) {
+	hook, err := LoadSource("hook.star", []byte(`
+def on_response(response):
+    return response.strip().upper()
+`))
+	require.NoError(t, err)
+	assert.False(t, hook.HasRequestHook())
+	assert.True(t, hook.HasResponseHook())
+
+	response, err := hook.OnResponse("  hello  ")
+	require.NoError(t, err)
+	assert.Equal(t, "HELLO", response)
+
+	// Without on_request the payload is passed through unchanged
+	payload := map[string]interface{}{"model": "gpt-4"}
+	result, err := hook.OnRequest(payload)
+	require.NoError(t, err)
+	assert.Equal(t, payload, result)
+}
+
+// TestHookErrors tests that script errors are reported
+func TestHookErrors(t *testing.T) {
+	_, err := LoadSource("broken.star", []byte("def on_request(:"))
+	assert.ErrorContains(t, err, "failed to load hook script broken.star")
+
+	_, err = LoadSource("invalid.star", []byte("on_request = 1"))
+	assert.ErrorContains(t, err, "on_request must be a function")
+
+	hook, err := LoadSource("wrong.star", []byte(`
+def on_request(request):
+    return "not a dict"
+
+def on_response(response):
+    fail("refusing to answer")
+`))
+	require.NoError(t, err)
+
+	_, err = hook.OnRequest(map[string]interface{}{})
+	assert.ErrorContains(t, err, "on_request must return a dict")
+
+	_, err = hook.OnResponse("text")
+	assert.ErrorContains(t, err, "refusing to answer")
+
+	_, err = Load(filepath.Join(t.TempDir(), "missing.star"))
+	assert.ErrorContains(t, err, "failed to read hook script")
+}
+
+// TestLoad tests loading a script from a file and using the json module
+func TestLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "hook.star")
+	err := os.WriteFile(path, []byte(`
+def on_response(response):
+    return json.encode({"answer": response})
+`), 0644)
+	require.NoError(t, err)
+
+	hook, err := Load(path)
+	require.NoError(t, err)
+
+	response, err := hook.OnResponse("42")
+	require.NoError(t, err)
+	assert.Equal(t, `{"answer":"42"}`, response)
+
+	// A nil hook does nothing
+	var none *Hook
+	assert.False(t, none.HasRequestHook())
+	assert.False(t, none.HasResponseHook())
+}
@@ -0,0 +1,240 @@
+// Package search queries web search engines for the web_search tool of agent
+// mode. SearXNG instances, the Brave Search API and the Bing Web Search API
+// are supported.
+package search
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Names of the backends
+const (
+	SearXNG = "searxng"
+	Brave   = "brave"
+	Bing    = "bing"
+)
+
+// Backends are the names of the supported backends
+var Backends = []string{SearXNG, Brave, Bing}
+
+// Default endpoints of the APIs
+const (
+	BraveURL = "https://api.search.brave.com/res/v1/web/search"
+	BingURL  = "https://api.bing.microsoft.com/v7.0/search"
+)
+
+// maxResponse limits the size of a response of a search engine
+const maxResponse = 4 << 20
+
+// Result is a page found by a search
+type Result struct {
+	Title   string
+	URL     string
+	Snippet string
+}
+
+// Searcher searches the web
+type Searcher interface {
+	Search(ctx context.Context, query string, count int) ([]Result, error)
+}
+
+// Options configures a backend
+type Options struct {
+	// Backend is searxng, brave or bing
+	Backend string
+
+	// URL is the address of the SearXNG instance, or overrides the endpoint
+	// of the Brave and Bing APIs
+	URL string
+
+	// APIKey is the subscription key of the Brave and Bing APIs
+	APIKey string
+
+	Client *http.Client
+}
+
+// New creates the searcher of the backend
+func New(opts Options) (Searcher, error) {
+	if opts.Client == nil {
+		opts.Client = http.DefaultClient
+	}
+
+	switch opts.Backend {
+	case SearXNG:
+		if opts.URL == "" {
+			return nil, fmt.Errorf("the URL of the SearXNG instance is required")
+		}
+		return &searxng{opts: opts}, nil
+	case Brave:
+		if opts.URL == "" {
+			opts.URL = BraveURL
+		}
+		if opts.APIKey == "" {
+			return nil, fmt.Errorf("an API key is required for Brave Search")
+		}
+		return &brave{opts: opts}, nil
+	case Bing:
+		if opts.URL == "" {
+			opts.URL = BingURL
+		}
+		if opts.APIKey == "" {
+			return nil, fmt.Errorf("an API key is required for Bing Web Search")
+		}
+		return &bing{opts: opts}, nil
+	default:
+		return nil, fmt.Errorf("unknown search backend %q (available: %s)", opts.Backend, strings.Join(Backends, ", "))
+	}
+}
+
+// searxng searches with the JSON API of a SearXNG instance
+type searxng struct {
+	opts Options
+}
+
+func (s *searxng) Search(ctx context.Context, query string, count int) ([]Result, error) {
+	endpoint := strings.TrimSuffix(s.opts.URL, "/") + "/search"
+	var response struct {
+		Results []struct {
+			Title   string `json:"title"`
+			URL     string `json:"url"`
+			Content string `json:"content"`
+		} `json:"results"`
+	}
+	params := url.Values{"q": {query}, "format": {"json"}}
+	if err := get(ctx, s.opts.Client, endpoint, params, nil, &response); err != nil {
+		return nil, err
+	}
+
+	var results []Result
+	for _, r := range response.Results {
+		results = append(results, Result{Title: r.Title, URL: r.URL, Snippet: r.Content})
+	}
+	return first(results, count), nil
+}
+
+// brave searches with the Brave Search API
+type brave struct {
+	opts Options
+}
+
+func (b *brave) Search(ctx context.Context, query string, count int) ([]Result, error) {
+	var response struct {
+		Web struct {
+			Results []struct {
+				Title       string `json:"title"`
+				URL         string `json:"url"`
+				Description string `json:"description"`
+			} `json:"results"`
+		} `json:"web"`
+	}
+	params := url.Values{"q": {query}, "count": {strconv.Itoa(count)}}
+	header := http.Header{"X-Subscription-Token": {b.opts.APIKey}}
+	if err := get(ctx, b.opts.Client, b.opts.URL, params, header, &response); err != nil {
+		return nil, err
+	}
+
+	var results []Result
+	for _, r := range response.Web.Results {
+		results = append(results, Result{Title: r.Title, URL: r.URL, Snippet: stripTags(r.Description)})
+	}
+	return first(results, count), nil
+}
+
+// bing searches with the Bing Web Search API
+type bing struct {
+	opts Options
+}
+
+func (b *bing) Search(ctx context.Context, query string, count int) ([]Result, error) {
+	var response struct {
+		WebPages struct {
+			Value []struct {
+				Name    string `json:"name"`
+				URL     string `json:"url"`
+				Snippet string `json:"snippet"`
+			} `json:"value"`
+		} `json:"webPages"`
+	}
+	params := url.Values{"q": {query}, "count": {strconv.Itoa(count)}}
+	header := http.Header{"Ocp-Apim-Subscription-Key": {b.opts.APIKey}}
+	if err := get(ctx, b.opts.Client, b.opts.URL, params, header, &response); err != nil {
+		return nil, err
+	}
+
+	var results []Result
+	for _, r := range response.WebPages.Value {
+		results = append(results, Result{Title: r.Name, URL: r.URL, Snippet: r.Snippet})
+	}
+	return first(results, count), nil
+}
+
+// get sends a GET request with the query parameters and headers and decodes
+// the JSON response
+func get(ctx context.Context, client *http.Client, endpoint string, params url.Values, header http.Header, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint+"?"+params.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxResponse))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("search failed: %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	if err := json.Unmarshal(body, v); err != nil {
+		return fmt.Errorf("invalid search response: %w", err)
+	}
+	return nil
+}
+
+// first returns at most count results
+func first(results []Result, count int) []Result {
+	if count > 0 && len(results) > count {
+		return results[:count]
+	}
+	return results
+}
+
+// stripTags removes the <strong> highlighting of search terms from snippets
+func stripTags(snippet string) string {
+	return strings.NewReplacer("<strong>", "", "</strong>", "").Replace(snippet)
+}
+
+// Format lists the results for the model, numbered, with their URLs and
+// snippets
+func Format(results []Result) string {
+	if len(results) == 0 {
+		return "No results."
+	}
+
+	var b strings.Builder
+	for i, r := range results {
+		if i > 0 {
+			b.WriteString("\n")
+		}
+		fmt.Fprintf(&b, "%d. %s\n   %s\n", i+1, strings.TrimSpace(r.Title), r.URL)
+		if snippet := strings.Join(strings.Fields(r.Snippet), " "); snippet != "" {
+			fmt.Fprintf(&b, "   %s\n", snippet)
+		}
+	}
+	return b.String()
+}
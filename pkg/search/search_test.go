@@ -0,0 +1,98 @@
+package search
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// mockEngine serves a JSON response and records the last request
+func mockEngine(t *testing.T, status int, response string) (*httptest.Server, **http.Request) {
+	t.Helper()
+
+	var last *http.Request
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		last = r
+		w.WriteHeader(status)
+		w.Write([]byte(response))
+	}))
+	t.Cleanup(server.Close)
+	return server, &last
+}
+
+// TestSearXNG tests searching a SearXNG instance
+func TestSearXNG(t *testing.T) {
+	server, last := mockEngine(t, http.StatusOK, `{"results":[
+		{"title":"Go 1.22","url":"https://go.dev/doc/go1.22","content":"Loop variables are per iteration."},
+		{"title":"Blog","url":"https://go.dev/blog","content":""},
+		{"title":"Third","url":"https://example.com","content":"More"}]}`)
+
+	searcher, err := New(Options{Backend: SearXNG, URL: server.URL + "/"})
+	require.NoError(t, err)
+	results, err := searcher.Search(context.Background(), "go loops", 2)
+	require.NoError(t, err)
+
+	assert.Equal(t, []Result{
+		{Title: "Go 1.22", URL: "https://go.dev/doc/go1.22", Snippet: "Loop variables are per iteration."},
+		{Title: "Blog", URL: "https://go.dev/blog"},
+	}, results)
+	assert.Equal(t, "/search", (*last).URL.Path)
+	assert.Equal(t, "go loops", (*last).URL.Query().Get("q"))
+	assert.Equal(t, "json", (*last).URL.Query().Get("format"))
+}
+
+// TestBrave tests searching with the Brave Search API
+func TestBrave(t *testing.T) {
+	server, last := mockEngine(t, http.StatusOK, `{"web":{"results":[
+		{"title":"Go","url":"https://go.dev","description":"The <strong>Go</strong> language"}]}}`)
+
+	searcher, err := New(Options{Backend: Brave, URL: server.URL, APIKey: "brave-key"})
+	require.NoError(t, err)
+	results, err := searcher.Search(context.Background(), "golang", 5)
+	require.NoError(t, err)
+
+	assert.Equal(t, []Result{{Title: "Go", URL: "https://go.dev", Snippet: "The Go language"}}, results)
+	assert.Equal(t, "brave-key", (*last).Header.Get("X-Subscription-Token"))
+	assert.Equal(t, "5", (*last).URL.Query().Get("count"))
+}
+
+// TestBing tests searching with the Bing Web Search API
+func TestBing(t *testing.T) {
+	server, last := mockEngine(t, http.StatusOK, `{"webPages":{"value":[
+		{"name":"Go","url":"https://go.dev","snippet":"Build simple software."}]}}`)
+
+	searcher, err := New(Options{Backend: Bing, URL: server.URL, APIKey: "bing-key"})
+	require.NoError(t, err)
+	results, err := searcher.Search(context.Background(), "golang", 3)
+	require.NoError(t, err)
+
+	assert.Equal(t, []Result{{Title: "Go", URL: "https://go.dev", Snippet: "Build simple software."}}, results)
+	assert.Equal(t, "bing-key", (*last).Header.Get("Ocp-Apim-Subscription-Key"))
+}
+
+// TestSearchErrors tests invalid options and failing searches
+func TestSearchErrors(t *testing.T) {
+	_, err := New(Options{Backend: "google"})
+	assert.EqualError(t, err, `unknown search backend "google" (available: searxng, brave, bing)`)
+	_, err = New(Options{Backend: SearXNG})
+	assert.EqualError(t, err, "the URL of the SearXNG instance is required")
+	_, err = New(Options{Backend: Brave})
+	assert.EqualError(t, err, "an API key is required for Brave Search")
+
+	server, _ := mockEngine(t, http.StatusUnauthorized, `{"error":"invalid key"}`)
+	searcher, err := New(Options{Backend: Bing, URL: server.URL, APIKey: "wrong"})
+	require.NoError(t, err)
+	_, err = searcher.Search(context.Background(), "golang", 3)
+	assert.EqualError(t, err, `search failed: 401 Unauthorized: {"error":"invalid key"}`)
+}
+
+// TestFormat tests listing results for the model
+func TestFormat(t *testing.T) {
+	assert.Equal(t, "No results.", Format(nil))
+	assert.Equal(t, "1. Go\n   https://go.dev\n   The Go language\n\n2. Blog\n   https://go.dev/blog\n",
+		Format([]Result{{Title: "Go", URL: "https://go.dev", Snippet: "The Go\n   language"}, {Title: " Blog ", URL: "https://go.dev/blog"}}))
+}
@@ -0,0 +1,145 @@
+// Package sse decodes server-sent events, the format providers stream their
+// answers in, following the event stream format of the HTML standard
+package sse
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MaxLineSize is the longest line the decoder accepts. Lines of a stream are
+// usually short, but a single data line may hold a large JSON document.
+const MaxLineSize = 16 << 20
+
+// Event is a dispatched server-sent event
+type Event struct {
+	// Type is the event field, empty for the default type "message"
+	Type string
+
+	// ID is the last event ID the stream set, which may have been set by an
+	// earlier event
+	ID string
+
+	// Data are the data fields of the event joined with newlines
+	Data string
+
+	// Retry is the reconnection time the stream asked for, or zero
+	Retry time.Duration
+}
+
+// Decoder reads events from a stream
+type Decoder struct {
+	scanner *bufio.Scanner
+	started bool
+
+	// lastID and retry last longer than the event that set them
+	lastID string
+	retry  time.Duration
+}
+
+// NewDecoder creates a decoder of the stream
+func NewDecoder(r io.Reader) *Decoder {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 4096), MaxLineSize)
+	scanner.Split(scanLines)
+	return &Decoder{scanner: scanner}
+}
+
+// Next returns the next event, or io.EOF when the stream ended. Lines may
+// end with CRLF, LF or CR, and comments and unknown fields are skipped.
+// Events without data are not dispatched. Unlike browsers, the decoder
+// dispatches an event the stream ends in the middle of, since some servers
+// omit the final empty line.
+func (d *Decoder) Next() (*Event, error) {
+	var event Event
+	var data strings.Builder
+	hasData := false
+
+	for d.scanner.Scan() {
+		line := d.scanner.Text()
+		if !d.started {
+			// A byte order mark may precede the first line
+			line = strings.TrimPrefix(line, "\uFEFF")
+			d.started = true
+		}
+
+		// An empty line dispatches the event
+		if line == "" {
+			if !hasData {
+				event.Type = ""
+				continue
+			}
+			return d.dispatch(event, data.String()), nil
+		}
+
+		// Lines starting with a colon are comments, e.g. keep-alives
+		if strings.HasPrefix(line, ":") {
+			continue
+		}
+
+		field, value, _ := strings.Cut(line, ":")
+		value = strings.TrimPrefix(value, " ")
+		switch field {
+		case "data":
+			if hasData {
+				data.WriteByte('\n')
+			}
+			data.WriteString(value)
+			hasData = true
+		case "event":
+			event.Type = value
+		case "id":
+			if !strings.ContainsRune(value, 0) {
+				d.lastID = value
+			}
+		case "retry":
+			if ms, err := strconv.ParseUint(value, 10, 32); err == nil {
+				d.retry = time.Duration(ms) * time.Millisecond
+			}
+		}
+	}
+
+	if err := d.scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read event stream: %w", err)
+	}
+	if hasData {
+		return d.dispatch(event, data.String()), nil
+	}
+	return nil, io.EOF
+}
+
+// dispatch completes the event with the state of the stream
+func (d *Decoder) dispatch(event Event, data string) *Event {
+	event.Data = data
+	event.ID = d.lastID
+	event.Retry = d.retry
+	return &event
+}
+
+// scanLines is a split function of lines that end with CRLF, LF or CR
+func scanLines(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	i := bytes.IndexAny(data, "\r\n")
+	switch {
+	case i < 0:
+		if atEOF && len(data) > 0 {
+			return len(data), data, nil
+		}
+		return 0, nil, nil
+	case data[i] == '\n':
+		return i + 1, data[:i], nil
+	case i+1 < len(data):
+		if data[i+1] == '\n' {
+			return i + 2, data[:i], nil
+		}
+		return i + 1, data[:i], nil
+	case atEOF:
+		return i + 1, data[:i], nil
+	}
+	// A CR at the end of the data may be followed by an LF
+	return 0, nil, nil
+}
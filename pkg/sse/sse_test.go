@@ -0,0 +1,136 @@
+package sse
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// decodeAll returns all events of the stream
+func decodeAll(t *testing.T, r io.Reader) []Event {
+	t.Helper()
+	decoder := NewDecoder(r)
+	var events []Event
+	for {
+		event, err := decoder.Next()
+		if errors.Is(err, io.EOF) {
+			return events
+		}
+		require.NoError(t, err)
+		events = append(events, *event)
+	}
+}
+
+// TestDecoder tests decoding the fields of events
+func TestDecoder(t *testing.T) {
+	tests := []struct {
+		name     string
+		stream   string
+		expected []Event
+	}{
+		{
+			name:     "data",
+			stream:   "data: {\"a\":1}\n\ndata: [DONE]\n\n",
+			expected: []Event{{Data: `{"a":1}`}, {Data: "[DONE]"}},
+		},
+		{
+			name:     "CRLF",
+			stream:   "event: delta\r\ndata: one\r\n\r\ndata: two\r\n\r\n",
+			expected: []Event{{Type: "delta", Data: "one"}, {Data: "two"}},
+		},
+		{
+			name:     "CR",
+			stream:   "data: one\r\rdata: two\r\r",
+			expected: []Event{{Data: "one"}, {Data: "two"}},
+		},
+		{
+			name:     "multi-line data",
+			stream:   "data: {\"a\":\ndata: 1}\n\n",
+			expected: []Event{{Data: "{\"a\":\n1}"}},
+		},
+		{
+			name:     "comments and unknown fields",
+			stream:   ": keep-alive\n\nfoo: bar\ndata: one\n: ignored\n\n",
+			expected: []Event{{Data: "one"}},
+		},
+		{
+			name:     "no space after the colon",
+			stream:   "data:one\ndata:  two\n\n",
+			expected: []Event{{Data: "one\n two"}},
+		},
+		{
+			name:     "field without colon",
+			stream:   "data\ndata\n\n",
+			expected: []Event{{Data: "\n"}},
+		},
+		{
+			name:     "event type and ID",
+			stream:   "id: 1\nevent: error\ndata: failed\n\ndata: next\n\nid\ndata: reset\n\n",
+			expected: []Event{{Type: "error", ID: "1", Data: "failed"}, {ID: "1", Data: "next"}, {Data: "reset"}},
+		},
+		{
+			name:     "events without data are not dispatched",
+			stream:   "event: ping\n\nid: 7\n\ndata: one\n\n",
+			expected: []Event{{ID: "7", Data: "one"}},
+		},
+		{
+			name:     "retry",
+			stream:   "retry: 1500\ndata: one\n\nretry: soon\ndata: two\n\n",
+			expected: []Event{{Data: "one", Retry: 1500 * time.Millisecond}, {Data: "two", Retry: 1500 * time.Millisecond}},
+		},
+		{
+			name:     "byte order mark",
+			stream:   "\uFEFFdata: one\n\n",
+			expected: []Event{{Data: "one"}},
+		},
+		{
+			name:     "stream ends without empty line",
+			stream:   "data: one\n\ndata: two",
+			expected: []Event{{Data: "one"}, {Data: "two"}},
+		},
+		{
+			name:   "empty stream",
+			stream: "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, decodeAll(t, strings.NewReader(tt.stream)))
+
+			// Chunked delivery splits lines, JSON documents and CRLFs across
+			// reads
+			assert.Equal(t, tt.expected, decodeAll(t, iotest.OneByteReader(strings.NewReader(tt.stream))))
+		})
+	}
+}
+
+// TestDecoderLongLines tests that data lines longer than the default buffer
+// are decoded, and lines over the limit fail
+func TestDecoderLongLines(t *testing.T) {
+	long := strings.Repeat("x", 1<<20)
+	events := decodeAll(t, strings.NewReader("data: "+long+"\n\n"))
+	require.Len(t, events, 1)
+	assert.Equal(t, long, events[0].Data)
+
+	_, err := NewDecoder(strings.NewReader("data: " + strings.Repeat("x", MaxLineSize) + "\n\n")).Next()
+	assert.ErrorContains(t, err, "failed to read event stream")
+}
+
+// TestDecoderReadError tests that errors of the stream are returned
+func TestDecoderReadError(t *testing.T) {
+	decoder := NewDecoder(io.MultiReader(strings.NewReader("data: one\n\n"), iotest.ErrReader(io.ErrUnexpectedEOF)))
+
+	event, err := decoder.Next()
+	require.NoError(t, err)
+	assert.Equal(t, "one", event.Data)
+
+	_, err = decoder.Next()
+	assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+}
@@ -0,0 +1,32 @@
+// Package state guards the local state si keeps between runs, such as the
+// answer cache and the usage log. In read-only mode none of it is written, so
+// si can run on shared machines and on data that must not be persisted.
+package state
+
+import (
+	"errors"
+	"sync/atomic"
+)
+
+// ErrReadOnly is the reason state was not written in read-only mode
+var ErrReadOnly = errors.New("local state is read-only")
+
+var readOnly atomic.Bool
+
+// SetReadOnly turns read-only mode on or off
+func SetReadOnly(on bool) {
+	readOnly.Store(on)
+}
+
+// ReadOnly reports whether writing local state is disabled
+func ReadOnly() bool {
+	return readOnly.Load()
+}
+
+// Writable returns ErrReadOnly if writing local state is disabled
+func Writable() error {
+	if ReadOnly() {
+		return ErrReadOnly
+	}
+	return nil
+}
@@ -0,0 +1,19 @@
+package state
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestReadOnly tests turning read-only mode on and off
+func TestReadOnly(t *testing.T) {
+	defer SetReadOnly(false)
+
+	assert.False(t, ReadOnly())
+	assert.NoError(t, Writable())
+
+	SetReadOnly(true)
+	assert.True(t, ReadOnly())
+	assert.ErrorIs(t, Writable(), ErrReadOnly)
+}
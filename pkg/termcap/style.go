@@ -0,0 +1,98 @@
+package termcap
+
+import "fmt"
+
+// RGB is a 24-bit color
+type RGB struct {
+	R, G, B uint8
+}
+
+// Common colors for styled output
+var (
+	Red    = RGB{205, 49, 49}
+	Green  = RGB{13, 188, 121}
+	Yellow = RGB{229, 229, 16}
+	Cyan   = RGB{17, 168, 205}
+)
+
+// ansi16 are the typical colors of the 16 ANSI colors, in the order of
+// their SGR codes 30-37 and 90-97
+var ansi16 = []RGB{
+	{0, 0, 0}, {205, 49, 49}, {13, 188, 121}, {229, 229, 16},
+	{36, 114, 200}, {188, 63, 188}, {17, 168, 205}, {229, 229, 229},
+	{102, 102, 102}, {241, 76, 76}, {35, 209, 139}, {245, 245, 67},
+	{59, 142, 234}, {214, 112, 214}, {41, 184, 219}, {255, 255, 255},
+}
+
+// Foreground returns the text in the color, approximated with the colors the
+// terminal has. Without color support the text is returned as is.
+func (c Capabilities) Foreground(text string, color RGB) string {
+	switch c.Color {
+	case ColorTrueColor:
+		return fmt.Sprintf("\x1b[38;2;%d;%d;%dm%s\x1b[39m", color.R, color.G, color.B, text)
+	case Color256:
+		return fmt.Sprintf("\x1b[38;5;%dm%s\x1b[39m", cube256(color), text)
+	case Color16:
+		return fmt.Sprintf("\x1b[%dm%s\x1b[39m", sgr16(color), text)
+	default:
+		return text
+	}
+}
+
+// Bold returns the text in bold when the terminal supports styling
+func (c Capabilities) Bold(text string) string {
+	if c.Color == ColorNone {
+		return text
+	}
+	return "\x1b[1m" + text + "\x1b[22m"
+}
+
+// Dim returns the text faint when the terminal supports styling
+func (c Capabilities) Dim(text string) string {
+	if c.Color == ColorNone {
+		return text
+	}
+	return "\x1b[2m" + text + "\x1b[22m"
+}
+
+// cubeLevels are the intensities of the 6x6x6 color cube of 256-color terminals
+var cubeLevels = []int{0, 95, 135, 175, 215, 255}
+
+// cube256 returns the closest color of the color cube of 256-color terminals
+func cube256(color RGB) int {
+	level := func(v uint8) int {
+		best := 0
+		for i, l := range cubeLevels {
+			if abs(int(v)-l) < abs(int(v)-cubeLevels[best]) {
+				best = i
+			}
+		}
+		return best
+	}
+	return 16 + 36*level(color.R) + 6*level(color.G) + level(color.B)
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+// sgr16 returns the SGR code of the closest of the 16 ANSI colors
+func sgr16(color RGB) int {
+	best, bestDistance := 0, -1
+	for i, candidate := range ansi16 {
+		dr := int(color.R) - int(candidate.R)
+		dg := int(color.G) - int(candidate.G)
+		db := int(color.B) - int(candidate.B)
+		if distance := dr*dr + dg*dg + db*db; bestDistance < 0 || distance < bestDistance {
+			best, bestDistance = i, distance
+		}
+	}
+
+	if best < 8 {
+		return 30 + best
+	}
+	return 90 + best - 8
+}
@@ -0,0 +1,31 @@
+package termcap
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestForeground tests that colors are approximated with the available colors
+func TestForeground(t *testing.T) {
+	orange := RGB{255, 135, 0}
+
+	assert.Equal(t, "\x1b[38;2;255;135;0mhi\x1b[39m", Capabilities{Color: ColorTrueColor}.Foreground("hi", orange))
+	assert.Equal(t, "\x1b[38;5;208mhi\x1b[39m", Capabilities{Color: Color256}.Foreground("hi", orange))
+	assert.Equal(t, "\x1b[91mhi\x1b[39m", Capabilities{Color: Color16}.Foreground("hi", orange))
+	assert.Equal(t, "hi", Capabilities{}.Foreground("hi", orange))
+
+	assert.Equal(t, "\x1b[33mhi\x1b[39m", Capabilities{Color: Color16}.Foreground("hi", Yellow))
+}
+
+// TestBold tests that bold text is only styled on color terminals
+func TestBold(t *testing.T) {
+	assert.Equal(t, "\x1b[1mhi\x1b[22m", Capabilities{Color: Color16}.Bold("hi"))
+	assert.Equal(t, "hi", Capabilities{Unicode: true}.Bold("hi"))
+}
+
+// TestDim tests that faint text is only styled on color terminals
+func TestDim(t *testing.T) {
+	assert.Equal(t, "\x1b[2mhi\x1b[22m", Capabilities{Color: Color256}.Dim("hi"))
+	assert.Equal(t, "hi", Capabilities{Unicode: true}.Dim("hi"))
+}
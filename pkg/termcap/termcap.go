@@ -0,0 +1,153 @@
+// Package termcap detects what a terminal can display, so output can fall back
+// to ASCII and fewer colors on minimal terminals and serial consoles
+package termcap
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ColorLevel is the number of colors a terminal can display
+type ColorLevel int
+
+// Color levels, from no color at all to 24-bit color
+const (
+	ColorNone ColorLevel = iota
+	Color16
+	Color256
+	ColorTrueColor
+)
+
+// String returns the name of the color level as used in the configuration
+func (l ColorLevel) String() string {
+	switch l {
+	case Color16:
+		return "16"
+	case Color256:
+		return "256"
+	case ColorTrueColor:
+		return "truecolor"
+	default:
+		return "none"
+	}
+}
+
+// ParseColorLevel parses a color level name: none, 16, 256 or truecolor
+func ParseColorLevel(name string) (ColorLevel, error) {
+	for _, level := range []ColorLevel{ColorNone, Color16, Color256, ColorTrueColor} {
+		if level.String() == name {
+			return level, nil
+		}
+	}
+	return ColorNone, fmt.Errorf("unknown color level %q (expected none, 16, 256 or truecolor)", name)
+}
+
+// Capabilities describes what a terminal can display
+type Capabilities struct {
+	// Unicode is true when the terminal can display non-ASCII characters
+	Unicode bool
+
+	// Color is the number of colors the terminal can display
+	Color ColorLevel
+}
+
+// Detect determines the capabilities of a terminal from the environment.
+// Output that doesn't go to a terminal is never colored.
+func Detect(getenv func(string) string, goos string, isTerminal bool) Capabilities {
+	var c Capabilities
+	if goos == "windows" {
+		c = detectWindows(getenv)
+	} else {
+		c = detectUnix(getenv)
+	}
+
+	// https://no-color.org
+	if !isTerminal || getenv("NO_COLOR") != "" {
+		c.Color = ColorNone
+	}
+	return c
+}
+
+// detectUnix reads the capabilities from TERM, COLORTERM and the locale
+func detectUnix(getenv func(string) string) Capabilities {
+	term := getenv("TERM")
+	if term == "" || term == "dumb" {
+		return Capabilities{}
+	}
+
+	// The Linux console and serial terminals lack the glyphs even in a
+	// UTF-8 locale
+	unicode := isUTF8Locale(getenv) && term != "linux" && !strings.HasPrefix(term, "vt")
+
+	switch colorTerm := getenv("COLORTERM"); {
+	case colorTerm == "truecolor" || colorTerm == "24bit":
+		return Capabilities{Unicode: unicode, Color: ColorTrueColor}
+	case strings.Contains(term, "256color"):
+		return Capabilities{Unicode: unicode, Color: Color256}
+	case strings.HasPrefix(term, "vt"):
+		return Capabilities{Unicode: unicode, Color: ColorNone}
+	default:
+		return Capabilities{Unicode: unicode, Color: Color16}
+	}
+}
+
+// detectWindows distinguishes modern terminals from the legacy console, which
+// only has 16 colors and a code page without most symbols
+func detectWindows(getenv func(string) string) Capabilities {
+	switch {
+	case getenv("WT_SESSION") != "" || getenv("TERM_PROGRAM") == "vscode":
+		return Capabilities{Unicode: true, Color: ColorTrueColor}
+	case getenv("ConEmuANSI") == "ON":
+		return Capabilities{Unicode: true, Color: Color256}
+	case getenv("TERM") != "":
+		// Unix-like environments such as MSYS2 and Cygwin
+		return detectUnix(getenv)
+	default:
+		return Capabilities{Color: Color16}
+	}
+}
+
+// isUTF8Locale reports whether the locale uses the UTF-8 character set, using
+// the first locale variable that is set like the C library does
+func isUTF8Locale(getenv func(string) string) bool {
+	for _, name := range []string{"LC_ALL", "LC_CTYPE", "LANG"} {
+		if locale := strings.ToLower(getenv(name)); locale != "" {
+			return strings.Contains(locale, "utf-8") || strings.Contains(locale, "utf8")
+		}
+	}
+	return false
+}
+
+// Override replaces the detected capabilities with the configured ones. A nil
+// unicode and an empty or "auto" color keep the detected values.
+func (c Capabilities) Override(unicode *bool, color string) (Capabilities, error) {
+	if unicode != nil {
+		c.Unicode = *unicode
+	}
+
+	if color != "" && color != "auto" {
+		level, err := ParseColorLevel(color)
+		if err != nil {
+			return c, err
+		}
+		c.Color = level
+	}
+
+	return c, nil
+}
+
+// SpinnerFrames returns the frames of a progress spinner
+func (c Capabilities) SpinnerFrames() []string {
+	if c.Unicode {
+		return []string{"⠋", "⠙", "⠹", "⠸", "⠼", "⠴", "⠦", "⠧", "⠇", "⠏"}
+	}
+	return []string{"|", "/", "-", "\\"}
+}
+
+// Ellipsis returns the symbol for omitted text
+func (c Capabilities) Ellipsis() string {
+	if c.Unicode {
+		return "…"
+	}
+	return "..."
+}
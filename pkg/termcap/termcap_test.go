@@ -0,0 +1,68 @@
+package termcap
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// env returns a getenv function for the given variables
+func env(vars map[string]string) func(string) string {
+	return func(name string) string { return vars[name] }
+}
+
+// TestDetect tests detecting the capabilities of common terminals
+func TestDetect(t *testing.T) {
+	tests := []struct {
+		name       string
+		goos       string
+		env        map[string]string
+		isTerminal bool
+		want       Capabilities
+	}{
+		{"modern terminal", "linux", map[string]string{"TERM": "xterm-256color", "COLORTERM": "truecolor", "LANG": "en_US.UTF-8"}, true, Capabilities{Unicode: true, Color: ColorTrueColor}},
+		{"256 colors", "darwin", map[string]string{"TERM": "xterm-256color", "LC_ALL": "en_US.utf8"}, true, Capabilities{Unicode: true, Color: Color256}},
+		{"C locale", "linux", map[string]string{"TERM": "xterm", "LANG": "C"}, true, Capabilities{Color: Color16}},
+		{"LC_ALL wins", "linux", map[string]string{"TERM": "xterm", "LC_ALL": "C", "LANG": "en_US.UTF-8"}, true, Capabilities{Color: Color16}},
+		{"linux console", "linux", map[string]string{"TERM": "linux", "LANG": "en_US.UTF-8"}, true, Capabilities{Color: Color16}},
+		{"serial console", "linux", map[string]string{"TERM": "vt100", "LANG": "en_US.UTF-8"}, true, Capabilities{}},
+		{"dumb terminal", "linux", map[string]string{"TERM": "dumb", "COLORTERM": "truecolor"}, true, Capabilities{}},
+		{"NO_COLOR", "linux", map[string]string{"TERM": "xterm-256color", "NO_COLOR": "1", "LANG": "en_US.UTF-8"}, true, Capabilities{Unicode: true}},
+		{"not a terminal", "linux", map[string]string{"TERM": "xterm-256color", "LANG": "en_US.UTF-8"}, false, Capabilities{Unicode: true}},
+		{"windows terminal", "windows", map[string]string{"WT_SESSION": "abc"}, true, Capabilities{Unicode: true, Color: ColorTrueColor}},
+		{"legacy console", "windows", map[string]string{}, true, Capabilities{Color: Color16}},
+		{"msys2", "windows", map[string]string{"TERM": "xterm-256color", "LANG": "en_US.UTF-8"}, true, Capabilities{Unicode: true, Color: Color256}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, Detect(env(tt.env), tt.goos, tt.isTerminal))
+		})
+	}
+}
+
+// TestOverride tests replacing detected capabilities with configured ones
+func TestOverride(t *testing.T) {
+	detected := Capabilities{Unicode: true, Color: ColorTrueColor}
+
+	c, err := detected.Override(nil, "auto")
+	require.NoError(t, err)
+	assert.Equal(t, detected, c)
+
+	unicode := false
+	c, err = detected.Override(&unicode, "16")
+	require.NoError(t, err)
+	assert.Equal(t, Capabilities{Color: Color16}, c)
+
+	_, err = detected.Override(nil, "many")
+	assert.EqualError(t, err, `unknown color level "many" (expected none, 16, 256 or truecolor)`)
+}
+
+// TestSymbols tests the ASCII fallbacks of symbols
+func TestSymbols(t *testing.T) {
+	assert.Equal(t, []string{"|", "/", "-", "\\"}, Capabilities{}.SpinnerFrames())
+	assert.Equal(t, "⠋", Capabilities{Unicode: true}.SpinnerFrames()[0])
+	assert.Equal(t, "...", Capabilities{}.Ellipsis())
+	assert.Equal(t, "…", Capabilities{Unicode: true}.Ellipsis())
+}
@@ -0,0 +1,124 @@
+// Package textdiff computes word-level differences between texts.
+package textdiff
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Kind is the kind of a diff operation
+type Kind int
+
+// Kinds of diff operations
+const (
+	// Equal is text both texts have
+	Equal Kind = iota
+
+	// Delete is text only the first text has
+	Delete
+
+	// Insert is text only the second text has
+	Insert
+)
+
+// Op is a run of text that is equal, deleted or inserted
+type Op struct {
+	Kind Kind
+	Text string
+}
+
+// Words returns the operations that turn a into b. The texts are compared
+// word by word, with whitespace between words as separate tokens, and
+// adjacent operations of the same kind are merged.
+func Words(a, b string) []Op {
+	x, y := tokenize(a), tokenize(b)
+
+	// Skip the common prefix and suffix, which is most of the text when the
+	// answers are similar
+	prefix := 0
+	for prefix < len(x) && prefix < len(y) && x[prefix] == y[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(x)-prefix && suffix < len(y)-prefix && x[len(x)-1-suffix] == y[len(y)-1-suffix] {
+		suffix++
+	}
+
+	var ops []Op
+	add := func(kind Kind, text string) {
+		if text == "" {
+			return
+		}
+		if n := len(ops); n > 0 && ops[n-1].Kind == kind {
+			ops[n-1].Text += text
+			return
+		}
+		ops = append(ops, Op{Kind: kind, Text: text})
+	}
+
+	add(Equal, strings.Join(x[:prefix], ""))
+	for _, op := range lcs(x[prefix:len(x)-suffix], y[prefix:len(y)-suffix]) {
+		add(op.Kind, op.Text)
+	}
+	add(Equal, strings.Join(x[len(x)-suffix:], ""))
+	return ops
+}
+
+// lcs diffs the tokens by their longest common subsequence
+func lcs(x, y []string) []Op {
+	// lengths[i][j] is the length of the longest common subsequence of x[i:]
+	// and y[j:]
+	lengths := make([][]int32, len(x)+1)
+	for i := range lengths {
+		lengths[i] = make([]int32, len(y)+1)
+	}
+	for i := len(x) - 1; i >= 0; i-- {
+		for j := len(y) - 1; j >= 0; j-- {
+			if x[i] == y[j] {
+				lengths[i][j] = lengths[i+1][j+1] + 1
+			} else {
+				lengths[i][j] = max(lengths[i+1][j], lengths[i][j+1])
+			}
+		}
+	}
+
+	var ops []Op
+	i, j := 0, 0
+	for i < len(x) && j < len(y) {
+		switch {
+		case x[i] == y[j]:
+			ops = append(ops, Op{Kind: Equal, Text: x[i]})
+			i, j = i+1, j+1
+		case lengths[i+1][j] >= lengths[i][j+1]:
+			ops = append(ops, Op{Kind: Delete, Text: x[i]})
+			i++
+		default:
+			ops = append(ops, Op{Kind: Insert, Text: y[j]})
+			j++
+		}
+	}
+	for ; i < len(x); i++ {
+		ops = append(ops, Op{Kind: Delete, Text: x[i]})
+	}
+	for ; j < len(y); j++ {
+		ops = append(ops, Op{Kind: Insert, Text: y[j]})
+	}
+	return ops
+}
+
+// tokenize splits text into words and the whitespace between them
+func tokenize(text string) []string {
+	var tokens []string
+	start, space := 0, false
+	for i, r := range text {
+		if i > start && unicode.IsSpace(r) != space {
+			tokens = append(tokens, text[start:i])
+			start = i
+		}
+		space = unicode.IsSpace(r)
+	}
+	if start < len(text) {
+		tokens = append(tokens, text[start:])
+	}
+	return tokens
+}
@@ -0,0 +1,62 @@
+package textdiff
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestWords tests diffing texts word by word
+func TestWords(t *testing.T) {
+	testCases := []struct {
+		name     string
+		a, b     string
+		expected []Op
+	}{
+		{
+			name:     "Identical",
+			a:        "Paris is the capital.",
+			b:        "Paris is the capital.",
+			expected: []Op{{Equal, "Paris is the capital."}},
+		},
+		{
+			name: "Changed word",
+			a:    "The capital is Paris.",
+			b:    "The capital is Lyon.",
+			expected: []Op{
+				{Equal, "The capital is "},
+				{Delete, "Paris."},
+				{Insert, "Lyon."},
+			},
+		},
+		{
+			name: "Inserted and deleted words",
+			a:    "use go test ./...",
+			b:    "use go test -race ./...\nthen lint",
+			expected: []Op{
+				{Equal, "use go test "},
+				{Insert, "-race "},
+				{Equal, "./..."},
+				{Insert, "\nthen lint"},
+			},
+		},
+		{
+			name:     "Empty",
+			a:        "",
+			b:        "new  text",
+			expected: []Op{{Insert, "new  text"}},
+		},
+		{
+			name:     "Unicode whitespace",
+			a:        "a　b",
+			b:        "a　c",
+			expected: []Op{{Equal, "a　"}, {Delete, "b"}, {Insert, "c"}},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, Words(tc.a, tc.b))
+		})
+	}
+}
@@ -0,0 +1,119 @@
+// Package tokens counts tokens the way OpenAI models do and knows the context
+// window sizes of common models
+package tokens
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/pkoukk/tiktoken-go"
+)
+
+// DefaultEncoding is used for models the tokenizer doesn't know
+const DefaultEncoding = "cl100k_base"
+
+// contextWindows maps model name prefixes to their context window in tokens.
+// The longest matching prefix wins.
+var contextWindows = map[string]int{
+	"gpt-3.5-turbo": 16385,
+	"gpt-4":         8192,
+	"gpt-4-32k":     32768,
+	"gpt-4-turbo":   128000,
+	"gpt-4o":        128000,
+	"gpt-4.1":       1047576,
+	"gpt-4.5":       128000,
+	"gpt-5":         400000,
+	"o1":            200000,
+	"o1-mini":       128000,
+	"o3":            200000,
+	"o4-mini":       200000,
+}
+
+var (
+	encodingsMu sync.Mutex
+	encodings   = map[string]*tiktoken.Tiktoken{}
+)
+
+// Count returns the number of tokens the text is encoded to for the model.
+// Loading an encoding for the first time may download its BPE ranks, which
+// are cached afterwards.
+func Count(model, text string) (int, error) {
+	enc, err := encodingForModel(model)
+	if err != nil {
+		return 0, err
+	}
+	return len(enc.EncodeOrdinary(text)), nil
+}
+
+// Estimate returns a rough token count of the text without loading an
+// encoding, based on the typical four characters per token of English text
+func Estimate(text string) int {
+	return (len(text) + 3) / 4
+}
+
+// ContextWindow returns the context window of the model in tokens, or zero if
+// the model is unknown
+func ContextWindow(model string) int {
+	model = upstreamModel(model)
+	window, matched := 0, ""
+	for prefix, size := range contextWindows {
+		if strings.HasPrefix(model, prefix) && len(prefix) > len(matched) {
+			window, matched = size, prefix
+		}
+	}
+	return window
+}
+
+// MayExceed reports whether the text may exceed a context window of the given
+// size. Every token encodes at least one byte, so texts that are not longer
+// than the window in bytes never need to be tokenized.
+func MayExceed(text string, window int) bool {
+	return window > 0 && len(text) > window
+}
+
+// encodingForModel returns the encoding of the model, loading it on first use
+func encodingForModel(model string) (*tiktoken.Tiktoken, error) {
+	name := EncodingName(model)
+
+	encodingsMu.Lock()
+	defer encodingsMu.Unlock()
+
+	if enc, ok := encodings[name]; ok {
+		return enc, nil
+	}
+
+	enc, err := tiktoken.GetEncoding(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load tokenizer: %w", err)
+	}
+
+	encodings[name] = enc
+	return enc, nil
+}
+
+// EncodingName returns the name of the encoding used by the model
+func EncodingName(model string) string {
+	model = upstreamModel(model)
+	if name, ok := tiktoken.MODEL_TO_ENCODING[model]; ok {
+		return name
+	}
+
+	name, matched := DefaultEncoding, ""
+	for prefix, encoding := range tiktoken.MODEL_PREFIX_TO_ENCODING {
+		if strings.HasPrefix(model, prefix) && len(prefix) > len(matched) {
+			name, matched = encoding, prefix
+		}
+	}
+	return name
+}
+
+// upstreamModel returns the name of the model without the vendor and the
+// variant OpenRouter adds, e.g. gpt-4o for openai/gpt-4o:nitro
+func upstreamModel(model string) string {
+	model, _, _ = strings.Cut(model, ":")
+	if _, name, ok := strings.Cut(model, "/"); ok {
+		return name
+	}
+	return model
+}
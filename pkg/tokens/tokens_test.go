@@ -0,0 +1,85 @@
+package tokens
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/pkoukk/tiktoken-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeLoader provides BPE ranks for single bytes and "ab", so tests don't
+// need to download the real encodings
+type fakeLoader struct{}
+
+func (fakeLoader) LoadTiktokenBpe(file string) (map[string]int, error) {
+	if strings.Contains(file, "p50k") {
+		return nil, errors.New("offline")
+	}
+
+	ranks := map[string]int{}
+	for i := 0; i < 256; i++ {
+		ranks[string([]byte{byte(i)})] = i
+	}
+	ranks["ab"] = 256
+	return ranks, nil
+}
+
+func init() {
+	tiktoken.SetBpeLoader(fakeLoader{})
+}
+
+// TestCount tests counting tokens with the encoding of the model
+func TestCount(t *testing.T) {
+	count, err := Count("gpt-4o", "abab")
+	require.NoError(t, err)
+	assert.Equal(t, 2, count)
+
+	count, err = Count("gpt-4", "abc")
+	require.NoError(t, err)
+	assert.Equal(t, 2, count)
+
+	// Unknown models use the default encoding
+	count, err = Count("my-local-model", "ab")
+	require.NoError(t, err)
+	assert.Equal(t, 1, count)
+
+	// Encodings that can't be loaded are reported
+	_, err = Count("text-davinci-003", "ab")
+	assert.ErrorContains(t, err, "failed to load tokenizer")
+}
+
+// TestEncodingName tests choosing the encoding for a model
+func TestEncodingName(t *testing.T) {
+	assert.Equal(t, "o200k_base", EncodingName("gpt-4o"))
+	assert.Equal(t, "o200k_base", EncodingName("gpt-4o-mini-2024-07-18"))
+	assert.Equal(t, "cl100k_base", EncodingName("gpt-4"))
+	assert.Equal(t, "cl100k_base", EncodingName("my-local-model"))
+	assert.Equal(t, "o200k_base", EncodingName("openai/gpt-4o:nitro"))
+}
+
+// TestContextWindow tests looking up context windows by model prefix
+func TestContextWindow(t *testing.T) {
+	assert.Equal(t, 8192, ContextWindow("gpt-4"))
+	assert.Equal(t, 32768, ContextWindow("gpt-4-32k-0613"))
+	assert.Equal(t, 128000, ContextWindow("gpt-4o-mini"))
+	assert.Equal(t, 1047576, ContextWindow("gpt-4.1-nano"))
+	assert.Equal(t, 0, ContextWindow("llama3"))
+	assert.Equal(t, 128000, ContextWindow("openai/gpt-4o-mini"))
+}
+
+// TestMayExceed tests the cheap check before counting tokens
+func TestMayExceed(t *testing.T) {
+	assert.False(t, MayExceed("short", 10))
+	assert.True(t, MayExceed("much longer text", 10))
+	assert.False(t, MayExceed("much longer text", 0))
+}
+
+// TestEstimate tests the rough token estimate
+func TestEstimate(t *testing.T) {
+	assert.Equal(t, 0, Estimate(""))
+	assert.Equal(t, 1, Estimate("abc"))
+	assert.Equal(t, 3, Estimate("hello world!"))
+}
@@ -0,0 +1,133 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+
+	"github.com/Turee/si/pkg/llm"
+	"github.com/Turee/si/pkg/openapi"
+	"github.com/Turee/si/pkg/output"
+)
+
+// API is a REST API whose operations the model can call
+type API struct {
+	// Name prefixes the names of the tools of the API
+	Name string
+
+	Spec *openapi.Spec
+
+	// Operations are the IDs of the operations to register, all if empty
+	Operations []string
+
+	// BaseURL overrides the server URL of the spec
+	BaseURL string
+
+	Auth openapi.Auth
+}
+
+// RegisterAPI adds a tool for every selected operation of the API to the
+// toolbox. Operations that may change data are only called when the user
+// confirms the request.
+func RegisterAPI(toolbox *llm.Toolbox, api API, opts Options) error {
+	operations, err := api.Select()
+	if err != nil {
+		return err
+	}
+
+	baseURL := api.BaseURL
+	if baseURL == "" {
+		baseURL = api.Spec.ServerURL()
+	}
+	if u, err := url.Parse(baseURL); err != nil || !u.IsAbs() {
+		return fmt.Errorf("the API %s has no absolute server URL, set its base_url", api.Name)
+	}
+
+	client := &http.Client{Timeout: fetchTimeout}
+	for _, op := range operations {
+		toolbox.Add(llm.Tool{
+			Name:        openapi.ToolName(api.Name, op.ID),
+			Description: op.Summarize(),
+			Parameters:  op.Schema(),
+		}, opts.redact(apiTool(op, baseURL, api.Auth, client, opts)))
+	}
+	return nil
+}
+
+// Select returns the selected operations of the API
+func (a API) Select() ([]openapi.Operation, error) {
+	if len(a.Operations) == 0 {
+		return a.Spec.Operations(), nil
+	}
+
+	operations := make([]openapi.Operation, 0, len(a.Operations))
+	for _, id := range a.Operations {
+		op, ok := a.Spec.Operation(id)
+		if !ok {
+			return nil, fmt.Errorf("the API %s has no operation %q", a.Name, id)
+		}
+		operations = append(operations, op)
+	}
+	return operations, nil
+}
+
+// apiTool calls an operation of an API. The credentials are added after the
+// user confirmed the request, so they are never shown.
+func apiTool(op openapi.Operation, baseURL string, auth openapi.Auth, client *http.Client, opts Options) llm.ToolFunc {
+	return func(ctx context.Context, arguments json.RawMessage) (string, error) {
+		req, err := op.NewRequest(ctx, baseURL, arguments)
+		if err != nil {
+			return "", err
+		}
+		target := req.URL.String()
+
+		if !op.Safe() {
+			if opts.ConfirmRequest == nil {
+				return "", errors.New("sending requests that may change data is not possible without a terminal to confirm them")
+			}
+			request := req.Method + " " + target
+			if body := requestBody(arguments); body != "" {
+				request += " " + body
+			}
+			ok, err := opts.ConfirmRequest(request)
+			if err != nil {
+				return "", err
+			}
+			if !ok {
+				return "The user declined to send the request.", nil
+			}
+		}
+
+		auth.Apply(req)
+		resp, err := client.Do(req)
+		if err != nil {
+			return "", err
+		}
+		defer resp.Body.Close()
+
+		body, err := io.ReadAll(io.LimitReader(resp.Body, MaxOutput+1))
+		if err != nil {
+			return "", err
+		}
+		if op.Method == http.MethodGet && resp.StatusCode < http.StatusBadRequest {
+			opts.cite(output.Source{URL: target})
+		}
+		return fmt.Sprintf("HTTP %s\n\n%s", resp.Status, truncate(string(body))), nil
+	}
+}
+
+// requestBody returns the body in the arguments of an operation, to show it
+// when the request is confirmed
+func requestBody(arguments json.RawMessage) string {
+	var args struct {
+		Body json.RawMessage `json:"body"`
+	}
+	if json.Unmarshal(arguments, &args) != nil || string(args.Body) == "null" {
+		return ""
+	}
+	return string(args.Body)
+}
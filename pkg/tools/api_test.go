@@ -0,0 +1,96 @@
+package tools
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Turee/si/pkg/llm"
+	"github.com/Turee/si/pkg/openapi"
+	"github.com/Turee/si/pkg/output"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// todoSpec is the spec of a todo API without a server URL
+const todoSpec = `openapi: 3.1.0
+paths:
+  /todos:
+    get:
+      operationId: listTodos
+      summary: List the todos
+    post:
+      operationId: addTodo
+      requestBody:
+        content:
+          application/json:
+            schema:
+              type: object
+`
+
+// TestRegisterAPI tests calling the operations of an API
+func TestRegisterAPI(t *testing.T) {
+	var requests []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		requests = append(requests, r.Method+" "+r.URL.String()+" "+r.Header.Get("Authorization")+" "+string(body))
+		w.Write([]byte(`[]`))
+	}))
+	defer server.Close()
+
+	spec, err := openapi.Parse([]byte(todoSpec))
+	require.NoError(t, err)
+
+	// The spec has no server URL
+	api := API{Name: "todo", Spec: spec, Auth: openapi.Auth{Type: openapi.AuthBearer, Token: "secret"}}
+	assert.EqualError(t, RegisterAPI(llm.NewToolbox(), api, Options{}), "the API todo has no absolute server URL, set its base_url")
+
+	api.Operations = []string{"listTodos", "deleteTodo"}
+	api.BaseURL = server.URL
+	assert.EqualError(t, RegisterAPI(llm.NewToolbox(), api, Options{}), `the API todo has no operation "deleteTodo"`)
+
+	// Requests that change data need to be confirmed
+	var sources []output.Source
+	var confirmed []string
+	allow := false
+	api.Operations = nil
+	toolbox := llm.NewToolbox()
+	require.NoError(t, RegisterAPI(toolbox, api, Options{
+		ConfirmRequest: func(request string) (bool, error) {
+			confirmed = append(confirmed, request)
+			return allow, nil
+		},
+		Cite: func(source output.Source) { sources = append(sources, source) },
+	}))
+	require.Len(t, toolbox.Tools(), 2)
+	assert.Equal(t, "todo_addTodo", toolbox.Tools()[0].Name)
+	assert.Equal(t, "GET /todos: List the todos", toolbox.Tools()[1].Description)
+	for _, tool := range toolbox.Tools() {
+		assert.True(t, json.Valid(tool.Parameters))
+	}
+
+	assert.Equal(t, "HTTP 200 OK\n\n[]", call(toolbox, "todo_listTodos", `{}`))
+	assert.Equal(t, []output.Source{{URL: server.URL + "/todos"}}, sources)
+
+	assert.Equal(t, "The user declined to send the request.", call(toolbox, "todo_addTodo", `{"body":{"title":"milk"}}`))
+	allow = true
+	assert.Equal(t, "HTTP 200 OK\n\n[]", call(toolbox, "todo_addTodo", `{"body":{"title":"milk"}}`))
+
+	// The credentials are never shown when the request is confirmed
+	assert.Equal(t, []string{
+		"POST " + server.URL + `/todos {"title":"milk"}`,
+		"POST " + server.URL + `/todos {"title":"milk"}`,
+	}, confirmed)
+	assert.Equal(t, []string{
+		"GET /todos Bearer secret ",
+		`POST /todos Bearer secret {"title":"milk"}`,
+	}, requests)
+
+	// Without a terminal only reading requests are sent
+	toolbox = llm.NewToolbox()
+	require.NoError(t, RegisterAPI(toolbox, api, Options{}))
+	assert.Contains(t, call(toolbox, "todo_addTodo", `{}`), "not possible without a terminal")
+	assert.Len(t, requests, 2)
+}
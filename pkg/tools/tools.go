@@ -0,0 +1,361 @@
+// Package tools provides the tools the model can call in agent mode: the
+// built-in ones for running shell commands, reading files, fetching URLs and
+// searching the web, and the operations of REST APIs described by OpenAPI
+// specs.
+package tools
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/Turee/si/pkg/fetch"
+	"github.com/Turee/si/pkg/llm"
+	"github.com/Turee/si/pkg/output"
+	"github.com/Turee/si/pkg/search"
+)
+
+// Names of the built-in tools
+const (
+	Shell     = "shell"
+	ReadFile  = "read_file"
+	Fetch     = "fetch"
+	WebSearch = "web_search"
+)
+
+// DefaultSearchResults is the number of results of a web search unless
+// configured otherwise
+const DefaultSearchResults = 5
+
+// MaxOutput is the largest tool result given to the model; longer output is
+// truncated
+const MaxOutput = 32 * 1024
+
+// fetchTimeout limits how long fetching a URL may take
+const fetchTimeout = 30 * time.Second
+
+// Options configures the built-in tools
+type Options struct {
+	// Shell is the command line used to run commands, e.g. ["/bin/sh", "-c"]
+	Shell []string
+
+	// Confirm asks the user whether a shell command may run. Without it no
+	// command is run.
+	Confirm func(command string) (bool, error)
+
+	// ConfirmRequest asks the user whether a request to an API that may
+	// change data may be sent. Without it only reading requests are sent.
+	ConfirmRequest func(request string) (bool, error)
+
+	// Policy restricts the hosts URLs may be fetched from
+	Policy *fetch.Policy
+
+	// Search is the search engine of the web_search tool, which is only
+	// available with one
+	Search search.Searcher
+
+	// SearchResults is the number of results of a web search (default: 5)
+	SearchResults int
+
+	// Cite is called with every file that was read and every URL that was
+	// fetched, so the answer can cite them
+	Cite func(source output.Source)
+
+	// Redact replaces secrets in the results of the tools before the model
+	// sees them
+	Redact func(text string) string
+}
+
+// cite reports a source the model was given, if sources are collected
+func (o Options) cite(source output.Source) {
+	if o.Cite != nil {
+		o.Cite(source)
+	}
+}
+
+// redact wraps the tool function so its results are redacted, if results
+// are redacted
+func (o Options) redact(fn llm.ToolFunc) llm.ToolFunc {
+	if o.Redact == nil {
+		return fn
+	}
+	return func(ctx context.Context, arguments json.RawMessage) (string, error) {
+		result, err := fn(ctx, arguments)
+		return o.Redact(result), err
+	}
+}
+
+// builtin is a built-in tool
+type builtin struct {
+	tool llm.Tool
+	fn   func(opts Options) llm.ToolFunc
+
+	// requires returns why the tool can't be used with the options, if it
+	// can't
+	requires func(opts Options) error
+}
+
+var builtins = map[string]builtin{
+	Shell: {
+		tool: llm.Tool{
+			Name:        Shell,
+			Description: "Run a shell command and return its output and exit code. The user is asked to confirm every command.",
+			Parameters:  json.RawMessage(`{"type":"object","properties":{"command":{"type":"string","description":"The command line to run"}},"required":["command"]}`),
+		},
+		fn: shellTool,
+	},
+	ReadFile: {
+		tool: llm.Tool{
+			Name:        ReadFile,
+			Description: "Read a text file, or list the entries of a directory.",
+			Parameters:  json.RawMessage(`{"type":"object","properties":{"path":{"type":"string","description":"Path of the file or directory"}},"required":["path"]}`),
+		},
+		fn: readFileTool,
+	},
+	Fetch: {
+		tool: llm.Tool{
+			Name:        Fetch,
+			Description: "Fetch a URL with an HTTP GET request and return the response body.",
+			Parameters:  json.RawMessage(`{"type":"object","properties":{"url":{"type":"string","description":"The http or https URL"}},"required":["url"]}`),
+		},
+		fn: fetchTool,
+	},
+	WebSearch: {
+		tool: llm.Tool{
+			Name:        WebSearch,
+			Description: "Search the web and return the titles, URLs and snippets of the results. Fetch a result to read the whole page.",
+			Parameters:  json.RawMessage(`{"type":"object","properties":{"query":{"type":"string","description":"The search query"}},"required":["query"]}`),
+		},
+		fn: webSearchTool,
+		requires: func(opts Options) error {
+			if opts.Search == nil {
+				return errors.New("the web_search tool needs a search engine, set search.backend in the config")
+			}
+			return nil
+		},
+	},
+}
+
+// Names returns the names of the built-in tools
+func Names() []string {
+	names := make([]string, 0, len(builtins))
+	for name := range builtins {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Register adds the named built-in tools to the toolbox, or all of them that
+// can be used with the options if no names are given
+func Register(toolbox *llm.Toolbox, names []string, opts Options) error {
+	all := len(names) == 0
+	if all {
+		names = Names()
+	}
+
+	for _, name := range names {
+		b, ok := builtins[name]
+		if !ok {
+			return fmt.Errorf("unknown tool %q (available: %s)", name, strings.Join(Names(), ", "))
+		}
+		if b.requires != nil {
+			if err := b.requires(opts); err != nil {
+				if all {
+					continue
+				}
+				return err
+			}
+		}
+		toolbox.Add(b.tool, opts.redact(b.fn(opts)))
+	}
+	return nil
+}
+
+// shellTool runs confirmed commands in the user's shell
+func shellTool(opts Options) llm.ToolFunc {
+	return func(ctx context.Context, arguments json.RawMessage) (string, error) {
+		var args struct {
+			Command string `json:"command"`
+		}
+		if err := json.Unmarshal(arguments, &args); err != nil || strings.TrimSpace(args.Command) == "" {
+			return "", errors.New("a command is required")
+		}
+
+		if opts.Confirm == nil {
+			return "", errors.New("running commands is not possible without a terminal to confirm them")
+		}
+		ok, err := opts.Confirm(args.Command)
+		if err != nil {
+			return "", err
+		}
+		if !ok {
+			return "The user declined to run the command.", nil
+		}
+
+		shell := opts.Shell
+		if len(shell) == 0 {
+			shell = []string{"/bin/sh", "-c"}
+		}
+		cmd := exec.CommandContext(ctx, shell[0], append(shell[1:], args.Command)...)
+		var output bytes.Buffer
+		cmd.Stdout, cmd.Stderr = &output, &output
+
+		exitCode := 0
+		err = cmd.Run()
+		var exitErr *exec.ExitError
+		switch {
+		case errors.As(err, &exitErr):
+			exitCode = exitErr.ExitCode()
+		case err != nil:
+			return "", err
+		}
+
+		result := fmt.Sprintf("exit code %d", exitCode)
+		if output.Len() > 0 {
+			result = strings.TrimRight(truncate(output.String()), "\n") + "\n" + result
+		}
+		return result, nil
+	}
+}
+
+// readFileTool reads files and lists directories
+func readFileTool(opts Options) llm.ToolFunc {
+	return func(ctx context.Context, arguments json.RawMessage) (string, error) {
+		var args struct {
+			Path string `json:"path"`
+		}
+		if err := json.Unmarshal(arguments, &args); err != nil || args.Path == "" {
+			return "", errors.New("a path is required")
+		}
+
+		info, err := os.Stat(args.Path)
+		if err != nil {
+			return "", err
+		}
+
+		if info.IsDir() {
+			entries, err := os.ReadDir(args.Path)
+			if err != nil {
+				return "", err
+			}
+			var b strings.Builder
+			for _, entry := range entries {
+				b.WriteString(entry.Name())
+				if entry.IsDir() {
+					b.WriteString("/")
+				}
+				b.WriteString("\n")
+			}
+			return truncate(b.String()), nil
+		}
+
+		f, err := os.Open(args.Path)
+		if err != nil {
+			return "", err
+		}
+		defer f.Close()
+
+		data, err := io.ReadAll(io.LimitReader(f, MaxOutput+1))
+		if err != nil {
+			return "", err
+		}
+		if bytes.IndexByte(data, 0) >= 0 {
+			return "", fmt.Errorf("%s is a binary file", args.Path)
+		}
+		opts.cite(output.Source{Path: args.Path})
+		return truncate(string(data)), nil
+	}
+}
+
+// fetchTool fetches URLs from the hosts the policy allows
+func fetchTool(opts Options) llm.ToolFunc {
+	policy := opts.Policy
+	if policy == nil {
+		policy = fetch.NewPolicy(nil, true)
+	}
+	client := policy.Client(&http.Client{Timeout: fetchTimeout})
+
+	return func(ctx context.Context, arguments json.RawMessage) (string, error) {
+		var args struct {
+			URL string `json:"url"`
+		}
+		if err := json.Unmarshal(arguments, &args); err != nil || args.URL == "" {
+			return "", errors.New("a URL is required")
+		}
+		if err := policy.Check(args.URL); err != nil {
+			return "", err
+		}
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, args.URL, nil)
+		if err != nil {
+			return "", err
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return "", err
+		}
+		defer resp.Body.Close()
+
+		body, err := io.ReadAll(io.LimitReader(resp.Body, MaxOutput+1))
+		if err != nil {
+			return "", err
+		}
+		if resp.StatusCode < http.StatusBadRequest {
+			opts.cite(output.Source{URL: args.URL})
+		}
+		return fmt.Sprintf("HTTP %s\n\n%s", resp.Status, truncate(string(body))), nil
+	}
+}
+
+// webSearchTool searches the web with the configured search engine. The
+// results are cited as sources.
+func webSearchTool(opts Options) llm.ToolFunc {
+	count := opts.SearchResults
+	if count <= 0 {
+		count = DefaultSearchResults
+	}
+
+	return func(ctx context.Context, arguments json.RawMessage) (string, error) {
+		var args struct {
+			Query string `json:"query"`
+		}
+		if err := json.Unmarshal(arguments, &args); err != nil || strings.TrimSpace(args.Query) == "" {
+			return "", errors.New("a query is required")
+		}
+
+		ctx, cancel := context.WithTimeout(ctx, fetchTimeout)
+		defer cancel()
+		results, err := opts.Search.Search(ctx, args.Query, count)
+		if err != nil {
+			return "", err
+		}
+		for _, result := range results {
+			opts.cite(output.Source{URL: result.URL})
+		}
+		return truncate(search.Format(results)), nil
+	}
+}
+
+// truncate shortens output to MaxOutput bytes, noting that it was truncated
+func truncate(output string) string {
+	if len(output) <= MaxOutput {
+		return output
+	}
+
+	cut := MaxOutput
+	for cut > 0 && !utf8.RuneStart(output[cut]) {
+		cut--
+	}
+	return output[:cut] + "\n[output truncated]"
+}
@@ -0,0 +1,179 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/Turee/si/pkg/fetch"
+	"github.com/Turee/si/pkg/llm"
+	"github.com/Turee/si/pkg/output"
+	"github.com/Turee/si/pkg/search"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// call calls a tool of the toolbox with the arguments
+func call(toolbox *llm.Toolbox, name, arguments string) string {
+	return toolbox.Call(context.Background(), llm.ToolCall{Name: name, Arguments: arguments})
+}
+
+// TestRegister tests selecting built-in tools
+func TestRegister(t *testing.T) {
+	toolbox := llm.NewToolbox()
+	require.NoError(t, Register(toolbox, nil, Options{}))
+	assert.Len(t, toolbox.Tools(), 3)
+
+	toolbox = llm.NewToolbox()
+	require.NoError(t, Register(toolbox, []string{ReadFile}, Options{}))
+	assert.Equal(t, ReadFile, toolbox.Tools()[0].Name)
+	assert.Len(t, toolbox.Tools(), 1)
+
+	for _, tool := range toolbox.Tools() {
+		assert.True(t, json.Valid(tool.Parameters))
+	}
+
+	assert.EqualError(t, Register(toolbox, []string{"rm"}, Options{}), `unknown tool "rm" (available: fetch, read_file, shell, web_search)`)
+
+	// web_search is only available with a search engine
+	assert.EqualError(t, Register(toolbox, []string{WebSearch}, Options{}), "the web_search tool needs a search engine, set search.backend in the config")
+	toolbox = llm.NewToolbox()
+	require.NoError(t, Register(toolbox, nil, Options{Search: &fakeSearcher{}}))
+	assert.Len(t, toolbox.Tools(), 4)
+}
+
+// TestShellTool tests that commands only run when confirmed
+func TestShellTool(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses a POSIX shell")
+	}
+
+	var confirmed []string
+	allow := true
+	toolbox := llm.NewToolbox()
+	require.NoError(t, Register(toolbox, []string{Shell}, Options{Confirm: func(command string) (bool, error) {
+		confirmed = append(confirmed, command)
+		return allow, nil
+	}}))
+
+	assert.Equal(t, "hello\nexit code 0", call(toolbox, Shell, `{"command":"echo hello"}`))
+	assert.Equal(t, "oops\nexit code 3", call(toolbox, Shell, `{"command":"echo oops >&2; exit 3"}`))
+
+	allow = false
+	assert.Equal(t, "The user declined to run the command.", call(toolbox, Shell, `{"command":"touch file"}`))
+	assert.Equal(t, []string{"echo hello", "echo oops >&2; exit 3", "touch file"}, confirmed)
+
+	assert.Equal(t, "error: a command is required", call(toolbox, Shell, `{}`))
+
+	// Without confirmation nothing runs
+	toolbox = llm.NewToolbox()
+	require.NoError(t, Register(toolbox, []string{Shell}, Options{}))
+	assert.Contains(t, call(toolbox, Shell, `{"command":"echo hello"}`), "without a terminal")
+}
+
+// TestReadFileTool tests reading files and listing directories
+func TestReadFileTool(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("hello"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "image.bin"), []byte{0x89, 0, 1}, 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "big.txt"), []byte(strings.Repeat("a", MaxOutput+10)), 0644))
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "sub"), 0755))
+
+	var cited []output.Source
+	toolbox := llm.NewToolbox()
+	require.NoError(t, Register(toolbox, []string{ReadFile}, Options{Cite: func(source output.Source) { cited = append(cited, source) }}))
+
+	assert.Equal(t, "hello", call(toolbox, ReadFile, `{"path":"`+filepath.Join(dir, "notes.txt")+`"}`))
+	assert.Equal(t, "big.txt\nimage.bin\nnotes.txt\nsub/\n", call(toolbox, ReadFile, `{"path":"`+dir+`"}`))
+	assert.Contains(t, call(toolbox, ReadFile, `{"path":"`+filepath.Join(dir, "image.bin")+`"}`), "is a binary file")
+	assert.True(t, strings.HasSuffix(call(toolbox, ReadFile, `{"path":"`+filepath.Join(dir, "big.txt")+`"}`), "\n[output truncated]"))
+	assert.Contains(t, call(toolbox, ReadFile, `{"path":"`+filepath.Join(dir, "missing")+`"}`), "error:")
+
+	// Only the files that were read are cited
+	assert.Equal(t, []output.Source{{Path: filepath.Join(dir, "notes.txt")}, {Path: filepath.Join(dir, "big.txt")}}, cited)
+
+	// Secrets in the results are redacted
+	toolbox = llm.NewToolbox()
+	require.NoError(t, Register(toolbox, []string{ReadFile}, Options{Redact: func(text string) string {
+		return strings.ReplaceAll(text, "hello", "[REDACTED]")
+	}}))
+	assert.Equal(t, "[REDACTED]", call(toolbox, ReadFile, `{"path":"`+filepath.Join(dir, "notes.txt")+`"}`))
+}
+
+// TestFetchTool tests fetching URLs within the allowlist
+func TestFetchTool(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte("page content"))
+	}))
+	defer server.Close()
+
+	var cited []output.Source
+	toolbox := llm.NewToolbox()
+	require.NoError(t, Register(toolbox, []string{Fetch}, Options{
+		Policy: fetch.NewPolicy([]string{"127.0.0.1"}, true),
+		Cite:   func(source output.Source) { cited = append(cited, source) },
+	}))
+	assert.Equal(t, "HTTP 200 OK\n\npage content", call(toolbox, Fetch, `{"url":"`+server.URL+`"}`))
+	assert.Contains(t, call(toolbox, Fetch, `{"url":"`+server.URL+`/missing"}`), "HTTP 404")
+	assert.Contains(t, call(toolbox, Fetch, `{"url":"https://attacker.test/?q=secret"}`), "fetching from attacker.test is not allowed")
+	assert.Equal(t, []output.Source{{URL: server.URL}}, cited)
+
+	// Without a policy nothing can be fetched
+	toolbox = llm.NewToolbox()
+	require.NoError(t, Register(toolbox, []string{Fetch}, Options{}))
+	assert.Contains(t, call(toolbox, Fetch, `{"url":"`+server.URL+`"}`), "is not allowed")
+}
+
+// fakeSearcher returns fixed results and records the last search
+type fakeSearcher struct {
+	results []search.Result
+	err     error
+	query   string
+	count   int
+}
+
+func (f *fakeSearcher) Search(ctx context.Context, query string, count int) ([]search.Result, error) {
+	f.query, f.count = query, count
+	return f.results, f.err
+}
+
+// TestWebSearchTool tests searching the web and citing the results
+func TestWebSearchTool(t *testing.T) {
+	searcher := &fakeSearcher{results: []search.Result{
+		{Title: "Go 1.22", URL: "https://go.dev/doc/go1.22", Snippet: "Release notes"},
+		{Title: "Blog", URL: "https://go.dev/blog"},
+	}}
+
+	var cited []output.Source
+	toolbox := llm.NewToolbox()
+	require.NoError(t, Register(toolbox, []string{WebSearch}, Options{
+		Search: searcher,
+		Cite:   func(source output.Source) { cited = append(cited, source) },
+	}))
+	assert.Equal(t, "1. Go 1.22\n   https://go.dev/doc/go1.22\n   Release notes\n\n2. Blog\n   https://go.dev/blog\n",
+		call(toolbox, WebSearch, `{"query":"go release"}`))
+	assert.Equal(t, "go release", searcher.query)
+	assert.Equal(t, DefaultSearchResults, searcher.count)
+	assert.Equal(t, []output.Source{{URL: "https://go.dev/doc/go1.22"}, {URL: "https://go.dev/blog"}}, cited)
+
+	assert.Contains(t, call(toolbox, WebSearch, `{"query":" "}`), "a query is required")
+
+	searcher.err = errors.New("search failed: 429 Too Many Requests")
+	assert.Contains(t, call(toolbox, WebSearch, `{"query":"go"}`), "429 Too Many Requests")
+
+	toolbox = llm.NewToolbox()
+	require.NoError(t, Register(toolbox, []string{WebSearch}, Options{Search: searcher, SearchResults: 2}))
+	call(toolbox, WebSearch, `{"query":"go"}`)
+	assert.Equal(t, 2, searcher.count)
+}
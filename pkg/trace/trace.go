@@ -0,0 +1,104 @@
+// Package trace keeps a local log of the conversations of the sub-agents of
+// agent mode, whose tool calls the user only sees summarized
+package trace
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/Turee/si/pkg/llm"
+	"github.com/Turee/si/pkg/paths"
+	"github.com/Turee/si/pkg/state"
+)
+
+// Record is the trace of a task delegated to a sub-agent
+type Record struct {
+	Time  time.Time `json:"time"`
+	Agent string    `json:"agent"`
+	Model string    `json:"model"`
+	Task  string    `json:"task"`
+
+	// Messages is the conversation of the sub-agent, including its tool
+	// calls and their results
+	Messages []llm.Message `json:"messages"`
+
+	// Usage is the token usage of the task
+	Usage llm.Usage `json:"usage"`
+
+	// Error is why the sub-agent stopped before answering, if it did
+	Error string `json:"error,omitempty"`
+}
+
+// DefaultPath returns the default path of the trace log, in paths.StateDir
+func DefaultPath() string {
+	dir := paths.StateDir()
+	if dir == "" {
+		return ""
+	}
+	return filepath.Join(dir, "traces.jsonl")
+}
+
+// Append adds the record to the trace log at path. Nothing is recorded in
+// read-only mode.
+func Append(path string, record Record) error {
+	if state.ReadOnly() {
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create trace directory: %w", err)
+	}
+
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open trace log: %w", err)
+	}
+	defer file.Close()
+
+	// The record is written as a single line, so concurrent invocations
+	// don't interleave
+	line, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to encode trace: %w", err)
+	}
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to write trace log: %w", err)
+	}
+	return nil
+}
+
+// Load reads all records of the trace log at path. A missing log has no
+// records; lines that can't be parsed are skipped.
+func Load(path string) ([]Record, error) {
+	file, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open trace log: %w", err)
+	}
+	defer file.Close()
+
+	var records []Record
+	reader := bufio.NewReader(file)
+	for {
+		line, err := reader.ReadBytes('\n')
+		var record Record
+		if len(line) > 0 && json.Unmarshal(line, &record) == nil {
+			records = append(records, record)
+		}
+		if errors.Is(err, io.EOF) {
+			return records, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read trace log: %w", err)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package trace
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Turee/si/pkg/llm"
+	"github.com/Turee/si/pkg/state"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestAppendLoad tests writing and reading back traces, including records
+// longer than the line limit of a bufio.Scanner
+func TestAppendLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state", "traces.jsonl")
+
+	records, err := Load(path)
+	require.NoError(t, err)
+	assert.Empty(t, records)
+
+	long := strings.Repeat("x", 100*1024)
+	first := Record{
+		Time:     time.Date(2025, 3, 14, 12, 0, 0, 0, time.UTC),
+		Agent:    "search",
+		Model:    "gpt-4o",
+		Task:     "find the notes",
+		Messages: []llm.Message{llm.NewUserMessage("find the notes"), {Role: llm.RoleAssistant, Content: long}},
+		Usage:    llm.Usage{TotalTokens: 20},
+	}
+	require.NoError(t, Append(path, first))
+	require.NoError(t, Append(path, Record{Agent: "search", Error: "budget used up"}))
+
+	// Lines that can't be parsed are skipped
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0)
+	require.NoError(t, err)
+	f.WriteString("not json\n")
+	f.Close()
+
+	records, err = Load(path)
+	require.NoError(t, err)
+	require.Len(t, records, 2)
+	assert.Equal(t, first.Task, records[0].Task)
+	assert.Equal(t, long, records[0].Messages[1].Content)
+	assert.Equal(t, 20, records[0].Usage.TotalTokens)
+	assert.Equal(t, "budget used up", records[1].Error)
+}
+
+// TestAppendReadOnly tests that nothing is recorded in read-only mode
+func TestAppendReadOnly(t *testing.T) {
+	state.SetReadOnly(true)
+	defer state.SetReadOnly(false)
+
+	path := filepath.Join(t.TempDir(), "traces.jsonl")
+	require.NoError(t, Append(path, Record{Agent: "search"}))
+	assert.NoFileExists(t, path)
+}
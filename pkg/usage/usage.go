@@ -0,0 +1,242 @@
+// Package usage keeps a local log of the token usage and cost of requests
+package usage
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Turee/si/pkg/llm"
+	"github.com/Turee/si/pkg/paths"
+	"github.com/Turee/si/pkg/pricing"
+	"github.com/Turee/si/pkg/state"
+)
+
+// Record is the usage of a single request
+type Record struct {
+	Time  time.Time `json:"time"`
+	Model string    `json:"model"`
+
+	// Session groups the requests of a run, or of the runs sharing a session
+	// name. Records from before sessions were recorded have none.
+	Session string `json:"session,omitempty"`
+
+	llm.Usage
+
+	// Cost is the estimated cost in US dollars, nil if the price of the
+	// model is unknown
+	Cost *float64 `json:"cost_usd,omitempty"`
+}
+
+// NewRecord creates a record for a request made now, estimating its cost
+func NewRecord(model string, u llm.Usage) Record {
+	record := Record{Time: time.Now(), Model: model, Usage: u}
+	if cost, ok := pricing.Estimate(model, u); ok {
+		record.Cost = &cost
+	}
+	return record
+}
+
+// DefaultPath returns the default path of the usage log, in paths.StateDir.
+// A log at the legacy path is used until MoveLegacy moves it.
+func DefaultPath() string {
+	return paths.Resolve(logFile(paths.StateDir()), logFile(paths.LegacyStateDir()))
+}
+
+// MoveLegacy moves a usage log from ~/.local/state/si, where it was kept on
+// every platform, to the default path. It returns the new path if the log
+// was moved.
+func MoveLegacy() (string, error) {
+	path := logFile(paths.StateDir())
+	moved, err := paths.MoveLegacy(logFile(paths.LegacyStateDir()), path)
+	if !moved {
+		return "", err
+	}
+	return path, err
+}
+
+// logFile returns the path of the usage log in dir
+func logFile(dir string) string {
+	if dir == "" {
+		return ""
+	}
+	return filepath.Join(dir, "usage.jsonl")
+}
+
+// Append adds the records to the usage log at path. Nothing is recorded in
+// read-only mode.
+func Append(path string, records ...Record) error {
+	if state.ReadOnly() {
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create usage directory: %w", err)
+	}
+
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open usage log: %w", err)
+	}
+	defer file.Close()
+
+	// Every record is written as a single line, so concurrent invocations
+	// don't interleave
+	for _, record := range records {
+		line, err := json.Marshal(record)
+		if err != nil {
+			return fmt.Errorf("failed to encode usage: %w", err)
+		}
+		if _, err := file.Write(append(line, '\n')); err != nil {
+			return fmt.Errorf("failed to write usage log: %w", err)
+		}
+	}
+	return nil
+}
+
+// Load reads all records of the usage log at path. A missing log has no
+// records; lines that can't be parsed are skipped.
+func Load(path string) ([]Record, error) {
+	file, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open usage log: %w", err)
+	}
+	defer file.Close()
+
+	var records []Record
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var record Record
+		if err := json.Unmarshal(scanner.Bytes(), &record); err == nil {
+			records = append(records, record)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read usage log: %w", err)
+	}
+	return records, nil
+}
+
+// Summary is the total usage of a model on a day, or of a session
+type Summary struct {
+	Date     string
+	Model    string
+	Session  string
+	Requests int
+	llm.Usage
+	Cost float64
+
+	// Unpriced is the number of requests whose cost is unknown
+	Unpriced int
+}
+
+// CacheHitRate returns the share of prompt tokens served from the cache
+func (s Summary) CacheHitRate() float64 {
+	if s.PromptTokens == 0 {
+		return 0
+	}
+	return float64(s.CachedTokens) / float64(s.PromptTokens)
+}
+
+// add adds a record to the summary
+func (s *Summary) add(record Record) {
+	s.Requests++
+	s.Usage.Add(record.Usage)
+	if record.Cost != nil {
+		s.Cost += *record.Cost
+	} else {
+		s.Unpriced++
+	}
+}
+
+// Summarize totals the records since the given time per day and model,
+// sorted by date and model, and returns the grand total
+func Summarize(records []Record, since time.Time) ([]Summary, Summary) {
+	byKey := map[[2]string]*Summary{}
+	var total Summary
+
+	for _, record := range records {
+		if record.Time.Before(since) {
+			continue
+		}
+
+		key := [2]string{record.Time.Local().Format("2006-01-02"), record.Model}
+		summary, ok := byKey[key]
+		if !ok {
+			summary = &Summary{Date: key[0], Model: key[1]}
+			byKey[key] = summary
+		}
+		summary.add(record)
+		total.add(record)
+	}
+
+	summaries := make([]Summary, 0, len(byKey))
+	for _, summary := range byKey {
+		summaries = append(summaries, *summary)
+	}
+	sort.Slice(summaries, func(i, j int) bool {
+		if summaries[i].Date != summaries[j].Date {
+			return summaries[i].Date < summaries[j].Date
+		}
+		return summaries[i].Model < summaries[j].Model
+	})
+
+	return summaries, total
+}
+
+// SummarizeSessions totals the records since the given time per session,
+// sorted by the start of the session, and returns the grand total. Date is
+// the start of the session and Model lists the models it used. Records
+// without a session are left out.
+func SummarizeSessions(records []Record, since time.Time) ([]Summary, Summary) {
+	bySession := map[string]*Summary{}
+	var sessions []*Summary
+	starts := map[string]time.Time{}
+	models := map[string][]string{}
+	var total Summary
+
+	for _, record := range records {
+		if record.Time.Before(since) || record.Session == "" {
+			continue
+		}
+
+		summary, ok := bySession[record.Session]
+		if !ok {
+			summary = &Summary{Session: record.Session}
+			bySession[record.Session] = summary
+			sessions = append(sessions, summary)
+		}
+		if start, ok := starts[record.Session]; !ok || record.Time.Before(start) {
+			starts[record.Session] = record.Time
+		}
+		if !slices.Contains(models[record.Session], record.Model) {
+			models[record.Session] = append(models[record.Session], record.Model)
+		}
+		summary.add(record)
+		total.add(record)
+	}
+
+	summaries := make([]Summary, len(sessions))
+	for i, summary := range sessions {
+		summary.Date = starts[summary.Session].Local().Format("2006-01-02 15:04")
+		sort.Strings(models[summary.Session])
+		summary.Model = strings.Join(models[summary.Session], ",")
+		summaries[i] = *summary
+	}
+	sort.SliceStable(summaries, func(i, j int) bool {
+		return starts[summaries[i].Session].Before(starts[summaries[j].Session])
+	})
+
+	return summaries, total
+}
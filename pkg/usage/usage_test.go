@@ -0,0 +1,120 @@
+package usage
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Turee/si/pkg/llm"
+	"github.com/Turee/si/pkg/state"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestAppendAndLoad tests writing and reading the usage log
+func TestAppendAndLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state", "usage.jsonl")
+
+	records, err := Load(path)
+	require.NoError(t, err)
+	assert.Empty(t, records)
+
+	first := NewRecord("gpt-4", llm.Usage{PromptTokens: 1000, CompletionTokens: 500, TotalTokens: 1500})
+	second := NewRecord("llama3", llm.Usage{PromptTokens: 10, CompletionTokens: 5, TotalTokens: 15})
+	require.NoError(t, Append(path, first))
+	require.NoError(t, Append(path, second))
+
+	// The log is only readable by the user
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	// Broken lines are skipped
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	require.NoError(t, err)
+	file.WriteString("{broken\n")
+	file.Close()
+
+	records, err = Load(path)
+	require.NoError(t, err)
+	require.Len(t, records, 2)
+	assert.Equal(t, "gpt-4", records[0].Model)
+	assert.Equal(t, 1000, records[0].PromptTokens)
+	require.NotNil(t, records[0].Cost)
+	assert.InDelta(t, 0.06, *records[0].Cost, 1e-9)
+	assert.Nil(t, records[1].Cost)
+}
+
+// TestAppendReadOnly tests that nothing is recorded in read-only mode
+func TestAppendReadOnly(t *testing.T) {
+	state.SetReadOnly(true)
+	defer state.SetReadOnly(false)
+
+	path := filepath.Join(t.TempDir(), "state", "usage.jsonl")
+	require.NoError(t, Append(path, NewRecord("gpt-4", llm.Usage{PromptTokens: 10})))
+	assert.NoDirExists(t, filepath.Dir(path))
+}
+
+// TestSummarize tests totaling usage per day and model
+func TestSummarize(t *testing.T) {
+	day1 := time.Date(2025, 3, 1, 12, 0, 0, 0, time.Local)
+	day2 := day1.AddDate(0, 0, 1)
+	cost := 0.5
+
+	records := []Record{
+		{Time: day1.AddDate(0, 0, -10), Model: "gpt-4o", Usage: llm.Usage{PromptTokens: 999}, Cost: &cost},
+		{Time: day2, Model: "gpt-4o", Usage: llm.Usage{PromptTokens: 100, CachedTokens: 50}, Cost: &cost},
+		{Time: day1, Model: "gpt-4o", Usage: llm.Usage{PromptTokens: 100, CompletionTokens: 10}, Cost: &cost},
+		{Time: day1, Model: "gpt-4o", Usage: llm.Usage{PromptTokens: 300, CachedTokens: 100}, Cost: &cost},
+		{Time: day1, Model: "llama3", Usage: llm.Usage{PromptTokens: 10}},
+	}
+
+	summaries, total := Summarize(records, day1.AddDate(0, 0, -1))
+	require.Len(t, summaries, 3)
+
+	assert.Equal(t, "2025-03-01", summaries[0].Date)
+	assert.Equal(t, "gpt-4o", summaries[0].Model)
+	assert.Equal(t, 2, summaries[0].Requests)
+	assert.Equal(t, 400, summaries[0].PromptTokens)
+	assert.Equal(t, 1.0, summaries[0].Cost)
+	assert.Equal(t, 0.25, summaries[0].CacheHitRate())
+
+	assert.Equal(t, "llama3", summaries[1].Model)
+	assert.Equal(t, 1, summaries[1].Unpriced)
+
+	assert.Equal(t, "2025-03-02", summaries[2].Date)
+	assert.Equal(t, 0.5, summaries[2].CacheHitRate())
+
+	assert.Equal(t, 4, total.Requests)
+	assert.Equal(t, 510, total.PromptTokens)
+	assert.Equal(t, 1.5, total.Cost)
+	assert.Equal(t, 1, total.Unpriced)
+}
+
+// TestSummarizeSessions tests totaling usage per session
+func TestSummarizeSessions(t *testing.T) {
+	start := time.Date(2025, 3, 1, 12, 0, 0, 0, time.Local)
+
+	records := []Record{
+		{Time: start.Add(time.Hour), Model: "gpt-4o", Session: "b", Usage: llm.Usage{PromptTokens: 100}},
+		{Time: start, Model: "gpt-4o", Session: "a", Usage: llm.Usage{PromptTokens: 100}},
+		{Time: start.Add(2 * time.Hour), Model: "claude-sonnet", Session: "a", Usage: llm.Usage{PromptTokens: 300, CachedTokens: 300}},
+		{Time: start, Model: "gpt-4o", Usage: llm.Usage{PromptTokens: 999}},
+	}
+
+	summaries, total := SummarizeSessions(records, time.Time{})
+	require.Len(t, summaries, 2)
+
+	assert.Equal(t, "a", summaries[0].Session)
+	assert.Equal(t, "2025-03-01 12:00", summaries[0].Date)
+	assert.Equal(t, "claude-sonnet,gpt-4o", summaries[0].Model)
+	assert.Equal(t, 2, summaries[0].Requests)
+	assert.Equal(t, 0.75, summaries[0].CacheHitRate())
+
+	assert.Equal(t, "b", summaries[1].Session)
+	assert.Equal(t, 0.0, summaries[1].CacheHitRate())
+
+	assert.Equal(t, 3, total.Requests)
+	assert.Equal(t, 500, total.PromptTokens)
+}
@@ -1,5 +1,10 @@
 package version
 
+import (
+	"runtime"
+	"runtime/debug"
+)
+
 // Version information set by build process
 var (
 	// Version is the current version of the application
@@ -12,7 +17,68 @@ var (
 	BuildDate = "unknown"
 )
 
+// readBuildInfo can be replaced in tests
+var readBuildInfo = debug.ReadBuildInfo
+
+// BuildInfo describes the running build of the application
+type BuildInfo struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	BuildDate string `json:"build_date"`
+	GoVersion string `json:"go_version"`
+	OS        string `json:"os"`
+	Arch      string `json:"arch"`
+}
+
+// Get returns the build information. Values not set by the build process are
+// taken from the module and VCS information embedded by the Go toolchain.
+func Get() BuildInfo {
+	info := BuildInfo{
+		Version:   Version,
+		Commit:    Commit,
+		BuildDate: BuildDate,
+		GoVersion: runtime.Version(),
+		OS:        runtime.GOOS,
+		Arch:      runtime.GOARCH,
+	}
+
+	bi, ok := readBuildInfo()
+	if !ok {
+		return info
+	}
+
+	if info.Version == "dev" && bi.Main.Version != "" && bi.Main.Version != "(devel)" {
+		info.Version = bi.Main.Version
+	}
+
+	var revision, modified, time string
+	for _, setting := range bi.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			revision = setting.Value
+		case "vcs.modified":
+			modified = setting.Value
+		case "vcs.time":
+			time = setting.Value
+		}
+	}
+
+	if info.Commit == "unknown" && revision != "" {
+		info.Commit = revision
+		if modified == "true" {
+			info.Commit += "-dirty"
+		}
+	}
+
+	if info.BuildDate == "unknown" && time != "" {
+		info.BuildDate = time
+	}
+
+	return info
+}
+
 // Info returns a string with version information
 func Info() string {
-	return "Version: " + Version + " Commit: " + Commit + " BuildDate: " + BuildDate
+	info := Get()
+	return "Version: " + info.Version + " Commit: " + info.Commit + " BuildDate: " + info.BuildDate
 }
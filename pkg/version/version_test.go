@@ -0,0 +1,68 @@
+package version
+
+import (
+	"runtime"
+	"runtime/debug"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// withBuildInfo replaces the build information embedded by the Go toolchain
+func withBuildInfo(t *testing.T, bi *debug.BuildInfo) {
+	t.Helper()
+
+	oldReadBuildInfo := readBuildInfo
+	t.Cleanup(func() { readBuildInfo = oldReadBuildInfo })
+	readBuildInfo = func() (*debug.BuildInfo, bool) {
+		return bi, bi != nil
+	}
+}
+
+// TestGetFallsBackToBuildInfo tests using VCS information when no values were set at build time
+func TestGetFallsBackToBuildInfo(t *testing.T) {
+	withBuildInfo(t, &debug.BuildInfo{
+		Main: debug.Module{Version: "v1.2.3"},
+		Settings: []debug.BuildSetting{
+			{Key: "vcs.revision", Value: "abc123"},
+			{Key: "vcs.modified", Value: "true"},
+			{Key: "vcs.time", Value: "2025-03-12T10:00:00Z"},
+		},
+	})
+
+	info := Get()
+	assert.Equal(t, "v1.2.3", info.Version)
+	assert.Equal(t, "abc123-dirty", info.Commit)
+	assert.Equal(t, "2025-03-12T10:00:00Z", info.BuildDate)
+	assert.Equal(t, runtime.GOOS, info.OS)
+	assert.Equal(t, runtime.GOARCH, info.Arch)
+	assert.Equal(t, runtime.Version(), info.GoVersion)
+	assert.Equal(t, "Version: v1.2.3 Commit: abc123-dirty BuildDate: 2025-03-12T10:00:00Z", Info())
+}
+
+// TestGetPrefersBuildValues tests that values set by the build process take precedence
+func TestGetPrefersBuildValues(t *testing.T) {
+	oldVersion, oldCommit, oldBuildDate := Version, Commit, BuildDate
+	defer func() { Version, Commit, BuildDate = oldVersion, oldCommit, oldBuildDate }()
+	Version, Commit, BuildDate = "1.0.0", "def456", "2025-03-13T00:00:00Z"
+
+	withBuildInfo(t, &debug.BuildInfo{
+		Main:     debug.Module{Version: "(devel)"},
+		Settings: []debug.BuildSetting{{Key: "vcs.revision", Value: "abc123"}},
+	})
+
+	info := Get()
+	assert.Equal(t, "1.0.0", info.Version)
+	assert.Equal(t, "def456", info.Commit)
+	assert.Equal(t, "2025-03-13T00:00:00Z", info.BuildDate)
+}
+
+// TestGetWithoutBuildInfo tests the defaults when no build information is available
+func TestGetWithoutBuildInfo(t *testing.T) {
+	withBuildInfo(t, nil)
+
+	info := Get()
+	assert.Equal(t, "dev", info.Version)
+	assert.Equal(t, "unknown", info.Commit)
+	assert.Equal(t, "unknown", info.BuildDate)
+}
@@ -0,0 +1,100 @@
+// Package workspace finds the memory file of the project si runs in: standing
+// instructions for every request, such as conventions of the repository.
+package workspace
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"unicode/utf8"
+)
+
+// MemoryFiles are the names of memory files, relative to a directory, in the
+// order they are looked for
+var MemoryFiles = []string{"SI.md", filepath.Join(".si", "instructions.md")}
+
+// Memory is the content of a memory file
+type Memory struct {
+	// Path is the path of the memory file
+	Path string
+
+	// Content is the content of the file, up to the size limit
+	Content string
+
+	// Truncated is true when the file exceeds the size limit
+	Truncated bool
+}
+
+// FindMemory returns the path of the memory file closest to dir, looking in
+// dir and its parents up to the root of the git repository dir is in. Outside
+// of a repository only dir itself is searched. It returns an empty path if
+// there is no memory file.
+func FindMemory(dir string) (string, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	root := repositoryRoot(dir)
+
+	for {
+		for _, name := range MemoryFiles {
+			path := filepath.Join(dir, name)
+			if info, err := os.Stat(path); err == nil && info.Mode().IsRegular() {
+				return path, nil
+			}
+		}
+
+		parent := filepath.Dir(dir)
+		if dir == root || parent == dir {
+			return "", nil
+		}
+		dir = parent
+	}
+}
+
+// LoadMemory finds and reads the memory file for dir. Content beyond
+// maxSize bytes is cut off. It returns nil if there is no memory file.
+func LoadMemory(dir string, maxSize int) (*Memory, error) {
+	path, err := FindMemory(dir)
+	if err != nil || path == "" {
+		return nil, err
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	data, err := io.ReadAll(io.LimitReader(f, int64(maxSize)+1))
+	if err != nil {
+		return nil, err
+	}
+
+	memory := &Memory{Path: path}
+	if len(data) > maxSize {
+		cut := maxSize
+		for cut > 0 && !utf8.RuneStart(data[cut]) {
+			cut--
+		}
+		data, memory.Truncated = data[:cut], true
+	}
+	memory.Content = string(data)
+	return memory, nil
+}
+
+// repositoryRoot returns the closest directory containing dir that has a .git
+// entry, or dir itself if there is none
+func repositoryRoot(dir string) string {
+	for current := dir; ; {
+		if _, err := os.Stat(filepath.Join(current, ".git")); err == nil {
+			return current
+		}
+
+		parent := filepath.Dir(current)
+		if parent == current {
+			return dir
+		}
+		current = parent
+	}
+}
@@ -0,0 +1,81 @@
+package workspace
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeFile creates a file with its parent directories
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+	require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+}
+
+// TestFindMemory tests finding the memory file within the repository
+func TestFindMemory(t *testing.T) {
+	outside := t.TempDir()
+	repo := filepath.Join(outside, "repo")
+	sub := filepath.Join(repo, "pkg", "sub")
+	require.NoError(t, os.MkdirAll(filepath.Join(repo, ".git"), 0755))
+	require.NoError(t, os.MkdirAll(sub, 0755))
+
+	// Memory files outside of the repository are ignored
+	writeFile(t, filepath.Join(outside, "SI.md"), "outside")
+	path, err := FindMemory(sub)
+	require.NoError(t, err)
+	assert.Empty(t, path)
+
+	writeFile(t, filepath.Join(repo, ".si", "instructions.md"), "repo")
+	path, err = FindMemory(sub)
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(repo, ".si", "instructions.md"), path)
+
+	// SI.md takes precedence, and closer files win
+	writeFile(t, filepath.Join(repo, "SI.md"), "repo")
+	path, err = FindMemory(sub)
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(repo, "SI.md"), path)
+
+	writeFile(t, filepath.Join(repo, "pkg", "SI.md"), "pkg")
+	path, err = FindMemory(sub)
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(repo, "pkg", "SI.md"), path)
+
+	// Outside of a repository only the directory itself is searched
+	plain := filepath.Join(outside, "plain", "dir")
+	require.NoError(t, os.MkdirAll(plain, 0755))
+	path, err = FindMemory(plain)
+	require.NoError(t, err)
+	assert.Empty(t, path)
+
+	path, err = FindMemory(outside)
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(outside, "SI.md"), path)
+}
+
+// TestLoadMemory tests reading the memory file up to the size limit
+func TestLoadMemory(t *testing.T) {
+	dir := t.TempDir()
+
+	memory, err := LoadMemory(dir, 1024)
+	require.NoError(t, err)
+	assert.Nil(t, memory)
+
+	writeFile(t, filepath.Join(dir, "SI.md"), "Use tabs.\n")
+	memory, err = LoadMemory(dir, 1024)
+	require.NoError(t, err)
+	assert.Equal(t, &Memory{Path: filepath.Join(dir, "SI.md"), Content: "Use tabs.\n"}, memory)
+
+	// Truncation doesn't split characters
+	writeFile(t, filepath.Join(dir, "SI.md"), "ab"+strings.Repeat("é", 10))
+	memory, err = LoadMemory(dir, 5)
+	require.NoError(t, err)
+	assert.Equal(t, "abé", memory.Content)
+	assert.True(t, memory.Truncated)
+}